@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/discovery"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/healthcheck"
+)
+
+// healthChecks runs the health check of every backend until ctx is done or
+// the backend is stopped, so backends that discovery removes stop being
+// checked.
+type healthChecks struct {
+	ctx      context.Context
+	interval time.Duration
+	log      *slog.Logger
+
+	mu      sync.Mutex
+	checks  map[*backend.Backend]healthcheck.Checker
+	cancels map[*backend.Backend]context.CancelFunc
+}
+
+func newHealthChecks(ctx context.Context, interval time.Duration, log *slog.Logger) *healthChecks {
+	return &healthChecks{
+		ctx:      ctx,
+		interval: interval,
+		log:      log,
+		checks:   make(map[*backend.Backend]healthcheck.Checker),
+		cancels:  make(map[*backend.Backend]context.CancelFunc),
+	}
+}
+
+func (h *healthChecks) start(b *backend.Backend, checker healthcheck.Checker) {
+	ctx, cancel := context.WithCancel(h.ctx)
+
+	h.mu.Lock()
+	h.checks[b] = checker
+	h.cancels[b] = cancel
+	h.mu.Unlock()
+
+	goroutines.Go("healthcheck", func() { healthcheck.Run(ctx, b, checker, h.interval, h.log) })
+}
+
+func (h *healthChecks) stop(b *backend.Backend) {
+	h.mu.Lock()
+	cancel, ok := h.cancels[b]
+	delete(h.checks, b)
+	delete(h.cancels, b)
+	h.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// checkers returns the checker of every backend being checked.
+func (h *healthChecks) checkers() map[*backend.Backend]healthcheck.Checker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return maps.Clone(h.checks)
+}
+
+// dnsRecord returns the DNS records a backend entry follows: those its dns
+// sets or, with health_check.expand_dns, the A and AAAA records of a hostname
+// URL, so expanded backends are re-resolved like any other DNS backend.
+func dnsRecord(cfg *config.Config, backendCfg config.BackendConfig) string {
+	if backendCfg.DNS != "" || !cfg.HealthCheck.ExpandDNS {
+		return backendCfg.DNS
+	}
+	u, err := url.Parse(backendCfg.URL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	if _, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return ""
+	}
+	return config.DNSRecordA
+}
+
+// dnsProvider follows the DNS name of a backend entry with dns set.
+func dnsProvider(log *slog.Logger, cfg *config.Config, backendCfg config.BackendConfig) *discovery.DNSProvider {
+	interval, _ := time.ParseDuration(cfg.Discovery.DNSInterval)
+	spec := discovery.BackendSpec{
+		Name:     backendCfg.Name,
+		URL:      backendCfg.URL,
+		Weight:   backendCfg.Weight,
+		Zone:     backendCfg.Zone,
+		Priority: backendCfg.Priority,
+	}
+	return discovery.NewDNSProvider(spec, backendCfg.DNS, net.DefaultResolver, interval, log)
+}
+
+// resolveDNSBackends returns the backends a DNS backend entry resolves to at
+// startup. A failed lookup yields none; they are added once the name
+// resolves.
+func resolveDNSBackends(ctx context.Context, log *slog.Logger, cfg *config.Config, backendCfg config.BackendConfig, opts []backend.Option) []*backend.Backend {
+	specs, err := dnsProvider(log, cfg, backendCfg).Resolve(ctx)
+	if err != nil {
+		log.Warn("Failed to resolve DNS backend, waiting for it to resolve",
+			slog.String("url", backendCfg.URL),
+			slog.Any("error", err))
+		return nil
+	}
+
+	backends := make([]*backend.Backend, 0, len(specs))
+	for _, spec := range specs {
+		if b := dnsBackend(backendCfg, opts, spec); b != nil {
+			backends = append(backends, b)
+		}
+	}
+	return backends
+}
+
+// dnsBackend creates the backend for one record of a DNS backend entry. It
+// keeps the entry's URL as its origin and, for A records, the hostname for
+// TLS verification and the Host header of health checks.
+func dnsBackend(backendCfg config.BackendConfig, opts []backend.Option, spec discovery.BackendSpec) *backend.Backend {
+	u, err := url.Parse(spec.URL)
+	if err != nil {
+		return nil
+	}
+
+	backendOpts := append(configuredOptions(backendCfg, opts),
+		backend.WithName(spec.Name),
+		backend.WithPriority(spec.Priority),
+		backend.WithOrigin(backendCfg.URL))
+	if backendCfg.DNS == config.DNSRecordA {
+		if origin, err := url.Parse(backendCfg.URL); err == nil {
+			backendOpts = append(backendOpts, backend.WithTLSServerName(origin.Hostname()), backend.WithHost(origin.Host))
+		}
+	}
+	return backend.New(u, spec.Weight, backendOpts...)
+}
+
+// followDNS re-resolves every DNS backend entry in the background, adding
+// backends for new records to the pool, removing those whose record is gone
+// and reweighting those whose SRV weight changed.
+func followDNS(ctx context.Context, log *slog.Logger, cfg *config.Config, pool *backend.Pool, checks *healthChecks) {
+	opts := backendOptions(cfg)
+
+	for _, backendCfg := range cfg.Backends {
+		backendCfg.DNS = dnsRecord(cfg, backendCfg)
+		if backendCfg.DNS == "" {
+			continue
+		}
+
+		owned := func(b *backend.Backend) bool { return b.Origin() == backendCfg.URL }
+		build := func(spec discovery.BackendSpec) *backend.Backend { return dnsBackend(backendCfg, opts, spec) }
+		checker := healthChecker(backendCfg, checks.interval)
+		updates := dnsProvider(log, cfg, backendCfg).Subscribe(ctx)
+
+		goroutines.Go("discovery", func() {
+			for specs := range updates {
+				added, updated, removed := discovery.Sync(pool, owned, specs, build)
+				for _, b := range added {
+					checks.start(b, checker)
+					log.Info("Added discovered backend",
+						slog.String("origin", backendCfg.URL),
+						slog.String("backend", b.URL().String()))
+				}
+				for _, b := range updated {
+					log.Info("Updated backend from DNS",
+						slog.String("origin", backendCfg.URL),
+						slog.String("backend", b.URL().String()),
+						slog.Any("placement", b.Placement()))
+				}
+				for _, b := range removed {
+					log.Info("Removed backend no longer in DNS",
+						slog.String("origin", backendCfg.URL),
+						slog.String("backend", b.URL().String()))
+				}
+				for _, b := range discovery.Reweight(pool, owned, specs) {
+					log.Info("Reweighted backend from DNS",
+						slog.String("origin", backendCfg.URL),
+						slog.String("backend", b.URL().String()),
+						slog.Int("weight", b.ConfiguredWeight()))
+				}
+			}
+		})
+		log.Info("DNS discovery enabled",
+			slog.String("url", backendCfg.URL),
+			slog.String("record", backendCfg.DNS),
+			slog.String("interval", cfg.Discovery.DNSInterval))
+	}
+}
+
+// etcdProvider follows the backends under the configured etcd prefix.
+func etcdProvider(log *slog.Logger, cfg *config.Config) *discovery.EtcdProvider {
+	ec := cfg.Discovery.Etcd
+	retry, _ := time.ParseDuration(ec.RetryInterval)
+	return discovery.NewEtcdProvider(discovery.EtcdOptions{
+		URL:           ec.URL,
+		Prefix:        ec.Prefix,
+		Token:         ec.Token,
+		RetryInterval: retry,
+	}, log)
+}
+
+// etcdOrigin is the origin of every backend read from etcd, which tells them
+// apart from configured and DNS backends.
+func etcdOrigin(cfg *config.Config) string {
+	return strings.TrimSuffix(cfg.Discovery.Etcd.URL, "/") + cfg.Discovery.Etcd.Prefix
+}
+
+// discoveredBackend creates the backend for a spec read from etcd or a
+// backends file, with origin telling where it came from.
+func discoveredBackend(origin string, opts []backend.Option, spec discovery.BackendSpec) *backend.Backend {
+	u, err := url.Parse(spec.URL)
+	if err != nil {
+		return nil
+	}
+	backendCfg := config.BackendConfig{
+		Name:           spec.Name,
+		URL:            spec.URL,
+		Weight:         spec.Weight,
+		Zone:           spec.Zone,
+		Priority:       spec.Priority,
+		MaxConnections: spec.MaxConnections,
+		MaxInFlight:    spec.MaxInFlight,
+	}
+	backendOpts := append(configuredOptions(backendCfg, opts), backend.WithOrigin(origin))
+	return backend.New(u, spec.Weight, backendOpts...)
+}
+
+// loadEtcdBackends returns the backends in etcd at startup. An unreachable
+// etcd yields none; they are added once it answers.
+func loadEtcdBackends(ctx context.Context, log *slog.Logger, cfg *config.Config, opts []backend.Option) []*backend.Backend {
+	specs, err := etcdProvider(log, cfg).List(ctx)
+	if err != nil {
+		log.Warn("Failed to read backends from etcd, waiting for it",
+			slog.String("prefix", cfg.Discovery.Etcd.Prefix),
+			slog.Any("error", err))
+		return nil
+	}
+
+	backends := make([]*backend.Backend, 0, len(specs))
+	for _, spec := range specs {
+		if b := discoveredBackend(etcdOrigin(cfg), opts, spec); b != nil {
+			backends = append(backends, b)
+		}
+	}
+	return backends
+}
+
+// followEtcd watches the etcd prefix in the background and makes the pool's
+// etcd backends match it in one atomic update per change, reweighting those
+// whose weight changed.
+func followEtcd(ctx context.Context, log *slog.Logger, cfg *config.Config, pool *backend.Pool, checks *healthChecks) {
+	if !cfg.Discovery.Etcd.Enabled {
+		return
+	}
+
+	opts := backendOptions(cfg)
+	origin := etcdOrigin(cfg)
+	owned := func(b *backend.Backend) bool { return b.Origin() == origin }
+	build := func(spec discovery.BackendSpec) *backend.Backend { return discoveredBackend(origin, opts, spec) }
+	updates := etcdProvider(log, cfg).Subscribe(ctx)
+
+	goroutines.Go("discovery", func() {
+		for specs := range updates {
+			added, updated, removed := discovery.Sync(pool, owned, specs, build)
+			for _, b := range added {
+				checks.start(b, healthChecker(config.BackendConfig{}, checks.interval))
+				log.Info("Added backend from etcd",
+					slog.String("origin", origin),
+					slog.String("backend", b.URL().String()))
+			}
+			for _, b := range updated {
+				log.Info("Updated backend from etcd",
+					slog.String("origin", origin),
+					slog.String("backend", b.URL().String()),
+					slog.Any("placement", b.Placement()))
+			}
+			for _, b := range removed {
+				log.Info("Removed backend no longer in etcd",
+					slog.String("origin", origin),
+					slog.String("backend", b.URL().String()))
+			}
+			for _, b := range discovery.Reweight(pool, owned, specs) {
+				log.Info("Reweighted backend from etcd",
+					slog.String("origin", origin),
+					slog.String("backend", b.URL().String()),
+					slog.Int("weight", b.ConfiguredWeight()))
+			}
+		}
+	})
+	log.Info("etcd discovery enabled",
+		slog.String("url", cfg.Discovery.Etcd.URL),
+		slog.String("prefix", cfg.Discovery.Etcd.Prefix))
+}
+
+// loadFileBackends returns the backends listed in the backends file at
+// startup.
+func loadFileBackends(cfg *config.Config, opts []backend.Option) ([]*backend.Backend, error) {
+	path := cfg.Discovery.File.Path
+	specs, err := discovery.LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("backends file %s: %w", path, err)
+	}
+
+	backends := make([]*backend.Backend, 0, len(specs))
+	for _, spec := range specs {
+		if b := discoveredBackend(path, opts, spec); b != nil {
+			backends = append(backends, b)
+		}
+	}
+	return backends, nil
+}
+
+// followFile applies edits of the backends file in the background: listed
+// backends join the pool, unlisted ones leave it and those whose weight
+// changed are reweighted.
+func followFile(ctx context.Context, log *slog.Logger, cfg *config.Config, pool *backend.Pool, checks *healthChecks) {
+	fc := cfg.Discovery.File
+	if !fc.Enabled {
+		return
+	}
+
+	opts := backendOptions(cfg)
+	owned := func(b *backend.Backend) bool { return b.Origin() == fc.Path }
+	build := func(spec discovery.BackendSpec) *backend.Backend { return discoveredBackend(fc.Path, opts, spec) }
+	interval, _ := time.ParseDuration(fc.PollInterval)
+	updates := discovery.NewFileProvider(fc.Path, interval, log).Subscribe(ctx)
+
+	goroutines.Go("discovery", func() {
+		for specs := range updates {
+			added, updated, removed := discovery.Sync(pool, owned, specs, build)
+			for _, b := range added {
+				checks.start(b, healthChecker(config.BackendConfig{}, checks.interval))
+				log.Info("Added backend from file",
+					slog.String("file", fc.Path),
+					slog.String("backend", b.URL().String()))
+			}
+			for _, b := range updated {
+				log.Info("Updated backend from file",
+					slog.String("file", fc.Path),
+					slog.String("backend", b.URL().String()),
+					slog.Any("placement", b.Placement()))
+			}
+			for _, b := range removed {
+				log.Info("Removed backend no longer in file",
+					slog.String("file", fc.Path),
+					slog.String("backend", b.URL().String()))
+			}
+			for _, b := range discovery.Reweight(pool, owned, specs) {
+				log.Info("Reweighted backend from file",
+					slog.String("file", fc.Path),
+					slog.String("backend", b.URL().String()),
+					slog.Int("weight", b.ConfiguredWeight()))
+			}
+		}
+	})
+	log.Info("File discovery enabled",
+		slog.String("file", fc.Path),
+		slog.String("poll_interval", fc.PollInterval))
+}
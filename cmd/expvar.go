@@ -0,0 +1,58 @@
+package main
+
+import (
+	"expvar"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/pkg/logger"
+)
+
+// expvarName is the variable the counters are published under in /debug/vars.
+const expvarName = "loadbalancer"
+
+// expvars are the counters published for expvar-based tooling. They are
+// computed when /debug/vars is read.
+type expvars struct {
+	TotalRequests   int64  `json:"total_requests"`
+	InFlight        int    `json:"in_flight"`
+	DroppedRequests int64  `json:"dropped_requests"`
+	DroppedEvents   int64  `json:"dropped_events"`
+	DroppedLogs     uint64 `json:"dropped_logs"`
+	HealthyBackends int    `json:"healthy_backends"`
+	OpenCircuits    int    `json:"open_circuits"`
+}
+
+func publishExpvars(collector *metrics.Collector, pool *backend.Pool, registry *circuitbreaker.Registry, logs *logger.AsyncWriter) {
+	expvar.Publish(expvarName, expvar.Func(func() any {
+		return collectExpvars(collector, pool.Backends(), registry, logs)
+	}))
+}
+
+func collectExpvars(collector *metrics.Collector, backends []*backend.Backend, registry *circuitbreaker.Registry, logs *logger.AsyncWriter) expvars {
+	counters := collector.Counters()
+	vars := expvars{
+		TotalRequests:   counters.Requests,
+		DroppedRequests: counters.LBErrors,
+		DroppedEvents:   counters.DroppedEvents,
+		DroppedLogs:     logs.Dropped(),
+	}
+
+	for _, b := range backends {
+		vars.InFlight += b.ActiveConnections()
+		if b.IsHealthy() {
+			vars.HealthyBackends++
+		}
+	}
+
+	if registry != nil {
+		for _, state := range registry.Stats() {
+			if state == circuitbreaker.StateOpen {
+				vars.OpenCircuits++
+			}
+		}
+	}
+
+	return vars
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+var _ = Describe("collectExpvars", func() {
+	It("should report requests, in-flight connections, drops and open circuits", func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		collector := metrics.NewCollector(0, log)
+		Expect(collector.Emit(metrics.MetricEvent{Type: metrics.EventLBError, StatusCode: 503})).To(BeFalse())
+
+		u, _ := url.Parse("http://localhost:8081")
+		healthy := backend.New(u, 1)
+		healthy.SetHealthy(true)
+		healthy.IncrementConn()
+		healthy.IncrementConn()
+		u, _ = url.Parse("http://localhost:8082")
+		broken := backend.New(u, 1)
+
+		registry := circuitbreaker.NewRegistry(1, time.Minute)
+		registry.GetBreaker(broken.Name()).RecordFailure()
+		registry.GetBreaker(healthy.Name())
+
+		vars := collectExpvars(collector, []*backend.Backend{healthy, broken}, registry, nil)
+		Expect(vars).To(Equal(expvars{
+			InFlight:        2,
+			DroppedEvents:   1,
+			HealthyBackends: 1,
+			OpenCircuits:    1,
+		}))
+	})
+})
@@ -2,28 +2,58 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
-	_ "net/http/pprof"
+	"net/netip"
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
 	"github.com/angeloszaimis/load-balancer/config"
 	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/capacity"
+	"github.com/angeloszaimis/load-balancer/internal/certmon"
 	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/cron"
+	"github.com/angeloszaimis/load-balancer/internal/failover"
+	"github.com/angeloszaimis/load-balancer/internal/fdmon"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
 	"github.com/angeloszaimis/load-balancer/internal/handler"
 	"github.com/angeloszaimis/load-balancer/internal/healthcheck"
 	"github.com/angeloszaimis/load-balancer/internal/httpserver"
 	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
 	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/override"
+	"github.com/angeloszaimis/load-balancer/internal/peer"
+	"github.com/angeloszaimis/load-balancer/internal/postmortem"
+	"github.com/angeloszaimis/load-balancer/internal/preflight"
+	"github.com/angeloszaimis/load-balancer/internal/registration"
+	"github.com/angeloszaimis/load-balancer/internal/remotewrite"
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+	"github.com/angeloszaimis/load-balancer/internal/schedule"
+	"github.com/angeloszaimis/load-balancer/internal/script"
+	"github.com/angeloszaimis/load-balancer/internal/shift"
+	"github.com/angeloszaimis/load-balancer/internal/standby"
+	"github.com/angeloszaimis/load-balancer/internal/state"
 	"github.com/angeloszaimis/load-balancer/internal/strategy"
+	"github.com/angeloszaimis/load-balancer/internal/waf"
 	"github.com/angeloszaimis/load-balancer/pkg/logger"
 )
 
+// version is reported to service registries; release builds set it with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
+	runSelftest := flag.Bool("selftest", false, "Run a burst of traffic through in-process fake backends, check the results and exit")
+	flag.Parse()
+
 	cfg, err := config.Load()
 	if err != nil {
 		slog.Error("failed to load config", slog.Any("err", err))
@@ -35,13 +65,31 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	backends, err := initializeBackends(ctx, cfg, log)
+	if *runSelftest {
+		os.Exit(selfTest(ctx, log, cfg))
+	}
+
+	backends, checks, err := initializeBackends(ctx, cfg, log)
 	if err != nil {
 		log.Error("Failed to initialize backends", slog.Any("err", err))
 		os.Exit(1)
 	}
 
-	strat, err := createStrategy(log, cfg.Strategy.Type, cfg.Strategy.VirtualNodes)
+	if cfg.Preflight.Enabled {
+		timeout, _ := time.ParseDuration(cfg.Preflight.Timeout)
+		err := preflight.Run(ctx, backends, preflight.Options{
+			Resolver:       net.DefaultResolver,
+			RequireHealthy: cfg.Preflight.RequireHealthy,
+			Timeout:        timeout,
+			Checkers:       checks.checkers(),
+		}, log)
+		if err != nil {
+			log.Error("Preflight checks failed", slog.Any("err", err))
+			os.Exit(1)
+		}
+	}
+
+	strat, err := strategy.FromConfig(log, cfg.Strategy)
 	if err != nil {
 		log.Error("Failed to create strategy",
 			slog.String("strategy", cfg.Strategy.Type),
@@ -49,11 +97,103 @@ func main() {
 		os.Exit(1)
 	}
 
-	lb := loadbalancer.NewLoadBalancer(strat)
-
 	metricsCollector := metrics.NewCollector(1000, log)
+	if cfg.Postmortem.Enabled {
+		metricsCollector.KeepRecent(cfg.Postmortem.Events)
+	}
 	metricsCollector.Start(ctx)
 
+	rebalanceWindow, _ := time.ParseDuration(cfg.Server.KeepAlive.RebalanceWindow)
+	rebalanceInterval, _ := time.ParseDuration(cfg.Server.KeepAlive.RebalanceInterval)
+	rebalancer := httpserver.NewRebalancer(rebalanceWindow, rebalanceInterval)
+	rebalance := func(reason string) {
+		if rebalanceWindow <= 0 {
+			return
+		}
+		if rebalancer.Rebalance() {
+			log.Info("Closing client connections to rebalance",
+				slog.String("reason", reason),
+				slog.Duration("window", rebalanceWindow))
+		} else {
+			log.Debug("Batching rebalance into the next window",
+				slog.String("reason", reason),
+				slog.Duration("interval", rebalanceInterval))
+		}
+	}
+
+	lbOpts := []loadbalancer.Option{loadbalancer.WithReporter(reportDecision(metricsCollector))}
+	if cfg.Strategy.SubsetSize > 0 {
+		lbOpts = append(lbOpts, loadbalancer.WithSubset(instanceName(cfg), cfg.Strategy.SubsetSize))
+		log.Info("Backend subsetting enabled",
+			slog.String("instance", instanceName(cfg)),
+			slog.Int("subset_size", cfg.Strategy.SubsetSize))
+	}
+	if cfg.Strategy.LocalZone != "" {
+		lbOpts = append(lbOpts, loadbalancer.WithLocalZone(cfg.Strategy.LocalZone))
+		log.Info("Zone-aware balancing enabled", slog.String("zone", cfg.Strategy.LocalZone))
+	}
+	pool := backend.NewPool(backends)
+	if hasRemote(backends) {
+		maxLatency, _ := time.ParseDuration(cfg.Failover.MaxLatency)
+		interval, _ := time.ParseDuration(cfg.HealthCheck.Interval)
+		controller := failover.NewController(pool, failover.Options{
+			MinHealthy:   cfg.Failover.MinHealthy,
+			MaxLatency:   maxLatency,
+			FailAfter:    cfg.Failover.FailAfter,
+			RecoverAfter: cfg.Failover.RecoverAfter,
+			ProbeShare:   cfg.Failover.ProbeShare,
+		}, log)
+		controller.OnSwitch(func(engaged bool) {
+			if engaged {
+				rebalance("failed over to remote backends")
+			} else {
+				rebalance("failed back to local backends")
+			}
+		})
+		controller.Start(ctx, interval)
+		lbOpts = append(lbOpts, loadbalancer.WithFailover(controller))
+		log.Info("Remote failover enabled",
+			slog.Float64("min_healthy", cfg.Failover.MinHealthy),
+			slog.String("max_latency", cfg.Failover.MaxLatency))
+	}
+	lb := loadbalancer.NewLoadBalancer(strat, lbOpts...)
+	// forget collects what drops the state kept per backend, for backends
+	// that leave the pool.
+	forget := []func(*backend.Backend){lb.Forget}
+	pool.OnAdd(func(*backend.Backend) { rebalance("backend added") })
+	pool.OnRemove(func(*backend.Backend) { rebalance("backend removed") })
+	// Peers agree on the ring's members themselves.
+	if updater, ok := strat.(strategy.Updater); ok {
+		if _, ring := strat.(strategy.Rebuilder); !ring || len(cfg.Peers.Addresses) == 0 {
+			strategy.FollowPool(updater, pool)
+		}
+	}
+
+	pool.OnRemove(checks.stop)
+
+	reportStates(metricsCollector, pool)
+
+	if rw := cfg.Metrics.RemoteWrite; rw.Enabled {
+		interval, _ := time.ParseDuration(rw.Interval)
+		timeout, _ := time.ParseDuration(rw.Timeout)
+		minBackoff, _ := time.ParseDuration(rw.MinBackoff)
+		maxBackoff, _ := time.ParseDuration(rw.MaxBackoff)
+		remotewrite.NewClient(remotewrite.Options{
+			URL:         rw.URL,
+			Interval:    interval,
+			Timeout:     timeout,
+			BatchSize:   rw.BatchSize,
+			MaxRetries:  rw.MaxRetries,
+			MinBackoff:  minBackoff,
+			MaxBackoff:  maxBackoff,
+			BearerToken: rw.BearerToken,
+			Labels:      rw.Labels,
+		}, func() metrics.Snapshot { return metricsCollector.Snapshot(cfg.Strategy.Type) }, log).Start(ctx)
+		log.Info("Pushing metrics to remote write endpoint",
+			slog.String("url", rw.URL),
+			slog.String("interval", rw.Interval))
+	}
+
 	var cbRegistry *circuitbreaker.Registry
 	if cfg.CircuitBreaker.Enabled {
 		resetTimeout, err := time.ParseDuration(cfg.CircuitBreaker.ResetTimeout)
@@ -67,53 +207,608 @@ func main() {
 			slog.String("reset_timeout", cfg.CircuitBreaker.ResetTimeout))
 	}
 
-	loadBalancerHandler := handler.NewLoadBalancerHandler(log, lb, backends, metricsCollector, cbRegistry, cfg.Retry.MaxRetries)
+	stateManager := state.NewManager(pool, cbRegistry, strat)
+	if cfg.State.ImportFile != "" {
+		if err := importState(log, stateManager, cfg.State.ImportFile); err != nil {
+			log.Error("Failed to import runtime state", slog.String("file", cfg.State.ImportFile), slog.Any("err", err))
+			os.Exit(1)
+		}
+	}
+
+	dumpPostmortem := func(reason string) {}
+	if cfg.Postmortem.Enabled {
+		dumpPostmortem = startPostmortem(log, cfg, metricsCollector, stateManager)
+	}
+	// fatal logs a failure that ends the process, with a post-mortem dump
+	// once those are being written.
+	fatal := func(msg string, err error, attrs ...any) {
+		log.Error(msg, append(attrs, slog.Any("err", err))...)
+		dumpPostmortem(fmt.Sprintf("%s: %v", msg, err))
+		os.Exit(1)
+	}
 
-	// Start pprof server on separate port for diagnostics
-	go func() {
-		log.Info("Starting pprof server on :6060")
-		if err := http.ListenAndServe(":6060", nil); err != nil {
-			log.Error("pprof server failed", slog.Any("err", err))
+	if hasStandby(backends) {
+		interval, _ := time.ParseDuration(cfg.HealthCheck.Interval)
+		standby.NewPool(pool, cfg.Standby.MinActive, log).Start(ctx, interval)
+		log.Info("Standby backends configured",
+			slog.Int("min_active", cfg.Standby.MinActive))
+	}
+
+	var scheduler *schedule.Scheduler
+	if len(cfg.Schedule.Rules) > 0 {
+		rules, err := scheduleRules(cfg.Schedule.Rules)
+		if err != nil {
+			fatal("Invalid traffic schedule", err)
 		}
-	}()
+		interval, _ := time.ParseDuration(cfg.Schedule.Interval)
+		scheduler = schedule.NewScheduler(rules, pool, log)
+		scheduler.Start(ctx, interval)
+		forget = append(forget, scheduler.Forget)
+		log.Info("Traffic schedules enabled", slog.Int("rules", len(rules)))
+	}
 
-	router := setupRouter(loadBalancerHandler, metricsCollector, cfg.Strategy.Type)
+	if cfg.Overrides.File != "" {
+		interval, _ := time.ParseDuration(cfg.Overrides.Interval)
+		watcher := override.NewWatcher(cfg.Overrides.File, pool, interval, log)
+		watcher.Start(ctx)
+		forget = append(forget, watcher.Forget)
+		log.Info("Watching overrides file",
+			slog.String("file", cfg.Overrides.File),
+			slog.String("interval", cfg.Overrides.Interval))
+	}
 
-	srv, err := httpserver.New(cfg.Server.Address, router)
+	if cfg.Capacity.Enabled {
+		interval, _ := time.ParseDuration(cfg.Capacity.Interval)
+		targetLatency, _ := time.ParseDuration(cfg.Capacity.TargetLatency)
+		calibrator := capacity.NewCalibrator(pool, capacity.Options{
+			Interval:      interval,
+			TargetLatency: targetLatency,
+			MaxWeight:     cfg.Capacity.MaxWeight,
+			MinRequests:   uint64(cfg.Capacity.MinRequests),
+		}, log)
+		calibrator.Start(ctx)
+		forget = append(forget, calibrator.Forget)
+		log.Info("Capacity auto-detection enabled",
+			slog.String("interval", cfg.Capacity.Interval),
+			slog.String("target_latency", cfg.Capacity.TargetLatency))
+	}
+
+	var fdMonitor *fdmon.Monitor
+	if cfg.FDMonitor.Enabled {
+		interval, _ := time.ParseDuration(cfg.FDMonitor.Interval)
+		fdMonitor = fdmon.NewMonitor(fdmon.Options{
+			Interval:  interval,
+			WarnRatio: cfg.FDMonitor.WarnRatio,
+		}, log)
+		fdMonitor.Start(ctx)
+	}
+
+	if cfg.Certificates.Enabled {
+		interval, _ := time.ParseDuration(cfg.Certificates.Interval)
+		timeout, _ := time.ParseDuration(cfg.Certificates.Timeout)
+		monitor := certmon.NewMonitor(pool, certmon.Options{
+			Interval: interval,
+			Warning:  time.Duration(cfg.Certificates.WarnDays) * 24 * time.Hour,
+			Timeout:  timeout,
+		}, metricsCollector, log)
+		monitor.Start(ctx)
+		forget = append(forget, monitor.Forget)
+		log.Info("Backend certificate monitoring enabled",
+			slog.String("interval", cfg.Certificates.Interval),
+			slog.Int("warn_days", cfg.Certificates.WarnDays))
+	}
+
+	// Discovery starts once everything keeping state per backend is in
+	// place, so no backend leaves the pool before its state can be dropped.
+	pool.OnRemove(func(b *backend.Backend) {
+		for _, f := range forget {
+			f(b)
+		}
+	})
+	followDNS(ctx, log, cfg, pool, checks)
+	followEtcd(ctx, log, cfg, pool, checks)
+	followFile(ctx, log, cfg, pool, checks)
+
+	proxy, err := setupProxy(ctx, log, cfg, pool, metricsCollector)
 	if err != nil {
-		log.Error("Failed to create server", slog.Any("err", err))
-		os.Exit(1)
+		fatal("Failed to set up proxy", err)
+	}
+
+	// Requests log through a queue so a slow log sink cannot stall them;
+	// startup and shutdown messages stay synchronous.
+	requestLog := log
+	var logs *logger.AsyncWriter
+	if cfg.Logging.Buffer > 0 {
+		logs = logger.NewAsyncWriter(os.Stdout, cfg.Logging.Buffer)
+		requestLog = logger.NewWriter(logs, cfg.Logging.Level, true, cfg.Server.Environment)
+	}
+
+	loadBalancerHandler := handler.NewLoadBalancerHandler(requestLog, lb, backends, metricsCollector, cbRegistry, cfg.Retry.MaxRetries, proxy.options...)
+
+	publishExpvars(metricsCollector, pool, cbRegistry, logs)
+	var shifter *shift.Controller
+	if cfg.Admin.Enabled {
+		shifter = shift.New(pool, log)
+		shifter.Start(ctx, time.Second)
 	}
 
-	srvErrCh := make(chan error, 1)
+	adminAPI, err := setupAdmin(log, cfg, pool, cbRegistry, stateManager, proxy.capturer, fdMonitor, scheduler, shifter, proxy.fingerprints, metricsCollector)
+	if err != nil {
+		fatal("Failed to set up admin API", err)
+	}
 
-	go func() {
-		srvErrCh <- srv.Start()
-	}()
+	var peerView http.Handler
+	if len(cfg.Peers.Addresses) > 0 {
+		peerView = startPeers(ctx, log, cfg, pool, strat)
+	}
+
+	routers := setupRouters(cfg, loadBalancerHandler, metricsCollector, adminAPI, peerView, proxy.readiness)
+
+	activated, err := httpserver.ActivationListeners()
+	if err != nil {
+		fatal("Failed to use socket activation", err)
+	}
+
+	servers := make([]*httpserver.Server, 0, len(routers))
+	for addr, router := range routers {
+		var h http.Handler = router
+		var opts []httpserver.Option
+		if addr == cfg.Server.Address {
+			h = proxyRouter(cfg, router, loadBalancerHandler)
+			opts = proxyServerOptions(cfg, metricsCollector)
+		} else {
+			opts = listenerTimeoutOptions(cfg.Listeners, addr)
+		}
+
+		if l := httpserver.MatchListener(&activated, addr); l != nil {
+			opts = append(opts, httpserver.WithListener(l))
+			log.Info("Using socket-activated listener", slog.String("address", addr), slog.String("socket", l.Addr().String()))
+		}
+
+		srv, err := httpserver.New(addr, h, opts...)
+		if err != nil {
+			fatal("Failed to create server", err, slog.String("address", addr))
+		}
+		servers = append(servers, srv)
+		rebalancer.Add(srv)
+		log.Info("Listening", slog.String("address", addr))
+	}
+	for _, l := range activated {
+		log.Warn("Socket-activated listener matches no configured address", slog.String("socket", l.Addr().String()))
+	}
+
+	srvErrCh := make(chan error, len(servers))
+
+	for _, srv := range servers {
+		go func() {
+			srvErrCh <- srv.Start()
+		}()
+	}
+
+	deregister := func() {}
+	if cfg.Registration.Enabled {
+		deregister = startRegistration(ctx, log, cfg)
+	}
 
 	select {
 	case <-ctx.Done():
 		log.Info("Shutting down gracefully...")
-		if err := srv.Shutdown(context.Background()); err != nil {
-			log.Error("Error during shutdown", slog.Any("err", err))
+		deregister()
+		if drainPeriod, _ := time.ParseDuration(cfg.Server.DrainPeriod); drainPeriod > 0 {
+			log.Info("Draining client connections", slog.Duration("period", drainPeriod))
+			for _, srv := range servers {
+				srv.Drain()
+			}
+			time.Sleep(drainPeriod)
 		}
+		for _, srv := range servers {
+			if err := srv.Shutdown(context.Background()); err != nil {
+				log.Error("Error during shutdown", slog.Any("err", err))
+			}
+		}
+		flushLogs(log, logs)
 	case err := <-srvErrCh:
 		if err != nil {
-			log.Error("Error starting load balancer", slog.Any("err", err))
-			os.Exit(1)
+			deregister()
+			flushLogs(log, logs)
+			fatal("Listener failed", err)
+		}
+	}
+}
+
+// flushLogs writes out the queued request log lines, giving a stalled log
+// sink a few seconds.
+func flushLogs(log *slog.Logger, logs *logger.AsyncWriter) {
+	if logs == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := logs.Close(ctx); err != nil {
+		log.Warn("Request log lines lost at shutdown", slog.Any("err", err))
+	}
+	if dropped := logs.Dropped(); dropped > 0 {
+		log.Warn("Request log lines were dropped", slog.Uint64("dropped", dropped))
+	}
+}
+
+func importState(log *slog.Logger, m *state.Manager, path string) error {
+	snap, err := state.Load(path)
+	if err != nil {
+		return err
+	}
+	result, err := m.Import(snap)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Imported runtime state",
+		slog.String("file", path),
+		slog.Time("exported_at", snap.ExportedAt),
+		slog.Int("backends", result.Backends),
+		slog.Int("breakers", result.Breakers))
+	if len(result.Unknown) > 0 {
+		log.Warn("Runtime state names backends that are not configured", slog.Any("backends", result.Unknown))
+	}
+	return nil
+}
+
+// startPostmortem writes a post-mortem dump when the process gets SIGQUIT or
+// a goroutine it started panics, and returns the function writing one for
+// the fatal errors main exits on.
+func startPostmortem(log *slog.Logger, cfg *config.Config, collector *metrics.Collector, stateManager *state.Manager) func(reason string) {
+	w := postmortem.NewWriter(cfg.Postmortem.Dir, postmortem.Sources{
+		Metrics: func() metrics.Snapshot { return collector.Snapshot(cfg.Strategy.Type) },
+		State:   stateManager.Export,
+		Events:  collector.RecentEvents,
+	}, log)
+	dump := func(reason string) {
+		if _, err := w.Write(reason); err != nil {
+			log.Error("Failed to write post-mortem dump", slog.String("reason", reason), slog.Any("err", err))
+		}
+	}
+
+	goroutines.OnPanic(func(subsystem string, v any) {
+		dump(fmt.Sprintf("panic in %s: %v", subsystem, v))
+	})
+
+	// SIGQUIT is raised again once the dump is written, with the runtime's
+	// handler back in place, so the goroutine stacks still go to stderr and
+	// the exit status stays 2.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGQUIT)
+	goroutines.Go("postmortem", func() {
+		<-quit
+		dump("SIGQUIT")
+		signal.Reset(syscall.SIGQUIT)
+		self, err := os.FindProcess(os.Getpid())
+		if err == nil {
+			err = self.Signal(syscall.SIGQUIT)
+		}
+		if err != nil {
+			log.Error("Failed to raise SIGQUIT again", slog.Any("err", err))
+			os.Exit(2)
+		}
+	})
+
+	log.Info("Post-mortem dumps enabled",
+		slog.String("dir", cfg.Postmortem.Dir),
+		slog.Int("events", cfg.Postmortem.Events))
+	return dump
+}
+
+// startPeers shares the hash ring with the configured peers and returns the
+// handler serving this instance's view to them.
+func startPeers(ctx context.Context, log *slog.Logger, cfg *config.Config, pool *backend.Pool, strat strategy.Strategy) http.Handler {
+	instance := instanceName(cfg)
+
+	if ring, ok := strat.(strategy.Rebuilder); ok {
+		interval, _ := time.ParseDuration(cfg.Peers.Interval)
+		coordinator := peer.NewCoordinator(instance, cfg.Peers.Addresses, pool, ring, interval, log)
+		// No request has been served yet, so a ring with members was
+		// imported and stays until the peers agree on another.
+		if lister, ok := strat.(strategy.MemberLister); ok {
+			if members := lister.Members(); len(members) > 0 {
+				coordinator.Adopt(members)
+			}
+		}
+		coordinator.Start(ctx)
+		log.Info("Sharing hash ring with peers",
+			slog.String("instance", instance),
+			slog.Int("peers", len(cfg.Peers.Addresses)))
+	} else {
+		log.Warn("Peers are configured but the strategy does not use a hash ring", slog.String("strategy", cfg.Strategy.Type))
+	}
+
+	return peer.Handler(instance, pool)
+}
+
+// startRegistration registers this instance in the configured registry and
+// returns the function removing it again, which the shutdown path calls
+// before draining so new traffic goes to the other replicas.
+func startRegistration(ctx context.Context, log *slog.Logger, cfg *config.Config) func() {
+	rc := cfg.Registration
+	interval, _ := time.ParseDuration(rc.Interval)
+	ttl, _ := time.ParseDuration(rc.TTL)
+
+	var registry registration.Registry
+	switch rc.Type {
+	case config.RegistryEtcd:
+		registry = &registration.Etcd{URL: rc.URL, Prefix: rc.Prefix, Token: rc.Token, TTL: ttl}
+	default:
+		registry = &registration.Consul{URL: rc.URL, Token: rc.Token, TTL: ttl}
+	}
+
+	address := rc.Address
+	if address == "" {
+		_, port, _ := net.SplitHostPort(cfg.Server.Address)
+		host, _ := os.Hostname()
+		address = net.JoinHostPort(host, port)
+	}
+
+	registrar := registration.NewRegistrar(registry, registration.Instance{
+		ID:        instanceName(cfg),
+		Name:      rc.Service,
+		Address:   address,
+		Version:   version,
+		HealthURL: rc.HealthURL,
+	}, interval, log)
+	registrar.Start(ctx)
+	log.Info("Self-registration enabled",
+		slog.String("registry", rc.Type),
+		slog.String("url", rc.URL),
+		slog.String("address", address))
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := registrar.Deregister(ctx); err != nil {
+			log.Error("Failed to deregister instance", slog.Any("err", err))
+			return
+		}
+		log.Info("Deregistered instance", slog.String("registry", rc.Type))
+	}
+}
+
+// instanceName identifies this instance to peers, backend subsetting and
+// service registries: peers.instance, or the host name when unset.
+func instanceName(cfg *config.Config) string {
+	if cfg.Peers.Instance != "" {
+		return cfg.Peers.Instance
+	}
+	instance, _ := os.Hostname()
+	return instance
+}
+
+func keepAliveOptions(cfg config.KeepAliveConfig) []httpserver.Option {
+	opts := []httpserver.Option{
+		httpserver.WithKeepAlives(cfg.Enabled),
+		httpserver.WithMaxRequestsPerConn(cfg.MaxRequests),
+		httpserver.WithMaxIdlePerClient(cfg.MaxIdlePerClient),
+	}
+	if idleTimeout, err := time.ParseDuration(cfg.IdleTimeout); err == nil {
+		opts = append(opts, httpserver.WithIdleTimeout(idleTimeout))
+	}
+	return opts
+}
+
+func proxyTimeoutOptions(cfg config.ServerConfig) []httpserver.Option {
+	read, _ := time.ParseDuration(cfg.ReadTimeout)
+	write, _ := time.ParseDuration(cfg.WriteTimeout)
+	opts := []httpserver.Option{
+		httpserver.WithTimeouts(read, write),
+		httpserver.WithMaxHeaderBytes(cfg.Headers.MaxBytes),
+	}
+
+	if len(cfg.RouteTimeouts) > 0 {
+		routes := make([]httpserver.RouteTimeout, 0, len(cfg.RouteTimeouts))
+		for _, rt := range cfg.RouteTimeouts {
+			route := httpserver.RouteTimeout{PathPrefix: rt.PathPrefix}
+			route.Read, _ = time.ParseDuration(rt.ReadTimeout)
+			route.Write, _ = time.ParseDuration(rt.WriteTimeout)
+			routes = append(routes, route)
+		}
+		opts = append(opts, httpserver.WithRouteTimeouts(routes))
+	}
+	return opts
+}
+
+// listenerTimeoutOptions applies the timeouts of the first auxiliary endpoint
+// listening on addr that sets any.
+func listenerTimeoutOptions(cfg config.ListenersConfig, addr string) []httpserver.Option {
+	for _, lc := range []config.ListenerConfig{cfg.Metrics, cfg.Admin, cfg.Pprof.ListenerConfig, cfg.Peers, cfg.Ready} {
+		if lc.Address != addr || (lc.ReadTimeout == "" && lc.WriteTimeout == "" && lc.IdleTimeout == "") {
+			continue
+		}
+
+		read, _ := time.ParseDuration(lc.ReadTimeout)
+		write, _ := time.ParseDuration(lc.WriteTimeout)
+		opts := []httpserver.Option{httpserver.WithTimeouts(read, write)}
+		if idle, err := time.ParseDuration(lc.IdleTimeout); err == nil {
+			opts = append(opts, httpserver.WithIdleTimeout(idle))
+		}
+		return opts
+	}
+	return nil
+}
+
+func scheduleRules(configs []config.ScheduleRuleConfig) ([]schedule.Rule, error) {
+	rules := make([]schedule.Rule, 0, len(configs))
+	for _, rc := range configs {
+		expr, err := cron.Parse(rc.Cron)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := time.ParseDuration(rc.Duration)
+		if err != nil {
+			return nil, err
+		}
+		location := time.Local
+		if rc.Timezone != "" {
+			if location, err = time.LoadLocation(rc.Timezone); err != nil {
+				return nil, err
+			}
+		}
+		rules = append(rules, schedule.Rule{
+			Name:     rc.Name,
+			Cron:     rc.Cron,
+			Expr:     expr,
+			Duration: duration,
+			Location: location,
+			Action:   schedule.Action(rc.Action),
+			Backends: rc.Backends,
+			Weight:   rc.Weight,
+		})
+	}
+	return rules, nil
+}
+
+func wafRules(configs []config.WAFRuleConfig) []waf.Rule {
+	rules := make([]waf.Rule, 0, len(configs))
+	for _, rc := range configs {
+		window, _ := time.ParseDuration(rc.Window)
+		rules = append(rules, waf.Rule{
+			Name:     rc.Name,
+			Methods:  rc.Methods,
+			Path:     rc.Path,
+			Headers:  rc.Headers,
+			Body:     rc.Body,
+			Action:   waf.Action(rc.Action),
+			Status:   rc.Status,
+			Tag:      rc.Tag,
+			Requests: rc.Requests,
+			Window:   window,
+		})
+	}
+	return rules
+}
+
+func routingRules(configs []config.RoutingRuleConfig) []routing.Rule {
+	rules := make([]routing.Rule, 0, len(configs))
+	for _, rc := range configs {
+		conditions := make([]routing.Condition, 0, len(rc.Conditions))
+		for _, c := range rc.Conditions {
+			conditions = append(conditions, routing.Condition{Source: routing.Source(c.Source), Name: c.Name, Pattern: c.Pattern})
+		}
+		rules = append(rules, routing.Rule{
+			Name:       rc.Name,
+			Host:       rc.Host,
+			PathPrefix: rc.PathPrefix,
+			Conditions: conditions,
+			Backends:   rc.Backends,
+			Labels:     rc.Labels,
+			Fallback:   rc.Fallback,
+		})
+	}
+	return rules
+}
+
+func scriptHooks(configs []config.ScriptHookConfig) []script.Hook {
+	hooks := make([]script.Hook, 0, len(configs))
+	for _, hc := range configs {
+		hooks = append(hooks, script.Hook{
+			Name:     hc.Name,
+			When:     hc.When,
+			Group:    hc.Group,
+			Fallback: hc.Fallback,
+			Headers:  hc.Headers,
+			Reject:   hc.Reject,
+		})
+	}
+	return hooks
+}
+
+// reportStates keeps the health and state of every pool member current in
+// the metrics.
+func reportStates(collector *metrics.Collector, pool *backend.Pool) {
+	report := func(b *backend.Backend, state backend.State) {
+		collector.Emit(metrics.MetricEvent{
+			Type:      metrics.EventHealthChanged,
+			Timestamp: time.Now(),
+			Backend:   b.Name(),
+			Healthy:   b.IsHealthy(),
+			State:     state.String(),
+		})
+	}
+
+	pool.OnStateChange(func(b *backend.Backend, _, to backend.State) { report(b, to) })
+	pool.OnAdd(func(b *backend.Backend) { report(b, b.State()) })
+	for _, b := range pool.Backends() {
+		report(b, b.State())
+	}
+
+	collector.ReportSkippedChecks(func() map[string]uint64 {
+		skipped := make(map[string]uint64)
+		for _, b := range pool.Backends() {
+			if n := b.SkippedChecks(); n > 0 {
+				skipped[b.Name()] = n
+			}
+		}
+		return skipped
+	})
+}
+
+// reportDecision records the decisions of the strategy in the metrics.
+func reportDecision(collector *metrics.Collector) strategy.Reporter {
+	return func(d strategy.Decision) {
+		collector.Emit(metrics.MetricEvent{
+			Type:      metrics.EventStrategyDecision,
+			Timestamp: time.Now(),
+			Reason:    d.Kind,
+			Value:     d.Value,
+		})
+	}
+}
+
+func hasStandby(backends []*backend.Backend) bool {
+	for _, b := range backends {
+		if b.IsStandby() {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRemote(backends []*backend.Backend) bool {
+	for _, b := range backends {
+		if b.IsRemote() {
+			return true
+		}
+	}
+	return false
+}
+
+// trustsEveryone reports whether the prefixes cover every IPv4 or IPv6 peer.
+func trustsEveryone(prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Bits() == 0 {
+			return true
 		}
 	}
+	return false
 }
 
-func initializeBackends(ctx context.Context, cfg *config.Config, log *slog.Logger) ([]*backend.Backend, error) {
+func initializeBackends(ctx context.Context, cfg *config.Config, log *slog.Logger) ([]*backend.Backend, *healthChecks, error) {
 	healthCheckInterval, err := time.ParseDuration(cfg.HealthCheck.Interval)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var backends []*backend.Backend
+	checks := newHealthChecks(ctx, healthCheckInterval, log)
+	opts := backendOptions(cfg)
 
 	for _, backendCfg := range cfg.Backends {
+		backendCfg.DNS = dnsRecord(cfg, backendCfg)
+		if backendCfg.DNS != "" {
+			for _, b := range resolveDNSBackends(ctx, log, cfg, backendCfg, opts) {
+				backends = append(backends, b)
+				checks.start(b, healthChecker(backendCfg, healthCheckInterval))
+			}
+			continue
+		}
+
 		u, err := url.Parse(backendCfg.URL)
 
 		if err != nil {
@@ -123,34 +818,85 @@ func initializeBackends(ctx context.Context, cfg *config.Config, log *slog.Logge
 			continue
 		}
 
-		backend := backend.New(u, backendCfg.Weight)
-		backends = append(backends, backend)
-		go healthcheck.HealthCheck(ctx, backend, healthCheckInterval, log)
+		b := backend.New(u, backendCfg.Weight, configuredOptions(backendCfg, opts)...)
+		backends = append(backends, b)
+		checks.start(b, healthChecker(backendCfg, healthCheckInterval))
 	}
 
-	if len(backends) == 0 {
-		return nil, os.ErrInvalid
+	if cfg.Discovery.Etcd.Enabled {
+		for _, b := range loadEtcdBackends(ctx, log, cfg, opts) {
+			backends = append(backends, b)
+			checks.start(b, healthChecker(config.BackendConfig{}, healthCheckInterval))
+		}
 	}
 
-	return backends, nil
+	if cfg.Discovery.File.Enabled {
+		listed, err := loadFileBackends(cfg, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, b := range listed {
+			backends = append(backends, b)
+			checks.start(b, healthChecker(config.BackendConfig{}, healthCheckInterval))
+		}
+	}
+
+	if len(backends) == 0 && !cfg.Discovery.Etcd.Enabled && !cfg.Discovery.File.Enabled && !slices.ContainsFunc(cfg.Backends, func(bc config.BackendConfig) bool { return dnsRecord(cfg, bc) != "" }) {
+		return nil, nil, os.ErrInvalid
+	}
+
+	return backends, checks, nil
 }
 
-func createStrategy(logger *slog.Logger, strategyType string, virtualNodes int) (strategy.Strategy, error) {
-	switch strategyType {
-	case "round-robin":
-		return strategy.NewRoundRobinStrategy(), nil
-	case "random":
-		return strategy.NewRandomStrategy(), nil
-	case "least-conn":
-		return strategy.NewLeastConnStrategy(), nil
-	case "least-response":
-		return strategy.NewLeastResponseStrategy(), nil
-	case "consistent_hash":
-		return strategy.NewConsistentHashStrategy(virtualNodes), nil
-	case "weighted-round-robin":
-		return strategy.NewWeightedRoundRobinStrategy(), nil
-	default:
-		logger.Warn("Unkown strategy, defaulting to round-robin", slog.String("requested", strategyType))
-		return strategy.NewRoundRobinStrategy(), nil
+// backendOptions returns the options every backend gets.
+func backendOptions(cfg *config.Config) []backend.Option {
+	var opts []backend.Option
+	if cfg.Feedback.Enabled {
+		opts = append(opts, backend.WithFeedback())
+	}
+	if slowStart, _ := time.ParseDuration(cfg.HealthCheck.SlowStart); slowStart > 0 {
+		opts = append(opts, backend.WithSlowStart(slowStart))
+	}
+	if wd := cfg.CircuitBreaker.WeightDecay; wd.Enabled {
+		recovery, _ := time.ParseDuration(wd.Recovery)
+		opts = append(opts, backend.WithErrorDecay(wd.Factor, recovery))
+	}
+	if cfg.Dial.HappyEyeballs {
+		delay, _ := time.ParseDuration(cfg.Dial.FallbackDelay)
+		opts = append(opts, backend.WithHappyEyeballs(delay))
+	}
+	if timeout, err := time.ParseDuration(cfg.Dial.IdleTimeout); err == nil {
+		opts = append(opts, backend.WithIdleConnTimeout(timeout))
+	}
+	if timeout, _ := time.ParseDuration(cfg.Drain.Timeout); timeout > 0 {
+		opts = append(opts, backend.WithDrainTimeout(timeout))
+	}
+	return opts
+}
+
+// configuredOptions adds the settings of one backend entry to opts.
+func configuredOptions(backendCfg config.BackendConfig, opts []backend.Option) []backend.Option {
+	backendOpts := append([]backend.Option{backend.WithName(backendCfg.Name)}, opts...)
+	if backendCfg.Standby {
+		backendOpts = append(backendOpts, backend.WithStandby())
+	}
+	if backendCfg.Remote {
+		backendOpts = append(backendOpts, backend.WithRemote())
+	}
+	return append(backendOpts,
+		backend.WithPriority(backendCfg.Priority),
+		backend.WithMaxConnections(backendCfg.MaxConnections),
+		backend.WithMaxInFlight(backendCfg.MaxInFlight),
+		backend.WithZone(backendCfg.Zone),
+		backend.WithLabels(backendCfg.Labels))
+}
+
+// healthChecker returns the check configured for a backend, with its timeout
+// capped at the check interval.
+func healthChecker(cfg config.BackendConfig, interval time.Duration) healthcheck.Checker {
+	timeout := min(cfg.HealthCheckTimeout(), interval)
+	if cfg.HealthCheck != nil && cfg.HealthCheck.Type == config.HealthCheckCommand {
+		return healthcheck.Command{Args: cfg.HealthCheck.Command, Timeout: timeout}
 	}
+	return healthcheck.HTTP{Timeout: timeout}
 }
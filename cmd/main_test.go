@@ -2,13 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/healthcheck"
+	"github.com/angeloszaimis/load-balancer/internal/schedule"
 )
 
 func TestMain(t *testing.T) {
@@ -44,7 +55,7 @@ var _ = Describe("initializeBackends", func() {
 	Context("valid backend URLs", func() {
 		It("should initialize single backend", func() {
 			cfg.Backends = []config.BackendConfig{{URL: "http://localhost:8080", Weight: 1}}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(backends).To(HaveLen(1))
 			Expect(backends[0]).NotTo(BeNil())
@@ -56,38 +67,99 @@ var _ = Describe("initializeBackends", func() {
 				{URL: "http://localhost:8081", Weight: 1},
 				{URL: "http://localhost:8082", Weight: 1},
 			}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(backends).To(HaveLen(3))
 		})
 
 		It("should handle HTTPS backends", func() {
 			cfg.Backends = []config.BackendConfig{{URL: "https://api.example.com", Weight: 1}}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(backends).To(HaveLen(1))
 		})
 
 		It("should handle backends with paths", func() {
 			cfg.Backends = []config.BackendConfig{{URL: "http://localhost:8080/api/v1", Weight: 1}}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(backends).To(HaveLen(1))
 		})
 	})
 
+	Context("standby backends", func() {
+		It("should mark standby backends", func() {
+			cfg.Backends = []config.BackendConfig{
+				{URL: "http://localhost:8080", Weight: 1},
+				{URL: "http://localhost:8081", Weight: 1, Standby: true},
+			}
+			backends, _, err := initializeBackends(ctx, cfg, log)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(backends[0].IsStandby()).To(BeFalse())
+			Expect(backends[1].IsStandby()).To(BeTrue())
+			Expect(hasStandby(backends)).To(BeTrue())
+		})
+	})
+
+	Context("schedule rules", func() {
+		It("should convert configured rules", func() {
+			rules, err := scheduleRules([]config.ScheduleRuleConfig{{
+				Name:     "nightly",
+				Cron:     "0 2 * * *",
+				Duration: "1h",
+				Timezone: "UTC",
+				Action:   "pool",
+				Backends: []string{"http://localhost:8081"},
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rules).To(HaveLen(1))
+			Expect(rules[0].Duration).To(Equal(time.Hour))
+			Expect(rules[0].Location).To(Equal(time.UTC))
+			Expect(rules[0].Action).To(Equal(schedule.ActionPool))
+		})
+	})
+
+	Context("health checkers", func() {
+		It("should run the configured command for command checks and HTTP otherwise", func() {
+			cfg.Backends = []config.BackendConfig{
+				{URL: "http://localhost:8080", Weight: 1},
+				{URL: "http://localhost:5432", Weight: 1, HealthCheck: &config.BackendHealthCheckConfig{
+					Type:    config.HealthCheckCommand,
+					Command: []string{"/usr/local/bin/check-replica"},
+					Timeout: "2s",
+				}},
+			}
+
+			backends, checks, err := initializeBackends(ctx, cfg, log)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(checks.checkers()[backends[0]]).To(Equal(healthcheck.HTTP{Timeout: 5 * time.Second}))
+			Expect(checks.checkers()[backends[1]]).To(Equal(healthcheck.Command{
+				Args:    []string{"/usr/local/bin/check-replica"},
+				Timeout: 2 * time.Second,
+			}))
+		})
+	})
+
+	Context("health check timeouts", func() {
+		It("should cap the timeout at the check interval", func() {
+			bc := config.BackendConfig{URL: "http://localhost:8080", Weight: 1}
+			Expect(healthChecker(bc, time.Second)).To(Equal(healthcheck.HTTP{Timeout: time.Second}))
+			Expect(healthChecker(bc, time.Minute)).To(Equal(healthcheck.HTTP{Timeout: 5 * time.Second}))
+		})
+	})
+
 	Context("invalid configurations", func() {
 		It("should return error for invalid health check interval", func() {
 			cfg.HealthCheck.Interval = "invalid"
 			cfg.Backends = []config.BackendConfig{{URL: "http://localhost:8080", Weight: 1}}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).To(HaveOccurred())
 			Expect(backends).To(BeNil())
 		})
 
 		It("should return error when no backends configured", func() {
 			cfg.Backends = []config.BackendConfig{}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).To(HaveOccurred())
 			Expect(backends).To(BeNil())
 		})
@@ -97,7 +169,7 @@ var _ = Describe("initializeBackends", func() {
 				{URL: "http://localhost:8080", Weight: 1},
 				{URL: "http://localhost:8081", Weight: 1},
 			}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(backends).To(HaveLen(2))
 		})
@@ -106,171 +178,169 @@ var _ = Describe("initializeBackends", func() {
 			cfg.Backends = []config.BackendConfig{
 				{URL: "://invalid", Weight: 1},
 			}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).To(HaveOccurred())
 			Expect(backends).To(BeNil())
 		})
 	})
 
-	Context("health check intervals", func() {
-		It("should handle different interval formats", func() {
-			cfg.Backends = []config.BackendConfig{{URL: "http://localhost:8080", Weight: 1}}
+	Context("DNS backends", func() {
+		It("should create one backend per address the name resolves to", func() {
+			cfg.Discovery.DNSInterval = "30s"
+			cfg.Backends = []config.BackendConfig{{Name: "api", URL: "http://localhost:8080", Weight: 2, DNS: config.DNSRecordA}}
 
-			cfg.HealthCheck.Interval = "1s"
-			backends, err := initializeBackends(ctx, cfg, log)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(backends).To(HaveLen(1))
-
-			cfg.HealthCheck.Interval = "100ms"
-			backends, err = initializeBackends(ctx, cfg, log)
+			backends, checks, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(backends).To(HaveLen(1))
+			Expect(backends).NotTo(BeEmpty())
+			for _, b := range backends {
+				Expect(b.Origin()).To(Equal("http://localhost:8080"))
+				Expect(b.URL().Hostname()).NotTo(Equal("localhost"))
+				Expect(b.Name()).To(HavePrefix("api@"))
+				Expect(b.ConfiguredWeight()).To(Equal(2))
+			}
+			Expect(checks.checkers()).To(HaveLen(len(backends)))
+		})
 
-			cfg.HealthCheck.Interval = "1m"
-			backends, err = initializeBackends(ctx, cfg, log)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(backends).To(HaveLen(1))
+		It("should follow hostname backends as DNS backends with expand_dns", func() {
+			cfg.Discovery.DNSInterval = "30s"
+			cfg.HealthCheck.ExpandDNS = true
+			cfg.Backends = []config.BackendConfig{
+				{URL: "http://localhost:8080", Weight: 1},
+				{URL: "http://127.0.0.1:8081", Weight: 1},
+			}
 
-			cfg.HealthCheck.Interval = "500ms"
-			backends, err = initializeBackends(ctx, cfg, log)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(backends).To(HaveLen(1))
+			Expect(len(backends)).To(BeNumerically(">=", 2))
+			for _, b := range backends {
+				if b.Origin() == "http://localhost:8080" {
+					Expect(b.URL().Hostname()).NotTo(Equal("localhost"))
+					Expect(b.Host()).To(Equal("localhost:8080"))
+				}
+			}
+			Expect(backends).To(ContainElement(WithTransform(func(b *backend.Backend) string { return b.URL().String() }, Equal("http://127.0.0.1:8081"))))
 		})
 
-		It("should handle hour format", func() {
-			cfg.HealthCheck.Interval = "1h"
+		It("should stop checking backends that are removed", func() {
 			cfg.Backends = []config.BackendConfig{{URL: "http://localhost:8080", Weight: 1}}
-			backends, err := initializeBackends(ctx, cfg, log)
+			backends, checks, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(backends).To(HaveLen(1))
-		})
-	})
-})
-
-var _ = Describe("createStrategy", func() {
-	var log *slog.Logger
 
-	BeforeEach(func() {
-		log = slog.Default()
+			checks.stop(backends[0])
+			Expect(checks.checkers()).To(BeEmpty())
+		})
 	})
 
-	Context("valid strategies", func() {
-		It("should create round-robin strategy", func() {
-			strat, err := createStrategy(log, "round-robin", 100)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+	Context("etcd backends", func() {
+		It("should start with the backends stored under the prefix", func() {
+			etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				value := base64.StdEncoding.EncodeToString([]byte(`{"name": "api-1", "url": "http://localhost:8081", "weight": 3}`))
+				w.Write([]byte(`{"header": {"revision": "7"}, "kvs": [{"key": "", "value": "` + value + `"}]}`))
+			}))
+			defer etcd.Close()
+			cfg.Discovery.Etcd = config.EtcdDiscoveryConfig{Enabled: true, URL: etcd.URL, Prefix: "/lb/", RetryInterval: "5s"}
 
-		It("should create random strategy", func() {
-			strat, err := createStrategy(log, "random", 100)
+			backends, checks, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
+			Expect(backends).To(HaveLen(1))
+			Expect(backends[0].Name()).To(Equal("api-1"))
+			Expect(backends[0].ConfiguredWeight()).To(Equal(3))
+			Expect(backends[0].Origin()).To(Equal(etcd.URL + "/lb/"))
+			Expect(checks.checkers()).To(HaveLen(1))
 		})
 
-		It("should create least-conn strategy", func() {
-			strat, err := createStrategy(log, "least-conn", 100)
+		It("should reweight backends whose weight changed in etcd", func() {
+			var weight atomic.Int64
+			weight.Store(3)
+			etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v3/kv/range" {
+					// Closing the watch makes the provider read the prefix again.
+					return
+				}
+				value := base64.StdEncoding.EncodeToString([]byte(`{"name": "api-1", "url": "http://localhost:8081", "weight": ` + strconv.FormatInt(weight.Load(), 10) + `}`))
+				w.Write([]byte(`{"header": {"revision": "7"}, "kvs": [{"key": "", "value": "` + value + `"}]}`))
+			}))
+			defer etcd.Close()
+			cfg.Discovery.Etcd = config.EtcdDiscoveryConfig{Enabled: true, URL: etcd.URL, Prefix: "/lb/", RetryInterval: "10ms"}
+
+			backends, checks, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+			Expect(backends).To(HaveLen(1))
+			followEtcd(ctx, log, cfg, backend.NewPool(backends), checks)
 
-		It("should create least-response strategy", func() {
-			strat, err := createStrategy(log, "least-response", 100)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
+			weight.Store(5)
+			Eventually(backends[0].BaseWeight).Should(Equal(5))
+			Expect(backends[0].ConfiguredWeight()).To(Equal(5))
 		})
 
-		It("should create consistent hash strategy with virtual nodes", func() {
-			strat, err := createStrategy(log, "consistent_hash", 150)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+		It("should start without backends while etcd is unreachable", func() {
+			cfg.Discovery.Etcd = config.EtcdDiscoveryConfig{Enabled: true, URL: "http://127.0.0.1:1", Prefix: "/lb/", RetryInterval: "5s"}
 
-		It("should create weighted-round-robin strategy", func() {
-			strat, err := createStrategy(log, "weighted-round-robin", 100)
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
+			Expect(backends).To(BeEmpty())
 		})
 	})
 
-	Context("default behavior", func() {
-		It("should default to round-robin for unknown strategy", func() {
-			strat, err := createStrategy(log, "unknown-strategy", 100)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+	Context("file backends", func() {
+		It("should start with the backends listed in the file", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "backends.yaml")
+			Expect(os.WriteFile(path, []byte("backends:\n  - name: \"api-1\"\n    url: \"http://localhost:8081\"\n    weight: 2\n    max_in_flight: 16\n"), 0o644)).To(Succeed())
+			cfg.Discovery.File = config.FileDiscoveryConfig{Enabled: true, Path: path, PollInterval: "30s"}
 
-		It("should default to round-robin for empty strategy", func() {
-			strat, err := createStrategy(log, "", 100)
+			backends, checks, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
+			Expect(backends).To(HaveLen(1))
+			Expect(backends[0].Name()).To(Equal("api-1"))
+			Expect(backends[0].ConfiguredWeight()).To(Equal(2))
+			Expect(backends[0].MaxInFlight()).To(Equal(16))
+			Expect(backends[0].Origin()).To(Equal(path))
+			Expect(checks.checkers()).To(HaveLen(1))
 		})
 
-		It("should default to round-robin for invalid strategy name", func() {
-			strat, err := createStrategy(log, "!!invalid!!", 100)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+		It("should fail when the file is missing or invalid", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "backends.yaml")
+			cfg.Discovery.File = config.FileDiscoveryConfig{Enabled: true, Path: path, PollInterval: "30s"}
+			_, _, err := initializeBackends(ctx, cfg, log)
+			Expect(err).To(HaveOccurred())
 
-		It("should default to round-robin for mixed case strategy", func() {
-			strat, err := createStrategy(log, "Round-Robin", 100)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
+			Expect(os.WriteFile(path, []byte("backends:\n  - url: \"ftp://localhost\"\n"), 0o644)).To(Succeed())
+			_, _, err = initializeBackends(ctx, cfg, log)
+			Expect(err).To(HaveOccurred())
 		})
 	})
 
-	Context("virtual nodes parameter", func() {
-		It("should handle different virtual nodes parameters", func() {
-			strat1, err := createStrategy(log, "consistent_hash", 50)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat1).NotTo(BeNil())
-
-			strat2, err := createStrategy(log, "consistent_hash", 200)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat2).NotTo(BeNil())
-		})
-
-		It("should handle zero virtual nodes", func() {
-			strat, err := createStrategy(log, "consistent_hash", 0)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
-
-		It("should handle negative virtual nodes", func() {
-			strat, err := createStrategy(log, "consistent_hash", -10)
-			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+	Context("health check intervals", func() {
+		It("should handle different interval formats", func() {
+			cfg.Backends = []config.BackendConfig{{URL: "http://localhost:8080", Weight: 1}}
 
-		It("should handle large virtual nodes value", func() {
-			strat, err := createStrategy(log, "consistent_hash", 10000)
+			cfg.HealthCheck.Interval = "1s"
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+			Expect(backends).To(HaveLen(1))
 
-		It("should ignore virtual nodes for non-hash strategies", func() {
-			strat, err := createStrategy(log, "round-robin", 999)
+			cfg.HealthCheck.Interval = "100ms"
+			backends, _, err = initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
-	})
+			Expect(backends).To(HaveLen(1))
 
-	Context("strategy name variations", func() {
-		It("should handle round-robin exactly", func() {
-			strat, err := createStrategy(log, "round-robin", 100)
+			cfg.HealthCheck.Interval = "1m"
+			backends, _, err = initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
-		})
+			Expect(backends).To(HaveLen(1))
 
-		It("should handle consistent_hash with underscore", func() {
-			strat, err := createStrategy(log, "consistent_hash", 100)
+			cfg.HealthCheck.Interval = "500ms"
+			backends, _, err = initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
+			Expect(backends).To(HaveLen(1))
 		})
 
-		It("should handle weighted-round-robin with hyphens", func() {
-			strat, err := createStrategy(log, "weighted-round-robin", 100)
+		It("should handle hour format", func() {
+			cfg.HealthCheck.Interval = "1h"
+			cfg.Backends = []config.BackendConfig{{URL: "http://localhost:8080", Weight: 1}}
+			backends, _, err := initializeBackends(ctx, cfg, log)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(strat).NotTo(BeNil())
+			Expect(backends).To(HaveLen(1))
 		})
 	})
 })
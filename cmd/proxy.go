@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/admission"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/capture"
+	"github.com/angeloszaimis/load-balancer/internal/fingerprint"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/hashkey"
+	"github.com/angeloszaimis/load-balancer/internal/httpserver"
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/overload"
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+	"github.com/angeloszaimis/load-balancer/internal/script"
+	"github.com/angeloszaimis/load-balancer/internal/traffic"
+	"github.com/angeloszaimis/load-balancer/internal/waf"
+)
+
+// proxySetup is what the configuration makes of the proxy handler: its
+// options and the parts the admin API and readiness endpoint share with it.
+type proxySetup struct {
+	options      []handler.Option
+	fingerprints *fingerprint.Recorder
+	capturer     *capture.Capturer
+	readiness    http.Handler
+}
+
+// setupProxy turns the configuration into handler options. The balancer and
+// the self-test both build their proxy handler from them.
+func setupProxy(ctx context.Context, log *slog.Logger, cfg *config.Config, pool *backend.Pool, collector *metrics.Collector) (proxySetup, error) {
+	var setup proxySetup
+	opts := []handler.Option{handler.WithBackendPool(pool)}
+	if cfg.Tunnel.Enabled {
+		dialTimeout, _ := time.ParseDuration(cfg.Tunnel.DialTimeout)
+		opts = append(opts, handler.WithTunneling(dialTimeout))
+		goroutines.SetLimit("tunnel", cfg.Tunnel.MaxOpen)
+		log.Info("CONNECT tunneling enabled",
+			slog.String("dial_timeout", cfg.Tunnel.DialTimeout),
+			slog.Int("max_open", cfg.Tunnel.MaxOpen))
+	}
+
+	if cfg.Fingerprints.Enabled {
+		setup.fingerprints = fingerprint.NewRecorder(cfg.Fingerprints.MaxEntries)
+		opts = append(opts, handler.WithFingerprints(setup.fingerprints, cfg.Fingerprints.TLSHeader))
+		log.Info("Client fingerprinting enabled",
+			slog.Int("max_entries", cfg.Fingerprints.MaxEntries),
+			slog.String("tls_header", cfg.Fingerprints.TLSHeader))
+	}
+
+	if cfg.Capture.Enabled {
+		maxDuration, _ := time.ParseDuration(cfg.Capture.MaxDuration)
+		setup.capturer = capture.New(cfg.Capture.Dir, maxDuration, log)
+		opts = append(opts, handler.WithCapture(setup.capturer))
+		if !cfg.Admin.Enabled {
+			log.Warn("Capture is enabled but the admin API that starts it is disabled")
+		}
+	}
+
+	if bi := cfg.BodyInspection; bi.Enabled {
+		opts = append(opts, handler.WithBodyInspection(inspect.New(inspect.Options{
+			MaxBytes:        bi.MaxBytes,
+			MaxDecodedBytes: bi.MaxDecodedBytes,
+			Decompress:      bi.Decompress,
+			Forward:         bi.Forward,
+			RejectOversized: bi.RejectOversized,
+		})))
+	}
+
+	if tc := cfg.Traffic; tc.Enabled {
+		classifier, err := traffic.New(traffic.Options{
+			ProbePaths:    tc.ProbePaths,
+			ProbeAgents:   tc.ProbeAgents,
+			BotAgents:     tc.BotAgents,
+			BrowserAgents: tc.BrowserAgents,
+		})
+		if err != nil {
+			return proxySetup{}, fmt.Errorf("invalid traffic class pattern: %w", err)
+		}
+		skip := make([]traffic.Class, 0, len(tc.SkipEndpointMetrics))
+		for _, class := range tc.SkipEndpointMetrics {
+			skip = append(skip, traffic.Class(class))
+		}
+		opts = append(opts, handler.WithTrafficClasses(classifier, handler.TrafficPolicy{
+			Header:              tc.Header,
+			SkipEndpointMetrics: skip,
+		}))
+	}
+
+	if cfg.WAF.Enabled {
+		var wafOpts []waf.Option
+		if cfg.WAF.UninspectedBodies == "skip" {
+			wafOpts = append(wafOpts, waf.SkipUninspected())
+		}
+		engine, err := waf.New(wafRules(cfg.WAF.Rules), wafOpts...)
+		if err != nil {
+			return proxySetup{}, fmt.Errorf("invalid WAF rule: %w", err)
+		}
+		opts = append(opts, handler.WithWAF(engine, cfg.WAF.TagHeader))
+		log.Info("WAF rules enabled", slog.Int("rules", len(cfg.WAF.Rules)))
+		if !cfg.BodyInspection.Enabled && slices.ContainsFunc(cfg.WAF.Rules, func(rc config.WAFRuleConfig) bool { return rc.Body != "" }) {
+			log.Warn("WAF body rules never match without body_inspection.enabled")
+		}
+	}
+
+	if cfg.Routing.Enabled {
+		router, err := routing.New(routingRules(cfg.Routing.Rules), cfg.Routing.MaxBodyBytes)
+		if err != nil {
+			return proxySetup{}, fmt.Errorf("invalid routing rule: %w", err)
+		}
+		opts = append(opts, handler.WithRouting(router))
+		log.Info("Routing rules enabled", slog.Int("rules", len(cfg.Routing.Rules)))
+		if !cfg.BodyInspection.Enabled && slices.ContainsFunc(cfg.Routing.Rules, func(rc config.RoutingRuleConfig) bool {
+			return slices.ContainsFunc(rc.Conditions, func(c config.RoutingConditionConfig) bool { return c.Source == "body" })
+		}) {
+			log.Warn("Routing body conditions only see empty values without body_inspection.enabled")
+		}
+	}
+
+	if cfg.Scripting.Enabled {
+		engine, err := script.New(scriptHooks(cfg.Scripting.Hooks))
+		if err != nil {
+			return proxySetup{}, fmt.Errorf("invalid script hook: %w", err)
+		}
+		opts = append(opts, handler.WithScript(engine, cfg.Scripting.GroupLabel))
+		log.Info("Script hooks enabled", slog.Int("hooks", len(cfg.Scripting.Hooks)))
+	}
+
+	opts = append(opts, handler.WithClientIPSource(handler.ClientIPSource{
+		Header:         cfg.ClientIP.Header,
+		TrustedProxies: cfg.ClientIP.TrustedNetworks(),
+	}))
+	if cfg.Server.Environment == config.EnvProd && cfg.ClientIP.Header != "" && trustsEveryone(cfg.ClientIP.TrustedNetworks()) {
+		log.Warn("Client IP header is trusted from any peer; restrict client_ip.trusted_proxies to your proxies",
+			slog.String("header", cfg.ClientIP.Header))
+	}
+
+	opts = append(opts, handler.WithHeaderLimits(handler.HeaderLimits{
+		MaxBytes:      cfg.Server.Headers.MaxBytes,
+		MaxCount:      cfg.Server.Headers.MaxCount,
+		MaxLineLength: cfg.Server.Headers.MaxLineLength,
+	}))
+
+	if cfg.Strategy.FailoverHeader != "" {
+		opts = append(opts, handler.WithAffinityFailoverHeader(cfg.Strategy.FailoverHeader))
+	}
+	if cfg.Strategy.HashKey != "" {
+		hashKey, _ := hashkey.Parse(cfg.Strategy.HashKey)
+		opts = append(opts, handler.WithHashKey(hashKey))
+	}
+
+	if cfg.Deadline.Enabled {
+		timeout, _ := time.ParseDuration(cfg.Deadline.Timeout)
+		opts = append(opts, handler.WithDeadline(timeout, cfg.Deadline.Header))
+		log.Info("Request deadlines enabled",
+			slog.String("timeout", cfg.Deadline.Timeout),
+			slog.String("header", cfg.Deadline.Header))
+	}
+
+	if cfg.Overload.Enabled {
+		interval, _ := time.ParseDuration(cfg.Overload.Interval)
+		defaultPriority, _ := overload.ParsePriority(cfg.Overload.DefaultPriority)
+		guard := overload.NewGuard(overload.Options{
+			Interval:        interval,
+			CPUThreshold:    cfg.Overload.CPUThreshold,
+			MemoryLimit:     uint64(cfg.Overload.MemoryLimitMB) << 20,
+			PriorityHeader:  cfg.Overload.PriorityHeader,
+			DefaultPriority: defaultPriority,
+		}, log)
+		guard.Start(ctx)
+		opts = append(opts, handler.WithOverloadGuard(guard))
+		setup.readiness = handler.ReadyHandler(guard.ReadyHandler())
+		log.Info("Overload protection enabled",
+			slog.Float64("cpu_threshold", cfg.Overload.CPUThreshold),
+			slog.Int("memory_limit_mb", cfg.Overload.MemoryLimitMB))
+	}
+
+	if cfg.Admission.Enabled {
+		timeout, _ := time.ParseDuration(cfg.Admission.Timeout)
+		queue := admission.New(admission.Options{
+			MaxInFlight: cfg.Admission.MaxInFlight,
+			MaxQueued:   cfg.Admission.MaxQueued,
+			Timeout:     timeout,
+			Observe: func(outcome string, waited time.Duration) {
+				collector.Emit(metrics.MetricEvent{
+					Type:      metrics.EventQueued,
+					Timestamp: time.Now(),
+					Reason:    outcome,
+					Duration:  waited,
+				})
+			},
+		})
+		collector.ReportQueueDepth(queue.Depth)
+		opts = append(opts, handler.WithAdmissionQueue(queue))
+		log.Info("Admission queue enabled",
+			slog.Int("max_in_flight", cfg.Admission.MaxInFlight),
+			slog.Int("max_queued", cfg.Admission.MaxQueued),
+			slog.String("timeout", cfg.Admission.Timeout))
+	}
+
+	if endpoints := cfg.Metrics.Endpoints.Templates; endpoints != nil {
+		opts = append(opts, handler.WithEndpointMetrics(endpoints))
+		log.Info("Per-endpoint metrics enabled",
+			slog.Int("path_templates", len(cfg.Metrics.Endpoints.Paths)))
+	}
+
+	setup.options = opts
+	return setup, nil
+}
+
+// proxyRouter puts CONNECT tunnels in front of the main address's mux when
+// tunneling is enabled.
+func proxyRouter(cfg *config.Config, mux *http.ServeMux, proxy http.Handler) http.Handler {
+	if cfg.Tunnel.Enabled {
+		return routeConnect(mux, proxy)
+	}
+	return mux
+}
+
+// proxyServerOptions configures the server on the main address: keep-alive,
+// timeouts and counting the 431s net/http answers by itself.
+func proxyServerOptions(cfg *config.Config, collector *metrics.Collector) []httpserver.Option {
+	opts := append(keepAliveOptions(cfg.Server.KeepAlive), proxyTimeoutOptions(cfg.Server)...)
+	return append(opts, httpserver.WithHeadersTooLarge(func(net.Addr) {
+		collector.Emit(metrics.MetricEvent{
+			Type:      metrics.EventHeadersRejected,
+			Timestamp: time.Now(),
+			Reason:    handler.HeaderLimitSize,
+		})
+	}))
+}
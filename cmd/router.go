@@ -1,17 +1,143 @@
 package main
 
 import (
+	"expvar"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
+	"time"
 
-	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/admin"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/capture"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/fdmon"
+	"github.com/angeloszaimis/load-balancer/internal/fingerprint"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
 	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/peer"
+	"github.com/angeloszaimis/load-balancer/internal/schedule"
+	"github.com/angeloszaimis/load-balancer/internal/shift"
+	"github.com/angeloszaimis/load-balancer/internal/state"
 )
 
-func setupRouter(loadBalancerHandler *handler.LoadBalancerHandler, metricsCollector *metrics.Collector, strategy string) *http.ServeMux {
-	mux := http.NewServeMux()
+// setupRouters builds one mux per listen address. The proxy always owns the
+// main server address; metrics, admin, pprof, the peer view and readiness
+// either join it (optionally restricted to a host name) or get a listener of
+// their own.
+func setupRouters(cfg *config.Config, loadBalancerHandler http.Handler, metricsCollector *metrics.Collector, adminAPI *admin.API, peerView http.Handler, readiness http.Handler) map[string]*http.ServeMux {
+	muxes := make(map[string]*http.ServeMux)
+	muxFor := func(addr string) *http.ServeMux {
+		if mux, ok := muxes[addr]; ok {
+			return mux
+		}
+		mux := http.NewServeMux()
+		muxes[addr] = mux
+		return mux
+	}
+
+	mount := func(lc config.ListenerConfig, path string, h http.Handler) {
+		addr := lc.Address
+		if addr == "" {
+			addr = cfg.Server.Address
+		}
+		muxFor(addr).Handle(lc.Host+path, h)
+	}
+
+	muxFor(cfg.Server.Address).Handle("/", loadBalancerHandler)
+	cacheTTL, _ := time.ParseDuration(cfg.Metrics.CacheTTL)
+	mount(cfg.Listeners.Metrics, "/metrics", metrics.Protect(metricsCollector.CachedHandler(cfg.Strategy.Type, cacheTTL), metrics.AccessPolicy{
+		BearerToken:     cfg.Metrics.BearerToken,
+		AllowedNetworks: cfg.Metrics.AllowedNetworks(),
+	}))
+
+	if adminAPI != nil {
+		mount(cfg.Listeners.Admin, "/admin/", adminAPI)
+		mount(cfg.Listeners.Admin, "/debug/vars", adminAPI)
+	}
+
+	if peerView != nil {
+		mount(cfg.Listeners.Peers, peer.ViewPath, peerView)
+	}
+
+	if readiness != nil {
+		mount(cfg.Listeners.Ready, "/readyz", readiness)
+	}
+
+	if cfg.Listeners.Pprof.Enabled {
+		mount(cfg.Listeners.Pprof.ListenerConfig, "/debug/pprof/", pprofHandler())
+	}
+
+	return muxes
+}
 
-	mux.HandleFunc("/", loadBalancerHandler.ServeHTTP)
-	mux.HandleFunc("/metrics", metricsCollector.Handler(strategy))
+// routeConnect sends CONNECT requests straight to the proxy. ServeMux cannot
+// route them because their authority-form target has no path.
+func routeConnect(mux *http.ServeMux, proxy http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
 
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 	return mux
 }
+
+func setupAdmin(log *slog.Logger, cfg *config.Config, pool *backend.Pool, cbRegistry *circuitbreaker.Registry, stateManager *state.Manager, capturer *capture.Capturer, fdMonitor *fdmon.Monitor, scheduler *schedule.Scheduler, shifter *shift.Controller, fingerprints *fingerprint.Recorder, metricsCollector *metrics.Collector) (*admin.API, error) {
+	if !cfg.Admin.Enabled {
+		return nil, nil
+	}
+
+	tokens := make([]admin.Token, 0, len(cfg.Admin.Tokens))
+	for _, t := range cfg.Admin.Tokens {
+		role, err := admin.ParseRole(t.Role)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, admin.Token{Value: t.Token, Role: role})
+	}
+
+	api := admin.New(log, tokens)
+	api.Handle("GET /admin/backends", admin.RoleObserver, admin.BackendsHandler(pool, cbRegistry))
+	api.Handle("PUT /admin/backends/weight", admin.RoleOperator, admin.SetWeightHandler(pool))
+	api.Handle("PUT /admin/backends/drain", admin.RoleOperator, admin.SetDrainHandler(pool))
+	api.Handle("GET /admin/breakers", admin.RoleObserver, admin.BreakersHandler(cbRegistry))
+	api.Handle("POST /admin/breakers/reset", admin.RoleOperator, admin.ResetBreakersHandler(cbRegistry))
+	api.Handle("GET /admin/state", admin.RoleObserver, admin.ExportStateHandler(stateManager))
+	api.Handle("PUT /admin/state", admin.RoleOperator, admin.ImportStateHandler(stateManager))
+	api.Handle("GET /admin/runtime", admin.RoleObserver, admin.RuntimeHandler(goroutines.Default))
+	api.Handle("GET /admin/fds", admin.RoleObserver, admin.FDsHandler(fdMonitor))
+	api.Handle("GET /admin/fingerprints", admin.RoleObserver, admin.FingerprintsHandler(fingerprints))
+	api.Handle("GET /admin/schedule", admin.RoleObserver, admin.ScheduleHandler(scheduler))
+	api.Handle("GET /admin/shift", admin.RoleObserver, admin.ShiftStatusHandler(shifter))
+	api.Handle("POST /admin/shift", admin.RoleOperator, admin.StartShiftHandler(shifter))
+	api.Handle("POST /admin/shift/rollback", admin.RoleOperator, admin.RollbackShiftHandler(shifter))
+	api.Handle("PUT /admin/shift/split", admin.RoleOperator, admin.SplitHandler(shifter))
+	api.Handle("GET /admin/shift/metrics", admin.RoleObserver, admin.ShiftMetricsHandler(shifter, pool, metricsCollector))
+	api.Handle("GET /debug/vars", admin.RoleObserver, expvar.Handler().ServeHTTP)
+
+	activeConfig := func() *config.Config { return cfg }
+	api.Handle("GET /admin/config", admin.RoleObserver, admin.ConfigHandler(activeConfig))
+	api.Handle("GET /admin/config/diff", admin.RoleObserver, admin.ConfigDiffHandler(activeConfig))
+	api.Handle("POST /admin/config/dry-run", admin.RoleOperator, admin.DryRunHandler(activeConfig))
+
+	if capturer != nil {
+		api.Handle("GET /admin/capture", admin.RoleObserver, admin.CaptureStatusHandler(capturer))
+		api.Handle("POST /admin/capture", admin.RoleOperator, admin.StartCaptureHandler(capturer))
+		api.Handle("DELETE /admin/capture", admin.RoleOperator, admin.StopCaptureHandler(capturer))
+	}
+
+	log.Info("Admin API enabled", slog.Int("tokens", len(tokens)))
+	return api, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"expvar"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/admin"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+var _ = Describe("setupRouters", func() {
+	var (
+		cfg       *config.Config
+		collector *metrics.Collector
+		adminAPI  *admin.API
+		proxy     http.Handler
+	)
+
+	serve := func(mux *http.ServeMux, host, path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Header().Get("X-Served-By")
+	}
+
+	BeforeEach(func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		collector = metrics.NewCollector(10, log)
+		adminAPI = admin.New(log, nil)
+		adminAPI.Handle("GET /admin/ping", admin.RoleNone, func(w http.ResponseWriter, r *http.Request) {})
+		adminAPI.Handle("GET /debug/vars", admin.RoleObserver, expvar.Handler().ServeHTTP)
+
+		proxy = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Served-By", "proxy")
+		})
+
+		cfg = &config.Config{Server: config.ServerConfig{Address: ":8080"}}
+	})
+
+	It("should serve everything on the main address by default", func() {
+		cfg.Listeners.Pprof.Enabled = true
+
+		routers := setupRouters(cfg, proxy, collector, adminAPI, nil, nil)
+
+		Expect(routers).To(HaveLen(1))
+		Expect(routers).To(HaveKey(":8080"))
+		Expect(serve(routers[":8080"], "lb", "/anything")).To(Equal("proxy"))
+		Expect(serve(routers[":8080"], "lb", "/metrics")).To(BeEmpty())
+	})
+
+	It("should move auxiliary endpoints to their own listeners", func() {
+		cfg.Listeners.Metrics.Address = ":9090"
+		cfg.Listeners.Admin.Address = ":9091"
+		cfg.Listeners.Pprof = config.PprofConfig{Enabled: true, ListenerConfig: config.ListenerConfig{Address: ":6060"}}
+
+		routers := setupRouters(cfg, proxy, collector, adminAPI, nil, nil)
+
+		Expect(routers).To(HaveLen(4))
+		Expect(serve(routers[":8080"], "lb", "/metrics")).To(Equal("proxy"))
+		Expect(serve(routers[":8080"], "lb", "/admin/ping")).To(Equal("proxy"))
+		Expect(serve(routers[":8080"], "lb", "/debug/vars")).To(Equal("proxy"))
+
+		req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+		w := httptest.NewRecorder()
+		routers[":9091"].ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusUnauthorized))
+
+		req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		w = httptest.NewRecorder()
+		routers[":9090"].ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		req = httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		w = httptest.NewRecorder()
+		routers[":6060"].ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should share one listener between endpoints with the same address", func() {
+		cfg.Listeners.Metrics.Address = ":9090"
+		cfg.Listeners.Admin.Address = ":9090"
+
+		routers := setupRouters(cfg, proxy, collector, adminAPI, nil, nil)
+
+		Expect(routers).To(HaveLen(2))
+	})
+
+	It("should separate endpoints by host on the shared port", func() {
+		cfg.Listeners.Metrics.Host = "metrics.internal"
+
+		routers := setupRouters(cfg, proxy, collector, adminAPI, nil, nil)
+
+		Expect(serve(routers[":8080"], "api.example.com", "/metrics")).To(Equal("proxy"))
+		Expect(serve(routers[":8080"], "metrics.internal", "/metrics")).To(BeEmpty())
+	})
+
+	It("should serve the peer view when peers are configured", func() {
+		peerView := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Served-By", "peers")
+		})
+
+		routers := setupRouters(cfg, proxy, collector, nil, peerView, nil)
+		Expect(serve(routers[":8080"], "lb", "/peers/view")).To(Equal("peers"))
+
+		routers = setupRouters(cfg, proxy, collector, nil, nil, nil)
+		Expect(serve(routers[":8080"], "lb", "/peers/view")).To(Equal("proxy"))
+	})
+
+	It("should serve readiness when overload protection is enabled", func() {
+		ready := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Served-By", "ready")
+		})
+
+		routers := setupRouters(cfg, proxy, collector, nil, nil, ready)
+		Expect(serve(routers[":8080"], "lb", "/readyz")).To(Equal("ready"))
+
+		routers = setupRouters(cfg, proxy, collector, nil, nil, nil)
+		Expect(serve(routers[":8080"], "lb", "/readyz")).To(Equal("proxy"))
+	})
+
+	It("should not expose pprof when disabled", func() {
+		routers := setupRouters(cfg, proxy, collector, nil, nil, nil)
+		Expect(serve(routers[":8080"], "lb", "/debug/pprof/")).To(Equal("proxy"))
+	})
+})
+
+var _ = Describe("routeConnect", func() {
+	It("should send CONNECT to the proxy and everything else to the mux", func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Served-By", "mux")
+		})
+		proxy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Served-By", "proxy")
+		})
+		h := routeConnect(mux, proxy)
+
+		req := httptest.NewRequest(http.MethodConnect, "/", nil)
+		req.URL.Path = ""
+		req.RequestURI = "secure.example:443"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		Expect(w.Header().Get("X-Served-By")).To(Equal("proxy"))
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		Expect(w.Header().Get("X-Served-By")).To(Equal("mux"))
+	})
+})
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/selftest"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// selfTest runs the self-test with the configured strategy, retries and
+// circuit breaker settings and returns the exit code. The proxy in front of
+// the fake backends is set up the way main sets it up, from the same
+// handler, router and server options.
+func selfTest(ctx context.Context, log *slog.Logger, cfg *config.Config) int {
+	strat, err := strategy.FromConfig(log, cfg.Strategy)
+	if err != nil {
+		log.Error("Failed to create strategy", slog.String("strategy", cfg.Strategy.Type), slog.Any("err", err))
+		return 1
+	}
+	resetTimeout, _ := time.ParseDuration(cfg.CircuitBreaker.ResetTimeout)
+
+	report, err := selftest.Run(ctx, selftest.Options{
+		Strategy:         strat,
+		MaxRetries:       cfg.Retry.MaxRetries,
+		FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+		ResetTimeout:     resetTimeout,
+		Front: func(pool *backend.Pool, collector *metrics.Collector) (selftest.Front, error) {
+			return selfTestFront(ctx, log, cfg, pool, collector)
+		},
+	})
+	if err != nil {
+		log.Error("Self-test could not run", slog.Any("err", err))
+		return 1
+	}
+	report.Write(os.Stdout)
+	if !report.Passed() {
+		return 1
+	}
+	return 0
+}
+
+// selfTestFront builds the proxy's handler options, router and server
+// options for the self-test's pool and collector.
+func selfTestFront(ctx context.Context, log *slog.Logger, cfg *config.Config, pool *backend.Pool, collector *metrics.Collector) (selftest.Front, error) {
+	proxy, err := setupProxy(ctx, log, cfg, pool, collector)
+	if err != nil {
+		return selftest.Front{}, err
+	}
+	return selftest.Front{
+		HandlerOptions: proxy.options,
+		Router: func(h http.Handler) http.Handler {
+			mux := setupRouters(cfg, h, collector, nil, nil, proxy.readiness)[cfg.Server.Address]
+			return proxyRouter(cfg, mux, h)
+		},
+		ServerOptions: proxyServerOptions(cfg, collector),
+	}, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/config"
+)
+
+var _ = Describe("selfTest", func() {
+	var (
+		log *slog.Logger
+		cfg *config.Config
+	)
+
+	BeforeEach(func() {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+		cfg = &config.Config{
+			Server:         config.ServerConfig{Address: ":8080"},
+			Strategy:       config.StrategyConfig{Type: "round-robin"},
+			Retry:          config.RetryConfig{MaxRetries: 2},
+			CircuitBreaker: config.CircuitBreakerConfig{FailureThreshold: 5, ResetTimeout: "30s"},
+		}
+	})
+
+	It("should pass through the configured proxy", func() {
+		Expect(selfTest(context.Background(), log, cfg)).To(Equal(0))
+	})
+
+	It("should apply the configured handler options", func() {
+		cfg.WAF = config.WAFConfig{
+			Enabled: true,
+			Rules:   []config.WAFRuleConfig{{Name: "no-health", Path: "^/health$", Action: "block"}},
+		}
+		Expect(selfTest(context.Background(), log, cfg)).To(Equal(1))
+	})
+})
@@ -1,15 +1,25 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
 	"github.com/spf13/viper"
+
+	"github.com/angeloszaimis/load-balancer/internal/cron"
+	"github.com/angeloszaimis/load-balancer/internal/hashkey"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/script"
 )
 
 const (
@@ -18,6 +28,18 @@ const (
 	EnvProd    = "prod"
 )
 
+// headerNamePattern matches HTTP header field names (RFC 9110 tokens).
+var headerNamePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// strategyTypes are the strategies strategy.type and the entries of a chain
+// may name.
+var strategyTypes = []interface{}{"round-robin", "least-conn", "least-response", "random", "consistent_hash", "ip-hash", "query-hash", "cookie-hash", "header-hash", "weighted-round-robin", "weighted-random", "weighted-alias", "peak-ewma", "p95", "warm"}
+
+const (
+	AdminRoleObserver = "observer"
+	AdminRoleOperator = "operator"
+)
+
 const (
 	LogLevelDebug = "debug"
 	LogLevelInfo  = "info"
@@ -26,59 +48,735 @@ const (
 )
 
 type ServerConfig struct {
-	Address     string `mapstructure:"address"`
-	Environment string `mapstructure:"environment"`
+	Address       string               `mapstructure:"address" json:"address"`
+	Environment   string               `mapstructure:"environment" json:"environment"`
+	KeepAlive     KeepAliveConfig      `mapstructure:"keep_alive" json:"keep_alive"`
+	DrainPeriod   string               `mapstructure:"drain_period" json:"drain_period"`
+	ReadTimeout   string               `mapstructure:"read_timeout" json:"read_timeout"`
+	WriteTimeout  string               `mapstructure:"write_timeout" json:"write_timeout"`
+	RouteTimeouts []RouteTimeoutConfig `mapstructure:"route_timeouts" json:"route_timeouts"`
+	Headers       HeaderLimitsConfig   `mapstructure:"headers" json:"headers"`
+}
+
+// HeaderLimitsConfig bounds the request headers the proxy accepts; requests
+// exceeding a limit are refused with 431. Zero means unlimited, except that
+// net/http never reads more than MaxBytes (1 MB when zero) plus 4 KiB.
+type HeaderLimitsConfig struct {
+	MaxBytes      int `mapstructure:"max_bytes" json:"max_bytes"`
+	MaxCount      int `mapstructure:"max_count" json:"max_count"`
+	MaxLineLength int `mapstructure:"max_line_length" json:"max_line_length"`
+}
+
+// RouteTimeoutConfig replaces the proxy listener's read and write timeouts
+// for requests whose path starts with PathPrefix. Empty timeouts keep the
+// listener's.
+type RouteTimeoutConfig struct {
+	PathPrefix   string `mapstructure:"path_prefix" json:"path_prefix"`
+	ReadTimeout  string `mapstructure:"read_timeout" json:"read_timeout,omitempty"`
+	WriteTimeout string `mapstructure:"write_timeout" json:"write_timeout,omitempty"`
+}
+
+// KeepAliveConfig controls connection reuse toward clients. Zero limits mean
+// unlimited.
+type KeepAliveConfig struct {
+	Enabled          bool   `mapstructure:"enabled" json:"enabled"`
+	IdleTimeout      string `mapstructure:"idle_timeout" json:"idle_timeout"`
+	MaxRequests      int    `mapstructure:"max_requests" json:"max_requests"`
+	MaxIdlePerClient int    `mapstructure:"max_idle_per_client" json:"max_idle_per_client"`
+	// RebalanceWindow is how long client connections are closed after
+	// each response once traffic fails over or back or the pool changes,
+	// so clients do not stay on connections balanced before the switch.
+	RebalanceWindow string `mapstructure:"rebalance_window" json:"rebalance_window"`
+	// RebalanceInterval is the least time between the starts of two
+	// windows. Changes within it are batched into one window once it has
+	// passed, so discovery churn does not keep keep-alive off.
+	RebalanceInterval string `mapstructure:"rebalance_interval" json:"rebalance_interval"`
 }
 
 type HealthCheckConfig struct {
-	Interval string `mapstructure:"interval"`
+	Interval  string `mapstructure:"interval" json:"interval"`
+	ExpandDNS bool   `mapstructure:"expand_dns" json:"expand_dns"`
+	// SlowStart is how long a backend that comes back up takes to ramp from
+	// no traffic to its full weight. Zero or empty disables it.
+	SlowStart string `mapstructure:"slow_start" json:"slow_start"`
 }
 
 type StrategyConfig struct {
-	Type         string `mapstructure:"type"`
-	VirtualNodes int    `mapstructure:"virtual_nodes"`
+	Type         string `mapstructure:"type" json:"type"`
+	VirtualNodes int    `mapstructure:"virtual_nodes" json:"virtual_nodes"`
+	IPv4Prefix   int    `mapstructure:"ipv4_prefix" json:"ipv4_prefix"`
+	IPv6Prefix   int    `mapstructure:"ipv6_prefix" json:"ipv6_prefix"`
+	HashParam    string `mapstructure:"hash_param" json:"hash_param"`
+	HashDefault  string `mapstructure:"hash_default" json:"hash_default"`
+	// HashKey is what consistent_hash places requests by: "ip", "path",
+	// "cookie:<name>" or "header:<name>". Empty means "ip". Requests
+	// without the cookie or header are placed by their client IP.
+	HashKey string `mapstructure:"hash_key" json:"hash_key"`
+	// WeightRamp is how long weighted-round-robin takes to move to a
+	// backend's new weight after it changes. Empty takes the strategy's
+	// default and zero switches at once. The other strategies do not ramp,
+	// so only zero is accepted for them.
+	WeightRamp string `mapstructure:"weight_ramp" json:"weight_ramp"`
+	// Decay is how quickly peak-ewma forgets a latency peak, and
+	// ErrorPenalty the latency a failed attempt counts as.
+	Decay        string `mapstructure:"decay" json:"decay"`
+	ErrorPenalty string `mapstructure:"error_penalty" json:"error_penalty"`
+	// P2C makes peak-ewma pick the cheaper of two backends drawn at random
+	// rather than the cheapest of all.
+	P2C bool `mapstructure:"p2c" json:"p2c"`
+	// P95Threshold is the recent P95 response time above which p95 avoids
+	// a backend.
+	P95Threshold string `mapstructure:"p95_threshold" json:"p95_threshold"`
+	// WarmPaths are the path prefixes of the latency-sensitive requests warm
+	// sends to backends with an idle connection. Empty means every request.
+	WarmPaths []string `mapstructure:"warm_paths" json:"warm_paths,omitempty"`
+	// FailoverHeader, when set, marks requests and responses of clients a
+	// hashing strategy moved off their usual backend.
+	FailoverHeader string `mapstructure:"failover_header" json:"failover_header"`
+	// SubsetSize limits each instance to that many backends, picked
+	// deterministically from peers.instance. Zero uses every backend.
+	SubsetSize int `mapstructure:"subset_size" json:"subset_size"`
+	// LocalZone is the zone this instance runs in. Backends of that zone are
+	// preferred and others only used while none of them can take traffic.
+	LocalZone string `mapstructure:"local_zone" json:"local_zone"`
+	// Chain lists the strategies the chain type asks in order, moving on to
+	// the next when one picks nothing or an ineligible backend: one with
+	// ChainMaxLoad or more active connections, a response time above
+	// ChainMaxLatency, or a reported load of ChainMaxReportedLoad or more.
+	// Zero disables a criterion.
+	Chain                []string `mapstructure:"chain" json:"chain"`
+	ChainMaxLoad         int      `mapstructure:"chain_max_load" json:"chain_max_load"`
+	ChainMaxLatency      string   `mapstructure:"chain_max_latency" json:"chain_max_latency"`
+	ChainMaxReportedLoad float64  `mapstructure:"chain_max_reported_load" json:"chain_max_reported_load"`
+}
+
+// Uses reports whether the strategy, or one in its chain, is of one of types.
+func (sc StrategyConfig) Uses(types ...string) bool {
+	if slices.Contains(types, sc.Type) {
+		return true
+	}
+	if sc.Type != "chain" {
+		return false
+	}
+	return slices.ContainsFunc(sc.Chain, func(t string) bool {
+		return slices.Contains(types, t)
+	})
 }
 
+// BackendConfig describes one backend. Name is its stable identity for
+// circuit breakers, metrics and hash affinity; without one the URL is used, so
+// changing the URL starts the backend afresh.
 type BackendConfig struct {
-	URL    string `mapstructure:"url"`
-	Weight int    `mapstructure:"weight"`
+	Name        string                    `mapstructure:"name" json:"name,omitempty"`
+	URL         string                    `mapstructure:"url" json:"url"`
+	Weight      int                       `mapstructure:"weight" json:"weight"`
+	HealthCheck *BackendHealthCheckConfig `mapstructure:"health_check" json:"health_check,omitempty"`
+	// Standby backends are health checked but only receive traffic while
+	// fewer than standby.min_active regular backends are available.
+	Standby bool `mapstructure:"standby" json:"standby,omitempty"`
+	// Priority places the backend in a failover tier: tier 2 only receives
+	// traffic while every tier 1 backend is unavailable or has all of its
+	// MaxConnections upstream connections busy. Zero means tier 1, and zero
+	// MaxConnections no limit.
+	Priority       int `mapstructure:"priority" json:"priority,omitempty"`
+	MaxConnections int `mapstructure:"max_connections" json:"max_connections,omitempty"`
+	// MaxInFlight is a hard cap on the requests the backend handles at once:
+	// a backend holding that many is skipped until one ends. Zero means no
+	// limit.
+	MaxInFlight int `mapstructure:"max_in_flight" json:"max_in_flight,omitempty"`
+	// Zone is the availability zone or locality the backend runs in.
+	Zone string `mapstructure:"zone" json:"zone,omitempty"`
+	// Remote backends form the fallback group that traffic fails over to
+	// when the local backends breach the failover thresholds.
+	Remote bool `mapstructure:"remote" json:"remote,omitempty"`
+	// Labels tag the backend for selection by label, e.g. color: blue for a
+	// blue/green traffic shift through the admin API.
+	Labels map[string]string `mapstructure:"labels" json:"labels,omitempty"`
+	// DNS makes the URL's host a DNS name re-resolved every
+	// discovery.dns_interval, one backend per record: "a" follows its A and
+	// AAAA records, "srv" its SRV records. Empty uses the URL as is.
+	DNS string `mapstructure:"dns" json:"dns,omitempty"`
+}
+
+// DNS discovery record types.
+const (
+	DNSRecordA   = "a"
+	DNSRecordSRV = "srv"
+)
+
+// DiscoveryConfig controls how backends are discovered at runtime.
+type DiscoveryConfig struct {
+	DNSInterval string              `mapstructure:"dns_interval" json:"dns_interval"`
+	Etcd        EtcdDiscoveryConfig `mapstructure:"etcd" json:"etcd"`
+	File        FileDiscoveryConfig `mapstructure:"file" json:"file"`
+}
+
+// FileDiscoveryConfig adds the backends listed in a separate YAML or JSON
+// file, shaped like the backends section, to the pool and applies edits to
+// it live. The file is watched for changes and also polled every
+// PollInterval for filesystems that do not report them.
+type FileDiscoveryConfig struct {
+	Enabled      bool   `mapstructure:"enabled" json:"enabled"`
+	Path         string `mapstructure:"path" json:"path"`
+	PollInterval string `mapstructure:"poll_interval" json:"poll_interval"`
+}
+
+// EtcdDiscoveryConfig adds the backends stored under Prefix in etcd to the
+// pool and follows changes to them, so every instance reading the prefix
+// serves the same backends. Each key holds one backend as JSON with name,
+// url, weight, zone and priority. Token is an etcd auth token. After etcd
+// fails, it is tried again every RetryInterval.
+type EtcdDiscoveryConfig struct {
+	Enabled       bool   `mapstructure:"enabled" json:"enabled"`
+	URL           string `mapstructure:"url" json:"url"`
+	Prefix        string `mapstructure:"prefix" json:"prefix"`
+	Token         string `mapstructure:"token" json:"token"`
+	RetryInterval string `mapstructure:"retry_interval" json:"retry_interval"`
+}
+
+// Health check types.
+const (
+	HealthCheckHTTP    = "http"
+	HealthCheckCommand = "command"
+)
+
+// BackendHealthCheckConfig replaces the HTTP /health check for one backend.
+// With type "command", Command is run every health_check.interval and the
+// backend is healthy when it exits 0 within Timeout.
+type BackendHealthCheckConfig struct {
+	Type    string   `mapstructure:"type" json:"type"`
+	Command []string `mapstructure:"command" json:"command,omitempty"`
+	Timeout string   `mapstructure:"timeout" json:"timeout,omitempty"`
+}
+
+// HealthCheckTimeout returns the timeout to use for a backend's health check,
+// defaulting to five seconds.
+func (b BackendConfig) HealthCheckTimeout() time.Duration {
+	if b.HealthCheck != nil && b.HealthCheck.Timeout != "" {
+		if d, err := time.ParseDuration(b.HealthCheck.Timeout); err == nil {
+			return d
+		}
+	}
+	return 5 * time.Second
+}
+
+// ID returns the backend's identity: its name, or its URL when unnamed.
+func (b BackendConfig) ID() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return b.URL
 }
 
 type LoggingConfig struct {
-	Level string `mapstructure:"level"`
+	Level string `mapstructure:"level" json:"level"`
+	// Buffer is how many log lines written while serving requests may queue
+	// for a slow log sink before further ones are dropped. Zero writes them
+	// synchronously, stalling requests while the sink is slow.
+	Buffer int `mapstructure:"buffer" json:"buffer"`
 }
 
 type CircuitBreakerConfig struct {
-	Enabled          bool   `mapstructure:"enabled"`
-	FailureThreshold int    `mapstructure:"failure_threshold"`
-	ResetTimeout     string `mapstructure:"reset_timeout"`
+	Enabled          bool              `mapstructure:"enabled" json:"enabled"`
+	FailureThreshold int               `mapstructure:"failure_threshold" json:"failure_threshold"`
+	ResetTimeout     string            `mapstructure:"reset_timeout" json:"reset_timeout"`
+	WeightDecay      WeightDecayConfig `mapstructure:"weight_decay" json:"weight_decay"`
+}
+
+// WeightDecayConfig makes every failure the circuit breaker counts multiply
+// the backend's effective weight by Factor. The weight grows back to its full
+// value linearly over Recovery from the last failure as requests succeed.
+type WeightDecayConfig struct {
+	Enabled  bool    `mapstructure:"enabled" json:"enabled"`
+	Factor   float64 `mapstructure:"factor" json:"factor"`
+	Recovery string  `mapstructure:"recovery" json:"recovery"`
+}
+
+// DialConfig controls how backend connections are opened and kept. With
+// HappyEyeballs, hostname backends resolving to both IPv4 and IPv6 addresses
+// race the other family after FallbackDelay rather than Go's default delay.
+// IdleTimeout closes pooled backend connections left idle that long.
+type DialConfig struct {
+	HappyEyeballs bool   `mapstructure:"happy_eyeballs" json:"happy_eyeballs"`
+	FallbackDelay string `mapstructure:"fallback_delay" json:"fallback_delay"`
+	IdleTimeout   string `mapstructure:"idle_timeout" json:"idle_timeout"`
+}
+
+// DrainConfig bounds how long a draining backend's requests may take: after
+// Timeout, the connections still open to it are closed. Zero waits for them
+// however long they take.
+type DrainConfig struct {
+	Timeout string `mapstructure:"timeout" json:"timeout"`
 }
 
 type RetryConfig struct {
-	MaxRetries int `mapstructure:"max_retries"`
+	MaxRetries int `mapstructure:"max_retries" json:"max_retries"`
+}
+
+// ListenerConfig places an auxiliary endpoint. An empty Address serves it on
+// the main server address; Host then optionally restricts it to requests for
+// that host name so it does not shadow proxied paths for other hosts. The
+// timeouts only apply to a listener of its own; when several endpoints share
+// an address, the first one that sets timeouts decides them.
+type ListenerConfig struct {
+	Address      string `mapstructure:"address" json:"address"`
+	Host         string `mapstructure:"host" json:"host"`
+	ReadTimeout  string `mapstructure:"read_timeout" json:"read_timeout,omitempty"`
+	WriteTimeout string `mapstructure:"write_timeout" json:"write_timeout,omitempty"`
+	IdleTimeout  string `mapstructure:"idle_timeout" json:"idle_timeout,omitempty"`
+}
+
+type PprofConfig struct {
+	Enabled        bool `mapstructure:"enabled" json:"enabled"`
+	ListenerConfig `mapstructure:",squash"`
+}
+
+type ListenersConfig struct {
+	Metrics ListenerConfig `mapstructure:"metrics" json:"metrics"`
+	Admin   ListenerConfig `mapstructure:"admin" json:"admin"`
+	Pprof   PprofConfig    `mapstructure:"pprof" json:"pprof"`
+	Peers   ListenerConfig `mapstructure:"peers" json:"peers"`
+	Ready   ListenerConfig `mapstructure:"ready" json:"ready"`
+}
+
+type MetricsConfig struct {
+	BearerToken  string                `mapstructure:"bearer_token" json:"bearer_token"`
+	AllowedCIDRs []string              `mapstructure:"allowed_cidrs" json:"allowed_cidrs"`
+	Endpoints    EndpointMetricsConfig `mapstructure:"endpoints" json:"endpoints"`
+	// CacheTTL is how long a rendered snapshot is served to further scrapers.
+	// Empty or zero renders one per request.
+	CacheTTL    string            `mapstructure:"cache_ttl" json:"cache_ttl"`
+	RemoteWrite RemoteWriteConfig `mapstructure:"remote_write" json:"remote_write"`
+}
+
+// RemoteWriteConfig pushes metrics to a Prometheus remote write endpoint
+// every Interval, in requests of at most BatchSize series. Requests failing
+// temporarily are retried MaxRetries times with a backoff doubling from
+// MinBackoff up to MaxBackoff. Labels are added to every series.
+type RemoteWriteConfig struct {
+	Enabled     bool              `mapstructure:"enabled" json:"enabled"`
+	URL         string            `mapstructure:"url" json:"url"`
+	Interval    string            `mapstructure:"interval" json:"interval"`
+	Timeout     string            `mapstructure:"timeout" json:"timeout"`
+	BatchSize   int               `mapstructure:"batch_size" json:"batch_size"`
+	MaxRetries  int               `mapstructure:"max_retries" json:"max_retries"`
+	MinBackoff  string            `mapstructure:"min_backoff" json:"min_backoff"`
+	MaxBackoff  string            `mapstructure:"max_backoff" json:"max_backoff"`
+	BearerToken string            `mapstructure:"bearer_token" json:"bearer_token"`
+	Labels      map[string]string `mapstructure:"labels" json:"labels"`
+}
+
+// EndpointMetricsConfig adds per-endpoint metrics labelled by method and path
+// template. Paths is the allow-list of templates, e.g. "/users/{id}" or
+// "/static/{path...}"; requests matching none are grouped as "other".
+type EndpointMetricsConfig struct {
+	Enabled bool     `mapstructure:"enabled" json:"enabled"`
+	Paths   []string `mapstructure:"paths" json:"paths"`
+	// Templates holds Paths as parsed by Validate, so they are parsed once
+	// and used as validated. It is nil until then or while disabled.
+	Templates *metrics.Endpoints `mapstructure:"-" json:"-"`
+}
+
+// AllowedNetworks returns the parsed allow-list. Entries are validated by
+// Validate, so invalid ones are skipped here.
+func (m MetricsConfig) AllowedNetworks() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(m.AllowedCIDRs))
+	for _, cidr := range m.AllowedCIDRs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return prefixes
+}
+
+// ClientIPConfig selects the header identifying the client for hashing
+// strategies and logs, e.g. X-Forwarded-For, X-Real-IP or CF-Connecting-IP.
+// It is only honoured on connections from TrustedProxies; an empty Header
+// always uses the connection's peer address.
+type ClientIPConfig struct {
+	Header         string   `mapstructure:"header" json:"header"`
+	TrustedProxies []string `mapstructure:"trusted_proxies" json:"trusted_proxies"`
+}
+
+// TrustedNetworks returns the parsed trusted proxies. Entries are validated
+// by Validate, so invalid ones are skipped here.
+func (c ClientIPConfig) TrustedNetworks() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, cidr := range c.TrustedProxies {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return prefixes
+}
+
+// StandbyConfig sets how many regular backends must be available before
+// standby backends are taken out of rotation again.
+type StandbyConfig struct {
+	MinActive int `mapstructure:"min_active" json:"min_active"`
+}
+
+// FailoverConfig sets when traffic moves from the local backends to the
+// remote ones: after FailAfter consecutive evaluations in which fewer than
+// MinHealthy of the local backends are available or their mean response time
+// exceeds MaxLatency. It moves back after RecoverAfter evaluations without a
+// breach. ProbeShare of requests keep going to the local backends meanwhile,
+// which failing back on latency depends on.
+type FailoverConfig struct {
+	MinHealthy   float64 `mapstructure:"min_healthy" json:"min_healthy"`
+	MaxLatency   string  `mapstructure:"max_latency" json:"max_latency"`
+	FailAfter    int     `mapstructure:"fail_after" json:"fail_after"`
+	RecoverAfter int     `mapstructure:"recover_after" json:"recover_after"`
+	ProbeShare   float64 `mapstructure:"probe_share" json:"probe_share"`
+}
+
+// ScheduleConfig lists traffic policies applied on a cron schedule. Rules are
+// evaluated every Interval.
+type ScheduleConfig struct {
+	Interval string               `mapstructure:"interval" json:"interval"`
+	Rules    []ScheduleRuleConfig `mapstructure:"rules" json:"rules"`
+}
+
+// ScheduleRuleConfig applies Action to Backends for Duration each time Cron
+// fires in Timezone (local time when empty). Action is "weight", which sets
+// the backends' weight to Weight, "maintenance", which takes them out of
+// rotation, or "pool", which takes every other backend out of rotation.
+type ScheduleRuleConfig struct {
+	Name     string   `mapstructure:"name" json:"name"`
+	Cron     string   `mapstructure:"cron" json:"cron"`
+	Duration string   `mapstructure:"duration" json:"duration"`
+	Timezone string   `mapstructure:"timezone" json:"timezone,omitempty"`
+	Action   string   `mapstructure:"action" json:"action"`
+	Backends []string `mapstructure:"backends" json:"backends"`
+	Weight   int      `mapstructure:"weight" json:"weight,omitempty"`
+}
+
+type FeedbackConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+}
+
+type CapacityConfig struct {
+	Enabled       bool   `mapstructure:"enabled" json:"enabled"`
+	Interval      string `mapstructure:"interval" json:"interval"`
+	TargetLatency string `mapstructure:"target_latency" json:"target_latency"`
+	MaxWeight     int    `mapstructure:"max_weight" json:"max_weight"`
+	MinRequests   int    `mapstructure:"min_requests" json:"min_requests"`
+}
+
+// FDMonitorConfig samples open file descriptors and listener accept queues
+// every Interval and logs a warning once usage reaches WarnRatio of the limit.
+type FDMonitorConfig struct {
+	Enabled   bool    `mapstructure:"enabled" json:"enabled"`
+	Interval  string  `mapstructure:"interval" json:"interval"`
+	WarnRatio float64 `mapstructure:"warn_ratio" json:"warn_ratio"`
+}
+
+// CertificatesConfig probes HTTPS backends every Interval and reports how
+// many days their TLS certificates have left, warning within WarnDays.
+type CertificatesConfig struct {
+	Enabled  bool   `mapstructure:"enabled" json:"enabled"`
+	Interval string `mapstructure:"interval" json:"interval"`
+	Timeout  string `mapstructure:"timeout" json:"timeout"`
+	WarnDays int    `mapstructure:"warn_days" json:"warn_days"`
+}
+
+// DeadlineConfig gives every proxied request a budget of Timeout and passes
+// the remaining milliseconds to backends in Header. A smaller budget received
+// in Header wins; an empty or zero Timeout only forwards received budgets.
+type DeadlineConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	Timeout string `mapstructure:"timeout" json:"timeout"`
+	Header  string `mapstructure:"header" json:"header"`
+}
+
+// OverloadConfig sheds low-priority requests while the balancer's own CPU
+// use, as a fraction of GOMAXPROCS, reaches CPUThreshold or its memory
+// reaches MemoryLimitMB; zero disables either check. Requests carry their
+// priority ("low", "normal" or "high") in PriorityHeader, which is only
+// believed from the client IP section's trusted proxies.
+type OverloadConfig struct {
+	Enabled         bool    `mapstructure:"enabled" json:"enabled"`
+	Interval        string  `mapstructure:"interval" json:"interval"`
+	CPUThreshold    float64 `mapstructure:"cpu_threshold" json:"cpu_threshold"`
+	MemoryLimitMB   int     `mapstructure:"memory_limit_mb" json:"memory_limit_mb"`
+	PriorityHeader  string  `mapstructure:"priority_header" json:"priority_header"`
+	DefaultPriority string  `mapstructure:"default_priority" json:"default_priority"`
+}
+
+// AdmissionConfig queues requests while every backend they may go to holds
+// MaxInFlight requests, or its max_connections if lower. At most MaxQueued
+// requests wait, each for at most Timeout, before being answered 503.
+type AdmissionConfig struct {
+	Enabled     bool   `mapstructure:"enabled" json:"enabled"`
+	MaxInFlight int    `mapstructure:"max_in_flight" json:"max_in_flight"`
+	MaxQueued   int    `mapstructure:"max_queued" json:"max_queued"`
+	Timeout     string `mapstructure:"timeout" json:"timeout"`
+}
+
+// TunnelConfig enables HTTP CONNECT: the client connection is hijacked and
+// piped to a selected backend's host:port. MaxOpen caps concurrent tunnels;
+// zero means unlimited.
+type TunnelConfig struct {
+	Enabled     bool   `mapstructure:"enabled" json:"enabled"`
+	DialTimeout string `mapstructure:"dial_timeout" json:"dial_timeout"`
+	MaxOpen     int    `mapstructure:"max_open" json:"max_open"`
+}
+
+// OverridesConfig points at an optional file, polled every Interval, that can
+// force backend health and weights without the admin API.
+type OverridesConfig struct {
+	File     string `mapstructure:"file" json:"file"`
+	Interval string `mapstructure:"interval" json:"interval"`
+}
+
+// StateConfig names a runtime state export, as served by GET /admin/state,
+// to import at startup so a replacement instance resumes where the old one
+// left off.
+type StateConfig struct {
+	ImportFile string `mapstructure:"import_file" json:"import_file"`
+}
+
+// PostmortemConfig writes a post-mortem dump to Dir when the process gets
+// SIGQUIT or dies of a fatal error: the final metrics snapshot, backend and
+// breaker state, the last Events metrics events and the goroutine stacks.
+type PostmortemConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	Dir     string `mapstructure:"dir" json:"dir"`
+	Events  int    `mapstructure:"events" json:"events"`
+}
+
+// PreflightConfig controls the backend checks run before listening.
+// RequireHealthy additionally fails the start unless a backend passes its
+// health check.
+type PreflightConfig struct {
+	Enabled        bool   `mapstructure:"enabled" json:"enabled"`
+	RequireHealthy bool   `mapstructure:"require_healthy" json:"require_healthy"`
+	Timeout        string `mapstructure:"timeout" json:"timeout"`
+}
+
+// PeersConfig lists other load balancer instances to share the consistent
+// hash ring with. Addresses are peer base URLs; Instance names this instance
+// and defaults to the host name.
+type PeersConfig struct {
+	Instance  string   `mapstructure:"instance" json:"instance"`
+	Addresses []string `mapstructure:"addresses" json:"addresses"`
+	Interval  string   `mapstructure:"interval" json:"interval"`
+}
+
+// RegistrationConfig registers this instance in Consul or etcd on startup
+// and removes it on shutdown, so global balancers or DNS automation can find
+// the replicas. Address is the host:port advertised, the host name with the
+// server port when empty. HealthURL is what Consul probes; without it, and
+// with etcd, every refresh renews a TTL check or lease instead. The
+// registration is refreshed every Interval, and a crashed instance is
+// dropped after TTL, at least one minute for Consul. Prefix is where etcd
+// keys are written.
+type RegistrationConfig struct {
+	Enabled   bool   `mapstructure:"enabled" json:"enabled"`
+	Type      string `mapstructure:"type" json:"type"`
+	URL       string `mapstructure:"url" json:"url"`
+	Token     string `mapstructure:"token" json:"token"`
+	Service   string `mapstructure:"service" json:"service"`
+	Address   string `mapstructure:"address" json:"address"`
+	HealthURL string `mapstructure:"health_url" json:"health_url"`
+	Interval  string `mapstructure:"interval" json:"interval"`
+	TTL       string `mapstructure:"ttl" json:"ttl"`
+	Prefix    string `mapstructure:"prefix" json:"prefix"`
+}
+
+const (
+	RegistryConsul = "consul"
+	RegistryEtcd   = "etcd"
+)
+
+// CaptureConfig allows admin-triggered request/response capture. Capture
+// files are written to Dir (the system temp directory when empty) and a
+// session never runs longer than MaxDuration.
+type CaptureConfig struct {
+	Enabled     bool   `mapstructure:"enabled" json:"enabled"`
+	Dir         string `mapstructure:"dir" json:"dir"`
+	MaxDuration string `mapstructure:"max_duration" json:"max_duration"`
+}
+
+// BodyInspectionConfig buffers request bodies so that capture and other
+// inspecting stages see them decompressed. MaxBytes bounds the body as
+// received and MaxDecodedBytes after decompression; Forward is "original",
+// "recompress" or "identity".
+type BodyInspectionConfig struct {
+	Enabled         bool   `mapstructure:"enabled" json:"enabled"`
+	MaxBytes        int64  `mapstructure:"max_bytes" json:"max_bytes"`
+	MaxDecodedBytes int64  `mapstructure:"max_decoded_bytes" json:"max_decoded_bytes"`
+	Decompress      bool   `mapstructure:"decompress" json:"decompress"`
+	Forward         string `mapstructure:"forward" json:"forward"`
+	RejectOversized bool   `mapstructure:"reject_oversized" json:"reject_oversized"`
+}
+
+// WAFConfig lists request rules evaluated before proxying. Tags of matching
+// tag rules are sent to the backend in TagHeader. UninspectedBodies is
+// "match" to hold body conditions as met by bodies that body inspection
+// passed on uninspected, or "skip" to hold them as failed.
+type WAFConfig struct {
+	Enabled           bool            `mapstructure:"enabled" json:"enabled"`
+	TagHeader         string          `mapstructure:"tag_header" json:"tag_header"`
+	UninspectedBodies string          `mapstructure:"uninspected_bodies" json:"uninspected_bodies"`
+	Rules             []WAFRuleConfig `mapstructure:"rules" json:"rules"`
+}
+
+// WAFRuleConfig matches requests by Methods and by the regular expressions
+// Path, Headers (header name to pattern) and Body, and applies Action:
+// "block" answers Status (403 when zero), "rate_limit" answers 429 to a
+// client sending more than Requests matching requests per Window, and "tag"
+// adds Tag (the name when empty) to the request.
+type WAFRuleConfig struct {
+	Name     string            `mapstructure:"name" json:"name"`
+	Methods  []string          `mapstructure:"methods" json:"methods,omitempty"`
+	Path     string            `mapstructure:"path" json:"path,omitempty"`
+	Headers  map[string]string `mapstructure:"headers" json:"headers,omitempty"`
+	Body     string            `mapstructure:"body" json:"body,omitempty"`
+	Action   string            `mapstructure:"action" json:"action"`
+	Status   int               `mapstructure:"status" json:"status,omitempty"`
+	Tag      string            `mapstructure:"tag" json:"tag,omitempty"`
+	Requests int               `mapstructure:"requests" json:"requests,omitempty"`
+	Window   string            `mapstructure:"window" json:"window,omitempty"`
+}
+
+// FingerprintsConfig counts requests per client fingerprint for up to
+// MaxEntries fingerprints. TLSHeader names the header in which a
+// TLS-terminating proxy passes on the client's JA3 or JA4 hash.
+type FingerprintsConfig struct {
+	Enabled    bool   `mapstructure:"enabled" json:"enabled"`
+	MaxEntries int    `mapstructure:"max_entries" json:"max_entries"`
+	TLSHeader  string `mapstructure:"tls_header" json:"tls_header"`
+}
+
+// RoutingConfig lists rules sending matching requests to a subset of the
+// backends; the first matching rule wins and other requests go to any
+// backend. Body conditions look at JSON bodies of up to MaxBodyBytes and need
+// body inspection.
+type RoutingConfig struct {
+	Enabled      bool                `mapstructure:"enabled" json:"enabled"`
+	MaxBodyBytes int                 `mapstructure:"max_body_bytes" json:"max_body_bytes"`
+	Rules        []RoutingRuleConfig `mapstructure:"rules" json:"rules"`
+}
+
+// RoutingRuleConfig matches requests by Host, PathPrefix and Conditions and
+// routes them to the backends named in Backends or carrying every label in
+// Labels. Fallback sends them to any backend while none of those is
+// available instead of refusing them.
+type RoutingRuleConfig struct {
+	Name       string                   `mapstructure:"name" json:"name"`
+	Host       string                   `mapstructure:"host" json:"host,omitempty"`
+	PathPrefix string                   `mapstructure:"path_prefix" json:"path_prefix,omitempty"`
+	Conditions []RoutingConditionConfig `mapstructure:"conditions" json:"conditions,omitempty"`
+	Backends   []string                 `mapstructure:"backends" json:"backends,omitempty"`
+	Labels     map[string]string        `mapstructure:"labels" json:"labels,omitempty"`
+	Fallback   bool                     `mapstructure:"fallback" json:"fallback,omitempty"`
+}
+
+// ScriptingConfig lists hooks written in expressions, run on every request
+// after the routing rules. A group a hook picks selects the backends whose
+// GroupLabel label has that value.
+type ScriptingConfig struct {
+	Enabled    bool               `mapstructure:"enabled" json:"enabled"`
+	GroupLabel string             `mapstructure:"group_label" json:"group_label"`
+	Hooks      []ScriptHookConfig `mapstructure:"hooks" json:"hooks"`
+}
+
+// ScriptHookConfig applies to the requests for which the bool expression
+// When holds. The string expressions Group and Headers (header name to
+// value) pick the request's backend group and set request headers, and a
+// non-zero Reject refuses the request with that status. Fallback sends the
+// request to any backend while none in its group is available.
+type ScriptHookConfig struct {
+	Name     string            `mapstructure:"name" json:"name"`
+	When     string            `mapstructure:"when" json:"when"`
+	Group    string            `mapstructure:"group" json:"group,omitempty"`
+	Fallback bool              `mapstructure:"fallback" json:"fallback,omitempty"`
+	Headers  map[string]string `mapstructure:"headers" json:"headers,omitempty"`
+	Reject   int               `mapstructure:"reject" json:"reject,omitempty"`
+}
+
+// RoutingConditionConfig matches the header, query parameter or JSON body
+// field (a dot-separated path such as "tenant.id") Name, as selected by
+// Source, against the regular expression Pattern.
+type RoutingConditionConfig struct {
+	Source  string `mapstructure:"source" json:"source"`
+	Name    string `mapstructure:"name" json:"name"`
+	Pattern string `mapstructure:"pattern" json:"pattern"`
+}
+
+// TrafficConfig classifies requests as probe, bot, browser or api traffic.
+// ProbePaths are exact paths and the *Agents fields User-Agent regular
+// expressions; empty lists use built-in patterns. Header, when set, passes
+// the class to the backend, and classes in SkipEndpointMetrics are left out
+// of per-endpoint metrics.
+type TrafficConfig struct {
+	Enabled             bool     `mapstructure:"enabled" json:"enabled"`
+	Header              string   `mapstructure:"header" json:"header"`
+	ProbePaths          []string `mapstructure:"probe_paths" json:"probe_paths"`
+	ProbeAgents         []string `mapstructure:"probe_agents" json:"probe_agents"`
+	BotAgents           []string `mapstructure:"bot_agents" json:"bot_agents"`
+	BrowserAgents       []string `mapstructure:"browser_agents" json:"browser_agents"`
+	SkipEndpointMetrics []string `mapstructure:"skip_endpoint_metrics" json:"skip_endpoint_metrics"`
+}
+
+type AdminTokenConfig struct {
+	Token string `mapstructure:"token" json:"token"`
+	Role  string `mapstructure:"role" json:"role"`
+}
+
+type AdminConfig struct {
+	Enabled bool               `mapstructure:"enabled" json:"enabled"`
+	Tokens  []AdminTokenConfig `mapstructure:"tokens" json:"tokens"`
 }
 
 type Config struct {
-	Server         ServerConfig         `mapstructure:"server"`
-	HealthCheck    HealthCheckConfig    `mapstructure:"health_check"`
-	Strategy       StrategyConfig       `mapstructure:"strategy"`
-	Backends       []BackendConfig      `mapstructure:"backends"`
-	Logging        LoggingConfig        `mapstructure:"logging"`
-	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
-	Retry          RetryConfig          `mapstructure:"retry"`
+	Server         ServerConfig         `mapstructure:"server" json:"server"`
+	HealthCheck    HealthCheckConfig    `mapstructure:"health_check" json:"health_check"`
+	Preflight      PreflightConfig      `mapstructure:"preflight" json:"preflight"`
+	Strategy       StrategyConfig       `mapstructure:"strategy" json:"strategy"`
+	Backends       []BackendConfig      `mapstructure:"backends" json:"backends"`
+	Logging        LoggingConfig        `mapstructure:"logging" json:"logging"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker" json:"circuit_breaker"`
+	Retry          RetryConfig          `mapstructure:"retry" json:"retry"`
+	Dial           DialConfig           `mapstructure:"dial" json:"dial"`
+	Drain          DrainConfig          `mapstructure:"drain" json:"drain"`
+	Discovery      DiscoveryConfig      `mapstructure:"discovery" json:"discovery"`
+	Deadline       DeadlineConfig       `mapstructure:"deadline" json:"deadline"`
+	ClientIP       ClientIPConfig       `mapstructure:"client_ip" json:"client_ip"`
+	Capacity       CapacityConfig       `mapstructure:"capacity" json:"capacity"`
+	Feedback       FeedbackConfig       `mapstructure:"feedback" json:"feedback"`
+	Standby        StandbyConfig        `mapstructure:"standby" json:"standby"`
+	Failover       FailoverConfig       `mapstructure:"failover" json:"failover"`
+	Schedule       ScheduleConfig       `mapstructure:"schedule" json:"schedule"`
+	Tunnel         TunnelConfig         `mapstructure:"tunnel" json:"tunnel"`
+	Overrides      OverridesConfig      `mapstructure:"overrides" json:"overrides"`
+	State          StateConfig          `mapstructure:"state" json:"state"`
+	Postmortem     PostmortemConfig     `mapstructure:"postmortem" json:"postmortem"`
+	Peers          PeersConfig          `mapstructure:"peers" json:"peers"`
+	Registration   RegistrationConfig   `mapstructure:"registration" json:"registration"`
+	Capture        CaptureConfig        `mapstructure:"capture" json:"capture"`
+	BodyInspection BodyInspectionConfig `mapstructure:"body_inspection" json:"body_inspection"`
+	WAF            WAFConfig            `mapstructure:"waf" json:"waf"`
+	Routing        RoutingConfig        `mapstructure:"routing" json:"routing"`
+	Scripting      ScriptingConfig      `mapstructure:"scripting" json:"scripting"`
+	Traffic        TrafficConfig        `mapstructure:"traffic" json:"traffic"`
+	Fingerprints   FingerprintsConfig   `mapstructure:"fingerprints" json:"fingerprints"`
+	FDMonitor      FDMonitorConfig      `mapstructure:"fd_monitor" json:"fd_monitor"`
+	Certificates   CertificatesConfig   `mapstructure:"certificates" json:"certificates"`
+	Overload       OverloadConfig       `mapstructure:"overload" json:"overload"`
+	Admission      AdmissionConfig      `mapstructure:"admission" json:"admission"`
+	Metrics        MetricsConfig        `mapstructure:"metrics" json:"metrics"`
+	Admin          AdminConfig          `mapstructure:"admin" json:"admin"`
+	Listeners      ListenersConfig      `mapstructure:"listeners" json:"listeners"`
+
+	// Source is the path of the file the configuration was read from, empty
+	// when only defaults and environment variables were used.
+	Source string `mapstructure:"-" json:"-"`
 }
 
 func Load() (*Config, error) {
-	viper.SetDefault("server.environment", EnvDev)
-	viper.SetDefault("server.address", ":8080")
-	viper.SetDefault("health_check.interval", "2s")
-	viper.SetDefault("strategy.type", "round-robin")
-	viper.SetDefault("strategy.virtual_nodes", 100)
-	viper.SetDefault("logging.level", LogLevelInfo)
-	viper.SetDefault("circuit_breaker.enabled", true)
-	viper.SetDefault("circuit_breaker.failure_threshold", 5)
-	viper.SetDefault("circuit_breaker.reset_timeout", "30s")
-	viper.SetDefault("retry.max_retries", 2)
+	setDefaults(viper.GetViper())
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -98,17 +796,211 @@ func Load() (*Config, error) {
 		slog.Info("loaded config file", slog.String("file", viper.ConfigFileUsed()))
 	}
 
+	return decode(viper.GetViper())
+}
+
+// LoadFile reads the configuration from path with the same defaults and
+// environment overrides as Load, without touching the global viper instance.
+func LoadFile(path string) (*Config, error) {
+	v := viper.New()
+	setDefaults(v)
+
+	v.SetConfigFile(path)
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	return decode(v)
+}
+
+// Parse reads a configuration document in the given format ("yaml" or
+// "json") with the same defaults as Load. Unlike Load it applies no
+// environment overrides, so a document posted to the admin API is checked
+// as written rather than with the variables of the running process.
+func Parse(data []byte, format string) (*Config, error) {
+	v := viper.New()
+	setDefaults(v)
+
+	v.SetConfigType(format)
+
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return decode(v)
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.environment", EnvDev)
+	v.SetDefault("server.address", ":8080")
+	v.SetDefault("server.keep_alive.enabled", true)
+	v.SetDefault("server.keep_alive.idle_timeout", "60s")
+	v.SetDefault("server.keep_alive.max_requests", 0)
+	v.SetDefault("server.keep_alive.max_idle_per_client", 0)
+	v.SetDefault("server.keep_alive.rebalance_window", "0s")
+	v.SetDefault("server.keep_alive.rebalance_interval", "1m")
+	v.SetDefault("server.drain_period", "0s")
+	v.SetDefault("server.read_timeout", "15s")
+	v.SetDefault("server.write_timeout", "15s")
+	v.SetDefault("server.headers.max_bytes", 1<<20)
+	v.SetDefault("server.headers.max_count", 0)
+	v.SetDefault("server.headers.max_line_length", 0)
+	v.SetDefault("health_check.interval", "2s")
+	v.SetDefault("health_check.slow_start", "0s")
+	v.SetDefault("preflight.enabled", true)
+	v.SetDefault("preflight.require_healthy", false)
+	v.SetDefault("preflight.timeout", "5s")
+	v.SetDefault("strategy.type", "round-robin")
+	v.SetDefault("strategy.virtual_nodes", 100)
+	v.SetDefault("strategy.hash_key", "ip")
+	v.SetDefault("strategy.ipv4_prefix", 24)
+	v.SetDefault("strategy.ipv6_prefix", 56)
+	v.SetDefault("strategy.weight_ramp", "")
+	v.SetDefault("strategy.decay", "10s")
+	v.SetDefault("strategy.error_penalty", "1s")
+	v.SetDefault("strategy.p2c", false)
+	v.SetDefault("strategy.p95_threshold", "500ms")
+	v.SetDefault("strategy.subset_size", 0)
+	v.SetDefault("strategy.local_zone", "")
+	v.SetDefault("strategy.chain", []string{})
+	v.SetDefault("strategy.chain_max_load", 0)
+	v.SetDefault("strategy.chain_max_latency", "0")
+	v.SetDefault("strategy.chain_max_reported_load", 0.0)
+	v.SetDefault("logging.level", LogLevelInfo)
+	v.SetDefault("logging.buffer", 1024)
+	v.SetDefault("circuit_breaker.enabled", true)
+	v.SetDefault("circuit_breaker.failure_threshold", 5)
+	v.SetDefault("circuit_breaker.reset_timeout", "30s")
+	v.SetDefault("circuit_breaker.weight_decay.enabled", false)
+	v.SetDefault("circuit_breaker.weight_decay.factor", 0.5)
+	v.SetDefault("circuit_breaker.weight_decay.recovery", "30s")
+	v.SetDefault("retry.max_retries", 2)
+	v.SetDefault("dial.happy_eyeballs", false)
+	v.SetDefault("dial.fallback_delay", "300ms")
+	v.SetDefault("dial.idle_timeout", "90s")
+	v.SetDefault("drain.timeout", "0s")
+	v.SetDefault("discovery.dns_interval", "30s")
+	v.SetDefault("discovery.etcd.enabled", false)
+	v.SetDefault("discovery.etcd.prefix", "/load-balancer/backends/")
+	v.SetDefault("discovery.etcd.retry_interval", "5s")
+	v.SetDefault("discovery.file.enabled", false)
+	v.SetDefault("discovery.file.poll_interval", "30s")
+	v.SetDefault("deadline.enabled", false)
+	v.SetDefault("deadline.timeout", "10s")
+	v.SetDefault("deadline.header", "X-Deadline-Ms")
+	v.SetDefault("client_ip.header", "X-Forwarded-For")
+	v.SetDefault("client_ip.trusted_proxies", []string{"0.0.0.0/0", "::/0"})
+	v.SetDefault("feedback.enabled", false)
+	v.SetDefault("standby.min_active", 1)
+	v.SetDefault("failover.min_healthy", 0.5)
+	v.SetDefault("failover.max_latency", "0")
+	v.SetDefault("failover.fail_after", 3)
+	v.SetDefault("failover.recover_after", 10)
+	v.SetDefault("failover.probe_share", 0.05)
+	v.SetDefault("schedule.interval", "15s")
+	v.SetDefault("capacity.enabled", false)
+	v.SetDefault("capacity.interval", "30s")
+	v.SetDefault("capacity.target_latency", "200ms")
+	v.SetDefault("capacity.max_weight", 10)
+	v.SetDefault("capacity.min_requests", 20)
+	v.SetDefault("tunnel.enabled", false)
+	v.SetDefault("tunnel.dial_timeout", "5s")
+	v.SetDefault("tunnel.max_open", 1000)
+	v.SetDefault("overrides.file", "")
+	v.SetDefault("overrides.interval", "5s")
+	v.SetDefault("state.import_file", "")
+	v.SetDefault("postmortem.enabled", false)
+	v.SetDefault("postmortem.dir", ".")
+	v.SetDefault("postmortem.events", 1000)
+	v.SetDefault("peers.interval", "5s")
+	v.SetDefault("registration.enabled", false)
+	v.SetDefault("registration.type", RegistryConsul)
+	v.SetDefault("registration.service", "load-balancer")
+	v.SetDefault("registration.interval", "10s")
+	v.SetDefault("registration.ttl", "1m")
+	v.SetDefault("registration.prefix", "/services/load-balancer/")
+	v.SetDefault("metrics.endpoints.enabled", false)
+	v.SetDefault("metrics.cache_ttl", "1s")
+	v.SetDefault("metrics.remote_write.enabled", false)
+	v.SetDefault("metrics.remote_write.interval", "15s")
+	v.SetDefault("metrics.remote_write.timeout", "10s")
+	v.SetDefault("metrics.remote_write.batch_size", 500)
+	v.SetDefault("metrics.remote_write.max_retries", 3)
+	v.SetDefault("metrics.remote_write.min_backoff", "100ms")
+	v.SetDefault("metrics.remote_write.max_backoff", "5s")
+	v.SetDefault("fd_monitor.enabled", true)
+	v.SetDefault("fd_monitor.interval", "10s")
+	v.SetDefault("fd_monitor.warn_ratio", 0.8)
+	v.SetDefault("certificates.enabled", true)
+	v.SetDefault("certificates.interval", "1h")
+	v.SetDefault("certificates.timeout", "5s")
+	v.SetDefault("certificates.warn_days", 14)
+	v.SetDefault("overload.enabled", false)
+	v.SetDefault("overload.interval", "1s")
+	v.SetDefault("overload.cpu_threshold", 0.85)
+	v.SetDefault("overload.memory_limit_mb", 0)
+	v.SetDefault("overload.priority_header", "X-Priority")
+	v.SetDefault("overload.default_priority", "normal")
+
+	v.SetDefault("admission.enabled", false)
+	v.SetDefault("admission.max_in_flight", 100)
+	v.SetDefault("admission.max_queued", 1000)
+	v.SetDefault("admission.timeout", "1s")
+	v.SetDefault("capture.enabled", false)
+	v.SetDefault("capture.max_duration", "15m")
+	v.SetDefault("body_inspection.enabled", false)
+	v.SetDefault("body_inspection.max_bytes", 1<<20)
+	v.SetDefault("body_inspection.max_decoded_bytes", 4<<20)
+	v.SetDefault("body_inspection.decompress", true)
+	v.SetDefault("body_inspection.forward", "original")
+	v.SetDefault("body_inspection.reject_oversized", false)
+	v.SetDefault("waf.enabled", false)
+	v.SetDefault("waf.tag_header", "X-WAF-Tags")
+	v.SetDefault("waf.uninspected_bodies", "match")
+	v.SetDefault("routing.enabled", false)
+	v.SetDefault("routing.max_body_bytes", 64<<10)
+	v.SetDefault("scripting.enabled", false)
+	v.SetDefault("scripting.group_label", "group")
+	v.SetDefault("traffic.enabled", false)
+	v.SetDefault("traffic.header", "")
+	v.SetDefault("traffic.skip_endpoint_metrics", []string{"probe"})
+	v.SetDefault("fingerprints.enabled", false)
+	v.SetDefault("fingerprints.max_entries", 1000)
+	v.SetDefault("fingerprints.tls_header", "")
+	v.SetDefault("admin.enabled", false)
+	v.SetDefault("listeners.pprof.enabled", true)
+	v.SetDefault("listeners.pprof.address", ":6060")
+}
+
+// Defaults returns the configuration with every setting at its default. It
+// is not validated: it has no backends, for one.
+func Defaults() *Config {
+	v := viper.New()
+	setDefaults(v)
+
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	v.Unmarshal(&cfg)
+	return &cfg
+}
+
+func decode(v *viper.Viper) (*Config, error) {
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
 		slog.Error("failed to unmarshal config", slog.String("error", err.Error()))
 		return nil, err
 	}
 
+	cfg.normalizeBackends()
+
 	if err := cfg.Validate(); err != nil {
 		slog.Error("invalid configuration", slog.String("error", err.Error()))
 		return nil, err
 	}
 
+	cfg.Source = v.ConfigFileUsed()
 	return &cfg, nil
 }
 
@@ -130,6 +1022,43 @@ func (c *Config) Validate() error {
 						validation.Required,
 						validation.By(validateHostPort),
 					),
+					validation.Field(&sc.KeepAlive, validation.By(func(value interface{}) error {
+						ka, _ := value.(KeepAliveConfig)
+						err := validation.ValidateStruct(&ka,
+							validation.Field(&ka.IdleTimeout, validation.When(ka.IdleTimeout != "", validation.By(validateDuration))),
+							validation.Field(&ka.MaxRequests, validation.Min(0)),
+							validation.Field(&ka.MaxIdlePerClient, validation.Min(0)),
+							validation.Field(&ka.RebalanceWindow, validation.When(ka.RebalanceWindow != "", validation.By(validateDuration))),
+							validation.Field(&ka.RebalanceInterval, validation.When(ka.RebalanceInterval != "", validation.By(validateDuration))),
+						)
+						if err != nil {
+							return err
+						}
+						window, _ := time.ParseDuration(ka.RebalanceWindow)
+						interval, _ := time.ParseDuration(ka.RebalanceInterval)
+						if window > 0 && interval <= window {
+							return validation.NewError("validation_invalid_rebalance_interval", "rebalance_interval must be longer than rebalance_window")
+						}
+						return nil
+					})),
+					validation.Field(&sc.DrainPeriod,
+						validation.When(sc.DrainPeriod != "", validation.By(validateDuration)),
+					),
+					validation.Field(&sc.ReadTimeout,
+						validation.When(sc.ReadTimeout != "", validation.By(validateDuration)),
+					),
+					validation.Field(&sc.WriteTimeout,
+						validation.When(sc.WriteTimeout != "", validation.By(validateDuration)),
+					),
+					validation.Field(&sc.RouteTimeouts, validation.Each(validation.By(validateRouteTimeout))),
+					validation.Field(&sc.Headers, validation.By(func(value interface{}) error {
+						hl, _ := value.(HeaderLimitsConfig)
+						return validation.ValidateStruct(&hl,
+							validation.Field(&hl.MaxBytes, validation.Min(0)),
+							validation.Field(&hl.MaxCount, validation.Min(0)),
+							validation.Field(&hl.MaxLineLength, validation.Min(0)),
+						)
+					})),
 				)
 			}),
 		),
@@ -145,6 +1074,76 @@ func (c *Config) Validate() error {
 						validation.Required,
 						validation.In(LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError),
 					),
+					validation.Field(&lc.Buffer, validation.Min(0)),
+				)
+			}),
+		),
+		validation.Field(&c.CircuitBreaker,
+			validation.By(func(value interface{}) error {
+				cc, ok := value.(CircuitBreakerConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a CircuitBreakerConfig")
+				}
+				wd := cc.WeightDecay
+				if !wd.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&wd,
+					validation.Field(&wd.Factor, validation.Required, validation.Min(0.0).Exclusive(), validation.Max(1.0).Exclusive()),
+					validation.Field(&wd.Recovery, validation.Required, validation.By(validateDuration)),
+				)
+			}),
+		),
+		validation.Field(&c.Discovery,
+			validation.By(func(value interface{}) error {
+				dc, ok := value.(DiscoveryConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a DiscoveryConfig")
+				}
+				dns := c.HealthCheck.ExpandDNS || slices.ContainsFunc(c.Backends, func(bc BackendConfig) bool { return bc.DNS != "" })
+				return validation.ValidateStruct(&dc,
+					validation.Field(&dc.DNSInterval, validation.When(dns, validation.Required, validation.By(validateDuration))),
+					validation.Field(&dc.Etcd, validation.By(func(value interface{}) error {
+						ec, _ := value.(EtcdDiscoveryConfig)
+						if !ec.Enabled {
+							return nil
+						}
+						return validation.ValidateStruct(&ec,
+							validation.Field(&ec.URL, validation.By(validateServerURL)),
+							validation.Field(&ec.Prefix, validation.Required),
+							validation.Field(&ec.RetryInterval, validation.Required, validation.By(validateDuration)),
+						)
+					})),
+					validation.Field(&dc.File, validation.By(func(value interface{}) error {
+						fc, _ := value.(FileDiscoveryConfig)
+						if !fc.Enabled {
+							return nil
+						}
+						return validation.ValidateStruct(&fc,
+							validation.Field(&fc.Path, validation.Required),
+							validation.Field(&fc.PollInterval, validation.Required, validation.By(validateDuration)),
+						)
+					})),
+				)
+			}),
+		),
+		validation.Field(&c.Drain,
+			validation.By(func(value interface{}) error {
+				dc, _ := value.(DrainConfig)
+				return validation.ValidateStruct(&dc,
+					validation.Field(&dc.Timeout, validation.When(dc.Timeout != "", validation.By(validateDuration))),
+				)
+			}),
+		),
+		validation.Field(&c.Dial,
+			validation.By(func(value interface{}) error {
+				dc, ok := value.(DialConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a DialConfig")
+				}
+				return validation.ValidateStruct(&dc,
+					validation.Field(&dc.FallbackDelay, validation.When(dc.HappyEyeballs, validation.Required, validation.By(validateDuration))),
+					validation.Field(&dc.IdleTimeout, validation.When(dc.IdleTimeout != "", validation.By(validateDuration))),
 				)
 			}),
 		),
@@ -160,13 +1159,30 @@ func (c *Config) Validate() error {
 						validation.Required,
 						validation.By(validateDuration),
 					),
+					validation.Field(&hc.SlowStart,
+						validation.When(hc.SlowStart != "", validation.By(validateDuration)),
+					),
+				)
+			}),
+		),
+		validation.Field(&c.Preflight,
+			validation.By(func(value interface{}) error {
+				pc, ok := value.(PreflightConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a PreflightConfig")
+				}
+				if !pc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&pc,
+					validation.Field(&pc.Timeout, validation.Required, validation.By(validateDuration)),
 				)
 			}),
 		),
 		validation.Field(&c.Backends,
-			validation.Required,
-			validation.Length(1, 0),
+			validation.When(!c.Discovery.Etcd.Enabled && !c.Discovery.File.Enabled, validation.Required, validation.Length(1, 0)),
 			validation.Each(validation.By(validateBackendConfig)),
+			validation.By(validateUniqueBackends),
 		),
 		validation.Field(&c.Strategy,
 			validation.Required,
@@ -178,12 +1194,521 @@ func (c *Config) Validate() error {
 				return validation.ValidateStruct(&sc,
 					validation.Field(&sc.Type,
 						validation.Required,
-						validation.In("round-robin", "least-conn", "least-response", "random", "consistent_hash", "weighted-round-robin"),
+						validation.In(append(strategyTypes, "chain")...),
+					),
+					validation.Field(&sc.Chain,
+						validation.When(sc.Type == "chain", validation.Required, validation.Length(2, 0)),
+						validation.Each(validation.In(strategyTypes...)),
 					),
+					validation.Field(&sc.ChainMaxLoad, validation.Min(0)),
+					validation.Field(&sc.ChainMaxLatency,
+						validation.When(sc.ChainMaxLatency != "", validation.By(validateDuration)),
+					),
+					validation.Field(&sc.ChainMaxReportedLoad, validation.Min(0.0), validation.Max(1.0)),
 					validation.Field(&sc.VirtualNodes,
 						validation.Required,
 						validation.Min(1),
 					),
+					validation.Field(&sc.IPv4Prefix,
+						validation.Min(0),
+						validation.Max(32),
+					),
+					validation.Field(&sc.IPv6Prefix,
+						validation.Min(0),
+						validation.Max(128),
+					),
+					validation.Field(&sc.HashParam,
+						validation.When(sc.Uses("query-hash", "cookie-hash", "header-hash"), validation.Required),
+						validation.When(sc.Uses("cookie-hash"), validation.By(validateHashKeyName(hashkey.Cookie))),
+						validation.When(sc.Uses("header-hash"), validation.By(validateHashKeyName(hashkey.Header))),
+					),
+					validation.Field(&sc.HashKey, validation.When(sc.HashKey != "", validation.By(validateHashKey))),
+					validation.Field(&sc.WeightRamp,
+						validation.When(sc.WeightRamp != "", validation.By(validateDuration)),
+						validation.When(!sc.Uses("weighted-round-robin"), validation.By(validateNoWeightRamp)),
+					),
+					validation.Field(&sc.Decay,
+						validation.When(sc.Uses("peak-ewma"), validation.Required, validation.By(validateDuration)),
+					),
+					validation.Field(&sc.ErrorPenalty,
+						validation.When(sc.Uses("peak-ewma"), validation.Required, validation.By(validateDuration)),
+					),
+					validation.Field(&sc.P95Threshold,
+						validation.When(sc.Uses("p95"), validation.Required, validation.By(validateDuration)),
+					),
+					validation.Field(&sc.WarmPaths, validation.Each(validation.By(validatePathPrefix))),
+					validation.Field(&sc.FailoverHeader, validation.Match(headerNamePattern).Error("must be a header name")),
+					validation.Field(&sc.SubsetSize, validation.Min(0)),
+				)
+			}),
+		),
+		validation.Field(&c.Standby,
+			validation.By(func(value interface{}) error {
+				sc, ok := value.(StandbyConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a StandbyConfig")
+				}
+				return validation.ValidateStruct(&sc,
+					validation.Field(&sc.MinActive, validation.Min(0)),
+				)
+			}),
+		),
+		validation.Field(&c.Failover,
+			validation.By(func(value interface{}) error {
+				fc, ok := value.(FailoverConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a FailoverConfig")
+				}
+				if !slices.ContainsFunc(c.Backends, func(b BackendConfig) bool { return b.Remote }) {
+					return nil
+				}
+				maxLatency, _ := time.ParseDuration(fc.MaxLatency)
+				return validation.ValidateStruct(&fc,
+					validation.Field(&fc.MinHealthy, validation.Min(0.0), validation.Max(1.0)),
+					validation.Field(&fc.MaxLatency, validation.Required, validation.By(validateDuration)),
+					validation.Field(&fc.FailAfter, validation.Required, validation.Min(1)),
+					validation.Field(&fc.RecoverAfter, validation.Required, validation.Min(1)),
+					validation.Field(&fc.ProbeShare, validation.Min(0.0), validation.Max(1.0),
+						validation.When(maxLatency > 0,
+							validation.Required.Error("must be above 0 when max_latency is set, or failing back on latency is never measured"))),
+				)
+			}),
+		),
+		validation.Field(&c.Schedule,
+			validation.By(func(value interface{}) error {
+				sc, ok := value.(ScheduleConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a ScheduleConfig")
+				}
+				return validation.ValidateStruct(&sc,
+					validation.Field(&sc.Interval,
+						validation.When(len(sc.Rules) > 0, validation.Required),
+						validation.When(sc.Interval != "", validation.By(validateDuration)),
+					),
+					validation.Field(&sc.Rules, validation.Each(validation.By(validateScheduleRule))),
+				)
+			}),
+		),
+		validation.Field(&c.ClientIP,
+			validation.By(func(value interface{}) error {
+				cc, ok := value.(ClientIPConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a ClientIPConfig")
+				}
+				return validation.ValidateStruct(&cc,
+					validation.Field(&cc.Header, validation.Match(headerNamePattern).Error("must be a header name")),
+					validation.Field(&cc.TrustedProxies, validation.Each(validation.By(validateCIDR))),
+				)
+			}),
+		),
+		validation.Field(&c.Capacity,
+			validation.By(func(value interface{}) error {
+				cc, ok := value.(CapacityConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a CapacityConfig")
+				}
+				if !cc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&cc,
+					validation.Field(&cc.Interval, validation.Required, validation.By(validateDuration)),
+					validation.Field(&cc.TargetLatency, validation.Required, validation.By(validateDuration)),
+					validation.Field(&cc.MaxWeight, validation.Required, validation.Min(1)),
+					validation.Field(&cc.MinRequests, validation.Min(0)),
+				)
+			}),
+		),
+		validation.Field(&c.Postmortem,
+			validation.By(func(value interface{}) error {
+				pc, ok := value.(PostmortemConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a PostmortemConfig")
+				}
+				if !pc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&pc,
+					validation.Field(&pc.Dir, validation.Required),
+					validation.Field(&pc.Events, validation.Required, validation.Min(1)),
+				)
+			}),
+		),
+		validation.Field(&c.FDMonitor,
+			validation.By(func(value interface{}) error {
+				fc, ok := value.(FDMonitorConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a FDMonitorConfig")
+				}
+				if !fc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&fc,
+					validation.Field(&fc.Interval, validation.Required, validation.By(validateDuration)),
+					validation.Field(&fc.WarnRatio, validation.Required, validation.Min(0.0), validation.Max(1.0)),
+				)
+			}),
+		),
+		validation.Field(&c.Certificates,
+			validation.By(func(value interface{}) error {
+				cc, ok := value.(CertificatesConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a CertificatesConfig")
+				}
+				if !cc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&cc,
+					validation.Field(&cc.Interval, validation.Required, validation.By(validateDuration)),
+					validation.Field(&cc.Timeout, validation.Required, validation.By(validateDuration)),
+					validation.Field(&cc.WarnDays, validation.Min(0)),
+				)
+			}),
+		),
+		validation.Field(&c.Deadline,
+			validation.By(func(value interface{}) error {
+				dc, ok := value.(DeadlineConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a DeadlineConfig")
+				}
+				if !dc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&dc,
+					validation.Field(&dc.Timeout, validation.When(dc.Timeout != "", validation.By(validateDuration))),
+					validation.Field(&dc.Header, validation.Required, validation.Match(headerNamePattern).Error("must be a header name")),
+				)
+			}),
+		),
+		validation.Field(&c.Overload,
+			validation.By(func(value interface{}) error {
+				oc, ok := value.(OverloadConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be an OverloadConfig")
+				}
+				if !oc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&oc,
+					validation.Field(&oc.Interval, validation.Required, validation.By(validateDuration)),
+					validation.Field(&oc.CPUThreshold, validation.Min(0.0), validation.Max(1.0)),
+					validation.Field(&oc.MemoryLimitMB, validation.Min(0)),
+					validation.Field(&oc.PriorityHeader, validation.Match(headerNamePattern).Error("must be a header name")),
+					validation.Field(&oc.DefaultPriority, validation.Required, validation.In("low", "normal", "high")),
+				)
+			}),
+		),
+		validation.Field(&c.Admission,
+			validation.By(func(value interface{}) error {
+				ac, ok := value.(AdmissionConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be an AdmissionConfig")
+				}
+				if !ac.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&ac,
+					validation.Field(&ac.MaxInFlight, validation.Required, validation.Min(1)),
+					validation.Field(&ac.MaxQueued, validation.Min(0)),
+					validation.Field(&ac.Timeout, validation.Required, validation.By(validateDuration)),
+				)
+			}),
+		),
+		validation.Field(&c.Tunnel,
+			validation.By(func(value interface{}) error {
+				tc, ok := value.(TunnelConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a TunnelConfig")
+				}
+				if !tc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&tc,
+					validation.Field(&tc.DialTimeout, validation.Required, validation.By(validateDuration)),
+					validation.Field(&tc.MaxOpen, validation.Min(0)),
+				)
+			}),
+		),
+		validation.Field(&c.Overrides,
+			validation.By(func(value interface{}) error {
+				oc, ok := value.(OverridesConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be an OverridesConfig")
+				}
+				if oc.File == "" {
+					return nil
+				}
+				return validation.ValidateStruct(&oc,
+					validation.Field(&oc.Interval, validation.Required, validation.By(validateDuration)),
+				)
+			}),
+		),
+		validation.Field(&c.Peers,
+			validation.By(func(value interface{}) error {
+				pc, ok := value.(PeersConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a PeersConfig")
+				}
+				if len(pc.Addresses) == 0 {
+					return nil
+				}
+				return validation.ValidateStruct(&pc,
+					validation.Field(&pc.Addresses, validation.Each(validation.By(validateServerURL))),
+					validation.Field(&pc.Interval, validation.Required, validation.By(validateDuration)),
+				)
+			}),
+		),
+		validation.Field(&c.Registration,
+			validation.By(func(value interface{}) error {
+				rc, ok := value.(RegistrationConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a RegistrationConfig")
+				}
+				if !rc.Enabled {
+					return nil
+				}
+				err := validation.ValidateStruct(&rc,
+					validation.Field(&rc.Type, validation.Required, validation.In(RegistryConsul, RegistryEtcd)),
+					validation.Field(&rc.URL, validation.By(validateServerURL)),
+					validation.Field(&rc.Service, validation.Required),
+					validation.Field(&rc.Address, validation.When(rc.Address != "", validation.By(validateHostPort))),
+					validation.Field(&rc.HealthURL, validation.When(rc.HealthURL != "", validation.By(validateServerURL))),
+					validation.Field(&rc.Interval, validation.Required, validation.By(validateDuration)),
+					validation.Field(&rc.TTL, validation.Required, validation.By(validateDuration)),
+				)
+				if err != nil {
+					return err
+				}
+				interval, _ := time.ParseDuration(rc.Interval)
+				ttl, _ := time.ParseDuration(rc.TTL)
+				if interval <= 0 || ttl <= interval {
+					return validation.NewError("validation_invalid_ttl", "ttl must be longer than a positive interval")
+				}
+				if rc.Type == RegistryConsul && ttl < time.Minute {
+					return validation.NewError("validation_invalid_ttl", "ttl must be at least 1m for consul")
+				}
+				return nil
+			}),
+		),
+		validation.Field(&c.Capture,
+			validation.By(func(value interface{}) error {
+				cc, ok := value.(CaptureConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a CaptureConfig")
+				}
+				if !cc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&cc,
+					validation.Field(&cc.MaxDuration, validation.Required, validation.By(validateDuration)),
+				)
+			}),
+		),
+		validation.Field(&c.BodyInspection,
+			validation.By(func(value interface{}) error {
+				bc, ok := value.(BodyInspectionConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a BodyInspectionConfig")
+				}
+				if !bc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&bc,
+					validation.Field(&bc.MaxBytes, validation.Required, validation.Min(int64(1))),
+					validation.Field(&bc.MaxDecodedBytes, validation.Required, validation.Min(int64(1))),
+					validation.Field(&bc.Forward, validation.In("original", "recompress", "identity")),
+				)
+			}),
+		),
+		validation.Field(&c.Traffic,
+			validation.By(func(value interface{}) error {
+				tc, ok := value.(TrafficConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a TrafficConfig")
+				}
+				if !tc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&tc,
+					validation.Field(&tc.Header, validation.Match(headerNamePattern).Error("must be a header name")),
+					validation.Field(&tc.ProbePaths, validation.Each(validation.By(func(value interface{}) error {
+						if path, _ := value.(string); !strings.HasPrefix(path, "/") {
+							return validation.NewError("validation_invalid_path", "must start with /")
+						}
+						return nil
+					}))),
+					validation.Field(&tc.ProbeAgents, validation.Each(validation.By(validateRegexp))),
+					validation.Field(&tc.BotAgents, validation.Each(validation.By(validateRegexp))),
+					validation.Field(&tc.BrowserAgents, validation.Each(validation.By(validateRegexp))),
+					validation.Field(&tc.SkipEndpointMetrics, validation.Each(validation.In("probe", "bot", "browser", "api"))),
+				)
+			}),
+		),
+		validation.Field(&c.WAF,
+			validation.By(func(value interface{}) error {
+				wc, ok := value.(WAFConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a WAFConfig")
+				}
+				if !wc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&wc,
+					validation.Field(&wc.TagHeader, validation.Match(headerNamePattern).Error("must be a header name")),
+					validation.Field(&wc.UninspectedBodies, validation.In("match", "skip")),
+					validation.Field(&wc.Rules, validation.Each(validation.By(validateWAFRule)), validation.By(func(value interface{}) error {
+						seen := make(map[string]int, len(wc.Rules))
+						for i, rule := range wc.Rules {
+							if first, ok := seen[rule.Name]; ok {
+								return validation.NewError("validation_duplicate_waf_rule",
+									fmt.Sprintf("rules %d and %d are both named %s", first, i, rule.Name))
+							}
+							seen[rule.Name] = i
+						}
+						return nil
+					})),
+				)
+			}),
+		),
+		validation.Field(&c.Fingerprints,
+			validation.By(func(value interface{}) error {
+				fc, ok := value.(FingerprintsConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a FingerprintsConfig")
+				}
+				if !fc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&fc,
+					validation.Field(&fc.MaxEntries, validation.Required, validation.Min(1)),
+					validation.Field(&fc.TLSHeader, validation.Match(headerNamePattern).Error("must be a header name")),
+				)
+			}),
+		),
+		validation.Field(&c.Routing,
+			validation.By(func(value interface{}) error {
+				rc, ok := value.(RoutingConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a RoutingConfig")
+				}
+				if !rc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&rc,
+					validation.Field(&rc.MaxBodyBytes, validation.Min(0)),
+					validation.Field(&rc.Rules, validation.Each(validation.By(validateRoutingRule)), validation.By(func(value interface{}) error {
+						seen := make(map[string]int, len(rc.Rules))
+						for i, rule := range rc.Rules {
+							if first, ok := seen[rule.Name]; ok {
+								return validation.NewError("validation_duplicate_routing_rule",
+									fmt.Sprintf("rules %d and %d are both named %s", first, i, rule.Name))
+							}
+							seen[rule.Name] = i
+						}
+						return nil
+					})),
+				)
+			}),
+		),
+		validation.Field(&c.Scripting,
+			validation.By(func(value interface{}) error {
+				sc, ok := value.(ScriptingConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a ScriptingConfig")
+				}
+				if !sc.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&sc,
+					validation.Field(&sc.GroupLabel, validation.Required),
+					validation.Field(&sc.Hooks, validation.Each(validation.By(validateScriptHook)), validation.By(func(value interface{}) error {
+						seen := make(map[string]int, len(sc.Hooks))
+						for i, hook := range sc.Hooks {
+							if first, ok := seen[hook.Name]; ok {
+								return validation.NewError("validation_duplicate_script_hook",
+									fmt.Sprintf("hooks %d and %d are both named %s", first, i, hook.Name))
+							}
+							seen[hook.Name] = i
+						}
+						return nil
+					})),
+				)
+			}),
+		),
+		validation.Field(&c.Metrics,
+			validation.By(func(value interface{}) error {
+				mc, ok := value.(MetricsConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a MetricsConfig")
+				}
+				return validation.ValidateStruct(&mc,
+					validation.Field(&mc.AllowedCIDRs, validation.Each(validation.By(validateCIDR))),
+					validation.Field(&mc.Endpoints, validation.By(func(value interface{}) error {
+						ec, _ := value.(EndpointMetricsConfig)
+						c.Metrics.Endpoints.Templates = nil
+						if !ec.Enabled {
+							return nil
+						}
+						templates, err := metrics.NewEndpoints(ec.Paths)
+						if err != nil {
+							return validation.Errors{"paths": validation.NewError("validation_invalid_path_template", err.Error())}
+						}
+						c.Metrics.Endpoints.Templates = templates
+						return nil
+					})),
+					validation.Field(&mc.CacheTTL, validation.When(mc.CacheTTL != "", validation.By(validateDuration))),
+					validation.Field(&mc.RemoteWrite, validation.By(func(value interface{}) error {
+						rc, _ := value.(RemoteWriteConfig)
+						if !rc.Enabled {
+							return nil
+						}
+						return validation.ValidateStruct(&rc,
+							validation.Field(&rc.URL, validation.By(validateServerURL)),
+							validation.Field(&rc.Interval, validation.Required, validation.By(validateDuration)),
+							validation.Field(&rc.Timeout, validation.Required, validation.By(validateDuration)),
+							validation.Field(&rc.BatchSize, validation.Required, validation.Min(1)),
+							validation.Field(&rc.MaxRetries, validation.Min(0)),
+							validation.Field(&rc.MinBackoff, validation.Required, validation.By(validateDuration)),
+							validation.Field(&rc.MaxBackoff, validation.Required, validation.By(validateDuration)),
+						)
+					})),
+				)
+			}),
+		),
+		validation.Field(&c.Listeners,
+			validation.By(func(value interface{}) error {
+				lc, ok := value.(ListenersConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be a ListenersConfig")
+				}
+				return validation.ValidateStruct(&lc,
+					validation.Field(&lc.Metrics, validation.By(validateListener)),
+					validation.Field(&lc.Admin, validation.By(validateListener)),
+					validation.Field(&lc.Peers, validation.By(validateListener)),
+					validation.Field(&lc.Ready, validation.By(validateListener)),
+					validation.Field(&lc.Pprof, validation.By(func(value interface{}) error {
+						pc, _ := value.(PprofConfig)
+						if !pc.Enabled {
+							return nil
+						}
+						return validateListener(pc.ListenerConfig)
+					})),
+				)
+			}),
+		),
+		validation.Field(&c.Admin,
+			validation.By(func(value interface{}) error {
+				ac, ok := value.(AdminConfig)
+				if !ok {
+					return validation.NewError("validation_invalid_type", "must be an AdminConfig")
+				}
+				if !ac.Enabled {
+					return nil
+				}
+				return validation.ValidateStruct(&ac,
+					validation.Field(&ac.Tokens,
+						validation.Required,
+						validation.Each(validation.By(validateAdminToken)),
+					),
 				)
 			}),
 		),
@@ -214,6 +1739,16 @@ func validateHostPort(value interface{}) error {
 	return nil
 }
 
+// validateNoWeightRamp rejects a weight ramp for strategies that apply
+// weight changes at once, which would otherwise be silently ignored.
+func validateNoWeightRamp(value interface{}) error {
+	ramp, _ := value.(string)
+	if d, err := time.ParseDuration(ramp); err == nil && d > 0 {
+		return validation.NewError("validation_weight_ramp_unsupported", "only weighted-round-robin ramps weight changes")
+	}
+	return nil
+}
+
 func validateDuration(value interface{}) error {
 	durationStr, ok := value.(string)
 	if !ok {
@@ -253,6 +1788,223 @@ func validateServerURL(value interface{}) error {
 	return nil
 }
 
+func validateCIDR(value interface{}) error {
+	cidr, ok := value.(string)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a string")
+	}
+
+	if _, err := netip.ParsePrefix(cidr); err != nil {
+		return validation.NewError("validation_invalid_cidr", "must be a CIDR such as 10.0.0.0/8")
+	}
+
+	return nil
+}
+
+func validateScheduleRule(value interface{}) error {
+	rule, ok := value.(ScheduleRuleConfig)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a ScheduleRuleConfig")
+	}
+
+	return validation.ValidateStruct(&rule,
+		validation.Field(&rule.Name, validation.Required),
+		validation.Field(&rule.Cron, validation.Required, validation.By(func(value interface{}) error {
+			if _, err := cron.Parse(rule.Cron); err != nil {
+				return validation.NewError("validation_invalid_cron", err.Error())
+			}
+			return nil
+		})),
+		validation.Field(&rule.Duration, validation.Required, validation.By(validateDuration)),
+		validation.Field(&rule.Timezone, validation.When(rule.Timezone != "", validation.By(func(value interface{}) error {
+			if _, err := time.LoadLocation(rule.Timezone); err != nil {
+				return validation.NewError("validation_invalid_timezone", "must be an IANA time zone such as Europe/Berlin")
+			}
+			return nil
+		}))),
+		validation.Field(&rule.Action, validation.Required, validation.In("weight", "maintenance", "pool")),
+		validation.Field(&rule.Backends, validation.Required),
+		validation.Field(&rule.Weight, validation.Min(0)),
+	)
+}
+
+func validateListener(value interface{}) error {
+	lc, ok := value.(ListenerConfig)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a ListenerConfig")
+	}
+
+	if lc.Address != "" {
+		if err := validateHostPort(lc.Address); err != nil {
+			return err
+		}
+	}
+
+	if lc.Host != "" {
+		if err := is.Host.Validate(lc.Host); err != nil {
+			return validation.NewError("validation_invalid_host", "invalid host")
+		}
+	}
+
+	for _, timeout := range []string{lc.ReadTimeout, lc.WriteTimeout, lc.IdleTimeout} {
+		if timeout == "" {
+			continue
+		}
+		if err := validateDuration(timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRouteTimeout(value interface{}) error {
+	rt, ok := value.(RouteTimeoutConfig)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a RouteTimeoutConfig")
+	}
+
+	return validation.ValidateStruct(&rt,
+		validation.Field(&rt.PathPrefix, validation.Required, validation.By(validatePathPrefix)),
+		validation.Field(&rt.ReadTimeout, validation.When(rt.ReadTimeout != "", validation.By(validateDuration))),
+		validation.Field(&rt.WriteTimeout, validation.When(rt.WriteTimeout != "", validation.By(validateDuration))),
+	)
+}
+
+func validateHashKey(value interface{}) error {
+	key, _ := value.(string)
+	if _, err := hashkey.Parse(key); err != nil {
+		return validation.NewError("validation_invalid_hash_key", "must be ip, path, cookie:<name> or header:<name>")
+	}
+	return nil
+}
+
+// validateHashKeyName checks the name cookie-hash or header-hash keys on
+// as hash_key would check it for source.
+func validateHashKeyName(source string) validation.RuleFunc {
+	return func(value interface{}) error {
+		name, _ := value.(string)
+		if _, err := hashkey.Parse(source + ":" + name); err != nil {
+			return validation.NewError("validation_invalid_hash_param", "must be a "+source+" name")
+		}
+		return nil
+	}
+}
+
+func validatePathPrefix(value interface{}) error {
+	if prefix, _ := value.(string); !strings.HasPrefix(prefix, "/") {
+		return validation.NewError("validation_invalid_path", "must start with /")
+	}
+	return nil
+}
+
+func validateWAFRule(value interface{}) error {
+	rule, ok := value.(WAFRuleConfig)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a WAFRuleConfig")
+	}
+
+	return validation.ValidateStruct(&rule,
+		validation.Field(&rule.Name, validation.Required),
+		validation.Field(&rule.Path, validation.By(validateRegexp)),
+		validation.Field(&rule.Headers, validation.Each(validation.By(validateRegexp))),
+		validation.Field(&rule.Body, validation.By(validateRegexp)),
+		validation.Field(&rule.Action, validation.Required, validation.In("block", "rate_limit", "tag")),
+		validation.Field(&rule.Status, validation.When(rule.Status != 0, validation.Min(400), validation.Max(599))),
+		validation.Field(&rule.Requests, validation.When(rule.Action == "rate_limit", validation.Required, validation.Min(1))),
+		validation.Field(&rule.Window, validation.When(rule.Action == "rate_limit", validation.Required, validation.By(validateDuration))),
+	)
+}
+
+func validateRoutingRule(value interface{}) error {
+	rule, ok := value.(RoutingRuleConfig)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a RoutingRuleConfig")
+	}
+
+	return validation.ValidateStruct(&rule,
+		validation.Field(&rule.Name, validation.Required),
+		validation.Field(&rule.PathPrefix, validation.When(rule.PathPrefix != "", validation.By(validatePathPrefix))),
+		validation.Field(&rule.Conditions, validation.Each(validation.By(func(value interface{}) error {
+			cond, _ := value.(RoutingConditionConfig)
+			return validation.ValidateStruct(&cond,
+				validation.Field(&cond.Source, validation.Required, validation.In("header", "query", "body")),
+				validation.Field(&cond.Name, validation.Required),
+				validation.Field(&cond.Pattern, validation.By(validateRegexp)),
+			)
+		}))),
+		validation.Field(&rule.Backends, validation.When(len(rule.Labels) == 0, validation.Required.Error("must name backends or labels to route to"))),
+	)
+}
+
+func validateScriptHook(value interface{}) error {
+	hook, ok := value.(ScriptHookConfig)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a ScriptHookConfig")
+	}
+
+	return validation.ValidateStruct(&hook,
+		validation.Field(&hook.Name, validation.Required),
+		validation.Field(&hook.When, validation.Required, validation.By(validateExpression(script.TypeBool))),
+		validation.Field(&hook.Group,
+			validation.When(len(hook.Headers) == 0 && hook.Reject == 0, validation.Required.Error("must pick a group, set headers or reject")),
+			validation.When(hook.Group != "", validation.By(validateExpression(script.TypeString))),
+		),
+		validation.Field(&hook.Headers, validation.By(func(value interface{}) error {
+			for name, expr := range hook.Headers {
+				if !headerNamePattern.MatchString(name) {
+					return validation.NewError("validation_invalid_header", name+" is not a header name")
+				}
+				if _, err := script.Compile(expr, script.TypeString); err != nil {
+					return validation.NewError("validation_invalid_expression", name+": "+err.Error())
+				}
+			}
+			return nil
+		})),
+		validation.Field(&hook.Reject, validation.When(hook.Reject != 0, validation.Min(400), validation.Max(599))),
+	)
+}
+
+// validateExpression checks that a script expression compiles to want.
+func validateExpression(want script.Type) validation.RuleFunc {
+	return func(value interface{}) error {
+		expr, _ := value.(string)
+		if _, err := script.Compile(expr, want); err != nil {
+			return validation.NewError("validation_invalid_expression", err.Error())
+		}
+		return nil
+	}
+}
+
+func validateRegexp(value interface{}) error {
+	pattern, ok := value.(string)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be a string")
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		return validation.NewError("validation_invalid_regexp", err.Error())
+	}
+	return nil
+}
+
+func validateAdminToken(value interface{}) error {
+	token, ok := value.(AdminTokenConfig)
+	if !ok {
+		return validation.NewError("validation_invalid_type", "must be an AdminTokenConfig")
+	}
+
+	if token.Token == "" {
+		return validation.NewError("validation_empty_token", "admin token cannot be empty")
+	}
+
+	if token.Role != AdminRoleObserver && token.Role != AdminRoleOperator {
+		return validation.NewError("validation_invalid_role", "role must be observer or operator")
+	}
+
+	return nil
+}
+
 func validateBackendConfig(value interface{}) error {
 	backend, ok := value.(BackendConfig)
 	if !ok {
@@ -280,5 +2032,36 @@ func validateBackendConfig(value interface{}) error {
 		return validation.NewError("validation_invalid_weight", "weight must be at least 1")
 	}
 
+	if backend.Priority < 0 {
+		return validation.NewError("validation_invalid_priority", "priority must not be negative")
+	}
+
+	if backend.MaxConnections < 0 {
+		return validation.NewError("validation_invalid_max_connections", "max_connections must not be negative")
+	}
+
+	if backend.MaxInFlight < 0 {
+		return validation.NewError("validation_invalid_max_in_flight", "max_in_flight must not be negative")
+	}
+
+	if backend.DNS != "" && backend.DNS != DNSRecordA && backend.DNS != DNSRecordSRV {
+		return validation.NewError("validation_invalid_dns", "dns must be a or srv")
+	}
+
+	if backend.Remote && backend.Standby {
+		return validation.NewError("validation_remote_standby", "a backend cannot be both remote and standby")
+	}
+
+	if hc := backend.HealthCheck; hc != nil {
+		return validation.ValidateStruct(hc,
+			validation.Field(&hc.Type, validation.In("", HealthCheckHTTP, HealthCheckCommand)),
+			validation.Field(&hc.Command,
+				validation.When(hc.Type == HealthCheckCommand, validation.Required),
+				validation.When(hc.Type != HealthCheckCommand, validation.Empty.Error("is only used by command health checks")),
+			),
+			validation.Field(&hc.Timeout, validation.When(hc.Timeout != "", validation.By(validateDuration))),
+		)
+	}
+
 	return nil
 }
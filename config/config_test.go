@@ -3,6 +3,7 @@ package config_test
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -87,4 +88,1011 @@ logging:
 			})
 		})
 	})
+
+	Describe("Defaults", func() {
+		It("should hold the default of every setting", func() {
+			cfg := config.Defaults()
+			Expect(cfg.Strategy.Type).To(Equal("round-robin"))
+			Expect(cfg.Strategy.VirtualNodes).To(Equal(100))
+			Expect(cfg.Strategy.Decay).To(Equal("10s"))
+			Expect(cfg.Strategy.P95Threshold).To(Equal("500ms"))
+			Expect(cfg.Backends).To(BeEmpty())
+		})
+	})
+
+	Describe("Validate", func() {
+		var cfg *config.Config
+
+		BeforeEach(func() {
+			cfg = &config.Config{
+				Server:      config.ServerConfig{Address: ":8080", Environment: config.EnvDev},
+				HealthCheck: config.HealthCheckConfig{Interval: "2s"},
+				Strategy:    config.StrategyConfig{Type: "round-robin", VirtualNodes: 100},
+				Backends:    []config.BackendConfig{{URL: "http://localhost:8081", Weight: 1}},
+				Logging:     config.LoggingConfig{Level: config.LogLevelInfo},
+			}
+		})
+
+		It("should accept a minimal configuration", func() {
+			Expect(cfg.Validate()).To(Succeed())
+		})
+
+		Context("request hash strategies", func() {
+			It("should require hash_param for query-hash", func() {
+				cfg.Strategy.Type = "query-hash"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.HashParam = "user_id"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should require hash_param for cookie-hash", func() {
+				cfg.Strategy.Type = "cookie-hash"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.HashParam = "session=1"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.HashParam = "session"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should require a header name for header-hash", func() {
+				cfg.Strategy.Type = "header-hash"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.HashParam = "X Tenant"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.HashParam = "X-Tenant-ID"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("metrics access", func() {
+			It("should reject malformed CIDRs", func() {
+				cfg.Metrics.AllowedCIDRs = []string{"10.0.0.0/8", "not-a-cidr"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should only validate remote write when enabled", func() {
+				cfg.Metrics.RemoteWrite = config.RemoteWriteConfig{URL: "not a url"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Metrics.RemoteWrite = config.RemoteWriteConfig{
+					Enabled:    true,
+					URL:        "ftp://prometheus:9090/api/v1/write",
+					Interval:   "15s",
+					Timeout:    "10s",
+					BatchSize:  500,
+					MinBackoff: "100ms",
+					MaxBackoff: "5s",
+				}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Metrics.RemoteWrite.URL = "http://prometheus:9090/api/v1/write"
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Metrics.RemoteWrite.BatchSize = 0
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should parse the allow-list", func() {
+				cfg.Metrics.AllowedCIDRs = []string{"10.1.2.3/8", "2001:db8::/32"}
+				Expect(cfg.Validate()).To(Succeed())
+				Expect(cfg.Metrics.AllowedNetworks()).To(HaveLen(2))
+				Expect(cfg.Metrics.AllowedNetworks()[0].String()).To(Equal("10.0.0.0/8"))
+			})
+
+			It("should accept an empty or valid cache ttl", func() {
+				cfg.Metrics.CacheTTL = "1s"
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Metrics.CacheTTL = "briefly"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("keep-alive", func() {
+			It("should reject negative limits", func() {
+				cfg.Server.KeepAlive.MaxRequests = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should reject an invalid idle timeout or drain period", func() {
+				cfg.Server.KeepAlive.IdleTimeout = "forever"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.KeepAlive.IdleTimeout = "90s"
+				cfg.Server.DrainPeriod = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.DrainPeriod = "5s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should reject an invalid rebalance window", func() {
+				cfg.Server.KeepAlive.RebalanceWindow = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.KeepAlive.RebalanceWindow = "2s"
+				cfg.Server.KeepAlive.RebalanceInterval = "1m"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should require the rebalance interval to be longer than the window", func() {
+				cfg.Server.KeepAlive.RebalanceWindow = "2s"
+				cfg.Server.KeepAlive.RebalanceInterval = "2s"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.KeepAlive.RebalanceInterval = "later"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.KeepAlive.RebalanceInterval = "30s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("timeouts", func() {
+			It("should validate listener and route timeouts", func() {
+				cfg.Server.ReadTimeout = "15s"
+				cfg.Server.WriteTimeout = "10m"
+				cfg.Server.RouteTimeouts = []config.RouteTimeoutConfig{{PathPrefix: "/poll", WriteTimeout: "10m"}}
+				cfg.Listeners.Admin = config.ListenerConfig{Address: ":9090", IdleTimeout: "5s"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Server.RouteTimeouts[0].PathPrefix = "poll"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.RouteTimeouts[0].PathPrefix = "/poll"
+				cfg.Server.RouteTimeouts[0].ReadTimeout = "long"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.RouteTimeouts = nil
+				cfg.Listeners.Admin.WriteTimeout = "never"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("backend health checks", func() {
+			It("should require a command for command checks", func() {
+				cfg.Backends[0].HealthCheck = &config.BackendHealthCheckConfig{Type: config.HealthCheckCommand}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].HealthCheck.Command = []string{"/usr/local/bin/check-replica"}
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should reject unknown types, stray commands and bad timeouts", func() {
+				cfg.Backends[0].HealthCheck = &config.BackendHealthCheckConfig{Type: "tcp"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].HealthCheck = &config.BackendHealthCheckConfig{Type: config.HealthCheckHTTP, Command: []string{"true"}}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].HealthCheck = &config.BackendHealthCheckConfig{Timeout: "soon"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should default the timeout to five seconds", func() {
+				Expect(cfg.Backends[0].HealthCheckTimeout()).To(Equal(5 * time.Second))
+
+				cfg.Backends[0].HealthCheck = &config.BackendHealthCheckConfig{Timeout: "2s"}
+				Expect(cfg.Backends[0].HealthCheckTimeout()).To(Equal(2 * time.Second))
+			})
+		})
+
+		Context("overrides", func() {
+			It("should require a valid interval when a file is set", func() {
+				cfg.Overrides = config.OverridesConfig{File: "/etc/lb/overrides.yaml"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Overrides.Interval = "5s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("preflight", func() {
+			It("should require a valid timeout only when enabled", func() {
+				cfg.Preflight = config.PreflightConfig{Enabled: true, Timeout: "soon"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Preflight.Enabled = false
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("peers", func() {
+			It("should require peer URLs and an interval when peers are set", func() {
+				cfg.Peers = config.PeersConfig{Addresses: []string{"10.0.0.2:8080"}, Interval: "5s"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Peers.Addresses = []string{"http://10.0.0.2:8080"}
+				cfg.Peers.Interval = ""
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Peers.Interval = "5s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("endpoint metrics", func() {
+			It("should validate path templates only when enabled", func() {
+				cfg.Metrics.Endpoints = config.EndpointMetricsConfig{Enabled: true, Paths: []string{"/users/{id}", "/static/{path...}"}}
+				Expect(cfg.Validate()).To(Succeed())
+				Expect(cfg.Metrics.Endpoints.Templates).NotTo(BeNil())
+
+				cfg.Metrics.Endpoints.Paths = []string{"users/{id}"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Metrics.Endpoints.Paths = []string{"/files/{path...}/raw"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Metrics.Endpoints.Paths = []string{"/users/id}"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Metrics.Endpoints.Enabled = false
+				Expect(cfg.Validate()).To(Succeed())
+				Expect(cfg.Metrics.Endpoints.Templates).To(BeNil())
+			})
+		})
+
+		Context("subsetting", func() {
+			It("should reject a negative subset size", func() {
+				cfg.Strategy.SubsetSize = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.SubsetSize = 10
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("priority tiers", func() {
+			It("should reject negative priorities and connection limits", func() {
+				cfg.Backends[0].Priority = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].Priority = 2
+				cfg.Backends[0].MaxConnections = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].MaxConnections = 100
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Backends[0].MaxInFlight = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].MaxInFlight = 10
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should validate DNS discovery", func() {
+				cfg.Backends[0].DNS = "aaaa"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].DNS = config.DNSRecordSRV
+				cfg.Discovery.DNSInterval = "often"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Discovery.DNSInterval = "30s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should validate etcd discovery and allow it to supply every backend", func() {
+				cfg.Discovery.Etcd = config.EtcdDiscoveryConfig{Enabled: true, URL: "etcd:2379", Prefix: "/lb/", RetryInterval: "5s"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Discovery.Etcd.URL = "http://etcd:2379"
+				cfg.Discovery.Etcd.RetryInterval = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Discovery.Etcd.RetryInterval = "5s"
+				cfg.Backends = nil
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Discovery.Etcd.Enabled = false
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should validate file discovery and allow it to supply every backend", func() {
+				cfg.Discovery.File = config.FileDiscoveryConfig{Enabled: true, PollInterval: "30s"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Discovery.File.Path = "backends.yaml"
+				cfg.Discovery.File.PollInterval = "often"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Discovery.File.PollInterval = "30s"
+				cfg.Backends = nil
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("standby", func() {
+			It("should reject a negative minimum of active backends", func() {
+				cfg.Standby.MinActive = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Standby.MinActive = 2
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("failover", func() {
+			It("should validate thresholds and hysteresis", func() {
+				cfg.Failover = config.FailoverConfig{MinHealthy: 1.5}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Backends = append(cfg.Backends, config.BackendConfig{URL: "https://lb.eu-central.example.com", Weight: 1, Remote: true})
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Failover = config.FailoverConfig{MinHealthy: 1.5, MaxLatency: "0", FailAfter: 3, RecoverAfter: 10}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Failover.MinHealthy = 0.5
+				cfg.Failover.MaxLatency = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Failover.MaxLatency = "300ms"
+				cfg.Failover.RecoverAfter = 0
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Failover.RecoverAfter = 10
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Failover.ProbeShare = 0.05
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Failover.MaxLatency = "0"
+				cfg.Failover.ProbeShare = 0
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should reject a backend that is both remote and standby", func() {
+				cfg.Failover = config.FailoverConfig{MinHealthy: 0.5, MaxLatency: "0", FailAfter: 3, RecoverAfter: 10}
+				cfg.Backends[0].Remote = true
+				cfg.Backends[0].Standby = true
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Backends[0].Standby = false
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("schedule", func() {
+			It("should validate cron, duration, time zone and action of each rule", func() {
+				cfg.Schedule = config.ScheduleConfig{
+					Interval: "15s",
+					Rules: []config.ScheduleRuleConfig{{
+						Name:     "nightly",
+						Cron:     "0 2 * * *",
+						Duration: "1h",
+						Timezone: "UTC",
+						Action:   "maintenance",
+						Backends: []string{"http://localhost:8081"},
+					}},
+				}
+				Expect(cfg.Validate()).To(Succeed())
+
+				rule := &cfg.Schedule.Rules[0]
+				rule.Cron = "0 25 * * *"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				rule.Cron = "0 2 * * *"
+				rule.Timezone = "Mars/Olympus"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				rule.Timezone = ""
+				rule.Action = "reboot"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				rule.Action = "pool"
+				rule.Backends = nil
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				rule.Backends = []string{"http://localhost:8081"}
+				cfg.Schedule.Interval = ""
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("deadline", func() {
+			It("should require a header name and accept an empty timeout", func() {
+				cfg.Deadline = config.DeadlineConfig{Enabled: true, Timeout: "10s", Header: "X-Deadline-Ms"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Deadline.Timeout = ""
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Deadline.Timeout = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Deadline.Timeout = "10s"
+				cfg.Deadline.Header = ""
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("overload", func() {
+			It("should validate thresholds and priorities only when enabled", func() {
+				cfg.Overload = config.OverloadConfig{
+					Enabled:         true,
+					Interval:        "1s",
+					CPUThreshold:    0.85,
+					PriorityHeader:  "X-Priority",
+					DefaultPriority: "normal",
+				}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Overload.CPUThreshold = 1.5
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Overload.CPUThreshold = 0.85
+				cfg.Overload.DefaultPriority = "urgent"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Overload.DefaultPriority = "low"
+				cfg.Overload.MemoryLimitMB = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Overload.Enabled = false
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("admission", func() {
+			It("should validate the limits only when enabled", func() {
+				cfg.Admission = config.AdmissionConfig{
+					Enabled:     true,
+					MaxInFlight: 100,
+					MaxQueued:   1000,
+					Timeout:     "1s",
+				}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Admission.MaxInFlight = 0
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Admission.MaxInFlight = 100
+				cfg.Admission.Timeout = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Admission.Enabled = false
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("dial", func() {
+			It("should validate the fallback delay only with happy eyeballs", func() {
+				cfg.Dial = config.DialConfig{FallbackDelay: "soon"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Dial = config.DialConfig{HappyEyeballs: true, FallbackDelay: "300ms"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Dial.FallbackDelay = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("drain", func() {
+			It("should validate the drain timeout", func() {
+				cfg.Drain.Timeout = "30s"
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Drain.Timeout = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("registration", func() {
+			It("should only validate registration when enabled", func() {
+				cfg.Registration = config.RegistrationConfig{Type: "zookeeper"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Registration = config.RegistrationConfig{
+					Enabled:  true,
+					Type:     config.RegistryConsul,
+					URL:      "http://127.0.0.1:8500",
+					Service:  "load-balancer",
+					Interval: "10s",
+					TTL:      "1m",
+				}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Registration.Type = "zookeeper"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Registration.Type = config.RegistryEtcd
+				cfg.Registration.Address = "10.0.0.2"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Registration.Address = "10.0.0.2:8080"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should require the ttl to outlast the refresh interval", func() {
+				cfg.Registration = config.RegistrationConfig{
+					Enabled:  true,
+					Type:     config.RegistryEtcd,
+					URL:      "http://127.0.0.1:2379",
+					Service:  "load-balancer",
+					Interval: "10s",
+					TTL:      "10s",
+				}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Registration.TTL = "30s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should require a ttl of at least a minute for consul", func() {
+				cfg.Registration = config.RegistrationConfig{
+					Enabled:  true,
+					Type:     config.RegistryConsul,
+					URL:      "http://127.0.0.1:8500",
+					Service:  "load-balancer",
+					Interval: "10s",
+					TTL:      "30s",
+				}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Registration.TTL = "1m"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("weight decay", func() {
+			It("should validate factor and recovery only when enabled", func() {
+				cfg.CircuitBreaker.WeightDecay = config.WeightDecayConfig{Factor: 2, Recovery: "soon"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.CircuitBreaker.WeightDecay = config.WeightDecayConfig{Enabled: true, Factor: 0.5, Recovery: "30s"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				for _, factor := range []float64{0, 1, 1.5, -0.5} {
+					cfg.CircuitBreaker.WeightDecay.Factor = factor
+					Expect(cfg.Validate()).NotTo(Succeed(), "factor %v", factor)
+				}
+
+				cfg.CircuitBreaker.WeightDecay.Factor = 0.5
+				cfg.CircuitBreaker.WeightDecay.Recovery = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("slow start", func() {
+			It("should accept an empty or valid duration", func() {
+				cfg.HealthCheck.SlowStart = ""
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.HealthCheck.SlowStart = "30s"
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.HealthCheck.SlowStart = "gently"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("weight ramp", func() {
+			It("should accept an empty or valid duration", func() {
+				cfg.Strategy.Type = "weighted-round-robin"
+				cfg.Strategy.WeightRamp = ""
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Strategy.WeightRamp = "30s"
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Strategy.WeightRamp = "slowly"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should reject a ramp for strategies that apply weights at once", func() {
+				for _, t := range []string{"weighted-random", "weighted-alias", "round-robin"} {
+					cfg.Strategy.Type = t
+					cfg.Strategy.WeightRamp = "30s"
+					Expect(cfg.Validate()).NotTo(Succeed(), t)
+
+					cfg.Strategy.WeightRamp = "0s"
+					Expect(cfg.Validate()).To(Succeed(), t)
+				}
+
+				cfg.Strategy.Type = "chain"
+				cfg.Strategy.Chain = []string{"least-conn", "weighted-round-robin"}
+				cfg.Strategy.WeightRamp = "30s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("peak-ewma", func() {
+			It("should require a valid decay and error penalty", func() {
+				cfg.Strategy.Type = "peak-ewma"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.Decay = "10s"
+				cfg.Strategy.ErrorPenalty = "soon"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.ErrorPenalty = "1s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("ip-hash prefixes", func() {
+			It("should default when unset and keep an explicit zero", func() {
+				Expect(config.Defaults().Strategy.IPv4Prefix).To(Equal(24))
+				Expect(config.Defaults().Strategy.IPv6Prefix).To(Equal(56))
+
+				cfg.Strategy.IPv4Prefix = 0
+				cfg.Strategy.IPv6Prefix = 0
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Strategy.IPv4Prefix = 33
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("hash key", func() {
+			It("should accept the client IP, the path, a cookie or a header", func() {
+				for _, key := range []string{"ip", "path", "cookie:session_id", "header:X-Tenant-ID"} {
+					cfg.Strategy.HashKey = key
+					Expect(cfg.Validate()).To(Succeed(), key)
+				}
+			})
+
+			It("should reject unknown sources and missing names", func() {
+				for _, key := range []string{"query:user", "cookie:", "header:X Tenant", "ip:x"} {
+					cfg.Strategy.HashKey = key
+					Expect(cfg.Validate()).NotTo(Succeed(), key)
+				}
+			})
+		})
+
+		Context("p95", func() {
+			It("should require a valid threshold", func() {
+				cfg.Strategy.Type = "p95"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.P95Threshold = "slow"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.P95Threshold = "250ms"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("warm", func() {
+			It("should accept path prefixes only, or none", func() {
+				cfg.Strategy.Type = "warm"
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Strategy.WarmPaths = []string{"/api/", "checkout"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.WarmPaths = []string{"/api/", "/checkout"}
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("chain", func() {
+			It("should require at least two known strategies", func() {
+				cfg.Strategy.Type = "chain"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.Chain = []string{"least-conn"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.Chain = []string{"consistent_hash", "chain"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.Chain = []string{"consistent_hash", "least-conn"}
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should require the settings of its strategies", func() {
+				cfg.Strategy.Type = "chain"
+				cfg.Strategy.Chain = []string{"cookie-hash", "least-conn"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.HashParam = "session"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should reject invalid limits", func() {
+				cfg.Strategy.ChainMaxLoad = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.ChainMaxLoad = 0
+				cfg.Strategy.ChainMaxLatency = "fast"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.ChainMaxLatency = "500ms"
+				cfg.Strategy.ChainMaxReportedLoad = 1.5
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Strategy.ChainMaxReportedLoad = 0.9
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("failover header", func() {
+			It("should accept an empty value or a header name", func() {
+				cfg.Strategy.FailoverHeader = "X-Session-Failover"
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Strategy.FailoverHeader = "Session Failover"
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("client ip", func() {
+			It("should require a header name and valid trusted proxy networks", func() {
+				cfg.ClientIP = config.ClientIPConfig{Header: "X-Real-IP", TrustedProxies: []string{"10.0.0.0/8"}}
+				Expect(cfg.Validate()).To(Succeed())
+				Expect(cfg.ClientIP.TrustedNetworks()).To(HaveLen(1))
+
+				cfg.ClientIP.Header = "X Real IP"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.ClientIP.Header = ""
+				cfg.ClientIP.TrustedProxies = []string{"10.0.0.1"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("header limits", func() {
+			It("should reject negative limits", func() {
+				cfg.Server.Headers.MaxCount = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Server.Headers = config.HeaderLimitsConfig{MaxBytes: 8192, MaxCount: 50, MaxLineLength: 4096}
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("body inspection", func() {
+			It("should require limits and a known forward mode when enabled", func() {
+				cfg.BodyInspection = config.BodyInspectionConfig{Enabled: true, MaxBytes: 1024, MaxDecodedBytes: 0, Forward: "original"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.BodyInspection.MaxDecodedBytes = 4096
+				cfg.BodyInspection.Forward = "deflate"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.BodyInspection.Forward = "recompress"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("traffic classes", func() {
+			It("should validate paths, patterns and skipped classes when enabled", func() {
+				cfg.Traffic = config.TrafficConfig{Enabled: true, ProbePaths: []string{"/healthz"}, SkipEndpointMetrics: []string{"probe"}}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Traffic.ProbePaths = []string{"healthz"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Traffic.ProbePaths = nil
+				cfg.Traffic.BotAgents = []string{"("}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Traffic.BotAgents = nil
+				cfg.Traffic.SkipEndpointMetrics = []string{"crawler"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("waf", func() {
+			It("should validate rules when enabled", func() {
+				cfg.WAF = config.WAFConfig{Enabled: true, TagHeader: "X-WAF-Tags", Rules: []config.WAFRuleConfig{
+					{Name: "dotfiles", Path: `^/\.`, Action: "block"},
+					{Name: "login", Path: "^/login$", Action: "rate_limit", Requests: 10, Window: "1m"},
+				}}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.WAF.Rules[0].Path = "("
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.WAF.Rules[0].Path = `^/\.`
+				cfg.WAF.Rules[1].Window = ""
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.WAF.Rules[1].Window = "1m"
+				cfg.WAF.UninspectedBodies = "allow"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.WAF.UninspectedBodies = "skip"
+				cfg.WAF.Rules[1].Name = "dotfiles"
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("both named dotfiles")))
+			})
+		})
+
+		Context("fingerprints", func() {
+			It("should validate the bound and header when enabled", func() {
+				cfg.Fingerprints = config.FingerprintsConfig{TLSHeader: "X JA3"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Fingerprints = config.FingerprintsConfig{Enabled: true, MaxEntries: 1000, TLSHeader: "X-JA3-Fingerprint"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Fingerprints.TLSHeader = "X JA3"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Fingerprints.TLSHeader = ""
+				cfg.Fingerprints.MaxEntries = 0
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("routing", func() {
+			It("should validate rules when enabled", func() {
+				cfg.Routing = config.RoutingConfig{Rules: []config.RoutingRuleConfig{{Name: "tenants"}}}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Routing.Enabled = true
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("must name backends or labels")))
+
+				cfg.Routing.Rules = []config.RoutingRuleConfig{
+					{Name: "acme", Backends: []string{"acme-1"}, Conditions: []config.RoutingConditionConfig{
+						{Source: "body", Name: "tenant.id", Pattern: "^acme$"},
+					}},
+					{Name: "canary", PathPrefix: "/v2/", Labels: map[string]string{"track": "canary"}, Fallback: true},
+				}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Routing.Rules[0].Conditions[0].Source = "cookie"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Routing.Rules[0].Conditions[0].Source = "body"
+				cfg.Routing.Rules[0].Conditions[0].Pattern = "("
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Routing.Rules[0].Conditions[0].Pattern = "^acme$"
+				cfg.Routing.Rules[1].PathPrefix = "v2"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Routing.Rules[1].PathPrefix = "/v2/"
+				cfg.Routing.Rules[1].Name = "acme"
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("both named acme")))
+			})
+		})
+
+		Context("scripting", func() {
+			It("should compile hook expressions only when enabled", func() {
+				cfg.Scripting = config.ScriptingConfig{GroupLabel: "group", Hooks: []config.ScriptHookConfig{{Name: "beta", When: "path"}}}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Scripting.Enabled = true
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("expression is string, want bool")))
+
+				cfg.Scripting.Hooks = []config.ScriptHookConfig{
+					{Name: "beta", When: `has_header("X-Beta")`, Group: `"canary"`},
+					{Name: "tenant", When: "true", Headers: map[string]string{"X-Tenant-Id": `lower(header("X-Tenant"))`}},
+					{Name: "banned", When: `client_ip == "10.0.0.9"`, Reject: 403},
+				}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Scripting.Hooks[0].Group = "1 +"
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("unexpected end of expression")))
+
+				cfg.Scripting.Hooks[0].Group = ""
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("must pick a group, set headers or reject")))
+
+				cfg.Scripting.Hooks[0].Group = `"canary"`
+				cfg.Scripting.Hooks[1].Headers = map[string]string{"X Bad": `"x"`}
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("is not a header name")))
+
+				cfg.Scripting.Hooks[1].Headers = map[string]string{"X-Tenant-Id": "len(path)"}
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("expression is int, want string")))
+
+				cfg.Scripting.Hooks[1].Headers = nil
+				cfg.Scripting.Hooks[1].Reject = 302
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Scripting.Hooks[1].Reject = 429
+				cfg.Scripting.Hooks[2].Name = "beta"
+				Expect(cfg.Validate()).To(MatchError(ContainSubstring("both named beta")))
+			})
+		})
+
+		Context("postmortem", func() {
+			It("should require a directory and an event count only when enabled", func() {
+				cfg.Postmortem = config.PostmortemConfig{Events: -1}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Postmortem.Enabled = true
+				cfg.Postmortem.Dir = "/var/lib/lb"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Postmortem.Events = 1000
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Postmortem.Dir = ""
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("fd monitor", func() {
+			It("should require an interval and a warning ratio up to 1 when enabled", func() {
+				cfg.FDMonitor = config.FDMonitorConfig{Enabled: true, Interval: "10s", WarnRatio: 1.5}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.FDMonitor.WarnRatio = 0.8
+				cfg.FDMonitor.Interval = "often"
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.FDMonitor.Interval = "10s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("certificates", func() {
+			It("should require an interval and a timeout only when enabled", func() {
+				cfg.Certificates = config.CertificatesConfig{Interval: "often"}
+				Expect(cfg.Validate()).To(Succeed())
+
+				cfg.Certificates = config.CertificatesConfig{Enabled: true, Interval: "often", Timeout: "5s", WarnDays: 14}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Certificates.Interval = "1h"
+				cfg.Certificates.WarnDays = -1
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Certificates.WarnDays = 14
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("capture", func() {
+			It("should require a valid maximum duration only when enabled", func() {
+				cfg.Capture = config.CaptureConfig{Enabled: true, MaxDuration: "forever"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Capture.Enabled = false
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("tunnel", func() {
+			It("should require a valid dial timeout when enabled", func() {
+				cfg.Tunnel = config.TunnelConfig{Enabled: true, DialTimeout: "soon"}
+				Expect(cfg.Validate()).NotTo(Succeed())
+
+				cfg.Tunnel.DialTimeout = "3s"
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should reject a negative tunnel limit", func() {
+				cfg.Tunnel = config.TunnelConfig{Enabled: true, DialTimeout: "3s", MaxOpen: -1}
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+		})
+
+		Context("admin API", func() {
+			It("should not require tokens when disabled", func() {
+				cfg.Admin.Enabled = false
+				Expect(cfg.Validate()).To(Succeed())
+			})
+
+			It("should require tokens when enabled", func() {
+				cfg.Admin.Enabled = true
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should reject unknown roles", func() {
+				cfg.Admin.Enabled = true
+				cfg.Admin.Tokens = []config.AdminTokenConfig{{Token: "t", Role: "root"}}
+				Expect(cfg.Validate()).NotTo(Succeed())
+			})
+
+			It("should accept observer and operator tokens", func() {
+				cfg.Admin.Enabled = true
+				cfg.Admin.Tokens = []config.AdminTokenConfig{
+					{Token: "a", Role: config.AdminRoleObserver},
+					{Token: "b", Role: config.AdminRoleOperator},
+				}
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+	})
 })
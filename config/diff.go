@@ -0,0 +1,113 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change describes a single differing leaf value between two configurations.
+// Path uses the YAML key names, e.g. "strategy.type" or "backends[1].weight".
+type Change struct {
+	Path string `json:"path"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+// Redacted returns a copy of the configuration that is safe to expose over
+// the admin API. Secrets are replaced by a short fingerprint so operators can
+// still tell whether two configurations carry the same secret.
+func (c *Config) Redacted() *Config {
+	out := *c
+
+	out.Admin.Tokens = make([]AdminTokenConfig, len(c.Admin.Tokens))
+	for i, t := range c.Admin.Tokens {
+		out.Admin.Tokens[i] = AdminTokenConfig{Token: fingerprint(t.Token), Role: t.Role}
+	}
+
+	out.Metrics.BearerToken = fingerprint(c.Metrics.BearerToken)
+	out.Metrics.RemoteWrite.BearerToken = fingerprint(c.Metrics.RemoteWrite.BearerToken)
+	out.Registration.Token = fingerprint(c.Registration.Token)
+	out.Discovery.Etcd.Token = fingerprint(c.Discovery.Etcd.Token)
+	out.Backends = append([]BackendConfig(nil), c.Backends...)
+	return &out
+}
+
+// Diff compares two configurations and returns their differences sorted by
+// path. Secrets are compared by fingerprint and never appear in the output.
+func Diff(from, to *Config) ([]Change, error) {
+	a, err := flatten(from.Redacted())
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := flatten(to.Redacted())
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for path, av := range a {
+		bv, ok := b[path]
+		if !ok || !reflect.DeepEqual(av, bv) {
+			changes = append(changes, Change{Path: path, From: av, To: bv})
+		}
+	}
+	for path, bv := range b {
+		if _, ok := a[path]; !ok {
+			changes = append(changes, Change{Path: path, From: nil, To: bv})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func flatten(cfg *Config) (map[string]any, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]any)
+	flattenInto(out, "", tree)
+	return out, nil
+}
+
+func flattenInto(out map[string]any, prefix string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenInto(out, key, child)
+		}
+	case []any:
+		for i, child := range v {
+			flattenInto(out, fmt.Sprintf("%s[%d]", prefix, i), child)
+		}
+	case nil:
+		// Absent and null values are treated the same so that an omitted
+		// list does not show up as a change against an empty one.
+	default:
+		out[prefix] = v
+	}
+}
+
+func fingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
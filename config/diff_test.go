@@ -0,0 +1,108 @@
+package config_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/config"
+)
+
+var _ = Describe("Diff", func() {
+	var base *config.Config
+
+	BeforeEach(func() {
+		base = &config.Config{
+			Server:   config.ServerConfig{Address: ":8080", Environment: config.EnvDev},
+			Strategy: config.StrategyConfig{Type: "round-robin", VirtualNodes: 100},
+			Backends: []config.BackendConfig{{URL: "http://localhost:8081", Weight: 1}},
+			Admin: config.AdminConfig{
+				Enabled: true,
+				Tokens:  []config.AdminTokenConfig{{Token: "secret", Role: config.AdminRoleOperator}},
+			},
+		}
+	})
+
+	It("should report no changes for identical configurations", func() {
+		changes, err := config.Diff(base, base)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("should report changed leaf values by path", func() {
+		other := *base
+		other.Strategy.Type = "least-conn"
+		other.Backends = []config.BackendConfig{
+			{URL: "http://localhost:8081", Weight: 3},
+			{URL: "http://localhost:8082", Weight: 1},
+		}
+
+		changes, err := config.Diff(base, &other)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(ConsistOf(
+			config.Change{Path: "backends[0].weight", From: float64(1), To: float64(3)},
+			config.Change{Path: "backends[1].url", From: nil, To: "http://localhost:8082"},
+			config.Change{Path: "backends[1].weight", From: nil, To: float64(1)},
+			config.Change{Path: "strategy.type", From: "round-robin", To: "least-conn"},
+		))
+	})
+
+	It("should never expose secrets", func() {
+		other := *base
+		other.Admin.Tokens = []config.AdminTokenConfig{{Token: "rotated", Role: config.AdminRoleOperator}}
+
+		changes, err := config.Diff(base, &other)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].Path).To(Equal("admin.tokens[0].token"))
+		Expect(changes[0].From).NotTo(ContainSubstring("secret"))
+		Expect(changes[0].To).NotTo(ContainSubstring("rotated"))
+	})
+
+	It("should never expose the remote write token", func() {
+		base.Metrics.RemoteWrite.BearerToken = "remote-secret"
+
+		dump, err := json.Marshal(base.Redacted())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(dump)).NotTo(ContainSubstring("remote-secret"))
+		Expect(base.Metrics.RemoteWrite.BearerToken).To(Equal("remote-secret"))
+	})
+
+	It("should not mutate the original when redacting", func() {
+		redacted := base.Redacted()
+		Expect(redacted.Admin.Tokens[0].Token).NotTo(Equal("secret"))
+		Expect(base.Admin.Tokens[0].Token).To(Equal("secret"))
+	})
+})
+
+var _ = Describe("LoadFile", func() {
+	It("should load a configuration from an explicit path", func() {
+		dir, err := os.MkdirTemp("", "config-loadfile-*")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+
+		path := filepath.Join(dir, "lb.yaml")
+		Expect(os.WriteFile(path, []byte(`
+strategy:
+  type: "least-conn"
+backends:
+  - url: "http://localhost:9001"
+    weight: 2
+`), 0644)).To(Succeed())
+
+		cfg, err := config.LoadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Source).To(Equal(path))
+		Expect(cfg.Strategy.Type).To(Equal("least-conn"))
+		Expect(cfg.Strategy.VirtualNodes).To(Equal(100))
+		Expect(cfg.Backends).To(HaveLen(1))
+	})
+
+	It("should fail for a missing file", func() {
+		_, err := config.LoadFile("/does/not/exist.yaml")
+		Expect(err).To(HaveOccurred())
+	})
+})
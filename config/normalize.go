@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL returns the canonical form of a backend URL: lower-case scheme
+// and host, no default port and no trailing slash, so that entries pointing
+// at the same server compare equal.
+func NormalizeURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+func (c *Config) normalizeBackends() {
+	for i, b := range c.Backends {
+		if normalized, err := NormalizeURL(b.URL); err == nil {
+			c.Backends[i].URL = normalized
+		}
+	}
+}
+
+// validateUniqueBackends rejects backend entries that point at the same server
+// once normalized, since each would silently add its weight to the server, and
+// entries that share an identity.
+func validateUniqueBackends(value interface{}) error {
+	backends, ok := value.([]BackendConfig)
+	if !ok {
+		return nil
+	}
+
+	urls := make(map[string]int, len(backends))
+	ids := make(map[string]int, len(backends))
+	for i, b := range backends {
+		normalized, err := NormalizeURL(b.URL)
+		if err != nil {
+			continue
+		}
+
+		if first, dup := urls[normalized]; dup {
+			return validation.NewError("validation_duplicate_backend",
+				fmt.Sprintf("entries %d and %d both point at %s; remove one or combine their weights", first, i, normalized))
+		}
+		urls[normalized] = i
+
+		id := b.Name
+		if id == "" {
+			id = normalized
+		}
+		if first, dup := ids[id]; dup {
+			return validation.NewError("validation_duplicate_backend_name",
+				fmt.Sprintf("entries %d and %d are both named %s", first, i, id))
+		}
+		ids[id] = i
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package config_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/config"
+)
+
+var _ = Describe("NormalizeURL", func() {
+	DescribeTable("canonical forms",
+		func(raw, expected string) {
+			normalized, err := config.NormalizeURL(raw)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(normalized).To(Equal(expected))
+		},
+		Entry("trailing slash", "http://localhost:8081/", "http://localhost:8081"),
+		Entry("case", "HTTP://Backend.Example:8081", "http://backend.example:8081"),
+		Entry("default http port", "http://backend.example:80", "http://backend.example"),
+		Entry("default https port", "https://backend.example:443/", "https://backend.example"),
+		Entry("non-default port kept", "https://backend.example:80", "https://backend.example:80"),
+		Entry("path kept", "http://backend.example/api/", "http://backend.example/api"),
+		Entry("IPv6", "http://[::1]:80/", "http://[::1]"),
+		Entry("IPv6 with port", "http://[::1]:8081", "http://[::1]:8081"),
+	)
+})
+
+var _ = Describe("duplicate backends", func() {
+	It("should reject entries that normalize to the same server", func() {
+		_, err := config.Parse([]byte(`
+backends:
+  - url: "http://localhost:8081"
+    weight: 1
+  - url: "http://LOCALHOST:8081/"
+    weight: 2
+`), "yaml")
+		Expect(err).To(MatchError(ContainSubstring("entries 0 and 1 both point at http://localhost:8081")))
+	})
+
+	It("should reject entries with the same name", func() {
+		_, err := config.Parse([]byte(`
+backends:
+  - name: "checkout"
+    url: "http://localhost:8081"
+    weight: 1
+  - name: "checkout"
+    url: "http://localhost:8082"
+    weight: 1
+`), "yaml")
+		Expect(err).To(MatchError(ContainSubstring("entries 0 and 1 are both named checkout")))
+	})
+
+	It("should store normalized URLs", func() {
+		cfg, err := config.Parse([]byte(`
+backends:
+  - url: "HTTP://localhost:80/"
+    weight: 1
+  - url: "http://localhost:8082/"
+    weight: 1
+`), "yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Backends[0].URL).To(Equal("http://localhost"))
+		Expect(cfg.Backends[1].URL).To(Equal("http://localhost:8082"))
+	})
+})
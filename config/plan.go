@@ -0,0 +1,93 @@
+package config
+
+import "strings"
+
+// ReloadPlan summarises what applying a candidate configuration would change
+// in terms an operator cares about, alongside the raw list of differences.
+type ReloadPlan struct {
+	BackendsAdded   []string        `json:"backends_added"`
+	BackendsRemoved []string        `json:"backends_removed"`
+	WeightChanges   []WeightChange  `json:"weight_changes"`
+	AddressChanges  []AddressChange `json:"address_changes"`
+	StrategyChange  *StrategyChange `json:"strategy_change,omitempty"`
+	Changes         []Change        `json:"changes"`
+}
+
+type WeightChange struct {
+	URL  string `json:"url"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+// AddressChange is a named backend whose URL changes. It keeps its breaker
+// state, metrics and hash ring position.
+type AddressChange struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type StrategyChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func PlanReload(current, candidate *Config) (*ReloadPlan, error) {
+	changes, err := Diff(current, candidate)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ReloadPlan{
+		BackendsAdded:   []string{},
+		BackendsRemoved: []string{},
+		WeightChanges:   []WeightChange{},
+		AddressChanges:  []AddressChange{},
+		Changes:         changes,
+	}
+	if plan.Changes == nil {
+		plan.Changes = []Change{}
+	}
+
+	before := make(map[string]BackendConfig, len(current.Backends))
+	for _, b := range current.Backends {
+		before[b.ID()] = b
+	}
+
+	after := make(map[string]bool, len(candidate.Backends))
+	for _, b := range candidate.Backends {
+		after[b.ID()] = true
+
+		old, existed := before[b.ID()]
+		if !existed {
+			plan.BackendsAdded = append(plan.BackendsAdded, b.ID())
+			continue
+		}
+		if old.URL != b.URL {
+			plan.AddressChanges = append(plan.AddressChanges, AddressChange{Name: b.Name, From: old.URL, To: b.URL})
+		}
+		if old.Weight != b.Weight {
+			plan.WeightChanges = append(plan.WeightChanges, WeightChange{URL: b.URL, From: old.Weight, To: b.Weight})
+		}
+	}
+
+	for _, b := range current.Backends {
+		if !after[b.ID()] {
+			plan.BackendsRemoved = append(plan.BackendsRemoved, b.ID())
+		}
+	}
+
+	if from, to := strategyLabel(current.Strategy), strategyLabel(candidate.Strategy); from != to {
+		plan.StrategyChange = &StrategyChange{From: from, To: to}
+	}
+
+	return plan, nil
+}
+
+// strategyLabel names a strategy, listing the members of a chain.
+func strategyLabel(sc StrategyConfig) string {
+	if sc.Type != "chain" {
+		return sc.Type
+	}
+	return "chain(" + strings.Join(sc.Chain, ",") + ")"
+}
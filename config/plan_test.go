@@ -0,0 +1,129 @@
+package config_test
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/config"
+)
+
+var _ = Describe("PlanReload", func() {
+	var current *config.Config
+
+	BeforeEach(func() {
+		current = &config.Config{
+			Strategy: config.StrategyConfig{Type: "round-robin", VirtualNodes: 100},
+			Backends: []config.BackendConfig{
+				{URL: "http://localhost:8081", Weight: 1},
+				{URL: "http://localhost:8082", Weight: 1},
+			},
+		}
+	})
+
+	It("should report an empty plan for identical configurations", func() {
+		plan, err := config.PlanReload(current, current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.BackendsAdded).To(BeEmpty())
+		Expect(plan.BackendsRemoved).To(BeEmpty())
+		Expect(plan.WeightChanges).To(BeEmpty())
+		Expect(plan.StrategyChange).To(BeNil())
+		Expect(plan.Changes).To(BeEmpty())
+	})
+
+	It("should report added, removed and reweighted backends", func() {
+		candidate := &config.Config{
+			Strategy: current.Strategy,
+			Backends: []config.BackendConfig{
+				{URL: "http://localhost:8082", Weight: 4},
+				{URL: "http://localhost:8083", Weight: 1},
+			},
+		}
+
+		plan, err := config.PlanReload(current, candidate)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.BackendsAdded).To(ConsistOf("http://localhost:8083"))
+		Expect(plan.BackendsRemoved).To(ConsistOf("http://localhost:8081"))
+		Expect(plan.WeightChanges).To(ConsistOf(config.WeightChange{URL: "http://localhost:8082", From: 1, To: 4}))
+	})
+
+	It("should report an address change for a named backend", func() {
+		current.Backends[0].Name = "checkout"
+		candidate := &config.Config{
+			Strategy: current.Strategy,
+			Backends: []config.BackendConfig{
+				{Name: "checkout", URL: "https://localhost:9443", Weight: 1},
+				{URL: "http://localhost:8082", Weight: 1},
+			},
+		}
+
+		plan, err := config.PlanReload(current, candidate)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.BackendsAdded).To(BeEmpty())
+		Expect(plan.BackendsRemoved).To(BeEmpty())
+		Expect(plan.AddressChanges).To(ConsistOf(config.AddressChange{
+			Name: "checkout",
+			From: "http://localhost:8081",
+			To:   "https://localhost:9443",
+		}))
+	})
+
+	It("should report a strategy change", func() {
+		candidate := *current
+		candidate.Strategy.Type = "least-conn"
+
+		plan, err := config.PlanReload(current, &candidate)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.StrategyChange).To(Equal(&config.StrategyChange{From: "round-robin", To: "least-conn"}))
+	})
+
+	It("should report a change to the strategies of a chain", func() {
+		current.Strategy = config.StrategyConfig{Type: "chain", Chain: []string{"consistent_hash", "least-conn"}}
+		candidate := *current
+		candidate.Strategy.Chain = []string{"consistent_hash", "random"}
+
+		plan, err := config.PlanReload(current, &candidate)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.StrategyChange).To(Equal(&config.StrategyChange{
+			From: "chain(consistent_hash,least-conn)",
+			To:   "chain(consistent_hash,random)",
+		}))
+	})
+})
+
+var _ = Describe("Parse", func() {
+	It("should parse YAML documents", func() {
+		cfg, err := config.Parse([]byte(`
+backends:
+  - url: "http://localhost:8081"
+    weight: 1
+`), "yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Backends).To(HaveLen(1))
+		Expect(cfg.Source).To(BeEmpty())
+	})
+
+	It("should reject invalid configurations", func() {
+		_, err := config.Parse([]byte(`backends: []`), "yaml")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should take the document as written, without environment overrides", func() {
+		os.Setenv("SERVER_ADDRESS", ":9999")
+		os.Setenv("STRATEGY_TYPE", "random")
+		DeferCleanup(os.Unsetenv, "SERVER_ADDRESS")
+		DeferCleanup(os.Unsetenv, "STRATEGY_TYPE")
+
+		cfg, err := config.Parse([]byte(`
+server:
+  address: ":8080"
+backends:
+  - url: "http://localhost:8081"
+    weight: 1
+`), "yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Server.Address).To(Equal(":8080"))
+		Expect(cfg.Strategy.Type).To(Equal("round-robin"))
+	})
+})
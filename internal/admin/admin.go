@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleObserver
+	RoleOperator
+)
+
+type Token struct {
+	Value string
+	Role  Role
+}
+
+type API struct {
+	logger *slog.Logger
+	tokens []Token
+	mux    *http.ServeMux
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func New(logger *slog.Logger, tokens []Token) *API {
+	return &API{
+		logger: logger,
+		tokens: tokens,
+		mux:    http.NewServeMux(),
+	}
+}
+
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(s) {
+	case "observer":
+		return RoleObserver, nil
+	case "operator":
+		return RoleOperator, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown admin role %q", s)
+	}
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleObserver:
+		return "observer"
+	case RoleOperator:
+		return "operator"
+	default:
+		return "none"
+	}
+}
+
+// Allows reports whether a caller holding r may access an endpoint that
+// requires the given role. Roles are ordered: operators can do everything
+// observers can.
+func (r Role) Allows(required Role) bool {
+	return r != RoleNone && r >= required
+}
+
+// Handle registers h under pattern, restricted to callers holding at least role.
+func (a *API) Handle(pattern string, role Role, h http.HandlerFunc) {
+	a.mux.Handle(pattern, a.authorize(role, h))
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *API) authorize(required Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role := a.roleFor(bearerToken(r))
+
+		if role == RoleNone {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+
+		if !role.Allows(required) {
+			a.logger.Warn("Admin request forbidden",
+				slog.String("path", r.URL.Path),
+				slog.String("method", r.Method),
+				slog.String("role", role.String()),
+				slog.String("required", required.String()))
+			writeError(w, http.StatusForbidden, fmt.Sprintf("role %s cannot access this endpoint", role))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// roleFor compares the presented token against every configured token in
+// constant time so response timing does not leak how much of a token matched.
+func (a *API) roleFor(presented string) Role {
+	if presented == "" {
+		return RoleNone
+	}
+
+	role := RoleNone
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(t.Value)) == 1 {
+			role = t.Role
+		}
+	}
+
+	return role
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(auth[len(prefix):])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,361 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/admin"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/cron"
+	"github.com/angeloszaimis/load-balancer/internal/fdmon"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/schedule"
+	"github.com/angeloszaimis/load-balancer/internal/state"
+)
+
+var _ = Describe("Admin API", func() {
+	var (
+		api      *admin.API
+		registry *circuitbreaker.Registry
+		backends []*backend.Backend
+		pool     *backend.Pool
+		tracker  *goroutines.Tracker
+		monitor  *fdmon.Monitor
+	)
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	BeforeEach(func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		registry = circuitbreaker.NewRegistry(1, time.Minute)
+		tracker = goroutines.NewTracker()
+		monitor = fdmon.NewMonitor(fdmon.Options{Interval: time.Minute}, log)
+
+		u, _ := url.Parse("http://localhost:8081")
+		backends = []*backend.Backend{backend.New(u, 3)}
+		backends[0].SetHealthy(true)
+		pool = backend.NewPool(backends)
+
+		api = admin.New(log, []admin.Token{
+			{Value: "observer-token", Role: admin.RoleObserver},
+			{Value: "operator-token", Role: admin.RoleOperator},
+		})
+		api.Handle("GET /admin/backends", admin.RoleObserver, admin.BackendsHandler(pool, registry))
+		api.Handle("PUT /admin/backends/weight", admin.RoleOperator, admin.SetWeightHandler(pool))
+		api.Handle("PUT /admin/backends/drain", admin.RoleOperator, admin.SetDrainHandler(pool))
+		api.Handle("GET /admin/breakers", admin.RoleObserver, admin.BreakersHandler(registry))
+		api.Handle("POST /admin/breakers/reset", admin.RoleOperator, admin.ResetBreakersHandler(registry))
+		api.Handle("GET /admin/runtime", admin.RoleObserver, admin.RuntimeHandler(tracker))
+		api.Handle("GET /admin/fds", admin.RoleObserver, admin.FDsHandler(monitor))
+	})
+
+	Describe("ParseRole", func() {
+		It("should parse known roles case-insensitively", func() {
+			role, err := admin.ParseRole("Operator")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(role).To(Equal(admin.RoleOperator))
+		})
+
+		It("should reject unknown roles", func() {
+			_, err := admin.ParseRole("root")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("runtime", func() {
+		It("should report goroutines per subsystem", func() {
+			stop := make(chan struct{})
+			defer close(stop)
+			tracker.Go("healthcheck", func() { <-stop })
+			tracker.SetLimit("tunnel", 10)
+
+			w := do(http.MethodGet, "/admin/runtime", "observer-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var report goroutines.Report
+			Expect(json.Unmarshal(w.Body.Bytes(), &report)).To(Succeed())
+			Expect(report.Total).To(BeNumerically(">", 0))
+			Expect(report.Subsystems).To(HaveKeyWithValue("healthcheck", goroutines.Usage{Running: 1, Peak: 1}))
+			Expect(report.Subsystems).To(HaveKeyWithValue("tunnel", goroutines.Usage{Limit: 10}))
+		})
+	})
+
+	Describe("weights", func() {
+		put := func(body, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/admin/backends/weight", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			return w
+		}
+
+		It("should set and restore a backend's weight", func() {
+			w := put(`{"backend":"http://localhost:8081","weight":7}`, "operator-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(backends[0].BaseWeight()).To(Equal(7))
+
+			var updated []admin.WeightStatus
+			Expect(json.Unmarshal(w.Body.Bytes(), &updated)).To(Succeed())
+			Expect(updated).To(Equal([]admin.WeightStatus{{
+				Name: "http://localhost:8081", URL: "http://localhost:8081", Weight: 7, ConfiguredWeight: 3, WeightBy: []string{"admin"},
+			}}))
+
+			w = put(`{"backend":"http://localhost:8081","weight":null}`, "operator-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(backends[0].BaseWeight()).To(Equal(3))
+		})
+
+		It("should keep an operator's weight over other owners until it is released", func() {
+			Expect(put(`{"backend":"http://localhost:8081","weight":7}`, "operator-token").Code).To(Equal(http.StatusOK))
+
+			backends[0].HoldWeight(backend.OwnerSchedule, 2)
+			backends[0].ReleaseWeight(backend.OwnerSchedule)
+			Expect(backends[0].BaseWeight()).To(Equal(7))
+
+			backends[0].HoldWeight(backend.OwnerOverride, 5)
+			Expect(backends[0].BaseWeight()).To(Equal(7))
+
+			Expect(put(`{"backend":"http://localhost:8081","weight":null}`, "operator-token").Code).To(Equal(http.StatusOK))
+			Expect(backends[0].BaseWeight()).To(Equal(5))
+		})
+
+		It("should reject unknown backends, negative weights and observers", func() {
+			Expect(put(`{"backend":"http://localhost:9999","weight":2}`, "operator-token").Code).To(Equal(http.StatusNotFound))
+			Expect(put(`{"backend":"http://localhost:8081","weight":-1}`, "operator-token").Code).To(Equal(http.StatusBadRequest))
+			Expect(put(`{"backend":"http://localhost:8081","weight":2}`, "observer-token").Code).To(Equal(http.StatusForbidden))
+			Expect(backends[0].BaseWeight()).To(Equal(3))
+		})
+	})
+
+	Describe("drain", func() {
+		put := func(body, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/admin/backends/drain", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			return w
+		}
+
+		It("should start and end draining a backend", func() {
+			w := put(`{"backend":"http://localhost:8081","draining":true}`, "operator-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(backends[0].IsDraining()).To(BeTrue())
+
+			var updated []admin.DrainStatus
+			Expect(json.Unmarshal(w.Body.Bytes(), &updated)).To(Succeed())
+			Expect(updated).To(Equal([]admin.DrainStatus{{
+				Name: "http://localhost:8081", URL: "http://localhost:8081", Draining: true, DrainedBy: []string{"admin"}, State: "draining",
+			}}))
+
+			Expect(put(`{"backend":"http://localhost:8081","draining":false}`, "operator-token").Code).To(Equal(http.StatusOK))
+			Expect(backends[0].IsDraining()).To(BeFalse())
+		})
+
+		It("should report the deadline of a drain given a timeout", func() {
+			w := put(`{"backend":"http://localhost:8081","draining":true,"timeout":"1m"}`, "operator-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var updated []admin.DrainStatus
+			Expect(json.Unmarshal(w.Body.Bytes(), &updated)).To(Succeed())
+			Expect(updated).To(HaveLen(1))
+			Expect(updated[0].InFlight).To(BeZero())
+			Expect(updated[0].Deadline).NotTo(BeNil())
+			Expect(*updated[0].Deadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+
+			Expect(put(`{"backend":"http://localhost:8081","draining":false}`, "operator-token").Code).To(Equal(http.StatusOK))
+			_, ok := backends[0].DrainDeadline()
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should reject an invalid timeout", func() {
+			Expect(put(`{"backend":"http://localhost:8081","draining":true,"timeout":"soon"}`, "operator-token").Code).To(Equal(http.StatusBadRequest))
+			Expect(put(`{"backend":"http://localhost:8081","draining":true,"timeout":"-1s"}`, "operator-token").Code).To(Equal(http.StatusBadRequest))
+			Expect(backends[0].IsDraining()).To(BeFalse())
+		})
+
+		It("should see backends that joined or left the pool since startup", func() {
+			u, _ := url.Parse("http://localhost:9999")
+			joined := backend.New(u, 1)
+			pool.Add(joined)
+			Expect(put(`{"backend":"http://localhost:9999","draining":true}`, "operator-token").Code).To(Equal(http.StatusOK))
+			Expect(joined.IsDraining()).To(BeTrue())
+
+			pool.Remove(backends[0])
+			Expect(put(`{"backend":"http://localhost:8081","draining":true}`, "operator-token").Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should reject unknown backends and observers", func() {
+			Expect(put(`{"backend":"http://localhost:9999","draining":true}`, "operator-token").Code).To(Equal(http.StatusNotFound))
+			Expect(put(`{"backend":"http://localhost:8081","draining":true}`, "observer-token").Code).To(Equal(http.StatusForbidden))
+			Expect(backends[0].IsDraining()).To(BeFalse())
+		})
+	})
+
+	Describe("state", func() {
+		BeforeEach(func() {
+			m := state.NewManager(pool, registry, nil)
+			api.Handle("GET /admin/state", admin.RoleObserver, admin.ExportStateHandler(m))
+			api.Handle("PUT /admin/state", admin.RoleOperator, admin.ImportStateHandler(m))
+		})
+
+		put := func(body, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/admin/state", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			return w
+		}
+
+		It("should import what it exports", func() {
+			backends[0].SetWeight(6)
+			registry.GetBreaker(backends[0].Name()).RecordFailure()
+
+			w := do(http.MethodGet, "/admin/state", "observer-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			exported := w.Body.String()
+
+			backends[0].SetWeight(3)
+			registry.Reset()
+
+			w = put(exported, "operator-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var result state.Result
+			Expect(json.Unmarshal(w.Body.Bytes(), &result)).To(Succeed())
+			Expect(result).To(Equal(state.Result{Backends: 1, Breakers: 1}))
+			Expect(backends[0].BaseWeight()).To(Equal(6))
+			Expect(registry.Stats()).To(HaveKeyWithValue(backends[0].Name(), circuitbreaker.StateOpen))
+		})
+
+		It("should reject invalid snapshots and observers", func() {
+			Expect(put(`{"version":99}`, "operator-token").Code).To(Equal(http.StatusBadRequest))
+			Expect(put(`not json`, "operator-token").Code).To(Equal(http.StatusBadRequest))
+			Expect(put(`{"version":1}`, "observer-token").Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Describe("fds", func() {
+		It("should report the latest file descriptor sample", func() {
+			w := do(http.MethodGet, "/admin/fds", "observer-token")
+			Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+
+			if err := monitor.Check(); errors.Is(err, errors.ErrUnsupported) {
+				Skip("file descriptor sampling is not supported on this platform")
+			}
+
+			w = do(http.MethodGet, "/admin/fds", "observer-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var usage fdmon.Usage
+			Expect(json.Unmarshal(w.Body.Bytes(), &usage)).To(Succeed())
+			Expect(usage.Open).To(BeNumerically(">", 0))
+			Expect(usage.Limit).To(BeNumerically(">", 0))
+		})
+
+		It("should conflict when monitoring is disabled", func() {
+			w := httptest.NewRecorder()
+			admin.FDsHandler(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/fds", nil))
+			Expect(w.Code).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Describe("schedule", func() {
+		It("should list rules with their next start", func() {
+			expr, _ := cron.Parse("0 2 * * *")
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			scheduler := schedule.NewScheduler([]schedule.Rule{{
+				Name:     "nightly",
+				Cron:     "0 2 * * *",
+				Expr:     expr,
+				Duration: time.Hour,
+				Action:   schedule.ActionMaintenance,
+				Backends: []string{"http://localhost:8081"},
+			}}, pool, log)
+			api.Handle("GET /admin/schedule", admin.RoleObserver, admin.ScheduleHandler(scheduler))
+
+			w := do(http.MethodGet, "/admin/schedule", "observer-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var statuses []schedule.Status
+			Expect(json.Unmarshal(w.Body.Bytes(), &statuses)).To(Succeed())
+			Expect(statuses).To(HaveLen(1))
+			Expect(statuses[0].Name).To(Equal("nightly"))
+			Expect(statuses[0].NextStart).NotTo(BeNil())
+		})
+
+		It("should conflict when no schedules are configured", func() {
+			w := httptest.NewRecorder()
+			admin.ScheduleHandler(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/schedule", nil))
+			Expect(w.Code).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Describe("authentication", func() {
+		It("should reject requests without a token", func() {
+			w := do(http.MethodGet, "/admin/backends", "")
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(w.Header().Get("WWW-Authenticate")).To(ContainSubstring("Bearer"))
+		})
+
+		It("should reject unknown tokens", func() {
+			w := do(http.MethodGet, "/admin/backends", "nope")
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Describe("authorization", func() {
+		It("should let observers read status", func() {
+			w := do(http.MethodGet, "/admin/backends", "observer-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var statuses []admin.BackendStatus
+			Expect(json.Unmarshal(w.Body.Bytes(), &statuses)).To(Succeed())
+			Expect(statuses).To(HaveLen(1))
+			Expect(statuses[0].URL).To(Equal("http://localhost:8081"))
+			Expect(statuses[0].Weight).To(Equal(3))
+			Expect(statuses[0].Healthy).To(BeTrue())
+			Expect(statuses[0].State).To(Equal("active"))
+			Expect(statuses[0].CircuitState).To(Equal("CLOSED"))
+		})
+
+		It("should forbid observers from mutating endpoints", func() {
+			registry.GetBreaker("http://localhost:8081").RecordFailure()
+
+			w := do(http.MethodPost, "/admin/breakers/reset", "observer-token")
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+			Expect(registry.Stats()).To(HaveKeyWithValue("http://localhost:8081", circuitbreaker.StateOpen))
+		})
+
+		It("should let operators reset breakers", func() {
+			registry.GetBreaker("http://localhost:8081").RecordFailure()
+
+			w := do(http.MethodPost, "/admin/breakers/reset", "operator-token")
+			Expect(w.Code).To(Equal(http.StatusNoContent))
+			Expect(registry.Stats()).To(BeEmpty())
+		})
+
+		It("should let operators read status", func() {
+			w := do(http.MethodGet, "/admin/breakers", "operator-token")
+			Expect(w.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,282 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+)
+
+type BackendStatus struct {
+	Name              string            `json:"name"`
+	URL               string            `json:"url"`
+	Origin            string            `json:"origin"`
+	Healthy           bool              `json:"healthy"`
+	State             string            `json:"state"`
+	HealthOverride    string            `json:"health_override,omitempty"`
+	Draining          bool              `json:"draining"`
+	DrainedBy         []string          `json:"drained_by,omitempty"`
+	DrainDeadline     *time.Time        `json:"drain_deadline,omitempty"`
+	Maintenance       bool              `json:"maintenance,omitempty"`
+	MaintenanceBy     []string          `json:"maintenance_by,omitempty"`
+	Weight            int               `json:"weight"`
+	ConfiguredWeight  int               `json:"configured_weight"`
+	WeightBy          []string          `json:"weight_by,omitempty"`
+	ActiveConnections int               `json:"active_connections"`
+	EWMAResponse      time.Duration     `json:"ewma_response"`
+	CircuitState      string            `json:"circuit_state,omitempty"`
+	ReportedLoad      *float64          `json:"reported_load,omitempty"`
+	SlowStart         *float64          `json:"slow_start,omitempty"`
+	WeightDecay       *float64          `json:"weight_decay,omitempty"`
+	Shift             *float64          `json:"shift,omitempty"`
+	CheckOutput       string            `json:"check_output,omitempty"`
+	SkippedChecks     uint64            `json:"skipped_checks,omitempty"`
+	Standby           string            `json:"standby,omitempty"`
+	Priority          int               `json:"priority"`
+	AtCapacity        bool              `json:"at_capacity,omitempty"`
+	MaxInFlight       int               `json:"max_in_flight,omitempty"`
+	Zone              string            `json:"zone,omitempty"`
+	Remote            bool              `json:"remote,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+}
+
+func BackendsHandler(pool *backend.Pool, registry *circuitbreaker.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backends := pool.Backends()
+		statuses := make([]BackendStatus, 0, len(backends))
+
+		for _, b := range backends {
+			status := BackendStatus{
+				Name:              b.Name(),
+				URL:               b.URL().String(),
+				Origin:            b.Origin(),
+				Healthy:           b.IsHealthy(),
+				State:             b.State().String(),
+				HealthOverride:    b.HealthOverride().String(),
+				Draining:          b.IsDraining(),
+				DrainedBy:         b.Holders(backend.StateDraining).Names(),
+				Maintenance:       b.InMaintenance(),
+				MaintenanceBy:     b.Holders(backend.StateMaintenance).Names(),
+				Weight:            b.Weight(),
+				ConfiguredWeight:  b.ConfiguredWeight(),
+				WeightBy:          b.WeightHolders().Names(),
+				ActiveConnections: b.ActiveConnections(),
+				EWMAResponse:      b.EWMATime(),
+				SkippedChecks:     b.SkippedChecks(),
+				Priority:          b.Priority(),
+				AtCapacity:        b.AtCapacity(),
+				MaxInFlight:       b.MaxInFlight(),
+				Zone:              b.Zone(),
+				Remote:            b.IsRemote(),
+				Labels:            b.Labels(),
+			}
+
+			if b.IsStandby() {
+				status.Standby = "inactive"
+				if b.StandbyActive() {
+					status.Standby = "active"
+				}
+			}
+
+			if load, ok := b.ReportedLoad(); ok {
+				status.ReportedLoad = &load
+			}
+
+			if factor := b.SlowStartFactor(time.Now()); factor < 1 {
+				status.SlowStart = &factor
+			}
+
+			if factor := b.DecayFactor(); factor < 1 {
+				status.WeightDecay = &factor
+			}
+
+			if factor := b.ShiftFactor(); factor < 1 {
+				status.Shift = &factor
+			}
+
+			if deadline, ok := b.DrainDeadline(); ok {
+				status.DrainDeadline = &deadline
+			}
+
+			if registry != nil {
+				status.CircuitState = registry.GetBreaker(b.Name()).State().String()
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		writeJSON(w, http.StatusOK, statuses)
+	}
+}
+
+// WeightRequest sets the runtime weight of the backends whose name, URL or
+// configured URL equals Backend. A null Weight releases the operator's
+// weight, leaving the one another owner holds or the configured one.
+type WeightRequest struct {
+	Backend string `json:"backend"`
+	Weight  *int   `json:"weight"`
+}
+
+type WeightStatus struct {
+	Name             string   `json:"name"`
+	URL              string   `json:"url"`
+	Weight           int      `json:"weight"`
+	ConfiguredWeight int      `json:"configured_weight"`
+	WeightBy         []string `json:"weight_by,omitempty"`
+}
+
+// SetWeightHandler changes backend weights at runtime on behalf of the
+// operator, whose weight outranks those of the override file, schedules and
+// capacity detection until it is released. Weighted strategies configured
+// with a ramp move to the new weight gradually.
+func SetWeightHandler(pool *backend.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req WeightRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBodyBytes)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid weight request: "+err.Error())
+			return
+		}
+		if req.Backend == "" {
+			writeError(w, http.StatusBadRequest, "backend is required")
+			return
+		}
+		if req.Weight != nil && *req.Weight < 0 {
+			writeError(w, http.StatusBadRequest, "weight must not be negative")
+			return
+		}
+
+		var updated []WeightStatus
+		for _, b := range pool.Backends() {
+			if req.Backend != b.Name() && req.Backend != b.URL().String() && req.Backend != b.Origin() {
+				continue
+			}
+
+			if req.Weight != nil {
+				b.HoldWeight(backend.OwnerAdmin, *req.Weight)
+			} else {
+				b.ReleaseWeight(backend.OwnerAdmin)
+			}
+
+			updated = append(updated, WeightStatus{
+				Name:             b.Name(),
+				URL:              b.URL().String(),
+				Weight:           b.BaseWeight(),
+				ConfiguredWeight: b.ConfiguredWeight(),
+				WeightBy:         b.WeightHolders().Names(),
+			})
+		}
+
+		if len(updated) == 0 {
+			writeError(w, http.StatusNotFound, "unknown backend "+req.Backend)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, updated)
+	}
+}
+
+// DrainRequest starts or ends draining the backends whose name, URL or
+// configured URL equals Backend. Timeout, when set, replaces the configured
+// drain timeout for this drain; "0s" waits for the requests in flight however
+// long they take.
+type DrainRequest struct {
+	Backend  string `json:"backend"`
+	Draining bool   `json:"draining"`
+	Timeout  string `json:"timeout,omitempty"`
+}
+
+// DrainStatus reports a backend after a drain request. InFlight is the
+// number of requests it still holds, and Deadline when those still in flight
+// are cut off.
+type DrainStatus struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Draining  bool       `json:"draining"`
+	DrainedBy []string   `json:"drained_by,omitempty"`
+	State     string     `json:"state"`
+	InFlight  int        `json:"in_flight"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+}
+
+// SetDrainHandler drains backends at runtime: a draining backend gets no new
+// requests while those in flight complete.
+func SetDrainHandler(pool *backend.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req DrainRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBodyBytes)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid drain request: "+err.Error())
+			return
+		}
+		if req.Backend == "" {
+			writeError(w, http.StatusBadRequest, "backend is required")
+			return
+		}
+		var timeout time.Duration
+		if req.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(req.Timeout); err != nil || timeout < 0 {
+				writeError(w, http.StatusBadRequest, "invalid timeout "+req.Timeout)
+				return
+			}
+		}
+
+		var updated []DrainStatus
+		for _, b := range pool.Backends() {
+			if req.Backend != b.Name() && req.Backend != b.URL().String() && req.Backend != b.Origin() {
+				continue
+			}
+
+			if req.Draining && req.Timeout != "" {
+				b.Drain(timeout)
+			} else {
+				b.SetDraining(req.Draining)
+			}
+			status := DrainStatus{
+				Name:      b.Name(),
+				URL:       b.URL().String(),
+				Draining:  b.IsDraining(),
+				DrainedBy: b.Holders(backend.StateDraining).Names(),
+				State:     b.State().String(),
+				InFlight:  b.ActiveConnections(),
+			}
+			if deadline, ok := b.DrainDeadline(); ok {
+				status.Deadline = &deadline
+			}
+			updated = append(updated, status)
+		}
+
+		if len(updated) == 0 {
+			writeError(w, http.StatusNotFound, "unknown backend "+req.Backend)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, updated)
+	}
+}
+
+func BreakersHandler(registry *circuitbreaker.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		states := make(map[string]string)
+		if registry != nil {
+			for url, state := range registry.Stats() {
+				states[url] = state.String()
+			}
+		}
+
+		writeJSON(w, http.StatusOK, states)
+	}
+}
+
+func ResetBreakersHandler(registry *circuitbreaker.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if registry == nil {
+			writeError(w, http.StatusConflict, "circuit breaker is disabled")
+			return
+		}
+
+		registry.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
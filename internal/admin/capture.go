@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/capture"
+)
+
+type CaptureRequest struct {
+	PathPrefix   string  `json:"path_prefix"`
+	Backend      string  `json:"backend"`
+	Status       string  `json:"status"`
+	Duration     string  `json:"duration"`
+	SampleRate   float64 `json:"sample_rate"`
+	MaxRecords   int     `json:"max_records"`
+	MaxBodyBytes int     `json:"max_body_bytes"`
+}
+
+// StartCaptureHandler starts a capture session. The body is optional; an
+// empty one captures every exchange with the default limits.
+func StartCaptureHandler(c *capture.Capturer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CaptureRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBodyBytes)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "invalid capture request: "+err.Error())
+			return
+		}
+
+		var duration time.Duration
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid duration "+req.Duration)
+				return
+			}
+			duration = d
+		}
+
+		filter := capture.Filter{
+			PathPrefix: req.PathPrefix,
+			Backend:    req.Backend,
+			Status:     req.Status,
+		}
+		if err := filter.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		status, err := c.Start(capture.Options{
+			Filter:       filter,
+			Duration:     duration,
+			SampleRate:   req.SampleRate,
+			MaxRecords:   req.MaxRecords,
+			MaxBodyBytes: req.MaxBodyBytes,
+		})
+		switch {
+		case errors.Is(err, capture.ErrActive):
+			writeJSON(w, http.StatusConflict, status)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		default:
+			writeJSON(w, http.StatusCreated, status)
+		}
+	}
+}
+
+func CaptureStatusHandler(c *capture.Capturer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	}
+}
+
+func StopCaptureHandler(c *capture.Capturer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Stop())
+	}
+}
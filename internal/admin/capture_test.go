@@ -0,0 +1,84 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/admin"
+	"github.com/angeloszaimis/load-balancer/internal/capture"
+)
+
+var _ = Describe("Capture endpoints", func() {
+	var api *admin.API
+
+	do := func(method, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/capture", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	decode := func(w *httptest.ResponseRecorder) capture.Status {
+		var status capture.Status
+		Expect(json.Unmarshal(w.Body.Bytes(), &status)).To(Succeed())
+		return status
+	}
+
+	BeforeEach(func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		c := capture.New(GinkgoT().TempDir(), time.Minute, log)
+		DeferCleanup(c.Stop)
+
+		api = admin.New(log, []admin.Token{
+			{Value: "observer-token", Role: admin.RoleObserver},
+			{Value: "operator-token", Role: admin.RoleOperator},
+		})
+		api.Handle("GET /admin/capture", admin.RoleObserver, admin.CaptureStatusHandler(c))
+		api.Handle("POST /admin/capture", admin.RoleOperator, admin.StartCaptureHandler(c))
+		api.Handle("DELETE /admin/capture", admin.RoleOperator, admin.StopCaptureHandler(c))
+	})
+
+	It("should start, report and stop a session", func() {
+		w := do(http.MethodPost, `{"path_prefix":"/api/","status":"5xx","duration":"30s"}`, "operator-token")
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		started := decode(w)
+		Expect(started.Active).To(BeTrue())
+		Expect(started.Filter.PathPrefix).To(Equal("/api/"))
+		Expect(started.Until.Sub(started.Started)).To(Equal(30 * time.Second))
+
+		w = do(http.MethodGet, "", "observer-token")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(decode(w).File).To(Equal(started.File))
+
+		w = do(http.MethodDelete, "", "operator-token")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(decode(w).Active).To(BeFalse())
+	})
+
+	It("should accept an empty body", func() {
+		Expect(do(http.MethodPost, "", "operator-token").Code).To(Equal(http.StatusCreated))
+	})
+
+	It("should reject a second session while one is running", func() {
+		Expect(do(http.MethodPost, "", "operator-token").Code).To(Equal(http.StatusCreated))
+		Expect(do(http.MethodPost, "", "operator-token").Code).To(Equal(http.StatusConflict))
+	})
+
+	It("should reject invalid filters and durations", func() {
+		Expect(do(http.MethodPost, `{"status":"bad"}`, "operator-token").Code).To(Equal(http.StatusBadRequest))
+		Expect(do(http.MethodPost, `{"duration":"soon"}`, "operator-token").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should only let operators start captures", func() {
+		Expect(do(http.MethodPost, "", "observer-token").Code).To(Equal(http.StatusForbidden))
+	})
+})
@@ -0,0 +1,145 @@
+package admin
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/angeloszaimis/load-balancer/config"
+)
+
+const maxConfigBodyBytes = 1 << 20
+
+// statusClientClosedRequest is nginx's status for a request whose client
+// went away before it was answered.
+const statusClientClosedRequest = 499
+
+// writeBodyError answers a request whose body, described by what, could not
+// be read: 413 when it exceeded its limit, 499 when the client went away and
+// 400 otherwise.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error, what string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, what+" too large")
+	case r.Context().Err() != nil:
+		writeError(w, statusClientClosedRequest, "client closed the request")
+	default:
+		writeError(w, http.StatusBadRequest, "failed to read "+what)
+	}
+}
+
+type DryRunResponse struct {
+	Valid  bool               `json:"valid"`
+	Source string             `json:"source"`
+	Error  string             `json:"error,omitempty"`
+	Plan   *config.ReloadPlan `json:"plan,omitempty"`
+}
+
+type ConfigDiffResponse struct {
+	File    string          `json:"file"`
+	InSync  bool            `json:"in_sync"`
+	Changes []config.Change `json:"changes"`
+}
+
+// ConfigHandler returns the configuration the balancer is currently running
+// with. active is consulted on every request so reloads are reflected.
+func ConfigHandler(active func() *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, active().Redacted())
+	}
+}
+
+// ConfigDiffHandler compares the active configuration against the file it was
+// loaded from, so operators can tell whether the file has drifted or a reload
+// is pending.
+func ConfigDiffHandler(active func() *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := active()
+		if current.Source == "" {
+			writeError(w, http.StatusConflict, "configuration was not loaded from a file")
+			return
+		}
+
+		onDisk, err := config.LoadFile(current.Source)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "on-disk configuration is invalid: "+err.Error())
+			return
+		}
+
+		changes, err := config.Diff(current, onDisk)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if changes == nil {
+			changes = []config.Change{}
+		}
+
+		writeJSON(w, http.StatusOK, ConfigDiffResponse{
+			File:    current.Source,
+			InSync:  len(changes) == 0,
+			Changes: changes,
+		})
+	}
+}
+
+// DryRunHandler validates a candidate configuration and reports what a reload
+// would change without applying anything. The candidate is the request body
+// when one is posted (YAML, or JSON when sent with a JSON content type) and
+// the on-disk configuration file otherwise.
+func DryRunHandler(active func() *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := active()
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigBodyBytes))
+		if err != nil {
+			writeBodyError(w, r, err, "configuration body")
+			return
+		}
+
+		var (
+			candidate *config.Config
+			source    string
+		)
+
+		if len(strings.TrimSpace(string(body))) > 0 {
+			source = "request"
+			format := "yaml"
+			if strings.Contains(r.Header.Get("Content-Type"), "json") {
+				format = "json"
+			}
+			candidate, err = config.Parse(body, format)
+		} else {
+			if current.Source == "" {
+				writeError(w, http.StatusConflict, "no request body and configuration was not loaded from a file")
+				return
+			}
+			source = current.Source
+			candidate, err = config.LoadFile(current.Source)
+		}
+
+		if err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, DryRunResponse{
+				Valid:  false,
+				Source: source,
+				Error:  err.Error(),
+			})
+			return
+		}
+
+		plan, err := config.PlanReload(current, candidate)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, DryRunResponse{
+			Valid:  true,
+			Source: source,
+			Plan:   plan,
+		})
+	}
+}
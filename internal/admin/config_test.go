@@ -0,0 +1,189 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/admin"
+)
+
+var _ = Describe("Config endpoints", func() {
+	var (
+		api    *admin.API
+		active *config.Config
+		path   string
+	)
+
+	post := func(target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer operator-token")
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer observer-token")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	writeConfig := func(strategyType string) {
+		Expect(os.WriteFile(path, []byte(`
+strategy:
+  type: "`+strategyType+`"
+backends:
+  - url: "http://localhost:8081"
+    weight: 1
+admin:
+  enabled: true
+  tokens:
+    - token: "observer-token"
+      role: "observer"
+`), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir, err := os.MkdirTemp("", "admin-config-*")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		path = filepath.Join(dir, "config.yaml")
+
+		writeConfig("round-robin")
+		active, err = config.LoadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		api = admin.New(slog.New(slog.NewTextHandler(io.Discard, nil)), []admin.Token{
+			{Value: "observer-token", Role: admin.RoleObserver},
+			{Value: "operator-token", Role: admin.RoleOperator},
+		})
+		activeFn := func() *config.Config { return active }
+		api.Handle("GET /admin/config", admin.RoleObserver, admin.ConfigHandler(activeFn))
+		api.Handle("GET /admin/config/diff", admin.RoleObserver, admin.ConfigDiffHandler(activeFn))
+		api.Handle("POST /admin/config/dry-run", admin.RoleOperator, admin.DryRunHandler(activeFn))
+	})
+
+	It("should dump the active configuration without secrets", func() {
+		w := get("/admin/config")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(ContainSubstring(`"type":"round-robin"`))
+		Expect(w.Body.String()).NotTo(ContainSubstring("observer-token"))
+	})
+
+	It("should report in sync when the file is unchanged", func() {
+		w := get("/admin/config/diff")
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var resp admin.ConfigDiffResponse
+		Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.InSync).To(BeTrue())
+		Expect(resp.Changes).To(BeEmpty())
+	})
+
+	It("should report drift when the file was edited", func() {
+		writeConfig("least-conn")
+
+		w := get("/admin/config/diff")
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var resp admin.ConfigDiffResponse
+		Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.InSync).To(BeFalse())
+		Expect(resp.Changes).To(ConsistOf(config.Change{Path: "strategy.type", From: "round-robin", To: "least-conn"}))
+	})
+
+	It("should refuse to diff when no file was used", func() {
+		active.Source = ""
+		w := get("/admin/config/diff")
+		Expect(w.Code).To(Equal(http.StatusConflict))
+	})
+
+	Describe("dry-run", func() {
+		It("should plan against the on-disk file when no body is posted", func() {
+			writeConfig("least-conn")
+
+			w := post("/admin/config/dry-run", "", "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var resp admin.DryRunResponse
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Valid).To(BeTrue())
+			Expect(resp.Source).To(Equal(path))
+			Expect(resp.Plan.StrategyChange).To(Equal(&config.StrategyChange{From: "round-robin", To: "least-conn"}))
+			Expect(active.Strategy.Type).To(Equal("round-robin"))
+		})
+
+		It("should plan against a posted YAML body", func() {
+			w := post("/admin/config/dry-run", "application/yaml", `
+strategy:
+  type: "round-robin"
+backends:
+  - url: "http://localhost:8082"
+    weight: 1
+`)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var resp admin.DryRunResponse
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Source).To(Equal("request"))
+			Expect(resp.Plan.BackendsAdded).To(ConsistOf("http://localhost:8082"))
+			Expect(resp.Plan.BackendsRemoved).To(ConsistOf("http://localhost:8081"))
+		})
+
+		It("should accept JSON bodies", func() {
+			w := post("/admin/config/dry-run", "application/json",
+				`{"backends":[{"url":"http://localhost:8081","weight":2}]}`)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var resp admin.DryRunResponse
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Plan.WeightChanges).To(ConsistOf(config.WeightChange{URL: "http://localhost:8081", From: 1, To: 2}))
+		})
+
+		It("should report validation errors without applying anything", func() {
+			w := post("/admin/config/dry-run", "application/yaml", "backends: []\n")
+			Expect(w.Code).To(Equal(http.StatusUnprocessableEntity))
+
+			var resp admin.DryRunResponse
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Valid).To(BeFalse())
+			Expect(resp.Error).NotTo(BeEmpty())
+		})
+
+		It("should refuse bodies over the limit with 413", func() {
+			w := post("/admin/config/dry-run", "application/yaml", strings.Repeat("#", 1<<20+1))
+			Expect(w.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+
+		It("should answer 400 to a body that cannot be read", func() {
+			req := httptest.NewRequest(http.MethodPost, "/admin/config/dry-run", iotest.ErrReader(errors.New("connection reset")))
+			req.Header.Set("Authorization", "Bearer operator-token")
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should be restricted to operators", func() {
+			req := httptest.NewRequest(http.MethodPost, "/admin/config/dry-run", nil)
+			req.Header.Set("Authorization", "Bearer observer-token")
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+})
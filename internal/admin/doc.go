@@ -0,0 +1,17 @@
+// Package admin implements the operational HTTP API of the load balancer.
+//
+// Every endpoint is protected by bearer tokens that carry a role:
+//
+//   - observer: read-only access to status endpoints (dashboards, monitoring)
+//   - operator: everything an observer can do plus mutating operations
+//     such as resetting circuit breakers
+//
+// Usage:
+//
+//	api := admin.New(logger, []admin.Token{
+//		{Value: "dashboard-token", Role: admin.RoleObserver},
+//		{Value: "ops-token", Role: admin.RoleOperator},
+//	})
+//	api.Handle("GET /admin/backends", admin.RoleObserver, admin.BackendsHandler(backends, registry))
+//	mux.Handle("/admin/", api)
+package admin
@@ -0,0 +1,20 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/angeloszaimis/load-balancer/internal/fingerprint"
+)
+
+// FingerprintsHandler reports the request and status counts per client
+// fingerprint, busiest first.
+func FingerprintsHandler(rec *fingerprint.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rec == nil {
+			writeError(w, http.StatusConflict, "client fingerprinting is disabled")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, rec.Snapshot())
+	}
+}
@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/angeloszaimis/load-balancer/internal/fdmon"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+// RuntimeHandler reports goroutine counts per subsystem next to the process
+// total, so a subsystem that keeps growing can be told apart from request
+// load.
+func RuntimeHandler(tracker *goroutines.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, tracker.Report())
+	}
+}
+
+// FDsHandler reports the latest file descriptor and accept queue sample.
+func FDsHandler(monitor *fdmon.Monitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitor == nil {
+			writeError(w, http.StatusConflict, "file descriptor monitoring is disabled")
+			return
+		}
+
+		usage, ok := monitor.Usage()
+		if !ok {
+			writeError(w, http.StatusServiceUnavailable, "no file descriptor sample is available")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, usage)
+	}
+}
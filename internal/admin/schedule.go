@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/schedule"
+)
+
+// ScheduleHandler lists the scheduled traffic policies with whether each is
+// in force and when its window next opens.
+func ScheduleHandler(scheduler *schedule.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if scheduler == nil {
+			writeError(w, http.StatusConflict, "no traffic schedules are configured")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, scheduler.Upcoming(time.Now()))
+	}
+}
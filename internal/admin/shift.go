@@ -0,0 +1,262 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/shift"
+)
+
+// ShiftRequest starts moving traffic from the backends labeled From to those
+// labeled To, both written as key=value, over Duration.
+type ShiftRequest struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Duration string `json:"duration"`
+}
+
+// SplitRequest holds Weight percent of the traffic on the backends labeled
+// To and the rest on those labeled From.
+type SplitRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Weight int    `json:"weight"`
+}
+
+// GroupMetrics sums the metrics of the backends in one group of a shift
+// since the shift started or the split was last set. Errors counts 5xx
+// responses and requests that failed to reach a backend. SuccessRate is the
+// share of requests that did not fail, absent until the group has served
+// one. AvgResponse averages the backends' latest responses.
+type GroupMetrics struct {
+	Selector    string        `json:"selector"`
+	Backends    int           `json:"backends"`
+	Healthy     int           `json:"healthy"`
+	Requests    int64         `json:"requests"`
+	Errors      int64         `json:"errors"`
+	SuccessRate *float64      `json:"success_rate,omitempty"`
+	AvgResponse time.Duration `json:"avg_response"`
+}
+
+// ShiftMetrics reports both groups of the current or most recent shift or
+// split, counted since Since.
+type ShiftMetrics struct {
+	Phase    shift.Phase  `json:"phase"`
+	Progress float64      `json:"progress"`
+	Since    time.Time    `json:"since"`
+	From     GroupMetrics `json:"from"`
+	To       GroupMetrics `json:"to"`
+}
+
+// shiftCounts are the requests and errors of one backend.
+type shiftCounts struct {
+	requests int64
+	errors   int64
+}
+
+// shiftBaseline holds the counts of every backend when the current shift
+// started or split was set, so the metrics only cover the traffic since.
+type shiftBaseline struct {
+	mutex  sync.Mutex
+	since  time.Time
+	counts map[string]shiftCounts
+}
+
+func (s *shiftBaseline) reset(snapshot metrics.Snapshot, now time.Time) {
+	counts := make(map[string]shiftCounts, len(snapshot.Backends))
+	for name, bm := range snapshot.Backends {
+		counts[name] = countsOf(bm)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.since, s.counts = now, counts
+}
+
+func (s *shiftBaseline) get() (time.Time, map[string]shiftCounts) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.since, s.counts
+}
+
+// countsOf counts the requests a backend took and those that failed.
+func countsOf(bm metrics.BackendMetrics) shiftCounts {
+	var c shiftCounts
+	for _, count := range bm.StatusClasses {
+		c.requests += count
+	}
+	c.errors = bm.StatusClasses["5xx"]
+	if errs := bm.Errors; errs != nil {
+		unreached := errs.Dial + errs.Timeout + errs.Reset + errs.Other
+		c.requests += unreached
+		c.errors += unreached
+	}
+	return c
+}
+
+// ShiftStatusHandler reports the current or most recent traffic shift.
+func ShiftStatusHandler(c *shift.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	}
+}
+
+// StartShiftHandler starts a traffic shift between two labeled groups.
+func StartShiftHandler(c *shift.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ShiftRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBodyBytes)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid shift request: "+err.Error())
+			return
+		}
+
+		from, err := shift.ParseSelector(req.From)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return
+		}
+		to, err := shift.ParseSelector(req.To)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "to: "+err.Error())
+			return
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration < 0 {
+			writeError(w, http.StatusBadRequest, "invalid duration "+req.Duration)
+			return
+		}
+
+		status, err := c.Shift(from, to, duration, time.Now())
+		switch {
+		case errors.Is(err, shift.ErrActive):
+			writeJSON(w, http.StatusConflict, status)
+		case err != nil:
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeJSON(w, http.StatusCreated, status)
+		}
+	}
+}
+
+// RollbackShiftHandler returns all traffic to the group the last shift moved
+// it away from.
+func RollbackShiftHandler(c *shift.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := c.Rollback(time.Now())
+		if errors.Is(err, shift.ErrNoShift) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// SplitHandler holds a fixed traffic split between two labeled groups, for
+// progressive delivery controllers.
+func SplitHandler(c *shift.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SplitRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBodyBytes)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid split request: "+err.Error())
+			return
+		}
+
+		from, err := shift.ParseSelector(req.From)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return
+		}
+		to, err := shift.ParseSelector(req.To)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "to: "+err.Error())
+			return
+		}
+		if req.Weight < 0 || req.Weight > 100 {
+			writeError(w, http.StatusBadRequest, "weight must be between 0 and 100")
+			return
+		}
+
+		status, err := c.Split(from, to, float64(req.Weight)/100, time.Now())
+		switch {
+		case errors.Is(err, shift.ErrActive):
+			writeJSON(w, http.StatusConflict, status)
+		case err != nil:
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeJSON(w, http.StatusOK, status)
+		}
+	}
+}
+
+// ShiftMetricsHandler reports the request metrics of both groups of the
+// current or most recent shift, for canary analysis. Counts start over
+// whenever a shift starts or a split is set, so each step of a canary is
+// judged by its own traffic.
+func ShiftMetricsHandler(c *shift.Controller, pool *backend.Pool, collector *metrics.Collector) http.HandlerFunc {
+	baseline := &shiftBaseline{}
+	c.OnStart(func(shift.Status) {
+		baseline.reset(collector.Snapshot(""), time.Now())
+	})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := c.Status()
+		if status.Phase == shift.PhaseIdle {
+			writeError(w, http.StatusConflict, "no traffic shift or split")
+			return
+		}
+
+		backends := pool.Backends()
+		snapshot := collector.Snapshot("")
+		since, base := baseline.get()
+		from, _ := shift.ParseSelector(status.From)
+		to, _ := shift.ParseSelector(status.To)
+		writeJSON(w, http.StatusOK, ShiftMetrics{
+			Phase:    status.Phase,
+			Progress: status.Progress,
+			Since:    since,
+			From:     groupMetrics(from, backends, snapshot, base),
+			To:       groupMetrics(to, backends, snapshot, base),
+		})
+	}
+}
+
+func groupMetrics(sel shift.Selector, backends []*backend.Backend, snapshot metrics.Snapshot, base map[string]shiftCounts) GroupMetrics {
+	group := GroupMetrics{Selector: sel.String()}
+	var responses int64
+	var totalResponse time.Duration
+	for _, b := range backends {
+		if !sel.Matches(b) {
+			continue
+		}
+		group.Backends++
+		if b.IsHealthy() {
+			group.Healthy++
+		}
+
+		bm := snapshot.Backends[b.Name()]
+		counts, before := countsOf(bm), base[b.Name()]
+		group.Requests += max(0, counts.requests-before.requests)
+		group.Errors += max(0, counts.errors-before.errors)
+
+		var served int64
+		for _, count := range bm.StatusClasses {
+			served += count
+		}
+		responses += served
+		totalResponse += bm.AvgResponse * time.Duration(served)
+	}
+
+	if group.Requests > 0 {
+		rate := float64(group.Requests-group.Errors) / float64(group.Requests)
+		group.SuccessRate = &rate
+	}
+	if responses > 0 {
+		group.AvgResponse = totalResponse / time.Duration(responses)
+	}
+	return group
+}
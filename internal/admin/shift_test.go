@@ -0,0 +1,133 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/admin"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/shift"
+)
+
+var _ = Describe("Shift endpoints", func() {
+	var (
+		api         *admin.API
+		blue, green *backend.Backend
+		collector   *metrics.Collector
+	)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer operator-token")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	decode := func(w *httptest.ResponseRecorder) shift.Status {
+		var status shift.Status
+		Expect(json.Unmarshal(w.Body.Bytes(), &status)).To(Succeed())
+		return status
+	}
+
+	BeforeEach(func() {
+		u1, _ := url.Parse("http://10.0.0.1")
+		u2, _ := url.Parse("http://10.0.0.2")
+		blue = backend.New(u1, 1, backend.WithLabels(map[string]string{"color": "blue"}))
+		green = backend.New(u2, 1, backend.WithLabels(map[string]string{"color": "green"}))
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		pool := backend.NewPool([]*backend.Backend{blue, green})
+		c := shift.New(pool, log)
+
+		api = admin.New(log, []admin.Token{{Value: "operator-token", Role: admin.RoleOperator}})
+		api.Handle("GET /admin/shift", admin.RoleObserver, admin.ShiftStatusHandler(c))
+		api.Handle("POST /admin/shift", admin.RoleOperator, admin.StartShiftHandler(c))
+		api.Handle("POST /admin/shift/rollback", admin.RoleOperator, admin.RollbackShiftHandler(c))
+
+		collector = metrics.NewCollector(100, log)
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		collector.Start(ctx)
+		api.Handle("PUT /admin/shift/split", admin.RoleOperator, admin.SplitHandler(c))
+		api.Handle("GET /admin/shift/metrics", admin.RoleObserver, admin.ShiftMetricsHandler(c, pool, collector))
+	})
+
+	It("should start, report and roll back a shift", func() {
+		w := do(http.MethodPost, "/admin/shift", `{"from":"color=blue","to":"color=green","duration":"10m"}`)
+		Expect(w.Code).To(Equal(http.StatusCreated))
+		Expect(decode(w).Phase).To(Equal(shift.PhaseShifting))
+		Expect(green.ShiftFactor()).To(BeNumerically("<", 0.01))
+
+		Expect(do(http.MethodPost, "/admin/shift", `{"from":"color=blue","to":"color=green","duration":"1m"}`).Code).To(Equal(http.StatusConflict))
+
+		w = do(http.MethodPost, "/admin/shift/rollback", "")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(decode(w).Phase).To(Equal(shift.PhaseRolledBack))
+		Expect(blue.ShiftFactor()).To(Equal(1.0))
+		Expect(green.ShiftFactor()).To(Equal(0.0))
+
+		Expect(decode(do(http.MethodGet, "/admin/shift", "")).Phase).To(Equal(shift.PhaseRolledBack))
+	})
+
+	It("should hold a split and report each group's metrics", func() {
+		Expect(do(http.MethodGet, "/admin/shift/metrics", "").Code).To(Equal(http.StatusConflict))
+
+		w := do(http.MethodPut, "/admin/shift/split", `{"from":"color=blue","to":"color=green","weight":20}`)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(decode(w).Phase).To(Equal(shift.PhaseSplit))
+		Expect(green.ShiftFactor()).To(BeNumerically("~", 0.2, 1e-9))
+		Expect(do(http.MethodPut, "/admin/shift/split", `{"from":"color=blue","to":"color=green","weight":120}`).Code).To(Equal(http.StatusBadRequest))
+
+		for _, code := range []int{200, 200, 200, 500} {
+			collector.Emit(metrics.MetricEvent{Type: metrics.EventResponseCompleted, Backend: green.Name(), Duration: 10 * time.Millisecond, StatusCode: code})
+		}
+		collector.Emit(metrics.MetricEvent{Type: metrics.EventResponseCompleted, Backend: blue.Name(), Duration: 30 * time.Millisecond, StatusCode: 200})
+
+		var m admin.ShiftMetrics
+		Eventually(func() int64 {
+			Expect(json.Unmarshal(do(http.MethodGet, "/admin/shift/metrics", "").Body.Bytes(), &m)).To(Succeed())
+			return m.To.Requests + m.From.Requests
+		}).Should(Equal(int64(5)))
+		Expect(m.Phase).To(Equal(shift.PhaseSplit))
+		Expect(m.Progress).To(Equal(0.2))
+		Expect(m.To.Selector).To(Equal("color=green"))
+		Expect(m.To.Backends).To(Equal(1))
+		Expect(m.To.Errors).To(Equal(int64(1)))
+		Expect(*m.To.SuccessRate).To(Equal(0.75))
+		Expect(m.To.AvgResponse).To(Equal(10 * time.Millisecond))
+		Expect(*m.From.SuccessRate).To(Equal(1.0))
+
+		Expect(do(http.MethodPut, "/admin/shift/split", `{"from":"color=blue","to":"color=green","weight":40}`).Code).To(Equal(http.StatusOK))
+		collector.Emit(metrics.MetricEvent{Type: metrics.EventResponseCompleted, Backend: green.Name(), Duration: 10 * time.Millisecond, StatusCode: 200})
+
+		m = admin.ShiftMetrics{}
+		Eventually(func() int64 {
+			Expect(json.Unmarshal(do(http.MethodGet, "/admin/shift/metrics", "").Body.Bytes(), &m)).To(Succeed())
+			return m.To.Requests
+		}).Should(Equal(int64(1)))
+		Expect(m.Since).NotTo(BeZero())
+		Expect(m.To.Errors).To(BeZero())
+		Expect(*m.To.SuccessRate).To(Equal(1.0))
+		Expect(m.From.Requests).To(BeZero())
+		Expect(m.From.SuccessRate).To(BeNil())
+	})
+
+	It("should reject invalid requests", func() {
+		Expect(do(http.MethodPost, "/admin/shift", `{"from":"blue","to":"color=green","duration":"1m"}`).Code).To(Equal(http.StatusBadRequest))
+		Expect(do(http.MethodPost, "/admin/shift", `{"from":"color=blue","to":"color=green","duration":"soon"}`).Code).To(Equal(http.StatusBadRequest))
+		Expect(do(http.MethodPost, "/admin/shift", `{"from":"color=blue","to":"color=red","duration":"1m"}`).Code).To(Equal(http.StatusBadRequest))
+		Expect(do(http.MethodPost, "/admin/shift/rollback", "").Code).To(Equal(http.StatusConflict))
+	})
+})
@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/angeloszaimis/load-balancer/internal/state"
+)
+
+// ExportStateHandler returns the runtime state for another instance to import.
+func ExportStateHandler(m *state.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Export())
+	}
+}
+
+// ImportStateHandler applies a snapshot from ExportStateHandler. Backends of
+// the snapshot that this instance does not have are reported, not rejected,
+// so state can move between instances whose backend sets differ slightly.
+func ImportStateHandler(m *state.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var snap state.Snapshot
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigBodyBytes)).Decode(&snap); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid state: "+err.Error())
+			return
+		}
+
+		result, err := m.Import(snap)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,191 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// What became of a request that met a full pool, as passed to
+// Options.Observe.
+const (
+	OutcomeQueued   = "queued"
+	OutcomeAdmitted = "admitted"
+	OutcomeTimeout  = "timeout"
+	OutcomeFull     = "full"
+	OutcomeCanceled = "canceled"
+)
+
+var (
+	// ErrQueueFull is returned when MaxQueued requests are already waiting.
+	ErrQueueFull = errors.New("admission queue is full")
+	// ErrTimeout is returned when no backend freed up within Timeout.
+	ErrTimeout = errors.New("timed out in the admission queue")
+)
+
+// recheckInterval bounds how long a waiting request goes without looking at
+// the backends again, for capacity freed by something other than Release,
+// such as a backend coming back up.
+const recheckInterval = 50 * time.Millisecond
+
+// Options configures a Queue. A backend is full once it holds MaxInFlight
+// requests, or all the connections its own max_connections allows are busy.
+// At most MaxQueued requests wait, each for at most Timeout. Observe, if set,
+// is told about every request that enters the queue and how it leaves it,
+// with the time it waited.
+type Options struct {
+	MaxInFlight int
+	MaxQueued   int
+	Timeout     time.Duration
+	Observe     func(outcome string, waited time.Duration)
+}
+
+// Queue holds requests while every backend they may go to is full.
+type Queue struct {
+	opts  Options
+	mutex sync.Mutex
+	// waiters holds a channel per waiting request, oldest first. Release
+	// wakes the oldest one not woken yet.
+	waiters []chan struct{}
+}
+
+func New(opts Options) *Queue {
+	return &Queue{opts: opts}
+}
+
+// Admissible returns the backends that are not full.
+func (q *Queue) Admissible(backends []*backend.Backend) []*backend.Backend {
+	admissible := make([]*backend.Backend, 0, len(backends))
+	for _, b := range backends {
+		if b.ActiveConnections() < q.opts.MaxInFlight && !b.AtCapacity() {
+			admissible = append(admissible, b)
+		}
+	}
+	return admissible
+}
+
+// Reserve reserves a connection on b unless it is full, checking and taking
+// the connection atomically, and reports whether it did.
+func (q *Queue) Reserve(b *backend.Backend) bool {
+	return b.TryIncrementConnBelow(q.opts.MaxInFlight)
+}
+
+// Wait reserves a connection with reserve on one of the backends of
+// candidates that are not full, waiting for one to free up while all are.
+// reserve is given the backends that were not full and returns a nil
+// backend and no error when all of them filled up meanwhile, which makes the
+// request wait for the next one to free up; it is expected to reserve with
+// Reserve, so no backend takes more than it may hold. When candidates
+// returns none, reserve is called with none at once, since no wait makes an
+// unavailable pool available. Otherwise the error is reserve's, ErrQueueFull,
+// ErrTimeout, or ctx's error when the request went away first.
+func (q *Queue) Wait(ctx context.Context, candidates func() []*backend.Backend, reserve func([]*backend.Backend) (*backend.Backend, error)) (*backend.Backend, error) {
+	if b, err, done := q.try(candidates, reserve); done {
+		return b, err
+	}
+
+	wake := make(chan struct{}, 1)
+	q.mutex.Lock()
+	if len(q.waiters) >= q.opts.MaxQueued {
+		q.mutex.Unlock()
+		q.observe(OutcomeFull, 0)
+		return nil, ErrQueueFull
+	}
+	q.waiters = append(q.waiters, wake)
+	q.mutex.Unlock()
+	defer q.leave(wake)
+
+	start := time.Now()
+	q.observe(OutcomeQueued, 0)
+
+	timeout := time.NewTimer(q.opts.Timeout)
+	defer timeout.Stop()
+	recheck := time.NewTicker(recheckInterval)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-wake:
+		case <-recheck.C:
+		case <-timeout.C:
+			q.observe(OutcomeTimeout, time.Since(start))
+			return nil, ErrTimeout
+		case <-ctx.Done():
+			q.observe(OutcomeCanceled, time.Since(start))
+			return nil, ctx.Err()
+		}
+
+		if b, err, done := q.try(candidates, reserve); done {
+			q.observe(OutcomeAdmitted, time.Since(start))
+			return b, err
+		}
+	}
+}
+
+// try calls reserve on the backends of candidates that are not full, and
+// reports whether that decided the request, i.e. it need not wait.
+func (q *Queue) try(candidates func() []*backend.Backend, reserve func([]*backend.Backend) (*backend.Backend, error)) (*backend.Backend, error, bool) {
+	backends := candidates()
+	if len(backends) == 0 {
+		b, err := reserve(nil)
+		return b, err, true
+	}
+	admissible := q.Admissible(backends)
+	if len(admissible) == 0 {
+		return nil, nil, false
+	}
+	b, err := reserve(admissible)
+	return b, err, b != nil || err != nil
+}
+
+// leave takes a request out of the queue. A wake-up it did not get to use
+// passes on to the next request waiting.
+func (q *Queue) leave(wake chan struct{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.waiters = slices.DeleteFunc(q.waiters, func(w chan struct{}) bool { return w == wake })
+	select {
+	case <-wake:
+		q.wake()
+	default:
+	}
+}
+
+// Release wakes the longest waiting request to look for a backend again.
+// Call it whenever a request reserved on a backend ends: one reservation
+// ending frees room for one request, so the others keep waiting rather than
+// all racing for it.
+func (q *Queue) Release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.wake()
+}
+
+// wake wakes the oldest waiter not woken yet. Callers must hold the mutex.
+func (q *Queue) wake() {
+	for _, w := range q.waiters {
+		select {
+		case w <- struct{}{}:
+			return
+		default:
+		}
+	}
+}
+
+// Depth returns the number of requests waiting.
+func (q *Queue) Depth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.waiters)
+}
+
+func (q *Queue) observe(outcome string, waited time.Duration) {
+	if q.opts.Observe != nil {
+		q.opts.Observe(outcome, waited)
+	}
+}
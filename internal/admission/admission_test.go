@@ -0,0 +1,171 @@
+package admission_test
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/admission"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Queue", func() {
+	var (
+		b        *backend.Backend
+		mutex    sync.Mutex
+		outcomes []string
+		opts     admission.Options
+	)
+
+	candidates := func() []*backend.Backend { return []*backend.Backend{b} }
+	// first reserves the first backend the queue lets it.
+	first := func(queue *admission.Queue) func([]*backend.Backend) (*backend.Backend, error) {
+		return func(backends []*backend.Backend) (*backend.Backend, error) {
+			for _, b := range backends {
+				if queue.Reserve(b) {
+					return b, nil
+				}
+			}
+			return nil, nil
+		}
+	}
+	recorded := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), outcomes...)
+	}
+
+	BeforeEach(func() {
+		u, _ := url.Parse("http://localhost:8081")
+		b = backend.New(u, 1)
+		outcomes = nil
+		opts = admission.Options{
+			MaxInFlight: 1,
+			MaxQueued:   1,
+			Timeout:     time.Second,
+			Observe: func(outcome string, _ time.Duration) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				outcomes = append(outcomes, outcome)
+			},
+		}
+	})
+
+	It("should admit at once while a backend has room", func() {
+		queue := admission.New(opts)
+
+		reserved, err := queue.Wait(context.Background(), candidates, first(queue))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reserved).To(Equal(b))
+		Expect(b.ActiveConnections()).To(Equal(1))
+		Expect(recorded()).To(BeEmpty())
+	})
+
+	It("should hold a request until a backend frees up", func() {
+		queue := admission.New(opts)
+		b.IncrementConn()
+
+		done := make(chan *backend.Backend)
+		go func() {
+			defer GinkgoRecover()
+			reserved, err := queue.Wait(context.Background(), candidates, first(queue))
+			Expect(err).NotTo(HaveOccurred())
+			done <- reserved
+		}()
+
+		Eventually(queue.Depth).Should(Equal(1))
+		Consistently(done, 20*time.Millisecond).ShouldNot(Receive())
+
+		b.DecrementConn()
+		queue.Release()
+		Eventually(done).Should(Receive(Equal(b)))
+		Expect(queue.Depth()).To(BeZero())
+		Expect(recorded()).To(Equal([]string{admission.OutcomeQueued, admission.OutcomeAdmitted}))
+	})
+
+	It("should give up after the timeout and turn requests away when full", func() {
+		opts.Timeout = 50 * time.Millisecond
+		queue := admission.New(opts)
+		b.IncrementConn()
+
+		errs := make(chan error)
+		go func() {
+			_, err := queue.Wait(context.Background(), candidates, first(queue))
+			errs <- err
+		}()
+		Eventually(queue.Depth).Should(Equal(1))
+
+		_, err := queue.Wait(context.Background(), candidates, first(queue))
+		Expect(err).To(MatchError(admission.ErrQueueFull))
+
+		Eventually(errs).Should(Receive(MatchError(admission.ErrTimeout)))
+		Expect(recorded()).To(Equal([]string{admission.OutcomeQueued, admission.OutcomeFull, admission.OutcomeTimeout}))
+	})
+
+	It("should stop waiting when the request goes away", func() {
+		queue := admission.New(opts)
+		b.IncrementConn()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := queue.Wait(ctx, candidates, first(queue))
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(recorded()).To(Equal([]string{admission.OutcomeQueued, admission.OutcomeCanceled}))
+	})
+
+	It("should treat a backend at its max_connections as full", func() {
+		u, _ := url.Parse("http://localhost:8082")
+		limited := backend.New(u, 1, backend.WithMaxConnections(1))
+		limited.IncrementConn()
+		queue := admission.New(admission.Options{MaxInFlight: 10})
+
+		Expect(queue.Admissible([]*backend.Backend{b, limited})).To(Equal([]*backend.Backend{b}))
+	})
+
+	It("should not wait when no backend is available at all", func() {
+		queue := admission.New(opts)
+
+		var offered []*backend.Backend
+		reserved, err := queue.Wait(context.Background(), func() []*backend.Backend { return nil }, func(backends []*backend.Backend) (*backend.Backend, error) {
+			offered = backends
+			return nil, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reserved).To(BeNil())
+		Expect(offered).To(BeEmpty())
+	})
+
+	It("should admit one waiting request per release without going over the limit", func() {
+		opts.MaxQueued = 2
+		opts.Timeout = 5 * time.Second
+		queue := admission.New(opts)
+		b.IncrementConn()
+
+		done := make(chan *backend.Backend, 2)
+		for range 2 {
+			go func() {
+				defer GinkgoRecover()
+				reserved, err := queue.Wait(context.Background(), candidates, first(queue))
+				Expect(err).NotTo(HaveOccurred())
+				done <- reserved
+			}()
+		}
+		Eventually(queue.Depth).Should(Equal(2))
+
+		b.DecrementConn()
+		queue.Release()
+		Eventually(done).Should(Receive(Equal(b)))
+		Consistently(done, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(b.ActiveConnections()).To(Equal(1))
+		Expect(queue.Depth()).To(Equal(1))
+
+		b.DecrementConn()
+		queue.Release()
+		Eventually(done).Should(Receive(Equal(b)))
+		Expect(b.ActiveConnections()).To(Equal(1))
+	})
+})
@@ -0,0 +1,35 @@
+// Package admission holds requests back while every backend they may go to
+// is full, instead of piling more onto a backend that is already saturated.
+//
+// A backend is full once it holds MaxInFlight requests, or all the
+// connections its own max_connections allows are busy. While all candidates
+// are full, up to MaxQueued requests wait for one to free up, each for at
+// most Timeout; the others are turned away at once. Release reports a finished request and
+// wakes the longest waiting request; every waiting request also looks again
+// periodically, for capacity freed some other way. A request is admitted by
+// reserving a connection with Reserve, which checks and takes it atomically,
+// so requests woken together cannot push a backend over its limit.
+//
+// Usage:
+//
+//	queue := admission.New(admission.Options{
+//		MaxInFlight: 100,
+//		MaxQueued:   1000,
+//		Timeout:     time.Second,
+//	})
+//
+//	b, err := queue.Wait(r.Context(), pool.Backends, func(backends []*backend.Backend) (*backend.Backend, error) {
+//		for _, b := range backends {
+//			if queue.Reserve(b) {
+//				return b, nil
+//			}
+//		}
+//		return nil, nil
+//	})
+//	if err != nil {
+//		// respond 503
+//	}
+//	...
+//	b.DecrementConn()
+//	queue.Release()
+package admission
@@ -0,0 +1,80 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrNotTLS is returned when probing the certificate of a plain HTTP backend.
+var ErrNotTLS = errors.New("backend does not use TLS")
+
+// observeCertificates is the transport's VerifyConnection hook: every
+// handshake, proxied or health check, records when the earliest certificate
+// the backend presented expires. It never rejects a connection.
+func (b *Backend) observeCertificates(state tls.ConnectionState) error {
+	b.recordCertificates(state)
+	return nil
+}
+
+func (b *Backend) recordCertificates(state tls.ConnectionState) {
+	var expiry time.Time
+	for _, cert := range state.PeerCertificates {
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	if expiry.IsZero() {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.certExpiry = expiry
+}
+
+// CertificateExpiry returns when the earliest certificate in the chain the
+// backend last presented expires. ok is false until a TLS handshake with the
+// backend has completed.
+func (b *Backend) CertificateExpiry() (expiry time.Time, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.certExpiry, !b.certExpiry.IsZero()
+}
+
+// ProbeCertificate completes a TLS handshake with the backend to refresh
+// CertificateExpiry. Pooled connections are kept open for a long time, so
+// without probing a renewed certificate may go unnoticed. The certificate is
+// read but not verified, so an expired or untrusted one is still recorded.
+func (b *Backend) ProbeCertificate(ctx context.Context) error {
+	if b.url.Scheme != "https" {
+		return ErrNotTLS
+	}
+
+	config := &tls.Config{}
+	if b.transport.TLSClientConfig != nil {
+		config = b.transport.TLSClientConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = b.url.Hostname()
+	}
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = nil
+
+	port := b.url.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(b.url.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	b.recordCertificates(conn.(*tls.Conn).ConnectionState())
+	return nil
+}
@@ -0,0 +1,57 @@
+package backend_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Certificates", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		DeferCleanup(server.Close)
+	})
+
+	It("should record the expiry when probed, even for an untrusted certificate", func() {
+		u, _ := url.Parse(server.URL)
+		b := backend.New(u, 1)
+
+		_, ok := b.CertificateExpiry()
+		Expect(ok).To(BeFalse())
+
+		Expect(b.ProbeCertificate(context.Background())).To(Succeed())
+		expiry, ok := b.CertificateExpiry()
+		Expect(ok).To(BeTrue())
+		Expect(expiry).To(BeTemporally("==", server.Certificate().NotAfter))
+	})
+
+	It("should record the expiry seen while proxying", func() {
+		u, _ := url.Parse(server.URL)
+		b := backend.New(u, 1)
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		b.Transport().TLSClientConfig.RootCAs = pool
+
+		rec := httptest.NewRecorder()
+		b.ReverseProxy().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		expiry, ok := b.CertificateExpiry()
+		Expect(ok).To(BeTrue())
+		Expect(expiry).To(BeTemporally("==", server.Certificate().NotAfter))
+	})
+
+	It("should not probe plain HTTP backends", func() {
+		u, _ := url.Parse("http://localhost:8081")
+		Expect(backend.New(u, 1).ProbeCertificate(context.Background())).To(MatchError(backend.ErrNotTLS))
+	})
+})
@@ -0,0 +1,60 @@
+package backend
+
+import "time"
+
+// minDecay keeps a decayed weight from shrinking towards zero, so a backend
+// always recovers within the recovery window of its last failure.
+const minDecay = 0.01
+
+// WithErrorDecay makes failures cost the backend weight instead of only
+// counting towards its circuit breaker. Each failure multiplies its decay
+// factor by factor, and successes let it grow back linearly to 1 over
+// recovery from the last failure. Weighted strategies scale the backend's
+// weight by its decay factor.
+func WithErrorDecay(factor float64, recovery time.Duration) Option {
+	return func(b *Backend) {
+		b.decayFactor = factor
+		b.decayRecovery = recovery
+	}
+}
+
+// Decay lowers the backend's decay factor after a failure at now. It does
+// nothing without WithErrorDecay.
+func (b *Backend) Decay(now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.decayFactor <= 0 {
+		return
+	}
+	b.decay = max(minDecay, b.decay*b.decayFactor)
+	b.decayedFrom = b.decay
+	b.decayedAt = now
+}
+
+// Recover raises the backend's decay factor after a success at now, as far
+// as the time since the last failure allows.
+func (b *Backend) Recover(now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.decay >= 1 {
+		return
+	}
+	elapsed := now.Sub(b.decayedAt)
+	if elapsed >= b.decayRecovery {
+		b.decay = 1
+		return
+	}
+	if elapsed > 0 {
+		b.decay = b.decayedFrom + (1-b.decayedFrom)*float64(elapsed)/float64(b.decayRecovery)
+	}
+}
+
+// DecayFactor returns the share of its weight the backend keeps after its
+// recent failures: 1 unless it failed since it last fully recovered.
+func (b *Backend) DecayFactor() float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.decay
+}
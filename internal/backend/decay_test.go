@@ -0,0 +1,70 @@
+package backend_test
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("ErrorDecay", func() {
+	u, _ := url.Parse("http://localhost:8081")
+
+	It("should multiply the factor by each failure and recover it over time on success", func() {
+		b := backend.New(u, 4, backend.WithErrorDecay(0.5, 10*time.Second))
+		now := time.Now()
+		Expect(b.DecayFactor()).To(Equal(1.0))
+
+		b.Decay(now)
+		b.Decay(now)
+		Expect(b.DecayFactor()).To(Equal(0.25))
+		Expect(b.Weight()).To(Equal(4))
+
+		b.Recover(now.Add(4 * time.Second))
+		Expect(b.DecayFactor()).To(BeNumerically("~", 0.55, 1e-9))
+
+		b.Recover(now.Add(10 * time.Second))
+		Expect(b.DecayFactor()).To(Equal(1.0))
+	})
+
+	It("should keep the reduced factor until a request succeeds", func() {
+		b := backend.New(u, 4, backend.WithErrorDecay(0.5, time.Second))
+		now := time.Now()
+		b.Decay(now)
+
+		Expect(b.DecayFactor()).To(Equal(0.5))
+		b.Recover(now.Add(time.Hour))
+		Expect(b.DecayFactor()).To(Equal(1.0))
+	})
+
+	It("should restart recovery from the latest failure", func() {
+		b := backend.New(u, 4, backend.WithErrorDecay(0.5, 10*time.Second))
+		now := time.Now()
+		b.Decay(now)
+		b.Recover(now.Add(5 * time.Second))
+		Expect(b.DecayFactor()).To(Equal(0.75))
+
+		b.Decay(now.Add(5 * time.Second))
+		Expect(b.DecayFactor()).To(Equal(0.375))
+		b.Recover(now.Add(5 * time.Second))
+		Expect(b.DecayFactor()).To(Equal(0.375))
+	})
+
+	It("should not decay below a floor", func() {
+		b := backend.New(u, 4, backend.WithErrorDecay(0.1, time.Second))
+		now := time.Now()
+		for range 10 {
+			b.Decay(now)
+		}
+		Expect(b.DecayFactor()).To(Equal(0.01))
+	})
+
+	It("should do nothing without the option", func() {
+		b := backend.New(u, 4)
+		b.Decay(time.Now())
+		Expect(b.DecayFactor()).To(Equal(1.0))
+	})
+})
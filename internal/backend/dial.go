@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"net"
+	"time"
+)
+
+// DefaultIdleConnTimeout is how long a backend's transport keeps a pooled
+// connection that no request uses, unless WithIdleConnTimeout sets another.
+const DefaultIdleConnTimeout = 90 * time.Second
+
+// WithIdleConnTimeout closes pooled connections to the backend once idle for
+// timeout, so connections a backend or middlebox silently dropped are not
+// reused and backends scaled down are not kept busy by the balancer. Zero
+// keeps idle connections until the backend closes them.
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(b *Backend) {
+		b.transport.IdleConnTimeout = timeout
+	}
+}
+
+// WithHappyEyeballs makes the backend's transport, and so its health checks,
+// give the address family its hostname resolves to first delay to connect
+// before racing the other family's addresses against it, as net.Dialer does
+// with FallbackDelay. The first connection made wins. Backends addressing an
+// IP dial it directly.
+func WithHappyEyeballs(delay time.Duration) Option {
+	return func(b *Backend) {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, FallbackDelay: delay}
+		b.transport.DialContext = b.conns.dial(dialer.DialContext)
+	}
+}
@@ -0,0 +1,62 @@
+package backend_test
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Happy eyeballs", func() {
+	var (
+		listener net.Listener
+		port     string
+	)
+
+	dial := func(host string) (net.Conn, error) {
+		u, err := url.Parse("http://" + net.JoinHostPort(host, port))
+		Expect(err).NotTo(HaveOccurred())
+		b := backend.New(u, 1, backend.WithHappyEyeballs(time.Second))
+		return b.Transport().DialContext(context.Background(), "tcp", u.Host)
+	}
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		_, port, _ = net.SplitHostPort(listener.Addr().String())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	It("should dial hostnames and IP literals", func() {
+		for _, host := range []string{"localhost", "127.0.0.1"} {
+			conn, err := dial(host)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.RemoteAddr().String()).To(Equal(listener.Addr().String()))
+			conn.Close()
+		}
+	})
+
+	It("should fail when no address connects", func() {
+		listener.Close()
+		_, err := dial("localhost")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Idle connection timeout", func() {
+	u, _ := url.Parse("http://localhost:8081")
+
+	It("should close idle connections after the default unless set", func() {
+		Expect(backend.New(u, 1).Transport().IdleConnTimeout).To(Equal(backend.DefaultIdleConnTimeout))
+		Expect(backend.New(u, 1, backend.WithIdleConnTimeout(time.Minute)).Transport().IdleConnTimeout).To(Equal(time.Minute))
+	})
+})
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// WithDrainTimeout bounds how long a drain waits for the requests in flight.
+// Once timeout has passed since the backend started draining, the
+// connections still open to it are closed, cutting off the requests that
+// have not completed. Zero waits for them however long they take.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(b *Backend) {
+		b.drainTimeout = timeout
+	}
+}
+
+// Drain stops new requests going to the backend on behalf of an operator
+// while those in flight complete, and cuts off those still in flight after
+// timeout rather than the backend's drain timeout. Draining a backend that
+// is already draining only sets the new deadline. Zero waits for the
+// requests however long they take.
+func (b *Backend) Drain(timeout time.Duration) (changed bool) {
+	return b.update(func() bool {
+		changed := b.draining&OwnerAdmin == 0
+		b.draining |= OwnerAdmin
+		b.armDrain(timeout)
+		return changed
+	})
+}
+
+// DrainDeadline returns when the current drain cuts off the requests still
+// in flight, and false when the backend is not draining or its drain waits
+// for them.
+func (b *Backend) DrainDeadline() (time.Time, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.drainDeadline, b.draining != 0 && !b.drainDeadline.IsZero()
+}
+
+// armDrain replaces the drain's deadline with one timeout from now. Callers
+// must hold the mutex.
+func (b *Backend) armDrain(timeout time.Duration) {
+	b.disarmDrain()
+	if timeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	b.drainDeadline = deadline
+	b.drainTimer = time.AfterFunc(timeout, func() { b.expireDrain(deadline) })
+}
+
+// disarmDrain clears the drain's deadline. Callers must hold the mutex.
+func (b *Backend) disarmDrain() {
+	if b.drainTimer != nil {
+		b.drainTimer.Stop()
+		b.drainTimer = nil
+	}
+	b.drainDeadline = time.Time{}
+}
+
+// expireDrain closes the backend's connections when the drain with deadline
+// is still going, unless it has ended or been given another deadline since.
+func (b *Backend) expireDrain(deadline time.Time) {
+	b.mutex.Lock()
+	current := b.draining != 0 && b.drainDeadline.Equal(deadline)
+	b.mutex.Unlock()
+
+	if current {
+		b.CloseConnections()
+	}
+}
+
+// CloseConnections closes every connection open to the backend, aborting
+// the requests and tunnels still using them, and returns how many it
+// closed.
+func (b *Backend) CloseConnections() int {
+	b.transport.CloseIdleConnections()
+	return b.conns.closeAll()
+}
+
+// Track makes a connection to the backend opened outside its transport, such
+// as a tunnel's, one that CloseConnections closes.
+func (b *Backend) Track(conn net.Conn) net.Conn {
+	tracked := &liveConn{Conn: conn, tracker: b.conns}
+	b.conns.remember(tracked)
+	return tracked
+}
+
+// liveConn is a tracked connection that is not counted as open.
+type liveConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+func (c *liveConn) Close() error {
+	c.once.Do(func() { c.tracker.forget(c) })
+	return c.Conn.Close()
+}
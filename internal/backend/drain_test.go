@@ -0,0 +1,97 @@
+package backend_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Drain", func() {
+	var (
+		server  *httptest.Server
+		release chan struct{}
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		DeferCleanup(server.Close)
+		DeferCleanup(func() { close(release) })
+	})
+
+	// inFlight proxies a request that hangs until release is closed and
+	// returns the status it ends with.
+	inFlight := func(b *backend.Backend) <-chan int {
+		done := make(chan int, 1)
+		go func() {
+			r, pe := backend.WithProxyErrorCapture(httptest.NewRequest(http.MethodGet, "/", nil))
+			w := httptest.NewRecorder()
+			b.ReverseProxy().ServeHTTP(w, r)
+			if pe.Err != nil {
+				done <- http.StatusBadGateway
+				return
+			}
+			done <- w.Code
+		}()
+		Eventually(b.OpenConnections).Should(Equal(1))
+		return done
+	}
+
+	It("should cut off the requests still in flight after the drain timeout", func() {
+		u, _ := url.Parse(server.URL)
+		b := backend.New(u, 1, backend.WithDrainTimeout(50*time.Millisecond))
+		b.SetHealthy(true)
+		done := inFlight(b)
+
+		Expect(b.SetDraining(true)).To(BeTrue())
+		Expect(b.State()).To(Equal(backend.StateDraining))
+		deadline, ok := b.DrainDeadline()
+		Expect(ok).To(BeTrue())
+		Expect(deadline).To(BeTemporally("~", time.Now().Add(50*time.Millisecond), 50*time.Millisecond))
+
+		Consistently(done, 30*time.Millisecond).ShouldNot(Receive())
+		Eventually(done).Should(Receive(Equal(http.StatusBadGateway)))
+		Expect(b.OpenConnections()).To(BeZero())
+	})
+
+	It("should wait for requests without a timeout and stop waiting once undrained", func() {
+		u, _ := url.Parse(server.URL)
+		b := backend.New(u, 1)
+		done := inFlight(b)
+
+		b.SetDraining(true)
+		_, ok := b.DrainDeadline()
+		Expect(ok).To(BeFalse())
+
+		Expect(b.Drain(30 * time.Millisecond)).To(BeFalse())
+		Expect(b.SetDraining(false)).To(BeTrue())
+		_, ok = b.DrainDeadline()
+		Expect(ok).To(BeFalse())
+		Consistently(done, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should close tracked connections made outside the transport", func() {
+		u, _ := url.Parse(server.URL)
+		b := backend.New(u, 1)
+		client, upstream := net.Pipe()
+		DeferCleanup(client.Close)
+		tracked := b.Track(upstream)
+
+		Expect(b.CloseConnections()).To(Equal(1))
+		_, err := tracked.Write([]byte("x"))
+		Expect(err).To(HaveOccurred())
+		Expect(b.CloseConnections()).To(BeZero())
+	})
+})
@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Failure kinds ClassifyFailure sorts a failed proxy attempt into.
+const (
+	FailureDial    = "dial"
+	FailureTimeout = "timeout"
+	FailureReset   = "reset"
+	FailureOther   = "other"
+)
+
+// ClassifyFailure tells why a proxy attempt got no response from the backend:
+// it could not be reached at all, it did not answer in time, or it dropped
+// the connection. Connections that fail to open count as dial failures even
+// when they time out.
+func ClassifyFailure(err error) string {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return FailureDial
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureDial
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return FailureTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "connection reset") {
+		return FailureReset
+	}
+
+	return FailureOther
+}
@@ -0,0 +1,60 @@
+package backend_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("ClassifyFailure", func() {
+	It("should classify a refused connection as a dial failure", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		addr := ln.Addr().String()
+		ln.Close()
+
+		_, err = http.Get("http://" + addr)
+		Expect(err).To(HaveOccurred())
+		Expect(backend.ClassifyFailure(err)).To(Equal(backend.FailureDial))
+	})
+
+	It("should classify a dial timeout as a dial failure", func() {
+		err := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+		Expect(backend.ClassifyFailure(err)).To(Equal(backend.FailureDial))
+	})
+
+	It("should classify a backend that does not answer in time as a timeout", func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer ln.Close()
+
+		client := &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond}}
+		_, err = client.Get("http://" + ln.Addr().String())
+		Expect(err).To(HaveOccurred())
+		Expect(backend.ClassifyFailure(err)).To(Equal(backend.FailureTimeout))
+
+		Expect(backend.ClassifyFailure(fmt.Errorf("proxy: %w", context.DeadlineExceeded))).
+			To(Equal(backend.FailureTimeout))
+	})
+
+	It("should classify dropped connections as resets", func() {
+		reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+		Expect(backend.ClassifyFailure(reset)).To(Equal(backend.FailureReset))
+		Expect(backend.ClassifyFailure(io.ErrUnexpectedEOF)).To(Equal(backend.FailureReset))
+	})
+
+	It("should classify anything else as other", func() {
+		Expect(backend.ClassifyFailure(errors.New("malformed HTTP response"))).To(Equal(backend.FailureOther))
+	})
+})
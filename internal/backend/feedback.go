@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HeaderLoad lets a backend advertise its utilisation as a number between
+	// 0 (idle) and 1 (saturated). Weighted strategies scale the backend's
+	// weight down accordingly.
+	HeaderLoad = "X-LB-Load"
+	// HeaderDrain lets a backend ask to be drained ("true") or put back into
+	// rotation ("false").
+	HeaderDrain = "X-LB-Drain"
+)
+
+// WithFeedback makes the backend honour the X-LB-Load and X-LB-Drain response
+// headers. The headers are consumed by the balancer and not forwarded to
+// clients.
+func WithFeedback() Option {
+	return func(b *Backend) {
+		b.feedback = true
+		next := b.proxy.ModifyResponse
+		b.proxy.ModifyResponse = func(res *http.Response) error {
+			b.applyFeedback(res.Header)
+			if next != nil {
+				return next(res)
+			}
+			return nil
+		}
+	}
+}
+
+// CheckFeedback applies the feedback headers of a passing health check's
+// response, nil for checks without one. Unless the response asks for it to
+// continue, a drain the backend asked for ends: a backend that drained
+// itself gets no more requests to answer with X-LB-Drain: false.
+func (b *Backend) CheckFeedback(h http.Header) {
+	if !b.feedback {
+		return
+	}
+	drain := h.Get(HeaderDrain)
+	b.applyFeedback(h)
+	if drain == "" {
+		b.setFeedbackDrain(false)
+	}
+}
+
+func (b *Backend) applyFeedback(h http.Header) {
+	if v := h.Get(HeaderLoad); v != "" {
+		if load, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && !math.IsNaN(load) {
+			b.SetReportedLoad(math.Max(0, math.Min(1, load)))
+		}
+		h.Del(HeaderLoad)
+	}
+
+	if v := h.Get(HeaderDrain); v != "" {
+		if drain, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			b.setFeedbackDrain(drain)
+		}
+		h.Del(HeaderDrain)
+	}
+}
+
+func (b *Backend) SetReportedLoad(load float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.reportedLoad = load
+	b.hasReportedLoad = true
+}
+
+// ReportedLoad returns the last load the backend advertised and whether it
+// has advertised one at all.
+func (b *Backend) ReportedLoad() (float64, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.reportedLoad, b.hasReportedLoad
+}
+
+// setFeedbackDrain starts a drain the backend asked for, or ends one. It
+// leaves drains started through SetDraining or Drain alone, so a backend
+// cannot undo a drain an operator decided on.
+func (b *Backend) setFeedbackDrain(draining bool) {
+	if draining {
+		b.Enter(OwnerFeedback, StateDraining)
+	} else {
+		b.Leave(OwnerFeedback, StateDraining)
+	}
+}
+
+// SetDraining starts or ends a drain on behalf of an operator. A drain it
+// starts is bounded by the drain timeout the backend was created with. It
+// leaves drains the backend asked for alone, so the backend stays drained
+// until it asks to be put back into rotation.
+func (b *Backend) SetDraining(draining bool) (changed bool) {
+	if draining {
+		return b.Enter(OwnerAdmin, StateDraining)
+	}
+	return b.Leave(OwnerAdmin, StateDraining)
+}
+
+func (b *Backend) IsDraining() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.draining != 0
+}
+
+// IsAvailable reports whether the backend may receive new requests: it must
+// be healthy, not draining or in maintenance and, if it is a standby,
+// activated.
+func (b *Backend) IsAvailable() bool {
+	return b.State().TakesTraffic()
+}
@@ -0,0 +1,151 @@
+package backend_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Feedback headers", func() {
+	var (
+		upstream *httptest.Server
+		headers  http.Header
+	)
+
+	proxy := func(b *backend.Backend) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		b.ReverseProxy().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	BeforeEach(func() {
+		headers = http.Header{}
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range headers {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	})
+
+	AfterEach(func() {
+		upstream.Close()
+	})
+
+	newBackend := func(opts ...backend.Option) *backend.Backend {
+		u, err := url.Parse(upstream.URL)
+		Expect(err).NotTo(HaveOccurred())
+		b := backend.New(u, 10, opts...)
+		b.SetHealthy(true)
+		return b
+	}
+
+	Context("with feedback enabled", func() {
+		It("should scale the weight by the reported load and strip the header", func() {
+			b := newBackend(backend.WithFeedback())
+			headers.Set(backend.HeaderLoad, "0.8")
+
+			w := proxy(b)
+
+			load, ok := b.ReportedLoad()
+			Expect(ok).To(BeTrue())
+			Expect(load).To(BeNumerically("~", 0.8, 0.001))
+			Expect(b.Weight()).To(Equal(2))
+			Expect(b.BaseWeight()).To(Equal(10))
+			Expect(w.Header().Get(backend.HeaderLoad)).To(BeEmpty())
+		})
+
+		It("should clamp out-of-range loads and never drop the weight below one", func() {
+			b := newBackend(backend.WithFeedback())
+			headers.Set(backend.HeaderLoad, "7")
+
+			proxy(b)
+
+			load, _ := b.ReportedLoad()
+			Expect(load).To(Equal(1.0))
+			Expect(b.Weight()).To(Equal(1))
+		})
+
+		It("should drain and undrain on request", func() {
+			b := newBackend(backend.WithFeedback())
+
+			headers.Set(backend.HeaderDrain, "true")
+			w := proxy(b)
+			Expect(b.IsDraining()).To(BeTrue())
+			Expect(b.IsAvailable()).To(BeFalse())
+			Expect(b.IsHealthy()).To(BeTrue())
+			Expect(w.Header().Get(backend.HeaderDrain)).To(BeEmpty())
+
+			headers.Set(backend.HeaderDrain, "false")
+			proxy(b)
+			Expect(b.IsDraining()).To(BeFalse())
+			Expect(b.IsAvailable()).To(BeTrue())
+		})
+
+		It("should leave drains an operator started alone, and be left its own", func() {
+			b := newBackend(backend.WithFeedback())
+			b.SetDraining(true)
+
+			headers.Set(backend.HeaderDrain, "false")
+			proxy(b)
+			b.CheckFeedback(nil)
+			Expect(b.IsDraining()).To(BeTrue())
+
+			headers.Set(backend.HeaderDrain, "true")
+			proxy(b)
+			b.SetDraining(false)
+			Expect(b.IsDraining()).To(BeTrue())
+			Expect(b.Holders(backend.StateDraining)).To(Equal(backend.OwnerFeedback))
+
+			headers.Set(backend.HeaderDrain, "false")
+			proxy(b)
+			Expect(b.IsDraining()).To(BeFalse())
+		})
+
+		It("should end its own drain on a passing health check that does not renew it", func() {
+			b := newBackend(backend.WithFeedback())
+			headers.Set(backend.HeaderDrain, "true")
+			proxy(b)
+
+			renew := http.Header{}
+			renew.Set(backend.HeaderDrain, "true")
+			b.CheckFeedback(renew)
+			Expect(b.IsDraining()).To(BeTrue())
+
+			b.CheckFeedback(http.Header{})
+			Expect(b.IsDraining()).To(BeFalse())
+		})
+
+		It("should ignore malformed values", func() {
+			b := newBackend(backend.WithFeedback())
+			headers.Set(backend.HeaderLoad, "busy")
+			headers.Set(backend.HeaderDrain, "maybe")
+
+			proxy(b)
+
+			_, ok := b.ReportedLoad()
+			Expect(ok).To(BeFalse())
+			Expect(b.IsDraining()).To(BeFalse())
+		})
+	})
+
+	Context("with feedback disabled", func() {
+		It("should pass the headers through untouched", func() {
+			b := newBackend()
+			headers.Set(backend.HeaderDrain, "true")
+
+			w := proxy(b)
+
+			Expect(b.IsDraining()).To(BeFalse())
+			Expect(w.Header().Get(backend.HeaderDrain)).To(Equal("true"))
+
+			b.CheckFeedback(headers)
+			Expect(b.IsDraining()).To(BeFalse())
+		})
+	})
+})
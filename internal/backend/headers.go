@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// HeaderBackendServer tells clients which backend served a response. The
+// balancer sets it; a backend's own value is dropped.
+const HeaderBackendServer = "X-Backend-Server"
+
+// reservedResponseHeaders are set by the balancer itself. Values sent by a
+// backend would otherwise be appended next to the balancer's own, or pass as
+// the balancer's when it sets none.
+var reservedResponseHeaders = []string{HeaderBackendServer, "X-LB-Error-Source"}
+
+// hopByHopHeaders only apply to a single connection (RFC 9110 section 7.6.1)
+// and must not be forwarded. Headers named in Connection are hop-by-hop too.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// singletonHeaders may appear only once (RFC 9110 section 5.3). Conflicting
+// values of the conflictingHeaders among them make a response ambiguous and
+// fail the attempt; for the others the first value wins.
+var (
+	singletonHeaders = []string{
+		"Age", "Content-Length", "Content-Location", "Content-Range", "Content-Type",
+		"Date", "Etag", "Expires", "Last-Modified", "Location", "Retry-After", "Server",
+	}
+	conflictingHeaders = map[string]bool{
+		"Content-Length": true, "Content-Range": true, "Content-Type": true, "Location": true,
+	}
+)
+
+// sanitizeResponse cleans a backend response before it is copied to the
+// client. The reverse proxy already strips hop-by-hop headers from regular
+// responses, but keeps all headers of a 101 Switching Protocols response.
+func sanitizeResponse(res *http.Response) error {
+	for _, name := range reservedResponseHeaders {
+		res.Header.Del(name)
+	}
+
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		upgrade := res.Header.Get("Upgrade")
+		removeHopByHop(res.Header)
+		if upgrade != "" {
+			res.Header.Set("Connection", "Upgrade")
+			res.Header.Set("Upgrade", upgrade)
+		}
+	}
+
+	for _, name := range singletonHeaders {
+		values := res.Header[name]
+		if len(values) < 2 {
+			continue
+		}
+		for _, v := range values[1:] {
+			if strings.TrimSpace(v) != strings.TrimSpace(values[0]) && conflictingHeaders[name] {
+				return fmt.Errorf("backend sent conflicting %s headers", name)
+			}
+		}
+		res.Header[name] = values[:1]
+	}
+
+	return nil
+}
+
+// removeHopByHop deletes the hop-by-hop headers and any header named in
+// Connection.
+func removeHopByHop(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
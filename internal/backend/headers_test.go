@@ -0,0 +1,141 @@
+package backend_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Header sanitization", func() {
+	var (
+		upstream *httptest.Server
+		received http.Header
+		respond  func(w http.ResponseWriter)
+		proxy    *httptest.Server
+		proxyErr *backend.ProxyError
+	)
+
+	BeforeEach(func() {
+		respond = func(w http.ResponseWriter) {}
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Clone()
+			respond(w)
+		}))
+		DeferCleanup(upstream.Close)
+
+		u, _ := url.Parse(upstream.URL)
+		b := backend.New(u, 1)
+		proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, proxyErr = backend.WithProxyErrorCapture(r)
+			b.ReverseProxy().ServeHTTP(w, r)
+		}))
+		DeferCleanup(proxy.Close)
+	})
+
+	get := func(header http.Header) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		res, err := http.DefaultTransport.RoundTrip(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(res.Body.Close)
+		return res
+	}
+
+	It("should not forward hop-by-hop request headers", func() {
+		get(http.Header{
+			"Connection":          {"X-Hop"},
+			"X-Hop":               {"secret"},
+			"Keep-Alive":          {"timeout=5"},
+			"Proxy-Authorization": {"Basic Zm9vOmJhcg=="},
+			"Te":                  {"trailers, gzip"},
+			"X-End-To-End":        {"kept"},
+		})
+
+		Expect(received).NotTo(HaveKey("X-Hop"))
+		Expect(received).NotTo(HaveKey("Keep-Alive"))
+		Expect(received).NotTo(HaveKey("Proxy-Authorization"))
+		Expect(received.Get("Te")).To(Equal("trailers"))
+		Expect(received.Get("X-End-To-End")).To(Equal("kept"))
+	})
+
+	It("should not forward hop-by-hop or reserved response headers", func() {
+		respond = func(w http.ResponseWriter) {
+			w.Header().Set("Connection", "X-Internal")
+			w.Header().Set("X-Internal", "secret")
+			w.Header().Set("Keep-Alive", "timeout=5")
+			w.Header().Set(backend.HeaderBackendServer, "spoofed")
+			w.Header().Set("X-LB-Error-Source", "lb")
+			w.Header().Set("X-End-To-End", "kept")
+		}
+
+		res := get(nil)
+		Expect(res.Header).NotTo(HaveKey("X-Internal"))
+		Expect(res.Header).NotTo(HaveKey("Keep-Alive"))
+		Expect(res.Header).NotTo(HaveKey(backend.HeaderBackendServer))
+		Expect(res.Header).NotTo(HaveKey("X-Lb-Error-Source"))
+		Expect(res.Header.Get("X-End-To-End")).To(Equal("kept"))
+	})
+
+	It("should collapse duplicate singleton response headers", func() {
+		respond = func(w http.ResponseWriter) {
+			w.Header()["Content-Type"] = []string{"text/plain", "text/plain"}
+			w.Header()["Server"] = []string{"app", "framework"}
+			w.Header()["Set-Cookie"] = []string{"a=1", "b=2"}
+		}
+
+		res := get(nil)
+		Expect(res.Header.Values("Content-Type")).To(Equal([]string{"text/plain"}))
+		Expect(res.Header.Values("Server")).To(Equal([]string{"app"}))
+		Expect(res.Header.Values("Set-Cookie")).To(Equal([]string{"a=1", "b=2"}))
+	})
+
+	It("should fail the attempt on conflicting framing or routing headers", func() {
+		respond = func(w http.ResponseWriter) {
+			w.Header()["Location"] = []string{"/a", "/b"}
+			w.WriteHeader(http.StatusFound)
+		}
+
+		get(nil)
+		Expect(proxyErr.Err).To(MatchError(ContainSubstring("conflicting Location")))
+	})
+
+	It("should keep only the upgrade headers of a 101 response", func() {
+		respond = func(w http.ResponseWriter) {
+			conn, rw, err := http.NewResponseController(w).Hijack()
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+				"Connection: Upgrade, X-Internal\r\n" +
+				"Upgrade: websocket\r\n" +
+				"X-Internal: secret\r\n" +
+				"Keep-Alive: timeout=5\r\n\r\n")
+			rw.Flush()
+		}
+
+		conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		Expect(req.Write(conn)).To(Succeed())
+
+		res, err := http.ReadResponse(bufio.NewReader(conn), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		Expect(res.Header.Get("Upgrade")).To(Equal("websocket"))
+		Expect(res.Header.Get("Connection")).To(Equal("Upgrade"))
+		Expect(res.Header).NotTo(HaveKey("X-Internal"))
+		Expect(res.Header).NotTo(HaveKey("Keep-Alive"))
+	})
+})
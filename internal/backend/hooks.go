@@ -0,0 +1,103 @@
+package backend
+
+import "time"
+
+// OnAdd registers fn to run for every backend that joins the pool, after the
+// snapshot including it is in place. Membership hooks run one update at a
+// time and must not update the pool themselves.
+func (p *Pool) OnAdd(fn func(b *Backend)) {
+	p.hooksMutex.Lock()
+	defer p.hooksMutex.Unlock()
+	p.onAdd = append(p.onAdd, fn)
+}
+
+// OnRemove registers fn to run for every backend that leaves the pool.
+func (p *Pool) OnRemove(fn func(b *Backend)) {
+	p.hooksMutex.Lock()
+	defer p.hooksMutex.Unlock()
+	p.onRemove = append(p.onRemove, fn)
+}
+
+// OnHealthChange registers fn to run whenever the effective health of a
+// member changes, whether through a health check or a health override. It
+// runs on the goroutine that made the change.
+func (p *Pool) OnHealthChange(fn func(b *Backend, healthy bool)) {
+	p.hooksMutex.Lock()
+	defer p.hooksMutex.Unlock()
+	p.onHealth = append(p.onHealth, fn)
+}
+
+// OnStateChange registers fn to run whenever the State of a member changes.
+// Like health changes it runs on the goroutine that made the change, or on a
+// timer goroutine when a slow start ends.
+func (p *Pool) OnStateChange(fn func(b *Backend, from, to State)) {
+	p.hooksMutex.Lock()
+	defer p.hooksMutex.Unlock()
+	p.onState = append(p.onState, fn)
+}
+
+func (p *Pool) added(b *Backend) {
+	p.hooksMutex.RLock()
+	hooks := p.onAdd
+	p.hooksMutex.RUnlock()
+
+	for _, fn := range hooks {
+		fn(b)
+	}
+}
+
+func (p *Pool) removed(b *Backend) {
+	p.hooksMutex.RLock()
+	hooks := p.onRemove
+	p.hooksMutex.RUnlock()
+
+	for _, fn := range hooks {
+		fn(b)
+	}
+}
+
+// status is what pool hooks are told about a backend.
+type status struct {
+	healthy bool
+	state   State
+}
+
+func (p *Pool) changed(b *Backend, before, after status) {
+	p.hooksMutex.RLock()
+	onHealth, onState := p.onHealth, p.onState
+	p.hooksMutex.RUnlock()
+
+	if before.healthy != after.healthy {
+		for _, fn := range onHealth {
+			fn(b, after.healthy)
+		}
+	}
+	if before.state != after.state {
+		for _, fn := range onState {
+			fn(b, before.state, after.state)
+		}
+	}
+}
+
+func (b *Backend) setWatcher(fn func(b *Backend, before, after status)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.watcher = fn
+}
+
+// update applies change under the mutex and reports the backend's health and
+// state before and after to the pool watching it.
+func (b *Backend) update(change func() bool) (changed bool) {
+	b.mutex.Lock()
+	now := time.Now()
+	before := status{healthy: b.healthy(), state: b.state(now)}
+	changed = change()
+	after := status{healthy: b.healthy(), state: b.state(now)}
+	watcher := b.watcher
+	b.mutex.Unlock()
+
+	if watcher != nil && before != after {
+		watcher(b, before, after)
+	}
+	return changed
+}
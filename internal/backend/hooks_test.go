@@ -0,0 +1,78 @@
+package backend_test
+
+import (
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Pool hooks", func() {
+	var (
+		first, second *backend.Backend
+		pool          *backend.Pool
+	)
+
+	BeforeEach(func() {
+		u, _ := url.Parse("http://localhost:8081")
+		first = backend.New(u, 1)
+		u, _ = url.Parse("http://localhost:8082")
+		second = backend.New(u, 1)
+		pool = backend.NewPool([]*backend.Backend{first})
+	})
+
+	It("should run membership hooks for the backends that joined or left", func() {
+		var added, removed []*backend.Backend
+		pool.OnAdd(func(b *backend.Backend) {
+			Expect(pool.Backends()).To(ContainElement(b))
+			added = append(added, b)
+		})
+		pool.OnRemove(func(b *backend.Backend) { removed = append(removed, b) })
+
+		pool.Add(second)
+		Expect(added).To(Equal([]*backend.Backend{second}))
+
+		pool.Update(func([]*backend.Backend) []*backend.Backend {
+			return []*backend.Backend{second}
+		})
+		Expect(added).To(Equal([]*backend.Backend{second}))
+		Expect(removed).To(Equal([]*backend.Backend{first}))
+
+		Expect(pool.Remove(first)).To(BeFalse())
+		Expect(removed).To(HaveLen(1))
+	})
+
+	It("should report changes of effective health from checks and overrides", func() {
+		type change struct {
+			backend *backend.Backend
+			healthy bool
+		}
+		var changes []change
+		pool.OnHealthChange(func(b *backend.Backend, healthy bool) {
+			changes = append(changes, change{b, healthy})
+		})
+
+		first.SetHealthy(true)
+		first.SetHealthy(true)
+		first.SetHealthOverride(backend.OverrideHealthy)
+		first.SetHealthy(false)
+		first.SetHealthOverride(backend.OverrideNone)
+
+		Expect(changes).To(Equal([]change{{first, true}, {first, false}}))
+	})
+
+	It("should only report health changes of members", func() {
+		var reported []*backend.Backend
+		pool.OnHealthChange(func(b *backend.Backend, _ bool) { reported = append(reported, b) })
+
+		second.SetHealthy(true)
+		pool.Add(second)
+		pool.Remove(first)
+		first.SetHealthy(true)
+		second.SetHealthy(false)
+
+		Expect(reported).To(Equal([]*backend.Backend{second}))
+	})
+})
@@ -0,0 +1,73 @@
+package backend
+
+// WithMaxInFlight caps the requests the backend handles at once: a backend
+// holding n requests is not selected until one ends. Zero means no limit.
+func WithMaxInFlight(n int) Option {
+	return func(b *Backend) {
+		b.maxInFlight = n
+	}
+}
+
+// MaxInFlight returns the backend's in-flight cap, zero when unlimited.
+func (b *Backend) MaxInFlight() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.maxInFlight
+}
+
+// AtInFlightLimit reports whether the backend holds as many requests as
+// WithMaxInFlight allows, or has no connection left under
+// WithMaxConnections.
+func (b *Backend) AtInFlightLimit() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.atInFlightLimit()
+}
+
+func (b *Backend) atInFlightLimit() bool {
+	return b.maxInFlight > 0 && b.activeConnections >= b.maxInFlight ||
+		b.atConnectionLimit()
+}
+
+// atConnectionLimit reports whether another request would have to open a
+// connection beyond WithMaxConnections: every open connection is busy and
+// there are as many as it allows. Over HTTP/1 a request holds a connection
+// of its own, so the requests reserved but not yet connected count too.
+// Once the backend speaks HTTP/2, requests share its connections and only
+// WithMaxInFlight caps them.
+func (b *Backend) atConnectionLimit() bool {
+	if b.maxConnections <= 0 || b.conns.shared.Load() > 0 {
+		return false
+	}
+	return b.activeConnections >= b.maxConnections ||
+		b.conns.open.Load() >= int64(b.maxConnections) && b.conns.idle.Load() == 0
+}
+
+// TryIncrementConn reserves a connection like IncrementConn unless the
+// backend is at its in-flight cap or connection limit, and reports whether
+// it did.
+func (b *Backend) TryIncrementConn() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.atInFlightLimit() {
+		return false
+	}
+	b.activeConnections++
+	return true
+}
+
+// TryIncrementConnBelow reserves a connection like TryIncrementConn unless
+// the backend also holds limit requests, and reports whether it did.
+// Checking and reserving at once keeps concurrent callers from going over
+// either.
+func (b *Backend) TryIncrementConnBelow(limit int) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.atInFlightLimit() || b.activeConnections >= limit {
+		return false
+	}
+	b.activeConnections++
+	return true
+}
@@ -0,0 +1,22 @@
+package backend
+
+import "maps"
+
+// WithLabels attaches key/value labels to the backend, such as the
+// deployment color a blue/green traffic shift selects backends by.
+func WithLabels(labels map[string]string) Option {
+	return func(b *Backend) {
+		b.labels = maps.Clone(labels)
+	}
+}
+
+// Labels returns a copy of the backend's labels.
+func (b *Backend) Labels() map[string]string {
+	return maps.Clone(b.labels)
+}
+
+// HasLabel reports whether the backend carries the label key with value.
+func (b *Backend) HasLabel(key, value string) bool {
+	v, ok := b.labels[key]
+	return ok && v == value
+}
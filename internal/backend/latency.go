@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"math"
+	"time"
+)
+
+// The latency window holds the last latencySamples response times of a
+// backend, of which those recorded within latencyWindow count towards its
+// percentiles. Percentiles need minLatencySamples such responses, so a single
+// slow one does not make a backend look slow.
+const (
+	latencySamples    = 128
+	latencyWindow     = 30 * time.Second
+	minLatencySamples = 10
+)
+
+// Response times are counted in buckets growing by latencyGrowth from a
+// microsecond, so a percentile is read off the counts within about 4% of
+// the exact one, without sorting. Times beyond the last bucket, about a
+// minute and a half, count in it.
+const (
+	latencyBuckets = 240
+	latencyGrowth  = 1.08
+)
+
+var logLatencyGrowth = math.Log(latencyGrowth)
+
+type latencySample struct {
+	bucket uint8
+	at     time.Time
+}
+
+// latencies is a ring of the most recent response times with a histogram of
+// the ones still in the window. The histogram is kept up to date as samples
+// enter and leave, so reading a percentile costs a walk over its buckets.
+type latencies struct {
+	samples [latencySamples]latencySample
+	next    int
+	count   int
+	buckets [latencyBuckets]uint8
+}
+
+func (l *latencies) add(d time.Duration, now time.Time) {
+	if l.count == latencySamples {
+		l.buckets[l.samples[l.next].bucket]--
+		l.count--
+	}
+	b := latencyBucket(d)
+	l.samples[l.next] = latencySample{bucket: b, at: now}
+	l.buckets[b]++
+	l.next = (l.next + 1) % latencySamples
+	l.count++
+}
+
+// expire drops the samples recorded before the window, oldest first.
+func (l *latencies) expire(now time.Time) {
+	for l.count > 0 {
+		oldest := &l.samples[(l.next-l.count+latencySamples)%latencySamples]
+		if now.Sub(oldest.at) <= latencyWindow {
+			return
+		}
+		l.buckets[oldest.bucket]--
+		l.count--
+	}
+}
+
+func (l *latencies) percentile(q float64, now time.Time) (time.Duration, bool) {
+	l.expire(now)
+	if l.count < minLatencySamples {
+		return 0, false
+	}
+
+	rank := max(int(math.Ceil(q*float64(l.count))), 1)
+	seen := 0
+	for b, n := range l.buckets {
+		seen += int(n)
+		if seen >= rank {
+			return latencyOf(b), true
+		}
+	}
+	return latencyOf(latencyBuckets - 1), true
+}
+
+// latencyBucket returns the bucket counting d: bucket i holds the times
+// above latencyGrowth^(i-1) and up to latencyGrowth^i microseconds.
+func latencyBucket(d time.Duration) uint8 {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	return uint8(min(int(math.Ceil(math.Log(us)/logLatencyGrowth)), latencyBuckets-1))
+}
+
+// latencyOf returns the geometric middle of bucket b.
+func latencyOf(b int) time.Duration {
+	return time.Duration(math.Pow(latencyGrowth, float64(b)-0.5) * float64(time.Microsecond))
+}
+
+// LatencyPercentile returns an estimate of the response time below which the
+// fraction q of the backend's recent responses completed, e.g. 0.95 for its
+// P95, within about 4%. Unlike EWMATime it shows a slow minority of
+// responses. ok is false until enough responses were recorded recently.
+func (b *Backend) LatencyPercentile(q float64) (d time.Duration, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.latencies.percentile(q, time.Now())
+}
@@ -0,0 +1,68 @@
+package backend_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("LatencyPercentile", func() {
+	var b *backend.Backend
+
+	BeforeEach(func() {
+		u, _ := url.Parse("http://localhost:8081")
+		b = backend.New(u, 1)
+	})
+
+	It("should need enough recent responses", func() {
+		for range 9 {
+			b.RecordResponse(time.Second)
+		}
+		_, ok := b.LatencyPercentile(0.95)
+		Expect(ok).To(BeFalse())
+
+		b.RecordResponse(time.Second)
+		p95, ok := b.LatencyPercentile(0.95)
+		Expect(ok).To(BeTrue())
+		Expect(p95).To(BeNumerically("~", time.Second, time.Second/25))
+	})
+
+	It("should show a slow minority the average hides", func() {
+		for i := range 100 {
+			if i%10 == 0 {
+				b.RecordResponse(time.Second)
+			} else {
+				b.RecordResponse(10 * time.Millisecond)
+			}
+		}
+		p50, _ := b.LatencyPercentile(0.5)
+		p95, _ := b.LatencyPercentile(0.95)
+		Expect(p50).To(BeNumerically("~", 10*time.Millisecond, 10*time.Millisecond/25))
+		Expect(p95).To(BeNumerically("~", time.Second, time.Second/25))
+	})
+
+	It("should only keep the most recent responses", func() {
+		for range 200 {
+			b.RecordResponse(time.Second)
+		}
+		for range 128 {
+			b.RecordResponse(10 * time.Millisecond)
+		}
+		p95, _ := b.LatencyPercentile(0.95)
+		Expect(p95).To(BeNumerically("~", 10*time.Millisecond, 10*time.Millisecond/25))
+	})
+
+	It("should read percentiles without allocating", func() {
+		for i := range 128 {
+			b.RecordResponse(time.Duration(i+1) * time.Millisecond)
+		}
+		p50, _ := b.LatencyPercentile(0.5)
+		Expect(p50).To(BeNumerically("~", 64*time.Millisecond, 64*time.Millisecond/25))
+		Expect(testing.AllocsPerRun(100, func() { b.LatencyPercentile(0.95) })).To(BeZero())
+	})
+})
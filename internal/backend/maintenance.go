@@ -0,0 +1,18 @@
+package backend
+
+// SetMaintenance takes the backend out of rotation for maintenance on behalf
+// of an operator, or ends the operator's maintenance. Unlike draining, which
+// backends request themselves, maintenance is decided by the balancer and is
+// not cleared by feedback. Maintenance a schedule started is left alone.
+func (b *Backend) SetMaintenance(on bool) (changed bool) {
+	if on {
+		return b.Enter(OwnerAdmin, StateMaintenance)
+	}
+	return b.Leave(OwnerAdmin, StateMaintenance)
+}
+
+func (b *Backend) InMaintenance() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.maintenance != 0
+}
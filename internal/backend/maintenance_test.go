@@ -0,0 +1,27 @@
+package backend_test
+
+import (
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Maintenance", func() {
+	It("should take a healthy backend out of rotation until maintenance ends", func() {
+		u, _ := url.Parse("http://localhost:8081")
+		b := backend.New(u, 1)
+		b.SetHealthy(true)
+
+		Expect(b.SetMaintenance(true)).To(BeTrue())
+		Expect(b.SetMaintenance(true)).To(BeFalse())
+		Expect(b.InMaintenance()).To(BeTrue())
+		Expect(b.IsHealthy()).To(BeTrue())
+		Expect(b.IsAvailable()).To(BeFalse())
+
+		Expect(b.SetMaintenance(false)).To(BeTrue())
+		Expect(b.IsAvailable()).To(BeTrue())
+	})
+})
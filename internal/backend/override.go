@@ -0,0 +1,52 @@
+package backend
+
+// HealthOverride pins a backend's health regardless of health check results.
+type HealthOverride int
+
+const (
+	OverrideNone HealthOverride = iota
+	OverrideHealthy
+	OverrideUnhealthy
+)
+
+func (o HealthOverride) String() string {
+	switch o {
+	case OverrideHealthy:
+		return "healthy"
+	case OverrideUnhealthy:
+		return "unhealthy"
+	default:
+		return ""
+	}
+}
+
+// SetHealthOverride forces the backend healthy or unhealthy. Health checks
+// keep running underneath, so clearing the override with OverrideNone
+// restores the last probed state.
+func (b *Backend) SetHealthOverride(o HealthOverride) (changed bool) {
+	return b.update(func() bool {
+		if b.healthOverride == o {
+			return false
+		}
+		b.healthOverride = o
+		return true
+	})
+}
+
+func (b *Backend) HealthOverride() HealthOverride {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.healthOverride
+}
+
+// healthy returns the effective health; callers must hold the mutex.
+func (b *Backend) healthy() bool {
+	switch b.healthOverride {
+	case OverrideHealthy:
+		return true
+	case OverrideUnhealthy:
+		return false
+	default:
+		return b.isHealthy
+	}
+}
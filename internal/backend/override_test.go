@@ -0,0 +1,46 @@
+package backend_test
+
+import (
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Health override", func() {
+	var b *backend.Backend
+
+	BeforeEach(func() {
+		u, _ := url.Parse("http://localhost:8081")
+		b = backend.New(u, 1)
+	})
+
+	It("should follow health checks without an override", func() {
+		b.SetHealthy(true)
+		Expect(b.IsHealthy()).To(BeTrue())
+		b.SetHealthy(false)
+		Expect(b.IsHealthy()).To(BeFalse())
+	})
+
+	It("should pin the effective health", func() {
+		b.SetHealthy(true)
+		Expect(b.SetHealthOverride(backend.OverrideUnhealthy)).To(BeTrue())
+		Expect(b.IsHealthy()).To(BeFalse())
+		Expect(b.IsAvailable()).To(BeFalse())
+
+		Expect(b.SetHealthOverride(backend.OverrideHealthy)).To(BeTrue())
+		b.SetHealthy(false)
+		Expect(b.IsAvailable()).To(BeTrue())
+	})
+
+	It("should restore the probed state when cleared", func() {
+		b.SetHealthOverride(backend.OverrideHealthy)
+		b.SetHealthy(false)
+
+		Expect(b.SetHealthOverride(backend.OverrideNone)).To(BeTrue())
+		Expect(b.IsHealthy()).To(BeFalse())
+		Expect(b.SetHealthOverride(backend.OverrideNone)).To(BeFalse())
+	})
+})
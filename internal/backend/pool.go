@@ -0,0 +1,86 @@
+package backend
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool holds the current set of backends as an immutable snapshot. Readers
+// take the snapshot with Backends and range over it without locking; updates
+// build a new slice and swap it in, so a snapshot already taken never
+// changes. Snapshots must not be modified.
+type Pool struct {
+	// mutex serializes updates; readers never take it.
+	mutex    sync.Mutex
+	snapshot atomic.Pointer[[]*Backend]
+
+	hooksMutex sync.RWMutex
+	onAdd      []func(b *Backend)
+	onRemove   []func(b *Backend)
+	onHealth   []func(b *Backend, healthy bool)
+	onState    []func(b *Backend, from, to State)
+}
+
+// NewPool returns a pool of backends. A backend reports health and state
+// changes to the last pool it was put in.
+func NewPool(backends []*Backend) *Pool {
+	p := &Pool{}
+	for _, b := range backends {
+		b.setWatcher(p.changed)
+	}
+	p.store(slices.Clone(backends))
+	return p
+}
+
+// Backends returns the current snapshot.
+func (p *Pool) Backends() []*Backend {
+	return *p.snapshot.Load()
+}
+
+// Update replaces the snapshot with what fn returns for a copy of the
+// current one, then runs the OnAdd and OnRemove hooks for the backends that
+// joined or left.
+func (p *Pool) Update(fn func(backends []*Backend) []*Backend) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	before := p.Backends()
+	after := fn(slices.Clone(before))
+	p.store(after)
+
+	for _, b := range before {
+		if !slices.Contains(after, b) {
+			b.setWatcher(nil)
+			p.removed(b)
+		}
+	}
+	for _, b := range after {
+		if !slices.Contains(before, b) {
+			b.setWatcher(p.changed)
+			p.added(b)
+		}
+	}
+}
+
+// Add appends b to the pool.
+func (p *Pool) Add(b *Backend) {
+	p.Update(func(backends []*Backend) []*Backend {
+		return append(backends, b)
+	})
+}
+
+// Remove takes b out of the pool. It reports false when b was not in it.
+func (p *Pool) Remove(b *Backend) (removed bool) {
+	p.Update(func(backends []*Backend) []*Backend {
+		before := len(backends)
+		backends = slices.DeleteFunc(backends, func(other *Backend) bool { return other == b })
+		removed = len(backends) < before
+		return backends
+	})
+	return removed
+}
+
+func (p *Pool) store(backends []*Backend) {
+	p.snapshot.Store(&backends)
+}
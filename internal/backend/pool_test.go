@@ -0,0 +1,63 @@
+package backend_test
+
+import (
+	"net/url"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Pool", func() {
+	newBackend := func(rawURL string) *backend.Backend {
+		u, _ := url.Parse(rawURL)
+		return backend.New(u, 1)
+	}
+
+	It("should keep a snapshot unchanged by later updates", func() {
+		first := newBackend("http://localhost:8081")
+		second := newBackend("http://localhost:8082")
+		configured := []*backend.Backend{first}
+		pool := backend.NewPool(configured)
+
+		snapshot := pool.Backends()
+		pool.Add(second)
+		configured[0] = second
+
+		Expect(snapshot).To(Equal([]*backend.Backend{first}))
+		Expect(pool.Backends()).To(Equal([]*backend.Backend{first, second}))
+
+		Expect(pool.Remove(first)).To(BeTrue())
+		Expect(pool.Remove(first)).To(BeFalse())
+		Expect(pool.Backends()).To(Equal([]*backend.Backend{second}))
+		Expect(snapshot).To(Equal([]*backend.Backend{first}))
+	})
+
+	It("should let readers range over snapshots while backends are added and removed", func() {
+		pool := backend.NewPool(nil)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				b := newBackend("http://localhost:8081")
+				pool.Add(b)
+				pool.Remove(b)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				for _, b := range pool.Backends() {
+					Expect(b).NotTo(BeNil())
+				}
+			}
+		}()
+		wg.Wait()
+
+		Expect(pool.Backends()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,93 @@
+package backend
+
+// DefaultPriority is the tier of backends created without WithPriority.
+const DefaultPriority = 1
+
+// WithPriority places the backend in a failover tier. Lower tiers are
+// preferred: a backend only receives traffic while every backend of the
+// tiers before it is unavailable or at capacity. Values below 1 keep
+// DefaultPriority.
+func WithPriority(priority int) Option {
+	return func(b *Backend) {
+		if priority >= 1 {
+			b.priority = priority
+		}
+	}
+}
+
+// WithMaxConnections caps the upstream connections the backend's transport
+// opens: a backend whose n connections are all busy is not selected until
+// one frees up, and its tier counts as over capacity once all its backends
+// are. Zero means no limit.
+func WithMaxConnections(n int) Option {
+	return func(b *Backend) {
+		b.maxConnections = n
+	}
+}
+
+// WithZone records the availability zone or locality the backend runs in,
+// so a balancer in the same zone can prefer it.
+func WithZone(zone string) Option {
+	return func(b *Backend) {
+		b.zone = zone
+	}
+}
+
+func (b *Backend) Priority() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.priority
+}
+
+// Zone returns the backend's zone, empty when none was configured.
+func (b *Backend) Zone() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.zone
+}
+
+// AtCapacity reports whether another request would need a connection beyond
+// WithMaxConnections, or the backend holds as many requests as
+// WithMaxInFlight allows.
+func (b *Backend) AtCapacity() bool {
+	return b.AtInFlightLimit()
+}
+
+// Placement is a backend's failover tier and zone and the limits on the
+// connections it takes, as WithPriority, WithZone, WithMaxConnections and
+// WithMaxInFlight set them.
+type Placement struct {
+	Priority       int
+	Zone           string
+	MaxConnections int
+	MaxInFlight    int
+}
+
+// Placement returns the backend's tier, zone and limits.
+func (b *Backend) Placement() Placement {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return Placement{
+		Priority:       b.priority,
+		Zone:           b.zone,
+		MaxConnections: b.maxConnections,
+		MaxInFlight:    b.maxInFlight,
+	}
+}
+
+// SetPlacement moves the backend to the tier and zone of p and applies its
+// limits, e.g. when discovery reports new settings for it, and reports
+// whether any changed. Requests it holds beyond lowered limits run to the
+// end; it takes no new ones until below them.
+func (b *Backend) SetPlacement(p Placement) bool {
+	if p.Priority < 1 {
+		p.Priority = DefaultPriority
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	changed := b.priority != p.Priority || b.zone != p.Zone ||
+		b.maxConnections != p.MaxConnections || b.maxInFlight != p.MaxInFlight
+	b.priority, b.zone, b.maxConnections, b.maxInFlight = p.Priority, p.Zone, p.MaxConnections, p.MaxInFlight
+	return changed
+}
@@ -0,0 +1,69 @@
+package backend_test
+
+import (
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Priority", func() {
+	u, _ := url.Parse("http://localhost:8081")
+
+	It("should default to the first tier", func() {
+		Expect(backend.New(u, 1).Priority()).To(Equal(backend.DefaultPriority))
+		Expect(backend.New(u, 1, backend.WithPriority(0)).Priority()).To(Equal(backend.DefaultPriority))
+		Expect(backend.New(u, 1, backend.WithPriority(2)).Priority()).To(Equal(2))
+	})
+
+	It("should be at capacity once it holds its maximum connections", func() {
+		b := backend.New(u, 1, backend.WithMaxConnections(2))
+		b.IncrementConn()
+		Expect(b.AtCapacity()).To(BeFalse())
+		b.IncrementConn()
+		Expect(b.AtCapacity()).To(BeTrue())
+		b.DecrementConn()
+		Expect(b.AtCapacity()).To(BeFalse())
+
+		unlimited := backend.New(u, 1)
+		unlimited.IncrementConn()
+		Expect(unlimited.AtCapacity()).To(BeFalse())
+	})
+
+	It("should not reserve beyond its maximum connections", func() {
+		b := backend.New(u, 1, backend.WithMaxConnections(1))
+		Expect(b.TryIncrementConn()).To(BeTrue())
+		Expect(b.TryIncrementConn()).To(BeFalse())
+		Expect(b.ActiveConnections()).To(Equal(1))
+	})
+
+	It("should apply a new placement and report whether it changed", func() {
+		b := backend.New(u, 1, backend.WithZone("eu-west-1a"))
+		Expect(b.SetPlacement(backend.Placement{Zone: "eu-west-1a"})).To(BeFalse())
+
+		Expect(b.TryIncrementConn()).To(BeTrue())
+		Expect(b.SetPlacement(backend.Placement{Priority: 2, Zone: "eu-west-1b", MaxInFlight: 1})).To(BeTrue())
+		Expect(b.Priority()).To(Equal(2))
+		Expect(b.Zone()).To(Equal("eu-west-1b"))
+		Expect(b.TryIncrementConn()).To(BeFalse())
+	})
+
+	It("should only reserve below its in-flight limit", func() {
+		b := backend.New(u, 1, backend.WithMaxInFlight(1))
+		Expect(b.MaxInFlight()).To(Equal(1))
+		Expect(b.TryIncrementConn()).To(BeTrue())
+		Expect(b.AtInFlightLimit()).To(BeTrue())
+		Expect(b.AtCapacity()).To(BeTrue())
+		Expect(b.TryIncrementConn()).To(BeFalse())
+		Expect(b.ActiveConnections()).To(Equal(1))
+
+		b.DecrementConn()
+		Expect(b.TryIncrementConn()).To(BeTrue())
+
+		unlimited := backend.New(u, 1)
+		Expect(unlimited.TryIncrementConn()).To(BeTrue())
+		Expect(unlimited.AtInFlightLimit()).To(BeFalse())
+	})
+})
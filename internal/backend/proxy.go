@@ -2,6 +2,8 @@ package backend
 
 import (
 	"context"
+	"crypto/tls"
+	"math"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -11,21 +13,59 @@ import (
 
 type Backend struct {
 	url               *url.URL
+	name              string
+	origin            string
+	host              string
 	proxy             *httputil.ReverseProxy
+	transport         *http.Transport
+	conns             *connTracker
 	mutex             sync.Mutex
 	isHealthy         bool
 	activeConnections int
 	weight            int
+	configuredWeight  int
+	heldWeights       map[Owner]int
 	ewmaResponseTime  time.Duration
 	hasEWMA           bool
+	latencies         latencies
+	completed         uint64
+	reportedLoad      float64
+	hasReportedLoad   bool
+	draining          Owner
+	feedback          bool
+	drainTimeout      time.Duration
+	drainDeadline     time.Time
+	drainTimer        *time.Timer
+	healthOverride    HealthOverride
+	checkOutput       string
+	skippedChecks     uint64
+	standby           bool
+	standbyActive     bool
+	maintenance       Owner
+	certExpiry        time.Time
+	slowStart         time.Duration
+	recoveredAt       time.Time
+	priority          int
+	maxConnections    int
+	maxInFlight       int
+	zone              string
+	remote            bool
+	decay             float64
+	decayFactor       float64
+	decayRecovery     time.Duration
+	decayedFrom       float64
+	decayedAt         time.Time
+	labels            map[string]string
+	shift             float64
+	watcher           func(b *Backend, before, after status)
 }
 
-type proxyErrorKeyType struct {}
+type proxyErrorKeyType struct{}
 
 var proxyErrorKey = proxyErrorKeyType{}
 
 type ProxyError struct {
-	Err        error
+	Err error
 }
 
 const ewmaAlpha = 0.2
@@ -39,15 +79,15 @@ func (bp *bufferPool) Get() []byte {
 }
 
 func (bp *bufferPool) Put(b []byte) {
-    bp.pool.Put(b)
+	bp.pool.Put(b)
 }
 
 var sharedBufferPool = &bufferPool{
-    pool: &sync.Pool{
-        New: func() interface{} {
-            return make([]byte, 32*1024)
-        },
-    },
+	pool: &sync.Pool{
+		New: func() interface{} {
+			return make([]byte, 32*1024)
+		},
+	},
 }
 
 func (b *Backend) ReverseProxy() *httputil.ReverseProxy {
@@ -78,27 +118,91 @@ func (b *Backend) URL() *url.URL {
 	return b.url
 }
 
+// Name returns the backend's stable identity, used to key circuit breakers,
+// metrics and hash ring positions. It defaults to the URL, so only backends
+// given a name keep their identity when their address changes.
+func (b *Backend) Name() string {
+	return b.name
+}
+
+// Origin returns the configured URL this backend was created from. It equals
+// URL().String() unless the backend was expanded from a DNS name.
+func (b *Backend) Origin() string {
+	return b.origin
+}
+
+// Host returns the Host header health checks send: the host of the URL,
+// unless the backend addresses an IP its hostname resolved to.
+func (b *Backend) Host() string {
+	if b.host != "" {
+		return b.host
+	}
+	return b.url.Host
+}
+
+// Transport returns the backend's dedicated HTTP transport, shared by the
+// reverse proxy and health checks so both use the same TLS settings.
+func (b *Backend) Transport() *http.Transport {
+	return b.transport
+}
+
+// IsHealthy reports the effective health: the health override if one is set,
+// otherwise the last health check result.
 func (b *Backend) IsHealthy() bool {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	return b.isHealthy
+	return b.healthy()
 }
 
+// SetHealthy records a health check result. It reports whether the probed
+// state changed, independently of any health override.
 func (b *Backend) SetHealthy(healthy bool) (changed bool) {
+	return b.update(func() bool {
+		if b.isHealthy == healthy {
+			return false
+		}
+
+		b.isHealthy = healthy
+		return true
+	})
+}
+
+// SetCheckOutput records the output of the latest health check. Only checks
+// that run a command produce any.
+func (b *Backend) SetCheckOutput(output string) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	if b.isHealthy == healthy {
-		return false
-	}
+	b.checkOutput = output
+}
 
-	b.isHealthy = healthy
-	return true
+func (b *Backend) CheckOutput() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.checkOutput
+}
+
+// SkipChecks counts n health checks that did not run because the previous
+// one overran the interval.
+func (b *Backend) SkipChecks(n int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.skippedChecks += uint64(n)
+}
+
+// SkippedChecks returns how many health checks were skipped since startup.
+func (b *Backend) SkippedChecks() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.skippedChecks
 }
 
 func (b *Backend) RecordResponse(duration time.Duration) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	b.completed++
+	b.latencies.add(duration, time.Now())
+
 	if !b.hasEWMA {
 		b.ewmaResponseTime = duration
 		b.hasEWMA = true
@@ -119,30 +223,148 @@ func (b *Backend) EWMATime() time.Duration {
 	return b.ewmaResponseTime
 }
 
+// Weight returns the effective weight used by weighted strategies. It starts
+// at the configured weight, may be adjusted at runtime with SetWeight, and is
+// scaled down by the load the backend reports via feedback headers.
 func (b *Backend) Weight() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.hasReportedLoad || b.weight <= 0 {
+		return b.weight
+	}
+
+	scaled := int(math.Round(float64(b.weight) * (1 - b.reportedLoad)))
+	if scaled < 1 {
+		scaled = 1
+	}
+	return scaled
+}
+
+// BaseWeight returns the runtime weight before load feedback is applied.
+func (b *Backend) BaseWeight() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 	return b.weight
 }
 
+func (b *Backend) ConfiguredWeight() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.configuredWeight
+}
+
+// SetConfiguredWeight changes the weight the backend is configured with, for
+// backends whose configuration changes at runtime. The runtime weight follows
+// unless an owner holds one or SetWeight has moved it away from the
+// configured one.
+func (b *Backend) SetConfiguredWeight(weight int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.heldWeights) == 0 && b.weight == b.configuredWeight {
+		b.weight = weight
+	}
+	b.configuredWeight = weight
+}
+
+func (b *Backend) SetWeight(weight int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.weight = weight
+}
+
+// CompletedRequests returns the number of successfully proxied responses
+// recorded via RecordResponse since the backend was created.
+func (b *Backend) CompletedRequests() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.completed
+}
+
 func WithProxyErrorCapture(r *http.Request) (*http.Request, *ProxyError) {
 	pe := &ProxyError{}
 	ctx := context.WithValue(r.Context(), proxyErrorKey, pe)
 	return r.WithContext(ctx), pe
 }
 
-func New(url *url.URL, weight int) *Backend {
+// Option customises a Backend at construction time.
+type Option func(*Backend)
+
+// WithTLSServerName sets the name used for SNI and certificate verification,
+// needed when the backend URL addresses a resolved IP instead of a hostname.
+func WithTLSServerName(name string) Option {
+	return func(b *Backend) {
+		if b.transport.TLSClientConfig == nil {
+			b.transport.TLSClientConfig = &tls.Config{}
+		}
+		b.transport.TLSClientConfig.ServerName = name
+	}
+}
+
+// WithHost sets the Host header of health checks, needed like
+// WithTLSServerName when the backend URL addresses a resolved IP, so the
+// backend is checked as the virtual host it serves requests for.
+func WithHost(host string) Option {
+	return func(b *Backend) {
+		b.host = host
+	}
+}
+
+// WithName sets the backend's identity. An empty name keeps the URL.
+func WithName(name string) Option {
+	return func(b *Backend) {
+		if name != "" {
+			b.name = name
+		}
+	}
+}
+
+// WithOrigin records the configured URL a backend was derived from, e.g. the
+// hostname URL that resolved to this backend's IP.
+func WithOrigin(origin string) Option {
+	return func(b *Backend) {
+		b.origin = origin
+	}
+}
+
+func New(url *url.URL, weight int, opts ...Option) *Backend {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.IdleConnTimeout = DefaultIdleConnTimeout
+	conns := &connTracker{}
+	transport.DialContext = conns.dial(transport.DialContext)
+
 	proxy := httputil.NewSingleHostReverseProxy(url)
 	proxy.BufferPool = sharedBufferPool
+	proxy.Transport = tracingTransport{RoundTripper: transport, tracker: conns}
+	proxy.ModifyResponse = sanitizeResponse
 
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		
+
 		if pe, ok := r.Context().Value(proxyErrorKey).(*ProxyError); ok {
 			pe.Err = err
 		}
 	}
-	return &Backend{
-		url:       url,
-		proxy:     proxy,
-		isHealthy: false,
-		weight: weight,
+	b := &Backend{
+		url:              url,
+		name:             url.String(),
+		origin:           url.String(),
+		proxy:            proxy,
+		transport:        transport,
+		conns:            conns,
+		isHealthy:        false,
+		weight:           weight,
+		configuredWeight: weight,
+		priority:         DefaultPriority,
+		decay:            1,
+		shift:            1,
 	}
+	if url.Scheme == "https" {
+		transport.TLSClientConfig = &tls.Config{VerifyConnection: b.observeCertificates}
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
 }
@@ -41,6 +41,24 @@ var _ = Describe("Backend", func() {
 		It("should provide a reverse proxy", func() {
 			Expect(b.ReverseProxy()).NotTo(BeNil())
 		})
+
+		It("should be named after its URL by default", func() {
+			Expect(b.Name()).To(Equal("http://localhost:8081"))
+			Expect(backend.New(testURL, 1, backend.WithName("checkout")).Name()).To(Equal("checkout"))
+		})
+	})
+
+	Describe("Weight", func() {
+		It("should start at the configured weight", func() {
+			Expect(b.Weight()).To(Equal(1))
+			Expect(b.ConfiguredWeight()).To(Equal(1))
+		})
+
+		It("should adjust the effective weight without changing the configured one", func() {
+			b.SetWeight(7)
+			Expect(b.Weight()).To(Equal(7))
+			Expect(b.ConfiguredWeight()).To(Equal(1))
+		})
 	})
 
 	Describe("Health Management", func() {
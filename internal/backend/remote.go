@@ -0,0 +1,15 @@
+package backend
+
+// WithRemote puts the backend in the remote fallback group, for example
+// another region's load balancer. Remote backends are health checked like
+// any other but only receive traffic while the local backends have failed
+// over to them.
+func WithRemote() Option {
+	return func(b *Backend) {
+		b.remote = true
+	}
+}
+
+func (b *Backend) IsRemote() bool {
+	return b.remote
+}
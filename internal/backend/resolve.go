@@ -0,0 +1,11 @@
+package backend
+
+import (
+	"context"
+	"net"
+)
+
+// Resolver looks up the addresses of a host. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
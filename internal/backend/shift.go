@@ -0,0 +1,18 @@
+package backend
+
+// SetShiftFactor sets the share of its weight a traffic shift gives the
+// backend, between 0 and 1. Weighted strategies scale the backend's weight
+// by it, and a backend at 0 gets no traffic from them.
+func (b *Backend) SetShiftFactor(factor float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.shift = min(1, max(0, factor))
+}
+
+// ShiftFactor returns the share of its weight a traffic shift gives the
+// backend: 1 unless one is moving traffic to or away from it.
+func (b *Backend) ShiftFactor() float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.shift
+}
@@ -0,0 +1,70 @@
+package backend
+
+import "time"
+
+// WithSlowStart makes the backend ease back into rotation after recovering:
+// for window after BeginSlowStart, SlowStartFactor rises linearly from 0 to
+// 1 and weighted strategies scale the backend's weight by it.
+func WithSlowStart(window time.Duration) Option {
+	return func(b *Backend) {
+		b.slowStart = window
+	}
+}
+
+// BeginSlowStart starts the slow-start ramp at now. Health checks call it when
+// the backend comes back up. It returns the ramp window, zero when slow start
+// is disabled.
+func (b *Backend) BeginSlowStart(now time.Time) time.Duration {
+	b.update(func() bool {
+		if b.slowStart > 0 {
+			b.recoveredAt = now
+		}
+		return true
+	})
+	if b.slowStart > 0 {
+		time.AfterFunc(b.slowStart, func() { b.endSlowStart(now) })
+	}
+	return b.slowStart
+}
+
+// endSlowStart reports the state change at the end of the slow start begun
+// at recoveredAt, unless another one has begun since. SlowStartFactor may
+// already have cleared it.
+func (b *Backend) endSlowStart(recoveredAt time.Time) {
+	b.mutex.Lock()
+	if !b.recoveredAt.IsZero() && !b.recoveredAt.Equal(recoveredAt) {
+		b.mutex.Unlock()
+		return
+	}
+	now := time.Now()
+	b.recoveredAt = recoveredAt
+	before := status{healthy: b.healthy(), state: b.state(recoveredAt.Add(b.slowStart - 1))}
+	b.recoveredAt = time.Time{}
+	after := status{healthy: b.healthy(), state: b.state(now)}
+	watcher := b.watcher
+	b.mutex.Unlock()
+
+	if watcher != nil && before != after {
+		watcher(b, before, after)
+	}
+}
+
+// SlowStartFactor returns the share of its weight the backend should get at
+// now: below 1 while it is slow starting, 1 otherwise.
+func (b *Backend) SlowStartFactor(now time.Time) float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.recoveredAt.IsZero() {
+		return 1
+	}
+	elapsed := now.Sub(b.recoveredAt)
+	if elapsed >= b.slowStart {
+		b.recoveredAt = time.Time{}
+		return 1
+	}
+	if elapsed < 0 {
+		return 0
+	}
+	return float64(elapsed) / float64(b.slowStart)
+}
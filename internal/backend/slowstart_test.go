@@ -0,0 +1,34 @@
+package backend_test
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("SlowStart", func() {
+	u, _ := url.Parse("http://localhost:8081")
+
+	It("should ramp the factor from 0 to 1 over the window", func() {
+		b := backend.New(u, 4, backend.WithSlowStart(10*time.Second))
+		now := time.Now()
+		Expect(b.SlowStartFactor(now)).To(Equal(1.0))
+
+		Expect(b.BeginSlowStart(now)).To(Equal(10 * time.Second))
+		Expect(b.SlowStartFactor(now)).To(Equal(0.0))
+		Expect(b.SlowStartFactor(now.Add(2500 * time.Millisecond))).To(BeNumerically("~", 0.25, 1e-9))
+		Expect(b.SlowStartFactor(now.Add(10 * time.Second))).To(Equal(1.0))
+		Expect(b.Weight()).To(Equal(4))
+	})
+
+	It("should do nothing without a window", func() {
+		b := backend.New(u, 4)
+		now := time.Now()
+		Expect(b.BeginSlowStart(now)).To(BeZero())
+		Expect(b.SlowStartFactor(now)).To(Equal(1.0))
+	})
+})
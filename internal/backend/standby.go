@@ -0,0 +1,31 @@
+package backend
+
+// WithStandby makes the backend a warm standby: it is health checked like
+// any other backend but receives no traffic until SetStandbyActive(true).
+func WithStandby() Option {
+	return func(b *Backend) {
+		b.standby = true
+	}
+}
+
+func (b *Backend) IsStandby() bool {
+	return b.standby
+}
+
+// SetStandbyActive lets a standby backend receive traffic, or takes it out
+// of rotation again. It has no effect on backends that are not standbys.
+func (b *Backend) SetStandbyActive(active bool) (changed bool) {
+	return b.update(func() bool {
+		if !b.standby || b.standbyActive == active {
+			return false
+		}
+		b.standbyActive = active
+		return true
+	})
+}
+
+func (b *Backend) StandbyActive() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.standbyActive
+}
@@ -0,0 +1,36 @@
+package backend_test
+
+import (
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Standby", func() {
+	u, _ := url.Parse("http://localhost:8081")
+
+	It("should keep a healthy standby out of rotation until activated", func() {
+		b := backend.New(u, 1, backend.WithStandby())
+		b.SetHealthy(true)
+		Expect(b.IsStandby()).To(BeTrue())
+		Expect(b.IsHealthy()).To(BeTrue())
+		Expect(b.IsAvailable()).To(BeFalse())
+
+		Expect(b.SetStandbyActive(true)).To(BeTrue())
+		Expect(b.IsAvailable()).To(BeTrue())
+
+		Expect(b.SetStandbyActive(false)).To(BeTrue())
+		Expect(b.IsAvailable()).To(BeFalse())
+	})
+
+	It("should ignore activation of regular backends", func() {
+		b := backend.New(u, 1)
+		b.SetHealthy(true)
+		Expect(b.SetStandbyActive(true)).To(BeFalse())
+		Expect(b.StandbyActive()).To(BeFalse())
+		Expect(b.IsAvailable()).To(BeTrue())
+	})
+})
@@ -0,0 +1,201 @@
+package backend
+
+import (
+	"strings"
+	"time"
+)
+
+// State summarises whether a backend takes traffic and why not. It is
+// derived from the health check result and health override, the drain and
+// maintenance flags, standby activation and slow start, so each of them
+// keeps being recorded while another one decides the state: a backend in
+// maintenance stays there whatever its health checks report, and returns
+// to Active or Down depending on the last one when maintenance ends.
+//
+// Maintenance and Draining are held by the owners that entered them, and a
+// backend only leaves them once every owner has left, so an owner cannot end
+// what another one decided on: a maintenance window ending does not undo
+// maintenance an operator started, and an operator ending a drain does not
+// put a backend that asked to be drained back into rotation.
+//
+// The states, in order of precedence:
+//
+//	Maintenance  taken out of rotation by an operator or schedule
+//	Down         failing its health checks, or overridden unhealthy
+//	Draining     healthy, finishing requests it holds but taking no new ones
+//	Standby      healthy standby backend not activated
+//	Degraded     taking traffic at a reduced share while slow starting
+//	Active       taking its full share
+type State int
+
+const (
+	StateActive State = iota
+	StateDegraded
+	StateStandby
+	StateDraining
+	StateDown
+	StateMaintenance
+)
+
+func (s State) String() string {
+	switch s {
+	case StateActive:
+		return "active"
+	case StateDegraded:
+		return "degraded"
+	case StateStandby:
+		return "standby"
+	case StateDraining:
+		return "draining"
+	case StateDown:
+		return "down"
+	case StateMaintenance:
+		return "maintenance"
+	default:
+		return "unknown"
+	}
+}
+
+// TakesTraffic reports whether backends in the state receive new requests.
+func (s State) TakesTraffic() bool {
+	return s == StateActive || s == StateDegraded
+}
+
+func (b *Backend) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state(time.Now())
+}
+
+// state derives the state. Callers must hold the mutex.
+func (b *Backend) state(now time.Time) State {
+	switch {
+	case b.maintenance != 0:
+		return StateMaintenance
+	case !b.healthy():
+		return StateDown
+	case b.draining != 0:
+		return StateDraining
+	case b.standby && !b.standbyActive:
+		return StateStandby
+	case !b.recoveredAt.IsZero() && now.Sub(b.recoveredAt) < b.slowStart:
+		return StateDegraded
+	default:
+		return StateActive
+	}
+}
+
+// Owner is a party that moves backends between states or sets their runtime
+// weight. Owners combine into sets, as returned by Holders and
+// WeightHolders.
+type Owner uint8
+
+const (
+	// OwnerAdmin is an operator, through the admin API or a state import.
+	OwnerAdmin Owner = 1 << iota
+	// OwnerSchedule is a scheduled traffic policy.
+	OwnerSchedule
+	// OwnerFeedback is the backend itself, through its feedback headers.
+	OwnerFeedback
+	// OwnerHealth is the backend's health checks.
+	OwnerHealth
+	// OwnerOverride is the override file.
+	OwnerOverride
+	// OwnerCapacity is capacity auto-detection.
+	OwnerCapacity
+)
+
+var ownerNames = []string{"admin", "schedule", "feedback", "health", "override", "capacity"}
+
+// Names returns the names of the owners in the set.
+func (o Owner) Names() []string {
+	var names []string
+	for i, name := range ownerNames {
+		if o&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (o Owner) String() string {
+	return strings.Join(o.Names(), ",")
+}
+
+// Enter puts the backend into Maintenance or Draining on behalf of owner. It
+// reports whether owner did not hold the state already, and does nothing for
+// other states: health checks and health overrides decide Down. A drain
+// entered while the backend was not draining is bounded by its drain
+// timeout.
+func (b *Backend) Enter(owner Owner, s State) (changed bool) {
+	return b.update(func() bool {
+		switch s {
+		case StateMaintenance:
+			if b.maintenance&owner != 0 {
+				return false
+			}
+			b.maintenance |= owner
+			return true
+		case StateDraining:
+			if b.draining&owner != 0 {
+				return false
+			}
+			if b.draining == 0 {
+				b.armDrain(b.drainTimeout)
+			}
+			b.draining |= owner
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// Leave ends owner's hold on Maintenance or Draining and reports whether it
+// had one. The backend stays in the state while other owners hold it.
+func (b *Backend) Leave(owner Owner, s State) (changed bool) {
+	return b.update(func() bool {
+		switch s {
+		case StateMaintenance:
+			if b.maintenance&owner == 0 {
+				return false
+			}
+			b.maintenance &^= owner
+			return true
+		case StateDraining:
+			if b.draining&owner == 0 {
+				return false
+			}
+			b.draining &^= owner
+			if b.draining == 0 {
+				b.disarmDrain()
+			}
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// Holders returns the owners holding the backend in Maintenance or Draining,
+// or for Down, health when it fails its health checks without a health
+// override and admin when it is overridden unhealthy.
+func (b *Backend) Holders(s State) Owner {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch s {
+	case StateMaintenance:
+		return b.maintenance
+	case StateDraining:
+		return b.draining
+	case StateDown:
+		switch {
+		case b.healthOverride == OverrideUnhealthy:
+			return OwnerAdmin
+		case b.healthOverride == OverrideNone && !b.isHealthy:
+			return OwnerHealth
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package backend_test
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("State", func() {
+	u, _ := url.Parse("http://localhost:8081")
+
+	It("should apply the flags in order of precedence", func() {
+		b := backend.New(u, 1, backend.WithStandby(), backend.WithSlowStart(time.Minute))
+		b.SetHealthy(true)
+		Expect(b.State()).To(Equal(backend.StateStandby))
+
+		b.SetStandbyActive(true)
+		Expect(b.State()).To(Equal(backend.StateActive))
+
+		b.BeginSlowStart(time.Now())
+		Expect(b.State()).To(Equal(backend.StateDegraded))
+		Expect(b.IsAvailable()).To(BeTrue())
+
+		b.SetDraining(true)
+		Expect(b.State()).To(Equal(backend.StateDraining))
+
+		b.SetHealthy(false)
+		Expect(b.State()).To(Equal(backend.StateDown))
+
+		b.SetMaintenance(true)
+		Expect(b.State()).To(Equal(backend.StateMaintenance))
+		Expect(b.IsAvailable()).To(BeFalse())
+	})
+
+	It("should hold maintenance whatever the health checks report", func() {
+		b := backend.New(u, 1)
+		b.SetHealthy(true)
+		b.SetMaintenance(true)
+
+		b.SetHealthy(false)
+		Expect(b.State()).To(Equal(backend.StateMaintenance))
+		b.SetHealthy(true)
+		Expect(b.State()).To(Equal(backend.StateMaintenance))
+		Expect(b.IsHealthy()).To(BeTrue())
+
+		b.SetHealthy(false)
+		b.SetMaintenance(false)
+		Expect(b.State()).To(Equal(backend.StateDown))
+
+		b.SetHealthy(true)
+		Expect(b.State()).To(Equal(backend.StateActive))
+	})
+
+	It("should only let an owner end the states it entered", func() {
+		b := backend.New(u, 1)
+		b.SetHealthy(true)
+
+		Expect(b.Enter(backend.OwnerSchedule, backend.StateMaintenance)).To(BeTrue())
+		Expect(b.Enter(backend.OwnerAdmin, backend.StateMaintenance)).To(BeTrue())
+		Expect(b.Holders(backend.StateMaintenance).Names()).To(Equal([]string{"admin", "schedule"}))
+
+		Expect(b.Leave(backend.OwnerSchedule, backend.StateMaintenance)).To(BeTrue())
+		Expect(b.Leave(backend.OwnerSchedule, backend.StateMaintenance)).To(BeFalse())
+		Expect(b.State()).To(Equal(backend.StateMaintenance))
+
+		Expect(b.Leave(backend.OwnerAdmin, backend.StateMaintenance)).To(BeTrue())
+		Expect(b.State()).To(Equal(backend.StateActive))
+
+		Expect(b.Enter(backend.OwnerHealth, backend.StateDown)).To(BeFalse())
+		b.SetHealthy(false)
+		Expect(b.Holders(backend.StateDown)).To(Equal(backend.OwnerHealth))
+		b.SetHealthOverride(backend.OverrideUnhealthy)
+		Expect(b.Holders(backend.StateDown)).To(Equal(backend.OwnerAdmin))
+	})
+
+	It("should report state changes to the pool", func() {
+		b := backend.New(u, 1, backend.WithSlowStart(50*time.Millisecond))
+		b.SetHealthy(true)
+		pool := backend.NewPool([]*backend.Backend{b})
+
+		var (
+			mutex       sync.Mutex
+			transitions [][2]backend.State
+		)
+		pool.OnStateChange(func(_ *backend.Backend, from, to backend.State) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			transitions = append(transitions, [2]backend.State{from, to})
+		})
+		recorded := func() [][2]backend.State {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([][2]backend.State(nil), transitions...)
+		}
+
+		b.SetMaintenance(true)
+		b.SetHealthy(false)
+		b.SetHealthy(true)
+		b.SetMaintenance(false)
+		Expect(recorded()).To(Equal([][2]backend.State{
+			{backend.StateActive, backend.StateMaintenance},
+			{backend.StateMaintenance, backend.StateActive},
+		}))
+
+		b.BeginSlowStart(time.Now())
+		Eventually(recorded).Should(HaveLen(4))
+		Expect(recorded()[2:]).To(Equal([][2]backend.State{
+			{backend.StateActive, backend.StateDegraded},
+			{backend.StateDegraded, backend.StateActive},
+		}))
+	})
+})
@@ -0,0 +1,171 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+)
+
+// connTracker counts the connections of a backend's transport and how many of
+// them sit in its idle pool. The transport does not expose its pool, so the
+// count is kept from the outside: the dialer wraps every connection it opens,
+// and a trace on each proxied request tells which connection the request got
+// and when it was put back. Requests sent through the transport directly
+// rather than TracedTransport count as open but only become idle once a
+// proxied request has used them. HTTP/2 connections are shared rather than
+// pooled: they never count as idle, but as shared once a request got one.
+type connTracker struct {
+	open   atomic.Int64
+	idle   atomic.Int64
+	shared atomic.Int64
+
+	mu   sync.Mutex
+	live map[net.Conn]struct{}
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	idle    atomic.Bool
+	shared  atomic.Bool
+	once    sync.Once
+}
+
+func (c *trackedConn) setIdle(idle bool) {
+	if c.idle.CompareAndSwap(!idle, idle) {
+		if idle {
+			c.tracker.idle.Add(1)
+		} else {
+			c.tracker.idle.Add(-1)
+		}
+	}
+}
+
+// setShared counts the connection as a shared HTTP/2 one.
+func (c *trackedConn) setShared() {
+	if c.shared.CompareAndSwap(false, true) {
+		c.tracker.shared.Add(1)
+	}
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.setIdle(false)
+		if c.shared.Load() {
+			c.tracker.shared.Add(-1)
+		}
+		c.tracker.open.Add(-1)
+		c.tracker.forget(c)
+	})
+	return c.Conn.Close()
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dial wraps the connections dial opens so they are counted.
+func (t *connTracker) dial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		t.open.Add(1)
+		tracked := &trackedConn{Conn: conn, tracker: t}
+		t.remember(tracked)
+		return tracked, nil
+	}
+}
+
+// remember adds conn to the connections closeAll closes.
+func (t *connTracker) remember(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.live == nil {
+		t.live = make(map[net.Conn]struct{})
+	}
+	t.live[conn] = struct{}{}
+}
+
+func (t *connTracker) forget(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.live, conn)
+}
+
+// closeAll closes every connection still open and returns how many it
+// closed.
+func (t *connTracker) closeAll() int {
+	t.mu.Lock()
+	conns := make([]net.Conn, 0, len(t.live))
+	for conn := range t.live {
+		conns = append(conns, conn)
+	}
+	t.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return len(conns)
+}
+
+// trace follows the connection of one request in and out of the idle pool.
+func (t *connTracker) trace() *httptrace.ClientTrace {
+	var conn atomic.Pointer[trackedConn]
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			nc := info.Conn
+			h2 := false
+			if tc, ok := nc.(*tls.Conn); ok {
+				nc = tc.NetConn()
+				h2 = tc.ConnectionState().NegotiatedProtocol == "h2"
+			}
+			if tracked, ok := nc.(*trackedConn); ok {
+				tracked.setIdle(false)
+				if h2 {
+					tracked.setShared()
+				}
+				conn.Store(tracked)
+			}
+		},
+		PutIdleConn: func(err error) {
+			if tracked := conn.Load(); tracked != nil && err == nil {
+				tracked.setIdle(true)
+			}
+		},
+	}
+}
+
+// tracingTransport traces every request it sends for the connTracker.
+type tracingTransport struct {
+	http.RoundTripper
+	tracker *connTracker
+}
+
+func (t tracingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.RoundTripper.RoundTrip(r.WithContext(httptrace.WithClientTrace(r.Context(), t.tracker.trace())))
+}
+
+// TracedTransport returns the backend's transport with the tracking proxied
+// requests get, so the connections of the requests sent through it, such as
+// health checks, count as idle once they are back in the pool rather than
+// as busy against WithMaxConnections.
+func (b *Backend) TracedTransport() http.RoundTripper {
+	return tracingTransport{RoundTripper: b.transport, tracker: b.conns}
+}
+
+// IdleConnections returns the number of keep-alive connections to the
+// backend waiting in its transport's idle pool. A request sent while there
+// is one skips the TCP and TLS handshakes.
+func (b *Backend) IdleConnections() int {
+	return int(b.conns.idle.Load())
+}
+
+// OpenConnections returns the number of connections the backend's transport
+// holds open, busy or idle.
+func (b *Backend) OpenConnections() int {
+	return int(b.conns.open.Load())
+}
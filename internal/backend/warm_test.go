@@ -0,0 +1,124 @@
+package backend_test
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Connection tracking", func() {
+	var (
+		server *httptest.Server
+		b      *backend.Backend
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		u, _ := url.Parse(server.URL)
+		b = backend.New(u, 1)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	proxy := func() {
+		w := httptest.NewRecorder()
+		b.ReverseProxy().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+	}
+
+	It("should start cold", func() {
+		Expect(b.IdleConnections()).To(Equal(0))
+		Expect(b.OpenConnections()).To(Equal(0))
+	})
+
+	It("should count a keep-alive connection left idle by a proxied request", func() {
+		proxy()
+		Eventually(b.IdleConnections).Should(Equal(1))
+		Expect(b.OpenConnections()).To(Equal(1))
+
+		proxy()
+		Eventually(b.IdleConnections).Should(Equal(1))
+		Expect(b.OpenConnections()).To(Equal(1))
+	})
+
+	It("should stop counting idle connections once they are closed", func() {
+		proxy()
+		Eventually(b.IdleConnections).Should(Equal(1))
+
+		b.Transport().CloseIdleConnections()
+		Expect(b.IdleConnections()).To(Equal(0))
+		Expect(b.OpenConnections()).To(Equal(0))
+	})
+
+	It("should count connections the backend closes", func() {
+		proxy()
+		Eventually(b.IdleConnections).Should(Equal(1))
+
+		server.CloseClientConnections()
+		Eventually(b.IdleConnections).Should(Equal(0))
+		Eventually(b.OpenConnections).Should(Equal(0))
+	})
+})
+
+var _ = Describe("Connection limit", func() {
+	It("should be at capacity while every connection it may open is busy", func() {
+		hold := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-hold
+		}))
+		DeferCleanup(server.Close)
+		u, _ := url.Parse(server.URL)
+		b := backend.New(u, 1, backend.WithMaxConnections(1))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/health", nil)
+			if res, err := b.TracedTransport().RoundTrip(req); err == nil {
+				res.Body.Close()
+			}
+		}()
+
+		Eventually(b.OpenConnections).Should(Equal(1))
+		Expect(b.ActiveConnections()).To(BeZero())
+		Expect(b.AtCapacity()).To(BeTrue())
+		Expect(b.TryIncrementConn()).To(BeFalse())
+
+		close(hold)
+		<-done
+		Eventually(b.IdleConnections).Should(Equal(1))
+		Expect(b.AtCapacity()).To(BeFalse())
+		Expect(b.TryIncrementConn()).To(BeTrue())
+	})
+
+	It("should let HTTP/2 requests share the connections it has", func() {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		DeferCleanup(server.Close)
+		u, _ := url.Parse(server.URL)
+		b := backend.New(u, 1, backend.WithMaxConnections(1))
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		b.Transport().TLSClientConfig.RootCAs = pool
+
+		w := httptest.NewRecorder()
+		b.ReverseProxy().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(b.OpenConnections()).To(Equal(1))
+
+		Expect(b.TryIncrementConn()).To(BeTrue())
+		Expect(b.TryIncrementConn()).To(BeTrue())
+		Expect(b.AtCapacity()).To(BeFalse())
+	})
+})
@@ -0,0 +1,58 @@
+package backend
+
+// weightPrecedence lists the owners that may hold a runtime weight, the one
+// whose weight applies first. An operator's weight stands until the operator
+// releases it, an override file entry outranks schedules, and capacity
+// detection only sets weights nobody else holds.
+var weightPrecedence = []Owner{OwnerAdmin, OwnerOverride, OwnerSchedule, OwnerCapacity}
+
+// HoldWeight sets the runtime weight on behalf of owner. Each owner keeps
+// its own weight, and the one of the owner first in precedence applies, so
+// a schedule ending or capacity detection recalibrating does not undo a
+// weight an operator set.
+func (b *Backend) HoldWeight(owner Owner, weight int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.heldWeights == nil {
+		b.heldWeights = make(map[Owner]int)
+	}
+	b.heldWeights[owner] = weight
+	b.applyHeldWeight()
+}
+
+// ReleaseWeight ends owner's hold on the runtime weight and reports whether
+// it had one. The weight of the next owner in precedence applies, or the
+// configured weight once none holds one.
+func (b *Backend) ReleaseWeight(owner Owner) (changed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.heldWeights[owner]; !ok {
+		return false
+	}
+	delete(b.heldWeights, owner)
+	b.applyHeldWeight()
+	return true
+}
+
+// WeightHolders returns the owners holding a runtime weight.
+func (b *Backend) WeightHolders() Owner {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var holders Owner
+	for owner := range b.heldWeights {
+		holders |= owner
+	}
+	return holders
+}
+
+// applyHeldWeight makes the weight of the first holder in precedence the
+// runtime weight. Callers must hold the mutex.
+func (b *Backend) applyHeldWeight() {
+	for _, owner := range weightPrecedence {
+		if weight, ok := b.heldWeights[owner]; ok {
+			b.weight = weight
+			return
+		}
+	}
+	b.weight = b.configuredWeight
+}
@@ -0,0 +1,52 @@
+package backend_test
+
+import (
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+var _ = Describe("Weight owners", func() {
+	var b *backend.Backend
+
+	BeforeEach(func() {
+		u, _ := url.Parse("http://localhost:8081")
+		b = backend.New(u, 2)
+	})
+
+	It("should apply the weight of the owner first in precedence", func() {
+		b.HoldWeight(backend.OwnerCapacity, 8)
+		Expect(b.BaseWeight()).To(Equal(8))
+
+		b.HoldWeight(backend.OwnerAdmin, 5)
+		b.HoldWeight(backend.OwnerSchedule, 3)
+		b.HoldWeight(backend.OwnerCapacity, 9)
+		Expect(b.BaseWeight()).To(Equal(5))
+		Expect(b.WeightHolders()).To(Equal(backend.OwnerAdmin | backend.OwnerSchedule | backend.OwnerCapacity))
+	})
+
+	It("should fall back to the next holder and then the configured weight", func() {
+		b.HoldWeight(backend.OwnerAdmin, 5)
+		b.HoldWeight(backend.OwnerSchedule, 3)
+
+		Expect(b.ReleaseWeight(backend.OwnerSchedule)).To(BeTrue())
+		Expect(b.BaseWeight()).To(Equal(5))
+
+		Expect(b.ReleaseWeight(backend.OwnerAdmin)).To(BeTrue())
+		Expect(b.ReleaseWeight(backend.OwnerAdmin)).To(BeFalse())
+		Expect(b.BaseWeight()).To(Equal(2))
+		Expect(b.WeightHolders()).To(BeZero())
+	})
+
+	It("should keep a held weight when the configured weight changes", func() {
+		b.HoldWeight(backend.OwnerOverride, 6)
+		b.SetConfiguredWeight(4)
+		Expect(b.BaseWeight()).To(Equal(6))
+
+		b.ReleaseWeight(backend.OwnerOverride)
+		Expect(b.BaseWeight()).To(Equal(4))
+	})
+})
@@ -0,0 +1,182 @@
+package capacity
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+const (
+	// smoothing is the weight given to a new capacity observation.
+	smoothing = 0.3
+	// maxStep bounds the factor by which a single observation can move an
+	// estimate up or down, so one unusual window cannot swing weights.
+	maxStep = 2.0
+)
+
+type Options struct {
+	Interval      time.Duration
+	TargetLatency time.Duration
+	MaxWeight     int
+	MinRequests   uint64
+}
+
+type Calibrator struct {
+	pool   *backend.Pool
+	opts   Options
+	logger *slog.Logger
+
+	mutex    sync.Mutex
+	lastRun  time.Time
+	counts   map[*backend.Backend]uint64
+	capacity map[*backend.Backend]float64
+}
+
+// NewCalibrator returns a calibrator weighting the backends in pool.
+func NewCalibrator(pool *backend.Pool, opts Options, logger *slog.Logger) *Calibrator {
+	if opts.MaxWeight < 1 {
+		opts.MaxWeight = 10
+	}
+
+	return &Calibrator{
+		pool:     pool,
+		opts:     opts,
+		logger:   logger,
+		counts:   make(map[*backend.Backend]uint64),
+		capacity: make(map[*backend.Backend]float64),
+	}
+}
+
+func (c *Calibrator) Start(ctx context.Context) {
+	goroutines.Go("capacity", func() { c.run(ctx) })
+}
+
+func (c *Calibrator) run(ctx context.Context) {
+	c.Calibrate(time.Now())
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.Calibrate(now)
+		}
+	}
+}
+
+// Calibrate takes one sample of every backend and updates weights. The first
+// call only records a baseline. Backends whose weight another owner holds,
+// such as an operator or the override file, are left out, and start from a
+// fresh estimate once it is released.
+func (c *Calibrator) Calibrate(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	first := c.lastRun.IsZero() || !now.After(c.lastRun)
+	c.lastRun = now
+
+	for _, b := range c.pool.Backends() {
+		count := b.CompletedRequests()
+		delta := count - c.counts[b]
+		c.counts[b] = count
+
+		if b.WeightHolders()&^backend.OwnerCapacity != 0 {
+			delete(c.capacity, b)
+			continue
+		}
+		if first || delta < c.opts.MinRequests || delta == 0 {
+			continue
+		}
+
+		observed := c.estimate(b.EWMATime(), b.MaxInFlight())
+		if observed <= 0 {
+			continue
+		}
+
+		if prev, ok := c.capacity[b]; ok {
+			observed = math.Max(prev/maxStep, math.Min(prev*maxStep, observed))
+			c.capacity[b] = (1-smoothing)*prev + smoothing*observed
+		} else {
+			c.capacity[b] = observed
+		}
+	}
+
+	c.apply()
+}
+
+// estimate returns the requests per second a backend answering in latency
+// completes while holding concurrency requests at once, by Little's law
+// (throughput = concurrency / latency). A backend without an in-flight cap
+// counts as holding one, so backends compare by latency alone. Above the
+// target latency the estimate shrinks further in proportion, so an
+// overloaded backend sheds weight quickly.
+//
+// The estimate deliberately ignores the observed request rate: that follows
+// the weight the calibrator itself set, and feeding it back would keep
+// raising the weight of whichever backend got more traffic.
+func (c *Calibrator) estimate(latency time.Duration, concurrency int) float64 {
+	if latency <= 0 {
+		return 0
+	}
+
+	capacity := float64(max(concurrency, 1)) / latency.Seconds()
+	if c.opts.TargetLatency > 0 && latency > c.opts.TargetLatency {
+		capacity *= float64(c.opts.TargetLatency) / float64(latency)
+	}
+	return capacity
+}
+
+func (c *Calibrator) apply() {
+	var best float64
+	for _, capacity := range c.capacity {
+		best = math.Max(best, capacity)
+	}
+	if best == 0 {
+		return
+	}
+
+	for b, capacity := range c.capacity {
+		weight := int(math.Round(float64(c.opts.MaxWeight) * capacity / best))
+		if weight < 1 {
+			weight = 1
+		}
+
+		if weight != b.BaseWeight() {
+			c.logger.Info("Recalibrated backend weight",
+				slog.String("backend", b.URL().String()),
+				slog.Int("weight", weight),
+				slog.Float64("capacity_rps", capacity))
+			b.HoldWeight(backend.OwnerCapacity, weight)
+		}
+	}
+}
+
+// Forget drops the request count and capacity estimate of b, for backends
+// that left the pool.
+func (c *Calibrator) Forget(b *backend.Backend) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.counts, b)
+	delete(c.capacity, b)
+}
+
+// Capacity returns the current sustainable throughput estimate in requests
+// per second, keyed by backend name.
+func (c *Calibrator) Capacity() map[string]float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	out := make(map[string]float64, len(c.capacity))
+	for b, capacity := range c.capacity {
+		out[b.Name()] = capacity
+	}
+	return out
+}
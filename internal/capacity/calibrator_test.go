@@ -0,0 +1,150 @@
+package capacity_test
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/capacity"
+)
+
+var _ = Describe("Calibrator", func() {
+	var (
+		fast, slow *backend.Backend
+		cal        *capacity.Calibrator
+		start      time.Time
+	)
+
+	record := func(b *backend.Backend, n int, latency time.Duration) {
+		for i := 0; i < n; i++ {
+			b.RecordResponse(latency)
+		}
+	}
+
+	BeforeEach(func() {
+		u1, _ := url.Parse("http://localhost:8081")
+		u2, _ := url.Parse("http://localhost:8082")
+		fast = backend.New(u1, 1)
+		slow = backend.New(u2, 1)
+
+		cal = capacity.NewCalibrator(backend.NewPool([]*backend.Backend{fast, slow}), capacity.Options{
+			Interval:      10 * time.Second,
+			TargetLatency: 100 * time.Millisecond,
+			MaxWeight:     10,
+			MinRequests:   10,
+		}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		start = time.Now()
+		cal.Calibrate(start)
+	})
+
+	It("should leave weights untouched on the baseline sample", func() {
+		Expect(fast.Weight()).To(Equal(1))
+		Expect(slow.Weight()).To(Equal(1))
+		Expect(cal.Capacity()).To(BeEmpty())
+	})
+
+	It("should favour the backend that sustains more throughput at target latency", func() {
+		record(fast, 100, 25*time.Millisecond)
+		record(slow, 100, 200*time.Millisecond)
+
+		cal.Calibrate(start.Add(10 * time.Second))
+
+		Expect(fast.Weight()).To(Equal(10))
+		Expect(slow.Weight()).To(BeNumerically("<", fast.Weight()))
+		Expect(slow.Weight()).To(BeNumerically(">=", 1))
+		Expect(fast.ConfiguredWeight()).To(Equal(1))
+	})
+
+	It("should skip backends without enough traffic in the window", func() {
+		record(fast, 100, 50*time.Millisecond)
+		record(slow, 5, 50*time.Millisecond)
+
+		cal.Calibrate(start.Add(10 * time.Second))
+
+		Expect(cal.Capacity()).To(HaveKey("http://localhost:8081"))
+		Expect(cal.Capacity()).NotTo(HaveKey("http://localhost:8082"))
+		Expect(slow.Weight()).To(Equal(1))
+	})
+
+	It("should leave backends whose override sets their weight alone until it is lifted", func() {
+		slow.HoldWeight(backend.OwnerOverride, 7)
+
+		record(fast, 100, 25*time.Millisecond)
+		record(slow, 100, 200*time.Millisecond)
+		cal.Calibrate(start.Add(10 * time.Second))
+
+		Expect(fast.Weight()).To(Equal(10))
+		Expect(slow.Weight()).To(Equal(7))
+		Expect(cal.Capacity()).NotTo(HaveKey("http://localhost:8082"))
+
+		slow.ReleaseWeight(backend.OwnerOverride)
+		record(fast, 100, 25*time.Millisecond)
+		record(slow, 100, 200*time.Millisecond)
+		cal.Calibrate(start.Add(20 * time.Second))
+
+		Expect(cal.Capacity()).To(HaveKey("http://localhost:8082"))
+		Expect(slow.Weight()).To(BeNumerically("<", 7))
+	})
+
+	It("should keep a weight an operator set through a calibration pass", func() {
+		slow.HoldWeight(backend.OwnerAdmin, 4)
+
+		record(fast, 100, 25*time.Millisecond)
+		record(slow, 100, 200*time.Millisecond)
+		cal.Calibrate(start.Add(10 * time.Second))
+
+		Expect(fast.Weight()).To(Equal(10))
+		Expect(slow.Weight()).To(Equal(4))
+		Expect(slow.WeightHolders()).To(Equal(backend.OwnerAdmin))
+	})
+
+	It("should not favour a backend for getting more traffic", func() {
+		record(fast, 300, 50*time.Millisecond)
+		record(slow, 100, 50*time.Millisecond)
+
+		cal.Calibrate(start.Add(10 * time.Second))
+
+		Expect(fast.Weight()).To(Equal(slow.Weight()))
+	})
+
+	It("should count the in-flight cap as the backend's concurrency", func() {
+		u, _ := url.Parse("http://localhost:8083")
+		wide := backend.New(u, 1, backend.WithMaxInFlight(4))
+		cal = capacity.NewCalibrator(backend.NewPool([]*backend.Backend{fast, wide}), capacity.Options{
+			Interval:    10 * time.Second,
+			MaxWeight:   10,
+			MinRequests: 10,
+		}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		cal.Calibrate(start)
+
+		record(fast, 100, 50*time.Millisecond)
+		record(wide, 100, 100*time.Millisecond)
+		cal.Calibrate(start.Add(10 * time.Second))
+
+		Expect(wide.Weight()).To(Equal(10))
+		Expect(fast.Weight()).To(Equal(5))
+	})
+
+	It("should smooth estimates and bound each step", func() {
+		record(fast, 100, 100*time.Millisecond)
+		record(slow, 100, 100*time.Millisecond)
+		cal.Calibrate(start.Add(10 * time.Second))
+		first := cal.Capacity()["http://localhost:8081"]
+		Expect(first).To(BeNumerically("~", 10, 0.5))
+
+		for range 50 {
+			fast.RecordResponse(time.Millisecond)
+		}
+		cal.Calibrate(start.Add(20 * time.Second))
+		second := cal.Capacity()["http://localhost:8081"]
+
+		Expect(second).To(BeNumerically(">", first))
+		Expect(second).To(BeNumerically("<=", first*(1-0.3+0.3*2)))
+	})
+})
@@ -0,0 +1,26 @@
+// Package capacity derives backend weights from observed response times.
+//
+// A Calibrator periodically samples each backend's completed request count
+// and smoothed response time. By Little's law a backend holding N requests
+// at once that answers each in W completes N/W requests per second; N is the
+// backend's in-flight cap, or one without, and backends slower than the
+// target latency are marked down further. Weights are rescaled so that the
+// highest capacity backend gets the maximum weight.
+//
+// The observed request rate is not used: it follows the weights the
+// calibrator sets, so deriving capacity from it would keep feeding more
+// traffic to whichever backend already got more. Latency instead rises with
+// load, which makes the loop settle. Each window moves an estimate by at
+// most a factor of two, smoothed with the previous one, and backends that
+// did not see enough traffic in a window keep their previous estimate.
+//
+// Usage:
+//
+//	cal := capacity.NewCalibrator(pool, capacity.Options{
+//		Interval:      30 * time.Second,
+//		TargetLatency: 200 * time.Millisecond,
+//		MaxWeight:     10,
+//		MinRequests:   20,
+//	}, logger)
+//	cal.Start(ctx)
+package capacity
@@ -0,0 +1,257 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDuration     = 5 * time.Minute
+	DefaultMaxRecords   = 1000
+	DefaultMaxBodyBytes = 4096
+)
+
+var ErrActive = errors.New("a capture session is already running")
+
+// Filter selects the exchanges to record. Empty fields match everything.
+// Status is an exact code such as "503" or a class such as "5xx"; Backend
+// matches the backend name.
+type Filter struct {
+	PathPrefix string `json:"path_prefix,omitempty"`
+	Backend    string `json:"backend,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+// Validate checks that Status is a code or a class.
+func (f Filter) Validate() error {
+	if f.Status == "" {
+		return nil
+	}
+	if _, _, ok := statusRange(f.Status); !ok {
+		return fmt.Errorf("invalid status filter %q, use a code such as 503 or a class such as 5xx", f.Status)
+	}
+	return nil
+}
+
+func statusRange(s string) (lo, hi int, ok bool) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+		lo = int(s[0]-'0') * 100
+		return lo, lo + 99, true
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, false
+	}
+	return code, code, true
+}
+
+func (f Filter) matchStatus(code int) bool {
+	if f.Status == "" {
+		return true
+	}
+	lo, hi, _ := statusRange(f.Status)
+	return code >= lo && code <= hi
+}
+
+type Options struct {
+	Filter
+	Duration     time.Duration
+	SampleRate   float64
+	MaxRecords   int
+	MaxBodyBytes int
+}
+
+// Status describes the current or most recent session.
+type Status struct {
+	Active       bool      `json:"active"`
+	File         string    `json:"file,omitempty"`
+	Filter       Filter    `json:"filter"`
+	SampleRate   float64   `json:"sample_rate,omitempty"`
+	Started      time.Time `json:"started,omitempty"`
+	Until        time.Time `json:"until,omitempty"`
+	Records      int       `json:"records"`
+	MaxRecords   int       `json:"max_records,omitempty"`
+	MaxBodyBytes int       `json:"max_body_bytes,omitempty"`
+}
+
+type Capturer struct {
+	dir         string
+	maxDuration time.Duration
+	logger      *slog.Logger
+
+	mutex   sync.Mutex
+	session *session
+	last    Status
+}
+
+type session struct {
+	status Status
+	file   *os.File
+	enc    *json.Encoder
+	timer  *time.Timer
+}
+
+// New creates a capturer writing to dir (the system temp directory when
+// empty). Sessions are limited to maxDuration.
+func New(dir string, maxDuration time.Duration, logger *slog.Logger) *Capturer {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return &Capturer{dir: dir, maxDuration: maxDuration, logger: logger}
+}
+
+// Start begins a session. Zero options take their defaults and the duration
+// is capped at the capturer's maximum.
+func (c *Capturer) Start(opts Options) (Status, error) {
+	if err := opts.Filter.Validate(); err != nil {
+		return Status{}, err
+	}
+
+	if opts.Duration <= 0 {
+		opts.Duration = DefaultDuration
+	}
+	if c.maxDuration > 0 && opts.Duration > c.maxDuration {
+		opts.Duration = c.maxDuration
+	}
+	if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	if opts.MaxRecords <= 0 {
+		opts.MaxRecords = DefaultMaxRecords
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.session != nil {
+		return c.session.status, ErrActive
+	}
+
+	now := time.Now().UTC()
+	path := filepath.Join(c.dir, "capture-"+now.Format("20060102T150405.000Z")+".jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return Status{}, err
+	}
+
+	s := &session{
+		status: Status{
+			Active:       true,
+			File:         path,
+			Filter:       opts.Filter,
+			SampleRate:   opts.SampleRate,
+			Started:      now,
+			Until:        now.Add(opts.Duration),
+			MaxRecords:   opts.MaxRecords,
+			MaxBodyBytes: opts.MaxBodyBytes,
+		},
+		file: file,
+		enc:  json.NewEncoder(file),
+	}
+	s.timer = time.AfterFunc(opts.Duration, func() { c.end(s, "duration elapsed") })
+	c.session = s
+
+	c.logger.Info("Capture started",
+		slog.String("file", path),
+		slog.Duration("duration", opts.Duration),
+		slog.String("path_prefix", opts.PathPrefix),
+		slog.String("backend", opts.Backend),
+		slog.String("status", opts.Status))
+
+	return s.status, nil
+}
+
+// Stop ends the running session, if any, and returns its final status.
+func (c *Capturer) Stop() Status {
+	c.mutex.Lock()
+	s := c.session
+	c.mutex.Unlock()
+
+	if s != nil {
+		c.end(s, "stopped")
+	}
+	return c.Status()
+}
+
+// Status returns the running session's status, or the last one's.
+func (c *Capturer) Status() Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.session != nil {
+		return c.session.status
+	}
+	return c.last
+}
+
+func (c *Capturer) end(s *session, reason string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.session != s {
+		return
+	}
+
+	s.timer.Stop()
+	s.file.Close()
+	s.status.Active = false
+	c.last = s.status
+	c.session = nil
+
+	c.logger.Info("Capture finished",
+		slog.String("file", s.status.File),
+		slog.String("reason", reason),
+		slog.Int("records", s.status.Records))
+}
+
+// sample decides whether a request starts an exchange, based on the parts of
+// the filter known before proxying.
+func (c *Capturer) sample(path string) (Options, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	s := c.session
+	if s == nil || !strings.HasPrefix(path, s.status.Filter.PathPrefix) {
+		return Options{}, false
+	}
+	if s.status.SampleRate < 1 && rand.Float64() >= s.status.SampleRate {
+		return Options{}, false
+	}
+
+	return Options{Filter: s.status.Filter, MaxBodyBytes: s.status.MaxBodyBytes}, true
+}
+
+func (c *Capturer) write(rec *Record) {
+	c.mutex.Lock()
+	s := c.session
+	if s == nil {
+		c.mutex.Unlock()
+		return
+	}
+
+	if err := s.enc.Encode(rec); err != nil {
+		c.mutex.Unlock()
+		c.logger.Error("Failed to write capture record", slog.Any("error", err))
+		c.end(s, "write failed")
+		return
+	}
+	s.status.Records++
+	full := s.status.Records >= s.status.MaxRecords
+	c.mutex.Unlock()
+
+	if full {
+		c.end(s, "record limit reached")
+	}
+}
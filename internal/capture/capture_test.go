@@ -0,0 +1,191 @@
+package capture_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/capture"
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+)
+
+var _ = Describe("Capturer", func() {
+	var c *capture.Capturer
+
+	// serve runs r through an exchange the way the balancer's handler does,
+	// answering with status and body from a backend called "api".
+	serve := func(r *http.Request, status int, body string) {
+		w := httptest.NewRecorder()
+		exchange := c.Begin(r)
+		defer exchange.Finish()
+
+		rw := exchange.Writer(w)
+		exchange.SetBackend("api")
+		if r.Body != nil {
+			io.ReadAll(r.Body)
+		}
+		rw.Header().Set("Set-Cookie", "session=secret")
+		rw.WriteHeader(status)
+		rw.Write([]byte(body))
+	}
+
+	records := func(path string) []capture.Record {
+		f, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		var out []capture.Record
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec capture.Record
+			Expect(json.Unmarshal(scanner.Bytes(), &rec)).To(Succeed())
+			out = append(out, rec)
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		c = capture.New(GinkgoT().TempDir(), time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	})
+
+	It("should not capture without a running session", func() {
+		Expect(c.Begin(httptest.NewRequest(http.MethodGet, "/", nil))).To(BeNil())
+	})
+
+	It("should be safe to use through a nil capturer and exchange", func() {
+		var none *capture.Capturer
+		exchange := none.Begin(httptest.NewRequest(http.MethodGet, "/", nil))
+		w := httptest.NewRecorder()
+
+		Expect(exchange.Writer(w)).To(BeIdenticalTo(w))
+		exchange.SetBackend("api")
+		exchange.Finish()
+	})
+
+	It("should record matching exchanges with truncated bodies and redacted credentials", func() {
+		status, err := c.Start(capture.Options{
+			Filter:       capture.Filter{PathPrefix: "/api/", Status: "5xx"},
+			MaxBodyBytes: 4,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Active).To(BeTrue())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/orders?id=1", strings.NewReader("request-body"))
+		req.Header.Set("Authorization", "Bearer secret")
+		serve(req, http.StatusBadGateway, "response-body")
+
+		serve(httptest.NewRequest(http.MethodGet, "/api/orders", nil), http.StatusOK, "ok")
+		serve(httptest.NewRequest(http.MethodGet, "/static/app.js", nil), http.StatusBadGateway, "")
+
+		final := c.Stop()
+		Expect(final.Active).To(BeFalse())
+		Expect(final.Records).To(Equal(1))
+
+		recs := records(final.File)
+		Expect(recs).To(HaveLen(1))
+		rec := recs[0]
+		Expect(rec.Backend).To(Equal("api"))
+		Expect(rec.Request.Method).To(Equal(http.MethodPost))
+		Expect(rec.Request.URL).To(Equal("/api/orders?id=1"))
+		Expect(rec.Request.Body).To(Equal("requ"))
+		Expect(rec.Request.BodyTruncated).To(BeTrue())
+		Expect(rec.Request.Header.Get("Authorization")).To(Equal("[redacted]"))
+		Expect(rec.Response.Status).To(Equal(http.StatusBadGateway))
+		Expect(rec.Response.Body).To(Equal("resp"))
+		Expect(rec.Response.Header.Get("Set-Cookie")).To(Equal("[redacted]"))
+	})
+
+	It("should record bodies prepared for inspection decompressed", func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte("request-body"))
+		zw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &buf)
+		req.Header.Set("Content-Encoding", "gzip")
+		req, err := inspect.New(inspect.Options{MaxBytes: 1024, MaxDecodedBytes: 1024, Decompress: true}).Prepare(req)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = c.Start(capture.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		serve(req, http.StatusOK, "ok")
+
+		recs := records(c.Stop().File)
+		Expect(recs).To(HaveLen(1))
+		Expect(recs[0].Request.Body).To(Equal("request-body"))
+	})
+
+	It("should filter by backend name", func() {
+		_, err := c.Start(capture.Options{Filter: capture.Filter{Backend: "other"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		serve(httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "ok")
+
+		Expect(c.Stop().Records).To(BeZero())
+	})
+
+	It("should end the session once the record limit is reached", func() {
+		_, err := c.Start(capture.Options{MaxRecords: 2})
+		Expect(err).NotTo(HaveOccurred())
+
+		for range 3 {
+			serve(httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "ok")
+		}
+
+		status := c.Status()
+		Expect(status.Active).To(BeFalse())
+		Expect(status.Records).To(Equal(2))
+		Expect(records(status.File)).To(HaveLen(2))
+	})
+
+	It("should end the session when its duration elapses", func() {
+		_, err := c.Start(capture.Options{Duration: 20 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() bool { return c.Status().Active }).Should(BeFalse())
+		Expect(c.Begin(httptest.NewRequest(http.MethodGet, "/", nil))).To(BeNil())
+	})
+
+	It("should cap the duration at the configured maximum", func() {
+		status, err := c.Start(capture.Options{Duration: time.Hour})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Until.Sub(status.Started)).To(Equal(time.Minute))
+		c.Stop()
+	})
+
+	It("should refuse a second concurrent session", func() {
+		_, err := c.Start(capture.Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = c.Start(capture.Options{})
+		Expect(err).To(MatchError(capture.ErrActive))
+		c.Stop()
+	})
+
+	DescribeTable("status filters",
+		func(status string, valid bool) {
+			err := capture.Filter{Status: status}.Validate()
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		Entry("exact code", "503", true),
+		Entry("class", "5xx", true),
+		Entry("upper-case class", "4XX", true),
+		Entry("out of range", "600", false),
+		Entry("garbage", "bad", false),
+	)
+})
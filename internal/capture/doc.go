@@ -0,0 +1,16 @@
+// Package capture records full request/response exchanges for
+// troubleshooting. A capture session is started on demand (normally through
+// the admin API), ends after a fixed duration or record count, and appends
+// one JSON object per matching exchange to a file in a configured directory.
+//
+// Bodies are truncated to a configurable size and credentials
+// (Authorization, Cookie, Set-Cookie, Proxy-Authorization) are redacted.
+//
+// Usage:
+//
+//	c := capture.New("/var/tmp/lb", 15*time.Minute, logger)
+//	status, err := c.Start(capture.Options{
+//		Filter:   capture.Filter{PathPrefix: "/api/", Status: "5xx"},
+//		Duration: 5 * time.Minute,
+//	})
+package capture
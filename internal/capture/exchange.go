@@ -0,0 +1,221 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+)
+
+var redacted = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// Record is one captured exchange as written to the capture file.
+type Record struct {
+	Time     time.Time      `json:"time"`
+	Duration time.Duration  `json:"duration"`
+	Backend  string         `json:"backend,omitempty"`
+	Request  RequestRecord  `json:"request"`
+	Response ResponseRecord `json:"response"`
+}
+
+type RequestRecord struct {
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Proto         string      `json:"proto"`
+	RemoteAddr    string      `json:"remote_addr"`
+	Header        http.Header `json:"header"`
+	Body          string      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+}
+
+type ResponseRecord struct {
+	Status        int         `json:"status"`
+	Header        http.Header `json:"header"`
+	Body          string      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+}
+
+// Exchange accumulates one request/response pair while it is proxied. A nil
+// Exchange is valid and records nothing, so callers need not check whether a
+// capture is running.
+type Exchange struct {
+	capturer *Capturer
+	filter   Filter
+	start    time.Time
+	request  RequestRecord
+	reqBody  *limitedBuffer
+	backend  string
+	writer   *responseWriter
+}
+
+// Begin starts recording r if a session is running and r passes its path
+// filter and sampling. A body prepared by package inspect is recorded as
+// inspected, any other is recorded by replacing r.Body with a reader that
+// copies what the backend consumes. Begin returns nil when the request is not
+// captured.
+func (c *Capturer) Begin(r *http.Request) *Exchange {
+	if c == nil {
+		return nil
+	}
+
+	opts, ok := c.sample(r.URL.Path)
+	if !ok {
+		return nil
+	}
+
+	e := &Exchange{
+		capturer: c,
+		filter:   opts.Filter,
+		start:    time.Now(),
+		request: RequestRecord{
+			Method:     r.Method,
+			URL:        r.URL.RequestURI(),
+			Proto:      r.Proto,
+			RemoteAddr: r.RemoteAddr,
+			Header:     redact(r.Header),
+		},
+		reqBody: &limitedBuffer{limit: opts.MaxBodyBytes},
+	}
+
+	if body, ok := inspect.FromRequest(r); ok {
+		e.reqBody.Write(body.Data)
+	} else if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &teeBody{ReadCloser: r.Body, tee: e.reqBody}
+	}
+
+	return e
+}
+
+// Writer wraps w so the response status, headers and body are recorded.
+func (e *Exchange) Writer(w http.ResponseWriter) http.ResponseWriter {
+	if e == nil {
+		return w
+	}
+	e.writer = &responseWriter{ResponseWriter: w, body: &limitedBuffer{limit: e.reqBody.limit}}
+	return e.writer
+}
+
+// SetBackend records the backend serving the current attempt.
+func (e *Exchange) SetBackend(name string) {
+	if e != nil {
+		e.backend = name
+	}
+}
+
+// Finish applies the backend and status filters and writes the record.
+func (e *Exchange) Finish() {
+	if e == nil || e.writer == nil {
+		return
+	}
+
+	status := e.writer.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if e.filter.Backend != "" && e.filter.Backend != e.backend {
+		return
+	}
+	if !e.filter.matchStatus(status) {
+		return
+	}
+
+	e.request.Body, e.request.BodyTruncated = e.reqBody.String(), e.reqBody.truncated
+	e.capturer.write(&Record{
+		Time:     e.start.UTC(),
+		Duration: time.Since(e.start),
+		Backend:  e.backend,
+		Request:  e.request,
+		Response: ResponseRecord{
+			Status:        status,
+			Header:        redact(e.writer.Header()),
+			Body:          e.writer.body.String(),
+			BodyTruncated: e.writer.body.truncated,
+		},
+	})
+}
+
+func redact(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redacted {
+		if _, ok := out[name]; ok {
+			out[name] = []string{"[redacted]"}
+		}
+	}
+	return out
+}
+
+// limitedBuffer keeps the first limit bytes written to it and notes whether
+// anything was dropped.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return strings.ToValidUTF8(b.Buffer.String(), "�")
+}
+
+type teeBody struct {
+	io.ReadCloser
+	tee io.Writer
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.tee.Write(p[:n])
+	}
+	return n, err
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	body   *limitedBuffer
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseWriter) Flush() {
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := rw.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
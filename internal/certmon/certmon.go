@@ -0,0 +1,120 @@
+package certmon
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+type Options struct {
+	Interval time.Duration
+	// Warning is how long before expiry a certificate counts as expiring.
+	Warning time.Duration
+	// Timeout bounds each probe.
+	Timeout time.Duration
+}
+
+type Monitor struct {
+	pool      *backend.Pool
+	opts      Options
+	collector *metrics.Collector
+	logger    *slog.Logger
+
+	mutex  sync.Mutex
+	warned map[*backend.Backend]bool
+}
+
+// NewMonitor watches the HTTPS backends in pool. A nil collector only logs.
+func NewMonitor(pool *backend.Pool, opts Options, collector *metrics.Collector, logger *slog.Logger) *Monitor {
+	return &Monitor{
+		pool:      pool,
+		opts:      opts,
+		collector: collector,
+		logger:    logger,
+		warned:    make(map[*backend.Backend]bool),
+	}
+}
+
+func (m *Monitor) Start(ctx context.Context) {
+	goroutines.Go("certmon", func() { m.run(ctx) })
+}
+
+func (m *Monitor) run(ctx context.Context) {
+	m.Check(ctx, time.Now())
+
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.Check(ctx, now)
+		}
+	}
+}
+
+// Forget drops whether b was warned about, for backends that left the pool.
+func (m *Monitor) Forget(b *backend.Backend) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.warned, b)
+}
+
+// Check probes every HTTPS backend once and reports the certificate expiry
+// relative to now. A backend that cannot be reached keeps the expiry seen in
+// its last handshake.
+func (m *Monitor) Check(ctx context.Context, now time.Time) {
+	for _, b := range m.pool.Backends() {
+		if b.URL().Scheme != "https" {
+			continue
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+		err := b.ProbeCertificate(probeCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			m.logger.Debug("Failed to probe backend certificate",
+				slog.String("backend", b.Name()),
+				slog.Any("err", err))
+		}
+
+		expiry, ok := b.CertificateExpiry()
+		if !ok {
+			continue
+		}
+		expiring := expiry.Sub(now) < m.opts.Warning
+
+		m.mutex.Lock()
+		warned := m.warned[b]
+		m.warned[b] = expiring
+		m.mutex.Unlock()
+
+		switch {
+		case expiring && !warned:
+			m.logger.Warn("Backend certificate expires soon",
+				slog.String("backend", b.Name()),
+				slog.Time("expiry", expiry),
+				slog.Duration("remaining", expiry.Sub(now).Round(time.Minute)))
+		case !expiring && warned:
+			m.logger.Info("Backend certificate renewed",
+				slog.String("backend", b.Name()),
+				slog.Time("expiry", expiry))
+		}
+
+		if m.collector != nil {
+			m.collector.Emit(metrics.MetricEvent{
+				Type:      metrics.EventCertificateChecked,
+				Timestamp: now,
+				Backend:   b.Name(),
+				Expiry:    expiry,
+				Expiring:  expiring,
+			})
+		}
+	}
+}
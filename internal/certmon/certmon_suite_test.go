@@ -0,0 +1,13 @@
+package certmon_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCertmon(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Certmon Suite")
+}
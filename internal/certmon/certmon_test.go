@@ -0,0 +1,77 @@
+package certmon_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/certmon"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+var _ = Describe("Monitor", func() {
+	var (
+		server     *httptest.Server
+		tlsBackend *backend.Backend
+		collector  *metrics.Collector
+		logs       bytes.Buffer
+		monitor    *certmon.Monitor
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		DeferCleanup(server.Close)
+
+		u, _ := url.Parse(server.URL)
+		tlsBackend = backend.New(u, 1)
+		plain, _ := url.Parse("http://localhost:8081")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		collector = metrics.NewCollector(10, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		collector.Start(ctx)
+
+		logs.Reset()
+		monitor = certmon.NewMonitor(backend.NewPool([]*backend.Backend{tlsBackend, backend.New(plain, 1)}), certmon.Options{
+			Interval: time.Hour,
+			Warning:  14 * 24 * time.Hour,
+			Timeout:  time.Second,
+		}, collector, slog.New(slog.NewTextHandler(&logs, nil)))
+	})
+
+	It("should report the days left for HTTPS backends only", func() {
+		now := time.Now()
+		monitor.Check(context.Background(), now)
+
+		Eventually(func() map[string]metrics.BackendMetrics {
+			return collector.Snapshot("round-robin").Backends
+		}).Should(HaveKey(tlsBackend.Name()))
+
+		bm := collector.Snapshot("round-robin").Backends[tlsBackend.Name()]
+		Expect(bm.CertificateExpiresInDays).NotTo(BeNil())
+		Expect(*bm.CertificateExpiresInDays).To(BeNumerically("~", time.Until(server.Certificate().NotAfter).Hours()/24, 0.01))
+		Expect(bm.CertificateExpiring).To(BeFalse())
+		Expect(collector.Snapshot("round-robin").Backends).To(HaveLen(1))
+		Expect(logs.String()).NotTo(ContainSubstring("expires soon"))
+	})
+
+	It("should warn once when the certificate enters the warning period", func() {
+		late := server.Certificate().NotAfter.Add(-24 * time.Hour)
+		monitor.Check(context.Background(), late)
+		monitor.Check(context.Background(), late)
+
+		Expect(bytes.Count(logs.Bytes(), []byte("Backend certificate expires soon"))).To(Equal(1))
+		Eventually(func() bool {
+			return collector.Snapshot("round-robin").Backends[tlsBackend.Name()].CertificateExpiring
+		}).Should(BeTrue())
+	})
+})
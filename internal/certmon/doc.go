@@ -0,0 +1,18 @@
+// Package certmon watches the TLS certificates of HTTPS backends and warns
+// before they expire.
+//
+// Backends record the certificate expiry seen in every handshake. Because
+// pooled connections live long, a Monitor also probes each HTTPS backend
+// periodically with a fresh handshake, reports the days left in the backend
+// metrics and logs a warning once a certificate is within the warning period,
+// catching internal certificates that were not renewed in time.
+//
+// Usage:
+//
+//	mon := certmon.NewMonitor(pool, certmon.Options{
+//		Interval: time.Hour,
+//		Warning:  14 * 24 * time.Hour,
+//		Timeout:  5 * time.Second,
+//	}, collector, logger)
+//	mon.Start(ctx)
+package certmon
@@ -1,6 +1,7 @@
 package circuitbreaker
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
@@ -67,12 +68,58 @@ func (cb *CircuitBreaker) RecordFailure() {
 	}
 }
 
+// RetryAfter returns how long an open circuit keeps rejecting requests before
+// it lets a probe through, or zero if it allows requests now.
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state != StateOpen {
+		return 0
+	}
+
+	remaining := cb.resetTimeout - time.Since(cb.lastFailure)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
 func (cb *CircuitBreaker) State() State {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 	return cb.state
 }
 
+// Failures returns the failures counted since the last success.
+func (cb *CircuitBreaker) Failures() int {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.failures
+}
+
+// Restore puts the breaker into state with failures counted, e.g. to carry
+// another instance's breaker over. An open breaker keeps rejecting requests
+// for retryAfter before it lets a probe through.
+func (cb *CircuitBreaker) Restore(state State, failures int, retryAfter time.Duration) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.state = state
+	cb.failures = failures
+	cb.lastFailure = time.Now().Add(retryAfter - cb.resetTimeout)
+}
+
+// ParseState is the inverse of State.String.
+func ParseState(s string) (State, error) {
+	for _, state := range []State{StateClosed, StateOpen, StateHalfOpen} {
+		if state.String() == s {
+			return state, nil
+		}
+	}
+	return StateClosed, fmt.Errorf("unknown circuit state %q", s)
+}
+
 func (s State) String() string {
 	switch s {
 		case StateClosed:
@@ -69,6 +69,13 @@ var _ = Describe("CircuitBreaker", func() {
 				Expect(cb.Allow()).To(BeFalse())
 				Expect(cb.State()).To(Equal(circuitbreaker.StateOpen))
 			})
+
+			It("should report the time left until the reset timeout", func() {
+				Expect(cb.RetryAfter()).To(BeNumerically("~", 100*time.Millisecond, 20*time.Millisecond))
+
+				time.Sleep(150 * time.Millisecond)
+				Expect(cb.RetryAfter()).To(BeZero())
+			})
 		})
 
 		Context("when in HALF-OPEN state", func() {
@@ -85,6 +92,7 @@ var _ = Describe("CircuitBreaker", func() {
 
 			It("should allow the probe request", func() {
 				Expect(cb.Allow()).To(BeTrue())
+				Expect(cb.RetryAfter()).To(BeZero())
 			})
 
 			It("should transition to CLOSED on success", func() {
@@ -130,6 +138,42 @@ var _ = Describe("CircuitBreaker", func() {
 		})
 	})
 
+	Describe("Restore", func() {
+		BeforeEach(func() {
+			cb = circuitbreaker.NewCircuitBreaker(3, time.Minute)
+		})
+
+		It("should keep an open circuit open for the remaining time only", func() {
+			cb.Restore(circuitbreaker.StateOpen, 3, 50*time.Millisecond)
+			Expect(cb.State()).To(Equal(circuitbreaker.StateOpen))
+			Expect(cb.Failures()).To(Equal(3))
+			Expect(cb.Allow()).To(BeFalse())
+
+			time.Sleep(80 * time.Millisecond)
+			Expect(cb.Allow()).To(BeTrue())
+			Expect(cb.State()).To(Equal(circuitbreaker.StateHalfOpen))
+		})
+
+		It("should carry failures of a closed circuit towards the threshold", func() {
+			cb.Restore(circuitbreaker.StateClosed, 2, 0)
+			cb.RecordFailure()
+			Expect(cb.State()).To(Equal(circuitbreaker.StateOpen))
+		})
+	})
+
+	Describe("ParseState", func() {
+		It("should parse what String returns", func() {
+			for _, s := range []circuitbreaker.State{circuitbreaker.StateClosed, circuitbreaker.StateOpen, circuitbreaker.StateHalfOpen} {
+				parsed, err := circuitbreaker.ParseState(s.String())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(parsed).To(Equal(s))
+			}
+
+			_, err := circuitbreaker.ParseState("ajar")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("State.String", func() {
 		It("should return correct string representation", func() {
 			Expect(circuitbreaker.StateClosed.String()).To(Equal("CLOSED"))
@@ -0,0 +1,55 @@
+package cron_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/cron"
+)
+
+var _ = Describe("Expression", func() {
+	// Wednesday 2026-01-07 10:30 UTC.
+	base := time.Date(2026, time.January, 7, 10, 30, 0, 0, time.UTC)
+
+	next := func(spec string, from time.Time) time.Time {
+		expr, err := cron.Parse(spec)
+		Expect(err).NotTo(HaveOccurred())
+		return expr.Next(from)
+	}
+
+	It("should fire on the next matching minute strictly after the given time", func() {
+		Expect(next("* * * * *", base)).To(Equal(base.Add(time.Minute)))
+		Expect(next("30 10 * * *", base)).To(Equal(base.AddDate(0, 0, 1)))
+		Expect(next("30 10 * * *", base.Add(-time.Second))).To(Equal(base))
+	})
+
+	It("should support ranges, lists and steps", func() {
+		Expect(next("*/15 * * * *", base)).To(Equal(base.Add(15 * time.Minute)))
+		Expect(next("0 9-17/4 * * *", base)).To(Equal(time.Date(2026, 1, 7, 13, 0, 0, 0, time.UTC)))
+		Expect(next("0 2 1,15 * *", base)).To(Equal(time.Date(2026, 1, 15, 2, 0, 0, 0, time.UTC)))
+	})
+
+	It("should treat 0 and 7 as Sunday", func() {
+		sunday := time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC)
+		Expect(next("0 0 * * 0", base)).To(Equal(sunday))
+		Expect(next("0 0 * * 7", base)).To(Equal(sunday))
+	})
+
+	It("should match either day field when both are restricted", func() {
+		// The 20th, or any Friday, whichever comes first.
+		Expect(next("0 0 20 * 5", base)).To(Equal(time.Date(2026, 1, 9, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("should return the zero time for expressions that never match", func() {
+		Expect(next("0 0 31 2 *", base).IsZero()).To(BeTrue())
+	})
+
+	It("should reject malformed expressions", func() {
+		for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+			_, err := cron.Parse(spec)
+			Expect(err).To(HaveOccurred(), spec)
+		}
+	})
+})
@@ -0,0 +1,17 @@
+// Package cron parses standard five-field cron expressions and computes
+// when they next fire.
+//
+// The fields are minute, hour, day of month, month and day of week. Each
+// accepts "*", single values, ranges ("1-5"), lists ("1,15") and steps
+// ("*/15", "0-30/10"). Day of week runs from 0 (Sunday) to 6; 7 is accepted
+// as Sunday too. As in classic cron, when both day fields are restricted a
+// time matches if either does.
+//
+// Usage:
+//
+//	expr, err := cron.Parse("0 2 * * 1-5")
+//	if err != nil {
+//		return err
+//	}
+//	next := expr.Next(time.Now())
+package cron
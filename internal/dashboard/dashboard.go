@@ -0,0 +1,237 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Options configures the generated dashboard. Selector is added to the
+// label matchers of every query, e.g. `job="lb"`, for Prometheus servers
+// holding more than one balancer fleet.
+type Options struct {
+	Title    string
+	UID      string
+	Selector string
+	Refresh  string
+}
+
+type Dashboard struct {
+	UID           string     `json:"uid,omitempty"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []Panel    `json:"panels"`
+}
+
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+type Variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label"`
+	Type       string      `json:"type"`
+	Query      interface{} `json:"query"`
+	Datasource *Datasource `json:"datasource,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+	AllValue   string      `json:"allValue,omitempty"`
+}
+
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type Panel struct {
+	ID          int         `json:"id"`
+	Type        string      `json:"type"`
+	Title       string      `json:"title"`
+	GridPos     GridPos     `json:"gridPos"`
+	Datasource  Datasource  `json:"datasource"`
+	Targets     []Target    `json:"targets"`
+	FieldConfig FieldConfig `json:"fieldConfig"`
+}
+
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+type FieldConfig struct {
+	Defaults FieldDefaults `json:"defaults"`
+}
+
+type FieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+var datasource = Datasource{Type: "prometheus", UID: "${datasource}"}
+
+// panel describes one panel. SEL in its queries is replaced by the label
+// matchers of the dashboard variables, and INST by those without the backend
+// for series that have no backend label.
+type panel struct {
+	kind    string
+	title   string
+	unit    string
+	width   int
+	queries []Target
+}
+
+var panels = []panel{
+	{"stat", "Healthy backends", "none", 6, []Target{
+		{Expr: `sum(lb_backend_healthy{SEL})`},
+	}},
+	{"stat", "Request rate", "reqps", 6, []Target{
+		{Expr: `sum(rate(lb_requests_total{INST}[$__rate_interval]))`},
+	}},
+	{"stat", "Balancer 5xx rate", "reqps", 6, []Target{
+		{Expr: `sum(rate(lb_errors_total{source="lb",INST}[$__rate_interval]))`},
+	}},
+	{"stat", "Upstream 5xx rate", "reqps", 6, []Target{
+		{Expr: `sum(rate(lb_errors_total{source="upstream",INST}[$__rate_interval]))`},
+	}},
+	{"timeseries", "Backend health", "none", 12, []Target{
+		{Expr: `min by (backend) (lb_backend_healthy{SEL})`, LegendFormat: "{{backend}}"},
+	}},
+	{"timeseries", "Requests by backend", "reqps", 12, []Target{
+		{Expr: `sum by (backend) (rate(lb_backend_requests_total{SEL}[$__rate_interval]))`, LegendFormat: "{{backend}}"},
+	}},
+	{"timeseries", "p95 response time", "s", 12, []Target{
+		{Expr: `max by (backend) (lb_backend_response_seconds{quantile="0.95",SEL})`, LegendFormat: "{{backend}}"},
+	}},
+	{"timeseries", "p99 response time", "s", 12, []Target{
+		{Expr: `max by (backend) (lb_backend_response_seconds{quantile="0.99",SEL})`, LegendFormat: "{{backend}}"},
+	}},
+	{"timeseries", "Responses by status code", "reqps", 12, []Target{
+		{Expr: `sum by (code) (rate(lb_backend_responses_total{SEL}[$__rate_interval]))`, LegendFormat: "{{code}}"},
+	}},
+	{"timeseries", "5xx by source", "reqps", 12, []Target{
+		{Expr: `sum by (source, code) (rate(lb_errors_total{INST}[$__rate_interval]))`, LegendFormat: "{{source}} {{code}}"},
+	}},
+	{"timeseries", "Client cancellations and affinity failovers", "reqps", 12, []Target{
+		{Expr: `sum by (backend) (rate(lb_backend_client_canceled_total{SEL}[$__rate_interval]))`, LegendFormat: "canceled {{backend}}"},
+		{Expr: `sum by (backend) (rate(lb_backend_affinity_failovers_total{SEL}[$__rate_interval]))`, LegendFormat: "failover {{backend}}"},
+	}},
+	{"timeseries", "Days until certificate expiry", "d", 12, []Target{
+		{Expr: `min by (backend) (lb_backend_certificate_expires_in_days{SEL})`, LegendFormat: "{{backend}}"},
+	}},
+}
+
+// New builds a dashboard of backend health, traffic, latency and error
+// panels over the series the balancer pushes with remote write. It has
+// variables for the Prometheus data source and to filter by the instance
+// and backend labels.
+func New(opts Options) Dashboard {
+	if opts.Title == "" {
+		opts.Title = "Load Balancer"
+	}
+	if opts.Refresh == "" {
+		opts.Refresh = "30s"
+	}
+
+	instance := matchers(opts.Selector, `instance=~"$instance"`)
+	replacer := strings.NewReplacer("SEL", matchers(instance, `backend=~"$backend"`), "INST", instance)
+
+	d := Dashboard{
+		UID:           opts.UID,
+		Title:         opts.Title,
+		Tags:          []string{"load-balancer"},
+		Timezone:      "browser",
+		SchemaVersion: 39,
+		Refresh:       opts.Refresh,
+		Time:          TimeRange{From: "now-1h", To: "now"},
+		Templating: Templating{List: []Variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			labelVariable("instance", "Instance", "label_values("+series("lb_requests_total", opts.Selector)+", instance)"),
+			labelVariable("backend", "Backend", "label_values("+series("lb_backend_healthy", instance)+", backend)"),
+		}},
+	}
+
+	x, y := 0, 0
+	for i, p := range panels {
+		if x+p.width > 24 {
+			x = 0
+			y += height(panels[i-1])
+		}
+
+		targets := make([]Target, len(p.queries))
+		for j, t := range p.queries {
+			t.RefID = string(rune('A' + j))
+			t.Expr = replacer.Replace(t.Expr)
+			targets[j] = t
+		}
+
+		d.Panels = append(d.Panels, Panel{
+			ID:          i + 1,
+			Type:        p.kind,
+			Title:       p.title,
+			GridPos:     GridPos{H: height(p), W: p.width, X: x, Y: y},
+			Datasource:  datasource,
+			Targets:     targets,
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: p.unit}},
+		})
+		x += p.width
+	}
+	return d
+}
+
+// Generate returns the dashboard as indented JSON, ready for Grafana's
+// dashboard import.
+func Generate(opts Options) ([]byte, error) {
+	return json.MarshalIndent(New(opts), "", "  ")
+}
+
+func matchers(selector, matcher string) string {
+	if selector == "" {
+		return matcher
+	}
+	return selector + "," + matcher
+}
+
+func series(name, matchers string) string {
+	if matchers == "" {
+		return name
+	}
+	return name + "{" + matchers + "}"
+}
+
+func labelVariable(name, label, query string) Variable {
+	return Variable{
+		Name:       name,
+		Label:      label,
+		Type:       "query",
+		Query:      query,
+		Datasource: &datasource,
+		Refresh:    2,
+		IncludeAll: true,
+		Multi:      true,
+		AllValue:   ".*",
+	}
+}
+
+func height(p panel) int {
+	if p.kind == "stat" {
+		return 4
+	}
+	return 8
+}
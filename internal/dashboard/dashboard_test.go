@@ -0,0 +1,81 @@
+package dashboard_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/dashboard"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/remotewrite"
+)
+
+var _ = Describe("Dashboard", func() {
+	It("should only query series the balancer pushes", func() {
+		days := 30.0
+		snap := metrics.Snapshot{
+			Backends: map[string]metrics.BackendMetrics{"api-1": {
+				StatusCodes:              map[int]int64{200: 1},
+				CertificateExpiresInDays: &days,
+			}},
+			Errors:    metrics.ErrorCounts{LB: map[int]int64{503: 1}},
+			Endpoints: map[string]metrics.EndpointMetrics{"GET /users/{id}": {}},
+		}
+		pushed := map[string]bool{}
+		for _, s := range remotewrite.Series(snap, time.Now(), nil) {
+			pushed[s.Labels[0].Value] = true
+		}
+
+		names := regexp.MustCompile(`lb_[a-z_]+`)
+		d := dashboard.New(dashboard.Options{})
+		Expect(d.Panels).NotTo(BeEmpty())
+		for _, p := range d.Panels {
+			for _, t := range p.Targets {
+				for _, name := range names.FindAllString(t.Expr, -1) {
+					Expect(pushed).To(HaveKey(name), "panel %q", p.Title)
+				}
+			}
+		}
+	})
+
+	It("should filter every query by the selector and the variables", func() {
+		d := dashboard.New(dashboard.Options{Selector: `job="lb"`})
+
+		for _, p := range d.Panels {
+			Expect(p.Datasource.UID).To(Equal("${datasource}"))
+			for _, t := range p.Targets {
+				Expect(t.Expr).To(ContainSubstring(`job="lb",instance=~"$instance"`))
+				Expect(t.Expr).NotTo(ContainSubstring("SEL"))
+			}
+		}
+		Expect(d.Panels[5].Targets[0].Expr).To(Equal(`sum by (backend) (rate(lb_backend_requests_total{job="lb",instance=~"$instance",backend=~"$backend"}[$__rate_interval]))`))
+		Expect(d.Templating.List[1].Query).To(Equal(`label_values(lb_requests_total{job="lb"}, instance)`))
+	})
+
+	It("should lay panels out without overlapping", func() {
+		d := dashboard.New(dashboard.Options{})
+
+		for i, a := range d.Panels {
+			Expect(a.GridPos.X + a.GridPos.W).To(BeNumerically("<=", 24))
+			for _, b := range d.Panels[i+1:] {
+				overlap := a.GridPos.X < b.GridPos.X+b.GridPos.W && b.GridPos.X < a.GridPos.X+a.GridPos.W &&
+					a.GridPos.Y < b.GridPos.Y+b.GridPos.H && b.GridPos.Y < a.GridPos.Y+a.GridPos.H
+				Expect(overlap).To(BeFalse(), "%q and %q", a.Title, b.Title)
+			}
+		}
+	})
+
+	It("should generate importable JSON", func() {
+		data, err := dashboard.Generate(dashboard.Options{Title: "Edge", UID: "edge-lb"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		Expect(decoded).To(HaveKeyWithValue("title", "Edge"))
+		Expect(decoded).To(HaveKeyWithValue("uid", "edge-lb"))
+		Expect(decoded["panels"]).To(HaveLen(12))
+	})
+})
@@ -0,0 +1,15 @@
+// Package dashboard generates a Grafana dashboard over the metrics the
+// balancer pushes with remote write: backend health, request rates,
+// response time quantiles, status codes, 5xx by source, affinity failovers
+// and certificate expiry. Queries use the series names of package
+// remotewrite, and variables select the Prometheus data source and filter by
+// instance and backend.
+//
+// Usage:
+//
+//	data, err := dashboard.Generate(dashboard.Options{
+//		Title:    "Load Balancer",
+//		Selector: `job="lb"`,
+//	})
+//	os.WriteFile("dashboard.json", data, 0o644)
+package dashboard
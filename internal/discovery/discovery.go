@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/angeloszaimis/load-balancer/config"
+)
+
+// BackendSpec describes one backend a provider discovered. A zero Weight
+// means 1. MaxConnections and MaxInFlight limit the backend like the
+// settings of the same name in the backends section; zero means no limit.
+type BackendSpec struct {
+	Name           string `mapstructure:"name" json:"name,omitempty"`
+	URL            string `mapstructure:"url" json:"url"`
+	Weight         int    `mapstructure:"weight" json:"weight,omitempty"`
+	Zone           string `mapstructure:"zone" json:"zone,omitempty"`
+	Priority       int    `mapstructure:"priority" json:"priority,omitempty"`
+	MaxConnections int    `mapstructure:"max_connections" json:"max_connections,omitempty"`
+	MaxInFlight    int    `mapstructure:"max_in_flight" json:"max_in_flight,omitempty"`
+}
+
+// Provider discovers the backends to balance over. Subscribe sends the full
+// list of backends whenever it changes, starting with the current one, and
+// closes the channel once ctx is done. A consumer that falls behind only
+// gets the latest list.
+type Provider interface {
+	Subscribe(ctx context.Context) <-chan []BackendSpec
+}
+
+// Validate checks every spec and rejects specs pointing at the same server
+// or sharing a name.
+func Validate(specs []BackendSpec) error {
+	urls := make(map[string]int, len(specs))
+	names := make(map[string]int, len(specs))
+	for i, s := range specs {
+		err := validation.ValidateStruct(&s,
+			validation.Field(&s.URL, validation.Required, validation.By(validateURL)),
+			validation.Field(&s.Weight, validation.Min(0)),
+			validation.Field(&s.Priority, validation.Min(0)),
+			validation.Field(&s.MaxConnections, validation.Min(0)),
+			validation.Field(&s.MaxInFlight, validation.Min(0)),
+		)
+		if err != nil {
+			return fmt.Errorf("backend %d: %w", i, err)
+		}
+
+		normalized, _ := config.NormalizeURL(s.URL)
+		if first, dup := urls[normalized]; dup {
+			return fmt.Errorf("backends %d and %d both point at %s", first, i, normalized)
+		}
+		urls[normalized] = i
+
+		if s.Name == "" {
+			continue
+		}
+		if first, dup := names[s.Name]; dup {
+			return fmt.Errorf("backends %d and %d are both named %s", first, i, s.Name)
+		}
+		names[s.Name] = i
+	}
+	return nil
+}
+
+func validateURL(value interface{}) error {
+	raw, _ := value.(string)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return validation.NewError("validation_invalid_url", "must be a valid URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return validation.NewError("validation_invalid_scheme", "URL must use http or https scheme")
+	}
+	if u.Host == "" {
+		return validation.NewError("validation_missing_host", "URL must have a host")
+	}
+	return nil
+}
+
+// normalize fills in default weights and canonical URLs, so that a list that
+// did not really change compares equal.
+func normalize(specs []BackendSpec) []BackendSpec {
+	out := make([]BackendSpec, len(specs))
+	for i, s := range specs {
+		if s.Weight == 0 {
+			s.Weight = 1
+		}
+		if normalized, err := config.NormalizeURL(s.URL); err == nil {
+			s.URL = normalized
+		}
+		out[i] = s
+	}
+	return out
+}
+
+// publish replaces whatever list ch still holds with specs.
+func publish(ch chan []BackendSpec, specs []BackendSpec) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- specs
+}
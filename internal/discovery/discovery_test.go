@@ -0,0 +1,165 @@
+package discovery_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/discovery"
+)
+
+var _ = Describe("Validate", func() {
+	It("should accept valid specs", func() {
+		Expect(discovery.Validate([]discovery.BackendSpec{
+			{URL: "http://10.0.0.1:8080"},
+			{Name: "checkout", URL: "https://10.0.0.2", Weight: 3, Priority: 2},
+		})).To(Succeed())
+	})
+
+	It("should reject invalid specs", func() {
+		for _, specs := range [][]discovery.BackendSpec{
+			{{URL: ""}},
+			{{URL: "ftp://10.0.0.1"}},
+			{{URL: "http://"}},
+			{{URL: "http://10.0.0.1", Weight: -1}},
+			{{URL: "http://10.0.0.1", Priority: -1}},
+			{{URL: "http://10.0.0.1", MaxConnections: -1}},
+			{{URL: "http://10.0.0.1", MaxInFlight: -1}},
+			{{URL: "http://10.0.0.1:80"}, {URL: "HTTP://10.0.0.1/"}},
+			{{Name: "a", URL: "http://10.0.0.1"}, {Name: "a", URL: "http://10.0.0.2"}},
+		} {
+			Expect(discovery.Validate(specs)).NotTo(Succeed(), "%+v", specs)
+		}
+	})
+})
+
+var _ = Describe("FileProvider", func() {
+	var (
+		path     string
+		modified time.Time
+		provider *discovery.FileProvider
+	)
+
+	// write bumps the modification time explicitly so consecutive writes
+	// within the filesystem's timestamp resolution are still detected.
+	write := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		modified = modified.Add(time.Second)
+		Expect(os.Chtimes(path, modified, modified)).To(Succeed())
+	}
+
+	subscribe := func() <-chan []discovery.BackendSpec {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		return provider.Subscribe(ctx)
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "backends.yaml")
+		modified = time.Now()
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		provider = discovery.NewFileProvider(path, 10*time.Millisecond, log)
+	})
+
+	It("should send the current backends, normalized, on subscribe", func() {
+		write(`
+backends:
+  - url: "HTTP://10.0.0.1:80/"
+  - name: "checkout"
+    url: "http://10.0.0.2:8080"
+    weight: 3
+    zone: "eu-west-1a"
+`)
+		Eventually(subscribe()).Should(Receive(Equal([]discovery.BackendSpec{
+			{URL: "http://10.0.0.1", Weight: 1},
+			{Name: "checkout", URL: "http://10.0.0.2:8080", Weight: 3, Zone: "eu-west-1a"},
+		})))
+	})
+
+	It("should read JSON files", func() {
+		path = filepath.Join(filepath.Dir(path), "backends.json")
+		write(`{"backends": [{"url": "http://10.0.0.1:8080", "priority": 2, "max_in_flight": 8}]}`)
+		provider = discovery.NewFileProvider(path, 10*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		Eventually(subscribe()).Should(Receive(Equal([]discovery.BackendSpec{
+			{URL: "http://10.0.0.1:8080", Weight: 1, Priority: 2, MaxInFlight: 8},
+		})))
+	})
+
+	It("should send changes but not rewrites of the same list", func() {
+		write("backends:\n  - url: \"http://10.0.0.1:8080\"\n")
+		ch := subscribe()
+		Eventually(ch).Should(Receive(HaveLen(1)))
+
+		write("backends:\n  - url: \"http://10.0.0.1:8080\"\n    weight: 1\n")
+		Consistently(ch, 100*time.Millisecond).ShouldNot(Receive())
+
+		write("backends:\n  - url: \"http://10.0.0.1:8080\"\n  - url: \"http://10.0.0.2:8080\"\n")
+		Eventually(ch).Should(Receive(HaveLen(2)))
+	})
+
+	It("should keep the last list while the file is invalid or missing", func() {
+		write("backends:\n  - url: \"http://10.0.0.1:8080\"\n")
+		ch := subscribe()
+		Eventually(ch).Should(Receive(HaveLen(1)))
+
+		write("backends:\n  - url: \"ftp://10.0.0.1\"\n")
+		Consistently(ch, 100*time.Millisecond).ShouldNot(Receive())
+
+		Expect(os.Remove(path)).To(Succeed())
+		Consistently(ch, 100*time.Millisecond).ShouldNot(Receive())
+
+		write("")
+		Consistently(ch, 100*time.Millisecond).ShouldNot(Receive())
+
+		write("backends: []\n")
+		Consistently(ch, 100*time.Millisecond).ShouldNot(Receive())
+
+		write("backends:\n  - url: \"http://10.0.0.2:8080\"\n")
+		Eventually(ch).Should(Receive(HaveLen(1)))
+	})
+
+	It("should send an empty list only while it has sent no backends", func() {
+		write("backends: []\n")
+		Eventually(subscribe()).Should(Receive(BeEmpty()))
+
+		_, err := discovery.LoadFile(filepath.Join(GinkgoT().TempDir(), "missing.yaml"))
+		Expect(err).To(HaveOccurred())
+		write("")
+		_, err = discovery.LoadFile(path)
+		Expect(err).To(MatchError(ContainSubstring("is empty")))
+	})
+
+	It("should wait for a file that does not exist yet", func() {
+		ch := subscribe()
+		Consistently(ch, 50*time.Millisecond).ShouldNot(Receive())
+
+		write("backends:\n  - url: \"http://10.0.0.1:8080\"\n")
+		Eventually(ch).Should(Receive(HaveLen(1)))
+	})
+
+	It("should notice changes without waiting for the poll", func() {
+		write("backends:\n  - url: \"http://10.0.0.1:8080\"\n")
+		provider = discovery.NewFileProvider(path, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		ch := subscribe()
+		Eventually(ch).Should(Receive(HaveLen(1)))
+
+		replacement := path + ".tmp"
+		Expect(os.WriteFile(replacement, []byte("backends:\n  - url: \"http://10.0.0.1:8080\"\n  - url: \"http://10.0.0.2:8080\"\n"), 0o644)).To(Succeed())
+		Expect(os.Rename(replacement, path)).To(Succeed())
+		Eventually(ch).Should(Receive(HaveLen(2)))
+	})
+
+	It("should close the channel once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := provider.Subscribe(ctx)
+		cancel()
+		Eventually(ch).Should(BeClosed())
+	})
+})
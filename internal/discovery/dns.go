@@ -0,0 +1,193 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+// DNS record types a DNSProvider follows.
+const (
+	// RecordA resolves the URL's host to its A and AAAA records, one backend
+	// per address on the URL's port.
+	RecordA = "a"
+	// RecordSRV looks up the URL's host as an SRV name, one backend per
+	// target and port.
+	RecordSRV = "srv"
+)
+
+// DNSResolver looks up the records a DNSProvider follows. *net.Resolver
+// satisfies it.
+type DNSResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSProvider discovers backends by re-resolving one DNS name every interval,
+// such as a headless Kubernetes service or a cloud DNS record. Every record
+// becomes a backend like the template spec, with the record's address in
+// the URL and, when the template is named, the address appended to the name.
+// SRV records also carry their weight, and each lower SRV priority is
+// placed in the next failover tier. A failed lookup is reported and leaves
+// the last list in place.
+type DNSProvider struct {
+	spec     BackendSpec
+	record   string
+	resolver DNSResolver
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func NewDNSProvider(spec BackendSpec, record string, resolver DNSResolver, interval time.Duration, logger *slog.Logger) *DNSProvider {
+	return &DNSProvider{spec: spec, record: record, resolver: resolver, interval: interval, logger: logger}
+}
+
+// Resolve looks the name up once and returns the backends its records
+// describe, sorted by URL.
+func (p *DNSProvider) Resolve(ctx context.Context) ([]BackendSpec, error) {
+	u, err := url.Parse(p.spec.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []BackendSpec
+	switch p.record {
+	case RecordSRV:
+		specs, err = p.resolveSRV(ctx, u)
+	default:
+		specs, err = p.resolveA(ctx, u)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	specs = normalize(specs)
+	slices.SortFunc(specs, func(a, b BackendSpec) int { return strings.Compare(a.URL, b.URL) })
+	return specs, nil
+}
+
+func (p *DNSProvider) resolveA(ctx context.Context, u *url.URL) ([]BackendSpec, error) {
+	addrs, err := p.resolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[netip.Addr]bool, len(addrs))
+	specs := make([]BackendSpec, 0, len(addrs))
+	for _, a := range addrs {
+		ip, ok := netip.AddrFromSlice(a.IP)
+		if !ok {
+			continue
+		}
+		ip = ip.Unmap()
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+
+		host := ip.String()
+		if port := u.Port(); port != "" {
+			host = net.JoinHostPort(host, port)
+		} else if ip.Is6() {
+			host = "[" + host + "]"
+		}
+		specs = append(specs, p.derive(u, host, ip.String()))
+	}
+	return specs, nil
+}
+
+func (p *DNSProvider) resolveSRV(ctx context.Context, u *url.URL) ([]BackendSpec, error) {
+	_, records, err := p.resolver.LookupSRV(ctx, "", "", u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	var priorities []uint16
+	for _, r := range records {
+		if !slices.Contains(priorities, r.Priority) {
+			priorities = append(priorities, r.Priority)
+		}
+	}
+	slices.Sort(priorities)
+
+	specs := make([]BackendSpec, 0, len(records))
+	for _, r := range records {
+		host := net.JoinHostPort(strings.TrimSuffix(r.Target, "."), fmt.Sprint(r.Port))
+		s := p.derive(u, host, host)
+		if r.Weight > 0 {
+			s.Weight = int(r.Weight)
+		}
+		if tier := slices.Index(priorities, r.Priority); tier > 0 {
+			s.Priority = max(s.Priority, 1) + tier
+		}
+		specs = append(specs, s)
+	}
+	return specs, nil
+}
+
+// derive returns the template spec pointing at host instead, named after
+// suffix when the template is named.
+func (p *DNSProvider) derive(u *url.URL, host, suffix string) BackendSpec {
+	s := p.spec
+	resolved := *u
+	resolved.Host = host
+	s.URL = resolved.String()
+	if s.Name != "" {
+		s.Name += "@" + suffix
+	}
+	return s
+}
+
+func (p *DNSProvider) Subscribe(ctx context.Context) <-chan []BackendSpec {
+	ch := make(chan []BackendSpec, 1)
+	goroutines.Go("discovery", func() {
+		defer close(ch)
+		p.run(ctx, ch)
+	})
+	return ch
+}
+
+func (p *DNSProvider) run(ctx context.Context, ch chan []BackendSpec) {
+	var last []BackendSpec
+	check := func() {
+		specs, err := p.Resolve(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Warn("DNS discovery failed, keeping current backends",
+					slog.String("url", p.spec.URL),
+					slog.Any("error", err))
+			}
+			return
+		}
+		if last != nil && slices.Equal(specs, last) {
+			return
+		}
+		p.logger.Info("Discovered backends",
+			slog.String("url", p.spec.URL),
+			slog.Int("backends", len(specs)))
+		last = specs
+		publish(ch, specs)
+	}
+
+	check()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package discovery_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/discovery"
+)
+
+type fakeDNS struct {
+	mu   sync.Mutex
+	ips  []string
+	srvs []*net.SRV
+	err  error
+}
+
+func (f *fakeDNS) set(ips ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ips, f.err = ips, nil
+}
+
+func (f *fakeDNS) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeDNS) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	addrs := make([]net.IPAddr, 0, len(f.ips))
+	for _, ip := range f.ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func (f *fakeDNS) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return name, f.srvs, f.err
+}
+
+var _ = Describe("DNSProvider", func() {
+	var (
+		resolver *fakeDNS
+		log      *slog.Logger
+	)
+
+	BeforeEach(func() {
+		resolver = &fakeDNS{}
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	})
+
+	It("should turn every address into a backend on the URL's port", func() {
+		resolver.set("10.0.0.2", "10.0.0.1", "10.0.0.1", "2001:db8::1")
+		provider := discovery.NewDNSProvider(discovery.BackendSpec{Name: "api", URL: "http://api.internal:8080", Zone: "eu-west-1a"}, discovery.RecordA, resolver, time.Second, log)
+
+		specs, err := provider.Resolve(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(specs).To(Equal([]discovery.BackendSpec{
+			{Name: "api@10.0.0.1", URL: "http://10.0.0.1:8080", Weight: 1, Zone: "eu-west-1a"},
+			{Name: "api@10.0.0.2", URL: "http://10.0.0.2:8080", Weight: 1, Zone: "eu-west-1a"},
+			{Name: "api@2001:db8::1", URL: "http://[2001:db8::1]:8080", Weight: 1, Zone: "eu-west-1a"},
+		}))
+	})
+
+	It("should take ports, weights and tiers from SRV records", func() {
+		resolver.srvs = []*net.SRV{
+			{Target: "b.api.internal.", Port: 9000, Priority: 10, Weight: 3},
+			{Target: "a.api.internal.", Port: 9000, Priority: 10},
+			{Target: "dr.api.internal.", Port: 9001, Priority: 20, Weight: 1},
+		}
+		provider := discovery.NewDNSProvider(discovery.BackendSpec{URL: "https://_api._tcp.internal", Weight: 2}, discovery.RecordSRV, resolver, time.Second, log)
+
+		specs, err := provider.Resolve(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(specs).To(Equal([]discovery.BackendSpec{
+			{URL: "https://a.api.internal:9000", Weight: 2},
+			{URL: "https://b.api.internal:9000", Weight: 3},
+			{URL: "https://dr.api.internal:9001", Weight: 1, Priority: 2},
+		}))
+	})
+
+	It("should send changes and keep the last list while lookups fail", func() {
+		resolver.set("10.0.0.1")
+		provider := discovery.NewDNSProvider(discovery.BackendSpec{URL: "http://api.internal"}, discovery.RecordA, resolver, 10*time.Millisecond, log)
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		updates := provider.Subscribe(ctx)
+
+		Eventually(updates).Should(Receive(Equal([]discovery.BackendSpec{{URL: "http://10.0.0.1", Weight: 1}})))
+
+		resolver.fail(errors.New("server misbehaving"))
+		Consistently(updates, 50*time.Millisecond).ShouldNot(Receive())
+
+		resolver.set("10.0.0.1", "10.0.0.2")
+		Eventually(updates).Should(Receive(HaveLen(2)))
+		Consistently(updates, 50*time.Millisecond).ShouldNot(Receive())
+	})
+})
+
+var _ = Describe("Sync", func() {
+	build := func(s discovery.BackendSpec) *backend.Backend {
+		u, err := url.Parse(s.URL)
+		Expect(err).NotTo(HaveOccurred())
+		return backend.New(u, s.Weight, backend.WithName(s.Name), backend.WithOrigin("http://api.internal"),
+			backend.WithPriority(s.Priority), backend.WithZone(s.Zone),
+			backend.WithMaxConnections(s.MaxConnections), backend.WithMaxInFlight(s.MaxInFlight))
+	}
+	owned := func(b *backend.Backend) bool { return b.Origin() == "http://api.internal" }
+
+	It("should add new backends, remove gone ones and keep the rest", func() {
+		static := backend.New(&url.URL{Scheme: "http", Host: "10.9.9.9"}, 1)
+		pool := backend.NewPool([]*backend.Backend{static})
+
+		added, _, removed := discovery.Sync(pool, owned, []discovery.BackendSpec{
+			{URL: "http://10.0.0.1", Weight: 1},
+			{URL: "http://10.0.0.2", Weight: 1},
+		}, build)
+		Expect(added).To(HaveLen(2))
+		Expect(removed).To(BeEmpty())
+		Expect(pool.Backends()).To(HaveLen(3))
+		kept := added[1]
+
+		added, _, removed = discovery.Sync(pool, owned, []discovery.BackendSpec{
+			{URL: "http://10.0.0.2", Weight: 1},
+			{URL: "http://10.0.0.3", Weight: 1},
+		}, build)
+		Expect(added).To(HaveLen(1))
+		Expect(added[0].URL().String()).To(Equal("http://10.0.0.3"))
+		Expect(removed).To(HaveLen(1))
+		Expect(removed[0].URL().String()).To(Equal("http://10.0.0.1"))
+		Expect(pool.Backends()).To(ConsistOf(static, kept, added[0]))
+	})
+
+	It("should apply changed tiers, zones and limits to the backends kept", func() {
+		pool := backend.NewPool(nil)
+		discovery.Sync(pool, owned, []discovery.BackendSpec{
+			{URL: "http://10.0.0.1", Weight: 1},
+			{URL: "http://10.0.0.2", Weight: 1},
+		}, build)
+
+		added, updated, removed := discovery.Sync(pool, owned, []discovery.BackendSpec{
+			{URL: "http://10.0.0.1", Weight: 1},
+			{URL: "http://10.0.0.2", Weight: 1, Priority: 2, Zone: "eu-west-1a", MaxConnections: 8, MaxInFlight: 4},
+		}, build)
+		Expect(added).To(BeEmpty())
+		Expect(removed).To(BeEmpty())
+		Expect(updated).To(HaveLen(1))
+		Expect(updated[0].Placement()).To(Equal(backend.Placement{Priority: 2, Zone: "eu-west-1a", MaxConnections: 8, MaxInFlight: 4}))
+		Expect(pool.Backends()).To(ContainElement(updated[0]))
+	})
+
+	It("should reweight owned backends whose spec weight changed", func() {
+		static := backend.New(&url.URL{Scheme: "http", Host: "10.0.0.1"}, 1)
+		pool := backend.NewPool([]*backend.Backend{static})
+		added, _, _ := discovery.Sync(pool, owned, []discovery.BackendSpec{
+			{URL: "http://10.0.0.1", Weight: 1},
+			{URL: "http://10.0.0.2", Weight: 1},
+		}, build)
+		added[1].SetWeight(5)
+
+		changed := discovery.Reweight(pool, owned, []discovery.BackendSpec{
+			{URL: "http://10.0.0.1", Weight: 3},
+			{URL: "http://10.0.0.2", Weight: 4},
+		})
+		Expect(changed).To(ConsistOf(added[0], added[1]))
+		Expect(added[0].ConfiguredWeight()).To(Equal(3))
+		Expect(added[0].Weight()).To(Equal(3))
+		Expect(added[1].ConfiguredWeight()).To(Equal(4))
+		Expect(added[1].Weight()).To(Equal(5))
+		Expect(static.ConfiguredWeight()).To(Equal(1))
+	})
+})
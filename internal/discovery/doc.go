@@ -0,0 +1,29 @@
+// Package discovery finds the backends to balance over at runtime, as an
+// alternative to listing them in the configuration.
+//
+// A Provider sends the full list of backends whenever it changes. The
+// FileProvider watches a YAML or JSON file, chosen by extension, in the same
+// shape as the backends section of the configuration:
+//
+//	backends:
+//	  - url: "http://10.0.0.5:8080"
+//	    weight: 2
+//	  - name: "checkout"
+//	    url: "http://10.0.0.6:8080"
+//	    zone: "eu-west-1a"
+//
+// The DNSProvider re-resolves a DNS name every interval, following its A and
+// AAAA records or its SRV records. The EtcdProvider watches an etcd prefix
+// holding one backend per key as JSON, so several balancers share one list.
+// Providers for service registries such as Consul or Kubernetes implement the
+// same interface. Sync applies a list to the backends of a pool that came
+// from the provider, and Reweight applies changed weights to those that
+// stayed.
+//
+// Usage:
+//
+//	provider := discovery.NewFileProvider("/etc/lb/backends.yaml", 5*time.Second, logger)
+//	for specs := range provider.Subscribe(ctx) {
+//		discovery.Sync(pool, owned, specs, build)
+//	}
+package discovery
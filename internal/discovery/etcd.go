@@ -0,0 +1,250 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+// EtcdOptions locate the backends in etcd. Every key under Prefix holds one
+// backend as a JSON BackendSpec. Token is an etcd auth token, sent as is.
+// After a failed request the provider waits RetryInterval before trying
+// again. HTTPClient must not time out requests, as watches stay open.
+type EtcdOptions struct {
+	URL           string
+	Prefix        string
+	Token         string
+	RetryInterval time.Duration
+	HTTPClient    *http.Client
+}
+
+// EtcdProvider discovers backends from an etcd prefix through the v3 JSON
+// gateway. It reads the whole prefix, watches it from the revision it read,
+// and reads it again whenever a key changes, so instances sharing the
+// prefix share one pool. An unreachable etcd or a prefix holding an invalid
+// list is reported and leaves the last list in place.
+type EtcdProvider struct {
+	opts   EtcdOptions
+	logger *slog.Logger
+}
+
+func NewEtcdProvider(opts EtcdOptions, logger *slog.Logger) *EtcdProvider {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &EtcdProvider{opts: opts, logger: logger}
+}
+
+type etcdKV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+// List reads the backends under the prefix once.
+func (p *EtcdProvider) List(ctx context.Context) ([]BackendSpec, error) {
+	kvs, _, err := p.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseEtcd(kvs)
+}
+
+func (p *EtcdProvider) Subscribe(ctx context.Context) <-chan []BackendSpec {
+	ch := make(chan []BackendSpec, 1)
+	goroutines.Go("discovery", func() {
+		defer close(ch)
+		p.run(ctx, ch)
+	})
+	return ch
+}
+
+func (p *EtcdProvider) run(ctx context.Context, ch chan []BackendSpec) {
+	var last []BackendSpec
+	for ctx.Err() == nil {
+		kvs, revision, err := p.read(ctx)
+		if err != nil {
+			p.logger.Warn("Cannot read backends from etcd, keeping current backends",
+				slog.String("prefix", p.opts.Prefix),
+				slog.Any("error", err))
+			p.wait(ctx)
+			continue
+		}
+
+		specs, err := parseEtcd(kvs)
+		switch {
+		case err != nil:
+			p.logger.Error("Ignoring invalid backends in etcd",
+				slog.String("prefix", p.opts.Prefix),
+				slog.Any("error", err))
+		case last == nil || !slices.Equal(specs, last):
+			p.logger.Info("Discovered backends",
+				slog.String("prefix", p.opts.Prefix),
+				slog.Int("backends", len(specs)))
+			publish(ch, specs)
+			last = specs
+		}
+
+		if err := p.watch(ctx, revision+1); err != nil && ctx.Err() == nil {
+			p.logger.Warn("Lost etcd watch, reading backends again",
+				slog.String("prefix", p.opts.Prefix),
+				slog.Any("error", err))
+			p.wait(ctx)
+		}
+	}
+}
+
+func (p *EtcdProvider) wait(ctx context.Context) {
+	timer := time.NewTimer(p.opts.RetryInterval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// read returns the keys under the prefix and the revision they were read at.
+func (p *EtcdProvider) read(ctx context.Context) ([]etcdKV, int64, error) {
+	var resp struct {
+		Header etcdHeader `json:"header"`
+		KVs    []etcdKV   `json:"kvs"`
+	}
+	if err := p.post(ctx, "/v3/kv/range", p.rangeRequest(), &resp); err != nil {
+		return nil, 0, err
+	}
+	revision, err := strconv.ParseInt(resp.Header.Revision, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid revision %q", resp.Header.Revision)
+	}
+	return resp.KVs, revision, nil
+}
+
+// watch returns once a key under the prefix changed at or after revision,
+// or etcd canceled the watch, for example because revision was compacted.
+func (p *EtcdProvider) watch(ctx context.Context, revision int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	create := p.rangeRequest()
+	create["start_revision"] = strconv.FormatInt(revision, 10)
+	resp, err := p.send(ctx, "/v3/watch", map[string]any{"create_request": create})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Result struct {
+				Canceled bool              `json:"canceled"`
+				Events   []json.RawMessage `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("watch closed")
+			}
+			return err
+		}
+		if msg.Error != nil {
+			return errors.New(msg.Error.Message)
+		}
+		if msg.Result.Canceled || len(msg.Result.Events) > 0 {
+			return nil
+		}
+	}
+}
+
+// rangeRequest selects every key under the prefix.
+func (p *EtcdProvider) rangeRequest() map[string]any {
+	key := []byte(p.opts.Prefix)
+	end := slices.Clone(key)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			end = end[:i+1]
+			break
+		}
+	}
+	return map[string]any{
+		"key":       base64.StdEncoding.EncodeToString(key),
+		"range_end": base64.StdEncoding.EncodeToString(end),
+	}
+}
+
+func (p *EtcdProvider) post(ctx context.Context, path string, body, out any) error {
+	resp, err := p.send(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *EtcdProvider) send(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(p.opts.URL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.opts.Token != "" {
+		req.Header.Set("Authorization", p.opts.Token)
+	}
+
+	resp, err := p.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("POST %s returned %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// parseEtcd decodes and validates the backend stored in every key.
+func parseEtcd(kvs []etcdKV) ([]BackendSpec, error) {
+	specs := make([]BackendSpec, 0, len(kvs))
+	for _, kv := range kvs {
+		key, _ := base64.StdEncoding.DecodeString(kv.Key)
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		var spec BackendSpec
+		if err := json.Unmarshal(value, &spec); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		specs = append(specs, spec)
+	}
+
+	if err := Validate(specs); err != nil {
+		return nil, err
+	}
+	return normalize(specs), nil
+}
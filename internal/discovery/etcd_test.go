@@ -0,0 +1,160 @@
+package discovery_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/discovery"
+)
+
+// fakeEtcd serves the range and watch calls of the etcd v3 JSON gateway
+// from a map, waking open watches whenever a key is put.
+type fakeEtcd struct {
+	mu       sync.Mutex
+	kvs      map[string]string
+	revision int64
+	changed  chan struct{}
+	auth     []string
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: make(map[string]string), revision: 1, changed: make(chan struct{})}
+}
+
+func (f *fakeEtcd) put(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kvs[key] = value
+	f.revision++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var req struct {
+			Key      string `json:"key"`
+			RangeEnd string `json:"range_end"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prefix, _ := base64.StdEncoding.DecodeString(req.Key)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var kvs []map[string]string
+		for k, v := range f.kvs {
+			if strings.HasPrefix(k, string(prefix)) {
+				kvs = append(kvs, map[string]string{
+					"key":   base64.StdEncoding.EncodeToString([]byte(k)),
+					"value": base64.StdEncoding.EncodeToString([]byte(v)),
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"header": map[string]string{"revision": strconv.FormatInt(f.revision, 10)},
+			"kvs":    kvs,
+		})
+	case "/v3/watch":
+		f.mu.Lock()
+		changed := f.changed
+		f.mu.Unlock()
+
+		enc := json.NewEncoder(w)
+		enc.Encode(map[string]any{"result": map[string]any{"created": true}})
+		w.(http.Flusher).Flush()
+		select {
+		case <-changed:
+			enc.Encode(map[string]any{"result": map[string]any{"events": []map[string]any{{"type": "PUT"}}}})
+		case <-r.Context().Done():
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var _ = Describe("EtcdProvider", func() {
+	var (
+		etcd   *fakeEtcd
+		server *httptest.Server
+		log    *slog.Logger
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		etcd = newFakeEtcd()
+		server = httptest.NewServer(etcd)
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	provider := func() *discovery.EtcdProvider {
+		return discovery.NewEtcdProvider(discovery.EtcdOptions{
+			URL:           server.URL,
+			Prefix:        "/lb/backends/",
+			Token:         "secret",
+			RetryInterval: 10 * time.Millisecond,
+		}, log)
+	}
+
+	It("should list the backends under the prefix", func() {
+		etcd.put("/lb/backends/a", `{"name": "a", "url": "http://10.0.0.1:8080", "weight": 2}`)
+		etcd.put("/lb/other/b", `{"url": "http://10.0.0.2:8080"}`)
+
+		specs, err := provider().List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(specs).To(Equal([]discovery.BackendSpec{{Name: "a", URL: "http://10.0.0.1:8080", Weight: 2}}))
+		Expect(etcd.auth).To(ContainElement("secret"))
+	})
+
+	It("should publish the list again whenever a key changes", func() {
+		etcd.put("/lb/backends/a", `{"url": "http://10.0.0.1:8080"}`)
+		updates := provider().Subscribe(ctx)
+
+		Eventually(updates).Should(Receive(HaveLen(1)))
+
+		etcd.put("/lb/backends/b", `{"url": "http://10.0.0.2:8080"}`)
+		Eventually(updates).Should(Receive(HaveLen(2)))
+	})
+
+	It("should keep the last list while the prefix holds an invalid one", func() {
+		etcd.put("/lb/backends/a", `{"url": "http://10.0.0.1:8080"}`)
+		updates := provider().Subscribe(ctx)
+		Eventually(updates).Should(Receive(HaveLen(1)))
+
+		etcd.put("/lb/backends/b", `{"url": "ftp://10.0.0.2"}`)
+		Consistently(updates, "100ms").ShouldNot(Receive())
+
+		etcd.put("/lb/backends/b", `{"url": "http://10.0.0.2:8080"}`)
+		Eventually(updates).Should(Receive(HaveLen(2)))
+	})
+
+	It("should fail to list when etcd is unreachable", func() {
+		server.Close()
+		_, err := provider().List(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,194 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+type backendsFile struct {
+	Backends []BackendSpec `mapstructure:"backends"`
+}
+
+// settleDelay is how long the file must go without change events before it
+// is read, so a file being written in place is not read half way through.
+const settleDelay = 100 * time.Millisecond
+
+// LoadFile reads and validates a backends file, YAML or JSON by extension.
+// An empty file is an error rather than an empty list: it is what a reader
+// sees of a file that is being rewritten.
+func LoadFile(path string) ([]BackendSpec, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var f backendsFile
+	if err := v.Unmarshal(&f); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(f.Backends); err != nil {
+		return nil, err
+	}
+	return normalize(f.Backends), nil
+}
+
+// FileProvider discovers backends from a file. It watches the file's
+// directory for changes, which also catches editors and ConfigMaps that
+// replace the file rather than write to it, and polls it every interval in
+// case the filesystem does not report changes. A file that is missing, empty
+// or fails to parse, or that lists no backends where it listed some, is
+// reported and leaves the last list in place, so a botched edit does not
+// empty the pool.
+type FileProvider struct {
+	path     string
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func NewFileProvider(path string, interval time.Duration, logger *slog.Logger) *FileProvider {
+	return &FileProvider{path: path, interval: interval, logger: logger}
+}
+
+func (p *FileProvider) Subscribe(ctx context.Context) <-chan []BackendSpec {
+	ch := make(chan []BackendSpec, 1)
+	goroutines.Go("discovery", func() {
+		defer close(ch)
+		p.run(ctx, ch)
+	})
+	return ch
+}
+
+func (p *FileProvider) run(ctx context.Context, ch chan []BackendSpec) {
+	w := fileWatch{provider: p}
+	if specs, changed := w.check(); changed {
+		publish(ch, specs)
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if watcher, err := p.watch(); err != nil {
+		p.logger.Warn("Cannot watch backends file, polling it",
+			slog.String("file", p.path),
+			slog.Any("error", err))
+	} else {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			p.logger.Warn("Error watching backends file", slog.String("file", p.path), slog.Any("error", err))
+		case <-events:
+			// Writing a file in place reports several events; read it once
+			// they stop.
+			settle = time.After(settleDelay)
+			continue
+		case <-settle:
+			settle = nil
+		case <-ticker.C:
+		}
+		if specs, changed := w.check(); changed {
+			publish(ch, specs)
+		}
+	}
+}
+
+// watch reports changes to the entries of the file's directory. Watching the
+// directory rather than the file survives the file being replaced.
+func (p *FileProvider) watch() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(p.path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// fileWatch is what one subscription last saw of the file.
+type fileWatch struct {
+	provider *FileProvider
+	modTime  time.Time
+	size     int64
+	present  bool
+	loaded   bool
+	specs    []BackendSpec
+}
+
+// check reloads the file if it changed since the last call and returns the
+// new list if it differs from the last one sent.
+func (w *fileWatch) check() ([]BackendSpec, bool) {
+	p := w.provider
+
+	info, err := os.Stat(p.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if w.present || !w.loaded {
+			p.logger.Warn("Backends file missing, keeping current backends", slog.String("file", p.path))
+		}
+		w.present, w.loaded = false, true
+		return nil, false
+	}
+	if err != nil {
+		p.logger.Error("Cannot read backends file", slog.String("file", p.path), slog.Any("error", err))
+		return nil, false
+	}
+
+	if w.present && info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return nil, false
+	}
+
+	// Record the version even if it is invalid so it is reported only once.
+	w.present, w.loaded = true, true
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+
+	specs, err := LoadFile(p.path)
+	if err != nil {
+		p.logger.Error("Ignoring invalid backends file", slog.String("file", p.path), slog.Any("error", err))
+		return nil, false
+	}
+	if w.specs != nil && slices.Equal(specs, w.specs) {
+		return nil, false
+	}
+	if len(specs) == 0 && len(w.specs) > 0 {
+		p.logger.Error("Ignoring backends file without backends, keeping current backends",
+			slog.String("file", p.path),
+			slog.Int("backends", len(w.specs)))
+		return nil, false
+	}
+
+	p.logger.Info("Discovered backends", slog.String("file", p.path), slog.Int("backends", len(specs)))
+	w.specs = specs
+	return specs, true
+}
@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"slices"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// Sync makes the backends in pool that owned reports on match specs. Owned
+// backends no spec describes any more are removed and specs without a
+// backend get one from build. The others stay, so they keep their health,
+// breakers and history, but take the tier, zone and limits build gives
+// their spec; those whose placement changed are returned as updated. A
+// backend matches a spec with the same name (the URL when unnamed) and URL.
+// Backends build returns nil for are skipped.
+func Sync(pool *backend.Pool, owned func(*backend.Backend) bool, specs []BackendSpec, build func(BackendSpec) *backend.Backend) (added, updated, removed []*backend.Backend) {
+	kept := make([]*backend.Backend, len(specs))
+	pool.Update(func(backends []*backend.Backend) []*backend.Backend {
+		backends = slices.DeleteFunc(backends, func(b *backend.Backend) bool {
+			if !owned(b) {
+				return false
+			}
+			i := slices.IndexFunc(specs, func(s BackendSpec) bool { return matches(b, s) })
+			if i < 0 {
+				removed = append(removed, b)
+				return true
+			}
+			kept[i] = b
+			return false
+		})
+
+		for i, s := range specs {
+			if kept[i] != nil {
+				continue
+			}
+			if b := build(s); b != nil {
+				added = append(added, b)
+				backends = append(backends, b)
+			}
+		}
+		return backends
+	})
+
+	for i, b := range kept {
+		if b == nil {
+			continue
+		}
+		if spec := build(specs[i]); spec != nil && b.SetPlacement(spec.Placement()) {
+			updated = append(updated, b)
+		}
+	}
+	return added, updated, removed
+}
+
+// Reweight gives the backends in pool that owned reports on the weight of the
+// spec they match, and returns those whose weight changed.
+func Reweight(pool *backend.Pool, owned func(*backend.Backend) bool, specs []BackendSpec) (changed []*backend.Backend) {
+	for _, b := range pool.Backends() {
+		if !owned(b) {
+			continue
+		}
+		i := slices.IndexFunc(specs, func(s BackendSpec) bool { return matches(b, s) })
+		if i >= 0 && b.ConfiguredWeight() != specs[i].Weight {
+			b.SetConfiguredWeight(specs[i].Weight)
+			changed = append(changed, b)
+		}
+	}
+	return changed
+}
+
+func matches(b *backend.Backend, s BackendSpec) bool {
+	name := s.Name
+	if name == "" {
+		name = s.URL
+	}
+	return b.Name() == name && b.URL().String() == s.URL
+}
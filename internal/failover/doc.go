@@ -0,0 +1,23 @@
+// Package failover moves traffic from the local backends to a remote
+// fallback group, such as another region's load balancer, when the local
+// pool runs short or slows down.
+//
+// A Controller evaluates the local backends periodically. The pool breaches
+// when fewer than MinHealthy of them are available or their mean response
+// time exceeds MaxLatency; after FailAfter consecutive breaching evaluations
+// it fails over, and after RecoverAfter consecutive evaluations without a
+// breach it fails back. While failed over, ProbeShare of requests still go to
+// the local backends so that their response time keeps being measured.
+//
+// Usage:
+//
+//	c := failover.NewController(pool, failover.Options{
+//		MinHealthy:   0.5,
+//		MaxLatency:   500 * time.Millisecond,
+//		FailAfter:    3,
+//		RecoverAfter: 10,
+//		ProbeShare:   0.05,
+//	}, logger)
+//	c.Start(ctx, 5*time.Second)
+//	serving := c.Select(available)
+package failover
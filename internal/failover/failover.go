@@ -0,0 +1,203 @@
+package failover
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+// Options sets when a Controller fails over. MinHealthy is the fraction of
+// local regular backends that must be available and MaxLatency the highest
+// mean response time of the available ones, zero for no limit. ProbeShare
+// must be above zero with a MaxLatency, so recovery can be measured.
+type Options struct {
+	MinHealthy   float64
+	MaxLatency   time.Duration
+	FailAfter    int
+	RecoverAfter int
+	ProbeShare   float64
+}
+
+type Controller struct {
+	pool    *backend.Pool
+	opts    Options
+	logger  *slog.Logger
+	engaged atomic.Bool
+
+	mutex      sync.Mutex
+	breaches   int
+	recoveries int
+	onSwitch   []func(engaged bool)
+}
+
+// NewController watches the local backends in pool, as they are when it
+// evaluates them, and fails over to the remote ones.
+func NewController(pool *backend.Pool, opts Options, logger *slog.Logger) *Controller {
+	opts.FailAfter = max(opts.FailAfter, 1)
+	opts.RecoverAfter = max(opts.RecoverAfter, 1)
+	return &Controller{pool: pool, opts: opts, logger: logger}
+}
+
+func (c *Controller) Start(ctx context.Context, interval time.Duration) {
+	goroutines.Go("failover", func() { c.run(ctx, interval) })
+}
+
+func (c *Controller) run(ctx context.Context, interval time.Duration) {
+	c.Evaluate()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Evaluate()
+		}
+	}
+}
+
+// OnSwitch registers fn to run whenever traffic fails over or back, with
+// whether it now goes to the remote backends. It runs while the controller
+// evaluates, so it must not block.
+func (c *Controller) OnSwitch(fn func(engaged bool)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onSwitch = append(c.onSwitch, fn)
+}
+
+// Engaged reports whether traffic has failed over to the remote backends.
+func (c *Controller) Engaged() bool {
+	return c.engaged.Load()
+}
+
+// Select narrows available backends to the group currently serving: the
+// local ones, or the remote ones while failed over, except for ProbeShare of
+// calls. A group without available backends gives way to the other.
+func (c *Controller) Select(available []*backend.Backend) []*backend.Backend {
+	return group(available, c.engaged.Load() && rand.Float64() >= c.opts.ProbeShare)
+}
+
+// Serving narrows backends to the group currently serving, without probes.
+func (c *Controller) Serving(backends []*backend.Backend) []*backend.Backend {
+	return group(backends, c.engaged.Load())
+}
+
+func group(backends []*backend.Backend, remote bool) []*backend.Backend {
+	local, remotes := split(backends)
+	if remote && len(remotes) > 0 || len(local) == 0 {
+		return remotes
+	}
+	return local
+}
+
+func split(backends []*backend.Backend) (local, remote []*backend.Backend) {
+	for _, b := range backends {
+		if b.IsRemote() {
+			remote = append(remote, b)
+		} else {
+			local = append(local, b)
+		}
+	}
+	return local, remote
+}
+
+// Evaluate checks the local backends and fails over or back once a breach,
+// or its absence, has lasted long enough.
+func (c *Controller) Evaluate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	local, remote := split(c.pool.Backends())
+	reason, available, latency := c.breach(local)
+	attrs := []any{
+		slog.Int("available", available),
+		slog.Int("local", len(local)),
+		slog.Duration("latency", latency),
+	}
+
+	if !c.engaged.Load() {
+		if reason == "" {
+			c.breaches = 0
+			return
+		}
+		c.breaches++
+		if c.breaches < c.opts.FailAfter || !anyAvailable(remote) {
+			return
+		}
+		c.breaches = 0
+		c.engaged.Store(true)
+		c.logger.Warn("Failed over to remote backends", append(attrs, slog.String("reason", reason))...)
+		c.switched(true)
+		return
+	}
+
+	if reason != "" {
+		c.recoveries = 0
+		return
+	}
+	c.recoveries++
+	if c.recoveries < c.opts.RecoverAfter {
+		return
+	}
+	c.recoveries = 0
+	c.engaged.Store(false)
+	c.logger.Info("Failed back to local backends", attrs...)
+	c.switched(false)
+}
+
+// switched runs the OnSwitch hooks. Callers must hold the mutex.
+func (c *Controller) switched(engaged bool) {
+	for _, fn := range c.onSwitch {
+		fn(engaged)
+	}
+}
+
+// breach returns why the local backends breach the thresholds, empty when
+// they do not, along with how many are available and their mean response
+// time. MinHealthy is a fraction of the regular backends: standbys only add
+// to the available ones while active, as they stand in for regular ones.
+func (c *Controller) breach(local []*backend.Backend) (reason string, available int, latency time.Duration) {
+	var total time.Duration
+	measured, regular := 0, 0
+	for _, b := range local {
+		if !b.IsStandby() {
+			regular++
+		}
+		if !b.IsAvailable() {
+			continue
+		}
+		available++
+		if d := b.EWMATime(); d > 0 {
+			total += d
+			measured++
+		}
+	}
+	if measured > 0 {
+		latency = total / time.Duration(measured)
+	}
+
+	switch {
+	case available == 0 || float64(available) < c.opts.MinHealthy*float64(regular):
+		return "unavailable", available, latency
+	case c.opts.MaxLatency > 0 && latency > c.opts.MaxLatency:
+		return "latency", available, latency
+	}
+	return "", available, latency
+}
+
+func anyAvailable(backends []*backend.Backend) bool {
+	for _, b := range backends {
+		if b.IsAvailable() {
+			return true
+		}
+	}
+	return false
+}
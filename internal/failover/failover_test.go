@@ -0,0 +1,161 @@
+package failover_test
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/failover"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		local      []*backend.Backend
+		remote     []*backend.Backend
+		controller *failover.Controller
+	)
+
+	newBackend := func(rawURL string, opts ...backend.Option) *backend.Backend {
+		u, _ := url.Parse(rawURL)
+		b := backend.New(u, 1, opts...)
+		b.SetHealthy(true)
+		return b
+	}
+
+	evaluate := func(times int) {
+		for range times {
+			controller.Evaluate()
+		}
+	}
+
+	BeforeEach(func() {
+		local = []*backend.Backend{newBackend("http://10.0.0.1"), newBackend("http://10.0.0.2")}
+		remote = []*backend.Backend{newBackend("https://lb.eu-central.example.com", backend.WithRemote())}
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		controller = failover.NewController(backend.NewPool(append(append([]*backend.Backend{}, local...), remote...)), failover.Options{
+			MinHealthy:   0.5,
+			MaxLatency:   100 * time.Millisecond,
+			FailAfter:    2,
+			RecoverAfter: 3,
+		}, log)
+	})
+
+	It("should serve from the local backends while they are within thresholds", func() {
+		local[0].SetHealthy(false)
+		evaluate(5)
+		Expect(controller.Engaged()).To(BeFalse())
+		Expect(controller.Select(append(local[1:], remote...))).To(Equal(local[1:]))
+	})
+
+	It("should fail over once too few local backends are available for long enough", func() {
+		local[0].SetHealthy(false)
+		local[1].SetDraining(true)
+		evaluate(1)
+		Expect(controller.Engaged()).To(BeFalse())
+
+		evaluate(1)
+		Expect(controller.Engaged()).To(BeTrue())
+		Expect(controller.Select(append(local, remote...))).To(Equal(remote))
+		Expect(controller.Serving(append(local, remote...))).To(Equal(remote))
+	})
+
+	It("should not count inactive standbys among the local backends that must be available", func() {
+		standbys := []*backend.Backend{newBackend("http://10.0.9.1", backend.WithStandby()), newBackend("http://10.0.9.2", backend.WithStandby())}
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		controller = failover.NewController(backend.NewPool(append(append(append([]*backend.Backend{}, local...), standbys...), remote...)), failover.Options{
+			MinHealthy:   0.5,
+			FailAfter:    1,
+			RecoverAfter: 1,
+		}, log)
+
+		local[0].SetHealthy(false)
+		evaluate(1)
+		Expect(controller.Engaged()).To(BeFalse())
+
+		local[1].SetHealthy(false)
+		standbys[0].SetStandbyActive(true)
+		evaluate(1)
+		Expect(controller.Engaged()).To(BeFalse())
+	})
+
+	It("should fail over when the local backends are too slow", func() {
+		local[0].RecordResponse(300 * time.Millisecond)
+		local[1].RecordResponse(50 * time.Millisecond)
+		evaluate(2)
+		Expect(controller.Engaged()).To(BeTrue())
+	})
+
+	It("should not fail over without an available remote backend", func() {
+		remote[0].SetHealthy(false)
+		local[0].SetHealthy(false)
+		local[1].SetHealthy(false)
+		evaluate(5)
+		Expect(controller.Engaged()).To(BeFalse())
+	})
+
+	It("should only fail back after enough evaluations without a breach", func() {
+		local[0].SetHealthy(false)
+		local[1].SetHealthy(false)
+		evaluate(2)
+		Expect(controller.Engaged()).To(BeTrue())
+
+		local[0].SetHealthy(true)
+		evaluate(2)
+		local[0].SetHealthy(false)
+		evaluate(1)
+		local[0].SetHealthy(true)
+		evaluate(2)
+		Expect(controller.Engaged()).To(BeTrue())
+
+		evaluate(1)
+		Expect(controller.Engaged()).To(BeFalse())
+	})
+
+	It("should tell switch hooks about failing over and back", func() {
+		var switches []bool
+		controller.OnSwitch(func(engaged bool) { switches = append(switches, engaged) })
+
+		local[0].SetHealthy(false)
+		local[1].SetHealthy(false)
+		evaluate(4)
+		Expect(switches).To(Equal([]bool{true}))
+
+		local[0].SetHealthy(true)
+		evaluate(3)
+		Expect(switches).To(Equal([]bool{true, false}))
+	})
+
+	It("should use the other group when the serving one has no available backend", func() {
+		Expect(controller.Select(remote)).To(Equal(remote))
+
+		local[0].SetHealthy(false)
+		local[1].SetHealthy(false)
+		evaluate(2)
+		Expect(controller.Select(local)).To(Equal(local))
+	})
+
+	It("should keep sending the probe share to the local backends", func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		controller = failover.NewController(backend.NewPool(append(append([]*backend.Backend{}, local...), remote...)), failover.Options{
+			MinHealthy: 1,
+			FailAfter:  1,
+			ProbeShare: 0.2,
+		}, log)
+		local[0].SetHealthy(false)
+		evaluate(1)
+		Expect(controller.Engaged()).To(BeTrue())
+
+		probes := 0
+		for range 1000 {
+			if selected := controller.Select(append(local, remote...)); selected[0] != remote[0] {
+				probes++
+			}
+		}
+		Expect(probes).To(BeNumerically("~", 200, 60))
+	})
+})
@@ -0,0 +1,20 @@
+// Package fdmon watches the process's file descriptor usage and the accept
+// queues of its listening sockets.
+//
+// Connection leaks usually surface as "too many open files" errors or as
+// clients timing out while the kernel drops their connections from a full
+// accept queue. A Monitor samples both periodically, warns before the
+// descriptor limit is reached, when a listener's queue fills up and when the
+// kernel reports listen queue overflows, and keeps the latest sample for the
+// admin API. Sampling reads /proc and is only supported on Linux.
+//
+// Usage:
+//
+//	mon := fdmon.NewMonitor(fdmon.Options{
+//		Interval:  10 * time.Second,
+//		WarnRatio: 0.8,
+//	}, logger)
+//	mon.Start(ctx)
+//
+//	usage, ok := mon.Usage()
+package fdmon
@@ -0,0 +1,164 @@
+package fdmon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+// Usage is one sample of the process's descriptor and socket usage.
+// ListenOverflows and ListenDrops are the kernel's cumulative counters of
+// connections dropped because an accept queue was full; they cover the whole
+// network namespace, not only this process.
+type Usage struct {
+	Open            int             `json:"open"`
+	Sockets         int             `json:"sockets"`
+	Limit           uint64          `json:"limit"`
+	Ratio           float64         `json:"ratio"`
+	Listeners       []ListenerQueue `json:"listeners"`
+	ListenOverflows uint64          `json:"listen_overflows"`
+	ListenDrops     uint64          `json:"listen_drops"`
+	SampledAt       time.Time       `json:"sampled_at"`
+}
+
+// ListenerQueue is the accept queue of one listening socket: Queued
+// connections are waiting for Accept, Backlog is the queue's capacity.
+type ListenerQueue struct {
+	Address string `json:"address"`
+	Queued  uint64 `json:"queued"`
+	Backlog uint64 `json:"backlog"`
+}
+
+type Options struct {
+	Interval time.Duration
+	// WarnRatio is the fraction of the descriptor limit, or of a listener's
+	// backlog, above which a warning is logged.
+	WarnRatio float64
+}
+
+type Monitor struct {
+	opts   Options
+	logger *slog.Logger
+
+	mutex       sync.Mutex
+	last        Usage
+	sampled     bool
+	fdsWarned   bool
+	queueWarned map[string]bool
+}
+
+func NewMonitor(opts Options, logger *slog.Logger) *Monitor {
+	if opts.WarnRatio <= 0 || opts.WarnRatio > 1 {
+		opts.WarnRatio = 0.8
+	}
+
+	return &Monitor{
+		opts:        opts,
+		logger:      logger,
+		queueWarned: make(map[string]bool),
+	}
+}
+
+func (m *Monitor) Start(ctx context.Context) {
+	goroutines.Go("fdmon", func() { m.run(ctx) })
+}
+
+func (m *Monitor) run(ctx context.Context) {
+	if err := m.Check(); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			m.logger.Info("File descriptor monitoring is not supported on this platform")
+			return
+		}
+		m.logger.Warn("Failed to sample file descriptor usage", slog.Any("err", err))
+	}
+
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Check(); err != nil {
+				m.logger.Warn("Failed to sample file descriptor usage", slog.Any("err", err))
+			}
+		}
+	}
+}
+
+// Check takes one sample, logs warnings for limits that are close and
+// queue overflows since the previous sample, and keeps it as the latest.
+func (m *Monitor) Check() error {
+	usage, err := Sample()
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.checkDescriptors(usage)
+	m.checkQueues(usage)
+	if m.sampled {
+		m.checkOverflows(m.last, usage)
+	}
+
+	m.last = usage
+	m.sampled = true
+	return nil
+}
+
+func (m *Monitor) checkDescriptors(usage Usage) {
+	high := usage.Ratio >= m.opts.WarnRatio
+	if high && !m.fdsWarned {
+		m.logger.Warn("Open file descriptors approaching the limit",
+			slog.Int("open", usage.Open),
+			slog.Int("sockets", usage.Sockets),
+			slog.Uint64("limit", usage.Limit))
+	}
+	if !high && m.fdsWarned {
+		m.logger.Info("Open file descriptors back below the warning level",
+			slog.Int("open", usage.Open),
+			slog.Uint64("limit", usage.Limit))
+	}
+	m.fdsWarned = high
+}
+
+func (m *Monitor) checkQueues(usage Usage) {
+	for _, l := range usage.Listeners {
+		high := l.Backlog > 0 && float64(l.Queued) >= m.opts.WarnRatio*float64(l.Backlog)
+		if high && !m.queueWarned[l.Address] {
+			m.logger.Warn("Listener accept queue is filling up",
+				slog.String("address", l.Address),
+				slog.Uint64("queued", l.Queued),
+				slog.Uint64("backlog", l.Backlog))
+		}
+		m.queueWarned[l.Address] = high
+	}
+}
+
+func (m *Monitor) checkOverflows(prev, usage Usage) {
+	overflows := usage.ListenOverflows - prev.ListenOverflows
+	drops := usage.ListenDrops - prev.ListenDrops
+	if usage.ListenOverflows < prev.ListenOverflows || usage.ListenDrops < prev.ListenDrops {
+		return
+	}
+	if overflows > 0 || drops > 0 {
+		m.logger.Warn("Kernel dropped connections from full accept queues",
+			slog.Uint64("overflows", overflows),
+			slog.Uint64("drops", drops),
+			slog.Duration("since", usage.SampledAt.Sub(prev.SampledAt)))
+	}
+}
+
+// Usage returns the latest sample, if one was taken.
+func (m *Monitor) Usage() (Usage, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.last, m.sampled
+}
@@ -0,0 +1,70 @@
+package fdmon_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/fdmon"
+)
+
+var _ = Describe("FD monitor", func() {
+	var listener net.Listener
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+	})
+
+	It("should count open descriptors and sockets", func() {
+		before, err := fdmon.Sample()
+		Expect(err).NotTo(HaveOccurred())
+
+		f, err := os.Open(os.DevNull)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		after, err := fdmon.Sample()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after.Open).To(Equal(before.Open + 1))
+		Expect(after.Sockets).To(BeNumerically(">=", 1))
+		Expect(after.Limit).To(BeNumerically(">", 0))
+		Expect(after.Ratio).To(BeNumerically(">", 0))
+	})
+
+	It("should report the accept queue of the process's listeners", func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		usage, err := fdmon.Sample()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage.Listeners).To(ContainElement(And(
+			HaveField("Address", listener.Addr().String()),
+			HaveField("Queued", BeNumerically("==", 1)),
+			HaveField("Backlog", BeNumerically(">", 0)),
+		)))
+	})
+
+	It("should warn once when usage crosses the warning level", func() {
+		var logs bytes.Buffer
+		mon := fdmon.NewMonitor(fdmon.Options{WarnRatio: 1e-9}, slog.New(slog.NewTextHandler(&logs, nil)))
+
+		Expect(mon.Check()).To(Succeed())
+		Expect(mon.Check()).To(Succeed())
+		Expect(bytes.Count(logs.Bytes(), []byte("Open file descriptors approaching the limit"))).To(Equal(1))
+
+		usage, ok := mon.Usage()
+		Expect(ok).To(BeTrue())
+		Expect(usage.Open).To(BeNumerically(">", 0))
+	})
+})
@@ -0,0 +1,13 @@
+package fdmon_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFDMon(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FD Monitor Suite")
+}
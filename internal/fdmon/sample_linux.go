@@ -0,0 +1,176 @@
+package fdmon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// tcpListen is the socket state of listening sockets in /proc/net/tcp.
+const tcpListen = "0A"
+
+// Sample reads the current usage from /proc.
+func Sample() (Usage, error) {
+	usage := Usage{SampledAt: time.Now()}
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return usage, fmt.Errorf("reading descriptor limit: %w", err)
+	}
+	usage.Limit = limit.Cur
+
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return usage, err
+	}
+
+	inodes := make(map[string]bool)
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", entry.Name()))
+		if err != nil {
+			// Closed since the directory was listed, most likely the
+			// descriptor ReadDir itself used.
+			continue
+		}
+		usage.Open++
+
+		if inode, ok := strings.CutPrefix(target, "socket:["); ok {
+			usage.Sockets++
+			inodes[strings.TrimSuffix(inode, "]")] = true
+		}
+	}
+	if usage.Limit > 0 {
+		usage.Ratio = float64(usage.Open) / float64(usage.Limit)
+	}
+
+	backlog := readBacklog("/proc/sys/net/core/somaxconn")
+	for _, table := range []string{"/proc/self/net/tcp", "/proc/self/net/tcp6"} {
+		listeners, err := readListeners(table, inodes, backlog)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return usage, err
+		}
+		usage.Listeners = append(usage.Listeners, listeners...)
+	}
+
+	usage.ListenOverflows, usage.ListenDrops, err = readListenDrops("/proc/self/net/netstat")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return usage, err
+	}
+
+	return usage, nil
+}
+
+// readListeners returns the accept queues of the listening sockets in a
+// /proc/net/tcp table that belong to this process. For listening sockets the
+// kernel reports the queued connections as rx_queue.
+func readListeners(path string, inodes map[string]bool, backlog uint64) ([]ListenerQueue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var listeners []ListenerQueue
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen || !inodes[fields[9]] {
+			continue
+		}
+
+		address, err := parseAddress(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		_, rxQueue, _ := strings.Cut(fields[4], ":")
+		queued, _ := strconv.ParseUint(rxQueue, 16, 64)
+
+		listeners = append(listeners, ListenerQueue{
+			Address: address.String(),
+			Queued:  queued,
+			Backlog: backlog,
+		})
+	}
+
+	return listeners, scanner.Err()
+}
+
+// readBacklog returns the accept queue capacity of listeners created by the
+// net package, which always asks for the somaxconn maximum. Zero means it is
+// unknown.
+func readBacklog(path string) uint64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	backlog, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return backlog
+}
+
+// parseAddress decodes an "ADDR:PORT" field. The address is printed as
+// 32-bit words in host byte order, the port as a plain number.
+func parseAddress(field string) (netip.AddrPort, error) {
+	hexAddr, hexPort, ok := strings.Cut(field, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("malformed address %q", field)
+	}
+
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("malformed address %q", field)
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("malformed port %q", field)
+	}
+
+	for i := 0; i < len(raw); i += 4 {
+		binary.NativeEndian.PutUint32(raw[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+
+	addr, _ := netip.AddrFromSlice(raw)
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+}
+
+// readListenDrops reads the ListenOverflows and ListenDrops counters from the
+// TcpExt section of /proc/net/netstat, which lists names and values on two
+// consecutive lines.
+func readListenDrops(path string) (overflows, drops uint64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "TcpExt:") || !strings.HasPrefix(lines[i+1], "TcpExt:") {
+			continue
+		}
+
+		names := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+		for j := 1; j < len(names) && j < len(values); j++ {
+			switch names[j] {
+			case "ListenOverflows":
+				overflows, _ = strconv.ParseUint(values[j], 10, 64)
+			case "ListenDrops":
+				drops, _ = strconv.ParseUint(values[j], 10, 64)
+			}
+		}
+		break
+	}
+
+	return overflows, drops, nil
+}
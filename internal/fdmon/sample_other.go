@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fdmon
+
+import "errors"
+
+// Sample is only implemented on Linux.
+func Sample() (Usage, error) {
+	return Usage{}, errors.ErrUnsupported
+}
@@ -0,0 +1,22 @@
+// Package fingerprint groups requests by how their client connects rather
+// than by who the client is, to help spot automation that rotates addresses
+// but keeps its TLS stack and HTTP client.
+//
+// A fingerprint combines a TLS fingerprint, either a JA3 or JA4 hash passed
+// on by a TLS-terminating proxy or a description of the handshake when the
+// balancer terminated TLS itself, with the HTTP version, which of a fixed
+// set of headers the request carried, and the low-entropy client hints a
+// browser volunteers. Client addresses, user agents and header values that
+// could identify a person are never kept; the values of Accept-Encoding and
+// the client hints are hashed into a fixed number of buckets, so clients
+// cannot make up unbounded fingerprints through them. The Recorder counts
+// requests and response status classes per fingerprint for a bounded number
+// of fingerprints, keeping the busiest ones by the space-saving algorithm.
+//
+// Usage:
+//
+//	rec := fingerprint.NewRecorder(1000)
+//	fp := fingerprint.Of(r, r.Header.Get("X-JA3-Fingerprint"))
+//	rec.Record(fp, status)
+//	snap := rec.Snapshot()
+package fingerprint
@@ -0,0 +1,101 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// maxValueLength bounds the TLS fingerprints a fingerprint keeps.
+const maxValueLength = 64
+
+// valueBuckets is the number of buckets the values of client-controlled
+// headers are hashed into, so a client varying them cannot make up more
+// than valueBuckets values per header.
+const valueBuckets = 64
+
+// headers are the request headers whose presence, not value, is part of a
+// fingerprint. Automation tends to send a different set than browsers.
+var headers = []string{
+	"Accept",
+	"Accept-Encoding",
+	"Accept-Language",
+	"Cache-Control",
+	"Connection",
+	"Cookie",
+	"Referer",
+	"Sec-Fetch-Mode",
+	"Sec-Fetch-Site",
+	"Upgrade-Insecure-Requests",
+	"User-Agent",
+}
+
+// Fingerprint describes how a request's client connects. ID is a short hash
+// of the other fields. AcceptEncoding and the client hints are not the
+// headers' values but the buckets they hash into.
+type Fingerprint struct {
+	ID             string   `json:"id"`
+	TLS            string   `json:"tls,omitempty"`
+	Protocol       string   `json:"protocol"`
+	Headers        []string `json:"headers"`
+	AcceptEncoding string   `json:"accept_encoding,omitempty"`
+	// Brands, Mobile and Platform are the Sec-CH-UA client hints.
+	Brands   string `json:"brands,omitempty"`
+	Mobile   string `json:"mobile,omitempty"`
+	Platform string `json:"platform,omitempty"`
+}
+
+// Of returns the fingerprint of r. tlsHash is the TLS fingerprint a proxy in
+// front computed, empty when there is none; without it a handshake the
+// balancer terminated itself is described by its version, cipher suite and
+// negotiated protocol.
+func Of(r *http.Request, tlsHash string) Fingerprint {
+	fp := Fingerprint{
+		TLS:            clean(tlsHash),
+		Protocol:       r.Proto,
+		Headers:        make([]string, 0, len(headers)),
+		AcceptEncoding: bucket(r.Header.Get("Accept-Encoding")),
+		Brands:         bucket(r.Header.Get("Sec-CH-UA")),
+		Mobile:         bucket(r.Header.Get("Sec-CH-UA-Mobile")),
+		Platform:       bucket(r.Header.Get("Sec-CH-UA-Platform")),
+	}
+	if fp.TLS == "" && r.TLS != nil {
+		fp.TLS = tls.VersionName(r.TLS.Version) + "/" + tls.CipherSuiteName(r.TLS.CipherSuite) + "/" + r.TLS.NegotiatedProtocol
+	}
+	for _, h := range headers {
+		if _, ok := r.Header[h]; ok {
+			fp.Headers = append(fp.Headers, h)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		fp.TLS, fp.Protocol, strings.Join(fp.Headers, ","), fp.AcceptEncoding, fp.Brands, fp.Mobile, fp.Platform,
+	}, "\n")))
+	fp.ID = hex.EncodeToString(sum[:8])
+	return fp
+}
+
+// bucket returns the bucket value hashes into, empty for an empty value.
+func bucket(value string) string {
+	if value == "" {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return fmt.Sprintf("%02x", h.Sum32()%valueBuckets)
+}
+
+// clean keeps at most maxValueLength printable ASCII characters of value.
+func clean(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, value)
+	return strings.TrimSpace(value[:min(len(value), maxValueLength)])
+}
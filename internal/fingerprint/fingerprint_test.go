@@ -0,0 +1,113 @@
+package fingerprint_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/fingerprint"
+)
+
+var _ = Describe("Fingerprint", func() {
+	browser := func(addr, agent string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		r.Header.Set("User-Agent", agent)
+		r.Header.Set("Accept", "text/html")
+		r.Header.Set("Accept-Encoding", "gzip, br")
+		r.Header.Set("Sec-CH-UA-Platform", `"Linux"`)
+		return r
+	}
+
+	It("should ignore who the client is", func() {
+		a := fingerprint.Of(browser("192.0.2.1:1234", "Mozilla/5.0 (X11; Linux x86_64) build 1"), "")
+		b := fingerprint.Of(browser("198.51.100.7:4321", "Mozilla/5.0 (X11; Linux x86_64) build 2"), "")
+		Expect(a).To(Equal(b))
+		Expect(a.Headers).To(Equal([]string{"Accept", "Accept-Encoding", "User-Agent"}))
+		Expect(a.Platform).To(HaveLen(2))
+		Expect(a.ID).To(HaveLen(16))
+	})
+
+	It("should tell clients with different stacks apart", func() {
+		r := browser("192.0.2.1:1234", "curl/8.0")
+		base := fingerprint.Of(r, "")
+
+		Expect(fingerprint.Of(r, "771,4865-4866,0-23,29-23,0").ID).NotTo(Equal(base.ID))
+
+		r.Header.Del("Accept")
+		Expect(fingerprint.Of(r, "").ID).NotTo(Equal(base.ID))
+	})
+
+	It("should describe a handshake terminated by the balancer", func() {
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		r.TLS = &tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, NegotiatedProtocol: "h2"}
+		Expect(fingerprint.Of(r, "").TLS).To(Equal("TLS 1.3/TLS_AES_128_GCM_SHA256/h2"))
+		Expect(fingerprint.Of(r, "t13d1516h2_8daaf6152771_b0da82dd1658").TLS).To(Equal("t13d1516h2_8daaf6152771_b0da82dd1658"))
+	})
+
+	It("should hash client-controlled values into a fixed number of buckets", func() {
+		platforms := make(map[string]bool)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for i := range 1000 {
+			r.Header.Set("Sec-CH-UA-Platform", fmt.Sprintf(`"Linux %d"`, i))
+			platforms[fingerprint.Of(r, "").Platform] = true
+		}
+		Expect(len(platforms)).To(BeNumerically("<=", 64))
+		Expect(platforms).NotTo(HaveKey(ContainSubstring("Linux")))
+
+		r.Header.Del("Sec-CH-UA-Platform")
+		Expect(fingerprint.Of(r, "").Platform).To(BeEmpty())
+	})
+
+	It("should bound and sanitize the TLS fingerprint it keeps", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		Expect(fingerprint.Of(r, "\x00t13d"+string(make([]byte, 100))).TLS).To(Equal("t13d"))
+	})
+})
+
+var _ = Describe("Recorder", func() {
+	fp := func(id string) fingerprint.Fingerprint {
+		return fingerprint.Fingerprint{ID: id, Protocol: "HTTP/1.1"}
+	}
+
+	It("should count requests and status classes per fingerprint, busiest first", func() {
+		rec := fingerprint.NewRecorder(10)
+		rec.Record(fp("a"), http.StatusOK)
+		rec.Record(fp("b"), http.StatusOK)
+		rec.Record(fp("b"), http.StatusTooManyRequests)
+
+		snap := rec.Snapshot()
+		Expect(snap.Other).To(BeZero())
+		Expect(snap.Fingerprints).To(HaveLen(2))
+		Expect(snap.Fingerprints[0].ID).To(Equal("b"))
+		Expect(snap.Fingerprints[0].Requests).To(Equal(int64(2)))
+		Expect(snap.Fingerprints[0].StatusClasses).To(Equal(map[string]int64{"2xx": 1, "4xx": 1}))
+		Expect(snap.Fingerprints[1].ID).To(Equal("a"))
+	})
+
+	It("should replace the fingerprint counted least once full", func() {
+		rec := fingerprint.NewRecorder(2)
+		for range 5 {
+			rec.Record(fp("busy"), http.StatusOK)
+		}
+		rec.Record(fp("a"), http.StatusOK)
+		for _, id := range []string{"b", "c", "d", "e"} {
+			rec.Record(fp(id), http.StatusOK)
+		}
+
+		snap := rec.Snapshot()
+		Expect(snap.Fingerprints).To(HaveLen(2))
+		Expect(snap.Fingerprints[0].ID).To(Equal("busy"))
+		Expect(snap.Fingerprints[0].Requests).To(Equal(int64(5)))
+		Expect(snap.Fingerprints[0].Overcount).To(BeZero())
+		Expect(snap.Fingerprints[1].ID).To(Equal("e"))
+		Expect(snap.Fingerprints[1].Requests).To(Equal(int64(5)))
+		Expect(snap.Fingerprints[1].Overcount).To(Equal(int64(4)))
+		Expect(snap.Fingerprints[1].StatusClasses).To(Equal(map[string]int64{"2xx": 1}))
+		Expect(snap.Other).To(Equal(int64(4)))
+	})
+})
@@ -0,0 +1,123 @@
+package fingerprint
+
+import (
+	"cmp"
+	"container/heap"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stats counts the requests of one fingerprint. StatusClasses counts their
+// responses by class ("2xx", ..., "5xx"). Requests is an upper bound: up to
+// Overcount of them were counted for fingerprints this one replaced.
+type Stats struct {
+	Fingerprint
+	Requests      int64            `json:"requests"`
+	Overcount     int64            `json:"overcount,omitempty"`
+	StatusClasses map[string]int64 `json:"status_classes"`
+	FirstSeen     time.Time        `json:"first_seen"`
+	LastSeen      time.Time        `json:"last_seen"`
+}
+
+// Snapshot lists the recorded fingerprints, busiest first. Other counts the
+// requests of fingerprints that were replaced.
+type Snapshot struct {
+	Fingerprints []Stats `json:"fingerprints"`
+	Other        int64   `json:"other"`
+}
+
+// Recorder counts requests per fingerprint for up to max fingerprints. Once
+// full, a new fingerprint replaces the one counted least, taking over its
+// count as in the space-saving algorithm, so a fingerprint that keeps
+// sending is always listed however many others come and go, and listing
+// never costs more than a heap update per request.
+type Recorder struct {
+	mutex   sync.Mutex
+	max     int
+	entries map[string]*entry
+	byCount counts
+	other   int64
+}
+
+type entry struct {
+	Stats
+	index int
+}
+
+// counts is a min-heap of entries by request count.
+type counts []*entry
+
+func (c counts) Len() int           { return len(c) }
+func (c counts) Less(i, j int) bool { return c[i].Requests < c[j].Requests }
+func (c counts) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+	c[i].index, c[j].index = i, j
+}
+
+func (c *counts) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*c)
+	*c = append(*c, e)
+}
+
+func (c *counts) Pop() any {
+	old := *c
+	e := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return e
+}
+
+func NewRecorder(max int) *Recorder {
+	return &Recorder{max: max, entries: make(map[string]*entry)}
+}
+
+// Record counts a request with fingerprint fp answered with status.
+func (rec *Recorder) Record(fp Fingerprint, status int) {
+	now := time.Now()
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	e, ok := rec.entries[fp.ID]
+	if !ok {
+		if rec.max <= 0 {
+			rec.other++
+			return
+		}
+		e = &entry{Stats: Stats{Fingerprint: fp, StatusClasses: make(map[string]int64), FirstSeen: now}}
+		if len(rec.byCount) >= rec.max {
+			least := rec.byCount[0]
+			delete(rec.entries, least.ID)
+			rec.other += least.Requests - least.Overcount
+			e.Requests, e.Overcount, e.index = least.Requests, least.Requests, 0
+			rec.byCount[0] = e
+		} else {
+			heap.Push(&rec.byCount, e)
+		}
+		rec.entries[fp.ID] = e
+	}
+	e.Requests++
+	e.StatusClasses[strconv.Itoa(status/100)+"xx"]++
+	e.LastSeen = now
+	heap.Fix(&rec.byCount, e.index)
+}
+
+// Snapshot returns a copy of the counts.
+func (rec *Recorder) Snapshot() Snapshot {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	snap := Snapshot{Fingerprints: make([]Stats, 0, len(rec.entries)), Other: rec.other}
+	for _, e := range rec.entries {
+		c := e.Stats
+		c.Headers = slices.Clone(e.Headers)
+		c.StatusClasses = maps.Clone(e.StatusClasses)
+		snap.Fingerprints = append(snap.Fingerprints, c)
+	}
+	slices.SortFunc(snap.Fingerprints, func(a, b Stats) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.ID, b.ID))
+	})
+	return snap
+}
@@ -0,0 +1,22 @@
+// Package goroutines counts the goroutines started by each subsystem of the
+// load balancer and caps the ones whose number depends on traffic.
+//
+// Long-running loops (health checks, the metrics collector, watchers) are
+// started through Go with a subsystem label so their counts can be inspected
+// at runtime. Work that grows with load, such as CONNECT tunnels, takes a slot
+// with Acquire and is refused once the subsystem's limit is reached. OnPanic
+// registers a hook that sees a panic of a goroutine started through Go before
+// it ends the process.
+//
+// Usage:
+//
+//	goroutines.SetLimit("tunnel", 1000)
+//
+//	release, ok := goroutines.Acquire("tunnel")
+//	if !ok {
+//		// shed the request
+//	}
+//	defer release()
+//
+//	goroutines.Go("healthcheck", func() { healthcheck.HealthCheck(ctx, b, interval, logger) })
+package goroutines
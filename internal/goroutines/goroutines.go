@@ -0,0 +1,140 @@
+package goroutines
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Usage reports a subsystem's goroutines. Limit is zero when unlimited and
+// Rejected counts the starts refused because the limit was reached.
+type Usage struct {
+	Running  int    `json:"running"`
+	Peak     int    `json:"peak"`
+	Limit    int    `json:"limit,omitempty"`
+	Rejected uint64 `json:"rejected,omitempty"`
+}
+
+// Report is a point-in-time view of goroutine usage. Total is the process-wide
+// count, including goroutines not started through a Tracker such as the HTTP
+// server's per-connection goroutines.
+type Report struct {
+	Total      int              `json:"total"`
+	Subsystems map[string]Usage `json:"subsystems"`
+}
+
+type Tracker struct {
+	mutex      sync.Mutex
+	subsystems map[string]*Usage
+	onPanic    atomic.Pointer[func(subsystem string, v any)]
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{subsystems: make(map[string]*Usage)}
+}
+
+// Default is the tracker used by the package-level functions.
+var Default = NewTracker()
+
+func (t *Tracker) usage(subsystem string) *Usage {
+	u, ok := t.subsystems[subsystem]
+	if !ok {
+		u = &Usage{}
+		t.subsystems[subsystem] = u
+	}
+	return u
+}
+
+// SetLimit caps the number of running goroutines in subsystem. A limit of
+// zero or less removes the cap.
+func (t *Tracker) SetLimit(subsystem string, limit int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if limit < 0 {
+		limit = 0
+	}
+	t.usage(subsystem).Limit = limit
+}
+
+// Acquire takes a slot in subsystem for work running on the caller's own
+// goroutine. It reports false, without taking a slot, when the subsystem is
+// at its limit; otherwise release must be called once the work is done.
+func (t *Tracker) Acquire(subsystem string) (release func(), ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	u := t.usage(subsystem)
+	if u.Limit > 0 && u.Running >= u.Limit {
+		u.Rejected++
+		return nil, false
+	}
+
+	u.Running++
+	u.Peak = max(u.Peak, u.Running)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mutex.Lock()
+			u.Running--
+			t.mutex.Unlock()
+		})
+	}, true
+}
+
+// Go runs fn on a new goroutine counted against subsystem. It reports false,
+// without running fn, when the subsystem is at its limit.
+func (t *Tracker) Go(subsystem string, fn func()) bool {
+	release, ok := t.Acquire(subsystem)
+	if !ok {
+		return false
+	}
+
+	go func() {
+		defer release()
+		defer t.crashed(subsystem)
+		fn()
+	}()
+	return true
+}
+
+// OnPanic registers fn to be called when a goroutine started by Go panics,
+// before the panic carries on and ends the process. It replaces any function
+// registered before.
+func (t *Tracker) OnPanic(fn func(subsystem string, v any)) {
+	t.onPanic.Store(&fn)
+}
+
+func (t *Tracker) crashed(subsystem string) {
+	fn := t.onPanic.Load()
+	if fn == nil {
+		return
+	}
+	if v := recover(); v != nil {
+		(*fn)(subsystem, v)
+		panic(v)
+	}
+}
+
+func (t *Tracker) Report() Report {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	r := Report{
+		Total:      runtime.NumGoroutine(),
+		Subsystems: make(map[string]Usage, len(t.subsystems)),
+	}
+	for name, u := range t.subsystems {
+		r.Subsystems[name] = *u
+	}
+	return r
+}
+
+func SetLimit(subsystem string, limit int) { Default.SetLimit(subsystem, limit) }
+
+func Acquire(subsystem string) (release func(), ok bool) { return Default.Acquire(subsystem) }
+
+func Go(subsystem string, fn func()) bool { return Default.Go(subsystem, fn) }
+
+func OnPanic(fn func(subsystem string, v any)) { Default.OnPanic(fn) }
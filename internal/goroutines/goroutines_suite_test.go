@@ -0,0 +1,13 @@
+package goroutines_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestGoroutines(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Goroutines Suite")
+}
@@ -0,0 +1,83 @@
+package goroutines_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+var _ = Describe("Tracker", func() {
+	var t *goroutines.Tracker
+
+	BeforeEach(func() {
+		t = goroutines.NewTracker()
+	})
+
+	It("should count running goroutines per subsystem", func() {
+		stop := make(chan struct{})
+		for range 3 {
+			Expect(t.Go("healthcheck", func() { <-stop })).To(BeTrue())
+		}
+		Expect(t.Go("metrics", func() { <-stop })).To(BeTrue())
+
+		report := t.Report()
+		Expect(report.Subsystems["healthcheck"].Running).To(Equal(3))
+		Expect(report.Subsystems["metrics"].Running).To(Equal(1))
+		Expect(report.Total).To(BeNumerically(">=", 4))
+
+		close(stop)
+		Eventually(func() int { return t.Report().Subsystems["healthcheck"].Running }).Should(BeZero())
+		Expect(t.Report().Subsystems["healthcheck"].Peak).To(Equal(3))
+	})
+
+	It("should refuse starts beyond the limit", func() {
+		t.SetLimit("tunnel", 2)
+
+		release1, ok := t.Acquire("tunnel")
+		Expect(ok).To(BeTrue())
+		_, ok = t.Acquire("tunnel")
+		Expect(ok).To(BeTrue())
+
+		_, ok = t.Acquire("tunnel")
+		Expect(ok).To(BeFalse())
+		Expect(t.Go("tunnel", func() { Fail("should not run") })).To(BeFalse())
+
+		usage := t.Report().Subsystems["tunnel"]
+		Expect(usage).To(Equal(goroutines.Usage{Running: 2, Peak: 2, Limit: 2, Rejected: 2}))
+
+		release1()
+		release1()
+		Expect(t.Report().Subsystems["tunnel"].Running).To(Equal(1))
+		_, ok = t.Acquire("tunnel")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should treat a zero limit as unlimited", func() {
+		t.SetLimit("tunnel", 1)
+		t.SetLimit("tunnel", 0)
+
+		for range 5 {
+			_, ok := t.Acquire("tunnel")
+			Expect(ok).To(BeTrue())
+		}
+	})
+
+	It("should report a panicking goroutine before it ends the process", func() {
+		type crash struct {
+			subsystem string
+			value     any
+		}
+		crashes := make(chan crash, 1)
+		// The hook never returns, so the panic does not take the test
+		// process down with it.
+		t.OnPanic(func(subsystem string, v any) {
+			crashes <- crash{subsystem, v}
+			select {}
+		})
+
+		t.Go("watcher", func() { panic("boom") })
+
+		Eventually(crashes).Should(Receive(Equal(crash{"watcher", "boom"})))
+	})
+})
@@ -0,0 +1,10 @@
+// Package grpcstatus reads gRPC status codes from proxied responses. gRPC
+// reports failures in the grpc-status trailer of an HTTP 200 response, so
+// the HTTP status alone says nothing about whether a call succeeded.
+//
+// Usage:
+//
+//	if code, ok := grpcstatus.FromHeader(w.Header()); ok && grpcstatus.IsFailure(code) {
+//		breaker.RecordFailure()
+//	}
+package grpcstatus
@@ -0,0 +1,66 @@
+package grpcstatus
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Status codes, as defined by the gRPC protocol.
+const (
+	OK                 = 0
+	Canceled           = 1
+	Unknown            = 2
+	InvalidArgument    = 3
+	DeadlineExceeded   = 4
+	NotFound           = 5
+	AlreadyExists      = 6
+	PermissionDenied   = 7
+	ResourceExhausted  = 8
+	FailedPrecondition = 9
+	Aborted            = 10
+	OutOfRange         = 11
+	Unimplemented      = 12
+	Internal           = 13
+	Unavailable        = 14
+	DataLoss           = 15
+	Unauthenticated    = 16
+)
+
+const header = "Grpc-Status"
+
+// IsGRPC reports whether r is a gRPC call.
+func IsGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// FromHeader returns the status carried by h, either as a header (a
+// trailers-only response) or as a trailer copied into h by the reverse
+// proxy once the body is done.
+func FromHeader(h http.Header) (int, bool) {
+	value := h.Get(header)
+	if value == "" {
+		value = h.Get(http.TrailerPrefix + header)
+	}
+	if value == "" {
+		return 0, false
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return Unknown, true
+	}
+	return code, true
+}
+
+// IsFailure reports whether code means the backend failed to serve the call,
+// as opposed to the call itself being rejected, so it should count against
+// the backend's circuit breaker and error rate.
+func IsFailure(code int) bool {
+	switch code {
+	case Unknown, DeadlineExceeded, Internal, Unavailable, DataLoss:
+		return true
+	default:
+		return false
+	}
+}
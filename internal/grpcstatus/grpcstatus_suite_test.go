@@ -0,0 +1,13 @@
+package grpcstatus_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestGRPCStatus(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "gRPC Status Suite")
+}
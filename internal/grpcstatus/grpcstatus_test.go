@@ -0,0 +1,53 @@
+package grpcstatus_test
+
+import (
+	"net/http"
+
+	"github.com/angeloszaimis/load-balancer/internal/grpcstatus"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("gRPC status", func() {
+	It("detects gRPC calls by content type", func() {
+		r, _ := http.NewRequest(http.MethodPost, "http://lb/pkg.Svc/Call", nil)
+		r.Header.Set("Content-Type", "application/grpc+proto")
+		Expect(grpcstatus.IsGRPC(r)).To(BeTrue())
+
+		r.Header.Set("Content-Type", "application/json")
+		Expect(grpcstatus.IsGRPC(r)).To(BeFalse())
+	})
+
+	It("reads the status from a header or a trailer", func() {
+		h := http.Header{}
+		_, ok := grpcstatus.FromHeader(h)
+		Expect(ok).To(BeFalse())
+
+		h.Set("Grpc-Status", "14")
+		code, ok := grpcstatus.FromHeader(h)
+		Expect(ok).To(BeTrue())
+		Expect(code).To(Equal(grpcstatus.Unavailable))
+
+		h = http.Header{}
+		h.Set(http.TrailerPrefix+"Grpc-Status", "5")
+		code, ok = grpcstatus.FromHeader(h)
+		Expect(ok).To(BeTrue())
+		Expect(code).To(Equal(grpcstatus.NotFound))
+	})
+
+	It("treats an unparsable status as unknown", func() {
+		h := http.Header{}
+		h.Set("Grpc-Status", "oops")
+		code, ok := grpcstatus.FromHeader(h)
+		Expect(ok).To(BeTrue())
+		Expect(code).To(Equal(grpcstatus.Unknown))
+	})
+
+	It("only counts backend-side codes as failures", func() {
+		Expect(grpcstatus.IsFailure(grpcstatus.Unavailable)).To(BeTrue())
+		Expect(grpcstatus.IsFailure(grpcstatus.Internal)).To(BeTrue())
+		Expect(grpcstatus.IsFailure(grpcstatus.OK)).To(BeFalse())
+		Expect(grpcstatus.IsFailure(grpcstatus.NotFound)).To(BeFalse())
+		Expect(grpcstatus.IsFailure(grpcstatus.InvalidArgument)).To(BeFalse())
+	})
+})
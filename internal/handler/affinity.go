@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// WithAffinityFailoverHeader names a header that marks requests a hashing
+// strategy could not send to the backend their key maps to, because that
+// backend was unavailable or failed. It is set on the request to the new
+// backend and on the response, holding the name of the backend the session
+// was pinned to, so applications keeping session state locally know to
+// rebuild it. Failovers are counted in the metrics either way.
+func WithAffinityFailoverHeader(name string) Option {
+	return func(h *LoadBalancerHandler) {
+		h.failoverHeader = name
+	}
+}
+
+// pinnedBackend returns the backend the affinity key of r maps to among the
+// backends r is routed to when none of them is excluded, or nil unless the
+// strategy hashes. Standby backends and backends of later priority tiers
+// only take traffic while preferred ones are missing, so they are never
+// pinned.
+func (lb *LoadBalancerHandler) pinnedBackend(r *http.Request, clientIP string) *backend.Backend {
+	if _, ok := lb.balancer.LoadBalancerStrategy().(strategy.Keyer); !ok {
+		return nil
+	}
+
+	backends := lb.routed(r)
+	regular := make([]*backend.Backend, 0, len(backends))
+	for _, b := range backends {
+		if !b.IsStandby() {
+			regular = append(regular, b)
+		}
+	}
+	return lb.balancer.PinnedServer(lb.selectionContext(r, clientIP), loadbalancer.TopTier(regular))
+}
+
+// failOver records that a request pinned to pinned is served by next
+// instead and returns the request to forward to it and later attempts.
+func (lb *LoadBalancerHandler) failOver(w http.ResponseWriter, r *http.Request, pinned, next *backend.Backend, clientIP string) *http.Request {
+	lb.logger.Info("Session affinity failover",
+		slog.String("client", clientIP),
+		slog.String("pinned", pinned.Name()),
+		slog.String("backend", next.Name()))
+	lb.emitEvent(metrics.MetricEvent{
+		Type:      metrics.EventAffinityFailover,
+		Timestamp: time.Now(),
+		Backend:   pinned.Name(),
+	})
+
+	if lb.failoverHeader == "" {
+		return r
+	}
+	w.Header().Set(lb.failoverHeader, pinned.Name())
+	r = r.WithContext(r.Context())
+	r.Header = r.Header.Clone()
+	r.Header.Set(lb.failoverHeader, pinned.Name())
+	return r
+}
+
+// stripFailoverHeader drops a failover header sent by the client, so backends
+// only see the balancer's own.
+func (lb *LoadBalancerHandler) stripFailoverHeader(r *http.Request) *http.Request {
+	if lb.failoverHeader == "" || len(r.Header.Values(lb.failoverHeader)) == 0 {
+		return r
+	}
+	r = r.WithContext(r.Context())
+	r.Header = r.Header.Clone()
+	r.Header.Del(lb.failoverHeader)
+	return r
+}
@@ -0,0 +1,131 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Handler affinity failover", func() {
+	const header = "X-Session-Failover"
+
+	var (
+		received  atomic.Value
+		backends  []*backend.Backend
+		collector *metrics.Collector
+		lbHandler http.Handler
+	)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:40000"
+		req.Header.Set(header, "spoofed")
+		w := httptest.NewRecorder()
+		lbHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	pinned := func() *backend.Backend {
+		served := serve().Header().Get(backend.HeaderBackendServer)
+		for _, b := range backends {
+			if b.URL().String() == served {
+				return b
+			}
+		}
+		Fail("no backend served " + served)
+		return nil
+	}
+
+	BeforeEach(func() {
+		received.Store("")
+		backends = nil
+		for range 3 {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received.Store(r.Header.Get(header))
+			}))
+			DeferCleanup(server.Close)
+
+			b := backend.New(mustParseURL(server.URL), 1)
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		collector = metrics.NewCollector(100, log)
+		collector.Start(ctx)
+
+		lb := loadbalancer.NewLoadBalancer(strategy.NewConsistentHashStrategy(100))
+		lbHandler = handler.NewLoadBalancerHandler(log, lb, backends, collector, nil, 1,
+			handler.WithAffinityFailoverHeader(header))
+	})
+
+	It("should not mark requests served by the pinned backend", func() {
+		home := pinned()
+		w := serve()
+		Expect(w.Header().Get(backend.HeaderBackendServer)).To(Equal(home.URL().String()))
+		Expect(w.Header().Get(header)).To(BeEmpty())
+		Expect(received.Load()).To(BeEmpty())
+	})
+
+	It("should mark and count requests moved off an unavailable pinned backend", func() {
+		home := pinned()
+		home.SetHealthy(false)
+
+		w := serve()
+		Expect(w.Header().Get(backend.HeaderBackendServer)).NotTo(Equal(home.URL().String()))
+		Expect(w.Header().Get(header)).To(Equal(home.Name()))
+		Expect(received.Load()).To(Equal(home.Name()))
+
+		Eventually(func() int64 {
+			return collector.Snapshot("consistent_hash").Backends[home.Name()].AffinityFailovers
+		}).Should(Equal(int64(1)))
+	})
+
+	It("should pin requests among the backends their route selects", func() {
+		for i, b := range backends {
+			backends[i] = backend.New(b.URL(), 1, backend.WithName(fmt.Sprintf("b%d", i)))
+			backends[i].SetHealthy(true)
+		}
+		rt, err := routing.New([]routing.Rule{{Name: "pair", PathPrefix: "/", Backends: []string{"b0", "b1"}}}, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewConsistentHashStrategy(100))
+		lbHandler = handler.NewLoadBalancerHandler(log, lb, backends, collector, nil, 1,
+			handler.WithAffinityFailoverHeader(header), handler.WithRouting(rt))
+
+		for i := range 32 {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = fmt.Sprintf("192.0.2.%d:40000", i+1)
+			w := httptest.NewRecorder()
+			lbHandler.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get(header)).To(BeEmpty())
+		}
+	})
+
+	It("should not fail over strategies without affinity", func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		lbHandler = handler.NewLoadBalancerHandler(log, lb, backends, collector, nil, 1,
+			handler.WithAffinityFailoverHeader(header))
+		backends[0].SetHealthy(false)
+
+		Expect(serve().Header().Get(header)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPSource decides which address identifies the client for hashing
+// strategies and logs. Header is only honoured on connections from one of
+// the TrustedProxies; other connections, and requests without the header,
+// are identified by their peer address. An empty Header always uses the peer
+// address.
+type ClientIPSource struct {
+	Header         string
+	TrustedProxies []netip.Prefix
+}
+
+// DefaultClientIPSource trusts X-Forwarded-For from any peer.
+var DefaultClientIPSource = ClientIPSource{
+	Header:         "X-Forwarded-For",
+	TrustedProxies: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")},
+}
+
+// Reasons Resolve gives for not believing a client IP header.
+const (
+	// ClientIPUntrustedPeer: the header came from a peer that is not a
+	// trusted proxy, which points at spoofing or at traffic bypassing the
+	// proxies.
+	ClientIPUntrustedPeer = "untrusted_peer"
+	// ClientIPInvalid: a value that had to be read is not an IP address.
+	ClientIPInvalid = "invalid"
+)
+
+// WithClientIPSource replaces DefaultClientIPSource.
+func WithClientIPSource(source ClientIPSource) Option {
+	return func(h *LoadBalancerHandler) {
+		h.clientIPSource = source
+	}
+}
+
+// ClientIP returns the client address of r. X-Forwarded-For is read from the
+// right, skipping trusted proxies, so entries a client prepended itself are
+// ignored unless every hop is trusted. Other headers hold a single address.
+// Values that are not IP addresses are ignored.
+func (s ClientIPSource) ClientIP(r *http.Request) string {
+	client, _ := s.Resolve(r)
+	return client
+}
+
+// Resolve returns the client address like ClientIP and, when r carries the
+// header but it was not believed in full, the reason why.
+func (s ClientIPSource) Resolve(r *http.Request) (client, rejected string) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || s.Header == "" {
+		return host, ""
+	}
+
+	values := r.Header.Values(s.Header)
+	if len(values) == 0 {
+		return host, ""
+	}
+	if !s.trusted(peer) {
+		return host, ClientIPUntrustedPeer
+	}
+
+	if http.CanonicalHeaderKey(s.Header) != "X-Forwarded-For" {
+		if addr, ok := parseIP(strings.Split(values[0], ",")[0]); ok {
+			return addr.String(), ""
+		}
+		return host, ClientIPInvalid
+	}
+
+	var hops []string
+	for _, v := range values {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	client = host
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseIP(hops[i])
+		if !ok {
+			return client, ClientIPInvalid
+		}
+		client = addr.String()
+		if !s.trusted(addr) {
+			break
+		}
+	}
+	return client, ""
+}
+
+// TrustedPeer reports whether r came straight from one of the
+// TrustedProxies.
+func (s ClientIPSource) TrustedPeer(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	return err == nil && s.trusted(peer)
+}
+
+func (s ClientIPSource) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range s.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseIP(value string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(value))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
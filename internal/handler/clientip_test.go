@@ -0,0 +1,68 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+)
+
+var _ = Describe("ClientIPSource", func() {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	request := func(peer string, header http.Header) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = peer + ":40000"
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		return r
+	}
+
+	DescribeTable("ClientIP",
+		func(source handler.ClientIPSource, peer string, header http.Header, expected string) {
+			Expect(source.ClientIP(request(peer, header))).To(Equal(expected))
+		},
+		Entry("uses the leftmost X-Forwarded-For entry by default",
+			handler.DefaultClientIPSource, "192.0.2.1",
+			http.Header{"X-Forwarded-For": {"203.0.113.7, 10.0.0.2"}}, "203.0.113.7"),
+		Entry("uses the peer address without the header",
+			handler.DefaultClientIPSource, "192.0.2.1", http.Header{}, "192.0.2.1"),
+		Entry("ignores the header from untrusted peers",
+			handler.ClientIPSource{Header: "X-Forwarded-For", TrustedProxies: proxies}, "192.0.2.1",
+			http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "192.0.2.1"),
+		Entry("skips trusted hops from the right",
+			handler.ClientIPSource{Header: "X-Forwarded-For", TrustedProxies: proxies}, "10.0.0.1",
+			http.Header{"X-Forwarded-For": {"198.51.100.9, 203.0.113.7", "10.0.0.2"}}, "203.0.113.7"),
+		Entry("reads a single-address header",
+			handler.ClientIPSource{Header: "CF-Connecting-IP", TrustedProxies: proxies}, "10.0.0.1",
+			http.Header{"Cf-Connecting-Ip": {"2001:db8::1"}}, "2001:db8::1"),
+		Entry("ignores values that are not addresses",
+			handler.ClientIPSource{Header: "X-Real-IP", TrustedProxies: proxies}, "10.0.0.1",
+			http.Header{"X-Real-Ip": {"unknown"}}, "10.0.0.1"),
+		Entry("always uses the peer address without a header name",
+			handler.ClientIPSource{TrustedProxies: proxies}, "10.0.0.1",
+			http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "10.0.0.1"),
+	)
+
+	DescribeTable("Resolve",
+		func(peer string, header http.Header, expectedClient, expectedReason string) {
+			source := handler.ClientIPSource{Header: "X-Forwarded-For", TrustedProxies: proxies}
+			client, rejected := source.Resolve(request(peer, header))
+			Expect(client).To(Equal(expectedClient))
+			Expect(rejected).To(Equal(expectedReason))
+		},
+		Entry("accepts the header from trusted peers",
+			"10.0.0.1", http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "203.0.113.7", ""),
+		Entry("does not flag requests without the header",
+			"192.0.2.1", http.Header{}, "192.0.2.1", ""),
+		Entry("flags the header from untrusted peers",
+			"192.0.2.1", http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "192.0.2.1", handler.ClientIPUntrustedPeer),
+		Entry("flags hops that are not addresses",
+			"10.0.0.1", http.Header{"X-Forwarded-For": {"203.0.113.7, unknown"}}, "10.0.0.1", handler.ClientIPInvalid),
+	)
+})
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultDeadlineHeader carries the remaining request budget, in
+// milliseconds, to backends.
+const DefaultDeadlineHeader = "X-Deadline-Ms"
+
+type deadline struct {
+	timeout time.Duration
+	header  string
+}
+
+// WithDeadline gives every proxied request a budget of timeout and tells
+// backends how much of it is left in header on each attempt, so they can
+// give up on work that cannot finish in time. A budget received in header
+// from a trusted proxy (see ClientIPSource), e.g. a balancer in front,
+// shortens the request's own; from other peers the header is dropped. A zero
+// timeout only forwards received budgets. Requests whose budget runs out get
+// a 504.
+func WithDeadline(timeout time.Duration, header string) Option {
+	return func(h *LoadBalancerHandler) {
+		if header == "" {
+			header = DefaultDeadlineHeader
+		}
+		h.deadline = &deadline{timeout: timeout, header: header}
+	}
+}
+
+// apply returns r with the request's deadline set on its context. A budget
+// in the header is only believed when trusted is set. received reports
+// whether that budget is the one the deadline comes from.
+func (d *deadline) apply(r *http.Request, trusted bool) (_ *http.Request, received bool, cancel context.CancelFunc) {
+	if !trusted {
+		r.Header.Del(d.header)
+	}
+
+	budget, limited := d.timeout, d.timeout > 0
+	if ms, err := strconv.ParseInt(r.Header.Get(d.header), 10, 64); err == nil && ms >= 0 {
+		if sent := time.Duration(ms) * time.Millisecond; !limited || sent < budget {
+			budget, limited, received = sent, true, true
+		}
+	}
+	if !limited {
+		return r, false, func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	return r.WithContext(ctx), received, cancel
+}
+
+// annotate sets the remaining budget on an attempt's outgoing request. The
+// header map is copied so retries and captures see the original headers.
+func (d *deadline) annotate(r *http.Request) {
+	until, ok := r.Context().Deadline()
+	if !ok {
+		return
+	}
+	remaining := max(time.Until(until).Milliseconds(), 0)
+
+	r.Header = r.Header.Clone()
+	r.Header.Set(d.header, strconv.FormatInt(remaining, 10))
+}
+
+func deadlineExceeded(r *http.Request) bool {
+	return r.Context().Err() == context.DeadlineExceeded
+}
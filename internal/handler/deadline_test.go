@@ -0,0 +1,133 @@
+package handler_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Handler request deadline", func() {
+	var (
+		received atomic.Value
+		delay    time.Duration
+		calls    atomic.Int32
+		backends []*backend.Backend
+		registry *circuitbreaker.Registry
+	)
+
+	newHandler := func(timeout time.Duration, opts ...handler.Option) http.Handler {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		opts = append(opts, handler.WithDeadline(timeout, handler.DefaultDeadlineHeader))
+		return handler.NewLoadBalancerHandler(log, lb, backends, nil, registry, 1, opts...)
+	}
+
+	budget := func() int64 {
+		ms, err := strconv.ParseInt(received.Load().(string), 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		return ms
+	}
+
+	BeforeEach(func() {
+		delay = 0
+		calls.Store(0)
+		received.Store("")
+		backends = nil
+		registry = circuitbreaker.NewRegistry(1, time.Minute)
+		for range 2 {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				received.Store(r.Header.Get(handler.DefaultDeadlineHeader))
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return
+				}
+				w.Write([]byte("served"))
+			}))
+			DeferCleanup(server.Close)
+
+			b := backend.New(mustParseURL(server.URL), 1)
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+	})
+
+	It("should forward the remaining budget to the backend", func() {
+		w := httptest.NewRecorder()
+		newHandler(2*time.Second).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(budget()).To(BeNumerically("~", 2000, 100))
+	})
+
+	It("should shorten the budget to a smaller one received from the client", func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(handler.DefaultDeadlineHeader, "500")
+		newHandler(2*time.Second).ServeHTTP(httptest.NewRecorder(), req)
+		Expect(budget()).To(BeNumerically("<=", 500))
+		Expect(req.Header.Get(handler.DefaultDeadlineHeader)).To(Equal("500"))
+	})
+
+	It("should only forward received budgets without a timeout of its own", func() {
+		newHandler(0).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(received.Load()).To(BeEmpty())
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(handler.DefaultDeadlineHeader, "800")
+		newHandler(0).ServeHTTP(httptest.NewRecorder(), req)
+		Expect(budget()).To(BeNumerically("~", 800, 100))
+	})
+
+	It("should answer 504 without retrying once the budget runs out", func() {
+		delay = time.Second
+
+		w := httptest.NewRecorder()
+		newHandler(100*time.Millisecond).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusGatewayTimeout))
+		Expect(w.Header().Get(handler.HeaderErrorSource)).To(Equal(handler.ErrorSourceLB))
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should not count a budget the client set against the backend", func() {
+		delay = time.Second
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(handler.DefaultDeadlineHeader, "20")
+		w := httptest.NewRecorder()
+		newHandler(2*time.Second).ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusGatewayTimeout))
+		for _, b := range backends {
+			Expect(registry.GetBreaker(b.Name()).State()).To(Equal(circuitbreaker.StateClosed))
+		}
+
+		w = httptest.NewRecorder()
+		newHandler(20*time.Millisecond).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusGatewayTimeout))
+		Expect(registry.GetBreaker(backends[0].Name()).State()).To(Equal(circuitbreaker.StateOpen))
+	})
+
+	It("should ignore budgets from peers that are not trusted proxies", func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(handler.DefaultDeadlineHeader, "1")
+		w := httptest.NewRecorder()
+		newHandler(2*time.Second, handler.WithClientIPSource(handler.ClientIPSource{
+			TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		})).ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(budget()).To(BeNumerically("~", 2000, 100))
+	})
+})
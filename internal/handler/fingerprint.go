@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/angeloszaimis/load-balancer/internal/fingerprint"
+)
+
+// WithFingerprints counts every request in rec by its client's fingerprint.
+// tlsHeader, when set, names the header in which a TLS-terminating proxy
+// passes on the JA3 or JA4 hash of the client's handshake; it is only
+// believed from the client IP source's trusted proxies.
+func WithFingerprints(rec *fingerprint.Recorder, tlsHeader string) Option {
+	return func(h *LoadBalancerHandler) {
+		h.fingerprints = rec
+		h.tlsHashHeader = tlsHeader
+	}
+}
+
+// fingerprintOf returns the fingerprint of r.
+func (lb *LoadBalancerHandler) fingerprintOf(r *http.Request) fingerprint.Fingerprint {
+	var tlsHash string
+	if lb.tlsHashHeader != "" && lb.fromTrustedProxy(r) {
+		tlsHash = r.Header.Get(lb.tlsHashHeader)
+	}
+	return fingerprint.Of(r, tlsHash)
+}
+
+func (lb *LoadBalancerHandler) recordFingerprint(fp fingerprint.Fingerprint, recorder *statusRecorder) {
+	lb.fingerprints.Record(fp, recorder.statusCode)
+}
+
+// fromTrustedProxy reports whether r came straight from one of the client IP
+// source's trusted proxies.
+func (lb *LoadBalancerHandler) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	return err == nil && lb.clientIPSource.trusted(peer)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// maxReplayBytes bounds the request body kept to resend a gRPC call to
+// another backend. Larger calls, and streams still sending, are not retried.
+const maxReplayBytes = 64 << 10
+
+var errGRPCUnavailable = errors.New("backend answered grpc-status UNAVAILABLE")
+
+// replayBody records a request body as the transport reads it, so that a call
+// whose body was read to the end can be sent again.
+type replayBody struct {
+	io.ReadCloser
+	mutex    sync.Mutex
+	buf      bytes.Buffer
+	started  bool
+	complete bool
+	overflow bool
+}
+
+func newReplayBody(body io.ReadCloser) *replayBody {
+	if body == nil {
+		body = http.NoBody
+	}
+	return &replayBody{ReadCloser: body, complete: body == http.NoBody}
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.started = true
+	if b.buf.Len()+n > maxReplayBytes {
+		b.overflow = true
+	} else if !b.overflow {
+		b.buf.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+// Close is left to the server, which owns the client's body; the transport
+// closing it after an attempt must not end the request.
+func (b *replayBody) Close() error {
+	return nil
+}
+
+// replayable reports whether the body can be sent again: it was either not
+// read at all, e.g. because the backend could not be dialed, or read to the
+// end and recorded.
+func (b *replayBody) replayable() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return !b.started || (b.complete && !b.overflow)
+}
+
+// next returns the body for the next attempt: the client's body while it is
+// untouched, otherwise a copy of what was recorded.
+func (b *replayBody) next() io.ReadCloser {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.started {
+		return b
+	}
+	return io.NopCloser(bytes.NewReader(b.buf.Bytes()))
+}
+
+// restoreHeader resets h to saved, discarding headers a suppressed attempt
+// set on the shared response header map.
+func restoreHeader(h, saved http.Header) {
+	clear(h)
+	for k, v := range saved {
+		h[k] = v
+	}
+}
@@ -0,0 +1,226 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/grpcstatus"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Handler gRPC semantics", func() {
+	var (
+		servers  []*httptest.Server
+		backends []*backend.Backend
+		registry *circuitbreaker.Registry
+		calls    int32
+		log      *slog.Logger
+	)
+
+	// trailersOnly answers like a gRPC server rejecting a call outright:
+	// status in the headers and no body.
+	trailersOnly := func(status string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", status)
+			w.Header().Set("Grpc-Message", "rejected")
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+
+	// streamed sends the request body back as the response message and ends
+	// with status in a trailer.
+	streamed := func(status string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+			w.Header().Set("Grpc-Status", status)
+		}
+	}
+
+	serve := func(handlers ...http.HandlerFunc) {
+		for _, hf := range handlers {
+			server := httptest.NewServer(hf)
+			DeferCleanup(server.Close)
+			servers = append(servers, server)
+
+			b := backend.New(mustParseURL(server.URL), 1)
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+	}
+
+	call := func(h http.Handler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/helloworld.Greeter/SayHello", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/grpc")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	newHandler := func(collector *metrics.Collector) *handler.LoadBalancerHandler {
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		return handler.NewLoadBalancerHandler(log, lb, backends, collector, registry, 1)
+	}
+
+	BeforeEach(func() {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+		servers, backends = nil, nil
+		registry = circuitbreaker.NewRegistry(100, time.Minute)
+		atomic.StoreInt32(&calls, 0)
+	})
+
+	It("should retry a call answered UNAVAILABLE on another backend and resend its body", func() {
+		serve(trailersOnly("14"), streamed("0"))
+		h := newHandler(nil)
+
+		for range 4 {
+			w := call(h, "payload")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(Equal("payload"))
+			Expect(w.Header().Get("Grpc-Status")).To(Equal("0"))
+			Expect(w.Header().Get("Grpc-Message")).To(BeEmpty())
+		}
+		Expect(atomic.LoadInt32(&calls)).To(BeNumerically(">", 4))
+	})
+
+	It("should not retry once the response has started streaming", func() {
+		serve(streamed("14"), streamed("0"))
+		h := newHandler(nil)
+
+		statuses := []string{
+			call(h, "payload").Header().Get("Grpc-Status"),
+			call(h, "payload").Header().Get("Grpc-Status"),
+		}
+		Expect(statuses).To(ConsistOf("14", "0"))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+	})
+
+	It("should not retry a call whose body is too large to resend", func() {
+		serve(trailersOnly("14"), streamed("0"))
+		h := newHandler(nil)
+
+		large := strings.Repeat("x", 128<<10)
+		statuses := []string{
+			call(h, large).Header().Get("Grpc-Status"),
+			call(h, large).Header().Get("Grpc-Status"),
+		}
+		Expect(statuses).To(ConsistOf("14", "0"))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+	})
+
+	It("should not retry a call that is still sending when the backend gives up", func() {
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			http.NewResponseController(w).EnableFullDuplex()
+			r.Body.Read(make([]byte, 64))
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "14")
+			w.WriteHeader(http.StatusOK)
+		})
+
+		pr, pw := io.Pipe()
+		var once sync.Once
+		DeferCleanup(func() { once.Do(func() { pw.Close() }) })
+		go pw.Write([]byte("first message"))
+
+		req := httptest.NewRequest(http.MethodPost, "/helloworld.Greeter/Chat", pr)
+		req.Header.Set("Content-Type", "application/grpc")
+		w := httptest.NewRecorder()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			newHandler(nil).ServeHTTP(w, req)
+		}()
+
+		Eventually(done).Should(BeClosed())
+		Expect(w.Header().Get("Grpc-Status")).To(Equal("14"))
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+	})
+
+	It("should not retry a call whose connection broke after it was sent", func() {
+		serve(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			io.ReadAll(r.Body)
+			conn, _, err := http.NewResponseController(w).Hijack()
+			Expect(err).NotTo(HaveOccurred())
+			conn.Close()
+		}, streamed("0"))
+		h := newHandler(nil)
+
+		for range 2 {
+			call(h, "payload")
+		}
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+	})
+
+	It("should retry a call on a backend that could not be dialed", func() {
+		serve(streamed("0"))
+		down := backend.New(mustParseURL("http://127.0.0.1:1"), 1)
+		down.SetHealthy(true)
+		backends = append([]*backend.Backend{down}, backends...)
+		h := newHandler(nil)
+
+		for range 2 {
+			w := call(h, "payload")
+			Expect(w.Header().Get("Grpc-Status")).To(Equal("0"))
+			Expect(w.Body.String()).To(Equal("payload"))
+		}
+	})
+
+	It("should count backend-side statuses against the circuit breaker", func() {
+		registry = circuitbreaker.NewRegistry(1, time.Minute)
+		serve(streamed("13"))
+
+		w := call(newHandler(nil), "payload")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(registry.GetBreaker(backends[0].Name()).State()).To(Equal(circuitbreaker.StateOpen))
+	})
+
+	It("should not count call errors such as NOT_FOUND against the circuit breaker", func() {
+		registry = circuitbreaker.NewRegistry(1, time.Minute)
+		serve(streamed("5"))
+
+		call(newHandler(nil), "payload")
+		Expect(registry.GetBreaker(backends[0].Name()).State()).To(Equal(circuitbreaker.StateClosed))
+	})
+
+	It("should report gRPC statuses in metrics", func() {
+		serve(streamed("13"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		collector := metrics.NewCollector(10, log)
+		collector.Start(ctx)
+
+		call(newHandler(collector), "payload")
+
+		Eventually(func() map[int]int64 {
+			return collector.Snapshot("round-robin").Errors.UpstreamGRPC
+		}).Should(HaveKeyWithValue(grpcstatus.Internal, int64(1)))
+		Expect(collector.Snapshot("round-robin").Backends[backends[0].Name()].GRPCStatuses).
+			To(HaveKeyWithValue(grpcstatus.Internal, int64(1)))
+	})
+})
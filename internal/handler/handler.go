@@ -1,32 +1,126 @@
 package handler
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"log/slog"
+	"math"
 	"net"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/angeloszaimis/load-balancer/internal/admission"
 	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/capture"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/fingerprint"
+	"github.com/angeloszaimis/load-balancer/internal/grpcstatus"
+	"github.com/angeloszaimis/load-balancer/internal/hashkey"
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
 	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
 	"github.com/angeloszaimis/load-balancer/internal/metrics"
-	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
-
+	"github.com/angeloszaimis/load-balancer/internal/overload"
+	"github.com/angeloszaimis/load-balancer/internal/reqstate"
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+	"github.com/angeloszaimis/load-balancer/internal/script"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+	"github.com/angeloszaimis/load-balancer/internal/traffic"
+	"github.com/angeloszaimis/load-balancer/internal/waf"
 )
 
 type LoadBalancerHandler struct {
 	logger           *slog.Logger
 	balancer         *loadbalancer.LoadBalancer
-	backends         []*backend.Backend
+	pool             *backend.Pool
 	metricsCollector *metrics.Collector
 	circuitRegistry  *circuitbreaker.Registry
 	maxRetries 		 int
+	tunnel           bool
+	dialTimeout      time.Duration
+	capturer         *capture.Capturer
+	endpoints        *metrics.Endpoints
+	clientIPSource   ClientIPSource
+	hashKey          hashkey.Key
+	overload         *overload.Guard
+	queue            *admission.Queue
+	deadline         *deadline
+	failoverHeader   string
+	headerLimits     HeaderLimits
+	inspector        *inspect.Inspector
+	waf              *waf.Engine
+	wafTagHeader     string
+	router           *routing.Router
+	script           *script.Engine
+	scriptGroupLabel string
+	fingerprints     *fingerprint.Recorder
+	tlsHashHeader    string
+	classifier       *traffic.Classifier
+	trafficPolicy    TrafficPolicy
+}
+
+// HeaderErrorSource marks 5xx responses with where they originated:
+// ErrorSourceLB when the balancer generated the response itself,
+// ErrorSourceUpstream when it was relayed from a backend.
+const (
+	HeaderErrorSource   = "X-LB-Error-Source"
+	ErrorSourceLB       = "lb"
+	ErrorSourceUpstream = "upstream"
+)
+
+// Option customises a LoadBalancerHandler at construction time.
+type Option func(*LoadBalancerHandler)
+
+// WithCapture records proxied exchanges to c while a capture session runs.
+func WithCapture(c *capture.Capturer) Option {
+	return func(h *LoadBalancerHandler) {
+		h.capturer = c
+	}
+}
+
+// WithEndpointMetrics records per-endpoint metrics for every request that is
+// not a tunnel, labelled by e.
+func WithEndpointMetrics(e *metrics.Endpoints) Option {
+	return func(h *LoadBalancerHandler) {
+		h.endpoints = e
+	}
+}
+
+// WithBackendPool balances over the backends of p, so that backends added to
+// or removed from it take effect without a new handler. It replaces the
+// backends passed to NewLoadBalancerHandler.
+func WithBackendPool(p *backend.Pool) Option {
+	return func(h *LoadBalancerHandler) {
+		h.pool = p
+	}
+}
+
+// WithOverloadGuard rejects requests g sheds with a 503 before a backend is
+// selected.
+func WithOverloadGuard(g *overload.Guard) Option {
+	return func(h *LoadBalancerHandler) {
+		h.overload = g
+	}
+}
+
+// WithAdmissionQueue makes requests wait in q while every backend is full,
+// instead of sending them to a full backend, and answers 503 to those that
+// cannot.
+func WithAdmissionQueue(q *admission.Queue) Option {
+	return func(h *LoadBalancerHandler) {
+		h.queue = q
+	}
 }
 
 type retryableWriter struct {
 	http.ResponseWriter
 	headerWritten bool
 	statusCode    int
+	// canRetry, when set, lets a gRPC UNAVAILABLE response be held back
+	// so the call can be retried; suppressed records that it was.
+	canRetry   func() bool
+	suppressed bool
 }
 
 type statusRecorder struct {
@@ -35,12 +129,24 @@ type statusRecorder struct {
 }
 
 func (rw *retryableWriter) WriteHeader(code int) {
+	if rw.canRetry != nil && !rw.headerWritten {
+		if status, ok := grpcstatus.FromHeader(rw.Header()); ok && status == grpcstatus.Unavailable && rw.canRetry() {
+			rw.suppressed = true
+			return
+		}
+	}
+	if code >= http.StatusInternalServerError {
+		rw.Header().Set(HeaderErrorSource, ErrorSourceUpstream)
+	}
 	rw.headerWritten = true
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
 
 func (rw *retryableWriter) Write(b []byte) (int, error) {
+	if rw.suppressed {
+		return len(b), nil
+	}
 	if !rw.headerWritten {
 		rw.headerWritten = true
 		rw.statusCode = http.StatusOK
@@ -48,6 +154,42 @@ func (rw *retryableWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer. The reverse
+// proxy relies on it to flush streamed responses and to force chunked
+// encoding before trailers.
+func (rw *retryableWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *retryableWriter) Flush() {
+	if rw.suppressed {
+		return
+	}
+	if !rw.headerWritten {
+		rw.headerWritten = true
+		rw.statusCode = http.StatusOK
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack hands the client connection to the caller. The reverse proxy only
+// does so for protocol upgrades, so the response is recorded as a 101.
+func (rw *retryableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil {
+		rw.headerWritten = true
+		rw.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+func (rw *retryableWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := rw.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
 // isIdempotent returns true if the HTTP method is safe to retry.
 // Based on RFC 7231.
 func isIdempotent(method string) bool {
@@ -62,26 +204,106 @@ func isIdempotent(method string) bool {
 	}
 }
 
-func (lb *LoadBalancerHandler) selectBackend(clientIP string, trackBackends map[string]bool) (*backend.Backend, error) {
-	available := make([]*backend.Backend, 0, len(lb.backends))
-	for _, b := range lb.backends {
-		if !trackBackends[b.URL().String()] && b.IsHealthy() {
-			available = append(available, b)
-		}
+// selectBackend picks a backend that has not been tried yet and reserves a
+// connection on it, waiting in the admission queue while all are full. The
+// caller must release the reservation with release once the attempt is over,
+// including when it is skipped. pinned, the backend r's affinity key maps to
+// if any, is taken while it can be without selecting again.
+func (lb *LoadBalancerHandler) selectBackend(r *http.Request, clientIP string, trackBackends map[string]bool, pinned *backend.Backend) (*backend.Backend, error) {
+	ctx := lb.selectionContext(r, clientIP)
+	if lb.queue == nil {
+		return lb.reserve(ctx, lb.untried(r, trackBackends), pinned, (*backend.Backend).TryIncrementConn)
 	}
 
+	return lb.queue.Wait(r.Context(), func() []*backend.Backend {
+		return lb.untried(r, trackBackends)
+	}, func(admissible []*backend.Backend) (*backend.Backend, error) {
+		b, err := lb.reserve(ctx, admissible, pinned, lb.queue.Reserve)
+		if errors.Is(err, loadbalancer.ErrInFlightLimit) {
+			// Requests woken at the same time took the room first.
+			return nil, nil
+		}
+		return b, err
+	})
+}
+
+// reserve selects one of available and reserves a connection on it with
+// reserveConn, preferring pinned.
+func (lb *LoadBalancerHandler) reserve(ctx strategy.SelectionContext, available []*backend.Backend, pinned *backend.Backend, reserveConn func(*backend.Backend) bool) (*backend.Backend, error) {
 	if len(available) == 0 {
 		return nil, http.ErrServerClosed
 	}
+	return lb.balancer.GetAndReservePinnedServerWith(ctx, available, pinned, reserveConn)
+}
 
-	if _, ok := lb.balancer.LoadBalancerStrategy().(interface{ SetKey(string) }); ok {
-        return lb.balancer.GetAndReserveServerWithKey(available, clientIP)
-    }
-    return lb.balancer.GetAndReserveServer(available)
+// untried returns the available backends r may go to that are not in tried.
+func (lb *LoadBalancerHandler) untried(r *http.Request, tried map[string]bool) []*backend.Backend {
+	backends := lb.routed(r)
+	available := make([]*backend.Backend, 0, len(backends))
+	for _, b := range backends {
+		if !tried[b.Name()] && b.IsAvailable() {
+			available = append(available, b)
+		}
+	}
+	return available
+}
+
+// release ends a reservation made by selectBackend and lets a queued request
+// have the connection.
+func (lb *LoadBalancerHandler) release(b *backend.Backend) {
+	b.DecrementConn()
+	if lb.queue != nil {
+		lb.queue.Release()
+	}
 }
 
 func (lb *LoadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-    clientIP := extractClientIP(r)
+	r, state := reqstate.Ensure(r)
+	clientIP, rejected := lb.clientIPSource.Resolve(r)
+	state.SetClientIP(clientIP)
+	if rejected != "" {
+		lb.logger.Debug("Ignored client IP header",
+			slog.String("reason", rejected),
+			slog.String("peer", r.RemoteAddr),
+			slog.String("header", lb.clientIPSource.Header),
+			slog.String("value", r.Header.Get(lb.clientIPSource.Header)))
+		lb.emitEvent(metrics.MetricEvent{
+			Type:      metrics.EventClientIPRejected,
+			Timestamp: time.Now(),
+			Reason:    rejected,
+		})
+	}
+
+	if lb.fingerprints != nil {
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		w = recorder
+		defer lb.recordFingerprint(lb.fingerprintOf(r), recorder)
+	}
+
+	if lb.rejectHeaders(w, r, clientIP) {
+		return
+	}
+
+	if trusted := lb.clientIPSource.TrustedPeer(r); lb.overload != nil && !lb.overload.Admit(r, trusted) {
+		lb.logger.Debug("Shedding request while overloaded",
+			slog.String("from", clientIP),
+			slog.String("priority", lb.overload.Priority(r, trusted).String()))
+		w.Header().Set("Retry-After", "1")
+		lb.writeRejection(w, http.StatusServiceUnavailable, ReasonOverloaded, "Service overloaded")
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		lb.serveTunnel(w, r, clientIP)
+		return
+	}
+
+	var receivedBudget bool
+	if lb.deadline != nil {
+		var cancel context.CancelFunc
+		r, receivedBudget, cancel = lb.deadline.apply(r, lb.clientIPSource.TrustedPeer(r))
+		defer cancel()
+	}
 
     lb.logger.Info("Received request",
         slog.String("from", clientIP),
@@ -91,19 +313,73 @@ func (lb *LoadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
         slog.String("host", r.Host),
         slog.String("user_agent", r.UserAgent()))
 
-    // Determine max retries based on method idempotency
+	var route string
+	if lb.endpoints != nil {
+		route = lb.endpoints.Label(r)
+		state.SetRoute(route)
+	}
+
+	class := lb.classify(r)
+	if lb.recordsEndpoint(class) || class != "" {
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		w = recorder
+		if lb.recordsEndpoint(class) {
+			defer lb.recordEndpoint(route, recorder, time.Now())
+		}
+		if class != "" {
+			defer lb.recordClass(class, recorder)
+		}
+	}
+
+	r, ok := lb.inspectBody(w, r, clientIP)
+	if !ok {
+		return
+	}
+
+	if lb.applyWAF(w, r, clientIP) {
+		return
+	}
+	r = lb.applyRouting(r, clientIP)
+	r, ok = lb.applyScript(w, r, clientIP)
+	if !ok {
+		return
+	}
+
+	exchange := lb.capturer.Begin(r)
+	if exchange != nil {
+		w = exchange.Writer(w)
+		defer exchange.Finish()
+	}
+
+	// Determine max retries based on method idempotency. gRPC calls are
+	// POSTs but are retried when the backend could not be dialed or refused
+	// them with UNAVAILABLE, provided their body can be sent again.
+	grpc := grpcstatus.IsGRPC(r)
     maxAttempts := 1
-    if isIdempotent(r.Method) && lb.maxRetries > 0 {
+	if (isIdempotent(r.Method) || grpc) && lb.maxRetries > 0 {
         maxAttempts = lb.maxRetries + 1
     }
 
+	var body *replayBody
+	if grpc && maxAttempts > 1 {
+		body = newReplayBody(r.Body)
+	}
+
     // Track which backends we've tried (to avoid retrying same one)
     triedBackends := make(map[string]bool)
 
+	r = lb.stripFailoverHeader(r)
+	pinned := lb.pinnedBackend(r, clientIP)
+	failedOver := false
+
     var lastErr error
     for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if deadlineExceeded(r) {
+			break
+		}
+
         // Select a backend
-        nextServer, err := lb.selectBackend(clientIP, triedBackends)
+		nextServer, err := lb.selectBackend(r, clientIP, triedBackends, pinned)
         if err != nil {
             lb.logger.Warn("No healthy backends available",
                 slog.String("client", clientIP),
@@ -112,68 +388,161 @@ func (lb *LoadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
             break
         }
 
-        backendURL := nextServer.URL().String()
-        triedBackends[backendURL] = true
+		backendName := nextServer.Name()
+		triedBackends[backendName] = true
 
         // Check circuit breaker
         if lb.circuitRegistry != nil {
-            cb := lb.circuitRegistry.GetBreaker(backendURL)
+			cb := lb.circuitRegistry.GetBreaker(backendName)
             if !cb.Allow() {
+				lb.release(nextServer)
                 lb.logger.Debug("Circuit breaker open, skipping backend",
-                    slog.String("backend", backendURL),
+					slog.String("backend", backendName),
                     slog.Int("attempt", attempt))
+				lb.emitEvent(metrics.MetricEvent{
+					Type:      metrics.EventBackendFailure,
+					Timestamp: time.Now(),
+					Backend:   backendName,
+					Reason:    metrics.BreakerRejected,
+				})
                 continue // Try next backend
             }
         }
+		if pinned != nil && nextServer != pinned && !failedOver {
+			failedOver = true
+			r = lb.failOver(w, r, pinned, nextServer, clientIP)
+		}
+		exchange.SetBackend(backendName)
+		state.BeginAttempt(backendName)
 
         // Emit metrics
         lb.emitEvent(metrics.MetricEvent{
             Type:      metrics.EventRequestReceived,
             Timestamp: time.Now(),
-            Backend:   backendURL,
+			Backend:   backendName,
         })
         lb.emitEvent(metrics.MetricEvent{
             Type:      metrics.EventBackendSelected,
             Timestamp: time.Now(),
-            Backend:   backendURL,
+			Backend:   backendName,
         })
 
-        // Increment connection count
-        nextServer.IncrementConn()
-
         lb.logger.Info("Forwarding to backend",
             slog.String("client", clientIP),
-            slog.String("backend", backendURL),
+			slog.String("backend", backendName),
             slog.Int("attempt", attempt))
 
         // Prepare for proxying
-        w.Header().Set("X-Backend-Server", backendURL)
+		w.Header().Set(backend.HeaderBackendServer, nextServer.URL().String())
 
         wrapped := &retryableWriter{ResponseWriter: w, statusCode: http.StatusOK}
         start := time.Now()
 
         // Enable error capture from proxy
         reqWithCapture, proxyErr := backend.WithProxyErrorCapture(r)
+		if lb.deadline != nil {
+			lb.deadline.annotate(reqWithCapture)
+		}
+
+		var savedHeader http.Header
+		if body != nil {
+			reqWithCapture.Body = body.next()
+			savedHeader = w.Header().Clone()
+			wrapped.canRetry = func() bool { return attempt < maxAttempts && body.replayable() }
+		}
 
         // Forward request to backend
-        nextServer.ReverseProxy().ServeHTTP(wrapped, reqWithCapture)
+		aborted := forward(nextServer.ReverseProxy(), wrapped, reqWithCapture)
 
         duration := time.Since(start)
-        nextServer.DecrementConn()
+		lb.release(nextServer)
+
+		// A client that went away is not the backend's fault: don't feed the
+		// circuit breaker or retry, just record the cancellation.
+		if (proxyErr.Err != nil || aborted) && clientGone(r) {
+			lb.logger.Info("Client disconnected",
+				slog.String("client", clientIP),
+				slog.String("backend", backendName),
+				slog.Duration("after", duration))
+
+			lb.emitEvent(metrics.MetricEvent{
+				Type:      metrics.EventClientCanceled,
+				Timestamp: time.Now(),
+				Backend:   backendName,
+				Duration:  duration,
+			})
+
+			if aborted {
+				panic(http.ErrAbortHandler)
+			}
+			return
+		}
+
+		// Copying the body failed after headers were sent, on either side.
+		// The client connection has to be aborted.
+		if aborted {
+			lb.logger.Warn("Response aborted mid-body",
+				slog.String("client", clientIP),
+				slog.String("backend", backendName))
+			panic(http.ErrAbortHandler)
+		}
+
+		// The backend answered a gRPC call with UNAVAILABLE before sending
+		// anything else; nothing reached the client, so try another backend.
+		if wrapped.suppressed {
+			restoreHeader(w.Header(), savedHeader)
+
+			if lb.circuitRegistry != nil {
+				lb.circuitRegistry.GetBreaker(backendName).RecordFailure()
+			}
+			lb.observe(nextServer, duration, true)
+
+			unavailable := grpcstatus.Unavailable
+			lb.emitEvent(metrics.MetricEvent{
+				Type:       metrics.EventResponseCompleted,
+				Timestamp:  time.Now(),
+				Backend:    backendName,
+				Duration:   duration,
+				StatusCode: http.StatusOK,
+				GRPCStatus: &unavailable,
+			})
+
+			lb.logger.Info("Retrying gRPC call answered UNAVAILABLE",
+				slog.String("backend", backendName),
+				slog.Int("attempt", attempt),
+				slog.Int("max_attempts", maxAttempts))
+
+			lastErr = errGRPCUnavailable
+			continue
+		}
 
         // Check if proxy succeeded
         if proxyErr.Err == nil {
-            // Success!
+			// Success, unless a gRPC call ended with a status that means
+			// the backend failed.
+			var grpcStatus *int
+			failed := false
+			if code, ok := grpcstatus.FromHeader(w.Header()); grpc && ok {
+				grpcStatus = &code
+				failed = grpcstatus.IsFailure(code)
+			}
+
             if lb.circuitRegistry != nil {
-                lb.circuitRegistry.GetBreaker(backendURL).RecordSuccess()
-            }
+				if failed {
+					lb.circuitRegistry.GetBreaker(backendName).RecordFailure()
+				} else {
+					lb.circuitRegistry.GetBreaker(backendName).RecordSuccess()
+				}
+			}
+			lb.observe(nextServer, duration, failed)
 
             lb.emitEvent(metrics.MetricEvent{
                 Type:       metrics.EventResponseCompleted,
                 Timestamp:  time.Now(),
-                Backend:    backendURL,
+				Backend:    backendName,
                 Duration:   duration,
                 StatusCode: wrapped.statusCode,
+				GRPCStatus: grpcStatus,
             })
             nextServer.RecordResponse(duration)
             return // Done!
@@ -181,14 +550,28 @@ func (lb *LoadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
         // Proxy failed
         lb.logger.Warn("Backend request failed",
-            slog.String("backend", backendURL),
+			slog.String("backend", backendName),
             slog.String("error", proxyErr.Err.Error()),
             slog.Int("attempt", attempt),
             slog.Bool("header_written", wrapped.headerWritten))
 
-        if lb.circuitRegistry != nil {
-            lb.circuitRegistry.GetBreaker(backendURL).RecordFailure()
-        }
+		// A budget the caller set ran out. The backend was not given the
+		// time to answer, and counting that against it would let any
+		// caller open its breaker or decay its weight with a tiny budget.
+		if !receivedBudget || !deadlineExceeded(r) {
+			if lb.circuitRegistry != nil {
+				lb.circuitRegistry.GetBreaker(backendName).RecordFailure()
+			}
+			lb.observe(nextServer, duration, true)
+		}
+
+		lb.emitEvent(metrics.MetricEvent{
+			Type:      metrics.EventBackendFailure,
+			Timestamp: time.Now(),
+			Backend:   backendName,
+			Duration:  duration,
+			Reason:    backend.ClassifyFailure(proxyErr.Err),
+		})
 
         lastErr = proxyErr.Err
 
@@ -196,9 +579,25 @@ func (lb *LoadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
         if wrapped.headerWritten {
             // Headers already sent to client - cannot retry
             lb.logger.Warn("Cannot retry: headers already written",
-                slog.String("backend", backendURL))
+				slog.String("backend", backendName))
             return
         }
+		// A gRPC call is not idempotent: the backend may have acted on it
+		// whatever broke afterwards. Only a call that never reached the
+		// backend, or was refused with UNAVAILABLE above, is sent again.
+		if grpc && !isIdempotent(r.Method) && backend.ClassifyFailure(proxyErr.Err) != backend.FailureDial {
+			lb.logger.Warn("Cannot retry: gRPC call may have reached the backend",
+				slog.String("backend", backendName))
+			break
+		}
+		if body != nil && !body.replayable() {
+			lb.logger.Warn("Cannot retry: request body was partly sent",
+				slog.String("backend", backendName))
+			break
+		}
+		if deadlineExceeded(r) {
+			break
+		}
 
         // Will retry with next backend (if attempts remain)
         lb.logger.Info("Retrying with different backend",
@@ -206,20 +605,117 @@ func (lb *LoadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
             slog.Int("max_attempts", maxAttempts))
     }
 
+	if deadlineExceeded(r) {
+		lb.logger.Warn("Request budget exhausted",
+			slog.String("client", clientIP),
+			slog.Any("error", lastErr))
+		lb.writeError(w, http.StatusGatewayTimeout, "Gateway timeout")
+		return
+	}
+
+	if errors.Is(lastErr, admission.ErrQueueFull) || errors.Is(lastErr, admission.ErrTimeout) || errors.Is(lastErr, loadbalancer.ErrInFlightLimit) {
+		lb.logger.Warn("Backends at capacity",
+			slog.String("client", clientIP),
+			slog.Any("error", lastErr))
+		w.Header().Set("Retry-After", "1")
+		lb.writeRejection(w, http.StatusServiceUnavailable, ReasonAtCapacity, "Backends at capacity")
+		return
+	}
+
     // All retries exhausted
     lb.logger.Error("All backends failed",
         slog.String("client", clientIP),
         slog.Any("error", lastErr))
-    http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+	lb.writeUnavailable(w, r)
+}
+
+// writeUnavailable sends a 503. When every available backend's circuit is
+// open, Retry-After tells clients when the first one lets a probe through.
+func (lb *LoadBalancerHandler) writeUnavailable(w http.ResponseWriter, r *http.Request) {
+	wait, circuitsOpen := lb.circuitRetryAfter(r)
+	if circuitsOpen {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	lb.writeRejection(w, http.StatusServiceUnavailable, lb.unavailableReason(r, circuitsOpen), "Service unavailable")
+}
+
+// circuitRetryAfter returns the time until the soonest open circuit among the
+// available backends r may go to resets, provided all of them are open.
+func (lb *LoadBalancerHandler) circuitRetryAfter(r *http.Request) (time.Duration, bool) {
+	if lb.circuitRegistry == nil {
+		return 0, false
+	}
+
+	var soonest time.Duration
+	found := false
+	for _, b := range lb.routed(r) {
+		if !b.IsAvailable() {
+			continue
+		}
+
+		wait := lb.circuitRegistry.GetBreaker(b.Name()).RetryAfter()
+		if wait <= 0 {
+			return 0, false
+		}
+		if !found || wait < soonest {
+			soonest, found = wait, true
+		}
+	}
+
+	return soonest, found
+}
+
+// writeError sends a response generated by the balancer itself rather than a
+// backend, marking 5xx responses so they can be told apart from upstream ones.
+func (lb *LoadBalancerHandler) writeError(w http.ResponseWriter, code int, msg string) {
+	lb.recordLBError(w, code)
+	http.Error(w, msg, code)
 }
 
-func extractClientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return strings.TrimSpace(strings.Split(xff, ",")[0])
+// recordLBError marks and counts a 5xx response the balancer generated.
+func (lb *LoadBalancerHandler) recordLBError(w http.ResponseWriter, code int) {
+	if code >= http.StatusInternalServerError {
+		w.Header().Set(HeaderErrorSource, ErrorSourceLB)
+		lb.emitEvent(metrics.MetricEvent{
+			Type:       metrics.EventLBError,
+			Timestamp:  time.Now(),
+			StatusCode: code,
+		})
 	}
+}
+
+// forward runs the reverse proxy and reports whether it aborted the response
+// with http.ErrAbortHandler, which it does when copying the body fails after
+// headers were sent.
+func forward(proxy http.Handler, w http.ResponseWriter, r *http.Request) (aborted bool) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			if rec != http.ErrAbortHandler {
+				panic(rec)
+			}
+			aborted = true
+		}
+	}()
+
+	proxy.ServeHTTP(w, r)
+	return false
+}
 
-	host, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return host
+func clientGone(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.Canceled)
+}
+
+// observe reports the outcome of an attempt to strategies that learn from it
+// and to the backend's error decay.
+func (lb *LoadBalancerHandler) observe(b *backend.Backend, duration time.Duration, failed bool) {
+	if failed {
+		b.Decay(time.Now())
+	} else {
+		b.Recover(time.Now())
+	}
+	if o, ok := lb.balancer.LoadBalancerStrategy().(strategy.Observer); ok {
+		o.Observe(b, duration, failed)
+	}
 }
 
 func (lb *LoadBalancerHandler) emitEvent(event metrics.MetricEvent) {
@@ -227,17 +723,47 @@ func (lb *LoadBalancerHandler) emitEvent(event metrics.MetricEvent) {
 		return
 	}
 
-	select {
-	case lb.metricsCollector.EventChannel() <- event:
-	default:
-	}
+	lb.metricsCollector.Emit(event)
 }
 
 func (r *statusRecorder) WriteHeader(code int) {
-	r.statusCode = code
+	if code >= http.StatusOK {
+		r.statusCode = code
+	}
 	r.ResponseWriter.WriteHeader(code)
 }
 
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+func (r *statusRecorder) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := r.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// recordEndpoint emits the response the client received for endpoint, once
+// retries are over.
+func (lb *LoadBalancerHandler) recordEndpoint(endpoint string, recorder *statusRecorder, start time.Time) {
+	lb.emitEvent(metrics.MetricEvent{
+		Type:       metrics.EventEndpointCompleted,
+		Timestamp:  time.Now(),
+		Duration:   time.Since(start),
+		StatusCode: recorder.statusCode,
+		Endpoint:   endpoint,
+	})
+}
+
 func NewLoadBalancerHandler(
     logger *slog.Logger,
     lb *loadbalancer.LoadBalancer,
@@ -245,13 +771,23 @@ func NewLoadBalancerHandler(
     collector *metrics.Collector,
     circuitRegistry *circuitbreaker.Registry,
     maxRetries int,
+	opts ...Option,
 ) *LoadBalancerHandler {
-    return &LoadBalancerHandler{
+	h := &LoadBalancerHandler{
         logger:           logger,
         balancer:         lb,
-        backends:         backends,
         metricsCollector: collector,
         circuitRegistry:  circuitRegistry,
         maxRetries:       maxRetries,
+		clientIPSource:   DefaultClientIPSource,
     }
+
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.pool == nil {
+		h.pool = backend.NewPool(backends)
+	}
+
+	return h
 }
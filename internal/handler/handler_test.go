@@ -1,23 +1,42 @@
 package handler_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/angeloszaimis/load-balancer/internal/admission"
 	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/capture"
 	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/fingerprint"
 	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
 	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/overload"
+	"github.com/angeloszaimis/load-balancer/internal/reqstate"
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+	"github.com/angeloszaimis/load-balancer/internal/script"
 	"github.com/angeloszaimis/load-balancer/internal/strategy"
+	"github.com/angeloszaimis/load-balancer/internal/traffic"
+	"github.com/angeloszaimis/load-balancer/internal/waf"
 )
 
 var _ = Describe("Handler", func() {
@@ -83,6 +102,118 @@ var _ = Describe("Handler", func() {
 
 				Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
 			})
+
+			It("should mark the 503 as generated by the load balancer", func() {
+				req := httptest.NewRequest(http.MethodGet, "/test", nil)
+				w := httptest.NewRecorder()
+
+				h.ServeHTTP(w, req)
+
+				Expect(w.Header().Get(handler.HeaderErrorSource)).To(Equal(handler.ErrorSourceLB))
+			})
+
+			It("should give the reason in a header and a JSON body", func() {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+				Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonNoHealthyBackends))
+				Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+				var body map[string]string
+				Expect(json.Unmarshal(w.Body.Bytes(), &body)).To(Succeed())
+				Expect(body).To(Equal(map[string]string{
+					"error":  "Service unavailable",
+					"reason": handler.ReasonNoHealthyBackends,
+				}))
+			})
+
+			It("should report draining backends when the healthy ones are being drained", func() {
+				backends[0].SetHealthy(true)
+				backends[0].SetDraining(true)
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+				Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonBackendsDraining))
+			})
+		})
+
+		It("should mark 5xx responses relayed from a backend as upstream", func() {
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+			defer failing.Close()
+
+			b := backend.New(mustParseURL(failing.URL), 1)
+			b.SetHealthy(true)
+			h = handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			Expect(w.Code).To(Equal(http.StatusBadGateway))
+			Expect(w.Header().Get(handler.HeaderErrorSource)).To(Equal(handler.ErrorSourceUpstream))
+		})
+
+		It("should send a single X-Backend-Server set by the balancer", func() {
+			spoofing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(backend.HeaderBackendServer, "http://elsewhere")
+				w.Header().Set(handler.HeaderErrorSource, handler.ErrorSourceLB)
+			}))
+			defer spoofing.Close()
+
+			b := backend.New(mustParseURL(spoofing.URL), 1)
+			b.SetHealthy(true)
+			h = handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			Expect(w.Header().Values(backend.HeaderBackendServer)).To(Equal([]string{spoofing.URL}))
+			Expect(w.Header().Get(handler.HeaderErrorSource)).To(BeEmpty())
+		})
+
+		Context("with an admission queue", func() {
+			var queue *admission.Queue
+
+			BeforeEach(func() {
+				queue = admission.New(admission.Options{MaxInFlight: 1, MaxQueued: 1, Timeout: 50 * time.Millisecond})
+				h = handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 0, handler.WithAdmissionQueue(queue))
+				backends[0].IncrementConn()
+			})
+
+			It("should answer 503 when no backend frees up in time", func() {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+				Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(w.Header().Get("Retry-After")).To(Equal("1"))
+				Expect(w.Header().Get(handler.HeaderErrorSource)).To(Equal(handler.ErrorSourceLB))
+				Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonAtCapacity))
+			})
+
+			It("should forward the request once a backend frees up", func() {
+				time.AfterFunc(10*time.Millisecond, func() {
+					backends[0].DecrementConn()
+					queue.Release()
+				})
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(backends[0].ActiveConnections()).To(BeZero())
+			})
+		})
+
+		It("should not mark successful responses", func() {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			Expect(w.Header().Get(handler.HeaderErrorSource)).To(BeEmpty())
 		})
 	})
 })
@@ -160,6 +291,42 @@ var _ = Describe("Handler Retry Logic", func() {
 			})
 		})
 
+		Context("when the only first-tier backend fails", func() {
+			BeforeEach(func() {
+				mockBackend1 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&callCount1, 1)
+					if hj, ok := w.(http.Hijacker); ok {
+						conn, _, _ := hj.Hijack()
+						conn.Close()
+					}
+				}))
+				mockBackend2 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&callCount2, 1)
+					w.WriteHeader(http.StatusOK)
+				}))
+
+				backends = []*backend.Backend{
+					backend.New(mustParseURL(mockBackend2.URL), 1, backend.WithPriority(2)),
+					backend.New(mustParseURL(mockBackend1.URL), 1),
+				}
+				for _, b := range backends {
+					b.SetHealthy(true)
+				}
+
+				lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+				h = handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 2)
+			})
+
+			It("should try it first and fail over to the second tier", func() {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(atomic.LoadInt32(&callCount1)).To(Equal(int32(1)))
+				Expect(atomic.LoadInt32(&callCount2)).To(Equal(int32(1)))
+			})
+		})
+
 		Context("when request is not idempotent", func() {
 			BeforeEach(func() {
 				// Backend 1 always fails
@@ -326,6 +493,137 @@ var _ = Describe("Handler with Circuit Breaker", func() {
 				Expect(cb.State()).To(Equal(circuitbreaker.StateClosed))
 			})
 		})
+
+		Context("when every circuit is open", func() {
+			It("should tell clients when the first circuit resets", func() {
+				mockBackend1 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				mockBackend2 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				backends = []*backend.Backend{
+					backend.New(mustParseURL(mockBackend1.URL), 1),
+					backend.New(mustParseURL(mockBackend2.URL), 1),
+				}
+				for _, b := range backends {
+					b.SetHealthy(true)
+				}
+
+				registry = circuitbreaker.NewRegistry(1, 5*time.Second)
+				registry.GetBreaker(mockBackend1.URL).RecordFailure()
+				time.Sleep(10 * time.Millisecond)
+				registry.GetBreaker(mockBackend2.URL).RecordFailure()
+
+				lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+				h = handler.NewLoadBalancerHandler(log, lb, backends, nil, registry, 2)
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+				Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(w.Header().Get("Retry-After")).To(Equal("5"))
+				Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonAllCircuitsOpen))
+			})
+
+			It("should not send Retry-After while some circuit is closed", func() {
+				mockBackend1 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				mockBackend1.Close()
+				backends = []*backend.Backend{backend.New(mustParseURL(mockBackend1.URL), 1)}
+				backends[0].SetHealthy(true)
+
+				lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+				h = handler.NewLoadBalancerHandler(log, lb, backends, nil, circuitbreaker.NewRegistry(5, time.Minute), 0)
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+				Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(w.Header().Get("Retry-After")).To(BeEmpty())
+				Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonUpstreamFailed))
+			})
+		})
+
+		Context("when backends are named", func() {
+			It("should key breakers by name so an address change keeps the state", func() {
+				mockBackend1 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&callCount1, 1)
+				}))
+				mockBackend2 = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&callCount2, 1)
+				}))
+
+				cb := registry.GetBreaker("primary")
+				cb.RecordFailure()
+				cb.RecordFailure()
+
+				// The primary backend moved to a new address; its open
+				// breaker still applies.
+				backends = []*backend.Backend{
+					backend.New(mustParseURL(mockBackend1.URL), 1, backend.WithName("primary")),
+					backend.New(mustParseURL(mockBackend2.URL), 1, backend.WithName("secondary")),
+				}
+				for _, b := range backends {
+					b.SetHealthy(true)
+				}
+				lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+				h = handler.NewLoadBalancerHandler(log, lb, backends, nil, registry, 2)
+
+				for range 4 {
+					w := httptest.NewRecorder()
+					h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+					Expect(w.Code).To(Equal(http.StatusOK))
+				}
+
+				Expect(atomic.LoadInt32(&callCount1)).To(BeZero())
+				Expect(atomic.LoadInt32(&callCount2)).To(Equal(int32(4)))
+				Expect(registry.Stats()).NotTo(HaveKey(mockBackend1.URL))
+			})
+		})
+	})
+})
+
+var _ = Describe("Handler with request hash strategies", func() {
+	var (
+		h       *handler.LoadBalancerHandler
+		servers []*httptest.Server
+	)
+
+	BeforeEach(func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		servers = nil
+
+		var backends []*backend.Backend
+		for i := 0; i < 4; i++ {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			servers = append(servers, srv)
+
+			b := backend.New(mustParseURL(srv.URL), 1)
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+
+		lb := loadbalancer.NewLoadBalancer(strategy.NewQueryHashStrategy(100, "user_id", ""))
+		h = handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 0)
+	})
+
+	AfterEach(func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	})
+
+	It("should route the same query key to the same backend from different clients", func() {
+		var first string
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/orders?user_id=42", nil)
+			req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i+1)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			if first == "" {
+				first = w.Header().Get("X-Backend-Server")
+			}
+			Expect(w.Header().Get("X-Backend-Server")).To(Equal(first))
+		}
 	})
 })
 
@@ -336,3 +634,970 @@ func mustParseURL(rawURL string) *url.URL {
 	}
 	return u
 }
+
+var _ = Describe("Handler client disconnects", func() {
+	var (
+		h         *handler.LoadBalancerHandler
+		backends  []*backend.Backend
+		servers   []*httptest.Server
+		registry  *circuitbreaker.Registry
+		collector *metrics.Collector
+		calls     int32
+		cancelCtx context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		registry = circuitbreaker.NewRegistry(1, time.Minute)
+		atomic.StoreInt32(&calls, 0)
+
+		var ctx context.Context
+		ctx, cancelCtx = context.WithCancel(context.Background())
+		collector = metrics.NewCollector(10, log)
+		collector.Start(ctx)
+
+		servers = nil
+		backends = nil
+		for i := 0; i < 2; i++ {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				select {
+				case <-r.Context().Done():
+				case <-time.After(2 * time.Second):
+				}
+			}))
+			servers = append(servers, server)
+
+			b := backend.New(mustParseURL(server.URL), 1)
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h = handler.NewLoadBalancerHandler(log, lb, backends, collector, registry, 2)
+	})
+
+	AfterEach(func() {
+		cancelCtx()
+		for _, s := range servers {
+			s.Close()
+		}
+	})
+
+	It("should record a cancellation instead of a backend failure", func() {
+		reqCtx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(reqCtx)
+		w := httptest.NewRecorder()
+
+		time.AfterFunc(50*time.Millisecond, cancel)
+		h.ServeHTTP(w, req)
+
+		Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+		Expect(w.Body.String()).NotTo(ContainSubstring("Service unavailable"))
+		for _, b := range backends {
+			Expect(registry.GetBreaker(b.URL().String()).State()).To(Equal(circuitbreaker.StateClosed))
+		}
+
+		Eventually(func() int64 {
+			var canceled int64
+			for _, bm := range collector.Snapshot("round-robin").Backends {
+				canceled += bm.ClientCanceled
+			}
+			return canceled
+		}).Should(Equal(int64(1)))
+	})
+})
+
+var _ = Describe("Handler failure metrics", func() {
+	It("should count why a backend failed", func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		collector := metrics.NewCollector(10, log)
+		collector.Start(ctx)
+
+		healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		defer healthy.Close()
+		dead := httptest.NewServer(http.NotFoundHandler())
+		dead.Close()
+
+		backends := []*backend.Backend{
+			backend.New(mustParseURL(dead.URL), 1),
+			backend.New(mustParseURL(healthy.URL), 1),
+		}
+		for _, b := range backends {
+			b.SetHealthy(true)
+		}
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h := handler.NewLoadBalancerHandler(log, lb, backends, collector, circuitbreaker.NewRegistry(1, time.Minute), 2)
+
+		for range 4 {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(w.Code).To(Equal(http.StatusOK))
+		}
+
+		Eventually(func() *metrics.BackendErrors {
+			return collector.Snapshot("round-robin").Backends[dead.URL].Errors
+		}).Should(SatisfyAll(
+			HaveField("Dial", int64(1)),
+			HaveField("BreakerRejected", BeNumerically(">=", 1)),
+			HaveField("Timeout", int64(0)),
+		))
+		Expect(collector.Snapshot("round-robin").Backends[healthy.URL].Errors).To(BeNil())
+	})
+})
+
+var _ = Describe("Handler weight decay", func() {
+	It("should decay a backend's weight on failures and recover it on success", func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		var fail atomic.Bool
+		fail.Store(true)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fail.Load() {
+				panic(http.ErrAbortHandler)
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		b := backend.New(mustParseURL(server.URL), 1, backend.WithErrorDecay(0.5, time.Millisecond))
+		b.SetHealthy(true)
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h := handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0)
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(b.DecayFactor()).To(Equal(0.5))
+
+		fail.Store(false)
+		time.Sleep(2 * time.Millisecond)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(b.DecayFactor()).To(Equal(1.0))
+	})
+})
+
+var _ = Describe("Handler connection accounting", func() {
+	var (
+		log      *slog.Logger
+		healthy  *httptest.Server
+		failing  *httptest.Server
+		backends []*backend.Backend
+		registry *circuitbreaker.Registry
+	)
+
+	connections := func() []int {
+		counts := make([]int, len(backends))
+		for i, b := range backends {
+			counts[i] = b.ActiveConnections()
+		}
+		return counts
+	}
+
+	BeforeEach(func() {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+		healthy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+
+		// A listener that was closed refuses connections, so every attempt
+		// fails before reaching a backend.
+		failing = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		failing.Close()
+
+		backends = []*backend.Backend{
+			backend.New(mustParseURL(failing.URL), 1),
+			backend.New(mustParseURL(healthy.URL), 1),
+		}
+		for _, b := range backends {
+			b.SetHealthy(true)
+		}
+		registry = circuitbreaker.NewRegistry(1000, time.Minute)
+	})
+
+	AfterEach(func() {
+		healthy.Close()
+	})
+
+	It("should count an in-flight request once", func() {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}))
+		defer slow.Close()
+
+		var releaseOnce sync.Once
+		unblock := func() { releaseOnce.Do(func() { close(release) }) }
+		defer unblock()
+
+		b := backend.New(mustParseURL(slow.URL), 1)
+		b.SetHealthy(true)
+		h := handler.NewLoadBalancerHandler(log, loadbalancer.NewLoadBalancer(strategy.NewLeastConnStrategy()), []*backend.Backend{b}, nil, nil, 0)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+
+		Eventually(started).Should(BeClosed())
+		Expect(b.ActiveConnections()).To(Equal(1))
+
+		unblock()
+		Eventually(done).Should(BeClosed())
+		Expect(b.ActiveConnections()).To(BeZero())
+	})
+
+	It("should not count attempts skipped by an open breaker", func() {
+		cb := registry.GetBreaker(backends[0].Name())
+		for range 1000 {
+			cb.RecordFailure()
+		}
+
+		h := handler.NewLoadBalancerHandler(log, loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy()), backends, nil, registry, 2)
+		for range 10 {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(w.Code).To(Equal(http.StatusOK))
+		}
+
+		Expect(connections()).To(Equal([]int{0, 0}))
+	})
+
+	It("should release every reservation during a retry storm", func() {
+		h := handler.NewLoadBalancerHandler(log, loadbalancer.NewLoadBalancer(strategy.NewLeastConnStrategy()), backends, nil, registry, 2)
+
+		results := make(chan int, 200)
+		for range 200 {
+			go func() {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				results <- w.Code
+			}()
+		}
+		for range 200 {
+			Eventually(results).Should(Receive(Equal(http.StatusOK)))
+		}
+
+		Expect(connections()).To(Equal([]int{0, 0}))
+	})
+
+	It("should release reservations when no attempt succeeds", func() {
+		backends = backends[:1]
+		h := handler.NewLoadBalancerHandler(log, loadbalancer.NewLoadBalancer(strategy.NewLeastConnStrategy()), backends, nil, registry, 3)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(connections()).To(Equal([]int{0}))
+	})
+})
+
+var _ = Describe("Handler with capture", func() {
+	It("should record the backend that finally served a retried request", func() {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hj, _ := w.(http.Hijacker)
+			conn, _, _ := hj.Hijack()
+			conn.Close()
+		}))
+		defer failing.Close()
+
+		healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("served"))
+		}))
+		defer healthy.Close()
+
+		backends := []*backend.Backend{
+			backend.New(mustParseURL(failing.URL), 1, backend.WithName("failing")),
+			backend.New(mustParseURL(healthy.URL), 1, backend.WithName("healthy")),
+		}
+		for _, b := range backends {
+			b.SetHealthy(true)
+		}
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		c := capture.New(GinkgoT().TempDir(), time.Minute, log)
+		_, err := c.Start(capture.Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h := handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 1, handler.WithCapture(c))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Body.String()).To(Equal("served"))
+
+		status := c.Stop()
+		Expect(status.Records).To(Equal(1))
+
+		data, err := os.ReadFile(status.File)
+		Expect(err).NotTo(HaveOccurred())
+		var rec capture.Record
+		Expect(json.Unmarshal(data, &rec)).To(Succeed())
+		Expect(rec.Backend).To(Equal("healthy"))
+		Expect(rec.Response.Status).To(Equal(http.StatusOK))
+		Expect(rec.Response.Body).To(Equal("served"))
+	})
+})
+
+var _ = Describe("Handler overload shedding", func() {
+	It("should reject shed priorities with a 503 and serve the rest", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("served"))
+		}))
+		defer server.Close()
+
+		b := backend.New(mustParseURL(server.URL), 1)
+		b.SetHealthy(true)
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		guard := overload.NewGuard(overload.Options{
+			CPUThreshold:    0.5,
+			PriorityHeader:  "X-Priority",
+			DefaultPriority: overload.PriorityNormal,
+		}, log)
+		guard.Update(overload.Usage{CPU: 0.9})
+
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h := handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0, handler.WithOverloadGuard(guard))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Priority", "low")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(w.Header().Get(handler.HeaderErrorSource)).To(Equal(handler.ErrorSourceLB))
+		Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonOverloaded))
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("served"))
+	})
+})
+
+var _ = Describe("Handler backend pool", func() {
+	It("should route to backends added to and removed from its pool", func() {
+		first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("first"))
+		}))
+		defer first.Close()
+		second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("second"))
+		}))
+		defer second.Close()
+
+		a := backend.New(mustParseURL(first.URL), 1)
+		b := backend.New(mustParseURL(second.URL), 1)
+		a.SetHealthy(true)
+		b.SetHealthy(true)
+		pool := backend.NewPool([]*backend.Backend{a})
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h := handler.NewLoadBalancerHandler(log, lb, nil, nil, nil, 0, handler.WithBackendPool(pool))
+
+		serve := func() string {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(w.Code).To(Equal(http.StatusOK))
+			return w.Body.String()
+		}
+		Expect(serve()).To(Equal("first"))
+
+		pool.Add(b)
+		pool.Remove(a)
+		Expect(serve()).To(Equal("second"))
+		Expect(serve()).To(Equal("second"))
+	})
+})
+
+var _ = Describe("Handler routing", func() {
+	var (
+		servers []*httptest.Server
+		build   func(fallback bool) http.Handler
+	)
+
+	BeforeEach(func() {
+		servers = nil
+		serve := func(name string) *backend.Backend {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name))
+			}))
+			servers = append(servers, server)
+			b := backend.New(mustParseURL(server.URL), 1, backend.WithName(name), backend.WithLabels(map[string]string{"pool": name}))
+			b.SetHealthy(true)
+			return b
+		}
+		general, premium := serve("general"), serve("premium")
+		down := backend.New(mustParseURL("http://127.0.0.1:1"), 1, backend.WithName("down"))
+
+		build = func(fallback bool) http.Handler {
+			rt, err := routing.New([]routing.Rule{
+				{Name: "premium", Labels: map[string]string{"pool": "premium"}, Conditions: []routing.Condition{
+					{Source: routing.SourceHeader, Name: "X-Plan", Pattern: "^premium$"},
+				}},
+				{Name: "down", PathPrefix: "/down", Backends: []string{"down"}, Fallback: fallback},
+			}, 1024)
+			Expect(err).NotTo(HaveOccurred())
+
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+			return handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{general, premium, down}, nil, nil, 0, handler.WithRouting(rt))
+		}
+	})
+
+	AfterEach(func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	})
+
+	It("should balance matching requests over the backends their rule selects", func() {
+		h := build(false)
+		for range 4 {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Plan", "premium")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			Expect(w.Body.String()).To(Equal("premium"))
+		}
+
+		seen := map[string]bool{}
+		for range 4 {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			seen[w.Body.String()] = true
+		}
+		Expect(seen).To(Equal(map[string]bool{"general": true, "premium": true}))
+	})
+
+	It("should reject requests whose route has no available backend", func() {
+		w := httptest.NewRecorder()
+		build(false).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/down", nil))
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonNoHealthyBackends))
+	})
+
+	It("should fall back to every backend when the route allows it", func() {
+		w := httptest.NewRecorder()
+		build(true).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/down", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("Handler script hooks", func() {
+	var (
+		servers []*httptest.Server
+		h       http.Handler
+	)
+
+	BeforeEach(func() {
+		servers = nil
+		serve := func(name string) *backend.Backend {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name + " " + r.Header.Get("X-Tenant-Id")))
+			}))
+			servers = append(servers, server)
+			b := backend.New(mustParseURL(server.URL), 1, backend.WithName(name), backend.WithLabels(map[string]string{"group": name}))
+			b.SetHealthy(true)
+			return b
+		}
+		stable, canary := serve("stable"), serve("canary")
+
+		engine, err := script.New([]script.Hook{
+			{Name: "banned", When: `header("X-Tenant") == "evil"`, Reject: http.StatusForbidden},
+			{Name: "tenant", When: `has_header("X-Tenant")`, Headers: map[string]string{"X-Tenant-Id": `lower(header("X-Tenant"))`}},
+			{Name: "canary", When: `has_header("X-Beta")`, Group: `"canary"`},
+			{Name: "missing", When: `path == "/missing"`, Group: `"gone"`},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h = handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{stable, canary}, nil, nil, 0, handler.WithScript(engine, "group"))
+	})
+
+	AfterEach(func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	})
+
+	It("should route requests to the group a hook picks and set its headers", func() {
+		for range 4 {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Beta", "1")
+			r.Header.Set("X-Tenant", "ACME")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			Expect(w.Body.String()).To(Equal("canary acme"))
+		}
+
+		seen := map[string]bool{}
+		for range 4 {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			seen[w.Body.String()] = true
+		}
+		Expect(seen).To(Equal(map[string]bool{"stable ": true, "canary ": true}))
+	})
+
+	It("should refuse requests a hook rejects", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Tenant", "evil")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should refuse requests whose group has no backend", func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+	})
+})
+
+var _ = Describe("Handler fingerprints", func() {
+	It("should count requests per fingerprint, including those it refuses", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+		b := backend.New(mustParseURL(server.URL), 1)
+		b.SetHealthy(true)
+
+		rec := fingerprint.NewRecorder(10)
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h := handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0,
+			handler.WithFingerprints(rec, "X-JA3"),
+			handler.WithClientIPSource(handler.ClientIPSource{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}))
+
+		serve := func(peer string) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = peer
+			r.Header.Set("X-JA3", "e7d705a3286e19ea42f587b344ee6865")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		serve("10.0.0.1:1234")
+		serve("10.0.0.2:1234")
+		serve("192.0.2.1:1234")
+		b.SetHealthy(false)
+		serve("10.0.0.1:1234")
+
+		snap := rec.Snapshot()
+		Expect(snap.Fingerprints).To(HaveLen(2))
+		Expect(snap.Fingerprints[0].TLS).To(Equal("e7d705a3286e19ea42f587b344ee6865"))
+		Expect(snap.Fingerprints[0].StatusClasses).To(Equal(map[string]int64{"2xx": 2, "5xx": 1}))
+		Expect(snap.Fingerprints[1].TLS).To(BeEmpty())
+		Expect(snap.Fingerprints[1].Requests).To(Equal(int64(1)))
+	})
+})
+
+var _ = Describe("Handler request state", func() {
+	It("should share client, route, backend and attempts with wrapping middlewares", func() {
+		failing := backend.New(mustParseURL("http://127.0.0.1:1"), 1, backend.WithName("down"))
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("served"))
+		}))
+		defer server.Close()
+		serving := backend.New(mustParseURL(server.URL), 1, backend.WithName("up"))
+		failing.SetHealthy(true)
+		serving.SetHealthy(true)
+
+		endpoints, err := metrics.NewEndpoints([]string{"/users/{id}"})
+		Expect(err).NotTo(HaveOccurred())
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h := handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{failing, serving}, nil, nil, 1, handler.WithEndpointMetrics(endpoints))
+
+		var state *reqstate.State
+		outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, state = reqstate.Ensure(r)
+			h.ServeHTTP(w, r)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		outer.ServeHTTP(w, req)
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(state.ClientIP()).To(Equal("192.0.2.1"))
+		Expect(state.Route()).To(Equal("GET /users/{id}"))
+		Expect(state.Backend()).To(Equal("up"))
+		Expect(state.Attempts()).To(Equal(2))
+	})
+})
+
+var _ = Describe("Handler endpoint metrics", func() {
+	var (
+		log       *slog.Logger
+		server    *httptest.Server
+		collector *metrics.Collector
+		cancelCtx context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+
+		var ctx context.Context
+		ctx, cancelCtx = context.WithCancel(context.Background())
+		collector = metrics.NewCollector(10, log)
+		collector.Start(ctx)
+	})
+
+	AfterEach(func() {
+		cancelCtx()
+		server.Close()
+	})
+
+	newHandler := func(healthy bool) *handler.LoadBalancerHandler {
+		endpoints, err := metrics.NewEndpoints([]string{"/users/{id}"})
+		Expect(err).NotTo(HaveOccurred())
+
+		b := backend.New(mustParseURL(server.URL), 1)
+		b.SetHealthy(healthy)
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		return handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, collector, nil, 0,
+			handler.WithEndpointMetrics(endpoints))
+	}
+
+	endpoint := func(label string) func() metrics.EndpointMetrics {
+		return func() metrics.EndpointMetrics {
+			return collector.Snapshot("round-robin").Endpoints[label]
+		}
+	}
+
+	It("should label requests by method and path template", func() {
+		h := newHandler(true)
+		for _, path := range []string{"/users/1", "/users/2", "/unknown/3"} {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		Eventually(endpoint("GET /users/{id}")).Should(And(
+			HaveField("Requests", int64(2)),
+			HaveField("StatusCodes", HaveKeyWithValue(http.StatusOK, int64(2))),
+		))
+		Eventually(endpoint("GET other")).Should(HaveField("Requests", int64(1)))
+		Expect(collector.Snapshot("round-robin").Endpoints).To(HaveLen(2))
+	})
+
+	It("should count responses generated by the balancer as endpoint errors", func() {
+		w := httptest.NewRecorder()
+		newHandler(false).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/1", nil))
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+
+		Eventually(endpoint("DELETE /users/{id}")).Should(And(
+			HaveField("Requests", int64(1)),
+			HaveField("Errors", int64(1)),
+		))
+	})
+})
+
+var _ = Describe("Handler header limits", func() {
+	var (
+		server *httptest.Server
+		h      *handler.LoadBalancerHandler
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("served"))
+		}))
+
+		b := backend.New(mustParseURL(server.URL), 1)
+		b.SetHealthy(true)
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h = handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0,
+			handler.WithHeaderLimits(handler.HeaderLimits{MaxBytes: 200, MaxCount: 4, MaxLineLength: 64}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header = header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	It("should forward requests within the limits", func() {
+		w := serve(http.Header{"X-Id": {"1"}})
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("served"))
+	})
+
+	It("should reject a header line that is too long", func() {
+		w := serve(http.Header{"X-Token": {strings.Repeat("a", 64)}})
+		Expect(w.Code).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+	})
+
+	It("should reject too many header lines", func() {
+		w := serve(http.Header{"X-A": {"1", "2", "3"}, "X-B": {"4", "5"}})
+		Expect(w.Code).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+	})
+
+	It("should reject headers that are too large in total", func() {
+		header := http.Header{}
+		for _, name := range []string{"X-A", "X-B", "X-C", "X-D"} {
+			header.Set(name, strings.Repeat("a", 55))
+		}
+		w := serve(header)
+		Expect(w.Code).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+	})
+})
+
+var _ = Describe("Handler body inspection", func() {
+	var (
+		server   *httptest.Server
+		received chan string
+		h        *handler.LoadBalancerHandler
+	)
+
+	BeforeEach(func() {
+		received = make(chan string, 1)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received <- r.Header.Get("Content-Encoding") + ":" + string(body)
+		}))
+
+		b := backend.New(mustParseURL(server.URL), 1)
+		b.SetHealthy(true)
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		in := inspect.New(inspect.Options{
+			MaxBytes:        1024,
+			MaxDecodedBytes: 1024,
+			Decompress:      true,
+			Forward:         inspect.ForwardIdentity,
+			RejectOversized: true,
+		})
+		h = handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0, handler.WithBodyInspection(in))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	gzipRequest := func(body string) *http.Request {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(body))
+		zw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &buf)
+		req.Header.Set("Content-Encoding", "gzip")
+		return req
+	}
+
+	It("should forward gzip bodies in the configured form", func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, gzipRequest("payload"))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(received).To(Receive(Equal(":payload")))
+	})
+
+	It("should refuse bodies that cannot be inspected", func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, gzipRequest(strings.Repeat("a", 2048)))
+		Expect(w.Code).To(Equal(http.StatusRequestEntityTooLarge))
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("not gzip"))
+		req.Header.Set("Content-Encoding", "gzip")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+		Expect(received).NotTo(Receive())
+	})
+})
+
+var _ = Describe("Handler WAF", func() {
+	var (
+		server    *httptest.Server
+		tags      chan string
+		collector *metrics.Collector
+		cancelCtx context.CancelFunc
+		h         *handler.LoadBalancerHandler
+	)
+
+	BeforeEach(func() {
+		tags = make(chan string, 1)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tags <- r.Header.Get("X-WAF-Tags")
+		}))
+
+		b := backend.New(mustParseURL(server.URL), 1)
+		b.SetHealthy(true)
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		var ctx context.Context
+		ctx, cancelCtx = context.WithCancel(context.Background())
+		collector = metrics.NewCollector(10, log)
+		collector.Start(ctx)
+
+		engine, err := waf.New([]waf.Rule{
+			{Name: "dotfiles", Path: `^/\.`, Action: waf.ActionBlock},
+			{Name: "login", Path: `^/login$`, Action: waf.ActionRateLimit, Requests: 1, Window: time.Minute},
+			{Name: "bot", Headers: map[string]string{"User-Agent": `(?i)bot`}, Action: waf.ActionTag},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h = handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, collector, nil, 0,
+			handler.WithWAF(engine, "X-WAF-Tags"))
+	})
+
+	AfterEach(func() {
+		cancelCtx()
+		server.Close()
+	})
+
+	hits := func() map[string]int64 {
+		return collector.Snapshot("round-robin").WAFHits
+	}
+
+	It("should block matching requests and count the hit", func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.env", nil))
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		Expect(tags).NotTo(Receive())
+		Eventually(hits).Should(HaveKeyWithValue("dotfiles", int64(1)))
+	})
+
+	It("should answer 429 with Retry-After over a rate limit", func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil))
+		Expect(tags).To(Receive())
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+		Expect(w.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(w.Header().Get("Retry-After")).NotTo(BeEmpty())
+		Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonRateLimited))
+	})
+
+	It("should pass tags to the backend and replace those sent by the client", func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", "Googlebot")
+		req.Header.Set("X-WAF-Tags", "trusted")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		Expect(tags).To(Receive(Equal("bot")))
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-WAF-Tags", "trusted")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		Expect(tags).To(Receive(BeEmpty()))
+		Eventually(hits).Should(HaveKeyWithValue("bot", int64(1)))
+	})
+})
+
+var _ = Describe("Handler traffic classes", func() {
+	var (
+		server    *httptest.Server
+		classes   chan string
+		collector *metrics.Collector
+		cancelCtx context.CancelFunc
+		h         *handler.LoadBalancerHandler
+	)
+
+	BeforeEach(func() {
+		classes = make(chan string, 2)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			classes <- r.Header.Get("X-Traffic-Class")
+		}))
+
+		b := backend.New(mustParseURL(server.URL), 1)
+		b.SetHealthy(true)
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		var ctx context.Context
+		ctx, cancelCtx = context.WithCancel(context.Background())
+		collector = metrics.NewCollector(10, log)
+		collector.Start(ctx)
+
+		classifier, err := traffic.New(traffic.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		endpoints, err := metrics.NewEndpoints(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		h = handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, collector, nil, 0,
+			handler.WithEndpointMetrics(endpoints),
+			handler.WithTrafficClasses(classifier, handler.TrafficPolicy{
+				Header:              "X-Traffic-Class",
+				SkipEndpointMetrics: []traffic.Class{traffic.ClassProbe},
+			}))
+	})
+
+	AfterEach(func() {
+		cancelCtx()
+		server.Close()
+	})
+
+	It("should count requests per class and pass the class to the backend", func() {
+		probe := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		probe.Header.Set("X-Traffic-Class", "browser")
+		h.ServeHTTP(httptest.NewRecorder(), probe)
+		Expect(classes).To(Receive(Equal("probe")))
+
+		browser := httptest.NewRequest(http.MethodGet, "/", nil)
+		browser.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64)")
+		h.ServeHTTP(httptest.NewRecorder(), browser)
+		Expect(classes).To(Receive(Equal("browser")))
+
+		Eventually(func() map[string]metrics.ClassMetrics {
+			return collector.Snapshot("round-robin").Classes
+		}).Should(Equal(map[string]metrics.ClassMetrics{
+			"probe":   {Requests: 1},
+			"browser": {Requests: 1},
+		}))
+	})
+
+	It("should leave skipped classes out of endpoint metrics", func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+		Eventually(func() map[string]metrics.EndpointMetrics {
+			return collector.Snapshot("round-robin").Endpoints
+		}).Should(HaveKeyWithValue("GET other", HaveField("Requests", int64(1))))
+		Consistently(func() int64 {
+			return collector.Snapshot("round-robin").Endpoints["GET other"].Requests
+		}, "50ms").Should(Equal(int64(1)))
+	})
+})
+
+var _ = Describe("ReadyHandler", func() {
+	ready := func(code int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ReadyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w
+	}
+
+	It("should give the overloaded reason on a 503", func() {
+		w := ready(http.StatusServiceUnavailable)
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Header().Get(handler.HeaderReason)).To(Equal(handler.ReasonOverloaded))
+	})
+
+	It("should give no reason while ready", func() {
+		w := ready(http.StatusOK)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get(handler.HeaderReason)).To(BeEmpty())
+	})
+})
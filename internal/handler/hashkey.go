@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/angeloszaimis/load-balancer/internal/hashkey"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// WithHashKey replaces the client IP as the key of consistent_hash.
+// Requests without the key's cookie or header are keyed on their client IP.
+func WithHashKey(key hashkey.Key) Option {
+	return func(h *LoadBalancerHandler) {
+		h.hashKey = key
+	}
+}
+
+// selectionContext describes r to the strategy.
+func (lb *LoadBalancerHandler) selectionContext(r *http.Request, clientIP string) strategy.SelectionContext {
+	ctx := strategy.NewSelectionContext(r, clientIP)
+	ctx.HashKey = lb.hashKey.Value(r)
+	return ctx
+}
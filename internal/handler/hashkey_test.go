@@ -0,0 +1,85 @@
+package handler_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/hashkey"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Hash keys", func() {
+	Describe("WithHashKey", func() {
+		var backends []*backend.Backend
+
+		BeforeEach(func() {
+			backends = nil
+			for range 5 {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+				DeferCleanup(server.Close)
+
+				b := backend.New(mustParseURL(server.URL), 1)
+				b.SetHealthy(true)
+				backends = append(backends, b)
+			}
+		})
+
+		// served returns the backends that served a request from each of
+		// several clients, prepared by prepare.
+		served := func(key string, prepare func(r *http.Request)) map[string]bool {
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			lb := loadbalancer.NewLoadBalancer(strategy.NewConsistentHashStrategy(100))
+			var opts []handler.Option
+			if key != "" {
+				hashKey, err := hashkey.Parse(key)
+				Expect(err).NotTo(HaveOccurred())
+				opts = append(opts, handler.WithHashKey(hashKey))
+			}
+			h := handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 0, opts...)
+
+			seen := make(map[string]bool)
+			for i := range 20 {
+				req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+				req.RemoteAddr = fmt.Sprintf("198.51.100.%d:40000", i+1)
+				prepare(req)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				seen[w.Header().Get(backend.HeaderBackendServer)] = true
+			}
+			return seen
+		}
+
+		It("should spread clients by IP without a hash key", func() {
+			Expect(len(served("", func(r *http.Request) {}))).To(BeNumerically(">", 1))
+		})
+
+		It("should keep clients sharing a cookie on one backend", func() {
+			Expect(served("cookie:session", func(r *http.Request) {
+				r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+			})).To(HaveLen(1))
+		})
+
+		It("should keep clients sharing a header on one backend", func() {
+			Expect(served("header:X-Tenant-ID", func(r *http.Request) {
+				r.Header.Set("X-Tenant-ID", "acme")
+			})).To(HaveLen(1))
+		})
+
+		It("should keep requests for one path on one backend", func() {
+			Expect(served("path", func(r *http.Request) {})).To(HaveLen(1))
+		})
+
+		It("should fall back to the client IP when the request has no key", func() {
+			Expect(len(served("header:X-Tenant-ID", func(r *http.Request) {}))).To(BeNumerically(">", 1))
+		})
+	})
+})
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+// Limits a request's headers can exceed, as counted in the headers_rejected
+// metric.
+const (
+	HeaderLimitSize       = "size"
+	HeaderLimitCount      = "count"
+	HeaderLimitLineLength = "line_length"
+)
+
+// HeaderLimits bounds the request headers the proxy accepts. MaxBytes counts
+// every header line including its CRLF, MaxLineLength one "Name: value" line.
+// Zero fields are unlimited.
+type HeaderLimits struct {
+	MaxBytes      int
+	MaxCount      int
+	MaxLineLength int
+}
+
+// WithHeaderLimits refuses requests whose headers exceed limits with 431
+// Request Header Fields Too Large before they reach a backend.
+func WithHeaderLimits(limits HeaderLimits) Option {
+	return func(h *LoadBalancerHandler) {
+		h.headerLimits = limits
+	}
+}
+
+// exceeded returns the limit h exceeds, or "" when it is within all of them.
+func (l HeaderLimits) exceeded(h http.Header) string {
+	if l == (HeaderLimits{}) {
+		return ""
+	}
+
+	size, count := 0, 0
+	for name, values := range h {
+		for _, v := range values {
+			line := len(name) + len(": ") + len(v)
+			if l.MaxLineLength > 0 && line > l.MaxLineLength {
+				return HeaderLimitLineLength
+			}
+			size += line + len("\r\n")
+			count++
+		}
+	}
+
+	switch {
+	case l.MaxCount > 0 && count > l.MaxCount:
+		return HeaderLimitCount
+	case l.MaxBytes > 0 && size > l.MaxBytes:
+		return HeaderLimitSize
+	}
+	return ""
+}
+
+// rejectHeaders answers 431 and reports true when r's headers exceed a limit.
+func (lb *LoadBalancerHandler) rejectHeaders(w http.ResponseWriter, r *http.Request, clientIP string) bool {
+	limit := lb.headerLimits.exceeded(r.Header)
+	if limit == "" {
+		return false
+	}
+
+	lb.logger.Debug("Rejected oversized request headers",
+		slog.String("from", clientIP),
+		slog.String("limit", limit),
+		slog.String("path", r.URL.Path))
+	lb.emitEvent(metrics.MetricEvent{
+		Type:      metrics.EventHeadersRejected,
+		Timestamp: time.Now(),
+		Reason:    limit,
+	})
+	lb.writeError(w, http.StatusRequestHeaderFieldsTooLarge, "Request header fields too large")
+	return true
+}
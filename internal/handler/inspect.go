@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/angeloszaimis/load-balancer/internal/grpcstatus"
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+)
+
+// WithBodyInspection buffers request bodies through in before they are
+// captured or proxied, so those stages see gzip bodies decompressed. gRPC
+// calls are streamed and never buffered.
+func WithBodyInspection(in *inspect.Inspector) Option {
+	return func(h *LoadBalancerHandler) {
+		h.inspector = in
+	}
+}
+
+// inspectBody prepares r's body for inspection. It answers the client itself
+// and reports false when the body is refused or cannot be read.
+func (lb *LoadBalancerHandler) inspectBody(w http.ResponseWriter, r *http.Request, clientIP string) (*http.Request, bool) {
+	if lb.inspector == nil || grpcstatus.IsGRPC(r) {
+		return r, true
+	}
+
+	r, err := lb.inspector.Prepare(r)
+	if err == nil {
+		return r, true
+	}
+
+	lb.logger.Warn("Rejected request body",
+		slog.String("from", clientIP),
+		slog.String("path", r.URL.Path),
+		slog.String("error", err.Error()))
+
+	switch {
+	case errors.Is(err, inspect.ErrTooLarge):
+		lb.writeError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+	case errors.Is(err, inspect.ErrCorrupt):
+		lb.writeError(w, http.StatusBadRequest, "Malformed request body")
+	default:
+		lb.writeError(w, http.StatusBadRequest, "Failed to read request body")
+	}
+	return r, false
+}
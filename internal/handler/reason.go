@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HeaderReason carries a machine-readable reason on the 503 and 429
+// responses the balancer generates itself, so clients and alerting can tell
+// their causes apart. The JSON body repeats it next to the message.
+const HeaderReason = "X-LB-Reason"
+
+// Reasons sent in HeaderReason.
+const (
+	ReasonNoHealthyBackends = "no_healthy_backends"
+	ReasonAllCircuitsOpen   = "all_circuits_open"
+	ReasonBackendsDraining  = "backends_draining"
+	ReasonUpstreamFailed    = "upstream_failed"
+	ReasonAtCapacity        = "at_capacity"
+	ReasonOverloaded        = "overloaded"
+	ReasonRateLimited       = "rate_limited"
+)
+
+type rejection struct {
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+// writeRejection sends a balancer-generated response like writeError, with
+// reason in HeaderReason and a JSON body instead of plain text.
+func (lb *LoadBalancerHandler) writeRejection(w http.ResponseWriter, code int, reason, msg string) {
+	lb.recordLBError(w, code)
+	w.Header().Set(HeaderReason, reason)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(rejection{Error: msg, Reason: reason})
+}
+
+// unavailableReason tells why no backend served r: none could take traffic,
+// the healthy ones were all being drained, every one that could had its
+// circuit open, or they were all tried and failed.
+func (lb *LoadBalancerHandler) unavailableReason(r *http.Request, circuitsOpen bool) string {
+	if circuitsOpen {
+		return ReasonAllCircuitsOpen
+	}
+
+	draining := false
+	for _, b := range lb.routed(r) {
+		if b.IsAvailable() {
+			return ReasonUpstreamFailed
+		}
+		if b.IsDraining() && b.IsHealthy() {
+			draining = true
+		}
+	}
+	if draining {
+		return ReasonBackendsDraining
+	}
+	return ReasonNoHealthyBackends
+}
+
+// ReadyHandler serves readiness from ready, such as an overload guard's,
+// with ReasonOverloaded in HeaderReason on its 503s like the balancer's
+// other rejections.
+func ReadyHandler(ready http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready.ServeHTTP(overloadedWriter{w}, r)
+	})
+}
+
+type overloadedWriter struct {
+	http.ResponseWriter
+}
+
+func (w overloadedWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable {
+		w.Header().Set(HeaderReason, ReasonOverloaded)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+)
+
+// WithRouting balances each request matching one of rt's rules over the
+// backends the rule selects only. Rules on body fields need body inspection.
+func WithRouting(rt *routing.Router) Option {
+	return func(h *LoadBalancerHandler) {
+		h.router = rt
+	}
+}
+
+type routeKey struct{}
+
+// applyRouting attaches the route r matches to its context.
+func (lb *LoadBalancerHandler) applyRouting(r *http.Request, clientIP string) *http.Request {
+	if lb.router == nil {
+		return r
+	}
+	route := lb.router.Match(r)
+	if route == nil {
+		return r
+	}
+
+	lb.logger.Debug("Routing request",
+		slog.String("from", clientIP),
+		slog.String("path", r.URL.Path),
+		slog.String("route", route.Name))
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, route))
+}
+
+// routed returns the backends r may go to: those its route selects, or the
+// whole pool when it has no route or its route falls back while none of its
+// backends is available.
+func (lb *LoadBalancerHandler) routed(r *http.Request) []*backend.Backend {
+	backends := lb.pool.Backends()
+	route, _ := r.Context().Value(routeKey{}).(*routing.Route)
+	if route == nil {
+		return backends
+	}
+
+	selected := slices.DeleteFunc(slices.Clone(backends), func(b *backend.Backend) bool { return !route.Selects(b) })
+	if route.Fallback && !slices.ContainsFunc(selected, (*backend.Backend).IsAvailable) {
+		return backends
+	}
+	return selected
+}
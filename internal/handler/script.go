@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+	"github.com/angeloszaimis/load-balancer/internal/script"
+)
+
+// WithScript runs e's hooks on every proxied request after the routing
+// rules. A group a hook picks selects the backends whose groupLabel label
+// has that value, taking the place of any route the rules matched.
+func WithScript(e *script.Engine, groupLabel string) Option {
+	return func(h *LoadBalancerHandler) {
+		h.script = e
+		h.scriptGroupLabel = groupLabel
+	}
+}
+
+// applyScript runs the script hooks on r, setting their headers and routing
+// it to the group they picked. It answers the client itself and reports
+// false when a hook refuses the request.
+func (lb *LoadBalancerHandler) applyScript(w http.ResponseWriter, r *http.Request, clientIP string) (*http.Request, bool) {
+	if lb.script == nil {
+		return r, true
+	}
+
+	d := lb.script.Run(r, clientIP)
+	for _, err := range d.Errors {
+		lb.logger.Warn("Skipped failing script hook",
+			slog.String("from", clientIP),
+			slog.String("path", r.URL.Path),
+			slog.Any("error", err))
+	}
+
+	if d.Status != 0 {
+		lb.logger.Warn("Request refused by script hook",
+			slog.String("from", clientIP),
+			slog.String("hook", d.Rejected),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path))
+		lb.writeError(w, d.Status, http.StatusText(d.Status))
+		return r, false
+	}
+
+	for name, value := range d.Headers {
+		r.Header.Set(name, value)
+	}
+	if d.Group == "" {
+		return r, true
+	}
+
+	lb.logger.Debug("Routing request to script group",
+		slog.String("from", clientIP),
+		slog.String("path", r.URL.Path),
+		slog.String("hook", d.Grouped),
+		slog.String("group", d.Group))
+	route := &routing.Route{Rule: routing.Rule{
+		Name:     d.Grouped,
+		Labels:   map[string]string{lb.scriptGroupLabel: d.Group},
+		Fallback: d.Fallback,
+	}}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, route)), true
+}
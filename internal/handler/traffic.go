@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/traffic"
+)
+
+// TrafficPolicy sets how traffic classes are treated. Header, when set,
+// carries the class to the backend, replacing any value sent by the client.
+// Requests of the SkipEndpointMetrics classes are left out of per-endpoint
+// metrics, so that for example probes do not flatter latency figures.
+type TrafficPolicy struct {
+	Header              string
+	SkipEndpointMetrics []traffic.Class
+}
+
+// WithTrafficClasses classifies every proxied request with c, counts the
+// responses per class and applies policy.
+func WithTrafficClasses(c *traffic.Classifier, policy TrafficPolicy) Option {
+	return func(h *LoadBalancerHandler) {
+		h.classifier = c
+		h.trafficPolicy = policy
+	}
+}
+
+// classify returns r's traffic class, empty when classification is off.
+func (lb *LoadBalancerHandler) classify(r *http.Request) traffic.Class {
+	if lb.classifier == nil {
+		return ""
+	}
+
+	class := lb.classifier.Classify(r)
+	if lb.trafficPolicy.Header != "" {
+		r.Header.Set(lb.trafficPolicy.Header, string(class))
+	}
+	return class
+}
+
+func (lb *LoadBalancerHandler) recordsEndpoint(class traffic.Class) bool {
+	return lb.endpoints != nil && !slices.Contains(lb.trafficPolicy.SkipEndpointMetrics, class)
+}
+
+func (lb *LoadBalancerHandler) recordClass(class traffic.Class, recorder *statusRecorder) {
+	lb.emitEvent(metrics.MetricEvent{
+		Type:       metrics.EventClassCompleted,
+		Timestamp:  time.Now(),
+		StatusCode: recorder.statusCode,
+		Class:      string(class),
+	})
+}
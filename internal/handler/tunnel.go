@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/reqstate"
+)
+
+// WithTunneling accepts CONNECT requests and pipes the hijacked client
+// connection to the selected backend's host:port. Without it CONNECT is
+// answered with 405.
+func WithTunneling(dialTimeout time.Duration) Option {
+	return func(h *LoadBalancerHandler) {
+		h.tunnel = true
+		h.dialTimeout = dialTimeout
+	}
+}
+
+func (lb *LoadBalancerHandler) serveTunnel(w http.ResponseWriter, r *http.Request, clientIP string) {
+	if !lb.tunnel {
+		w.Header().Set("Allow", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, TRACE")
+		http.Error(w, "CONNECT not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		lb.writeError(w, http.StatusInternalServerError, "Tunneling not supported")
+		return
+	}
+
+	// Each open tunnel holds this goroutine and a copy goroutine, so their
+	// number is capped rather than left to grow with client connections.
+	release, ok := goroutines.Acquire("tunnel")
+	if !ok {
+		lb.logger.Warn("Tunnel limit reached, refusing CONNECT", slog.String("client", clientIP))
+		lb.writeRejection(w, http.StatusServiceUnavailable, ReasonOverloaded, "Too many open tunnels")
+		return
+	}
+	defer release()
+
+	nextServer, upstream := lb.dialTunnel(r, clientIP)
+	if upstream == nil {
+		lb.writeUnavailable(w, r)
+		return
+	}
+	defer upstream.Close()
+	// The tunnel holds the connection reserved by dialTunnel for as long as
+	// it is open.
+	defer lb.release(nextServer)
+
+	backendName := nextServer.Name()
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		lb.logger.Error("Failed to hijack client connection", slog.Any("error", err))
+		return
+	}
+	defer client.Close()
+
+	// The server's read and write timeouts would otherwise cut long-lived
+	// tunnels short.
+	client.SetDeadline(time.Time{})
+
+	lb.emitEvent(metrics.MetricEvent{
+		Type:      metrics.EventRequestReceived,
+		Timestamp: time.Now(),
+		Backend:   backendName,
+	})
+	lb.emitEvent(metrics.MetricEvent{
+		Type:      metrics.EventBackendSelected,
+		Timestamp: time.Now(),
+		Backend:   backendName,
+	})
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	// Bytes the client sent after the CONNECT head are already buffered.
+	if n := buffered.Reader.Buffered(); n > 0 {
+		pending, _ := buffered.Reader.Peek(n)
+		if _, err := upstream.Write(pending); err != nil {
+			return
+		}
+	}
+
+	lb.logger.Info("Tunnel established",
+		slog.String("client", clientIP),
+		slog.String("backend", backendName))
+
+	start := time.Now()
+	sent, received := pipe(client, upstream)
+	duration := time.Since(start)
+
+	lb.emitEvent(metrics.MetricEvent{
+		Type:       metrics.EventResponseCompleted,
+		Timestamp:  time.Now(),
+		Backend:    backendName,
+		Duration:   duration,
+		StatusCode: http.StatusOK,
+	})
+
+	lb.logger.Info("Tunnel closed",
+		slog.String("client", clientIP),
+		slog.String("backend", backendName),
+		slog.Int64("bytes_sent", sent),
+		slog.Int64("bytes_received", received),
+		slog.Duration("duration", duration))
+}
+
+// dialTunnel connects to a backend, moving on to the next one on dial
+// failure the same way proxied requests are retried. The returned backend
+// keeps the connection reserved by selectBackend.
+func (lb *LoadBalancerHandler) dialTunnel(r *http.Request, clientIP string) (*backend.Backend, net.Conn) {
+	dialer := &net.Dialer{Timeout: lb.dialTimeout}
+	triedBackends := make(map[string]bool)
+	_, state := reqstate.Ensure(r)
+
+	for attempt := 1; attempt <= lb.maxRetries+1; attempt++ {
+		nextServer, err := lb.selectBackend(r, clientIP, triedBackends, nil)
+		if err != nil {
+			lb.logger.Warn("No healthy backends available for tunnel",
+				slog.String("client", clientIP),
+				slog.Int("attempt", attempt))
+			return nil, nil
+		}
+
+		backendName := nextServer.Name()
+		triedBackends[backendName] = true
+
+		if lb.circuitRegistry != nil && !lb.circuitRegistry.GetBreaker(backendName).Allow() {
+			lb.release(nextServer)
+			continue
+		}
+
+		state.BeginAttempt(backendName)
+		conn, err := dialer.DialContext(r.Context(), "tcp", tunnelAddress(nextServer.URL()))
+		if err != nil {
+			lb.release(nextServer)
+			lb.logger.Warn("Failed to dial backend for tunnel",
+				slog.String("backend", backendName),
+				slog.String("error", err.Error()),
+				slog.Int("attempt", attempt))
+			if lb.circuitRegistry != nil {
+				lb.circuitRegistry.GetBreaker(backendName).RecordFailure()
+			}
+			continue
+		}
+
+		if lb.circuitRegistry != nil {
+			lb.circuitRegistry.GetBreaker(backendName).RecordSuccess()
+		}
+		return nextServer, nextServer.Track(conn)
+	}
+
+	return nil, nil
+}
+
+func tunnelAddress(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// pipe copies in both directions until either side closes, then closes both
+// so the other copy unblocks. It returns the bytes sent to the upstream and
+// received from it.
+func pipe(client, upstream net.Conn) (sent, received int64) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(client, upstream)
+		client.Close()
+	}()
+
+	sent, _ = io.Copy(upstream, client)
+	upstream.Close()
+	wg.Wait()
+	return sent, received
+}
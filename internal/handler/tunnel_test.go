@@ -0,0 +1,149 @@
+package handler_test
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Handler CONNECT tunneling", func() {
+	var (
+		echo     net.Listener
+		backends []*backend.Backend
+		lb       *loadbalancer.LoadBalancer
+		log      *slog.Logger
+	)
+
+	connect := func(h http.Handler) (net.Conn, *bufio.Reader, *http.Response) {
+		server := httptest.NewServer(h)
+		DeferCleanup(server.Close)
+
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { conn.Close() })
+
+		_, err = io.WriteString(conn, "CONNECT secure.example:443 HTTP/1.1\r\nHost: secure.example:443\r\n\r\n")
+		Expect(err).NotTo(HaveOccurred())
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+		Expect(err).NotTo(HaveOccurred())
+		return conn, reader, resp
+	}
+
+	BeforeEach(func() {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		var err error
+		echo, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func(echo net.Listener) {
+			for {
+				conn, err := echo.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					io.Copy(conn, conn)
+				}()
+			}
+		}(echo)
+
+		b := backend.New(mustParseURL("http://"+echo.Addr().String()), 1)
+		b.SetHealthy(true)
+		backends = []*backend.Backend{b}
+		lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+	})
+
+	AfterEach(func() {
+		echo.Close()
+	})
+
+	It("should reject CONNECT when tunneling is disabled", func() {
+		h := handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 0)
+
+		_, _, resp := connect(h)
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("should pipe bytes to the selected backend", func() {
+		h := handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 0, handler.WithTunneling(time.Second))
+
+		conn, reader, resp := connect(h)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		_, err := io.WriteString(conn, "ping\n")
+		Expect(err).NotTo(HaveOccurred())
+
+		line, err := reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("ping\n"))
+	})
+
+	It("should fail over to another backend when dialing fails", func() {
+		dead, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		deadAddr := dead.Addr().String()
+		dead.Close()
+
+		down := backend.New(mustParseURL("http://"+deadAddr), 1)
+		down.SetHealthy(true)
+		backends = append([]*backend.Backend{down}, backends...)
+
+		h := handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 1, handler.WithTunneling(time.Second))
+
+		conn, _, resp := connect(h)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(down.ActiveConnections()).To(BeZero())
+		Expect(backends[1].ActiveConnections()).To(Equal(1))
+
+		conn.Close()
+		Eventually(backends[1].ActiveConnections).Should(BeZero())
+	})
+
+	It("should return 503 when no backend can be reached", func() {
+		echo.Close()
+		h := handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 0, handler.WithTunneling(time.Second))
+
+		_, _, resp := connect(h)
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should refuse tunnels beyond the configured limit", func() {
+		tunnels := func() int { return goroutines.Default.Report().Subsystems["tunnel"].Running }
+		Eventually(tunnels).Should(BeZero())
+
+		goroutines.SetLimit("tunnel", 1)
+		DeferCleanup(goroutines.SetLimit, "tunnel", 0)
+
+		h := handler.NewLoadBalancerHandler(log, lb, backends, nil, nil, 0, handler.WithTunneling(time.Second))
+
+		first, _, resp := connect(h)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		_, _, resp = connect(h)
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(resp.Header.Get(handler.HeaderErrorSource)).To(Equal(handler.ErrorSourceLB))
+		Expect(resp.Header.Get(handler.HeaderReason)).To(Equal(handler.ReasonOverloaded))
+
+		first.Close()
+		Eventually(tunnels).Should(BeZero())
+
+		_, _, resp = connect(h)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/waf"
+)
+
+// WithWAF evaluates e before every proxied request. Tags of matching tag
+// rules are sent to the backend in tagHeader, comma separated; a value sent
+// by the client is removed.
+func WithWAF(e *waf.Engine, tagHeader string) Option {
+	return func(h *LoadBalancerHandler) {
+		h.waf = e
+		h.wafTagHeader = tagHeader
+	}
+}
+
+// applyWAF evaluates the WAF rules against r. It answers the client itself
+// and reports true when a rule refuses the request.
+func (lb *LoadBalancerHandler) applyWAF(w http.ResponseWriter, r *http.Request, clientIP string) bool {
+	if lb.waf == nil {
+		return false
+	}
+
+	if lb.wafTagHeader != "" {
+		r.Header.Del(lb.wafTagHeader)
+	}
+
+	v := lb.waf.Evaluate(r, clientIP)
+	for _, rule := range v.Hits {
+		lb.emitEvent(metrics.MetricEvent{
+			Type:      metrics.EventWAFHit,
+			Timestamp: time.Now(),
+			Rule:      rule,
+		})
+	}
+
+	if v.Status == 0 {
+		if len(v.Tags) > 0 && lb.wafTagHeader != "" {
+			r.Header.Set(lb.wafTagHeader, strings.Join(v.Tags, ","))
+		}
+		return false
+	}
+
+	lb.logger.Warn("Request refused by WAF rule",
+		slog.String("from", clientIP),
+		slog.String("rule", v.Rule),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path))
+
+	if v.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(v.RetryAfter.Seconds()))))
+	}
+	if v.Status == http.StatusTooManyRequests {
+		lb.writeRejection(w, v.Status, ReasonRateLimited, http.StatusText(v.Status))
+	} else {
+		lb.writeError(w, v.Status, http.StatusText(v.Status))
+	}
+	return true
+}
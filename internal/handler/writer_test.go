@@ -0,0 +1,150 @@
+package handler_test
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Handler response streaming", func() {
+	var (
+		upstream *httptest.Server
+		front    *httptest.Server
+	)
+
+	serveThrough := func(h http.HandlerFunc) {
+		upstream = httptest.NewServer(h)
+
+		b := backend.New(mustParseURL(upstream.URL), 1)
+		b.SetHealthy(true)
+		lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		front = httptest.NewServer(handler.NewLoadBalancerHandler(log, lb, []*backend.Backend{b}, nil, nil, 0))
+	}
+
+	rawRequest := func(request string) (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", front.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		_, err = io.WriteString(conn, request)
+		Expect(err).NotTo(HaveOccurred())
+		return conn, bufio.NewReader(conn)
+	}
+
+	AfterEach(func() {
+		front.Close()
+		upstream.Close()
+	})
+
+	It("should pass trailers through", func() {
+		serveThrough(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Trailer", "X-Checksum")
+			w.Write([]byte("abc"))
+			w.Header().Set("X-Checksum", "900150983cd24fb0")
+		})
+
+		resp, err := http.Get(front.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("abc"))
+		Expect(resp.Trailer.Get("X-Checksum")).To(Equal("900150983cd24fb0"))
+	})
+
+	It("should flush streamed chunks as they arrive", func() {
+		release := make(chan struct{})
+		serveThrough(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("first\n"))
+			w.(http.Flusher).Flush()
+			<-release
+			w.Write([]byte("second\n"))
+		})
+		defer close(release)
+
+		client := &http.Client{Timeout: 2 * time.Second}
+		resp, err := client.Get(front.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("first\n"))
+	})
+
+	It("should answer HTTP/1.0 clients without chunked encoding", func() {
+		serveThrough(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("part one, "))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("part two"))
+		})
+
+		_, reader := rawRequest("GET / HTTP/1.0\r\nHost: lb\r\n\r\n")
+		resp, err := http.ReadResponse(reader, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.TransferEncoding).To(BeEmpty())
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("part one, part two"))
+	})
+
+	It("should relay responses without Content-Length intact", func() {
+		serveThrough(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 3; i++ {
+				w.Write([]byte("0123456789"))
+				w.(http.Flusher).Flush()
+			}
+		})
+
+		resp, err := http.Get(front.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.ContentLength).To(Equal(int64(-1)))
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(body).To(HaveLen(30))
+	})
+
+	It("should let protocol upgrades hijack the client connection", func() {
+		serveThrough(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "Upgrade")
+			w.Header().Set("Upgrade", "echo")
+			w.WriteHeader(http.StatusSwitchingProtocols)
+			conn, brw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			line, _ := brw.ReadString('\n')
+			conn.Write([]byte(line))
+		})
+
+		conn, reader := rawRequest("GET / HTTP/1.1\r\nHost: lb\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		resp, err := http.ReadResponse(reader, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+
+		_, err = io.WriteString(conn, "hello\n")
+		Expect(err).NotTo(HaveOccurred())
+		line, err := reader.ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		Expect(line).To(Equal("hello\n"))
+	})
+})
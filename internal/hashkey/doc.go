@@ -0,0 +1,15 @@
+// Package hashkey parses the request keys consistent hashing places
+// requests by, and reads them off requests.
+//
+// A key is "ip", "path", "cookie:<name>" or "header:<name>", where the name
+// is an HTTP token. Configuration validation and the handler share Parse, so
+// a key that validates is the key that is used.
+//
+// Usage:
+//
+//	key, err := hashkey.Parse("header:X-Tenant-ID")
+//	if err != nil {
+//		return err
+//	}
+//	value := key.Value(r)
+package hashkey
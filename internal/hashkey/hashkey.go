@@ -0,0 +1,68 @@
+package hashkey
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Sources a Key reads the key from.
+const (
+	IP     = "ip"
+	Cookie = "cookie"
+	Header = "header"
+	Path   = "path"
+)
+
+// namePattern matches an HTTP token, which both header and cookie names are.
+var namePattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// Key selects what a request is hashed by: the client IP, the value of a
+// named cookie or header, or the URL path. The zero Key uses the client IP.
+type Key struct {
+	Source string
+	Name   string
+}
+
+// Parse parses "ip", "path", "cookie:<name>" or "header:<name>".
+func Parse(spec string) (Key, error) {
+	source, name, named := strings.Cut(spec, ":")
+	switch source {
+	case IP, Path:
+		if named {
+			return Key{}, fmt.Errorf("hash key %q takes no name", source)
+		}
+		return Key{Source: source}, nil
+	case Cookie, Header:
+		if !namePattern.MatchString(name) {
+			return Key{}, fmt.Errorf("hash key %q needs a %s name, as in %s:<name>", source, source, source)
+		}
+		return Key{Source: source, Name: name}, nil
+	default:
+		return Key{}, fmt.Errorf("unknown hash key %q", spec)
+	}
+}
+
+func (k Key) String() string {
+	if k.Name == "" {
+		return k.Source
+	}
+	return k.Source + ":" + k.Name
+}
+
+// Value returns the key of r, empty when r has none and the client IP keys
+// it instead.
+func (k Key) Value(r *http.Request) string {
+	switch k.Source {
+	case Cookie:
+		if c, err := r.Cookie(k.Name); err == nil {
+			return c.Value
+		}
+	case Header:
+		return strings.TrimSpace(r.Header.Get(k.Name))
+	case Path:
+		return r.URL.Path
+	}
+	return ""
+}
@@ -0,0 +1,13 @@
+package hashkey_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestHashkey(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Hashkey Suite")
+}
@@ -0,0 +1,58 @@
+package hashkey_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/hashkey"
+)
+
+var _ = Describe("Key", func() {
+	Describe("Parse", func() {
+		It("should parse every source", func() {
+			for spec, want := range map[string]hashkey.Key{
+				"ip":                 {Source: hashkey.IP},
+				"path":               {Source: hashkey.Path},
+				"cookie:session":     {Source: hashkey.Cookie, Name: "session"},
+				"header:X-Tenant-ID": {Source: hashkey.Header, Name: "X-Tenant-ID"},
+			} {
+				key, err := hashkey.Parse(spec)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key).To(Equal(want))
+				Expect(key.String()).To(Equal(spec))
+			}
+		})
+
+		It("should reject unknown sources and missing or invalid names", func() {
+			for _, spec := range []string{"", "query:user", "cookie", "header:", "header:X Tenant", "cookie:a=b", "path:/api", "ip:x"} {
+				_, err := hashkey.Parse(spec)
+				Expect(err).To(HaveOccurred(), spec)
+			}
+		})
+	})
+
+	Describe("Value", func() {
+		var req *http.Request
+
+		BeforeEach(func() {
+			req = httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+			req.Header.Set("X-Tenant-ID", " acme ")
+			req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		})
+
+		It("should read the key from its source", func() {
+			Expect(hashkey.Key{Source: hashkey.Header, Name: "X-Tenant-ID"}.Value(req)).To(Equal("acme"))
+			Expect(hashkey.Key{Source: hashkey.Cookie, Name: "session"}.Value(req)).To(Equal("abc"))
+			Expect(hashkey.Key{Source: hashkey.Path}.Value(req)).To(Equal("/orders/42"))
+		})
+
+		It("should be empty when the client IP keys the request", func() {
+			Expect(hashkey.Key{}.Value(req)).To(BeEmpty())
+			Expect(hashkey.Key{Source: hashkey.IP}.Value(req)).To(BeEmpty())
+			Expect(hashkey.Key{Source: hashkey.Cookie, Name: "missing"}.Value(req)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// MaxOutputBytes bounds the output kept from a command check.
+const MaxOutputBytes = 1024
+
+// Command runs a local program and treats exit status 0 as healthy. It is for
+// backends whose health only local tooling can judge, e.g. a database
+// replica's lag. The program sees the backend in LB_BACKEND_NAME,
+// LB_BACKEND_URL, LB_BACKEND_HOST and LB_BACKEND_PORT, and is killed when
+// Timeout expires.
+type Command struct {
+	Args    []string
+	Timeout time.Duration
+}
+
+func (c Command) Check(ctx context.Context, b *backend.Backend) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"LB_BACKEND_NAME="+b.Name(),
+		"LB_BACKEND_URL="+b.URL().String(),
+		"LB_BACKEND_HOST="+b.URL().Hostname(),
+		"LB_BACKEND_PORT="+port(b),
+	)
+	// Children that inherit the output pipe must not keep the check running
+	// past its timeout.
+	cmd.WaitDelay = time.Second
+
+	out := &limitedWriter{limit: MaxOutputBytes}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err := cmd.Run()
+	output := strings.TrimSpace(out.String())
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, fmt.Errorf("%s timed out after %s", c.Args[0], c.Timeout)
+	}
+	if err != nil {
+		return output, fmt.Errorf("%s: %w", c.Args[0], err)
+	}
+	b.CheckFeedback(nil)
+	return output, nil
+}
+
+func port(b *backend.Backend) string {
+	if p := b.URL().Port(); p != "" {
+		return p
+	}
+	if b.URL().Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// limitedWriter keeps the first limit bytes and discards the rest, so a noisy
+// command cannot grow memory. The buffer is not embedded so that io.Copy
+// cannot bypass Write through bytes.Buffer.ReadFrom.
+type limitedWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if room := w.limit - w.buf.Len(); room > 0 {
+		w.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+func (w *limitedWriter) String() string {
+	return w.buf.String()
+}
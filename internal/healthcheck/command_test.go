@@ -0,0 +1,80 @@
+package healthcheck_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/healthcheck"
+)
+
+var _ = Describe("Command", func() {
+	var b *backend.Backend
+
+	sh := func(script string, timeout time.Duration) healthcheck.Command {
+		return healthcheck.Command{Args: []string{"/bin/sh", "-c", script}, Timeout: timeout}
+	}
+
+	BeforeEach(func() {
+		b = backend.New(mustParseURL("http://db-replica:5432"), 1, backend.WithName("replica"))
+	})
+
+	It("should pass when the command exits 0 and keep its output", func() {
+		output, err := sh(`echo "lag 0s"`, time.Second).Check(context.Background(), b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal("lag 0s"))
+	})
+
+	It("should fail with the command's output when it exits non-zero", func() {
+		output, err := sh(`echo "lag 90s" >&2; exit 2`, time.Second).Check(context.Background(), b)
+		Expect(err).To(MatchError(ContainSubstring("exit status 2")))
+		Expect(output).To(Equal("lag 90s"))
+	})
+
+	It("should describe the backend in the environment", func() {
+		output, err := sh(`echo "$LB_BACKEND_NAME $LB_BACKEND_URL $LB_BACKEND_HOST $LB_BACKEND_PORT"`, time.Second).Check(context.Background(), b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal("replica http://db-replica:5432 db-replica 5432"))
+	})
+
+	It("should kill the command when it exceeds its timeout", func() {
+		start := time.Now()
+		_, err := sh(`sleep 10`, 100*time.Millisecond).Check(context.Background(), b)
+		Expect(err).To(MatchError(ContainSubstring("timed out")))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+
+	It("should truncate long output", func() {
+		output, err := sh(`head -c 5000 /dev/zero | tr '\0' x`, time.Second).Check(context.Background(), b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(HaveLen(healthcheck.MaxOutputBytes))
+	})
+
+	It("should fail when the command does not exist", func() {
+		_, err := healthcheck.Command{Args: []string{"/nonexistent/check"}, Timeout: time.Second}.Check(context.Background(), b)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should drive the backend's health through Run", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		marker := GinkgoT().TempDir() + "/down"
+		check := sh(`if [ -e `+marker+` ]; then echo replica behind; exit 1; fi`, time.Second)
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		go healthcheck.Run(ctx, b, check, 20*time.Millisecond, log)
+		Eventually(b.IsHealthy).Should(BeTrue())
+
+		Expect(os.WriteFile(marker, nil, 0o600)).To(Succeed())
+		Eventually(b.IsHealthy).Should(BeFalse())
+		Expect(strings.TrimSpace(b.CheckOutput())).To(Equal("replica behind"))
+	})
+})
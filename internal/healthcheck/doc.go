@@ -1,4 +1,5 @@
 // Package healthcheck implements periodic health checking for backend servers.
 // It monitors backend availability and updates their health status based on
-// HTTP health endpoint responses.
+// HTTP health endpoint responses or, for backends configured with a Command
+// check, the exit status of a local program.
 package healthcheck
@@ -2,6 +2,7 @@ package healthcheck
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -10,18 +11,63 @@ import (
 	"github.com/angeloszaimis/load-balancer/internal/backend"
 )
 
+// Checker probes a backend once. It returns nil when the backend is healthy,
+// along with any output the probe produced for operators to inspect.
+type Checker interface {
+	Check(ctx context.Context, b *backend.Backend) (output string, err error)
+}
+
+// HTTP checks that the backend's /health endpoint answers 200. With feedback
+// enabled, the answer's feedback headers are applied to the backend.
+type HTTP struct {
+	Timeout time.Duration
+}
+
+func (h HTTP) Check(ctx context.Context, b *backend.Backend) (string, error) {
+	client := &http.Client{
+		Timeout:   h.Timeout,
+		Transport: b.TracedTransport(),
+	}
+
+	healthURL := b.URL().ResolveReference(&url.URL{Path: "/health"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Host = b.Host()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", healthURL, res.Status)
+	}
+	b.CheckFeedback(res.Header)
+	return "", nil
+}
+
+// HealthCheck runs the HTTP check against backend every interval until ctx is
+// done.
 func HealthCheck(
 	ctx context.Context,
 	backend *backend.Backend,
 	interval time.Duration,
 	logger *slog.Logger,
 ) {
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
+	Run(ctx, backend, HTTP{Timeout: 5 * time.Second}, interval, logger)
+}
 
+// Run checks backend with checker immediately and then every interval until
+// ctx is done, recording the result as the backend's health. Checks run one
+// after another, and one that has not finished within interval fails. The
+// ticks a check overruns are skipped rather than run back to back, and
+// counted on the backend.
+func Run(ctx context.Context, backend *backend.Backend, checker Checker, interval time.Duration, logger *slog.Logger) {
 	// Perform initial health check immediately
-	doHealthCheck(ctx, client, backend, logger, true)
+	doHealthCheck(ctx, checker, backend, interval, logger, true)
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -34,44 +80,63 @@ func HealthCheck(
 			return
 
 		case <-ticker.C:
-			doHealthCheck(ctx, client, backend, logger, false)
+			start := time.Now()
+			doHealthCheck(ctx, checker, backend, interval, logger, false)
+			if skipped := int(time.Since(start) / interval); skipped > 0 {
+				// The ticker keeps one tick from the overrun; drop it so the
+				// next check waits a full interval.
+				select {
+				case <-ticker.C:
+				default:
+				}
+				backend.SkipChecks(skipped)
+				logger.Warn("Health check overran its interval",
+					slog.String("server", backend.URL().String()),
+					slog.Duration("took", time.Since(start)),
+					slog.Int("skipped", skipped))
+			}
 		}
 	}
 }
 
-func doHealthCheck( ctx context.Context, client *http.Client, backend *backend.Backend, logger *slog.Logger, isInitial bool ) {
-	healthURL := backend.URL().ResolveReference(&url.URL{Path: "/health"})
-
-	req, err := http.NewRequestWithContext(
-		ctx, http.MethodGet, healthURL.String(), nil)
-	if err != nil {
-		return
-	}
-
-	res, err := client.Do(req)
-	if err != nil {
-		backend.SetHealthy(false)
-		if isInitial {
-			logger.Warn("Server is down (initial check)",
-				slog.String("server", backend.URL().String()),
-				slog.Any("error", err))
-		}
+func doHealthCheck(ctx context.Context, checker Checker, backend *backend.Backend, interval time.Duration, logger *slog.Logger, isInitial bool) {
+	checkCtx, cancel := context.WithTimeout(ctx, interval)
+	output, err := checker.Check(checkCtx, backend)
+	cancel()
+	if ctx.Err() != nil {
 		return
 	}
-	defer res.Body.Close()
+	backend.SetCheckOutput(output)
 
-	healthy := res.StatusCode == http.StatusOK
+	healthy := err == nil
 	changed := backend.SetHealthy(healthy)
 
-	if changed {
-		if healthy {
-			logger.Info("Server is back up",
-				slog.String("server", backend.URL().String()))
-		} else {
-			logger.Warn("Server is down",
-				slog.String("server", backend.URL().String()))
-		}
-	} else if isInitial && healthy {
+	// A backend that recovers eases back in; one found healthy at startup
+	// takes its full share at once along with everyone else.
+	var slowStart time.Duration
+	if changed && healthy && !isInitial {
+		slowStart = backend.BeginSlowStart(time.Now())
+	}
+
+	switch {
+	case !healthy && isInitial:
+		logger.Warn("Server is down (initial check)",
+			slog.String("server", backend.URL().String()),
+			slog.Any("error", err),
+			slog.String("output", output))
+	case changed && healthy && slowStart > 0:
+		logger.Info("Server is back up, slow starting",
+			slog.String("server", backend.URL().String()),
+			slog.Duration("slow_start", slowStart))
+	case changed && healthy:
+		logger.Info("Server is back up",
+			slog.String("server", backend.URL().String()))
+	case changed:
+		logger.Warn("Server is down",
+			slog.String("server", backend.URL().String()),
+			slog.Any("error", err),
+			slog.String("output", output))
+	case isInitial:
 		logger.Info("Server is up (initial check)",
 			slog.String("server", backend.URL().String()))
 	}
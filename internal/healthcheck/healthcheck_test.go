@@ -2,11 +2,13 @@ package healthcheck_test
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -56,6 +58,51 @@ var _ = Describe("Healthcheck", func() {
 			Expect(backends[0].IsHealthy()).To(BeTrue())
 		})
 
+		It("should slow start a backend that recovers but not one up at startup", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			recovering := backend.New(mustParseURL(mockBackend1.URL), 1, backend.WithSlowStart(time.Minute))
+			checker := &flakyChecker{failures: 1}
+			go healthcheck.Run(ctx, recovering, checker, 50*time.Millisecond, log)
+
+			up := backend.New(mustParseURL(mockBackend1.URL), 1, backend.WithSlowStart(time.Minute))
+			go healthcheck.Run(ctx, up, healthcheck.HTTP{Timeout: time.Second}, 50*time.Millisecond, log)
+
+			Eventually(recovering.IsHealthy).Should(BeTrue())
+			Expect(recovering.SlowStartFactor(time.Now())).To(BeNumerically("<", 0.1))
+
+			Eventually(up.IsHealthy).Should(BeTrue())
+			Expect(up.SlowStartFactor(time.Now())).To(Equal(1.0))
+		})
+
+		It("should fail checks that overrun the interval and skip the ticks they miss", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			slow := backend.New(mustParseURL(mockBackend1.URL), 1)
+			slow.SetHealthy(true)
+			checker := &hangingChecker{}
+			go healthcheck.Run(ctx, slow, checker, 50*time.Millisecond, log)
+
+			Eventually(slow.IsHealthy).Should(BeFalse())
+			Eventually(slow.SkippedChecks).Should(BeNumerically(">", 0))
+			Expect(checker.maxRunning()).To(Equal(1))
+		})
+
+		It("should check a backend addressing a resolved IP as its hostname", func() {
+			var host string
+			named := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				host = r.Host
+			}))
+			defer named.Close()
+
+			b := backend.New(mustParseURL(named.URL), 1, backend.WithHost("api.internal:8080"))
+			_, err := healthcheck.HTTP{Timeout: time.Second}.Check(context.Background(), b)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(host).To(Equal("api.internal:8080"))
+		})
+
 		It("should stop when context is cancelled", func() {
 			ctx, cancel := context.WithCancel(context.Background())
 
@@ -70,6 +117,49 @@ var _ = Describe("Healthcheck", func() {
 	})
 })
 
+// flakyChecker fails its first failures checks and passes the rest.
+type flakyChecker struct {
+	mu       sync.Mutex
+	failures int
+}
+
+func (c *flakyChecker) Check(ctx context.Context, b *backend.Backend) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return "", errors.New("down")
+	}
+	return "", nil
+}
+
+// hangingChecker never finishes a check before its context is done.
+type hangingChecker struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (c *hangingChecker) Check(ctx context.Context, b *backend.Backend) (string, error) {
+	c.mu.Lock()
+	c.running++
+	c.max = max(c.max, c.running)
+	c.mu.Unlock()
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	c.running--
+	c.mu.Unlock()
+	return "", ctx.Err()
+}
+
+func (c *hangingChecker) maxRunning() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max
+}
+
 func mustParseURL(rawURL string) *url.URL {
 	u, err := url.Parse(rawURL)
 	if err != nil {
@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// WithListener serves on an already bound listener instead of listening on
+// the server address, e.g. a socket passed in by systemd.
+func WithListener(l net.Listener) Option {
+	return func(s *Server) {
+		s.listener = l
+	}
+}
+
+// ActivationListeners returns the sockets passed by systemd socket activation
+// (LISTEN_PID/LISTEN_FDS), or nil when the process was not socket activated.
+// The environment variables are cleared so child processes do not inherit
+// them.
+func ActivationListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation fd %d: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// MatchListener returns the listener bound to addr and removes it from
+// listeners, so two addresses sharing a port never get the same one. A
+// listener on a wildcard address matches any configured host with the same
+// port, and a configured address without host matches any listener on that
+// port.
+func MatchListener(listeners *[]net.Listener, addr string) net.Listener {
+	for i, l := range *listeners {
+		if listenerMatches(l, addr) {
+			*listeners = slices.Delete(*listeners, i, i+1)
+			return l
+		}
+	}
+	return nil
+}
+
+// listenerMatches reports whether l is bound to addr.
+func listenerMatches(l net.Listener, addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	tcp, ok := l.Addr().(*net.TCPAddr)
+	if !ok || strconv.Itoa(tcp.Port) != port {
+		return false
+	}
+	if host == "" || tcp.IP.IsUnspecified() {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.Equal(tcp.IP) {
+		return true
+	}
+	if ips, err := net.LookupIP(host); err == nil {
+		for _, ip := range ips {
+			if ip.Equal(tcp.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
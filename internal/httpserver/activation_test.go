@@ -0,0 +1,105 @@
+package httpserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/httpserver"
+)
+
+var _ = Describe("Socket activation", func() {
+	Describe("ActivationListeners", func() {
+		It("should return nothing when not socket activated", func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+
+			listeners, err := httpserver.ActivationListeners()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listeners).To(BeNil())
+		})
+
+		It("should ignore sockets meant for another process", func() {
+			GinkgoT().Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+			GinkgoT().Setenv("LISTEN_FDS", "1")
+
+			listeners, err := httpserver.ActivationListeners()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(listeners).To(BeNil())
+			Expect(os.Getenv("LISTEN_FDS")).To(Equal("1"))
+		})
+	})
+
+	Describe("MatchListener", func() {
+		var loopback, wildcard net.Listener
+
+		BeforeEach(func() {
+			var err error
+			loopback, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			wildcard, err = net.Listen("tcp", ":0")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			loopback.Close()
+			wildcard.Close()
+		})
+
+		port := func(l net.Listener) string {
+			return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+		}
+
+		It("should match by port when no host is configured", func() {
+			listeners := []net.Listener{loopback, wildcard}
+			Expect(httpserver.MatchListener(&listeners, ":"+port(wildcard))).To(Equal(wildcard))
+			Expect(httpserver.MatchListener(&listeners, ":"+port(loopback))).To(Equal(loopback))
+			Expect(listeners).To(BeEmpty())
+		})
+
+		It("should match a configured host against the bound address", func() {
+			listeners := []net.Listener{loopback}
+			Expect(httpserver.MatchListener(&listeners, "10.1.1.1:"+port(loopback))).To(BeNil())
+			Expect(httpserver.MatchListener(&listeners, "127.0.0.1:"+port(loopback))).To(Equal(loopback))
+		})
+
+		It("should hand out each listener once", func() {
+			listeners := []net.Listener{wildcard}
+			Expect(httpserver.MatchListener(&listeners, "127.0.0.1:"+port(wildcard))).To(Equal(wildcard))
+			Expect(httpserver.MatchListener(&listeners, "localhost:"+port(wildcard))).To(BeNil())
+		})
+
+		It("should return nil when no listener has the port", func() {
+			listeners := []net.Listener{loopback}
+			Expect(httpserver.MatchListener(&listeners, ":1")).To(BeNil())
+			Expect(listeners).To(HaveLen(1))
+		})
+	})
+
+	It("should serve on a provided listener", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("activated"))
+		})
+		srv, err := httpserver.New(":80", handler, httpserver.WithListener(l))
+		Expect(err).NotTo(HaveOccurred())
+		go srv.Start()
+		defer srv.Shutdown(context.Background())
+
+		client := &http.Client{Timeout: time.Second}
+		resp, err := client.Get("http://" + l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		Expect(string(body)).To(Equal("activated"))
+	})
+})
@@ -1,3 +1,4 @@
 // Package httpserver provides a wrapper around Go's HTTP server with
-// graceful shutdown support and configurable timeouts.
+// graceful shutdown support, configurable timeouts and client keep-alive
+// limits.
 package httpserver
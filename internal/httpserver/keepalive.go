@@ -0,0 +1,100 @@
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Option customises a Server at construction time.
+type Option func(*Server)
+
+// WithKeepAlives enables or disables HTTP keep-alive toward clients.
+func WithKeepAlives(enabled bool) Option {
+	return func(s *Server) {
+		s.keepAlive = enabled
+	}
+}
+
+// WithIdleTimeout sets how long an idle keep-alive connection is kept open.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.server.IdleTimeout = d
+	}
+}
+
+// WithMaxRequestsPerConn closes a client connection after it has served n
+// requests, spreading long-lived clients across instances. Zero means no
+// limit.
+func WithMaxRequestsPerConn(n int) Option {
+	return func(s *Server) {
+		s.maxRequests = int64(n)
+	}
+}
+
+// WithMaxIdlePerClient caps the number of idle keep-alive connections a
+// single client IP may hold; connections going idle beyond the cap are
+// closed. Zero means no limit.
+func WithMaxIdlePerClient(n int) Option {
+	return func(s *Server) {
+		if n <= 0 {
+			s.idle = nil
+			return
+		}
+		s.idle = &idleTracker{max: n, conns: make(map[net.Conn]string), perClient: make(map[string]int)}
+	}
+}
+
+type connRequestsKeyType struct{}
+
+var connRequestsKey = connRequestsKeyType{}
+
+func countRequests(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey, new(atomic.Int64))
+}
+
+func (s *Server) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served, ok := r.Context().Value(connRequestsKey).(*atomic.Int64); ok {
+			if served.Add(1) >= s.maxRequests {
+				w.Header().Set("Connection", "close")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type idleTracker struct {
+	mutex     sync.Mutex
+	max       int
+	conns     map[net.Conn]string
+	perClient map[string]int
+}
+
+func (t *idleTracker) track(c net.Conn, state http.ConnState) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if state == http.StateIdle {
+		client, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+		if t.perClient[client] >= t.max {
+			c.Close()
+			return
+		}
+		t.conns[c] = client
+		t.perClient[client]++
+		return
+	}
+
+	client, ok := t.conns[c]
+	if !ok {
+		return
+	}
+	delete(t.conns, c)
+	if t.perClient[client]--; t.perClient[client] <= 0 {
+		delete(t.perClient, client)
+	}
+}
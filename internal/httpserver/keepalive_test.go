@@ -0,0 +1,172 @@
+package httpserver_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/httpserver"
+)
+
+var _ = Describe("Keep-alive", func() {
+	var testServer *httpserver.Server
+
+	start := func(addr string, opts ...httpserver.Option) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+		var err error
+		testServer, err = httpserver.New(addr, handler, opts...)
+		Expect(err).NotTo(HaveOccurred())
+
+		go testServer.Start()
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	get := func(conn net.Conn, reader *bufio.Reader) *http.Response {
+		_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: lb\r\n\r\n")
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := http.ReadResponse(reader, nil)
+		Expect(err).NotTo(HaveOccurred())
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	dial := func(addr string) (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", "localhost"+addr)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+		return conn, bufio.NewReader(conn)
+	}
+
+	AfterEach(func() {
+		if testServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_ = testServer.Shutdown(ctx)
+		}
+	})
+
+	It("should close the connection after the maximum number of requests", func() {
+		start(":19990", httpserver.WithMaxRequestsPerConn(2))
+		conn, reader := dial(":19990")
+
+		Expect(get(conn, reader).Close).To(BeFalse())
+		Expect(get(conn, reader).Close).To(BeTrue())
+	})
+
+	It("should honour disabled keep-alives", func() {
+		start(":19991", httpserver.WithKeepAlives(false))
+		conn, reader := dial(":19991")
+
+		Expect(get(conn, reader).Close).To(BeTrue())
+	})
+
+	It("should send Connection: close while draining", func() {
+		start(":19992")
+		conn, reader := dial(":19992")
+
+		Expect(get(conn, reader).Close).To(BeFalse())
+		testServer.Drain()
+
+		other, otherReader := dial(":19992")
+		Expect(get(other, otherReader).Close).To(BeTrue())
+	})
+
+	It("should close connections during a rebalance window and reuse them after", func() {
+		start(":19994")
+		rebalancer := httpserver.NewRebalancer(100*time.Millisecond, 0)
+		rebalancer.Add(testServer)
+
+		conn, reader := dial(":19994")
+		Expect(get(conn, reader).Close).To(BeFalse())
+
+		Expect(rebalancer.Rebalance()).To(BeTrue())
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := reader.ReadByte()
+		Expect(err).To(MatchError(io.EOF))
+
+		during, duringReader := dial(":19994")
+		Expect(get(during, duringReader).Close).To(BeTrue())
+
+		time.Sleep(150 * time.Millisecond)
+		after, afterReader := dial(":19994")
+		Expect(get(after, afterReader).Close).To(BeFalse())
+	})
+
+	It("should batch rebalances within the interval into one window after it", func() {
+		start(":19996")
+		rebalancer := httpserver.NewRebalancer(200*time.Millisecond, 400*time.Millisecond)
+		rebalancer.Add(testServer)
+
+		Expect(rebalancer.Rebalance()).To(BeTrue())
+		time.Sleep(250 * time.Millisecond)
+		Expect(rebalancer.Rebalance()).To(BeFalse())
+		Expect(rebalancer.Rebalance()).To(BeFalse())
+
+		between, betweenReader := dial(":19996")
+		Expect(get(between, betweenReader).Close).To(BeFalse())
+
+		time.Sleep(250 * time.Millisecond)
+		batched, batchedReader := dial(":19996")
+		Expect(get(batched, batchedReader).Close).To(BeTrue())
+	})
+
+	It("should rebalance every server added to it", func() {
+		start(":19997")
+		other, err := httpserver.New(":19983", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		Expect(err).NotTo(HaveOccurred())
+		go other.Start()
+		DeferCleanup(other.Shutdown, context.Background())
+		Eventually(func() error {
+			conn, err := net.Dial("tcp", ":19983")
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		}).Should(Succeed())
+
+		rebalancer := httpserver.NewRebalancer(time.Second, 0)
+		rebalancer.Add(testServer)
+		rebalancer.Add(other)
+		rebalancer.Rebalance()
+
+		for _, addr := range []string{":19997", ":19983"} {
+			conn, reader := dial(addr)
+			Expect(get(conn, reader).Close).To(BeTrue(), addr)
+		}
+	})
+
+	It("should not reopen keep-alive after a drain", func() {
+		start(":19995")
+		testServer.Rebalance(50 * time.Millisecond)
+		testServer.Drain()
+		time.Sleep(100 * time.Millisecond)
+
+		conn, reader := dial(":19995")
+		Expect(get(conn, reader).Close).To(BeTrue())
+	})
+
+	It("should cap idle connections per client", func() {
+		start(":19993", httpserver.WithMaxIdlePerClient(1))
+		first, firstReader := dial(":19993")
+		second, secondReader := dial(":19993")
+
+		get(first, firstReader)
+		time.Sleep(50 * time.Millisecond)
+		get(second, secondReader)
+
+		second.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := secondReader.ReadByte()
+		Expect(err).To(MatchError(io.EOF))
+
+		Expect(get(first, firstReader).StatusCode).To(Equal(http.StatusOK))
+	})
+})
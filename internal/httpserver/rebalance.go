@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"sync"
+	"time"
+)
+
+// Rebalance stops reusing client connections for window: idle ones are
+// closed and every response carries "Connection: close", so clients pinned
+// to connections opened before a switch reconnect and are balanced afresh.
+// A call during the window extends it. It does nothing once the server
+// drains, or when keep-alives are disabled anyway.
+func (s *Server) Rebalance(window time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.keepAlive || s.draining || window <= 0 {
+		return
+	}
+
+	if until := time.Now().Add(window); until.After(s.rebalanceUntil) {
+		s.rebalanceUntil = until
+	}
+	s.server.SetKeepAlivesEnabled(false)
+
+	if s.rebalanceTimer != nil {
+		s.rebalanceTimer.Stop()
+	}
+	s.rebalanceTimer = time.AfterFunc(time.Until(s.rebalanceUntil), s.endRebalance)
+}
+
+func (s *Server) endRebalance() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.draining || time.Now().Before(s.rebalanceUntil) {
+		return
+	}
+	s.server.SetKeepAlivesEnabled(s.keepAlive)
+}
+
+// Rebalancer opens a Rebalance window on the servers added to it, at most
+// once per interval. A call within interval of the last window is held back
+// and opens one window once the interval has passed, so a burst of pool
+// changes costs a single window and steady discovery churn still leaves
+// keep-alive on for all but window of every interval. Servers can be added
+// after the events that trigger it are wired up.
+type Rebalancer struct {
+	window   time.Duration
+	interval time.Duration
+	mutex    sync.Mutex
+	servers  []*Server
+	last     time.Time
+	pending  *time.Timer
+}
+
+func NewRebalancer(window, interval time.Duration) *Rebalancer {
+	return &Rebalancer{window: window, interval: interval}
+}
+
+func (r *Rebalancer) Add(s *Server) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.servers = append(r.servers, s)
+}
+
+// Rebalance opens a window now, or once the interval since the last one has
+// passed. It reports whether the window opened now.
+func (r *Rebalancer) Rebalance() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.window <= 0 {
+		return false
+	}
+	if wait := time.Until(r.last.Add(r.interval)); wait > 0 {
+		if r.pending == nil {
+			r.pending = time.AfterFunc(wait, r.flush)
+		}
+		return false
+	}
+	r.open()
+	return true
+}
+
+func (r *Rebalancer) flush() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pending = nil
+	r.open()
+}
+
+func (r *Rebalancer) open() {
+	r.last = time.Now()
+	for _, s := range r.servers {
+		s.Rebalance(r.window)
+	}
+}
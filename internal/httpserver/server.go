@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-ozzo/ozzo-validation/is"
@@ -12,10 +13,21 @@ import (
 )
 
 type Server struct {
-	server *http.Server
+	server      *http.Server
+	keepAlive   bool
+	maxRequests int64
+	idle        *idleTracker
+	listener    net.Listener
+	routes      []RouteTimeout
+	tooLarge    func(remote net.Addr)
+
+	mutex          sync.Mutex
+	draining       bool
+	rebalanceUntil time.Time
+	rebalanceTimer *time.Timer
 }
 
-func New(addr string, handler http.Handler) (*Server, error) {
+func New(addr string, handler http.Handler, opts ...Option) (*Server, error) {
 	if err := validateHost(addr); err != nil {
 		return nil, err
 	}
@@ -23,18 +35,61 @@ func New(addr string, handler http.Handler) (*Server, error) {
 	srv := &Server{
 		server: &http.Server{
 			Addr:         addr,
-			Handler:      handler,
-			ReadTimeout:  15 * time.Second,
-			WriteTimeout: 15 * time.Second,
-			IdleTimeout:  60 * time.Second,
+			ReadTimeout:  DefaultReadTimeout,
+			WriteTimeout: DefaultWriteTimeout,
+			IdleTimeout:  DefaultIdleTimeout,
 		},
+		keepAlive: true,
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	srv.server.SetKeepAlivesEnabled(srv.keepAlive)
+	srv.server.Handler = handler
+	if srv.maxRequests > 0 {
+		srv.server.ConnContext = countRequests
+		srv.server.Handler = srv.limitRequests(handler)
+	}
+	if len(srv.routes) > 0 {
+		srv.server.Handler = srv.routeTimeouts(srv.server.Handler)
+	}
+	if srv.idle != nil {
+		srv.server.ConnState = srv.idle.track
 	}
 
 	return srv, nil
 }
 
+// Drain stops reusing client connections: idle ones are closed and every
+// further response carries "Connection: close", so clients reconnect (and
+// land on another instance) while in-flight requests finish normally.
+func (s *Server) Drain() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.draining = true
+	s.server.SetKeepAlivesEnabled(false)
+}
+
 func (s *Server) Start() error {
-	err := s.server.ListenAndServe()
+	listener := s.listener
+	if listener == nil && s.tooLarge != nil {
+		var err error
+		if listener, err = net.Listen("tcp", s.server.Addr); err != nil {
+			return err
+		}
+	}
+	if s.tooLarge != nil {
+		listener = tooLargeListener{Listener: listener, fn: s.tooLarge}
+	}
+
+	var err error
+	if listener != nil {
+		err = s.server.Serve(listener)
+	} else {
+		err = s.server.ListenAndServe()
+	}
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
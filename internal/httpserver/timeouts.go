@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default timeouts of a Server created without WithTimeouts or
+// WithIdleTimeout.
+const (
+	DefaultReadTimeout  = 15 * time.Second
+	DefaultWriteTimeout = 15 * time.Second
+	DefaultIdleTimeout  = 60 * time.Second
+)
+
+// WithTimeouts sets how long the server waits to read a request, including
+// its body, and to write the response. A zero duration keeps the default.
+func WithTimeouts(read, write time.Duration) Option {
+	return func(s *Server) {
+		if read > 0 {
+			s.server.ReadTimeout = read
+		}
+		if write > 0 {
+			s.server.WriteTimeout = write
+		}
+	}
+}
+
+// WithMaxHeaderBytes caps the bytes the server reads for a request line and
+// its headers; larger requests are refused with 431 before any handler runs.
+// Zero keeps net/http's default of 1 MB.
+func WithMaxHeaderBytes(n int) Option {
+	return func(s *Server) {
+		s.server.MaxHeaderBytes = n
+	}
+}
+
+// WithHeadersTooLarge calls fn for every request net/http refuses with 431
+// itself because its request line and headers exceed MaxHeaderBytes. Those
+// requests never reach the handler, so this is the only way to count them.
+// HTTP/2 requests are refused through the handler instead.
+func WithHeadersTooLarge(fn func(remote net.Addr)) Option {
+	return func(s *Server) {
+		s.tooLarge = fn
+	}
+}
+
+// tooLargeResponse is what net/http writes to a connection whose request
+// headers exceed MaxHeaderBytes, in a single write. Responses from handlers
+// always carry a Date header, so they never match it.
+const tooLargeResponse = "HTTP/1.1 431 Request Header Fields Too Large\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\nConnection: close\r\n\r\n" +
+	"431 Request Header Fields Too Large"
+
+// tooLargeListener hands out connections that report net/http's own 431
+// responses.
+type tooLargeListener struct {
+	net.Listener
+	fn func(remote net.Addr)
+}
+
+func (l tooLargeListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &tooLargeConn{Conn: c, fn: l.fn}, nil
+}
+
+type tooLargeConn struct {
+	net.Conn
+	fn func(remote net.Addr)
+}
+
+func (c *tooLargeConn) Write(p []byte) (int, error) {
+	if len(p) == len(tooLargeResponse) && string(p) == tooLargeResponse {
+		c.fn(c.RemoteAddr())
+	}
+	return c.Conn.Write(p)
+}
+
+// CloseWrite lets net/http half-close the connection after its 431, as it
+// does for the TCP connections it wraps.
+func (c *tooLargeConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// RouteTimeout replaces the server's read and write timeouts for requests
+// whose path starts with PathPrefix, e.g. to give long-poll endpoints minutes
+// on a listener that otherwise serves fast API calls. A zero duration keeps
+// the server's timeout.
+type RouteTimeout struct {
+	PathPrefix string
+	Read       time.Duration
+	Write      time.Duration
+}
+
+// WithRouteTimeouts applies per-route timeouts. The longest matching prefix
+// wins.
+func WithRouteTimeouts(routes []RouteTimeout) Option {
+	return func(s *Server) {
+		s.routes = append([]RouteTimeout(nil), routes...)
+		sort.SliceStable(s.routes, func(i, j int) bool {
+			return len(s.routes[i].PathPrefix) > len(s.routes[j].PathPrefix)
+		})
+	}
+}
+
+// routeTimeouts moves the connection deadlines of requests matching a route.
+// The server sets them before the handler runs and resets them for the next
+// request on the connection, so a route only affects its own requests.
+func (s *Server) routeTimeouts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range s.routes {
+			if !strings.HasPrefix(r.URL.Path, route.PathPrefix) {
+				continue
+			}
+			rc := http.NewResponseController(w)
+			now := time.Now()
+			if route.Read > 0 {
+				_ = rc.SetReadDeadline(now.Add(route.Read))
+			}
+			if route.Write > 0 {
+				_ = rc.SetWriteDeadline(now.Add(route.Write))
+			}
+			break
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,88 @@
+package httpserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/httpserver"
+)
+
+var _ = Describe("Timeouts", func() {
+	var testServer *httpserver.Server
+
+	AfterEach(func() {
+		if testServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_ = testServer.Shutdown(ctx)
+		}
+	})
+
+	It("should let a route outlast the listener's write timeout", func() {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+			w.Write([]byte("ok"))
+		})
+		var err error
+		testServer, err = httpserver.New(":19980", handler,
+			httpserver.WithTimeouts(time.Second, 100*time.Millisecond),
+			httpserver.WithRouteTimeouts([]httpserver.RouteTimeout{
+				{PathPrefix: "/", Write: 50 * time.Millisecond},
+				{PathPrefix: "/poll/", Write: 2 * time.Second},
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		go testServer.Start()
+		time.Sleep(100 * time.Millisecond)
+
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+		resp, err := client.Get("http://localhost:19980/poll/updates")
+		Expect(err).NotTo(HaveOccurred())
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(string(body)).To(Equal("ok"))
+
+		_, err = client.Get("http://localhost:19980/api/users")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should report the requests net/http refuses for oversized headers", func() {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusRequestHeaderFieldsTooLarge)
+		})
+		var refused atomic.Int64
+		var err error
+		testServer, err = httpserver.New(":19981", handler,
+			httpserver.WithMaxHeaderBytes(1024),
+			httpserver.WithHeadersTooLarge(func(net.Addr) { refused.Add(1) }),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		go testServer.Start()
+		time.Sleep(100 * time.Millisecond)
+
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost:19981/", nil)
+		req.Header.Set("X-Large", strings.Repeat("a", 8192))
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+		Expect(refused.Load()).To(Equal(int64(1)))
+
+		resp, err = client.Get("http://localhost:19981/")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusRequestHeaderFieldsTooLarge))
+		Expect(refused.Load()).To(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,20 @@
+// Package inspect buffers request bodies so that the stages of the handler
+// that look at them, such as request capture, see the body as the
+// application sent it. Bodies compressed with gzip can be decompressed for
+// inspection, bounded by a limit on both the received and the decompressed
+// size, and are then forwarded to the backend as received, recompressed, or
+// decompressed.
+//
+// Usage:
+//
+//	in := inspect.New(inspect.Options{
+//		MaxBytes:        1 << 20,
+//		MaxDecodedBytes: 4 << 20,
+//		Decompress:      true,
+//		Forward:         inspect.ForwardRecompress,
+//	})
+//	r, err := in.Prepare(r)
+//	if body, ok := inspect.FromRequest(r); ok {
+//		scan(body.Data)
+//	}
+package inspect
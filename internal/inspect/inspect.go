@@ -0,0 +1,180 @@
+package inspect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// How a decompressed body is sent to the backend.
+const (
+	// ForwardOriginal sends the bytes the client sent.
+	ForwardOriginal = "original"
+	// ForwardRecompress sends the inspected body compressed again, so the
+	// backend cannot decode anything the inspection did not see.
+	ForwardRecompress = "recompress"
+	// ForwardIdentity sends the inspected body uncompressed and drops
+	// Content-Encoding.
+	ForwardIdentity = "identity"
+)
+
+var (
+	// ErrTooLarge is returned for bodies over a limit when Options.RejectOversized is set.
+	ErrTooLarge = errors.New("request body exceeds the inspection limit")
+	// ErrCorrupt is returned for bodies that claim gzip but do not decode.
+	ErrCorrupt = errors.New("request body is not valid gzip")
+)
+
+// Options configures an Inspector. MaxBytes bounds the body as received and
+// MaxDecodedBytes the body after decompression; bodies over either are not
+// inspected and are passed on untouched, or refused with RejectOversized.
+type Options struct {
+	MaxBytes        int64
+	MaxDecodedBytes int64
+	Decompress      bool
+	Forward         string
+	RejectOversized bool
+}
+
+// Body is a request body made available for inspection.
+type Body struct {
+	// Data is the body after decompression.
+	Data []byte
+	// Encoding is the Content-Encoding the body arrived with, empty when
+	// it was not compressed.
+	Encoding string
+}
+
+type bodyKey struct{}
+
+type skippedKey struct{}
+
+// FromRequest returns the inspected body of r. It reports false when r has
+// no body or its body could not be inspected.
+func FromRequest(r *http.Request) (*Body, bool) {
+	body, ok := r.Context().Value(bodyKey{}).(*Body)
+	return body, ok
+}
+
+// Skipped reports whether r has a body that is passed on without being
+// inspected, because it is over a limit or in an encoding that is not
+// decompressed.
+func Skipped(r *http.Request) bool {
+	skipped, _ := r.Context().Value(skippedKey{}).(bool)
+	return skipped
+}
+
+type Inspector struct {
+	opts Options
+}
+
+func New(opts Options) *Inspector {
+	if opts.Forward == "" {
+		opts.Forward = ForwardOriginal
+	}
+	return &Inspector{opts: opts}
+}
+
+// Prepare reads r's body and returns r with the body attached for
+// FromRequest and replaced by one that sends it on to the backend. Bodies in
+// an encoding other than gzip, or in gzip without Decompress, are buffered
+// but not inspected.
+func (i *Inspector) Prepare(r *http.Request) (*http.Request, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, nil
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, i.opts.MaxBytes+1))
+	if err != nil {
+		return r, err
+	}
+	if int64(len(raw)) > i.opts.MaxBytes {
+		if i.opts.RejectOversized {
+			return r, ErrTooLarge
+		}
+		r.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(raw), r.Body), Closer: r.Body}
+		return skip(r), nil
+	}
+	r.Body.Close()
+
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch {
+	case encoding == "" || encoding == "identity":
+		setBody(r, raw)
+		return withBody(r, &Body{Data: raw}), nil
+	case encoding != "gzip" && encoding != "x-gzip", !i.opts.Decompress:
+		setBody(r, raw)
+		return skip(r), nil
+	}
+
+	data, err := decompress(raw, i.opts.MaxDecodedBytes)
+	switch {
+	case errors.Is(err, ErrTooLarge) && !i.opts.RejectOversized:
+		setBody(r, raw)
+		return skip(r), nil
+	case err != nil:
+		return r, err
+	}
+
+	switch i.opts.Forward {
+	case ForwardRecompress:
+		setBody(r, compress(data))
+	case ForwardIdentity:
+		r.Header.Del("Content-Encoding")
+		setBody(r, data)
+	default:
+		setBody(r, raw)
+	}
+	return withBody(r, &Body{Data: data, Encoding: encoding}), nil
+}
+
+func withBody(r *http.Request, body *Body) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), bodyKey{}, body))
+}
+
+func skip(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), skippedKey{}, true))
+}
+
+// setBody makes data the body sent to the backend, replayable for retries.
+func setBody(r *http.Request, data []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r.ContentLength = int64(len(data))
+}
+
+func decompress(raw []byte, limit int64) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+func compress(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
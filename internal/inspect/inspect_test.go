@@ -0,0 +1,172 @@
+package inspect_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+)
+
+var _ = Describe("Inspector", func() {
+	const payload = `{"user":"alice"}`
+
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	gzipRequest := func(body []byte) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		r.Header.Set("Content-Encoding", "gzip")
+		return r
+	}
+
+	forwarded := func(r *http.Request) []byte {
+		data, err := io.ReadAll(r.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.ContentLength).To(Equal(int64(len(data))))
+		return data
+	}
+
+	gunzip := func(data []byte) string {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		Expect(err).NotTo(HaveOccurred())
+		out, err := io.ReadAll(zr)
+		Expect(err).NotTo(HaveOccurred())
+		return string(out)
+	}
+
+	options := func(forward string) inspect.Options {
+		return inspect.Options{MaxBytes: 1024, MaxDecodedBytes: 1024, Decompress: true, Forward: forward}
+	}
+
+	It("should leave requests without a body alone", func() {
+		r, err := inspect.New(options("")).Prepare(httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := inspect.FromRequest(r)
+		Expect(ok).To(BeFalse())
+		Expect(inspect.Skipped(r)).To(BeFalse())
+	})
+
+	It("should expose uncompressed bodies and forward them unchanged", func() {
+		r, err := inspect.New(options("")).Prepare(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload)))
+		Expect(err).NotTo(HaveOccurred())
+
+		body, ok := inspect.FromRequest(r)
+		Expect(ok).To(BeTrue())
+		Expect(string(body.Data)).To(Equal(payload))
+		Expect(body.Encoding).To(BeEmpty())
+		Expect(inspect.Skipped(r)).To(BeFalse())
+		Expect(string(forwarded(r))).To(Equal(payload))
+	})
+
+	It("should decompress gzip and forward the original bytes", func() {
+		raw := gzipped(payload)
+		r, err := inspect.New(options(inspect.ForwardOriginal)).Prepare(gzipRequest(raw))
+		Expect(err).NotTo(HaveOccurred())
+
+		body, ok := inspect.FromRequest(r)
+		Expect(ok).To(BeTrue())
+		Expect(string(body.Data)).To(Equal(payload))
+		Expect(body.Encoding).To(Equal("gzip"))
+		Expect(forwarded(r)).To(Equal(raw))
+		Expect(r.Header.Get("Content-Encoding")).To(Equal("gzip"))
+	})
+
+	It("should forward exactly what was inspected when recompressing", func() {
+		// A second gzip member after the first is not seen by every decoder.
+		raw := append(gzipped(payload), gzipped("hidden")...)
+		r, err := inspect.New(options(inspect.ForwardRecompress)).Prepare(gzipRequest(raw))
+		Expect(err).NotTo(HaveOccurred())
+
+		body, _ := inspect.FromRequest(r)
+		Expect(gunzip(forwarded(r))).To(Equal(string(body.Data)))
+	})
+
+	It("should forward the decompressed body without Content-Encoding", func() {
+		r, err := inspect.New(options(inspect.ForwardIdentity)).Prepare(gzipRequest(gzipped(payload)))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(string(forwarded(r))).To(Equal(payload))
+		Expect(r.Header.Get("Content-Encoding")).To(BeEmpty())
+	})
+
+	It("should let retries send the body again", func() {
+		r, err := inspect.New(options(inspect.ForwardOriginal)).Prepare(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(payload)))
+		Expect(err).NotTo(HaveOccurred())
+		forwarded(r)
+
+		again, err := r.GetBody()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.ReadAll(again)).To(Equal([]byte(payload)))
+	})
+
+	It("should not inspect gzip bodies without decompression or other encodings", func() {
+		opts := options("")
+		opts.Decompress = false
+		r, err := inspect.New(opts).Prepare(gzipRequest(gzipped(payload)))
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := inspect.FromRequest(r)
+		Expect(ok).To(BeFalse())
+
+		br := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("compressed"))
+		br.Header.Set("Content-Encoding", "br")
+		r, err = inspect.New(options("")).Prepare(br)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok = inspect.FromRequest(r)
+		Expect(ok).To(BeFalse())
+		Expect(inspect.Skipped(r)).To(BeTrue())
+		Expect(string(forwarded(r))).To(Equal("compressed"))
+	})
+
+	It("should reject bodies that claim gzip but do not decode", func() {
+		_, err := inspect.New(options("")).Prepare(gzipRequest([]byte("not gzip")))
+		Expect(err).To(MatchError(inspect.ErrCorrupt))
+	})
+
+	Context("over the limits", func() {
+		large := strings.Repeat("a", 2048)
+
+		It("should pass bodies larger than max bytes through uninspected", func() {
+			r, err := inspect.New(options("")).Prepare(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(large)))
+			Expect(err).NotTo(HaveOccurred())
+			_, ok := inspect.FromRequest(r)
+			Expect(ok).To(BeFalse())
+			Expect(inspect.Skipped(r)).To(BeTrue())
+			Expect(io.ReadAll(r.Body)).To(Equal([]byte(large)))
+		})
+
+		It("should pass bodies that decompress past the limit through uninspected", func() {
+			raw := gzipped(large)
+			r, err := inspect.New(options(inspect.ForwardIdentity)).Prepare(gzipRequest(raw))
+			Expect(err).NotTo(HaveOccurred())
+			_, ok := inspect.FromRequest(r)
+			Expect(ok).To(BeFalse())
+			Expect(inspect.Skipped(r)).To(BeTrue())
+			Expect(forwarded(r)).To(Equal(raw))
+			Expect(r.Header.Get("Content-Encoding")).To(Equal("gzip"))
+		})
+
+		It("should refuse them when oversized bodies are rejected", func() {
+			opts := options("")
+			opts.RejectOversized = true
+			in := inspect.New(opts)
+
+			_, err := in.Prepare(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(large)))
+			Expect(err).To(MatchError(inspect.ErrTooLarge))
+
+			_, err = in.Prepare(gzipRequest(gzipped(large)))
+			Expect(err).To(MatchError(inspect.ErrTooLarge))
+		})
+	})
+})
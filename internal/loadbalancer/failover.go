@@ -0,0 +1,29 @@
+package loadbalancer
+
+import (
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/failover"
+)
+
+// WithFailover sends requests to the backends c currently serves with:
+// the local ones, or the remote fallback group while c has failed over.
+// Without it, remote backends are balanced like any other.
+func WithFailover(c *failover.Controller) Option {
+	return func(lb *LoadBalancer) {
+		lb.failover = c
+	}
+}
+
+func (lb *LoadBalancer) serving(available []*backend.Backend) []*backend.Backend {
+	if lb.failover == nil {
+		return available
+	}
+	return lb.failover.Select(available)
+}
+
+func (lb *LoadBalancer) pinnedGroup(backends []*backend.Backend) []*backend.Backend {
+	if lb.failover == nil {
+		return backends
+	}
+	return lb.failover.Serving(backends)
+}
@@ -1,46 +1,73 @@
 package loadbalancer
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/failover"
 	"github.com/angeloszaimis/load-balancer/internal/strategy"
 )
 
 type LoadBalancer struct {
-	strategy strategy.Strategy
-	mutex    sync.Mutex
+	strategy       strategy.Strategy
+	mutex          sync.Mutex
+	subsetInstance string
+	subsetSize     int
+	ranks          map[*backend.Backend]uint64
+	ranked         []*backend.Backend
+	positions      map[*backend.Backend]int
+	marks          []uint64
+	zone           string
+	failover       *failover.Controller
+	report         strategy.Reporter
+	reportedSubset int
 }
 
-func NewLoadBalancer(strategy strategy.Strategy) *LoadBalancer {
-	return &LoadBalancer{
+func NewLoadBalancer(strategy strategy.Strategy, opts ...Option) *LoadBalancer {
+	lb := &LoadBalancer{
 		strategy: strategy,
 		mutex:    sync.Mutex{},
 	}
-}
-
-func (lb *LoadBalancer) GetAndReserveServer(backends []*backend.Backend) (*backend.Backend, error) {
-	lb.mutex.Lock()
 
-	healthyBackends := lb.filterHealthyBackends(backends)
-	if len(healthyBackends) == 0 {
-		lb.mutex.Unlock()
-		return nil, fmt.Errorf("no healthy backends")
+	for _, opt := range opts {
+		opt(lb)
 	}
 
-	chosen := lb.strategy.SelectBackend(healthyBackends)
-	lb.mutex.Unlock()
+	return lb
+}
+
+// ErrInFlightLimit is returned by GetAndReserveServer when every backend it
+// could select is at its in-flight cap.
+var ErrInFlightLimit = errors.New("all backends at their in-flight limit")
 
-	if chosen == nil {
-		return nil, fmt.Errorf("strategy returned nil backend")
-	}
+// GetAndReserveServer selects a backend for ctx among the available ones and
+// reserves a connection on it. Backends at their in-flight cap are left out;
+// when the strategy picks one that reached it concurrently, it picks again
+// among the rest.
+func (lb *LoadBalancer) GetAndReserveServer(ctx strategy.SelectionContext, backends []*backend.Backend) (*backend.Backend, error) {
+	return lb.GetAndReserveServerWith(ctx, backends, (*backend.Backend).TryIncrementConn)
+}
 
-	chosen.IncrementConn()
-	return chosen, nil
+// GetAndReserveServerWith works like GetAndReserveServer but reserves the
+// connection with reserve, e.g. to hold backends to a lower limit than their
+// own. It returns ErrInFlightLimit when reserve fails on every backend.
+func (lb *LoadBalancer) GetAndReserveServerWith(ctx strategy.SelectionContext, backends []*backend.Backend, reserve func(*backend.Backend) bool) (*backend.Backend, error) {
+	return lb.GetAndReservePinnedServerWith(ctx, backends, nil, reserve)
 }
 
-func (lb *LoadBalancer) GetAndReserveServerWithKey(backends []*backend.Backend, key string) (*backend.Backend, error) {
+// GetAndReservePinnedServerWith works like GetAndReserveServerWith but takes
+// pinned, as returned by PinnedServer for the same ctx, when it is among the
+// backends the strategy would select from, instead of selecting again. A
+// strategy combining others pins clients with a different one, so its
+// selection is always made.
+func (lb *LoadBalancer) GetAndReservePinnedServerWith(ctx strategy.SelectionContext, backends []*backend.Backend, pinned *backend.Backend, reserve func(*backend.Backend) bool) (*backend.Backend, error) {
+	if _, ok := lb.strategy.(strategy.Affinity); ok {
+		pinned = nil
+	}
+
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
@@ -48,31 +75,77 @@ func (lb *LoadBalancer) GetAndReserveServerWithKey(backends []*backend.Backend,
 	if len(healthyBackends) == 0 {
 		return nil, fmt.Errorf("no healthy backends")
 	}
+	if lb.report != nil && lb.subsetSize > 0 && len(healthyBackends) != lb.reportedSubset {
+		lb.reportedSubset = len(healthyBackends)
+		lb.report(strategy.Decision{Kind: strategy.DecisionSubset, Value: float64(len(healthyBackends))})
+	}
+
+	candidates := belowInFlightLimit(healthyBackends)
+	for len(candidates) > 0 {
+		shiftedCtx, among := lb.shifted(ctx, candidates)
+		chosen := pinned
+		if pinned == nil || !slices.Contains(among, pinned) {
+			chosen = lb.strategy.SelectBackend(shiftedCtx, among)
+		}
+		if chosen == nil {
+			return nil, fmt.Errorf("strategy returned nil backend")
+		}
+		if reserve(chosen) {
+			return chosen, nil
+		}
+		candidates = slices.DeleteFunc(candidates, func(b *backend.Backend) bool { return b == chosen })
+	}
+
+	return nil, ErrInFlightLimit
+}
+
+// belowInFlightLimit returns a copy of backends without those at their
+// in-flight cap.
+func belowInFlightLimit(backends []*backend.Backend) []*backend.Backend {
+	below := make([]*backend.Backend, 0, len(backends))
+	for _, b := range backends {
+		if !b.AtInFlightLimit() {
+			below = append(below, b)
+		}
+	}
+	return below
+}
 
-	// Set the key if strategy supports it
-	if ks, ok := lb.strategy.(interface{ SetKey(string) }); ok {
-		ks.SetKey(key)
+// PinnedServer returns the backend a hashing strategy maps ctx to among
+// backends of the serving failover group and local zone and within this
+// instance's subset, whatever their health, without reserving it. Comparing
+// it with the backend actually selected tells whether a client was failed
+// over.
+func (lb *LoadBalancer) PinnedServer(ctx strategy.SelectionContext, backends []*backend.Backend) *backend.Backend {
+	if _, ok := lb.strategy.(strategy.Keyer); !ok || len(backends) == 0 {
+		return nil
 	}
 
-	chosen := lb.strategy.SelectBackend(healthyBackends)
-	if chosen == nil {
-		return nil, fmt.Errorf("strategy returned nil backend")
+	pinning := lb.strategy
+	if a, ok := pinning.(strategy.Affinity); ok {
+		pinning = a.AffinityStrategy()
 	}
 
-	chosen.IncrementConn()
-	return chosen, nil
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	return pinning.SelectBackend(ctx, lb.subset(lb.local(lb.pinnedGroup(backends))))
 }
 
+// filterHealthyBackends returns the available backends of the serving
+// failover group and preferred priority tier, narrowed to the local zone and
+// to this instance's subset.
+// Callers must hold the mutex.
 func (lb *LoadBalancer) filterHealthyBackends(backends []*backend.Backend) []*backend.Backend {
 	healthy := make([]*backend.Backend, 0, len(backends))
 
 	for _, b := range backends {
-		if b.IsHealthy() {
+		if b.IsAvailable() {
 			healthy = append(healthy, b)
 		}
 	}
 
-	return healthy
+	return lb.subset(lb.local(PreferredTier(lb.serving(healthy))))
 }
 
 func (lb *LoadBalancer) LoadBalancerStrategy() strategy.Strategy {
@@ -1,12 +1,17 @@
 package loadbalancer_test
 
 import (
+	"fmt"
+	"io"
+	"log/slog"
 	"net/url"
+	"slices"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/failover"
 	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
 	"github.com/angeloszaimis/load-balancer/internal/strategy"
 )
@@ -43,13 +48,13 @@ var _ = Describe("LoadBalancer", func() {
 			})
 
 			It("should return a backend", func() {
-				server, err := lb.GetAndReserveServer(backends)
+				server, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(server).NotTo(BeNil())
 			})
 
 			It("should increment connection count", func() {
-				server, err := lb.GetAndReserveServer(backends)
+				server, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(server.ActiveConnections()).To(Equal(1))
 			})
@@ -63,14 +68,14 @@ var _ = Describe("LoadBalancer", func() {
 			})
 
 			It("should return an error", func() {
-				server, err := lb.GetAndReserveServer(backends)
+				server, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
 				Expect(err).To(HaveOccurred())
 				Expect(server).To(BeNil())
 			})
 		})
 	})
 
-	Describe("GetAndReserveServerWithKey", func() {
+	Describe("GetAndReserveServer with a hashing strategy", func() {
 		BeforeEach(func() {
 			for _, b := range backends {
 				b.SetHealthy(true)
@@ -84,16 +89,419 @@ var _ = Describe("LoadBalancer", func() {
 			})
 
 			It("should select backend based on key", func() {
-				server1, err := lb.GetAndReserveServerWithKey(backends, "192.168.1.1")
+				server1, err := lb.GetAndReserveServer(strategy.SelectionContext{ClientIP: "192.168.1.1"}, backends)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(server1).NotTo(BeNil())
 
-				server2, err := lb.GetAndReserveServerWithKey(backends, "192.168.1.1")
+				server2, err := lb.GetAndReserveServer(strategy.SelectionContext{ClientIP: "192.168.1.1"}, backends)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(server2).To(Equal(server1))
 			})
 		})
 	})
+
+	Describe("priority tiers", func() {
+		var primary, secondary []*backend.Backend
+
+		BeforeEach(func() {
+			primary = []*backend.Backend{
+				backend.New(mustParseURL("http://localhost:8081"), 1, backend.WithMaxConnections(1)),
+				backend.New(mustParseURL("http://localhost:8082"), 1, backend.WithMaxConnections(1)),
+			}
+			secondary = []*backend.Backend{
+				backend.New(mustParseURL("http://localhost:9081"), 1, backend.WithPriority(2), backend.WithMaxConnections(1)),
+			}
+			backends = append(append([]*backend.Backend{}, secondary...), primary...)
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+		})
+
+		It("should only use the second tier while the first is unavailable", func() {
+			for i := 0; i < 4; i++ {
+				Expect(loadbalancer.PreferredTier(backends)).To(ConsistOf(primary[0], primary[1]))
+			}
+
+			primary[0].SetHealthy(false)
+			chosen, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chosen).To(Equal(primary[1]))
+			chosen.DecrementConn()
+
+			primary[1].SetDraining(true)
+			chosen, err = lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chosen).To(Equal(secondary[0]))
+		})
+
+		It("should spill over to the second tier while the first is at capacity", func() {
+			primary[0].IncrementConn()
+			Expect(loadbalancer.PreferredTier(backends)).To(Equal([]*backend.Backend{primary[1]}))
+
+			primary[1].IncrementConn()
+			Expect(loadbalancer.PreferredTier(backends)).To(Equal(secondary))
+
+			secondary[0].IncrementConn()
+			Expect(loadbalancer.PreferredTier(backends)).To(ConsistOf(primary[0], primary[1]))
+		})
+
+		It("should take the top tier whatever its state", func() {
+			primary[0].SetHealthy(false)
+			Expect(loadbalancer.TopTier(backends)).To(ConsistOf(primary[0], primary[1]))
+		})
+	})
+
+	Describe("in-flight limits", func() {
+		BeforeEach(func() {
+			lb = loadbalancer.NewLoadBalancer(strategy.NewLeastConnStrategy())
+			backends = []*backend.Backend{
+				backend.New(mustParseURL("http://localhost:8081"), 1, backend.WithMaxInFlight(1)),
+				backend.New(mustParseURL("http://localhost:8082"), 1, backend.WithMaxInFlight(2)),
+			}
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+		})
+
+		It("should skip backends at their limit and fail once all are", func() {
+			reserved := map[*backend.Backend]int{}
+			for i := 0; i < 3; i++ {
+				chosen, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+				Expect(err).NotTo(HaveOccurred())
+				reserved[chosen]++
+			}
+			Expect(reserved).To(Equal(map[*backend.Backend]int{backends[0]: 1, backends[1]: 2}))
+
+			_, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+			Expect(err).To(MatchError(loadbalancer.ErrInFlightLimit))
+
+			backends[0].DecrementConn()
+			chosen, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chosen).To(Equal(backends[0]))
+		})
+	})
+
+	Describe("subsetting", func() {
+		var pool []*backend.Backend
+
+		BeforeEach(func() {
+			pool = nil
+			for i := range 20 {
+				b := backend.New(mustParseURL("http://localhost:8081"), 1, backend.WithName(fmt.Sprintf("backend-%d", i)))
+				b.SetHealthy(true)
+				pool = append(pool, b)
+			}
+		})
+
+		selected := func(lb *loadbalancer.LoadBalancer) map[*backend.Backend]bool {
+			seen := make(map[*backend.Backend]bool)
+			for range 100 {
+				b, err := lb.GetAndReserveServer(strategy.SelectionContext{}, pool)
+				Expect(err).NotTo(HaveOccurred())
+				b.DecrementConn()
+				seen[b] = true
+			}
+			return seen
+		}
+
+		It("should balance over the same subset of the given size", func() {
+			first := selected(loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithSubset("lb-1", 5)))
+			Expect(first).To(HaveLen(5))
+
+			again := selected(loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithSubset("lb-1", 5)))
+			Expect(again).To(Equal(first))
+		})
+
+		It("should spread instances over the whole pool", func() {
+			load := make(map[*backend.Backend]int)
+			for i := range 100 {
+				lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithSubset(fmt.Sprintf("lb-%d", i), 5))
+				for b := range selected(lb) {
+					load[b]++
+				}
+			}
+
+			Expect(load).To(HaveLen(len(pool)))
+			for _, instances := range load {
+				Expect(instances).To(BeNumerically("~", 25, 15))
+			}
+		})
+
+		It("should replace an unavailable member with the next ranked backend", func() {
+			lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithSubset("lb-1", 5))
+			before := selected(lb)
+
+			var dropped *backend.Backend
+			for b := range before {
+				dropped = b
+				break
+			}
+			dropped.SetHealthy(false)
+
+			after := selected(lb)
+			Expect(after).To(HaveLen(5))
+			Expect(after).NotTo(HaveKey(dropped))
+
+			shared := 0
+			for b := range after {
+				if before[b] {
+					shared++
+				}
+			}
+			Expect(shared).To(Equal(4))
+		})
+
+		It("should rank backends joining or leaving the pool like a fresh instance", func() {
+			lb := loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithSubset("lb-1", 5))
+			all := pool
+			pool = all[:10]
+			selected(lb)
+			pool = all
+
+			Expect(selected(lb)).To(Equal(selected(loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithSubset("lb-1", 5)))))
+
+			var gone *backend.Backend
+			for b := range selected(lb) {
+				gone = b
+				break
+			}
+			lb.Forget(gone)
+			pool = slices.DeleteFunc(slices.Clone(all), func(b *backend.Backend) bool { return b == gone })
+
+			Expect(selected(lb)).To(Equal(selected(loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithSubset("lb-1", 5)))))
+		})
+
+		It("should report the subset size when it changes and the strategy's decisions", func() {
+			var decisions []strategy.Decision
+			lb := loadbalancer.NewLoadBalancer(strategy.NewConsistentHashStrategy(10),
+				loadbalancer.WithSubset("lb-1", 5),
+				loadbalancer.WithReporter(func(d strategy.Decision) { decisions = append(decisions, d) }))
+
+			for range 3 {
+				_, err := lb.GetAndReserveServer(strategy.SelectionContext{ClientIP: "10.0.0.1"}, pool)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			lb.LoadBalancerStrategy().(strategy.Rebuilder).Rebuild(pool[:3])
+			_, err := lb.GetAndReserveServer(strategy.SelectionContext{ClientIP: "10.0.0.1"}, pool[:3])
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(decisions).To(Equal([]strategy.Decision{
+				{Kind: strategy.DecisionSubset, Value: 5},
+				{Kind: strategy.DecisionRingRebuild, Value: 3},
+				{Kind: strategy.DecisionSubset, Value: 3},
+			}))
+		})
+	})
+
+	Describe("zones", func() {
+		var local, remote []*backend.Backend
+
+		BeforeEach(func() {
+			lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithLocalZone("eu-west-1a"))
+			local = []*backend.Backend{
+				backend.New(mustParseURL("http://localhost:8081"), 1, backend.WithZone("eu-west-1a"), backend.WithMaxConnections(1)),
+				backend.New(mustParseURL("http://localhost:8082"), 1, backend.WithZone("eu-west-1a"), backend.WithMaxConnections(1)),
+			}
+			remote = []*backend.Backend{
+				backend.New(mustParseURL("http://localhost:9081"), 1, backend.WithZone("eu-west-1b")),
+			}
+			backends = append(append([]*backend.Backend{}, remote...), local...)
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+		})
+
+		selected := func() *backend.Backend {
+			b, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+			Expect(err).NotTo(HaveOccurred())
+			b.DecrementConn()
+			return b
+		}
+
+		It("should only use local backends while one is available", func() {
+			for range 4 {
+				Expect(selected()).To(BeElementOf(local[0], local[1]))
+			}
+
+			local[0].SetHealthy(false)
+			Expect(selected()).To(Equal(local[1]))
+
+			local[1].SetHealthy(false)
+			Expect(selected()).To(Equal(remote[0]))
+		})
+
+		It("should spill cross-zone while the local backends are at capacity", func() {
+			local[0].IncrementConn()
+			local[1].IncrementConn()
+			Expect(selected()).To(Equal(remote[0]))
+		})
+
+		It("should prefer the top priority tier over the local zone", func() {
+			fallback := backend.New(mustParseURL("http://localhost:8083"), 1, backend.WithZone("eu-west-1a"), backend.WithPriority(2))
+			fallback.SetHealthy(true)
+			local[0].SetHealthy(false)
+			local[1].SetHealthy(false)
+			backends = append(backends, fallback)
+
+			Expect(selected()).To(Equal(remote[0]))
+		})
+
+		It("should treat all zones alike without a local zone", func() {
+			lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy())
+			seen := make(map[*backend.Backend]bool)
+			for range 6 {
+				seen[selected()] = true
+			}
+			Expect(seen).To(HaveLen(3))
+		})
+	})
+
+	Describe("failover", func() {
+		It("should only send requests to the group the controller serves", func() {
+			remote := backend.New(mustParseURL("https://lb.eu-central.example.com"), 1, backend.WithRemote())
+			backends = append(backends, remote)
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+			controller := failover.NewController(backend.NewPool(backends), failover.Options{MinHealthy: 1, FailAfter: 1, RecoverAfter: 1}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			lb = loadbalancer.NewLoadBalancer(strategy.NewRoundRobinStrategy(), loadbalancer.WithFailover(controller))
+
+			for range 6 {
+				b, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+				Expect(err).NotTo(HaveOccurred())
+				b.DecrementConn()
+				Expect(b).NotTo(Equal(remote))
+			}
+
+			backends[0].SetHealthy(false)
+			controller.Evaluate()
+			for range 3 {
+				b, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+				Expect(err).NotTo(HaveOccurred())
+				b.DecrementConn()
+				Expect(b).To(Equal(remote))
+			}
+		})
+	})
+
+	Describe("traffic shifts", func() {
+		BeforeEach(func() {
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+		})
+
+		selections := func(n int) map[*backend.Backend]int {
+			picked := make(map[*backend.Backend]int)
+			for range n {
+				b, err := lb.GetAndReserveServer(strategy.SelectionContext{}, backends)
+				Expect(err).NotTo(HaveOccurred())
+				b.DecrementConn()
+				picked[b]++
+			}
+			return picked
+		}
+
+		It("should apply shift factors to strategies that ignore them", func() {
+			lb = loadbalancer.NewLoadBalancer(strategy.NewLeastConnStrategy())
+			backends[0].SetShiftFactor(0)
+			backends[1].SetShiftFactor(0.25)
+
+			picked := selections(2000)
+			Expect(picked).NotTo(HaveKey(backends[0]))
+			Expect(picked[backends[1]]).To(BeNumerically("~", 400, 100))
+			Expect(picked[backends[2]]).To(BeNumerically("~", 1600, 100))
+		})
+
+		It("should ignore a shift that left no candidate any share", func() {
+			for _, strat := range []strategy.Strategy{
+				strategy.NewRoundRobinStrategy(),
+				strategy.NewWeightedRoundRobinStrategy(),
+				strategy.NewWeightedRandomStrategy(),
+				strategy.NewWeightedAliasStrategy(),
+			} {
+				lb = loadbalancer.NewLoadBalancer(strat)
+				for _, b := range backends {
+					b.SetShiftFactor(0)
+				}
+
+				Expect(selections(30)).To(HaveLen(3))
+			}
+		})
+	})
+
+	Describe("PinnedServer", func() {
+		It("should return the keyed backend whatever its health, without reserving it", func() {
+			lb = loadbalancer.NewLoadBalancer(strategy.NewConsistentHashStrategy(100))
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+			reserved, err := lb.GetAndReserveServer(strategy.SelectionContext{ClientIP: "192.168.1.1"}, backends)
+			Expect(err).NotTo(HaveOccurred())
+
+			reserved.SetHealthy(false)
+			Expect(lb.PinnedServer(strategy.SelectionContext{ClientIP: "192.168.1.1"}, backends)).To(Equal(reserved))
+			Expect(reserved.ActiveConnections()).To(Equal(1))
+		})
+
+		It("should return the hashing strategy's pick for a chain that fell back", func() {
+			hash := strategy.NewConsistentHashStrategy(100)
+			lb = loadbalancer.NewLoadBalancer(strategy.NewChain(strategy.MaxLoad(1), hash, strategy.NewLeastConnStrategy()))
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+			ctx := strategy.SelectionContext{ClientIP: "192.168.1.1"}
+			pinned := hash.SelectBackend(ctx, backends)
+			pinned.IncrementConn()
+
+			served, err := lb.GetAndReserveServer(ctx, backends)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(served).NotTo(Equal(pinned))
+			Expect(lb.PinnedServer(ctx, backends)).To(Equal(pinned))
+		})
+
+		It("should return nil for strategies without keys", func() {
+			Expect(lb.PinnedServer(strategy.SelectionContext{ClientIP: "192.168.1.1"}, backends)).To(BeNil())
+		})
+	})
+
+	Describe("GetAndReservePinnedServerWith", func() {
+		BeforeEach(func() {
+			for _, b := range backends {
+				b.SetHealthy(true)
+			}
+		})
+
+		It("should take the pinned backend without selecting again", func() {
+			for range 3 {
+				chosen, err := lb.GetAndReservePinnedServerWith(strategy.SelectionContext{}, backends, backends[2], (*backend.Backend).TryIncrementConn)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(chosen).To(Equal(backends[2]))
+			}
+			Expect(backends[2].ActiveConnections()).To(Equal(3))
+		})
+
+		It("should select among the others once the pinned backend is unavailable", func() {
+			backends[2].SetHealthy(false)
+
+			chosen, err := lb.GetAndReservePinnedServerWith(strategy.SelectionContext{}, backends, backends[2], (*backend.Backend).TryIncrementConn)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chosen).NotTo(Equal(backends[2]))
+		})
+
+		It("should select again for a strategy pinning with another one", func() {
+			hash := strategy.NewConsistentHashStrategy(100)
+			lb = loadbalancer.NewLoadBalancer(strategy.NewChain(strategy.MaxLoad(1), hash, strategy.NewLeastConnStrategy()))
+			ctx := strategy.SelectionContext{ClientIP: "192.168.1.1"}
+			pinned := lb.PinnedServer(ctx, backends)
+			pinned.IncrementConn()
+
+			chosen, err := lb.GetAndReservePinnedServerWith(ctx, backends, pinned, (*backend.Backend).TryIncrementConn)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chosen).NotTo(Equal(pinned))
+		})
+	})
 })
 
 func mustParseURL(rawURL string) *url.URL {
@@ -0,0 +1,38 @@
+package loadbalancer
+
+import "github.com/angeloszaimis/load-balancer/internal/backend"
+
+// PreferredTier narrows available backends to the lowest priority tier that
+// still has a backend below capacity, leaving out the backends at capacity.
+// When every backend is at capacity the lowest tier is returned whole, so
+// requests keep going to the preferred backends rather than fail.
+func PreferredTier(available []*backend.Backend) []*backend.Backend {
+	if tier := lowestTier(available, true); len(tier) > 0 {
+		return tier
+	}
+	return TopTier(available)
+}
+
+// TopTier returns the backends of the lowest priority tier, whatever their
+// health or load.
+func TopTier(backends []*backend.Backend) []*backend.Backend {
+	return lowestTier(backends, false)
+}
+
+func lowestTier(backends []*backend.Backend, belowCapacity bool) []*backend.Backend {
+	var tier []*backend.Backend
+	lowest := 0
+	for _, b := range backends {
+		if belowCapacity && b.AtCapacity() {
+			continue
+		}
+		switch p := b.Priority(); {
+		case lowest == 0 || p < lowest:
+			lowest = p
+			tier = append(tier[:0], b)
+		case p == lowest:
+			tier = append(tier, b)
+		}
+	}
+	return tier
+}
@@ -0,0 +1,15 @@
+package loadbalancer
+
+import "github.com/angeloszaimis/load-balancer/internal/strategy"
+
+// WithReporter reports the decisions of the strategy, if it reports any, and
+// the size of the subset selections are made within, whenever it changes, to
+// r.
+func WithReporter(r strategy.Reporter) Option {
+	return func(lb *LoadBalancer) {
+		lb.report = r
+		if rs, ok := lb.strategy.(strategy.Reporting); ok {
+			rs.SetReporter(r)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package loadbalancer
+
+import (
+	"math/rand/v2"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// shifted applies a traffic shift to a selection among candidates. When the
+// shift left none of them any share, the selection ignores it, so requests
+// still reach the group traffic is leaving while the other has no backend
+// available. A strategy that does not scale weights by shift factors itself
+// selects among one group of candidates sharing a factor, drawn with a
+// probability proportional to the sum of its factors, which gives every
+// group the share a weighted strategy would with equal weights.
+func (lb *LoadBalancer) shifted(ctx strategy.SelectionContext, candidates []*backend.Backend) (strategy.SelectionContext, []*backend.Backend) {
+	factors := make([]float64, len(candidates))
+	total, shifting := 0.0, false
+	for i, b := range candidates {
+		factors[i] = b.ShiftFactor()
+		total += factors[i]
+		shifting = shifting || factors[i] < 1
+	}
+	if !shifting {
+		return ctx, candidates
+	}
+	if total <= 0 {
+		ctx.Unshifted = true
+		return ctx, candidates
+	}
+	if s, ok := lb.strategy.(strategy.Shifter); ok && s.HonoursShift() {
+		return ctx, candidates
+	}
+
+	var factor float64
+	pick := rand.Float64() * total
+	for _, f := range factors {
+		if f <= 0 {
+			continue
+		}
+		factor = f
+		if pick < f {
+			break
+		}
+		pick -= f
+	}
+
+	group := make([]*backend.Backend, 0, len(candidates))
+	for i, b := range candidates {
+		if factors[i] == factor {
+			group = append(group, b)
+		}
+	}
+	return ctx, group
+}
@@ -0,0 +1,131 @@
+package loadbalancer
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"slices"
+	"sort"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// Option customises a LoadBalancer at construction time.
+type Option func(*LoadBalancer)
+
+// WithSubset limits the balancer to size of the backends it is offered, so a
+// fleet of instances in front of a large pool does not open connections from
+// every instance to every backend. Each backend is ranked by a hash of
+// instance and its name (rendezvous hashing) and the size best ranked
+// available ones are used: instances with different names spread over
+// different subsets, the same instance always picks the same one, and a
+// backend leaving or joining the pool only changes the subsets it is part of.
+// A size of zero, or one not below the number of backends, uses them all.
+func WithSubset(instance string, size int) Option {
+	return func(lb *LoadBalancer) {
+		lb.subsetInstance = instance
+		lb.subsetSize = size
+		lb.ranks = make(map[*backend.Backend]uint64)
+		lb.positions = make(map[*backend.Backend]int)
+	}
+}
+
+// subset returns the subsetSize best ranked of backends. Every backend seen
+// is kept in rank order, which is only sorted again when a backend not seen
+// before is offered or one is forgotten, so a selection only marks its
+// backends' positions and takes the first subsetSize marked. Callers must
+// hold the mutex.
+func (lb *LoadBalancer) subset(backends []*backend.Backend) []*backend.Backend {
+	if lb.subsetSize <= 0 || len(backends) <= lb.subsetSize {
+		return backends
+	}
+
+	for _, b := range backends {
+		if _, ok := lb.positions[b]; !ok {
+			lb.rerank(backends)
+			break
+		}
+	}
+
+	clear(lb.marks)
+	for _, b := range backends {
+		p := lb.positions[b]
+		lb.marks[p/64] |= 1 << (p % 64)
+	}
+
+	subset := make([]*backend.Backend, 0, lb.subsetSize)
+	for i, word := range lb.marks {
+		for ; word != 0; word &= word - 1 {
+			subset = append(subset, lb.ranked[i*64+bits.TrailingZeros64(word)])
+			if len(subset) == lb.subsetSize {
+				return subset
+			}
+		}
+	}
+	return subset
+}
+
+// rerank adds the backends not ranked yet to the rank order. Callers must
+// hold the mutex.
+func (lb *LoadBalancer) rerank(backends []*backend.Backend) {
+	for _, b := range backends {
+		if _, ok := lb.positions[b]; !ok {
+			lb.positions[b] = -1
+			lb.ranked = append(lb.ranked, b)
+		}
+	}
+	lb.sortRanked()
+}
+
+// sortRanked sorts the rank order and records every backend's position in
+// it. Callers must hold the mutex.
+func (lb *LoadBalancer) sortRanked() {
+	sort.Slice(lb.ranked, func(i, j int) bool {
+		return lb.rank(lb.ranked[i]) > lb.rank(lb.ranked[j])
+	})
+	for i, b := range lb.ranked {
+		lb.positions[b] = i
+	}
+	lb.marks = make([]uint64, (len(lb.ranked)+63)/64)
+}
+
+// Forget drops what the balancer and its strategy keep about b, for backends
+// that left the pool.
+func (lb *LoadBalancer) Forget(b *backend.Backend) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	delete(lb.ranks, b)
+	if _, ok := lb.positions[b]; ok {
+		delete(lb.positions, b)
+		lb.ranked = slices.DeleteFunc(lb.ranked, func(r *backend.Backend) bool { return r == b })
+		lb.sortRanked()
+	}
+	if f, ok := lb.strategy.(strategy.Forgetter); ok {
+		f.Forget(b)
+	}
+}
+
+func (lb *LoadBalancer) rank(b *backend.Backend) uint64 {
+	if r, ok := lb.ranks[b]; ok {
+		return r
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(lb.subsetInstance))
+	h.Write([]byte{0})
+	h.Write([]byte(b.Name()))
+	r := mix(h.Sum64())
+	lb.ranks[b] = r
+	return r
+}
+
+// mix finalises an FNV hash (the splitmix64 finaliser), whose low-entropy
+// high bits would otherwise make ranks of similar names correlate.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
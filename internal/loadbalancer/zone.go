@@ -0,0 +1,33 @@
+package loadbalancer
+
+import "github.com/angeloszaimis/load-balancer/internal/backend"
+
+// WithLocalZone makes the balancer prefer backends whose zone is zone. Other
+// zones only receive traffic while no backend of the local zone is available
+// and below capacity in the preferred priority tier, which keeps requests
+// off cross-zone links, with their latency and transfer cost, unless the
+// local zone cannot take them. An empty zone treats all backends alike.
+func WithLocalZone(zone string) Option {
+	return func(lb *LoadBalancer) {
+		lb.zone = zone
+	}
+}
+
+// local narrows backends to those of the local zone, or returns them all
+// when none is local.
+func (lb *LoadBalancer) local(backends []*backend.Backend) []*backend.Backend {
+	if lb.zone == "" {
+		return backends
+	}
+
+	var local []*backend.Backend
+	for _, b := range backends {
+		if b.Zone() == lb.zone {
+			local = append(local, b)
+		}
+	}
+	if len(local) == 0 {
+		return backends
+	}
+	return local
+}
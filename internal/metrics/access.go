@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// AccessPolicy restricts who may read metrics. A zero policy allows everyone.
+type AccessPolicy struct {
+	// BearerToken, when set, must be presented as "Authorization: Bearer <token>".
+	BearerToken string
+	// AllowedNetworks, when non-empty, lists the client networks allowed to
+	// connect. The peer address of the connection is used, never forwarding
+	// headers, since those are trivially spoofed.
+	AllowedNetworks []netip.Prefix
+}
+
+func (p AccessPolicy) enabled() bool {
+	return p.BearerToken != "" || len(p.AllowedNetworks) > 0
+}
+
+// Protect wraps next so it is only served to callers satisfying the policy.
+func Protect(next http.Handler, policy AccessPolicy) http.Handler {
+	if !policy.enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(policy.AllowedNetworks) > 0 && !policy.allowsPeer(r.RemoteAddr) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if policy.BearerToken != "" && !policy.validToken(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p AccessPolicy) allowsPeer(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range p.AllowedNetworks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p AccessPolicy) validToken(header string) bool {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return false
+	}
+	token := strings.TrimSpace(header[len(prefix):])
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.BearerToken)) == 1
+}
@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+var _ = Describe("Protect", func() {
+	var next http.Handler
+
+	serve := func(h http.Handler, remoteAddr, auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	BeforeEach(func() {
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	It("should leave the handler open with an empty policy", func() {
+		h := metrics.Protect(next, metrics.AccessPolicy{})
+		Expect(serve(h, "203.0.113.1:1234", "")).To(Equal(http.StatusOK))
+	})
+
+	Context("with a bearer token", func() {
+		var h http.Handler
+
+		BeforeEach(func() {
+			h = metrics.Protect(next, metrics.AccessPolicy{BearerToken: "scrape"})
+		})
+
+		It("should require the token", func() {
+			Expect(serve(h, "10.0.0.1:1234", "")).To(Equal(http.StatusUnauthorized))
+			Expect(serve(h, "10.0.0.1:1234", "Bearer wrong")).To(Equal(http.StatusUnauthorized))
+			Expect(serve(h, "10.0.0.1:1234", "Bearer scrape")).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("with an allow-list", func() {
+		var h http.Handler
+
+		BeforeEach(func() {
+			h = metrics.Protect(next, metrics.AccessPolicy{AllowedNetworks: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("2001:db8::/32"),
+			}})
+		})
+
+		It("should allow peers inside the networks", func() {
+			Expect(serve(h, "10.1.2.3:1234", "")).To(Equal(http.StatusOK))
+			Expect(serve(h, "[2001:db8::5]:1234", "")).To(Equal(http.StatusOK))
+			Expect(serve(h, "[::ffff:10.1.2.3]:1234", "")).To(Equal(http.StatusOK))
+		})
+
+		It("should reject peers outside the networks", func() {
+			Expect(serve(h, "192.168.1.1:1234", "")).To(Equal(http.StatusForbidden))
+		})
+
+		It("should ignore forwarding headers", func() {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = "192.168.1.1:1234"
+			req.Header.Set("X-Forwarded-For", "10.0.0.1")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	It("should require both checks when both are configured", func() {
+		h := metrics.Protect(next, metrics.AccessPolicy{
+			BearerToken:     "scrape",
+			AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		})
+		Expect(serve(h, "10.0.0.1:1234", "")).To(Equal(http.StatusUnauthorized))
+		Expect(serve(h, "192.168.0.1:1234", "Bearer scrape")).To(Equal(http.StatusForbidden))
+		Expect(serve(h, "10.0.0.1:1234", "Bearer scrape")).To(Equal(http.StatusOK))
+	})
+})
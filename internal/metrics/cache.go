@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CachedHandler serves the snapshot like Handler but renders it at most once
+// per ttl. Requests within ttl of a render get the same body, and concurrent
+// requests wait for a single render, so heavy polling cannot keep the
+// balancer busy sorting latency samples. A ttl of zero renders every time.
+func (c *Collector) CachedHandler(strategy string, ttl time.Duration) http.HandlerFunc {
+	if ttl <= 0 {
+		return c.Handler(strategy)
+	}
+
+	cache := &snapshotCache{ttl: ttl}
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := cache.get(func() ([]byte, error) {
+			return json.Marshal(c.Snapshot(strategy))
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+type snapshotCache struct {
+	ttl        time.Duration
+	mutex      sync.Mutex
+	body       []byte
+	renderedAt time.Time
+}
+
+func (s *snapshotCache) get(render func() ([]byte, error)) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.body != nil && time.Since(s.renderedAt) < s.ttl {
+		return s.body, nil
+	}
+
+	body, err := render()
+	if err != nil {
+		return nil, err
+	}
+	s.body = append(body, '\n')
+	s.renderedAt = time.Now()
+	return s.body, nil
+}
@@ -3,7 +3,10 @@ package metrics
 import (
 	"context"
 	"log/slog"
+	"sync/atomic"
 	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
 )
 
 type EventType string
@@ -13,6 +16,18 @@ const (
     EventBackendSelected   EventType = "backend_selected"
     EventResponseCompleted EventType = "response_completed"
     EventHealthChanged     EventType = "health_changed"
+    EventClientCanceled    EventType = "client_canceled"
+    EventLBError           EventType = "lb_error"
+    EventEndpointCompleted EventType = "endpoint_completed"
+    EventClientIPRejected  EventType = "client_ip_rejected"
+    EventCertificateChecked EventType = "certificate_checked"
+    EventAffinityFailover  EventType = "affinity_failover"
+    EventHeadersRejected   EventType = "headers_rejected"
+    EventWAFHit            EventType = "waf_hit"
+    EventClassCompleted    EventType = "class_completed"
+    EventStrategyDecision  EventType = "strategy_decision"
+    EventQueued            EventType = "queued"
+    EventBackendFailure    EventType = "backend_failure"
 )
 
 type MetricEvent struct {
@@ -22,12 +37,38 @@ type MetricEvent struct {
 	Duration time.Duration
 	StatusCode int
 	Healthy bool
+	// State is the backend state of an EventHealthChanged, empty when only
+	// Healthy is known.
+	State string
+	// GRPCStatus is the grpc-status of a completed gRPC call, nil otherwise.
+	GRPCStatus *int
+	// Endpoint is the endpoint label of an EventEndpointCompleted.
+	Endpoint string
+	// Reason is why the client IP header of an EventClientIPRejected was
+	// not believed, or which limit the headers of an EventHeadersRejected
+	// exceeded, the kind of an EventStrategyDecision, the outcome of an
+	// EventQueued, or why the attempt of an EventBackendFailure failed.
+	Reason string
+	// Value is the value reported with an EventStrategyDecision.
+	Value float64
+	// Rule is the WAF rule that acted on the request of an EventWAFHit.
+	Rule string
+	// Class is the traffic class of an EventClassCompleted.
+	Class string
+	// Expiry is when the TLS certificate of an EventCertificateChecked
+	// expires, and Expiring whether that is within the warning period.
+	Expiry time.Time
+	Expiring bool
 }
 
 type Collector struct {
 	eventCh 	  chan MetricEvent
 	metrics 	  *Metrics
 	logger 		  *slog.Logger
+	dropped       atomic.Int64
+	recent        *eventRing
+	queueDepth    atomic.Pointer[func() int]
+	skipped       atomic.Pointer[func() map[string]uint64]
 }
 
 func NewCollector(bufferSize int, logger *slog.Logger) *Collector {
@@ -42,8 +83,27 @@ func (c *Collector) EventChannel() chan<- MetricEvent {
 	return c.eventCh
 }
 
+// Emit sends event to the collector without blocking. When the buffer is
+// full the event is dropped and counted.
+func (c *Collector) Emit(event MetricEvent) bool {
+	select {
+	case c.eventCh <- event:
+		return true
+	default:
+		c.dropped.Add(1)
+		return false
+	}
+}
+
+// Counters returns the running totals without building a full snapshot.
+func (c *Collector) Counters() Counters {
+	counters := c.metrics.Counters()
+	counters.DroppedEvents = c.dropped.Load()
+	return counters
+}
+
 func (c *Collector) Start(ctx context.Context) {
-	go c.run(ctx)
+	goroutines.Go("metrics", func() { c.run(ctx) })
 }
 
 func (c *Collector) run(ctx context.Context) {
@@ -63,6 +123,10 @@ func (c *Collector) run(ctx context.Context) {
 }
 
 func (c *Collector) processEvent(event MetricEvent) {
+    if c.recent != nil {
+        c.recent.add(event)
+    }
+
     switch event.Type {
     case EventRequestReceived:
         c.metrics.IncrementRequests(event.Backend)
@@ -72,9 +136,51 @@ func (c *Collector) processEvent(event MetricEvent) {
         
     case EventResponseCompleted:
         c.metrics.RecordResponse(event.Backend, event.Duration, event.StatusCode)
+        if event.GRPCStatus != nil {
+            c.metrics.RecordGRPCStatus(event.Backend, *event.GRPCStatus)
+        }
         
     case EventHealthChanged:
         c.metrics.UpdateHealthStatus(event.Backend, event.Healthy)
+        if event.State != "" {
+            c.metrics.UpdateState(event.Backend, event.State)
+        }
+
+    case EventClientCanceled:
+        c.metrics.RecordClientCanceled(event.Backend)
+
+    case EventLBError:
+        c.metrics.RecordLBError(event.StatusCode)
+
+    case EventEndpointCompleted:
+        c.metrics.RecordEndpoint(event.Endpoint, event.Duration, event.StatusCode)
+
+    case EventClientIPRejected:
+        c.metrics.RecordClientIPRejected(event.Reason)
+
+    case EventCertificateChecked:
+        c.metrics.UpdateCertificate(event.Backend, event.Expiry, event.Expiring)
+
+    case EventAffinityFailover:
+        c.metrics.RecordAffinityFailover(event.Backend)
+
+    case EventHeadersRejected:
+        c.metrics.RecordHeadersRejected(event.Reason)
+
+    case EventWAFHit:
+        c.metrics.RecordWAFHit(event.Rule)
+
+    case EventClassCompleted:
+        c.metrics.RecordClass(event.Class, event.StatusCode)
+
+    case EventStrategyDecision:
+        c.metrics.RecordDecision(event.Reason, event.Value)
+
+    case EventQueued:
+        c.metrics.RecordQueue(event.Reason, event.Duration)
+
+    case EventBackendFailure:
+        c.metrics.RecordBackendFailure(event.Backend, event.Reason)
     }
 }
 
@@ -89,5 +195,34 @@ func (c *Collector) drain() {
 	}
 }
 func (c *Collector) Snapshot(algorithm string) Snapshot {
-return c.metrics.Snapshot(algorithm)
+	snap := c.metrics.Snapshot(algorithm)
+	if depth := c.queueDepth.Load(); depth != nil {
+		if snap.Queue == nil {
+			snap.Queue = &QueueMetrics{Outcomes: map[string]int64{}}
+		}
+		snap.Queue.Depth = int64((*depth)())
+	}
+	if skipped := c.skipped.Load(); skipped != nil {
+		for name, n := range (*skipped)() {
+			if m, ok := snap.Backends[name]; ok {
+				m.SkippedChecks = n
+				snap.Backends[name] = m
+			}
+		}
+	}
+	return snap
+}
+
+// ReportQueueDepth makes snapshots read the admission queue depth from
+// depth when they are taken, rather than counting it from events, which
+// are dropped when the buffer is full.
+func (c *Collector) ReportQueueDepth(depth func() int) {
+	c.queueDepth.Store(&depth)
+}
+
+// ReportSkippedChecks makes snapshots read the health checks skipped per
+// backend name from skipped when they are taken. The backends count them
+// since startup, so the totals survive dropped events.
+func (c *Collector) ReportSkippedChecks(skipped func() map[string]uint64) {
+	c.skipped.Store(&skipped)
 }
@@ -2,7 +2,10 @@ package metrics_test
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"time"
 
@@ -40,6 +43,38 @@ var _ = Describe("Collector", func() {
 		})
 	})
 
+	Describe("ReportQueueDepth", func() {
+		It("should read the queue depth when the snapshot is taken", func() {
+			depth := 3
+			collector.ReportQueueDepth(func() int { return depth })
+			Expect(collector.Snapshot("round-robin").Queue.Depth).To(Equal(int64(3)))
+
+			depth = 0
+			Expect(collector.Snapshot("round-robin").Queue.Depth).To(BeZero())
+		})
+	})
+
+	Describe("ReportSkippedChecks", func() {
+		It("should read the skipped checks of known backends when the snapshot is taken", func() {
+			collector.Start(ctx)
+			collector.EventChannel() <- metrics.MetricEvent{
+				Type:    metrics.EventHealthChanged,
+				Backend: "http://localhost:8081",
+				Healthy: true,
+			}
+			Eventually(func() map[string]metrics.BackendMetrics {
+				return collector.Snapshot("round-robin").Backends
+			}).Should(HaveKey("http://localhost:8081"))
+
+			collector.ReportSkippedChecks(func() map[string]uint64 {
+				return map[string]uint64{"http://localhost:8081": 4, "http://gone:8081": 1}
+			})
+			snap := collector.Snapshot("round-robin")
+			Expect(snap.Backends["http://localhost:8081"].SkippedChecks).To(Equal(uint64(4)))
+			Expect(snap.Backends).NotTo(HaveKey("http://gone:8081"))
+		})
+	})
+
 	Describe("EventChannel", func() {
 		It("should return a write-only channel", func() {
 			ch := collector.EventChannel()
@@ -108,6 +143,7 @@ var _ = Describe("Collector", func() {
 				Timestamp: time.Now(),
 				Backend:   "http://localhost:8081",
 				Healthy:   true,
+				State:     "draining",
 			}
 
 			collector.EventChannel() <- event
@@ -115,6 +151,7 @@ var _ = Describe("Collector", func() {
 
 			snap := collector.Snapshot("round-robin")
 			Expect(snap.Backends["http://localhost:8081"].Healthy).To(BeTrue())
+			Expect(snap.Backends["http://localhost:8081"].State).To(Equal("draining"))
 		})
 
 		It("should process multiple events in sequence", func() {
@@ -174,6 +211,32 @@ var _ = Describe("Collector", func() {
 		})
 	})
 
+	Describe("RecentEvents", func() {
+		It("should keep nothing unless asked to", func() {
+			collector.Start(ctx)
+			collector.Emit(metrics.MetricEvent{Type: metrics.EventRequestReceived, Backend: "a"})
+
+			Eventually(func() int64 { return collector.Counters().Requests }).Should(Equal(int64(1)))
+			Expect(collector.RecentEvents()).To(BeNil())
+		})
+
+		It("should keep the latest events, oldest first", func() {
+			collector.KeepRecent(3)
+			collector.Start(ctx)
+			for _, name := range []string{"a", "b", "c", "d", "e"} {
+				collector.Emit(metrics.MetricEvent{Type: metrics.EventRequestReceived, Backend: name})
+			}
+
+			Eventually(func() []string {
+				var backends []string
+				for _, e := range collector.RecentEvents() {
+					backends = append(backends, e.Backend)
+				}
+				return backends
+			}).Should(Equal([]string{"c", "d", "e"}))
+		})
+	})
+
 	Describe("Handler", func() {
 		It("should return a valid http.HandlerFunc", func() {
 			handler := collector.Handler("round-robin")
@@ -181,6 +244,52 @@ var _ = Describe("Collector", func() {
 		})
 	})
 
+	Describe("CachedHandler", func() {
+		scrape := func(h http.HandlerFunc) metrics.Snapshot {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var snap metrics.Snapshot
+			Expect(json.Unmarshal(w.Body.Bytes(), &snap)).To(Succeed())
+			return snap
+		}
+
+		record := func() {
+			collector.EventChannel() <- metrics.MetricEvent{
+				Type:      metrics.EventRequestReceived,
+				Timestamp: time.Now(),
+				Backend:   "http://localhost:8081",
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		It("should serve the cached snapshot until the ttl has passed", func() {
+			collector.Start(ctx)
+			handler := collector.CachedHandler("round-robin", 100*time.Millisecond)
+
+			record()
+			Expect(scrape(handler).TotalRequests).To(Equal(int64(1)))
+
+			record()
+			Expect(scrape(handler).TotalRequests).To(Equal(int64(1)))
+
+			time.Sleep(100 * time.Millisecond)
+			Expect(scrape(handler).TotalRequests).To(Equal(int64(2)))
+		})
+
+		It("should render every time without a ttl", func() {
+			collector.Start(ctx)
+			handler := collector.CachedHandler("round-robin", 0)
+
+			record()
+			Expect(scrape(handler).TotalRequests).To(Equal(int64(1)))
+			record()
+			Expect(scrape(handler).TotalRequests).To(Equal(int64(2)))
+		})
+	})
+
 	Describe("Snapshot", func() {
 		It("should return current metrics snapshot", func() {
 			collector.Start(ctx)
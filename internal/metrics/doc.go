@@ -6,6 +6,7 @@
 //   - Response times with percentile calculations (P50, P95, P99)
 //   - HTTP status code distribution
 //   - Health status tracking
+//   - Optional per-endpoint latency and errors, labelled by Endpoints
 //
 // The collector runs in a dedicated goroutine and processes events without blocking
 // the request path. Events are sent via buffered channels with non-blocking semantics
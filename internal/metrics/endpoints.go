@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OtherEndpoint labels requests whose path matches none of the configured
+// templates, and OtherMethod requests with a non-standard method.
+const (
+	OtherEndpoint = "other"
+	OtherMethod   = "OTHER"
+)
+
+// Endpoints maps requests to "METHOD template" labels for per-endpoint
+// metrics. Only the configured path templates become labels, so the number
+// of series stays bounded however many distinct paths clients send.
+type Endpoints struct {
+	templates []template
+}
+
+type template struct {
+	raw      string
+	segments []string
+	rest     bool
+}
+
+// NewEndpoints parses path templates such as "/users/{id}" or
+// "/static/{path...}". A {name} segment matches any single path segment and a
+// trailing {name...} matches the remainder of the path. Templates are tried
+// in order and the first match wins.
+func NewEndpoints(templates []string) (*Endpoints, error) {
+	e := &Endpoints{templates: make([]template, 0, len(templates))}
+	for _, raw := range templates {
+		t, err := parseTemplate(raw)
+		if err != nil {
+			return nil, err
+		}
+		e.templates = append(e.templates, t)
+	}
+	return e, nil
+}
+
+func parseTemplate(raw string) (template, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return template{}, fmt.Errorf("path template %q must start with /", raw)
+	}
+
+	t := template{raw: raw, segments: strings.Split(raw[1:], "/")}
+	for i, seg := range t.segments {
+		if !strings.HasPrefix(seg, "{") && !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		if len(seg) < 3 || !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			return template{}, fmt.Errorf("path template %q has a malformed wildcard %q", raw, seg)
+		}
+		if strings.HasSuffix(seg, "...}") {
+			if i != len(t.segments)-1 {
+				return template{}, fmt.Errorf("path template %q: %s must be the last segment", raw, seg)
+			}
+			t.rest = true
+			t.segments = t.segments[:i]
+		}
+	}
+	return t, nil
+}
+
+// Label returns the endpoint label for r, e.g. "GET /users/{id}".
+func (e *Endpoints) Label(r *http.Request) string {
+	return normalizeMethod(r.Method) + " " + e.match(r.URL.Path)
+}
+
+func (e *Endpoints) match(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for _, t := range e.templates {
+		if t.matches(segments) {
+			return t.raw
+		}
+	}
+	return OtherEndpoint
+}
+
+func (t template) matches(segments []string) bool {
+	if len(segments) < len(t.segments) || (!t.rest && len(segments) != len(t.segments)) {
+		return false
+	}
+
+	for i, seg := range t.segments {
+		if strings.HasPrefix(seg, "{") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if seg != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return OtherMethod
+	}
+}
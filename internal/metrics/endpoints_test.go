@@ -0,0 +1,40 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+var _ = Describe("Endpoints", func() {
+	var endpoints *metrics.Endpoints
+
+	BeforeEach(func() {
+		var err error
+		endpoints, err = metrics.NewEndpoints([]string{"/users/{id}", "/users/{id}/orders", "/static/{path...}", "/"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("labels",
+		func(method, target, label string) {
+			Expect(endpoints.Label(httptest.NewRequest(method, target, nil))).To(Equal(label))
+		},
+		Entry("a single-segment wildcard", "GET", "/users/42", "GET /users/{id}"),
+		Entry("a literal after a wildcard", "POST", "/users/42/orders", "POST /users/{id}/orders"),
+		Entry("a trailing wildcard", "GET", "/static/css/site.css?v=1", "GET /static/{path...}"),
+		Entry("the root", "GET", "/", "GET /"),
+		Entry("an empty wildcard segment as other", "GET", "/users/", "GET other"),
+		Entry("an unlisted path as other", "GET", "/admin/users", "GET other"),
+		Entry("a non-standard method as OTHER", "PROPFIND", "/users/42", "OTHER /users/{id}"),
+	)
+
+	It("should reject malformed templates", func() {
+		for _, template := range []string{"users/{id}", "/users/{id", "/files/{path...}/raw", "/users/{}"} {
+			_, err := metrics.NewEndpoints([]string{template})
+			Expect(err).To(HaveOccurred(), template)
+		}
+	})
+})
@@ -7,7 +7,7 @@ import (
 
 func (c *Collector) Handler(strategy string) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        snap := c.metrics.Snapshot(strategy)
+        snap := c.Snapshot(strategy)
         
         w.Header().Set("Content-Type", "application/json")
         if err := json.NewEncoder(w).Encode(snap); err != nil {
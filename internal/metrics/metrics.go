@@ -1,9 +1,13 @@
 package metrics
 
 import (
+	"math"
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/grpcstatus"
 )
 
 type Metrics struct {
@@ -11,27 +15,185 @@ type Metrics struct {
 	requests      map[string]int64
 	selections    map[string]int64
 	responseTimes map[string][]time.Duration
-	statusCodes   map[string]map[int]int64
+	statusCodes   map[string]*statusCounts
+	grpcStatuses  map[string]map[int]int64
 	healthStatus  map[string]bool
+	states        map[string]string
+	canceled      map[string]int64
+	lbErrors      map[int]int64
+	endpoints     map[string]*endpointStats
+	ipRejected    map[string]int64
+	hdrRejected   map[string]int64
+	wafHits       map[string]int64
+	classes       map[string]ClassMetrics
+	decisions     map[string]DecisionMetrics
+	queue         queueStats
+	certificates  map[string]certificateStatus
+	failovers     map[string]int64
+	failures      map[string]map[string]int64
 	startTime     time.Time
 }
 
+type queueStats struct {
+	outcomes map[string]int64
+	admitted int64
+	waited   time.Duration
+}
+
+type certificateStatus struct {
+	expiry   time.Time
+	expiring bool
+}
+
+type endpointStats struct {
+	requests      int64
+	responseTimes []time.Duration
+	statusCodes   *statusCounts
+}
+
+// SnapshotSchemaVersion is bumped whenever a Snapshot field is added,
+// renamed, removed or changes meaning. Version 2 adds the fields introduced
+// since version 1, such as client_ip_rejected and affinity_failovers.
+const SnapshotSchemaVersion = 2
+
 type Snapshot struct {
+	SchemaVersion int                       `json:"schema_version"`
 	TotalRequests int64                     `json:"total_requests"`
 	Uptime        time.Duration             `json:"uptime"`
 	Backends      map[string]BackendMetrics `json:"backends"`
 	Algorithm     string                    `json:"algorithm"`
+	Errors        ErrorCounts               `json:"errors"`
+	// Endpoints is keyed by endpoint label, e.g. "GET /users/{id}", and is
+	// only populated when endpoint metrics are enabled.
+	Endpoints map[string]EndpointMetrics `json:"endpoints,omitempty"`
+	// ClientIPRejected counts requests whose client IP header was not
+	// believed, keyed by reason ("untrusted_peer", "invalid").
+	ClientIPRejected map[string]int64 `json:"client_ip_rejected,omitempty"`
+	// HeadersRejected counts requests refused with 431 because their headers
+	// exceeded a limit, keyed by limit ("size", "count", "line_length").
+	HeadersRejected map[string]int64 `json:"headers_rejected,omitempty"`
+	// WAFHits counts requests each WAF rule blocked, rate limited or
+	// tagged, keyed by rule name.
+	WAFHits map[string]int64 `json:"waf_hits,omitempty"`
+	// Classes counts the responses clients received by traffic class
+	// ("probe", "bot", "browser", "api"), when classification is enabled.
+	Classes map[string]ClassMetrics `json:"classes,omitempty"`
+	// Decisions counts the internal decisions of the strategy and the
+	// balancer, keyed by kind ("ring_rebuild", "ring_miss",
+	// "chain_fallback", "subset").
+	Decisions map[string]DecisionMetrics `json:"decisions,omitempty"`
+	// Queue describes the admission queue, once a request has met a pool
+	// whose backends were all full.
+	Queue *QueueMetrics `json:"queue,omitempty"`
+}
+
+// ClassMetrics counts the requests of one traffic class. Errors counts 5xx
+// responses.
+type ClassMetrics struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+// DecisionMetrics counts the decisions of one kind. Last is the value the
+// latest one reported, e.g. the number of backends on a rebuilt ring.
+type DecisionMetrics struct {
+	Count int64   `json:"count"`
+	Last  float64 `json:"last"`
+}
+
+// QueueMetrics describes the admission queue. Depth is the number of requests
+// waiting when the snapshot was taken, as the Collector reads it from the
+// queue, Outcomes counts requests by what became of them ("queued",
+// "admitted", "timeout", "full", "canceled") and AvgWait is the mean time
+// admitted requests waited.
+type QueueMetrics struct {
+	Depth    int64            `json:"depth"`
+	Outcomes map[string]int64 `json:"outcomes"`
+	AvgWait  time.Duration    `json:"avg_wait"`
+}
+
+// ErrorCounts splits 5xx responses by origin: LB counts responses the
+// balancer generated itself (no backend available, timeouts, rate limits),
+// Upstream counts 5xx responses relayed from backends. UpstreamGRPC counts
+// gRPC calls that failed with a backend-side status, which arrive as HTTP 200.
+type ErrorCounts struct {
+	LB           map[int]int64 `json:"lb"`
+	Upstream     map[int]int64 `json:"upstream"`
+	UpstreamGRPC map[int]int64 `json:"upstream_grpc,omitempty"`
 }
 
 type BackendMetrics struct {
+	Requests       int64         `json:"requests"`
+	Selections     int64         `json:"selections"`
+	Healthy        bool          `json:"healthy"`
+	State          string        `json:"state,omitempty"`
+	AvgResponse    time.Duration `json:"avg_response"`
+	P50Response    time.Duration `json:"p50_response"`
+	P95Response    time.Duration `json:"p95_response"`
+	P99Response    time.Duration `json:"p99_response"`
+	StatusCodes    map[int]int64 `json:"status_codes"`
+	GRPCStatuses   map[int]int64 `json:"grpc_statuses,omitempty"`
+	ClientCanceled int64         `json:"client_canceled"`
+	// AffinityFailovers counts requests a hashing strategy maps to this
+	// backend that were served by another one.
+	AffinityFailovers int64 `json:"affinity_failovers,omitempty"`
+	// OtherStatusCodes counts the responses whose code StatusCodes no
+	// longer lists, so that the two together count every response.
+	OtherStatusCodes int64 `json:"other_status_codes,omitempty"`
+	// StatusClasses counts every response by class ("2xx", ..., "other"),
+	// including those whose code StatusCodes no longer lists.
+	StatusClasses map[string]int64 `json:"status_classes"`
+	// Errors breaks down why the backend failed requests. It is only present
+	// once it has.
+	Errors *BackendErrors `json:"errors,omitempty"`
+	// CertificateExpiresInDays is the time left until the backend's TLS
+	// certificate expires, negative once it has expired. It is only present
+	// for HTTPS backends once certificate monitoring has seen a handshake.
+	CertificateExpiresInDays *float64 `json:"certificate_expires_in_days,omitempty"`
+	CertificateExpiring      bool     `json:"certificate_expiring,omitempty"`
+	// SkippedChecks counts the health checks that did not run because the
+	// one before them overran the check interval.
+	SkippedChecks uint64 `json:"skipped_checks,omitempty"`
+}
+
+// EndpointMetrics describes the responses clients received for one endpoint,
+// after retries. Errors counts 5xx responses from any source.
+type EndpointMetrics struct {
 	Requests    int64         `json:"requests"`
-	Selections  int64         `json:"selections"`
-	Healthy     bool          `json:"healthy"`
+	Errors      int64         `json:"errors"`
 	AvgResponse time.Duration `json:"avg_response"`
 	P50Response time.Duration `json:"p50_response"`
 	P95Response time.Duration `json:"p95_response"`
 	P99Response time.Duration `json:"p99_response"`
 	StatusCodes map[int]int64 `json:"status_codes"`
+	// OtherStatusCodes counts the responses whose code StatusCodes no
+	// longer lists, like the backend's.
+	OtherStatusCodes int64 `json:"other_status_codes,omitempty"`
+	// StatusClasses counts every response by class, like the backend's.
+	StatusClasses map[string]int64 `json:"status_classes"`
+}
+
+// Counters are cheap running totals. LBErrors counts responses the balancer
+// generated itself, such as 503s when no backend is available, and
+// DroppedEvents the metric events lost because the collector fell behind.
+type Counters struct {
+	Requests      int64 `json:"requests"`
+	LBErrors      int64 `json:"lb_errors"`
+	DroppedEvents int64 `json:"dropped_events"`
+}
+
+func (m *Metrics) Counters() Counters {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var counters Counters
+	for _, count := range m.requests {
+		counters.Requests += count
+	}
+	for _, count := range m.lbErrors {
+		counters.LBErrors += count
+	}
+	return counters
 }
 
 func (m *Metrics) IncrementRequests(backend string) {
@@ -56,10 +218,104 @@ func (m *Metrics) RecordResponse(backend string, duration time.Duration, statusC
 		m.responseTimes[backend] = m.responseTimes[backend][1:]
 	}
 
+	now := time.Now()
 	if m.statusCodes[backend] == nil {
-		m.statusCodes[backend] = make(map[int]int64)
+		m.statusCodes[backend] = newStatusCounts(now)
+	}
+	m.statusCodes[backend].record(statusCode, now)
+}
+
+func (m *Metrics) RecordGRPCStatus(backend string, code int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.grpcStatuses[backend] == nil {
+		m.grpcStatuses[backend] = make(map[int]int64)
+	}
+	m.grpcStatuses[backend][code]++
+}
+
+func (m *Metrics) RecordEndpoint(endpoint string, duration time.Duration, statusCode int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats := m.endpoints[endpoint]
+	if stats == nil {
+		stats = &endpointStats{statusCodes: newStatusCounts(time.Now())}
+		m.endpoints[endpoint] = stats
+	}
+
+	stats.requests++
+	stats.statusCodes.record(statusCode, time.Now())
+	stats.responseTimes = append(stats.responseTimes, duration)
+	if len(stats.responseTimes) > 1000 {
+		stats.responseTimes = stats.responseTimes[1:]
+	}
+}
+
+func (m *Metrics) RecordClientCanceled(backend string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.canceled[backend]++
+}
+
+func (m *Metrics) RecordLBError(statusCode int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lbErrors[statusCode]++
+}
+
+func (m *Metrics) RecordClientIPRejected(reason string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.ipRejected[reason]++
+}
+
+func (m *Metrics) RecordHeadersRejected(reason string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.hdrRejected[reason]++
+}
+
+func (m *Metrics) RecordWAFHit(rule string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.wafHits[rule]++
+}
+
+func (m *Metrics) RecordDecision(kind string, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	dm := m.decisions[kind]
+	dm.Count++
+	dm.Last = value
+	m.decisions[kind] = dm
+}
+
+// RecordQueue records a request entering the admission queue with outcome
+// "queued", or leaving it or being turned away with any other outcome.
+func (m *Metrics) RecordQueue(outcome string, waited time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.queue.outcomes[outcome]++
+	if outcome == "admitted" {
+		m.queue.admitted++
+		m.queue.waited += waited
+	}
+}
+
+func (m *Metrics) RecordClass(class string, statusCode int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cm := m.classes[class]
+	cm.Requests++
+	if statusCode >= 500 {
+		cm.Errors++
 	}
-	m.statusCodes[backend][statusCode]++
+	m.classes[class] = cm
 }
 
 func (m *Metrics) UpdateHealthStatus(backend string, healthy bool) {
@@ -68,14 +324,97 @@ func (m *Metrics) UpdateHealthStatus(backend string, healthy bool) {
 	m.healthStatus[backend] = healthy
 }
 
+func (m *Metrics) UpdateState(backend, state string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.states[backend] = state
+}
+
+func (m *Metrics) RecordAffinityFailover(backend string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failovers[backend]++
+}
+
+// BreakerRejected is the Reason of an EventBackendFailure for an attempt the
+// backend's open circuit breaker skipped.
+const BreakerRejected = "breaker_rejected"
+
+// BackendErrors counts a backend's failures by cause. Dial, Timeout, Reset and
+// Other count attempts that got no response, as backend.ClassifyFailure
+// sorts them; Status5xx counts the 5xx responses it sent and
+// BreakerRejected the attempts its circuit breaker skipped.
+type BackendErrors struct {
+	Dial            int64 `json:"dial"`
+	Timeout         int64 `json:"timeout"`
+	Reset           int64 `json:"reset"`
+	Other           int64 `json:"other"`
+	Status5xx       int64 `json:"status_5xx"`
+	BreakerRejected int64 `json:"breaker_rejected"`
+}
+
+func (m *Metrics) RecordBackendFailure(backend, reason string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.failures[backend] == nil {
+		m.failures[backend] = make(map[string]int64)
+	}
+	m.failures[backend][reason]++
+}
+
+// backendErrors returns nil for a backend that has not failed.
+func (m *Metrics) backendErrors(name string) *BackendErrors {
+	failures := m.failures[name]
+	var status5xx int64
+	if s := m.statusCodes[name]; s != nil {
+		status5xx = s.classes[5]
+	}
+	if len(failures) == 0 && status5xx == 0 {
+		return nil
+	}
+
+	errs := &BackendErrors{Status5xx: status5xx}
+	for reason, count := range failures {
+		switch reason {
+		case backend.FailureDial:
+			errs.Dial += count
+		case backend.FailureTimeout:
+			errs.Timeout += count
+		case backend.FailureReset:
+			errs.Reset += count
+		case BreakerRejected:
+			errs.BreakerRejected += count
+		default:
+			errs.Other += count
+		}
+	}
+	return errs
+}
+
+func (m *Metrics) UpdateCertificate(backend string, expiry time.Time, expiring bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.certificates[backend] = certificateStatus{expiry: expiry, expiring: expiring}
+}
+
 func (m *Metrics) Snapshot(algorithm string) Snapshot {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	snap := Snapshot{
-		Uptime:    time.Since(m.startTime),
-		Backends:  make(map[string]BackendMetrics),
-		Algorithm: algorithm,
+		SchemaVersion: SnapshotSchemaVersion,
+		Uptime:        time.Since(m.startTime),
+		Backends:      make(map[string]BackendMetrics),
+		Algorithm:     algorithm,
+		Errors: ErrorCounts{
+			LB:           make(map[int]int64, len(m.lbErrors)),
+			Upstream:     make(map[int]int64),
+			UpstreamGRPC: make(map[int]int64),
+		},
+	}
+
+	for code, count := range m.lbErrors {
+		snap.Errors.LB[code] = count
 	}
 
 	// Collect all unique backend URLs
@@ -92,25 +431,61 @@ func (m *Metrics) Snapshot(algorithm string) Snapshot {
 	for backend := range m.healthStatus {
 		allBackends[backend] = true
 	}
+	for backend := range m.canceled {
+		allBackends[backend] = true
+	}
+	for backend := range m.states {
+		allBackends[backend] = true
+	}
+	for backend := range m.certificates {
+		allBackends[backend] = true
+	}
+	for backend := range m.failovers {
+		allBackends[backend] = true
+	}
+	for backend := range m.failures {
+		allBackends[backend] = true
+	}
 
 	for backend := range allBackends {
 		snap.TotalRequests += m.requests[backend]
 
 		bm := BackendMetrics{
-			Requests:    m.requests[backend],
-			Selections:  m.selections[backend],
-			Healthy:     m.healthStatus[backend],
-			StatusCodes: m.statusCodes[backend],
+			Requests:          m.requests[backend],
+			Selections:        m.selections[backend],
+			Healthy:           m.healthStatus[backend],
+			State:             m.states[backend],
+			StatusCodes:       m.statusCodes[backend].codeCounts(),
+			OtherStatusCodes:  m.statusCodes[backend].otherCount(),
+			StatusClasses:     m.statusCodes[backend].classCounts(),
+			GRPCStatuses:      m.grpcStatuses[backend],
+			ClientCanceled:    m.canceled[backend],
+			AffinityFailovers: m.failovers[backend],
+			Errors:            m.backendErrors(backend),
+		}
+
+		if cert, ok := m.certificates[backend]; ok {
+			days := math.Round(time.Until(cert.expiry).Hours()/24*100) / 100
+			bm.CertificateExpiresInDays = &days
+			bm.CertificateExpiring = cert.expiring
+		}
+
+		// Every 5xx code is counted exactly, so these add up to the
+		// backends' 5xx class counts.
+		for code, count := range bm.StatusCodes {
+			if statusClass(code) == 5 {
+				snap.Errors.Upstream[code] += count
+			}
+		}
+		for code, count := range m.grpcStatuses[backend] {
+			if grpcstatus.IsFailure(code) {
+				snap.Errors.UpstreamGRPC[code] += count
+			}
 		}
 
 		durations := m.responseTimes[backend]
 		if len(durations) > 0 {
-			sorted := make([]time.Duration, len(durations))
-			copy(sorted, durations)
-			sort.Slice(sorted, func(i, j int) bool {
-				return sorted[i] < sorted[j]
-			})
-
+			sorted := sortedCopy(durations)
 			bm.AvgResponse = average(sorted)
 			bm.P50Response = percentile(sorted, 0.50)
 			bm.P95Response = percentile(sorted, 0.95)
@@ -120,6 +495,74 @@ func (m *Metrics) Snapshot(algorithm string) Snapshot {
 		snap.Backends[backend] = bm
 	}
 
+	if len(m.endpoints) > 0 {
+		snap.Endpoints = make(map[string]EndpointMetrics, len(m.endpoints))
+	}
+	for endpoint, stats := range m.endpoints {
+		em := EndpointMetrics{
+			Requests:         stats.requests,
+			Errors:           stats.statusCodes.classes[5],
+			StatusCodes:      stats.statusCodes.codeCounts(),
+			OtherStatusCodes: stats.statusCodes.otherCount(),
+			StatusClasses:    stats.statusCodes.classCounts(),
+		}
+		if len(stats.responseTimes) > 0 {
+			sorted := sortedCopy(stats.responseTimes)
+			em.AvgResponse = average(sorted)
+			em.P50Response = percentile(sorted, 0.50)
+			em.P95Response = percentile(sorted, 0.95)
+			em.P99Response = percentile(sorted, 0.99)
+		}
+		snap.Endpoints[endpoint] = em
+	}
+
+	if len(m.ipRejected) > 0 {
+		snap.ClientIPRejected = make(map[string]int64, len(m.ipRejected))
+		for reason, count := range m.ipRejected {
+			snap.ClientIPRejected[reason] = count
+		}
+	}
+
+	if len(m.hdrRejected) > 0 {
+		snap.HeadersRejected = make(map[string]int64, len(m.hdrRejected))
+		for reason, count := range m.hdrRejected {
+			snap.HeadersRejected[reason] = count
+		}
+	}
+
+	if len(m.wafHits) > 0 {
+		snap.WAFHits = make(map[string]int64, len(m.wafHits))
+		for rule, count := range m.wafHits {
+			snap.WAFHits[rule] = count
+		}
+	}
+
+	if len(m.classes) > 0 {
+		snap.Classes = make(map[string]ClassMetrics, len(m.classes))
+		for class, cm := range m.classes {
+			snap.Classes[class] = cm
+		}
+	}
+
+	if len(m.queue.outcomes) > 0 {
+		snap.Queue = &QueueMetrics{
+			Outcomes: make(map[string]int64, len(m.queue.outcomes)),
+		}
+		for outcome, count := range m.queue.outcomes {
+			snap.Queue.Outcomes[outcome] = count
+		}
+		if m.queue.admitted > 0 {
+			snap.Queue.AvgWait = m.queue.waited / time.Duration(m.queue.admitted)
+		}
+	}
+
+	if len(m.decisions) > 0 {
+		snap.Decisions = make(map[string]DecisionMetrics, len(m.decisions))
+		for kind, dm := range m.decisions {
+			snap.Decisions[kind] = dm
+		}
+	}
+
 	return snap
 }
 
@@ -128,12 +571,35 @@ func NewMetrics() *Metrics {
 		requests:      make(map[string]int64),
 		selections:    make(map[string]int64),
 		responseTimes: make(map[string][]time.Duration),
-		statusCodes:   make(map[string]map[int]int64),
+		statusCodes:   make(map[string]*statusCounts),
+		grpcStatuses:  make(map[string]map[int]int64),
 		healthStatus:  make(map[string]bool),
+		states:        make(map[string]string),
+		canceled:      make(map[string]int64),
+		lbErrors:      make(map[int]int64),
+		endpoints:     make(map[string]*endpointStats),
+		ipRejected:    make(map[string]int64),
+		hdrRejected:   make(map[string]int64),
+		wafHits:       make(map[string]int64),
+		classes:       make(map[string]ClassMetrics),
+		decisions:     make(map[string]DecisionMetrics),
+		queue:         queueStats{outcomes: make(map[string]int64)},
+		certificates:  make(map[string]certificateStatus),
+		failovers:     make(map[string]int64),
+		failures:      make(map[string]map[string]int64),
 		startTime:     time.Now(),
 	}
 }
 
+func sortedCopy(durations []time.Duration) []time.Duration {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
 func average(durations []time.Duration) time.Duration {
 	if len(durations) == 0 {
 		return 0
@@ -6,6 +6,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/angeloszaimis/load-balancer/internal/backend"
 	"github.com/angeloszaimis/load-balancer/internal/metrics"
 )
 
@@ -56,6 +57,86 @@ var _ = Describe("Metrics", func() {
 		})
 	})
 
+	Describe("Counters", func() {
+		It("should total requests and balancer errors across backends", func() {
+			m.IncrementRequests("http://localhost:8081")
+			m.IncrementRequests("http://localhost:8082")
+			m.RecordLBError(503)
+
+			Expect(m.Counters()).To(Equal(metrics.Counters{Requests: 2, LBErrors: 1}))
+		})
+	})
+
+	Describe("RecordEndpoint", func() {
+		It("should report requests, 5xx errors and latency per endpoint", func() {
+			m.RecordEndpoint("GET /users/{id}", 10*time.Millisecond, 200)
+			m.RecordEndpoint("GET /users/{id}", 30*time.Millisecond, 502)
+			m.RecordEndpoint("POST /users", 5*time.Millisecond, 201)
+
+			snap := m.Snapshot("round-robin")
+			Expect(snap.Endpoints).To(HaveLen(2))
+
+			em := snap.Endpoints["GET /users/{id}"]
+			Expect(em.Requests).To(Equal(int64(2)))
+			Expect(em.Errors).To(Equal(int64(1)))
+			Expect(em.StatusCodes).To(Equal(map[int]int64{200: 1, 502: 1}))
+			Expect(em.AvgResponse).To(Equal(20 * time.Millisecond))
+			Expect(em.P99Response).To(Equal(30 * time.Millisecond))
+		})
+
+		It("should leave endpoints out of the snapshot when none were recorded", func() {
+			Expect(m.Snapshot("round-robin").Endpoints).To(BeNil())
+		})
+	})
+
+	Describe("RecordClientIPRejected", func() {
+		It("should count rejected client IP headers by reason", func() {
+			m.RecordClientIPRejected("untrusted_peer")
+			m.RecordClientIPRejected("untrusted_peer")
+			m.RecordClientIPRejected("invalid")
+
+			Expect(m.Snapshot("round-robin").ClientIPRejected).To(Equal(map[string]int64{"untrusted_peer": 2, "invalid": 1}))
+		})
+
+		It("should leave the counts out of the snapshot when nothing was rejected", func() {
+			Expect(m.Snapshot("round-robin").ClientIPRejected).To(BeNil())
+		})
+	})
+
+	Describe("RecordHeadersRejected", func() {
+		It("should count rejected request headers by limit", func() {
+			m.RecordHeadersRejected("size")
+			m.RecordHeadersRejected("line_length")
+			m.RecordHeadersRejected("size")
+
+			Expect(m.Snapshot("round-robin").HeadersRejected).To(Equal(map[string]int64{"size": 2, "line_length": 1}))
+		})
+	})
+
+	Describe("RecordWAFHit", func() {
+		It("should count hits by rule", func() {
+			m.RecordWAFHit("block-dotfiles")
+			m.RecordWAFHit("block-dotfiles")
+			m.RecordWAFHit("limit-login")
+
+			Expect(m.Snapshot("round-robin").WAFHits).To(Equal(map[string]int64{"block-dotfiles": 2, "limit-login": 1}))
+		})
+	})
+
+	Describe("RecordClass", func() {
+		It("should count requests and 5xx responses by class", func() {
+			m.RecordClass("probe", 200)
+			m.RecordClass("api", 200)
+			m.RecordClass("api", 502)
+			m.RecordClass("api", 404)
+
+			Expect(m.Snapshot("round-robin").Classes).To(Equal(map[string]metrics.ClassMetrics{
+				"probe": {Requests: 1},
+				"api":   {Requests: 3, Errors: 1},
+			}))
+		})
+	})
+
 	Describe("RecordResponse", func() {
 		It("should record response time and status code", func() {
 			m.RecordResponse("http://localhost:8081", 100*time.Millisecond, 200)
@@ -94,6 +175,73 @@ var _ = Describe("Metrics", func() {
 			Expect(backend.P99Response).To(BeNumerically("~", 99*time.Millisecond, 1*time.Millisecond))
 		})
 
+		It("should count status classes", func() {
+			for _, code := range []int{200, 201, 302, 404, 503, 999} {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, code)
+			}
+
+			backend := m.Snapshot("round-robin").Backends["http://localhost:8081"]
+			Expect(backend.StatusClasses).To(Equal(map[string]int64{
+				"2xx": 2, "3xx": 1, "4xx": 1, "5xx": 1, "other": 1,
+			}))
+		})
+
+		It("should bound the exact status codes kept", func() {
+			for range 100 {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 200)
+			}
+			for code := 400; code < 450; code++ {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, code)
+			}
+
+			backend := m.Snapshot("round-robin").Backends["http://localhost:8081"]
+			Expect(len(backend.StatusCodes)).To(BeNumerically("<=", 20))
+			Expect(backend.StatusCodes).To(HaveKeyWithValue(200, int64(100)))
+			Expect(backend.StatusClasses).To(Equal(map[string]int64{"2xx": 100, "4xx": 50}))
+		})
+
+		It("should count every 5xx code exactly", func() {
+			for code := 400; code < 450; code++ {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, code)
+			}
+			for code := 500; code < 530; code++ {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, code)
+			}
+
+			snap := m.Snapshot("round-robin")
+			backend := snap.Backends["http://localhost:8081"]
+			var upstream int64
+			for _, count := range snap.Errors.Upstream {
+				upstream += count
+			}
+			Expect(upstream).To(Equal(backend.StatusClasses["5xx"]))
+			Expect(upstream).To(Equal(int64(30)))
+		})
+
+		It("should make room for codes seen often after a burst of unusual ones", func() {
+			for code := 450; code < 470; code++ {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, code)
+			}
+			for range 5 {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 404)
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 429)
+			}
+			for code := 470; code < 480; code++ {
+				m.RecordResponse("http://localhost:8081", 10*time.Millisecond, code)
+			}
+
+			backend := m.Snapshot("round-robin").Backends["http://localhost:8081"]
+			Expect(backend.StatusCodes).To(HaveKeyWithValue(404, int64(5)))
+			Expect(backend.StatusCodes).To(HaveKeyWithValue(429, int64(5)))
+			Expect(backend.OtherStatusCodes).To(BeNumerically(">", 0))
+
+			var total int64
+			for _, count := range backend.StatusCodes {
+				total += count
+			}
+			Expect(total + backend.OtherStatusCodes).To(Equal(int64(40)))
+		})
+
 		It("should limit stored response times to 1000", func() {
 			for i := 1; i <= 1500; i++ {
 				m.RecordResponse("http://localhost:8081", time.Duration(i)*time.Millisecond, 200)
@@ -106,6 +254,60 @@ var _ = Describe("Metrics", func() {
 		})
 	})
 
+	Describe("RecordClientCanceled", func() {
+		It("should count cancellations separately from responses", func() {
+			m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 200)
+			m.RecordClientCanceled("http://localhost:8081")
+
+			bm := m.Snapshot("round-robin").Backends["http://localhost:8081"]
+			Expect(bm.ClientCanceled).To(Equal(int64(1)))
+			Expect(bm.StatusCodes).To(HaveLen(1))
+		})
+	})
+
+	Describe("RecordBackendFailure", func() {
+		It("should break a backend's failures down by cause", func() {
+			m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 200)
+			m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 503)
+			m.RecordBackendFailure("http://localhost:8081", backend.FailureDial)
+			m.RecordBackendFailure("http://localhost:8081", backend.FailureDial)
+			m.RecordBackendFailure("http://localhost:8081", backend.FailureTimeout)
+			m.RecordBackendFailure("http://localhost:8081", backend.FailureReset)
+			m.RecordBackendFailure("http://localhost:8081", backend.FailureOther)
+			m.RecordBackendFailure("http://localhost:8081", metrics.BreakerRejected)
+
+			bm := m.Snapshot("round-robin").Backends["http://localhost:8081"]
+			Expect(bm.Errors).To(Equal(&metrics.BackendErrors{
+				Dial:            2,
+				Timeout:         1,
+				Reset:           1,
+				Other:           1,
+				Status5xx:       1,
+				BreakerRejected: 1,
+			}))
+		})
+
+		It("should leave the breakdown out for a backend that has not failed", func() {
+			m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 200)
+			m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 404)
+
+			Expect(m.Snapshot("round-robin").Backends["http://localhost:8081"].Errors).To(BeNil())
+		})
+	})
+
+	Describe("RecordLBError", func() {
+		It("should separate LB-generated errors from upstream ones", func() {
+			m.RecordResponse("http://localhost:8081", 10*time.Millisecond, 502)
+			m.RecordResponse("http://localhost:8082", 10*time.Millisecond, 502)
+			m.RecordResponse("http://localhost:8082", 10*time.Millisecond, 404)
+			m.RecordLBError(503)
+
+			snap := m.Snapshot("round-robin")
+			Expect(snap.Errors.LB).To(Equal(map[int]int64{503: 1}))
+			Expect(snap.Errors.Upstream).To(Equal(map[int]int64{502: 2}))
+		})
+	})
+
 	Describe("UpdateHealthStatus", func() {
 		It("should update backend health status", func() {
 			m.UpdateHealthStatus("http://localhost:8081", true)
@@ -123,6 +325,37 @@ var _ = Describe("Metrics", func() {
 			snap2 := m.Snapshot("round-robin")
 			Expect(snap2.Backends["http://localhost:8081"].Healthy).To(BeFalse())
 		})
+
+		It("should count strategy decisions and keep the last value", func() {
+			m.RecordDecision("ring_rebuild", 3)
+			m.RecordDecision("ring_rebuild", 2)
+
+			snap := m.Snapshot("consistent-hash")
+			Expect(snap.Decisions).To(Equal(map[string]metrics.DecisionMetrics{
+				"ring_rebuild": {Count: 2, Last: 2},
+			}))
+		})
+
+		It("should track the admission queue outcomes", func() {
+			Expect(m.Snapshot("round-robin").Queue).To(BeNil())
+
+			m.RecordQueue("queued", 0)
+			m.RecordQueue("queued", 0)
+			m.RecordQueue("full", 0)
+			m.RecordQueue("admitted", 30*time.Millisecond)
+
+			q := m.Snapshot("round-robin").Queue
+			Expect(q).NotTo(BeNil())
+			Expect(q.Outcomes).To(Equal(map[string]int64{"queued": 2, "full": 1, "admitted": 1}))
+			Expect(q.AvgWait).To(Equal(30 * time.Millisecond))
+		})
+
+		It("should report the backend state", func() {
+			m.UpdateState("http://localhost:8081", "maintenance")
+
+			snap := m.Snapshot("round-robin")
+			Expect(snap.Backends["http://localhost:8081"].State).To(Equal("maintenance"))
+		})
 	})
 
 	Describe("Snapshot", func() {
@@ -157,5 +390,11 @@ var _ = Describe("Metrics", func() {
 			Expect(snap1.TotalRequests).To(Equal(int64(1)))
 			Expect(snap2.TotalRequests).To(Equal(int64(2)))
 		})
+
+		It("should carry the schema version", func() {
+			snap := m.Snapshot("round-robin")
+
+			Expect(snap.SchemaVersion).To(Equal(metrics.SnapshotSchemaVersion))
+		})
 	})
 })
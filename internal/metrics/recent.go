@@ -0,0 +1,49 @@
+package metrics
+
+import "sync"
+
+// eventRing keeps the latest events the collector processed.
+type eventRing struct {
+	mutex  sync.Mutex
+	events []MetricEvent
+	next   int
+	full   bool
+}
+
+// KeepRecent makes the collector keep the last n events it processes for
+// RecentEvents. It must be called before Start.
+func (c *Collector) KeepRecent(n int) {
+	if n > 0 {
+		c.recent = &eventRing{events: make([]MetricEvent, n)}
+	}
+}
+
+// RecentEvents returns the events kept, oldest first, or nil unless
+// KeepRecent was called.
+func (c *Collector) RecentEvents() []MetricEvent {
+	if c.recent == nil {
+		return nil
+	}
+	return c.recent.list()
+}
+
+func (r *eventRing) add(event MetricEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *eventRing) list() []MetricEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.full {
+		return append([]MetricEvent(nil), r.events[:r.next]...)
+	}
+	return append(append([]MetricEvent(nil), r.events[r.next:]...), r.events[:r.next]...)
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// Exact counts outside 5xx are kept for the maxStatusCodes codes seen most
+// within the latest statusCodeWindow, per backend and endpoint. Up to twice
+// as many are held between compactions. The responses of codes that drop out
+// move to the other bucket, so the exact counts and other together only ever
+// grow; a code that comes back restarts its exact count. 5xx codes are always
+// counted exactly, as there are at most 100 of them.
+const (
+	maxStatusCodes   = 10
+	statusCodeWindow = 10 * time.Minute
+)
+
+// statusClasses labels the classes statusCounts.classes counts, by the
+// hundreds digit of the code; codes outside 100-599 count as "other".
+var statusClasses = [6]string{"other", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// statusCounts counts responses by status class, and by exact code for every
+// 5xx code and the other codes seen most recently. Its size is bounded
+// whatever codes backends send.
+type statusCounts struct {
+	classes     [6]int64
+	codes       map[int]*codeCount
+	windowStart time.Time
+	// others is the number of codes outside 5xx in codes, and other the
+	// responses of the codes compaction dropped.
+	others int
+	other  int64
+}
+
+type codeCount struct {
+	total  int64
+	recent int64
+}
+
+func newStatusCounts(now time.Time) *statusCounts {
+	return &statusCounts{codes: make(map[int]*codeCount), windowStart: now}
+}
+
+func (s *statusCounts) record(code int, now time.Time) {
+	class := statusClass(code)
+	s.classes[class]++
+
+	if c, ok := s.codes[code]; ok {
+		c.total++
+		c.recent++
+	} else {
+		s.codes[code] = &codeCount{total: 1, recent: 1}
+		if class != 5 {
+			s.others++
+		}
+	}
+
+	if now.Sub(s.windowStart) >= statusCodeWindow {
+		s.compact()
+		s.newWindow(now)
+	} else if s.others > 2*maxStatusCodes {
+		s.compact()
+	}
+}
+
+// compact keeps the maxStatusCodes codes outside 5xx seen most in the
+// current window, breaking ties by their total, and adds the responses of
+// the others to the other bucket.
+func (s *statusCounts) compact() {
+	if s.others <= maxStatusCodes {
+		return
+	}
+
+	ranked := make([]int, 0, s.others)
+	for code := range s.codes {
+		if statusClass(code) != 5 {
+			ranked = append(ranked, code)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := s.codes[ranked[i]], s.codes[ranked[j]]
+		if a.recent != b.recent {
+			return a.recent > b.recent
+		}
+		if a.total != b.total {
+			return a.total > b.total
+		}
+		return ranked[i] < ranked[j]
+	})
+	for _, code := range ranked[maxStatusCodes:] {
+		s.other += s.codes[code].total
+		delete(s.codes, code)
+	}
+	s.others = maxStatusCodes
+}
+
+func (s *statusCounts) newWindow(now time.Time) {
+	for _, c := range s.codes {
+		c.recent = 0
+	}
+	s.windowStart = now
+}
+
+// codeCounts returns the exact codes kept, nil for a nil statusCounts.
+func (s *statusCounts) codeCounts() map[int]int64 {
+	if s == nil {
+		return nil
+	}
+	counts := make(map[int]int64, len(s.codes))
+	for code, c := range s.codes {
+		counts[code] = c.total
+	}
+	return counts
+}
+
+// otherCount returns the responses whose code codeCounts no longer lists,
+// zero for a nil statusCounts.
+func (s *statusCounts) otherCount() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.other
+}
+
+// classCounts returns the classes seen, nil for a nil statusCounts.
+func (s *statusCounts) classCounts() map[string]int64 {
+	if s == nil {
+		return nil
+	}
+	counts := make(map[string]int64)
+	for i, count := range s.classes {
+		if count > 0 {
+			counts[statusClasses[i]] = count
+		}
+	}
+	return counts
+}
+
+func statusClass(code int) int {
+	if code < 100 || code > 599 {
+		return 0
+	}
+	return code / 100
+}
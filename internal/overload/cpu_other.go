@@ -0,0 +1,13 @@
+//go:build !unix
+
+package overload
+
+import (
+	"errors"
+	"time"
+)
+
+// processCPUTime is only implemented on Unix systems.
+func processCPUTime() (time.Duration, error) {
+	return 0, errors.ErrUnsupported
+}
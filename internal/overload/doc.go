@@ -0,0 +1,25 @@
+// Package overload keeps the balancer itself from becoming the unstable
+// component by shedding low-priority traffic when its own CPU or memory use
+// runs high.
+//
+// A Guard samples the process every Interval. While CPU use (as a fraction
+// of GOMAXPROCS) or memory stays above its threshold, each sample sheds one
+// more priority class, starting with PriorityLow; PriorityHigh is never
+// shed. Once usage falls below 80% of the thresholds, classes are let back in
+// one sample at a time. Requests carry their class in a header, believed
+// only from trusted peers, and while anything is shed the Guard reports
+// itself degraded on its readiness handler.
+//
+// Usage:
+//
+//	guard := overload.NewGuard(overload.Options{
+//		Interval:       time.Second,
+//		CPUThreshold:   0.85,
+//		PriorityHeader: "X-Priority",
+//	}, logger)
+//	guard.Start(ctx)
+//
+//	if !guard.Admit(r, fromTrustedProxy(r)) {
+//		// respond 503
+//	}
+package overload
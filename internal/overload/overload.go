@@ -0,0 +1,266 @@
+package overload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low":
+		return PriorityLow, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %q", s)
+	}
+}
+
+// recoverRatio is the fraction of a threshold usage must fall below before
+// shed classes are admitted again, so the guard does not flap around it.
+const recoverRatio = 0.8
+
+type Options struct {
+	Interval time.Duration
+	// CPUThreshold is the fraction of GOMAXPROCS the process may keep busy;
+	// zero disables the CPU check.
+	CPUThreshold float64
+	// MemoryLimit is the number of bytes the Go runtime may hold from the
+	// operating system; zero disables the memory check.
+	MemoryLimit uint64
+	// PriorityHeader names the request header carrying "low", "normal" or
+	// "high". It is only believed on requests from a trusted peer, as any
+	// client could otherwise exempt itself from shedding. Other requests,
+	// and those without it or with another value, get DefaultPriority.
+	PriorityHeader  string
+	DefaultPriority Priority
+}
+
+// Usage is one sample of the process's resource use. CPU is the fraction of
+// GOMAXPROCS used since the previous sample.
+type Usage struct {
+	CPU       float64   `json:"cpu"`
+	Memory    uint64    `json:"memory_bytes"`
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// Status is what the readiness handler reports.
+type Status struct {
+	Status       string   `json:"status"`
+	Shedding     []string `json:"shedding,omitempty"`
+	CPU          float64  `json:"cpu"`
+	CPUThreshold float64  `json:"cpu_threshold,omitempty"`
+	Memory       uint64   `json:"memory_bytes"`
+	MemoryLimit  uint64   `json:"memory_limit_bytes,omitempty"`
+	Shed         uint64   `json:"shed_requests"`
+}
+
+type Guard struct {
+	opts   Options
+	logger *slog.Logger
+
+	// level is the number of priority classes being shed: requests with a
+	// priority below it are rejected.
+	level atomic.Int32
+	shed  atomic.Uint64
+
+	mutex    sync.Mutex
+	last     Usage
+	cpuTime  time.Duration
+	cpuStart time.Time
+}
+
+func NewGuard(opts Options, logger *slog.Logger) *Guard {
+	return &Guard{opts: opts, logger: logger}
+}
+
+func (g *Guard) Start(ctx context.Context) {
+	goroutines.Go("overload", func() { g.run(ctx) })
+}
+
+func (g *Guard) run(ctx context.Context) {
+	if err := g.Check(); errors.Is(err, errors.ErrUnsupported) && g.opts.MemoryLimit == 0 {
+		g.logger.Info("Overload protection needs CPU sampling, which is not supported on this platform")
+		return
+	}
+
+	ticker := time.NewTicker(g.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.Check(); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+				g.logger.Warn("Failed to sample process usage", slog.Any("err", err))
+			}
+		}
+	}
+}
+
+// Check samples the process and adjusts shedding. The first call only
+// establishes the CPU baseline. Memory is still checked when CPU sampling is
+// unsupported, in which case the error is errors.ErrUnsupported.
+func (g *Guard) Check() error {
+	now := time.Now()
+	usage := Usage{Memory: memoryInUse(), SampledAt: now}
+
+	cpuTime, err := processCPUTime()
+	if err == nil {
+		g.mutex.Lock()
+		if !g.cpuStart.IsZero() {
+			if wall := now.Sub(g.cpuStart); wall > 0 {
+				usage.CPU = float64(cpuTime-g.cpuTime) / (float64(wall) * float64(runtime.GOMAXPROCS(0)))
+			}
+		}
+		g.cpuTime, g.cpuStart = cpuTime, now
+		g.mutex.Unlock()
+	}
+
+	g.Update(usage)
+	return err
+}
+
+// Update adjusts shedding for usage: one more priority class is shed while
+// usage is over a threshold, one fewer once it is well below all of them.
+func (g *Guard) Update(usage Usage) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.last = usage
+
+	level := g.level.Load()
+	switch {
+	case g.over(usage, 1) && level < int32(PriorityHigh):
+		g.level.Store(level + 1)
+		g.logger.Warn("Balancer overloaded, shedding traffic",
+			slog.String("priority", Priority(level).String()),
+			slog.Float64("cpu", usage.CPU),
+			slog.Uint64("memory_bytes", usage.Memory))
+	case !g.over(usage, recoverRatio) && level > 0:
+		g.level.Store(level - 1)
+		g.logger.Info("Balancer load eased, admitting traffic again",
+			slog.String("priority", Priority(level-1).String()),
+			slog.Float64("cpu", usage.CPU),
+			slog.Uint64("memory_bytes", usage.Memory))
+	}
+}
+
+func (g *Guard) over(usage Usage, ratio float64) bool {
+	if g.opts.CPUThreshold > 0 && usage.CPU >= g.opts.CPUThreshold*ratio {
+		return true
+	}
+	return g.opts.MemoryLimit > 0 && float64(usage.Memory) >= float64(g.opts.MemoryLimit)*ratio
+}
+
+// Admit reports whether r may be served, counting it as shed if not. trusted
+// tells whether r came from a peer whose priority header is believed.
+func (g *Guard) Admit(r *http.Request, trusted bool) bool {
+	if g.Priority(r, trusted) >= Priority(g.level.Load()) {
+		return true
+	}
+	g.shed.Add(1)
+	return false
+}
+
+// Priority returns the priority class of r, read from the priority header
+// only when trusted.
+func (g *Guard) Priority(r *http.Request, trusted bool) Priority {
+	if trusted && g.opts.PriorityHeader != "" {
+		if p, err := ParsePriority(r.Header.Get(g.opts.PriorityHeader)); err == nil {
+			return p
+		}
+	}
+	return g.opts.DefaultPriority
+}
+
+// Degraded reports whether any traffic is being shed.
+func (g *Guard) Degraded() bool {
+	return g.level.Load() > 0
+}
+
+func (g *Guard) Status() Status {
+	g.mutex.Lock()
+	usage := g.last
+	g.mutex.Unlock()
+
+	status := Status{
+		Status:       "ready",
+		CPU:          usage.CPU,
+		CPUThreshold: g.opts.CPUThreshold,
+		Memory:       usage.Memory,
+		MemoryLimit:  g.opts.MemoryLimit,
+		Shed:         g.shed.Load(),
+	}
+	for p := Priority(0); p < Priority(g.level.Load()); p++ {
+		status.Status = "degraded"
+		status.Shedding = append(status.Shedding, p.String())
+	}
+	return status
+}
+
+// ReadyHandler serves the guard's status, with 503 while it is degraded so
+// upstream load balancers send less traffic to this instance.
+func (g *Guard) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := g.Status()
+		code := http.StatusOK
+		if status.Status != "ready" {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+var memorySamples = []metrics.Sample{
+	{Name: "/memory/classes/total:bytes"},
+	{Name: "/memory/classes/heap/released:bytes"},
+}
+
+// memoryInUse returns the memory the Go runtime has mapped and not returned
+// to the operating system, which tracks the process's resident size.
+func memoryInUse() uint64 {
+	samples := make([]metrics.Sample, len(memorySamples))
+	copy(samples, memorySamples)
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
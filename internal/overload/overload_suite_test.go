@@ -0,0 +1,13 @@
+package overload_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOverload(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Overload Suite")
+}
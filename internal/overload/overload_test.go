@@ -0,0 +1,122 @@
+package overload_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/overload"
+)
+
+var _ = Describe("Guard", func() {
+	var guard *overload.Guard
+
+	request := func(priority string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if priority != "" {
+			r.Header.Set("X-Priority", priority)
+		}
+		return r
+	}
+
+	admitted := func() []bool {
+		return []bool{guard.Admit(request("low"), true), guard.Admit(request("normal"), true), guard.Admit(request("high"), true)}
+	}
+
+	BeforeEach(func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		guard = overload.NewGuard(overload.Options{
+			CPUThreshold:    0.8,
+			MemoryLimit:     1000,
+			PriorityHeader:  "X-Priority",
+			DefaultPriority: overload.PriorityNormal,
+		}, log)
+	})
+
+	It("should admit everything below the thresholds", func() {
+		guard.Update(overload.Usage{CPU: 0.5, Memory: 500})
+		Expect(admitted()).To(Equal([]bool{true, true, true}))
+		Expect(guard.Degraded()).To(BeFalse())
+	})
+
+	It("should shed one more class per overloaded sample but never high priority", func() {
+		guard.Update(overload.Usage{CPU: 0.9})
+		Expect(admitted()).To(Equal([]bool{false, true, true}))
+
+		guard.Update(overload.Usage{CPU: 0.9})
+		Expect(admitted()).To(Equal([]bool{false, false, true}))
+
+		guard.Update(overload.Usage{CPU: 0.9})
+		Expect(admitted()).To(Equal([]bool{false, false, true}))
+		Expect(guard.Status().Shed).To(Equal(uint64(5)))
+	})
+
+	It("should shed on memory alone", func() {
+		guard.Update(overload.Usage{CPU: 0.1, Memory: 1000})
+		Expect(admitted()).To(Equal([]bool{false, true, true}))
+	})
+
+	It("should only recover once usage is well below the thresholds", func() {
+		guard.Update(overload.Usage{CPU: 0.9})
+		guard.Update(overload.Usage{CPU: 0.9})
+
+		guard.Update(overload.Usage{CPU: 0.7})
+		Expect(admitted()).To(Equal([]bool{false, false, true}))
+
+		guard.Update(overload.Usage{CPU: 0.5})
+		Expect(admitted()).To(Equal([]bool{false, true, true}))
+
+		guard.Update(overload.Usage{CPU: 0.5})
+		Expect(admitted()).To(Equal([]bool{true, true, true}))
+	})
+
+	It("should use the default priority for requests without a valid header", func() {
+		guard.Update(overload.Usage{CPU: 0.9})
+		Expect(guard.Admit(request(""), true)).To(BeTrue())
+		Expect(guard.Admit(request("urgent"), true)).To(BeTrue())
+		Expect(guard.Priority(request("HIGH"), true)).To(Equal(overload.PriorityHigh))
+	})
+
+	It("should ignore the priority header from untrusted peers", func() {
+		guard.Update(overload.Usage{CPU: 0.9})
+		guard.Update(overload.Usage{CPU: 0.9})
+		Expect(guard.Priority(request("high"), false)).To(Equal(overload.PriorityNormal))
+		Expect(guard.Admit(request("high"), false)).To(BeFalse())
+	})
+
+	Describe("ReadyHandler", func() {
+		ready := func() (int, overload.Status) {
+			w := httptest.NewRecorder()
+			guard.ReadyHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			var status overload.Status
+			Expect(json.Unmarshal(w.Body.Bytes(), &status)).To(Succeed())
+			return w.Code, status
+		}
+
+		It("should report ready while nothing is shed", func() {
+			code, status := ready()
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(status.Status).To(Equal("ready"))
+		})
+
+		It("should report degraded with the shed classes while shedding", func() {
+			guard.Update(overload.Usage{CPU: 0.95, Memory: 200})
+			code, status := ready()
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(status.Status).To(Equal("degraded"))
+			Expect(status.Shedding).To(Equal([]string{"low"}))
+			Expect(status.CPU).To(Equal(0.95))
+		})
+	})
+
+	It("should sample the process", func() {
+		Expect(guard.Check()).To(Succeed())
+		Expect(guard.Check()).To(Succeed())
+		Expect(guard.Status().Memory).To(BeNumerically(">", 0))
+	})
+})
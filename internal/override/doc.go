@@ -0,0 +1,21 @@
+// Package override applies operator overrides from a file to backends, for
+// environments where the admin API is not available but files can be written.
+//
+// The file (YAML or JSON, chosen by extension) lists backends by URL or name
+// and can force their health and set their weight:
+//
+//	backends:
+//	  - url: "http://10.0.0.5:8080"
+//	    health: "down"   # "up", "down", or omitted to follow health checks
+//	  - name: "checkout"
+//	    weight: 5        # omitted or 0 restores the configured weight
+//
+// A Watcher polls the file for changes. Removing the file clears all
+// overrides; a file that fails to parse is ignored and the previous overrides
+// stay in effect.
+//
+// Usage:
+//
+//	w := override.NewWatcher("/etc/lb/overrides.yaml", pool, 5*time.Second, logger)
+//	w.Start(ctx)
+package override
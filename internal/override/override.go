@@ -0,0 +1,238 @@
+package override
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/spf13/viper"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// Entry selects a backend by Name if set, otherwise by URL.
+type Entry struct {
+	Name   string `mapstructure:"name"`
+	URL    string `mapstructure:"url"`
+	Health string `mapstructure:"health"`
+	Weight int    `mapstructure:"weight"`
+}
+
+type File struct {
+	Backends []Entry `mapstructure:"backends"`
+}
+
+// Load reads and validates an overrides file.
+func Load(path string) (*File, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var f File
+	if err := v.Unmarshal(&f); err != nil {
+		return nil, err
+	}
+
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+func (f *File) Validate() error {
+	return validation.ValidateStruct(f,
+		validation.Field(&f.Backends, validation.Each(validation.By(func(value interface{}) error {
+			e, ok := value.(Entry)
+			if !ok {
+				return validation.NewError("validation_invalid_type", "must be an Entry")
+			}
+			return validation.ValidateStruct(&e,
+				validation.Field(&e.URL, validation.When(e.Name == "", validation.Required)),
+				validation.Field(&e.Health, validation.In(HealthUp, HealthDown)),
+				validation.Field(&e.Weight, validation.Min(0)),
+			)
+		}))),
+	)
+}
+
+type Watcher struct {
+	path     string
+	pool     *backend.Pool
+	interval time.Duration
+	logger   *slog.Logger
+
+	mutex    sync.Mutex
+	modTime  time.Time
+	size     int64
+	present  bool
+	file     *File
+	applied  []*backend.Backend
+	weighted map[*backend.Backend]bool
+}
+
+// NewWatcher applies the overrides in the file at path to the backends in
+// pool, including those that join it later.
+func NewWatcher(path string, pool *backend.Pool, interval time.Duration, logger *slog.Logger) *Watcher {
+	return &Watcher{
+		path:     path,
+		pool:     pool,
+		interval: interval,
+		logger:   logger,
+		weighted: make(map[*backend.Backend]bool),
+	}
+}
+
+func (w *Watcher) Start(ctx context.Context) {
+	goroutines.Go("overrides", func() { w.run(ctx) })
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	w.check()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+func (w *Watcher) check() {
+	if err := w.Check(); err != nil {
+		w.logger.Error("Ignoring invalid overrides file",
+			slog.String("file", w.path),
+			slog.Any("error", err))
+	}
+}
+
+// Forget drops whether the overrides changed b's weight, for backends that
+// left the pool.
+func (w *Watcher) Forget(b *backend.Backend) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.weighted, b)
+}
+
+// Check reloads the file if it changed since the last call, and applies it
+// again to the pool if backends joined or left it. An invalid file is
+// reported and leaves the current overrides in place.
+func (w *Watcher) Check() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	info, err := os.Stat(w.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if w.present {
+			w.present = false
+			w.logger.Info("Overrides file removed, clearing overrides", slog.String("file", w.path))
+			w.apply(&File{}, true)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.present && info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		if w.file != nil && !slices.Equal(w.applied, w.pool.Backends()) {
+			w.apply(w.file, false)
+		}
+		return nil
+	}
+
+	// Record the version even if it is invalid so it is reported only once.
+	w.present = true
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+
+	f, err := Load(w.path)
+	if err != nil {
+		return err
+	}
+
+	w.logger.Info("Applying overrides file",
+		slog.String("file", w.path),
+		slog.Int("entries", len(f.Backends)))
+	w.apply(f, true)
+	return nil
+}
+
+// apply sets the overrides of f on the backends in the pool, warning about
+// entries matching none of them when report is set.
+func (w *Watcher) apply(f *File, report bool) {
+	w.file = f
+	w.applied = w.pool.Backends()
+
+	entries := make(map[string]Entry, len(f.Backends))
+	for _, e := range f.Backends {
+		key := e.Name
+		if key == "" {
+			key = e.URL
+			if normalized, err := config.NormalizeURL(e.URL); err == nil {
+				key = normalized
+			}
+		}
+		entries[key] = e
+	}
+
+	matched := make(map[string]bool)
+	for _, b := range w.applied {
+		var e Entry
+		for _, key := range []string{b.Name(), b.URL().String(), b.Origin()} {
+			if entry, ok := entries[key]; ok {
+				e = entry
+				matched[key] = true
+				break
+			}
+		}
+
+		health := backend.OverrideNone
+		switch e.Health {
+		case HealthUp:
+			health = backend.OverrideHealthy
+		case HealthDown:
+			health = backend.OverrideUnhealthy
+		}
+		if b.SetHealthOverride(health) {
+			w.logger.Info("Backend health override changed",
+				slog.String("backend", b.URL().String()),
+				slog.String("override", health.String()))
+		}
+
+		switch {
+		case e.Weight > 0:
+			b.HoldWeight(backend.OwnerOverride, e.Weight)
+			w.weighted[b] = true
+		case w.weighted[b]:
+			b.ReleaseWeight(backend.OwnerOverride)
+			delete(w.weighted, b)
+		}
+	}
+
+	for key := range entries {
+		if report && !matched[key] {
+			w.logger.Warn("Override for unknown backend", slog.String("backend", key))
+		}
+	}
+}
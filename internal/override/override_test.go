@@ -0,0 +1,139 @@
+package override_test
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/override"
+)
+
+var _ = Describe("Watcher", func() {
+	var (
+		path     string
+		b1, b2   *backend.Backend
+		pool     *backend.Pool
+		watcher  *override.Watcher
+		modified time.Time
+	)
+
+	newBackend := func(raw string) *backend.Backend {
+		u, err := url.Parse(raw)
+		Expect(err).NotTo(HaveOccurred())
+		b := backend.New(u, 2)
+		b.SetHealthy(true)
+		return b
+	}
+
+	// write bumps the modification time explicitly so consecutive writes
+	// within the filesystem's timestamp resolution are still detected.
+	write := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		modified = modified.Add(time.Second)
+		Expect(os.Chtimes(path, modified, modified)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "overrides.yaml")
+		modified = time.Now()
+		b1 = newBackend("http://10.0.0.1:8080")
+		b2 = newBackend("http://10.0.0.2:8080")
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		pool = backend.NewPool([]*backend.Backend{b1, b2})
+		watcher = override.NewWatcher(path, pool, time.Second, log)
+	})
+
+	It("should do nothing without a file", func() {
+		Expect(watcher.Check()).To(Succeed())
+		Expect(b1.HealthOverride()).To(Equal(backend.OverrideNone))
+	})
+
+	It("should force health and set weights", func() {
+		write(`
+backends:
+  - url: "http://10.0.0.1:8080"
+    health: "down"
+  - url: "http://10.0.0.2:8080"
+    weight: 7
+`)
+		Expect(watcher.Check()).To(Succeed())
+
+		Expect(b1.IsHealthy()).To(BeFalse())
+		Expect(b1.IsAvailable()).To(BeFalse())
+		Expect(b2.BaseWeight()).To(Equal(7))
+		Expect(b1.WeightHolders()).To(BeZero())
+		Expect(b2.WeightHolders()).To(Equal(backend.OwnerOverride))
+	})
+
+	It("should match entries written in a different URL form", func() {
+		write(`{"backends": [{"url": "HTTP://10.0.0.2:8080/", "weight": 4}]}`)
+		Expect(watcher.Check()).To(Succeed())
+
+		Expect(b2.BaseWeight()).To(Equal(4))
+	})
+
+	It("should keep a forced health state across health checks", func() {
+		b1.SetHealthy(false)
+		write(`{"backends": [{"url": "http://10.0.0.1:8080", "health": "up"}]}`)
+		Expect(watcher.Check()).To(Succeed())
+
+		Expect(b1.IsHealthy()).To(BeTrue())
+		b1.SetHealthy(false)
+		Expect(b1.IsHealthy()).To(BeTrue())
+	})
+
+	It("should revert entries that are removed", func() {
+		write(`
+backends:
+  - url: "http://10.0.0.1:8080"
+    health: "down"
+    weight: 9
+`)
+		Expect(watcher.Check()).To(Succeed())
+
+		write(`backends: []`)
+		Expect(watcher.Check()).To(Succeed())
+
+		Expect(b1.HealthOverride()).To(Equal(backend.OverrideNone))
+		Expect(b1.IsHealthy()).To(BeTrue())
+		Expect(b1.BaseWeight()).To(Equal(2))
+		Expect(b1.WeightHolders()).To(BeZero())
+	})
+
+	It("should apply the file to backends that join the pool", func() {
+		write(`{"backends": [{"url": "http://10.0.0.3:8080", "health": "down", "weight": 5}]}`)
+		Expect(watcher.Check()).To(Succeed())
+
+		b3 := newBackend("http://10.0.0.3:8080")
+		pool.Add(b3)
+		Expect(watcher.Check()).To(Succeed())
+		Expect(b3.IsHealthy()).To(BeFalse())
+		Expect(b3.BaseWeight()).To(Equal(5))
+	})
+
+	It("should clear overrides when the file is deleted", func() {
+		write(`{"backends": [{"url": "http://10.0.0.2:8080", "health": "down"}]}`)
+		Expect(watcher.Check()).To(Succeed())
+		Expect(b2.IsHealthy()).To(BeFalse())
+
+		Expect(os.Remove(path)).To(Succeed())
+		Expect(watcher.Check()).To(Succeed())
+		Expect(b2.IsHealthy()).To(BeTrue())
+	})
+
+	It("should keep the previous overrides when the file is invalid", func() {
+		write(`{"backends": [{"url": "http://10.0.0.2:8080", "health": "down"}]}`)
+		Expect(watcher.Check()).To(Succeed())
+
+		write(`{"backends": [{"url": "http://10.0.0.2:8080", "health": "sideways"}]}`)
+		Expect(watcher.Check()).NotTo(Succeed())
+		Expect(b2.IsHealthy()).To(BeFalse())
+	})
+})
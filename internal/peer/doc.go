@@ -0,0 +1,16 @@
+// Package peer coordinates the consistent hash ring between load balancer
+// instances, so session affinity holds when clients reach different replicas.
+//
+// The ring layout is deterministic for a given set of backends, but each
+// instance only puts the backends it sees healthy on it; a backend flapping
+// on one replica would send that replica's clients elsewhere. Instead, each
+// instance serves its health view at /peers/view and a Coordinator polls the
+// configured peers. A backend is on the shared ring when a majority of the
+// views that could be fetched see it healthy. Peers that cannot be reached do
+// not vote.
+//
+// Usage:
+//
+//	c := peer.NewCoordinator("lb1", []string{"http://10.0.0.2:8080"}, pool, ring, 5*time.Second, logger)
+//	c.Start(ctx)
+package peer
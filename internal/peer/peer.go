@@ -0,0 +1,221 @@
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// ViewPath is where every instance serves its view.
+const ViewPath = "/peers/view"
+
+// View is one instance's health view, keyed by backend name.
+type View struct {
+	Instance string          `json:"instance"`
+	Backends map[string]bool `json:"backends"`
+}
+
+// LocalView returns the health this instance currently sees for backends.
+func LocalView(instance string, backends []*backend.Backend) View {
+	v := View{Instance: instance, Backends: make(map[string]bool, len(backends))}
+	for _, b := range backends {
+		v.Backends[b.Name()] = b.IsHealthy()
+	}
+	return v
+}
+
+// Handler serves the local view of the backends in pool to peers.
+func Handler(instance string, pool *backend.Pool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LocalView(instance, pool.Backends()))
+	})
+}
+
+// Members returns, in configuration order, the backends that a majority of
+// the views reporting them see healthy.
+func Members(backends []*backend.Backend, views []View) []*backend.Backend {
+	members := make([]*backend.Backend, 0, len(backends))
+	for _, b := range backends {
+		var votes, healthy int
+		for _, v := range views {
+			if up, ok := v.Backends[b.Name()]; ok {
+				votes++
+				if up {
+					healthy++
+				}
+			}
+		}
+
+		if healthy*2 > votes {
+			members = append(members, b)
+		}
+	}
+	return members
+}
+
+type Coordinator struct {
+	instance string
+	peers    []string
+	pool     *backend.Pool
+	ring     strategy.Rebuilder
+	interval time.Duration
+	client   *http.Client
+	logger   *slog.Logger
+
+	mutex   sync.Mutex
+	members []*backend.Backend
+	synced  bool
+}
+
+// NewCoordinator creates a coordinator for the given peer base URLs, e.g.
+// "http://10.0.0.2:8080"; ViewPath is appended to each. The ring is built
+// from the backends in pool.
+func NewCoordinator(instance string, peers []string, pool *backend.Pool, ring strategy.Rebuilder, interval time.Duration, logger *slog.Logger) *Coordinator {
+	return &Coordinator{
+		instance: instance,
+		peers:    peers,
+		pool:     pool,
+		ring:     ring,
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+		logger:   logger,
+	}
+}
+
+func (c *Coordinator) Start(ctx context.Context) {
+	goroutines.Go("peers", func() { c.run(ctx) })
+}
+
+func (c *Coordinator) run(ctx context.Context) {
+	c.Sync(ctx)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Sync(ctx)
+		}
+	}
+}
+
+// Sync fetches the peers' views, combines them with the local one and
+// rebuilds the ring if the agreed membership changed. It returns the members.
+func (c *Coordinator) Sync(ctx context.Context) []*backend.Backend {
+	backends := c.pool.Backends()
+	views := append(c.fetchViews(ctx), LocalView(c.instance, backends))
+	members := Members(backends, views)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.synced && sameMembers(members, c.members) {
+		return members
+	}
+
+	c.ring.Rebuild(members)
+	c.members = members
+	c.synced = true
+
+	names := make([]string, len(members))
+	for i, b := range members {
+		names[i] = b.Name()
+	}
+	c.logger.Info("Shared hash ring updated",
+		slog.Int("views", len(views)),
+		slog.String("members", strings.Join(names, ",")))
+
+	return members
+}
+
+// Adopt takes members, such as a ring imported from another instance, as
+// the membership last agreed on. The ring is then only rebuilt once the
+// views agree on a different one, instead of on the first sync.
+func (c *Coordinator) Adopt(members []*backend.Backend) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.members = slices.Clone(members)
+	c.synced = true
+}
+
+// sameMembers reports whether a and b hold the same backends in any order.
+func sameMembers(a, b []*backend.Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, m := range a {
+		if !slices.Contains(b, m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Coordinator) fetchViews(ctx context.Context) []View {
+	views := make([]View, len(c.peers))
+	ok := make([]bool, len(c.peers))
+
+	var wg sync.WaitGroup
+	for i, addr := range c.peers {
+		wg.Add(1)
+		if !goroutines.Go("peers", func() {
+			defer wg.Done()
+			v, err := c.fetch(ctx, addr)
+			if err != nil {
+				c.logger.Warn("Failed to fetch peer view",
+					slog.String("peer", addr),
+					slog.Any("error", err))
+				return
+			}
+			views[i], ok[i] = v, true
+		}) {
+			wg.Done()
+			c.logger.Warn("Peer view fetch not started, too many peer goroutines", slog.String("peer", addr))
+		}
+	}
+	wg.Wait()
+
+	fetched := make([]View, 0, len(views))
+	for i, v := range views {
+		if ok[i] {
+			fetched = append(fetched, v)
+		}
+	}
+	return fetched
+}
+
+func (c *Coordinator) fetch(ctx context.Context, addr string) (View, error) {
+	var v View
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+ViewPath, nil)
+	if err != nil {
+		return v, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return v, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return v, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&v)
+	return v, err
+}
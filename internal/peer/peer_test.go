@@ -0,0 +1,191 @@
+package peer_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/peer"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+type recordingRing struct {
+	builds [][]*backend.Backend
+}
+
+func (r *recordingRing) Rebuild(backends []*backend.Backend) {
+	r.builds = append(r.builds, backends)
+}
+
+var _ = Describe("Peer", func() {
+	var (
+		backends []*backend.Backend
+		log      *slog.Logger
+	)
+
+	newBackend := func(raw string) *backend.Backend {
+		u, err := url.Parse(raw)
+		Expect(err).NotTo(HaveOccurred())
+		b := backend.New(u, 1)
+		b.SetHealthy(true)
+		return b
+	}
+
+	peerServer := func(view peer.View) *httptest.Server {
+		mux := http.NewServeMux()
+		mux.HandleFunc(peer.ViewPath, func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(view)
+		})
+		return httptest.NewServer(mux)
+	}
+
+	BeforeEach(func() {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+		backends = []*backend.Backend{
+			newBackend("http://localhost:8081"),
+			newBackend("http://localhost:8082"),
+			newBackend("http://localhost:8083"),
+		}
+	})
+
+	Describe("Members", func() {
+		It("should keep backends a majority of views see healthy", func() {
+			views := []peer.View{
+				{Backends: map[string]bool{"http://localhost:8081": true, "http://localhost:8082": false, "http://localhost:8083": true}},
+				{Backends: map[string]bool{"http://localhost:8081": true, "http://localhost:8082": false, "http://localhost:8083": false}},
+				{Backends: map[string]bool{"http://localhost:8081": true, "http://localhost:8082": true, "http://localhost:8083": true}},
+			}
+
+			Expect(peer.Members(backends, views)).To(Equal([]*backend.Backend{backends[0], backends[2]}))
+		})
+
+		It("should drop a backend on a tie", func() {
+			views := []peer.View{
+				{Backends: map[string]bool{"http://localhost:8081": true}},
+				{Backends: map[string]bool{"http://localhost:8081": false}},
+			}
+
+			Expect(peer.Members(backends, views)).To(BeEmpty())
+		})
+	})
+
+	Describe("Handler", func() {
+		It("should serve the local view", func() {
+			backends[1].SetHealthy(false)
+
+			w := httptest.NewRecorder()
+			peer.Handler("lb1", backend.NewPool(backends)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, peer.ViewPath, nil))
+
+			var view peer.View
+			Expect(json.NewDecoder(w.Body).Decode(&view)).To(Succeed())
+			Expect(view.Instance).To(Equal("lb1"))
+			Expect(view.Backends).To(Equal(map[string]bool{
+				"http://localhost:8081": true,
+				"http://localhost:8082": false,
+				"http://localhost:8083": true,
+			}))
+		})
+	})
+
+	Describe("Coordinator", func() {
+		It("should rebuild the ring only when the agreed membership changes", func() {
+			server := peerServer(peer.View{Instance: "lb2", Backends: map[string]bool{
+				"http://localhost:8081": true,
+				"http://localhost:8082": true,
+				"http://localhost:8083": true,
+			}})
+			defer server.Close()
+
+			ring := &recordingRing{}
+			c := peer.NewCoordinator("lb1", []string{server.URL}, backend.NewPool(backends), ring, time.Second, log)
+
+			Expect(c.Sync(context.Background())).To(HaveLen(3))
+			Expect(c.Sync(context.Background())).To(HaveLen(3))
+			Expect(ring.builds).To(HaveLen(1))
+
+			backends[1].SetHealthy(false)
+			Expect(c.Sync(context.Background())).To(Equal([]*backend.Backend{backends[0], backends[2]}))
+			Expect(ring.builds).To(HaveLen(2))
+		})
+
+		It("should keep an adopted ring until the agreed membership changes", func() {
+			ring := &recordingRing{}
+			c := peer.NewCoordinator("lb1", nil, backend.NewPool(backends), ring, time.Second, log)
+			c.Adopt([]*backend.Backend{backends[2], backends[1], backends[0]})
+
+			Expect(c.Sync(context.Background())).To(HaveLen(3))
+			Expect(ring.builds).To(BeEmpty())
+
+			backends[1].SetHealthy(false)
+			c.Sync(context.Background())
+			Expect(ring.builds).To(Equal([][]*backend.Backend{{backends[0], backends[2]}}))
+		})
+
+		It("should ignore unreachable peers", func() {
+			ring := &recordingRing{}
+			c := peer.NewCoordinator("lb1", []string{"http://127.0.0.1:1"}, backend.NewPool(backends), ring, time.Second, log)
+
+			Expect(c.Sync(context.Background())).To(HaveLen(3))
+		})
+
+		It("should sync on the local view when fetches cannot be started", func() {
+			goroutines.SetLimit("peers", 1)
+			release, ok := goroutines.Acquire("peers")
+			Expect(ok).To(BeTrue())
+			DeferCleanup(func() {
+				release()
+				goroutines.SetLimit("peers", 0)
+			})
+
+			ring := &recordingRing{}
+			c := peer.NewCoordinator("lb1", []string{"http://127.0.0.1:1"}, backend.NewPool(backends), ring, time.Second, log)
+
+			done := make(chan []*backend.Backend)
+			go func() { done <- c.Sync(context.Background()) }()
+			Eventually(done).Should(Receive(HaveLen(3)))
+		})
+
+		It("should realign a ring built while a backend was down", func() {
+			other := []*backend.Backend{
+				newBackend("http://localhost:8081"),
+				newBackend("http://localhost:8082"),
+				newBackend("http://localhost:8083"),
+			}
+
+			strat1 := strategy.NewConsistentHashStrategy(100)
+			strat2 := strategy.NewConsistentHashStrategy(100)
+			// lb2 served its first request while 8082 was down, so its
+			// lazily built ring lacks 8082 even after it recovers.
+			strat2.SelectBackend(strategy.SelectionContext{ClientIP: "warmup"}, []*backend.Backend{other[0], other[2]})
+
+			lb1 := httptest.NewServer(peer.Handler("lb1", backend.NewPool(backends)))
+			defer lb1.Close()
+			lb2 := httptest.NewServer(peer.Handler("lb2", backend.NewPool(other)))
+			defer lb2.Close()
+
+			peer.NewCoordinator("lb1", []string{lb2.URL}, backend.NewPool(backends), strat1.(strategy.Rebuilder), time.Second, log).Sync(context.Background())
+			peer.NewCoordinator("lb2", []string{lb1.URL}, backend.NewPool(other), strat2.(strategy.Rebuilder), time.Second, log).Sync(context.Background())
+
+			seen := make(map[string]bool)
+			for i := range 50 {
+				ctx := strategy.SelectionContext{ClientIP: "client-" + strconv.Itoa(i)}
+
+				chosen := strat1.SelectBackend(ctx, backends).URL()
+				Expect(strat2.SelectBackend(ctx, other).URL()).To(Equal(chosen))
+				seen[chosen.String()] = true
+			}
+			Expect(seen).To(HaveKey("http://localhost:8082"))
+		})
+	})
+})
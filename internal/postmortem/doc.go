@@ -0,0 +1,20 @@
+// Package postmortem saves what the balancer knew when it went down, so an
+// incident that kills the process still leaves something to investigate.
+//
+// A Dump holds the final metrics snapshot, the backend and circuit breaker
+// state, the last metrics events and the stacks of every goroutine. The
+// balancer writes one when it is sent SIGQUIT, when a goroutine it started
+// panics and when a listener fails. Each source gets a few seconds to answer,
+// since a crash can leave a lock held; the parts that do not make it are
+// listed in Missing rather than hanging the dying process.
+//
+// Usage:
+//
+//	w := postmortem.NewWriter("/var/lib/lb", postmortem.Sources{
+//		Metrics: func() metrics.Snapshot { return collector.Snapshot("round-robin") },
+//		State:   stateManager.Export,
+//		Events:  collector.RecentEvents,
+//	}, logger)
+//
+//	path, err := w.Write("SIGQUIT")
+package postmortem
@@ -0,0 +1,171 @@
+package postmortem
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/state"
+)
+
+// sourceTimeout bounds how long a dump waits for each source. A crash can
+// leave a lock held that a source needs, and a dump that never finishes would
+// keep the process from dying.
+const sourceTimeout = 2 * time.Second
+
+// Dump is what the balancer knew when it went down. Missing lists the parts
+// that could not be collected in time.
+type Dump struct {
+	Reason     string           `json:"reason"`
+	Time       time.Time        `json:"time"`
+	Metrics    metrics.Snapshot `json:"metrics"`
+	State      state.Snapshot   `json:"state"`
+	Events     []Event          `json:"events"`
+	Goroutines string           `json:"goroutines"`
+	Missing    []string         `json:"missing,omitempty"`
+}
+
+// Event is a metrics event as recorded in a Dump. Healthy is only set for
+// health changes.
+type Event struct {
+	Time       time.Time     `json:"time"`
+	Type       string        `json:"type"`
+	Backend    string        `json:"backend,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Healthy    *bool         `json:"healthy,omitempty"`
+	State      string        `json:"state,omitempty"`
+	Endpoint   string        `json:"endpoint,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+	Rule       string        `json:"rule,omitempty"`
+	Class      string        `json:"class,omitempty"`
+}
+
+// Sources supply the parts of a dump.
+type Sources struct {
+	Metrics func() metrics.Snapshot
+	State   func() state.Snapshot
+	Events  func() []metrics.MetricEvent
+}
+
+type Writer struct {
+	dir     string
+	sources Sources
+	logger  *slog.Logger
+}
+
+// NewWriter returns a Writer saving dumps to dir.
+func NewWriter(dir string, sources Sources, logger *slog.Logger) *Writer {
+	return &Writer{dir: dir, sources: sources, logger: logger}
+}
+
+// Collect gathers a dump, leaving out the parts whose source does not answer
+// within a few seconds.
+func (w *Writer) Collect(reason string) Dump {
+	dump := Dump{Reason: reason, Time: time.Now(), Goroutines: stacks()}
+
+	if snap, ok := within(w.sources.Metrics); ok {
+		dump.Metrics = snap
+	} else {
+		dump.Missing = append(dump.Missing, "metrics")
+	}
+	if snap, ok := within(w.sources.State); ok {
+		dump.State = snap
+	} else {
+		dump.Missing = append(dump.Missing, "state")
+	}
+	if events, ok := within(w.sources.Events); ok {
+		dump.Events = make([]Event, 0, len(events))
+		for _, e := range events {
+			dump.Events = append(dump.Events, event(e))
+		}
+	} else {
+		dump.Missing = append(dump.Missing, "events")
+	}
+
+	return dump
+}
+
+// Write collects a dump and saves it as postmortem-<time>.json in the
+// writer's directory, returning its path. The file only appears once it is
+// complete.
+func (w *Writer) Write(reason string) (string, error) {
+	dump := w.Collect(reason)
+	path := filepath.Join(w.dir, "postmortem-"+dump.Time.UTC().Format("20060102T150405.000Z")+".json")
+
+	f, err := os.CreateTemp(w.dir, ".postmortem-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dump); err != nil {
+		f.Close()
+		return "", fmt.Errorf("writing post-mortem dump: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+
+	w.logger.Error("Wrote post-mortem dump", slog.String("reason", reason), slog.String("file", path))
+	return path, nil
+}
+
+// within returns what fn returns, or false if fn is nil or does not return
+// within sourceTimeout.
+func within[T any](fn func() T) (T, bool) {
+	var zero T
+	if fn == nil {
+		return zero, false
+	}
+
+	done := make(chan T, 1)
+	go func() { done <- fn() }()
+	select {
+	case v := <-done:
+		return v, true
+	case <-time.After(sourceTimeout):
+		return zero, false
+	}
+}
+
+func stacks() string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func event(e metrics.MetricEvent) Event {
+	out := Event{
+		Time:       e.Timestamp,
+		Type:       string(e.Type),
+		Backend:    e.Backend,
+		Duration:   e.Duration,
+		StatusCode: e.StatusCode,
+		State:      e.State,
+		Endpoint:   e.Endpoint,
+		Reason:     e.Reason,
+		Rule:       e.Rule,
+		Class:      e.Class,
+	}
+	if e.Type == metrics.EventHealthChanged {
+		healthy := e.Healthy
+		out.Healthy = &healthy
+	}
+	return out
+}
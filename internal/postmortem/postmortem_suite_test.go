@@ -0,0 +1,13 @@
+package postmortem_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPostmortem(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Postmortem Suite")
+}
@@ -0,0 +1,90 @@
+package postmortem_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/postmortem"
+	"github.com/angeloszaimis/load-balancer/internal/state"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		dir     string
+		sources postmortem.Sources
+		logger  *slog.Logger
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		sources = postmortem.Sources{
+			Metrics: func() metrics.Snapshot { return metrics.Snapshot{TotalRequests: 42} },
+			State: func() state.Snapshot {
+				return state.Snapshot{
+					Version:  state.Version,
+					Breakers: map[string]state.Breaker{"api-1": {State: "open", Failures: 5}},
+				}
+			},
+			Events: func() []metrics.MetricEvent {
+				return []metrics.MetricEvent{
+					{Type: metrics.EventBackendFailure, Backend: "api-1", Reason: "dial"},
+					{Type: metrics.EventHealthChanged, Backend: "api-1", Healthy: false},
+				}
+			},
+		}
+	})
+
+	It("should save the metrics, state, recent events and goroutines to a timestamped file", func() {
+		path, err := postmortem.NewWriter(dir, sources, logger).Write("SIGQUIT")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Base(path)).To(MatchRegexp(`^postmortem-\d{8}T\d{6}\.\d{3}Z\.json$`))
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		var dump postmortem.Dump
+		Expect(json.Unmarshal(data, &dump)).To(Succeed())
+
+		Expect(dump.Reason).To(Equal("SIGQUIT"))
+		Expect(dump.Metrics.TotalRequests).To(Equal(int64(42)))
+		Expect(dump.State.Breakers).To(HaveKeyWithValue("api-1", state.Breaker{State: "open", Failures: 5}))
+		Expect(dump.Events).To(HaveLen(2))
+		Expect(dump.Events[0].Type).To(Equal("backend_failure"))
+		Expect(dump.Events[0].Reason).To(Equal("dial"))
+		Expect(*dump.Events[1].Healthy).To(BeFalse())
+		Expect(dump.Goroutines).To(ContainSubstring("goroutine"))
+		Expect(dump.Missing).To(BeEmpty())
+
+		entries, _ := os.ReadDir(dir)
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("should leave out sources that do not answer", func() {
+		block := make(chan struct{})
+		defer close(block)
+		sources.Metrics = func() metrics.Snapshot {
+			<-block
+			return metrics.Snapshot{}
+		}
+		sources.Events = nil
+
+		start := time.Now()
+		dump := postmortem.NewWriter(dir, sources, logger).Collect("panic")
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		Expect(dump.Missing).To(Equal([]string{"metrics", "events"}))
+		Expect(dump.State.Breakers).To(HaveKey("api-1"))
+	})
+
+	It("should fail when the directory cannot be written", func() {
+		_, err := postmortem.NewWriter(filepath.Join(dir, "missing"), sources, logger).Write("fatal")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,17 @@
+// Package preflight checks the backends before the load balancer starts
+// listening, so a misconfiguration fails the start with an explanation
+// instead of every request getting a 503.
+//
+// Run fails when no backend host resolves, or when RequireHealthy is set and
+// no backend passes its health check. Individual unresolvable or
+// unhealthy backends, and backends that end up at the same address (e.g. two
+// host names expanded to one IP), are only logged.
+//
+// Usage:
+//
+//	err := preflight.Run(ctx, backends, preflight.Options{
+//		Resolver:       net.DefaultResolver,
+//		RequireHealthy: true,
+//		Timeout:        5 * time.Second,
+//	}, logger)
+package preflight
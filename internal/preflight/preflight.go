@@ -0,0 +1,142 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/healthcheck"
+)
+
+// Options configure Run. Checkers holds each backend's health check; backends
+// without one are checked over HTTP.
+type Options struct {
+	Resolver       backend.Resolver
+	RequireHealthy bool
+	Timeout        time.Duration
+	Checkers       map[*backend.Backend]healthcheck.Checker
+}
+
+// Run checks backends and returns an error describing why the load balancer
+// cannot serve traffic, or nil if it can. It returns within opts.Timeout,
+// counting checks still running by then as failed.
+func Run(ctx context.Context, backends []*backend.Backend, opts Options, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	warnDuplicates(backends, logger)
+
+	resolved, err := resolve(ctx, backends, opts.Resolver, logger)
+	if err != nil {
+		return err
+	}
+
+	if opts.RequireHealthy {
+		return probe(ctx, resolved, opts.Checkers, opts.Timeout, logger)
+	}
+	return nil
+}
+
+func warnDuplicates(backends []*backend.Backend, logger *slog.Logger) {
+	seen := make(map[string]int)
+	for _, b := range backends {
+		seen[b.URL().String()]++
+	}
+
+	for _, b := range backends {
+		url := b.URL().String()
+		if n := seen[url]; n > 1 {
+			logger.Warn("Several backend entries resolve to the same address, which gets the sum of their weights",
+				slog.String("backend", url),
+				slog.Int("count", n))
+			delete(seen, url)
+		}
+	}
+}
+
+func resolve(ctx context.Context, backends []*backend.Backend, resolver backend.Resolver, logger *slog.Logger) ([]*backend.Backend, error) {
+	var (
+		resolved []*backend.Backend
+		errs     []error
+	)
+
+	for _, b := range backends {
+		host := b.URL().Hostname()
+		if _, err := netip.ParseAddr(host); err == nil {
+			resolved = append(resolved, b)
+			continue
+		}
+
+		if _, err := resolver.LookupIPAddr(ctx, host); err != nil {
+			logger.Warn("Backend host does not resolve",
+				slog.String("backend", b.URL().String()),
+				slog.Any("error", err))
+			errs = append(errs, fmt.Errorf("%s: %w", b.URL(), err))
+			continue
+		}
+		resolved = append(resolved, b)
+	}
+
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("no backend host resolves; check the backends[].url entries and DNS:\n%w", errors.Join(errs...))
+	}
+	return resolved, nil
+}
+
+// probe checks backends concurrently and returns nil if one passed. It does
+// not wait for checks that outlive ctx, e.g. a command still being killed,
+// which count as timed out.
+func probe(ctx context.Context, backends []*backend.Backend, checkers map[*backend.Backend]healthcheck.Checker, timeout time.Duration, logger *slog.Logger) error {
+	type result struct {
+		index int
+		err   error
+	}
+	results := make(chan result, len(backends))
+	for i, b := range backends {
+		checker, ok := checkers[b]
+		if !ok {
+			checker = healthcheck.HTTP{Timeout: timeout}
+		}
+		if !goroutines.Go("preflight", func() {
+			_, err := checker.Check(ctx, b)
+			results <- result{index: i, err: err}
+		}) {
+			results <- result{index: i, err: errors.New("preflight check not started")}
+		}
+	}
+
+	errs := make([]error, len(backends))
+	for i := range errs {
+		errs[i] = fmt.Errorf("timed out after %s", timeout)
+	}
+	passed := false
+collect:
+	for range backends {
+		select {
+		case r := <-results:
+			errs[r.index] = r.err
+			passed = passed || r.err == nil
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	for i, b := range backends {
+		if errs[i] == nil {
+			continue
+		}
+		logger.Warn("Backend failed its preflight health check",
+			slog.String("backend", b.URL().String()),
+			slog.Any("error", errs[i]))
+		errs[i] = fmt.Errorf("%s: %w", b.URL(), errs[i])
+	}
+	if passed {
+		return nil
+	}
+	return fmt.Errorf("no backend passed its health check; start the backends or set preflight.require_healthy to false:\n%w", errors.Join(errs...))
+}
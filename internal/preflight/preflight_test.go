@@ -0,0 +1,138 @@
+package preflight_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/healthcheck"
+	"github.com/angeloszaimis/load-balancer/internal/preflight"
+)
+
+type fakeResolver map[string][]net.IPAddr
+
+// stuckChecker is a health check that ignores its context until released.
+type stuckChecker chan struct{}
+
+func (c stuckChecker) Check(ctx context.Context, b *backend.Backend) (string, error) {
+	<-c
+	return "", nil
+}
+
+func (f fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, ok := f[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+var _ = Describe("Run", func() {
+	var (
+		logs     *bytes.Buffer
+		log      *slog.Logger
+		resolver fakeResolver
+		opts     preflight.Options
+	)
+
+	newBackend := func(raw string) *backend.Backend {
+		u, err := url.Parse(raw)
+		Expect(err).NotTo(HaveOccurred())
+		return backend.New(u, 1)
+	}
+
+	BeforeEach(func() {
+		logs = &bytes.Buffer{}
+		log = slog.New(slog.NewTextHandler(logs, nil))
+		resolver = fakeResolver{"app.internal": {{IP: net.ParseIP("10.0.0.5")}}}
+		opts = preflight.Options{Resolver: resolver, Timeout: time.Second}
+	})
+
+	It("should pass when some backend resolves", func() {
+		backends := []*backend.Backend{
+			newBackend("http://missing.internal:8080"),
+			newBackend("http://app.internal:8080"),
+		}
+
+		Expect(preflight.Run(context.Background(), backends, opts, log)).To(Succeed())
+		Expect(logs.String()).To(ContainSubstring("missing.internal"))
+	})
+
+	It("should accept IP backends without resolving them", func() {
+		backends := []*backend.Backend{newBackend("http://10.0.0.9:8080")}
+		Expect(preflight.Run(context.Background(), backends, opts, log)).To(Succeed())
+	})
+
+	It("should fail when no backend resolves", func() {
+		backends := []*backend.Backend{
+			newBackend("http://missing.internal:8080"),
+			newBackend("http://gone.internal:8080"),
+		}
+
+		err := preflight.Run(context.Background(), backends, opts, log)
+		Expect(err).To(MatchError(ContainSubstring("no backend host resolves")))
+		Expect(err).To(MatchError(ContainSubstring("gone.internal")))
+
+		var dnsErr *net.DNSError
+		Expect(errors.As(err, &dnsErr)).To(BeTrue())
+	})
+
+	It("should warn about duplicate backends", func() {
+		backends := []*backend.Backend{
+			newBackend("http://10.0.0.9:8080"),
+			newBackend("http://10.0.0.9:8080"),
+		}
+
+		Expect(preflight.Run(context.Background(), backends, opts, log)).To(Succeed())
+		Expect(logs.String()).To(ContainSubstring("resolve to the same address"))
+	})
+
+	Context("when healthy backends are required", func() {
+		BeforeEach(func() {
+			opts.RequireHealthy = true
+		})
+
+		It("should pass when one backend is healthy", func() {
+			healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer healthy.Close()
+
+			backends := []*backend.Backend{newBackend("http://127.0.0.1:1"), newBackend(healthy.URL)}
+			Expect(preflight.Run(context.Background(), backends, opts, log)).To(Succeed())
+			Expect(backends[1].IsHealthy()).To(BeFalse())
+		})
+
+		It("should fail when no backend is healthy", func() {
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer failing.Close()
+
+			backends := []*backend.Backend{newBackend(failing.URL)}
+			err := preflight.Run(context.Background(), backends, opts, log)
+			Expect(err).To(MatchError(ContainSubstring("no backend passed its health check")))
+			Expect(err).To(MatchError(ContainSubstring("503")))
+		})
+
+		It("should not wait past its timeout for checks that do", func() {
+			stuck := stuckChecker(make(chan struct{}))
+			DeferCleanup(func() { close(stuck) })
+			backends := []*backend.Backend{newBackend("http://10.0.0.9:8080")}
+			opts.Timeout = 50 * time.Millisecond
+			opts.Checkers = map[*backend.Backend]healthcheck.Checker{backends[0]: stuck}
+
+			start := time.Now()
+			err := preflight.Run(context.Background(), backends, opts, log)
+			Expect(err).To(MatchError(ContainSubstring("timed out after 50ms")))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+})
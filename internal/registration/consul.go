@@ -0,0 +1,90 @@
+package registration
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consul registers instances with a Consul agent. TTL is how long the agent
+// keeps an instance whose health check keeps failing, such as one that
+// crashed without deregistering; Consul's minimum is one minute. Without a
+// health URL the check is a TTL check that every Register passes, so an
+// instance that stops refreshing turns critical after TTL and is removed
+// after another TTL.
+type Consul struct {
+	URL        string
+	Token      string
+	TTL        time.Duration
+	HTTPClient *http.Client
+}
+
+type consulService struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   *consulCheck      `json:"Check,omitempty"`
+}
+
+type consulCheck struct {
+	HTTP                           string `json:"HTTP,omitempty"`
+	Interval                       string `json:"Interval,omitempty"`
+	Timeout                        string `json:"Timeout,omitempty"`
+	TTL                            string `json:"TTL,omitempty"`
+	Status                         string `json:"Status,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+func (c *Consul) Register(ctx context.Context, inst Instance) error {
+	host, rawPort, err := net.SplitHostPort(inst.Address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return err
+	}
+
+	svc := consulService{ID: inst.ID, Name: inst.Name, Address: host, Port: port}
+	if inst.Version != "" {
+		svc.Meta = map[string]string{"version": inst.Version}
+	}
+	switch {
+	case inst.HealthURL != "":
+		svc.Check = &consulCheck{HTTP: inst.HealthURL, Interval: "10s", Timeout: "5s"}
+	case c.TTL > 0:
+		svc.Check = &consulCheck{TTL: c.TTL.String(), Status: "passing"}
+	}
+	if svc.Check != nil && c.TTL > 0 {
+		svc.Check.DeregisterCriticalServiceAfter = c.TTL.String()
+	}
+	if err := call(ctx, c.HTTPClient, http.MethodPut, c.endpoint("/v1/agent/service/register"), c.auth(), svc, nil); err != nil {
+		return err
+	}
+	if svc.Check == nil || svc.Check.TTL == "" {
+		return nil
+	}
+	// A check registered with a service is named after it.
+	return call(ctx, c.HTTPClient, http.MethodPut, c.endpoint("/v1/agent/check/pass/"+url.PathEscape("service:"+inst.ID)), c.auth(), nil, nil)
+}
+
+func (c *Consul) Deregister(ctx context.Context, inst Instance) error {
+	return call(ctx, c.HTTPClient, http.MethodPut, c.endpoint("/v1/agent/service/deregister/"+url.PathEscape(inst.ID)), c.auth(), nil, nil)
+}
+
+func (c *Consul) auth() string {
+	if c.Token == "" {
+		return ""
+	}
+	return "Bearer " + c.Token
+}
+
+func (c *Consul) endpoint(path string) string {
+	return strings.TrimSuffix(c.URL, "/") + path
+}
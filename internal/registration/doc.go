@@ -0,0 +1,26 @@
+// Package registration announces this load balancer instance in an external
+// service registry, so global balancers or DNS automation in front of the
+// replicas can find them.
+//
+// A Registrar registers the Instance on start, refreshes the registration
+// every interval and removes it on Deregister, which the shutdown path calls
+// before draining so traffic moves to the other replicas first. An instance
+// that crashes is still cleaned up: Consul drops it once its health check
+// has been failing for the TTL and etcd once its lease runs out.
+//
+// Consul is reached through the local agent's HTTP API and etcd through its
+// v3 JSON gateway, where the instance is stored as JSON under Prefix + ID.
+//
+// Usage:
+//
+//	r := registration.NewRegistrar(&registration.Consul{URL: "http://127.0.0.1:8500"}, registration.Instance{
+//		ID:        "lb-1",
+//		Name:      "load-balancer",
+//		Address:   "10.0.0.2:8080",
+//		Version:   "1.4.0",
+//		HealthURL: "http://10.0.0.2:8080/readyz",
+//	}, 10*time.Second, logger)
+//	r.Start(ctx)
+//	...
+//	r.Deregister(context.Background())
+package registration
@@ -0,0 +1,105 @@
+package registration
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Etcd stores instances in etcd under Prefix + ID, attached to a lease of
+// TTL that every Register keeps alive. Refreshing more often than TTL keeps
+// the key; a crashed instance disappears when the lease runs out. Token is
+// an etcd auth token, sent as is.
+type Etcd struct {
+	URL        string
+	Prefix     string
+	Token      string
+	TTL        time.Duration
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	lease string
+}
+
+type etcdLease struct {
+	ID  string `json:"ID"`
+	TTL string `json:"TTL"`
+}
+
+func (e *Etcd) Register(ctx context.Context, inst Instance) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lease != "" {
+		alive, err := e.keepAlive(ctx)
+		if err != nil {
+			return err
+		}
+		if alive {
+			return nil
+		}
+		e.lease = ""
+	}
+
+	var lease etcdLease
+	ttl := max(int64(e.TTL/time.Second), 1)
+	if err := call(ctx, e.HTTPClient, http.MethodPost, e.endpoint("/v3/lease/grant"), e.Token, map[string]any{"TTL": ttl}, &lease); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	put := map[string]string{
+		"key":   e.key(inst),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": lease.ID,
+	}
+	if err := call(ctx, e.HTTPClient, http.MethodPost, e.endpoint("/v3/kv/put"), e.Token, put, nil); err != nil {
+		return err
+	}
+	e.lease = lease.ID
+	return nil
+}
+
+// keepAlive renews the lease and reports whether it still existed. etcd
+// answers an expired lease with a TTL of zero.
+func (e *Etcd) keepAlive(ctx context.Context) (bool, error) {
+	var resp struct {
+		Result etcdLease `json:"result"`
+	}
+	if err := call(ctx, e.HTTPClient, http.MethodPost, e.endpoint("/v3/lease/keepalive"), e.Token, map[string]string{"ID": e.lease}, &resp); err != nil {
+		return false, err
+	}
+	ttl, _ := strconv.ParseInt(resp.Result.TTL, 10, 64)
+	return ttl > 0, nil
+}
+
+// Deregister revokes the lease, which deletes the key with it.
+func (e *Etcd) Deregister(ctx context.Context, inst Instance) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lease == "" {
+		return call(ctx, e.HTTPClient, http.MethodPost, e.endpoint("/v3/kv/deleterange"), e.Token, map[string]string{"key": e.key(inst)}, nil)
+	}
+	if err := call(ctx, e.HTTPClient, http.MethodPost, e.endpoint("/v3/lease/revoke"), e.Token, map[string]string{"ID": e.lease}, nil); err != nil {
+		return err
+	}
+	e.lease = ""
+	return nil
+}
+
+func (e *Etcd) key(inst Instance) string {
+	return base64.StdEncoding.EncodeToString([]byte(e.Prefix + inst.ID))
+}
+
+func (e *Etcd) endpoint(path string) string {
+	return strings.TrimSuffix(e.URL, "/") + path
+}
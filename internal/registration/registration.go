@@ -0,0 +1,146 @@
+package registration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+// Instance describes this load balancer to a registry. Address is the
+// host:port clients reach it on. HealthURL is what the registry probes, when
+// it probes at all; empty means no probe.
+type Instance struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Version   string `json:"version,omitempty"`
+	HealthURL string `json:"health_url,omitempty"`
+}
+
+// Registry stores instances in an external service registry. Register is
+// called again every refresh interval and must be idempotent; it also
+// restores a registration the registry lost.
+type Registry interface {
+	Register(ctx context.Context, inst Instance) error
+	Deregister(ctx context.Context, inst Instance) error
+}
+
+// Registrar keeps one instance registered until it is deregistered.
+type Registrar struct {
+	registry Registry
+	instance Instance
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu           sync.Mutex
+	deregistered bool
+}
+
+func NewRegistrar(registry Registry, inst Instance, interval time.Duration, logger *slog.Logger) *Registrar {
+	return &Registrar{registry: registry, instance: inst, interval: interval, logger: logger}
+}
+
+// Start registers the instance and refreshes the registration every interval
+// until ctx is done. Failures are logged and retried on the next refresh, so
+// an unreachable registry does not keep the balancer from serving.
+func (r *Registrar) Start(ctx context.Context) {
+	goroutines.Go("registration", func() { r.run(ctx) })
+}
+
+func (r *Registrar) run(ctx context.Context) {
+	r.refresh(ctx, true)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.refresh(ctx, false)
+		}
+	}
+}
+
+func (r *Registrar) refresh(ctx context.Context, first bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.deregistered {
+		return
+	}
+
+	if err := r.registry.Register(ctx, r.instance); err != nil {
+		if ctx.Err() == nil {
+			r.logger.Warn("Failed to register instance",
+				slog.String("id", r.instance.ID),
+				slog.Any("err", err))
+		}
+		return
+	}
+	if first {
+		r.logger.Info("Registered instance",
+			slog.String("id", r.instance.ID),
+			slog.String("address", r.instance.Address))
+	}
+}
+
+// Deregister removes the instance from the registry and stops further
+// refreshes.
+func (r *Registrar) Deregister(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deregistered = true
+	return r.registry.Deregister(ctx, r.instance)
+}
+
+// call sends body as JSON and decodes a 2xx response into out, when given.
+// A non-empty auth is sent as the Authorization header.
+func call(ctx context.Context, client *http.Client, method, url, auth string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, url, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
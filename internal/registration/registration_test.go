@@ -0,0 +1,277 @@
+package registration_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/registration"
+)
+
+type recordedCall struct {
+	Method string
+	Path   string
+	Auth   string
+	Body   map[string]any
+}
+
+// recorder is a fake registry API answering every call with the response
+// set for its path, or an empty object.
+type recorder struct {
+	mu        sync.Mutex
+	calls     []recordedCall
+	responses map[string]string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body map[string]any
+	json.NewDecoder(req.Body).Decode(&body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, recordedCall{Method: req.Method, Path: req.URL.Path, Auth: req.Header.Get("Authorization"), Body: body})
+	if resp, ok := r.responses[req.URL.Path]; ok {
+		io.WriteString(w, resp)
+		return
+	}
+	io.WriteString(w, "{}")
+}
+
+func (r *recorder) Calls() []recordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordedCall(nil), r.calls...)
+}
+
+func (r *recorder) Paths() []string {
+	var paths []string
+	for _, c := range r.Calls() {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+var instance = registration.Instance{
+	ID:        "lb-1",
+	Name:      "load-balancer",
+	Address:   "10.0.0.2:8080",
+	Version:   "1.4.0",
+	HealthURL: "http://10.0.0.2:8080/readyz",
+}
+
+var _ = Describe("Consul", func() {
+	var (
+		rec    *recorder
+		server *httptest.Server
+		consul *registration.Consul
+	)
+
+	BeforeEach(func() {
+		rec = &recorder{}
+		server = httptest.NewServer(rec)
+		DeferCleanup(server.Close)
+		consul = &registration.Consul{URL: server.URL, Token: "secret", TTL: time.Minute}
+	})
+
+	It("should register the instance as a service with a health check", func() {
+		Expect(consul.Register(context.Background(), instance)).To(Succeed())
+
+		calls := rec.Calls()
+		Expect(calls).To(HaveLen(1))
+		Expect(calls[0].Method).To(Equal(http.MethodPut))
+		Expect(calls[0].Path).To(Equal("/v1/agent/service/register"))
+		Expect(calls[0].Auth).To(Equal("Bearer secret"))
+		body := calls[0].Body
+		Expect(body).To(HaveKeyWithValue("ID", "lb-1"))
+		Expect(body).To(HaveKeyWithValue("Name", "load-balancer"))
+		Expect(body).To(HaveKeyWithValue("Address", "10.0.0.2"))
+		Expect(body).To(HaveKeyWithValue("Port", BeNumerically("==", 8080)))
+		Expect(body).To(HaveKeyWithValue("Meta", map[string]any{"version": "1.4.0"}))
+		Expect(body).To(HaveKeyWithValue("Check", SatisfyAll(
+			HaveKeyWithValue("HTTP", "http://10.0.0.2:8080/readyz"),
+			HaveKeyWithValue("DeregisterCriticalServiceAfter", "1m0s"),
+		)))
+	})
+
+	It("should register a TTL check and pass it when there is no health URL", func() {
+		inst := instance
+		inst.HealthURL = ""
+		Expect(consul.Register(context.Background(), inst)).To(Succeed())
+		Expect(consul.Register(context.Background(), inst)).To(Succeed())
+
+		calls := rec.Calls()
+		Expect(calls[0].Body).To(HaveKeyWithValue("Check", SatisfyAll(
+			HaveKeyWithValue("TTL", "1m0s"),
+			HaveKeyWithValue("Status", "passing"),
+			HaveKeyWithValue("DeregisterCriticalServiceAfter", "1m0s"),
+			Not(HaveKey("HTTP")),
+		)))
+		Expect(rec.Paths()).To(Equal([]string{
+			"/v1/agent/service/register",
+			"/v1/agent/check/pass/service:lb-1",
+			"/v1/agent/service/register",
+			"/v1/agent/check/pass/service:lb-1",
+		}))
+		Expect(calls[1].Method).To(Equal(http.MethodPut))
+		Expect(calls[1].Auth).To(Equal("Bearer secret"))
+	})
+
+	It("should deregister the service by ID", func() {
+		Expect(consul.Deregister(context.Background(), instance)).To(Succeed())
+		Expect(rec.Paths()).To(Equal([]string{"/v1/agent/service/deregister/lb-1"}))
+	})
+
+	It("should surface error responses", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "ACL not found", http.StatusForbidden)
+		})
+		err := consul.Register(context.Background(), instance)
+		Expect(err).To(MatchError(ContainSubstring("403 Forbidden: ACL not found")))
+	})
+})
+
+var _ = Describe("Etcd", func() {
+	var (
+		rec    *recorder
+		server *httptest.Server
+		etcd   *registration.Etcd
+	)
+
+	BeforeEach(func() {
+		rec = &recorder{responses: map[string]string{
+			"/v3/lease/grant":     `{"ID":"42","TTL":"30"}`,
+			"/v3/lease/keepalive": `{"result":{"ID":"42","TTL":"30"}}`,
+		}}
+		server = httptest.NewServer(rec)
+		DeferCleanup(server.Close)
+		etcd = &registration.Etcd{URL: server.URL, Prefix: "/services/lb/", TTL: 30 * time.Second}
+	})
+
+	It("should put the instance under a lease", func() {
+		Expect(etcd.Register(context.Background(), instance)).To(Succeed())
+
+		calls := rec.Calls()
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].Path).To(Equal("/v3/lease/grant"))
+		Expect(calls[0].Body).To(HaveKeyWithValue("TTL", BeNumerically("==", 30)))
+		Expect(calls[1].Path).To(Equal("/v3/kv/put"))
+		Expect(calls[1].Body).To(HaveKeyWithValue("lease", "42"))
+
+		key, _ := base64.StdEncoding.DecodeString(calls[1].Body["key"].(string))
+		Expect(string(key)).To(Equal("/services/lb/lb-1"))
+		value, _ := base64.StdEncoding.DecodeString(calls[1].Body["value"].(string))
+		var stored registration.Instance
+		Expect(json.Unmarshal(value, &stored)).To(Succeed())
+		Expect(stored).To(Equal(instance))
+	})
+
+	It("should keep the lease alive on later registrations", func() {
+		Expect(etcd.Register(context.Background(), instance)).To(Succeed())
+		Expect(etcd.Register(context.Background(), instance)).To(Succeed())
+		Expect(rec.Paths()).To(Equal([]string{"/v3/lease/grant", "/v3/kv/put", "/v3/lease/keepalive"}))
+	})
+
+	It("should put the instance again once the lease expired", func() {
+		Expect(etcd.Register(context.Background(), instance)).To(Succeed())
+		rec.mu.Lock()
+		rec.responses["/v3/lease/keepalive"] = `{"result":{"ID":"42"}}`
+		rec.mu.Unlock()
+
+		Expect(etcd.Register(context.Background(), instance)).To(Succeed())
+		Expect(rec.Paths()).To(Equal([]string{"/v3/lease/grant", "/v3/kv/put", "/v3/lease/keepalive", "/v3/lease/grant", "/v3/kv/put"}))
+	})
+
+	It("should revoke the lease on deregistration", func() {
+		Expect(etcd.Register(context.Background(), instance)).To(Succeed())
+		Expect(etcd.Deregister(context.Background(), instance)).To(Succeed())
+
+		calls := rec.Calls()
+		Expect(calls[2].Path).To(Equal("/v3/lease/revoke"))
+		Expect(calls[2].Body).To(HaveKeyWithValue("ID", "42"))
+	})
+
+	It("should delete the key when it holds no lease", func() {
+		Expect(etcd.Deregister(context.Background(), instance)).To(Succeed())
+		Expect(rec.Paths()).To(Equal([]string{"/v3/kv/deleterange"}))
+	})
+})
+
+type fakeRegistry struct {
+	mu            sync.Mutex
+	registered    int
+	deregistered  int
+	registerError error
+}
+
+func (f *fakeRegistry) Register(ctx context.Context, inst registration.Instance) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.registered++
+	return f.registerError
+}
+
+func (f *fakeRegistry) Deregister(ctx context.Context, inst registration.Instance) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deregistered++
+	return nil
+}
+
+func (f *fakeRegistry) Registered() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.registered
+}
+
+var _ = Describe("Registrar", func() {
+	var (
+		registry *fakeRegistry
+		log      *slog.Logger
+	)
+
+	BeforeEach(func() {
+		registry = &fakeRegistry{}
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	})
+
+	It("should register at once and refresh every interval", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		registration.NewRegistrar(registry, instance, 10*time.Millisecond, log).Start(ctx)
+		Eventually(registry.Registered).Should(BeNumerically(">=", 3))
+	})
+
+	It("should keep retrying while the registry fails", func() {
+		registry.registerError = errors.New("connection refused")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		registration.NewRegistrar(registry, instance, 10*time.Millisecond, log).Start(ctx)
+		Eventually(registry.Registered).Should(BeNumerically(">=", 2))
+	})
+
+	It("should stop refreshing once deregistered", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r := registration.NewRegistrar(registry, instance, 10*time.Millisecond, log)
+		r.Start(ctx)
+		Eventually(registry.Registered).Should(BeNumerically(">=", 1))
+
+		Expect(r.Deregister(context.Background())).To(Succeed())
+		registered := registry.Registered()
+		Consistently(registry.Registered, 50*time.Millisecond).Should(Equal(registered))
+		Expect(registry.deregistered).To(Equal(1))
+	})
+})
@@ -0,0 +1,141 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+// Options configures a Client. Each push sends the series of one snapshot in
+// requests of at most BatchSize series. A request failing with a network
+// error, 429 or 5xx is retried up to MaxRetries times, waiting MinBackoff
+// and doubling up to MaxBackoff; other failures drop the batch.
+type Options struct {
+	URL         string
+	Interval    time.Duration
+	Timeout     time.Duration
+	BatchSize   int
+	MaxRetries  int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	BearerToken string
+	// Labels are added to every series, e.g. to tell instances apart.
+	Labels map[string]string
+}
+
+// Client pushes metrics snapshots to a Prometheus remote write endpoint.
+type Client struct {
+	opts     Options
+	snapshot func() metrics.Snapshot
+	client   *http.Client
+	logger   *slog.Logger
+}
+
+func NewClient(opts Options, snapshot func() metrics.Snapshot, logger *slog.Logger) *Client {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	return &Client{
+		opts:     opts,
+		snapshot: snapshot,
+		client:   &http.Client{Timeout: opts.Timeout},
+		logger:   logger,
+	}
+}
+
+// Start pushes a snapshot every interval until ctx is done.
+func (c *Client) Start(ctx context.Context) {
+	goroutines.Go("remotewrite", func() { c.run(ctx) })
+}
+
+func (c *Client) run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Push(ctx); err != nil && ctx.Err() == nil {
+				c.logger.Warn("Remote write failed", slog.String("url", c.opts.URL), slog.Any("err", err))
+			}
+		}
+	}
+}
+
+// Push sends the current snapshot. It returns the first batch error; later
+// batches are still attempted.
+func (c *Client) Push(ctx context.Context) error {
+	series := Series(c.snapshot(), time.Now(), c.opts.Labels)
+
+	var first error
+	for start := 0; start < len(series); start += c.opts.BatchSize {
+		end := min(start+c.opts.BatchSize, len(series))
+		if err := c.send(ctx, snappyBlock(encodeWriteRequest(series[start:end]))); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// errPermanent marks responses that retrying will not change.
+var errPermanent = errors.New("rejected by remote")
+
+func (c *Client) send(ctx context.Context, body []byte) error {
+	backoff := c.opts.MinBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := c.post(ctx, body)
+		if err == nil || errors.Is(err, errPermanent) || attempt >= c.opts.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.opts.MaxBackoff)
+	}
+}
+
+func (c *Client) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "load-balancer-remote-write")
+	if c.opts.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.BearerToken)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	return err
+}
@@ -0,0 +1,22 @@
+// Package remotewrite pushes the balancer's metrics to a Prometheus remote
+// write endpoint, such as Prometheus with the remote write receiver, Mimir,
+// Thanos or VictoriaMetrics, for environments that cannot scrape /metrics.
+// Every interval the metrics snapshot is converted to counter, gauge and
+// summary quantile series, split into batches and sent snappy-framed as a
+// WriteRequest protobuf. Failed batches are retried with exponential
+// backoff when the failure is temporary.
+//
+// Usage:
+//
+//	client := remotewrite.NewClient(remotewrite.Options{
+//		URL:        "https://prometheus.example.com/api/v1/write",
+//		Interval:   15 * time.Second,
+//		Timeout:    10 * time.Second,
+//		BatchSize:  500,
+//		MaxRetries: 3,
+//		MinBackoff: 100 * time.Millisecond,
+//		MaxBackoff: 5 * time.Second,
+//		Labels:     map[string]string{"instance": "lb-1"},
+//	}, func() metrics.Snapshot { return collector.Snapshot("round-robin") }, logger)
+//	client.Start(ctx)
+package remotewrite
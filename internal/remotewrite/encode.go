@@ -0,0 +1,69 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// encodeWriteRequest encodes series as a Prometheus remote write
+// WriteRequest protobuf message. The wire format is written by hand as the
+// message is small:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []TimeSeries) []byte {
+	var buf, ts, msg []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.Labels {
+			msg = msg[:0]
+			msg = appendBytesField(msg, 1, []byte(l.Name))
+			msg = appendBytesField(msg, 2, []byte(l.Value))
+			ts = appendBytesField(ts, 1, msg)
+		}
+
+		msg = msg[:0]
+		msg = binary.AppendUvarint(msg, 1<<3|1)
+		msg = binary.LittleEndian.AppendUint64(msg, math.Float64bits(s.Value))
+		msg = binary.AppendUvarint(msg, 2<<3)
+		msg = binary.AppendUvarint(msg, uint64(s.Timestamp.UnixMilli()))
+		ts = appendBytesField(ts, 2, msg)
+
+		buf = appendBytesField(buf, 1, ts)
+	}
+	return buf
+}
+
+func appendBytesField(buf []byte, field int, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// maxLiteral is the longest literal written per snappy tag, whose length
+// then fits in two bytes.
+const maxLiteral = 1 << 16
+
+// snappyBlock frames data in the snappy block format remote write requires.
+// It only emits literals, so the body is not smaller, but any snappy
+// decoder accepts it and the balancer needs no compression library.
+func snappyBlock(data []byte) []byte {
+	out := binary.AppendUvarint(make([]byte, 0, len(data)+len(data)/maxLiteral*3+16), uint64(len(data)))
+	for len(data) > 0 {
+		n := min(len(data), maxLiteral)
+		// Literal tag: lengths above 60 are stored in the following bytes.
+		switch l := n - 1; {
+		case l < 60:
+			out = append(out, byte(l)<<2)
+		case l < 1<<8:
+			out = append(out, 60<<2, byte(l))
+		default:
+			out = append(out, 61<<2, byte(l), byte(l>>8))
+		}
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
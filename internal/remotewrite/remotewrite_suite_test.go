@@ -0,0 +1,13 @@
+package remotewrite_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RemoteWrite Suite")
+}
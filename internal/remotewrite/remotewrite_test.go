@@ -0,0 +1,314 @@
+package remotewrite_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/remotewrite"
+)
+
+var _ = Describe("Series", func() {
+	now := time.UnixMilli(1700000000000)
+	snap := metrics.Snapshot{
+		TotalRequests: 7,
+		Uptime:        90 * time.Second,
+		Backends: map[string]metrics.BackendMetrics{
+			"api-1": {
+				Requests:      7,
+				Healthy:       true,
+				State:         "degraded",
+				P95Response:   250 * time.Millisecond,
+				StatusCodes:   map[int]int64{200: 6, 502: 1},
+				StatusClasses: map[string]int64{"2xx": 6, "5xx": 1},
+				Errors:        &metrics.BackendErrors{Dial: 3, Status5xx: 1},
+				SkippedChecks: 2,
+			},
+		},
+		Errors:    metrics.ErrorCounts{LB: map[int]int64{503: 2}},
+		Decisions: map[string]metrics.DecisionMetrics{"ring_rebuild": {Count: 4, Last: 3}},
+	}
+
+	find := func(series []remotewrite.TimeSeries, labels ...remotewrite.Label) *remotewrite.TimeSeries {
+		for i, s := range series {
+			matched := 0
+			for _, l := range labels {
+				for _, have := range s.Labels {
+					if have == l {
+						matched++
+					}
+				}
+			}
+			if matched == len(labels) && len(s.Labels) == len(labels) {
+				return &series[i]
+			}
+		}
+		return nil
+	}
+
+	It("should name counters, gauges and quantiles like a Prometheus exporter", func() {
+		series := remotewrite.Series(snap, now, nil)
+
+		requests := find(series, remotewrite.Label{Name: "__name__", Value: "lb_requests_total"})
+		Expect(requests).NotTo(BeNil())
+		Expect(requests.Value).To(Equal(7.0))
+		Expect(requests.Timestamp).To(Equal(now))
+
+		healthy := find(series, remotewrite.Label{Name: "__name__", Value: "lb_backend_healthy"}, remotewrite.Label{Name: "backend", Value: "api-1"})
+		Expect(healthy).NotTo(BeNil())
+		Expect(healthy.Value).To(Equal(1.0))
+
+		state := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_backend_state"},
+			remotewrite.Label{Name: "backend", Value: "api-1"},
+			remotewrite.Label{Name: "state", Value: "degraded"})
+		Expect(state).NotTo(BeNil())
+		Expect(state.Value).To(Equal(1.0))
+
+		rebuilds := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_strategy_decisions_total"},
+			remotewrite.Label{Name: "kind", Value: "ring_rebuild"})
+		Expect(rebuilds).NotTo(BeNil())
+		Expect(rebuilds.Value).To(Equal(4.0))
+
+		p95 := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_backend_response_seconds"},
+			remotewrite.Label{Name: "backend", Value: "api-1"},
+			remotewrite.Label{Name: "quantile", Value: "0.95"})
+		Expect(p95).NotTo(BeNil())
+		Expect(p95.Value).To(Equal(0.25))
+
+		badGateway := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_backend_responses_total"},
+			remotewrite.Label{Name: "backend", Value: "api-1"},
+			remotewrite.Label{Name: "code", Value: "502"})
+		Expect(badGateway).NotTo(BeNil())
+		Expect(badGateway.Value).To(Equal(1.0))
+
+		serverErrors := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_backend_responses_by_class_total"},
+			remotewrite.Label{Name: "backend", Value: "api-1"},
+			remotewrite.Label{Name: "class", Value: "5xx"})
+		Expect(serverErrors).NotTo(BeNil())
+		Expect(serverErrors.Value).To(Equal(1.0))
+
+		dialErrors := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_backend_errors_total"},
+			remotewrite.Label{Name: "backend", Value: "api-1"},
+			remotewrite.Label{Name: "kind", Value: "dial"})
+		Expect(dialErrors).NotTo(BeNil())
+		Expect(dialErrors.Value).To(Equal(3.0))
+
+		skipped := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_backend_health_checks_skipped_total"},
+			remotewrite.Label{Name: "backend", Value: "api-1"})
+		Expect(skipped).NotTo(BeNil())
+		Expect(skipped.Value).To(Equal(2.0))
+
+		lbErrors := find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_errors_total"},
+			remotewrite.Label{Name: "code", Value: "503"},
+			remotewrite.Label{Name: "source", Value: "lb"})
+		Expect(lbErrors).NotTo(BeNil())
+		Expect(lbErrors.Value).To(Equal(2.0))
+	})
+
+	It("should add external labels and keep labels sorted by name", func() {
+		series := remotewrite.Series(snap, now, map[string]string{"instance": "lb-1", "backend": "ignored"})
+
+		for _, s := range series {
+			for i := 1; i < len(s.Labels); i++ {
+				Expect(s.Labels[i-1].Name < s.Labels[i].Name).To(BeTrue())
+			}
+			Expect(s.Labels).To(ContainElement(remotewrite.Label{Name: "instance", Value: "lb-1"}))
+		}
+		Expect(find(series,
+			remotewrite.Label{Name: "__name__", Value: "lb_backend_healthy"},
+			remotewrite.Label{Name: "backend", Value: "api-1"},
+			remotewrite.Label{Name: "instance", Value: "lb-1"})).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Client", func() {
+	var (
+		server   *httptest.Server
+		requests atomic.Int32
+		respond  func(n int32) int
+		bodies   chan []byte
+		headers  chan http.Header
+	)
+
+	snapshot := func() metrics.Snapshot {
+		return metrics.Snapshot{
+			TotalRequests: 3,
+			Backends:      map[string]metrics.BackendMetrics{"api-1": {Requests: 3, Healthy: true}},
+		}
+	}
+
+	newClient := func(batchSize, maxRetries int) *remotewrite.Client {
+		return remotewrite.NewClient(remotewrite.Options{
+			URL:         server.URL,
+			Timeout:     time.Second,
+			BatchSize:   batchSize,
+			MaxRetries:  maxRetries,
+			MinBackoff:  time.Millisecond,
+			MaxBackoff:  5 * time.Millisecond,
+			BearerToken: "secret",
+		}, snapshot, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+
+	BeforeEach(func() {
+		requests.Store(0)
+		respond = func(int32) int { return http.StatusNoContent }
+		bodies = make(chan []byte, 100)
+		headers = make(chan http.Header, 100)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies <- body
+			headers <- r.Header
+			w.WriteHeader(respond(requests.Add(1)))
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	It("should send a snappy-framed WriteRequest", func() {
+		Expect(newClient(500, 0).Push(context.Background())).To(Succeed())
+
+		header := <-headers
+		Expect(header.Get("Content-Encoding")).To(Equal("snappy"))
+		Expect(header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+		Expect(header.Get("X-Prometheus-Remote-Write-Version")).To(Equal("0.1.0"))
+		Expect(header.Get("Authorization")).To(Equal("Bearer secret"))
+
+		series := decodeWriteRequest(decodeSnappy(<-bodies))
+		Expect(series).To(ContainElement(decodedSeries{
+			labels: []remotewrite.Label{{Name: "__name__", Value: "lb_requests_total"}},
+			value:  3,
+		}))
+	})
+
+	It("should split the series into batches", func() {
+		Expect(newClient(2, 0).Push(context.Background())).To(Succeed())
+
+		total := len(remotewrite.Series(snapshot(), time.Now(), nil))
+		Expect(requests.Load()).To(BeEquivalentTo((total + 1) / 2))
+		for range requests.Load() {
+			Expect(len(decodeWriteRequest(decodeSnappy(<-bodies)))).To(BeNumerically("<=", 2))
+		}
+	})
+
+	It("should retry temporary failures with backoff", func() {
+		respond = func(n int32) int {
+			if n < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusNoContent
+		}
+
+		Expect(newClient(500, 3).Push(context.Background())).To(Succeed())
+		Expect(requests.Load()).To(BeEquivalentTo(3))
+	})
+
+	It("should give up after the last retry", func() {
+		respond = func(int32) int { return http.StatusTooManyRequests }
+
+		Expect(newClient(500, 2).Push(context.Background())).To(MatchError(ContainSubstring("429")))
+		Expect(requests.Load()).To(BeEquivalentTo(3))
+	})
+
+	It("should not retry requests the endpoint rejects", func() {
+		respond = func(int32) int { return http.StatusBadRequest }
+
+		Expect(newClient(500, 3).Push(context.Background())).NotTo(Succeed())
+		Expect(requests.Load()).To(BeEquivalentTo(1))
+	})
+})
+
+type decodedSeries struct {
+	labels []remotewrite.Label
+	value  float64
+}
+
+// decodeSnappy reads a snappy block made only of literals.
+func decodeSnappy(data []byte) []byte {
+	length, n := binary.Uvarint(data)
+	data = data[n:]
+	out := make([]byte, 0, length)
+	for len(data) > 0 {
+		tag := data[0]
+		Expect(tag&3).To(BeZero(), "only literals are expected")
+		l := int(tag >> 2)
+		data = data[1:]
+		switch l {
+		case 60:
+			l = int(data[0])
+			data = data[1:]
+		case 61:
+			l = int(data[0]) | int(data[1])<<8
+			data = data[2:]
+		}
+		out = append(out, data[:l+1]...)
+		data = data[l+1:]
+	}
+	Expect(out).To(HaveLen(int(length)))
+	return out
+}
+
+// decodeWriteRequest reads the labels and sample value of each series.
+func decodeWriteRequest(data []byte) []decodedSeries {
+	var series []decodedSeries
+	for _, ts := range fields(data) {
+		var s decodedSeries
+		for _, f := range fields(ts.data) {
+			switch f.num {
+			case 1:
+				label := fields(f.data)
+				s.labels = append(s.labels, remotewrite.Label{Name: string(label[0].data), Value: string(label[1].data)})
+			case 2:
+				sample := fields(f.data)
+				s.value = math.Float64frombits(sample[0].fixed)
+			}
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+type field struct {
+	num   uint64
+	data  []byte
+	fixed uint64
+}
+
+func fields(data []byte) []field {
+	var out []field
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		f := field{num: key >> 3}
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(data)
+			data = data[n:]
+		case 1:
+			f.fixed = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			l, n := binary.Uvarint(data)
+			f.data = data[n : n+int(l)]
+			data = data[n+int(l):]
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package remotewrite
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+)
+
+// Label is a Prometheus label pair.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// TimeSeries is one sample of a series, identified by its labels including
+// __name__.
+type TimeSeries struct {
+	Labels    []Label
+	Value     float64
+	Timestamp time.Time
+}
+
+var quantiles = []struct {
+	label string
+	value func(m metrics.BackendMetrics) time.Duration
+}{
+	{"0.5", func(m metrics.BackendMetrics) time.Duration { return m.P50Response }},
+	{"0.95", func(m metrics.BackendMetrics) time.Duration { return m.P95Response }},
+	{"0.99", func(m metrics.BackendMetrics) time.Duration { return m.P99Response }},
+}
+
+// Series converts a metrics snapshot into the series pushed to the remote
+// endpoint, stamped with now and carrying external on every series.
+// Counters end in _total and response times are summary quantiles in
+// seconds, as a Prometheus exporter would name them.
+func Series(snap metrics.Snapshot, now time.Time, external map[string]string) []TimeSeries {
+	b := &builder{now: now, external: external}
+
+	b.add("lb_uptime_seconds", snap.Uptime.Seconds())
+	b.add("lb_requests_total", float64(snap.TotalRequests))
+
+	for _, name := range sortedKeys(snap.Backends) {
+		m := snap.Backends[name]
+		backend := Label{"backend", name}
+
+		b.add("lb_backend_requests_total", float64(m.Requests), backend)
+		b.add("lb_backend_selections_total", float64(m.Selections), backend)
+		b.add("lb_backend_healthy", boolValue(m.Healthy), backend)
+		if m.State != "" {
+			b.add("lb_backend_state", 1, backend, Label{"state", m.State})
+		}
+		b.add("lb_backend_client_canceled_total", float64(m.ClientCanceled), backend)
+		b.add("lb_backend_affinity_failovers_total", float64(m.AffinityFailovers), backend)
+		b.add("lb_backend_health_checks_skipped_total", float64(m.SkippedChecks), backend)
+		for _, q := range quantiles {
+			b.add("lb_backend_response_seconds", q.value(m).Seconds(), backend, Label{"quantile", q.label})
+		}
+		for _, code := range sortedKeys(m.StatusCodes) {
+			b.add("lb_backend_responses_total", float64(m.StatusCodes[code]), backend, Label{"code", strconv.Itoa(code)})
+		}
+		if m.OtherStatusCodes > 0 {
+			b.add("lb_backend_responses_total", float64(m.OtherStatusCodes), backend, Label{"code", "other"})
+		}
+		for _, class := range sortedKeys(m.StatusClasses) {
+			b.add("lb_backend_responses_by_class_total", float64(m.StatusClasses[class]), backend, Label{"class", class})
+		}
+		if e := m.Errors; e != nil {
+			for _, kind := range []struct {
+				label string
+				count int64
+			}{
+				{"dial", e.Dial},
+				{"timeout", e.Timeout},
+				{"reset", e.Reset},
+				{"other", e.Other},
+				{"5xx", e.Status5xx},
+				{"breaker_rejected", e.BreakerRejected},
+			} {
+				b.add("lb_backend_errors_total", float64(kind.count), backend, Label{"kind", kind.label})
+			}
+		}
+		if m.CertificateExpiresInDays != nil {
+			b.add("lb_backend_certificate_expires_in_days", *m.CertificateExpiresInDays, backend)
+		}
+	}
+
+	for _, code := range sortedKeys(snap.Errors.LB) {
+		b.add("lb_errors_total", float64(snap.Errors.LB[code]), Label{"source", "lb"}, Label{"code", strconv.Itoa(code)})
+	}
+	for _, code := range sortedKeys(snap.Errors.Upstream) {
+		b.add("lb_errors_total", float64(snap.Errors.Upstream[code]), Label{"source", "upstream"}, Label{"code", strconv.Itoa(code)})
+	}
+
+	for _, name := range sortedKeys(snap.Endpoints) {
+		m := snap.Endpoints[name]
+		endpoint := Label{"endpoint", name}
+
+		b.add("lb_endpoint_requests_total", float64(m.Requests), endpoint)
+		b.add("lb_endpoint_errors_total", float64(m.Errors), endpoint)
+		b.add("lb_endpoint_response_seconds", m.P50Response.Seconds(), endpoint, Label{"quantile", "0.5"})
+		b.add("lb_endpoint_response_seconds", m.P95Response.Seconds(), endpoint, Label{"quantile", "0.95"})
+		b.add("lb_endpoint_response_seconds", m.P99Response.Seconds(), endpoint, Label{"quantile", "0.99"})
+	}
+
+	if q := snap.Queue; q != nil {
+		b.add("lb_queue_depth", float64(q.Depth))
+		for _, outcome := range sortedKeys(q.Outcomes) {
+			b.add("lb_queue_requests_total", float64(q.Outcomes[outcome]), Label{"outcome", outcome})
+		}
+		b.add("lb_queue_wait_seconds", q.AvgWait.Seconds())
+	}
+
+	for _, kind := range sortedKeys(snap.Decisions) {
+		m := snap.Decisions[kind]
+		b.add("lb_strategy_decisions_total", float64(m.Count), Label{"kind", kind})
+		b.add("lb_strategy_decision_last", m.Last, Label{"kind", kind})
+	}
+
+	return b.series
+}
+
+type builder struct {
+	now      time.Time
+	external map[string]string
+	series   []TimeSeries
+}
+
+// add appends a sample with its labels sorted by name, as remote write
+// requires. Labels of the series win over external labels of the same name.
+func (b *builder) add(name string, value float64, labels ...Label) {
+	all := make([]Label, 0, len(labels)+len(b.external)+1)
+	all = append(all, Label{"__name__", name})
+	all = append(all, labels...)
+	for k, v := range b.external {
+		if !hasLabel(all, k) {
+			all = append(all, Label{k, v})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	b.series = append(b.series, TimeSeries{Labels: all, Value: value, Timestamp: b.now})
+}
+
+func hasLabel(labels []Label, name string) bool {
+	for _, l := range labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
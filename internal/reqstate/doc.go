@@ -0,0 +1,19 @@
+// Package reqstate carries what the balancer learns about a request while it
+// serves it: the client identity, the route label, the backend selected and
+// how many attempts it took. The state travels in the request context under
+// an unexported key, so middlewares wrapping the handler, access logging and
+// tracing read it through typed accessors instead of re-parsing headers.
+//
+// Usage:
+//
+//	func accessLog(next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			r, state := reqstate.Ensure(r)
+//			next.ServeHTTP(w, r)
+//			log.Info("served",
+//				slog.String("client", state.ClientIP()),
+//				slog.String("backend", state.Backend()),
+//				slog.Int("attempts", state.Attempts()))
+//		})
+//	}
+package reqstate
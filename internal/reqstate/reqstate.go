@@ -0,0 +1,92 @@
+package reqstate
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type stateKey struct{}
+
+// State is the per-request state. It is safe for concurrent use, as tunnels
+// and tracing may read it from other goroutines.
+type State struct {
+	mutex    sync.Mutex
+	clientIP string
+	route    string
+	backend  string
+	attempts int
+}
+
+// NewContext returns ctx carrying a new State.
+func NewContext(ctx context.Context) (context.Context, *State) {
+	s := &State{}
+	return context.WithValue(ctx, stateKey{}, s), s
+}
+
+// FromContext returns the State ctx carries.
+func FromContext(ctx context.Context) (*State, bool) {
+	s, ok := ctx.Value(stateKey{}).(*State)
+	return s, ok
+}
+
+// Ensure returns r with a State, attaching a new one when it has none, and
+// that State. A middleware that calls it before the handler sees what the
+// handler records.
+func Ensure(r *http.Request) (*http.Request, *State) {
+	if s, ok := FromContext(r.Context()); ok {
+		return r, s
+	}
+	ctx, s := NewContext(r.Context())
+	return r.WithContext(ctx), s
+}
+
+// ClientIP returns the client address the request was attributed to.
+func (s *State) ClientIP() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.clientIP
+}
+
+func (s *State) SetClientIP(ip string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clientIP = ip
+}
+
+// Route returns the endpoint label of the request, e.g. "GET /users/{id}",
+// or empty when endpoint labels are not configured.
+func (s *State) Route() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.route
+}
+
+func (s *State) SetRoute(route string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.route = route
+}
+
+// Backend returns the name of the backend of the latest attempt, empty
+// before the request was forwarded.
+func (s *State) Backend() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.backend
+}
+
+// Attempts returns how many times the request was forwarded to a backend.
+func (s *State) Attempts() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.attempts
+}
+
+// BeginAttempt records that the request is forwarded to backend.
+func (s *State) BeginAttempt(backend string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.backend = backend
+	s.attempts++
+}
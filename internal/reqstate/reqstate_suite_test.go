@@ -0,0 +1,13 @@
+package reqstate_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestReqstate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reqstate Suite")
+}
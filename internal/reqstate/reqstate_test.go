@@ -0,0 +1,44 @@
+package reqstate_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/reqstate"
+)
+
+var _ = Describe("State", func() {
+	It("should attach a state once and return the same one after", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		_, ok := reqstate.FromContext(r.Context())
+		Expect(ok).To(BeFalse())
+
+		r, state := reqstate.Ensure(r)
+		again, same := reqstate.Ensure(r)
+		Expect(again).To(BeIdenticalTo(r))
+		Expect(same).To(BeIdenticalTo(state))
+
+		found, ok := reqstate.FromContext(r.Context())
+		Expect(ok).To(BeTrue())
+		Expect(found).To(BeIdenticalTo(state))
+	})
+
+	It("should record client, route and attempts", func() {
+		_, state := reqstate.Ensure(httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(state.Backend()).To(BeEmpty())
+		Expect(state.Attempts()).To(BeZero())
+
+		state.SetClientIP("192.0.2.1")
+		state.SetRoute("GET /users/{id}")
+		state.BeginAttempt("a")
+		state.BeginAttempt("b")
+
+		Expect(state.ClientIP()).To(Equal("192.0.2.1"))
+		Expect(state.Route()).To(Equal("GET /users/{id}"))
+		Expect(state.Backend()).To(Equal("b"))
+		Expect(state.Attempts()).To(Equal(2))
+	})
+})
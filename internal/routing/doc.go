@@ -0,0 +1,22 @@
+// Package routing sends requests to a subset of the backends based on the
+// request itself: its host, path, headers, query parameters and fields of a
+// JSON body. It lets an API route by tenant even when the tenant only appears
+// in the payload.
+//
+// A Rule matches when every condition it sets holds and selects backends by
+// name or by label. Rules are evaluated in order and the first match wins;
+// requests matching no rule may go to any backend. Body conditions only see
+// bodies prepared by package inspect, and only up to MaxBodyBytes.
+//
+// Usage:
+//
+//	router, err := routing.New([]routing.Rule{{
+//		Name:       "acme",
+//		PathPrefix: "/api/",
+//		Conditions: []routing.Condition{{Source: routing.SourceBody, Name: "tenant.id", Pattern: "^acme$"}},
+//		Labels:     map[string]string{"tenant": "acme"},
+//	}}, 64<<10)
+//	if route := router.Match(r); route != nil {
+//		// balance over the backends route.Selects
+//	}
+package routing
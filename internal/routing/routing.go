@@ -0,0 +1,227 @@
+package routing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+)
+
+// Source is the part of a request a Condition looks at.
+type Source string
+
+const (
+	SourceHeader Source = "header"
+	SourceQuery  Source = "query"
+	// SourceBody looks up Name as a dot-separated path into a JSON body,
+	// e.g. "tenant.id" or "items.0.sku".
+	SourceBody Source = "body"
+)
+
+// Condition matches the header, query parameter or JSON body field Name
+// against the regular expression Pattern. A value that is absent is matched
+// as empty. JSON strings, numbers and booleans are matched as written;
+// objects, arrays and null are matched as empty.
+type Condition struct {
+	Source  Source
+	Name    string
+	Pattern string
+}
+
+// Rule routes the requests it matches to the backends named in Backends or
+// carrying every label in Labels. Host is matched exactly, ignoring case and
+// port, and PathPrefix as a prefix of the path; empty ones match every
+// request. When none of the selected backends can take a request it is
+// refused, unless Fallback lets it go to any backend.
+type Rule struct {
+	Name       string
+	Host       string
+	PathPrefix string
+	Conditions []Condition
+	Backends   []string
+	Labels     map[string]string
+	Fallback   bool
+}
+
+// Route is a compiled rule.
+type Route struct {
+	Rule
+	conditions []condition
+}
+
+type condition struct {
+	Condition
+	re *regexp.Regexp
+}
+
+// Router matches requests against rules.
+type Router struct {
+	routes       []*Route
+	maxBodyBytes int
+}
+
+// New compiles rules. Body conditions ignore bodies over maxBodyBytes; zero
+// means no limit beyond the inspector's. It fails on invalid patterns and
+// on rules that select no backends.
+func New(rules []Rule, maxBodyBytes int) (*Router, error) {
+	rt := &Router{routes: make([]*Route, 0, len(rules)), maxBodyBytes: maxBodyBytes}
+	for _, r := range rules {
+		route, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("routing rule %q: %w", r.Name, err)
+		}
+		rt.routes = append(rt.routes, route)
+	}
+	return rt, nil
+}
+
+func compile(r Rule) (*Route, error) {
+	if len(r.Backends) == 0 && len(r.Labels) == 0 {
+		return nil, errors.New("selects no backends")
+	}
+
+	route := &Route{Rule: r, conditions: make([]condition, 0, len(r.Conditions))}
+	for _, c := range r.Conditions {
+		switch c.Source {
+		case SourceHeader:
+			c.Name = http.CanonicalHeaderKey(c.Name)
+		case SourceQuery, SourceBody:
+		default:
+			return nil, fmt.Errorf("unknown condition source %q", c.Source)
+		}
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", c.Source, c.Name, err)
+		}
+		route.conditions = append(route.conditions, condition{Condition: c, re: re})
+	}
+	return route, nil
+}
+
+// Match returns the route of the first rule r matches, or nil.
+func (rt *Router) Match(r *http.Request) *Route {
+	var body *jsonBody
+	for _, route := range rt.routes {
+		if route.matches(r, func() *jsonBody {
+			if body == nil {
+				body = rt.parseBody(r)
+			}
+			return body
+		}) {
+			return route
+		}
+	}
+	return nil
+}
+
+// Selects reports whether b is one of the route's backends.
+func (route *Route) Selects(b *backend.Backend) bool {
+	if slices.Contains(route.Backends, b.Name()) {
+		return true
+	}
+	if len(route.Labels) == 0 {
+		return false
+	}
+	for k, v := range route.Labels {
+		if !b.HasLabel(k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (route *Route) matches(r *http.Request, body func() *jsonBody) bool {
+	if route.Host != "" && !strings.EqualFold(route.Host, hostname(r.Host)) {
+		return false
+	}
+	if !strings.HasPrefix(r.URL.Path, route.PathPrefix) {
+		return false
+	}
+	for _, c := range route.conditions {
+		var values []string
+		switch c.Source {
+		case SourceHeader:
+			values = r.Header.Values(c.Name)
+		case SourceQuery:
+			values = r.URL.Query()[c.Name]
+		case SourceBody:
+			if v, ok := body().field(c.Name); ok {
+				values = []string{v}
+			}
+		}
+		if len(values) == 0 {
+			values = []string{""}
+		}
+		if !slices.ContainsFunc(values, c.re.MatchString) {
+			return false
+		}
+	}
+	return true
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// jsonBody is a request body decoded once for every body condition of a
+// request. A nil value holds no fields.
+type jsonBody struct {
+	value any
+}
+
+func (rt *Router) parseBody(r *http.Request) *jsonBody {
+	body, ok := inspect.FromRequest(r)
+	if !ok || (rt.maxBodyBytes > 0 && len(body.Data) > rt.maxBodyBytes) {
+		return &jsonBody{}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body.Data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return &jsonBody{}
+	}
+	return &jsonBody{value: value}
+}
+
+// field returns the value at path as text.
+func (b *jsonBody) field(path string) (string, bool) {
+	v := b.value
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
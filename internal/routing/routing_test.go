@@ -0,0 +1,135 @@
+package routing_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+	"github.com/angeloszaimis/load-balancer/internal/routing"
+)
+
+var _ = Describe("Router", func() {
+	newRouter := func(rules ...routing.Rule) *routing.Router {
+		rt, err := routing.New(rules, 1024)
+		Expect(err).NotTo(HaveOccurred())
+		return rt
+	}
+
+	post := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		r, err := inspect.New(inspect.Options{MaxBytes: 4096, MaxDecodedBytes: 4096}).Prepare(r)
+		Expect(err).NotTo(HaveOccurred())
+		return r
+	}
+
+	matched := func(rt *routing.Router, r *http.Request) string {
+		if route := rt.Match(r); route != nil {
+			return route.Name
+		}
+		return ""
+	}
+
+	It("should match host and path prefix", func() {
+		rt := newRouter(routing.Rule{Name: "api", Host: "API.example.com", PathPrefix: "/v1/", Backends: []string{"a"}})
+
+		Expect(matched(rt, httptest.NewRequest(http.MethodGet, "http://api.example.com:8080/v1/users", nil))).To(Equal("api"))
+		Expect(matched(rt, httptest.NewRequest(http.MethodGet, "http://api.example.com/v2/users", nil))).To(BeEmpty())
+		Expect(matched(rt, httptest.NewRequest(http.MethodGet, "http://www.example.com/v1/users", nil))).To(BeEmpty())
+	})
+
+	It("should match headers and query parameters", func() {
+		rt := newRouter(routing.Rule{Name: "acme", Backends: []string{"a"}, Conditions: []routing.Condition{
+			{Source: routing.SourceHeader, Name: "x-tenant", Pattern: "^acme$"},
+			{Source: routing.SourceQuery, Name: "tenantId", Pattern: "^[0-9]+$"},
+		}})
+
+		r := httptest.NewRequest(http.MethodGet, "/?tenantId=42", nil)
+		r.Header.Set("X-Tenant", "acme")
+		Expect(matched(rt, r)).To(Equal("acme"))
+
+		r = httptest.NewRequest(http.MethodGet, "/?tenantid=42", nil)
+		r.Header.Set("X-Tenant", "acme")
+		Expect(matched(rt, r)).To(BeEmpty())
+	})
+
+	It("should match JSON body fields", func() {
+		rt := newRouter(
+			routing.Rule{Name: "acme", Backends: []string{"a"}, Conditions: []routing.Condition{
+				{Source: routing.SourceBody, Name: "tenant.id", Pattern: "^acme$"},
+			}},
+			routing.Rule{Name: "bulk", Backends: []string{"b"}, Conditions: []routing.Condition{
+				{Source: routing.SourceBody, Name: "items.1.qty", Pattern: "^[0-9]{3,}$"},
+			}},
+		)
+
+		Expect(matched(rt, post(`{"tenant": {"id": "acme"}}`))).To(Equal("acme"))
+		Expect(matched(rt, post(`{"tenant": {"id": "globex"}}`))).To(BeEmpty())
+		Expect(matched(rt, post(`{"items": [{"qty": 1}, {"qty": 500}]}`))).To(Equal("bulk"))
+		Expect(matched(rt, post(`not json`))).To(BeEmpty())
+	})
+
+	It("should match absent values as empty", func() {
+		rt := newRouter(routing.Rule{Name: "anonymous", Backends: []string{"a"}, Conditions: []routing.Condition{
+			{Source: routing.SourceBody, Name: "tenant", Pattern: "^$"},
+		}})
+		Expect(matched(rt, httptest.NewRequest(http.MethodGet, "/", nil))).To(Equal("anonymous"))
+	})
+
+	It("should ignore bodies over the limit", func() {
+		rt := newRouter(routing.Rule{Name: "acme", Backends: []string{"a"}, Conditions: []routing.Condition{
+			{Source: routing.SourceBody, Name: "tenant", Pattern: "acme"},
+		}})
+
+		big := `{"tenant": "acme", "pad": "` + strings.Repeat("x", 2048) + `"}`
+		Expect(matched(rt, post(big))).To(BeEmpty())
+	})
+
+	It("should pick the first matching rule", func() {
+		rt := newRouter(
+			routing.Rule{Name: "first", PathPrefix: "/api", Backends: []string{"a"}},
+			routing.Rule{Name: "second", PathPrefix: "/", Backends: []string{"b"}},
+		)
+		Expect(matched(rt, httptest.NewRequest(http.MethodGet, "/api/x", nil))).To(Equal("first"))
+		Expect(matched(rt, httptest.NewRequest(http.MethodGet, "/other", nil))).To(Equal("second"))
+	})
+
+	It("should select backends by name or by every label", func() {
+		newBackend := func(name string, labels map[string]string) *backend.Backend {
+			u, _ := url.Parse("http://" + name)
+			return backend.New(u, 1, backend.WithName(name), backend.WithLabels(labels))
+		}
+		rt := newRouter(
+			routing.Rule{Name: "named", PathPrefix: "/named", Backends: []string{"a"}},
+			routing.Rule{Name: "labelled", Labels: map[string]string{"tenant": "acme", "tier": "gold"}},
+		)
+
+		named := rt.Match(httptest.NewRequest(http.MethodGet, "/named", nil))
+		Expect(named.Selects(newBackend("a", nil))).To(BeTrue())
+		Expect(named.Selects(newBackend("b", nil))).To(BeFalse())
+
+		labelled := rt.Match(httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(labelled.Selects(newBackend("c", map[string]string{"tenant": "acme", "tier": "gold"}))).To(BeTrue())
+		Expect(labelled.Selects(newBackend("d", map[string]string{"tenant": "acme"}))).To(BeFalse())
+	})
+
+	It("should reject invalid rules", func() {
+		_, err := routing.New([]routing.Rule{{Name: "none"}}, 0)
+		Expect(err).To(MatchError(ContainSubstring("selects no backends")))
+
+		_, err = routing.New([]routing.Rule{{Name: "bad", Backends: []string{"a"}, Conditions: []routing.Condition{
+			{Source: routing.SourceQuery, Name: "q", Pattern: "("},
+		}}}, 0)
+		Expect(err).To(HaveOccurred())
+
+		_, err = routing.New([]routing.Rule{{Name: "bad", Backends: []string{"a"}, Conditions: []routing.Condition{
+			{Source: "cookie", Name: "q"},
+		}}}, 0)
+		Expect(err).To(HaveOccurred())
+	})
+})
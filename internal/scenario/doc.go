@@ -0,0 +1,33 @@
+// Package scenario compares load balancer setups by running each one
+// in-process against demo backends and recording what its traffic met.
+//
+// A Scenario names a strategy, whether circuit breakers are on and how many
+// retries a request gets, and sends its requests through a real handler to
+// backends from testbackend, killing the first one part way through. A
+// Matrix expands a base scenario into every combination of the settings it
+// lists. Nothing is built or started as a separate process, so a run needs
+// no free fixed ports and no platform tools.
+//
+// Usage:
+//
+//	scenarios := scenario.Matrix{
+//		CircuitBreaker: []bool{true, false},
+//		MaxRetries:     []int{2, 0},
+//	}.Scenarios(scenario.Scenario{
+//		Strategy:  "round-robin",
+//		Backends:  5,
+//		Requests:  100,
+//		KillAfter: 30,
+//		Interval:  20 * time.Millisecond,
+//	})
+//
+//	report := scenario.Report{Date: time.Now()}
+//	for _, s := range scenarios {
+//		result, err := scenario.Run(ctx, s)
+//		if err != nil {
+//			return err
+//		}
+//		report.Results = append(report.Results, result)
+//	}
+//	report.WriteMarkdown(os.Stdout)
+package scenario
@@ -0,0 +1,107 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Result is what a scenario's requests met. Latencies are in milliseconds.
+type Result struct {
+	Scenario      Scenario       `json:"scenario"`
+	Requests      int            `json:"requests"`
+	Succeeded     int            `json:"succeeded"`
+	Failed        int            `json:"failed"`
+	SuccessRate   float64        `json:"success_rate"`
+	DurationMs    float64        `json:"duration_ms"`
+	AvgLatencyMs  float64        `json:"avg_latency_ms"`
+	P95LatencyMs  float64        `json:"p95_latency_ms"`
+	MaxLatencyMs  float64        `json:"max_latency_ms"`
+	ThroughputRPS float64        `json:"throughput_rps"`
+	Errors        map[string]int `json:"errors"`
+}
+
+func (r *Result) summarize(latencies []time.Duration, elapsed time.Duration) {
+	r.DurationMs = milliseconds(elapsed)
+	if r.Requests > 0 {
+		r.SuccessRate = float64(r.Succeeded) / float64(r.Requests)
+		r.ThroughputRPS = float64(r.Requests) / elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return
+	}
+
+	slices.Sort(latencies)
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	r.AvgLatencyMs = milliseconds(total / time.Duration(len(latencies)))
+	r.P95LatencyMs = milliseconds(latencies[int(0.95*float64(len(latencies)-1))])
+	r.MaxLatencyMs = milliseconds(latencies[len(latencies)-1])
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Report is the outcome of a set of scenarios.
+type Report struct {
+	Date    time.Time `json:"date"`
+	Results []Result  `json:"results"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as a markdown table with a section listing
+// the errors of every scenario that had any.
+func (r Report) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# Load Balancer Scenario Comparison\n\n")
+	fmt.Fprintf(&sb, "**Test Date:** %s\n\n", r.Date.Format("2006-01-02 15:04:05"))
+	if len(r.Results) > 0 {
+		s := r.Results[0].Scenario
+		fmt.Fprintf(&sb, "**Traffic:** %d requests over %d backends", s.Requests, s.Backends)
+		if s.KillAfter > 0 && s.KillAfter < s.Requests {
+			fmt.Fprintf(&sb, ", one killed after request #%d", s.KillAfter)
+		}
+		fmt.Fprintf(&sb, "\n\n")
+	}
+
+	sb.WriteString("| Scenario | Success Rate | Successful | Failed | Avg Latency | P95 Latency | Max Latency | Throughput |\n")
+	sb.WriteString("|----------|:------------:|:----------:|:------:|:-----------:|:-----------:|:-----------:|:----------:|\n")
+	for _, res := range r.Results {
+		fmt.Fprintf(&sb, "| %s | %.1f%% | %d | %d | %.2f ms | %.2f ms | %.2f ms | %.1f req/s |\n",
+			res.Scenario.Name, res.SuccessRate*100, res.Succeeded, res.Failed,
+			res.AvgLatencyMs, res.P95LatencyMs, res.MaxLatencyMs, res.ThroughputRPS)
+	}
+
+	sb.WriteString("\n## Errors Observed\n")
+	for _, res := range r.Results {
+		fmt.Fprintf(&sb, "\n### %s\n", res.Scenario.Name)
+		if len(res.Errors) == 0 {
+			sb.WriteString("_No errors_\n")
+			continue
+		}
+		kinds := make([]string, 0, len(res.Errors))
+		for kind := range res.Errors {
+			kinds = append(kinds, kind)
+		}
+		slices.Sort(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(&sb, "- `%s` ×%d\n", kind, res.Errors[kind])
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
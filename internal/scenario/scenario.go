@@ -0,0 +1,225 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/healthcheck"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+	"github.com/angeloszaimis/load-balancer/internal/testbackend"
+)
+
+// Circuit breaker settings of every scenario that enables it, the defaults of
+// circuit_breaker.
+const (
+	FailureThreshold = 5
+	ResetTimeout     = 30 * time.Second
+)
+
+// strategies are the strategies a scenario may name: those that need no
+// settings beyond the config defaults. Run builds them with those defaults,
+// as the balancer would.
+var strategies = []string{
+	"round-robin",
+	"random",
+	"least-conn",
+	"least-response",
+	"weighted-round-robin",
+	"weighted-random",
+	"weighted-alias",
+	"consistent_hash",
+	"ip-hash",
+	"peak-ewma",
+	"p95",
+	"warm",
+}
+
+// Strategies returns the strategy names a Scenario accepts, sorted.
+func Strategies() []string {
+	names := slices.Clone(strategies)
+	slices.Sort(names)
+	return names
+}
+
+// Scenario is one load balancer setup and the traffic sent through it. Requests
+// are sent one after another, Interval apart; after KillAfter of them the first
+// backend dies. A KillAfter of zero or at least Requests keeps every backend up.
+type Scenario struct {
+	Name                string        `json:"name"`
+	Strategy            string        `json:"strategy"`
+	CircuitBreaker      bool          `json:"circuit_breaker"`
+	MaxRetries          int           `json:"max_retries"`
+	Backends            int           `json:"backends"`
+	Requests            int           `json:"requests"`
+	KillAfter           int           `json:"kill_after"`
+	Interval            time.Duration `json:"-"`
+	HealthCheckInterval time.Duration `json:"-"`
+}
+
+// Matrix expands a base scenario into every combination of the values it
+// lists. Empty lists keep the base scenario's value.
+type Matrix struct {
+	Strategies     []string
+	CircuitBreaker []bool
+	MaxRetries     []int
+}
+
+// Scenarios returns one scenario per combination, named after the values that
+// set it apart.
+func (m Matrix) Scenarios(base Scenario) []Scenario {
+	strats := m.Strategies
+	if len(strats) == 0 {
+		strats = []string{base.Strategy}
+	}
+	breakers := m.CircuitBreaker
+	if len(breakers) == 0 {
+		breakers = []bool{base.CircuitBreaker}
+	}
+	retries := m.MaxRetries
+	if len(retries) == 0 {
+		retries = []int{base.MaxRetries}
+	}
+
+	var scenarios []Scenario
+	for _, strat := range strats {
+		for _, cb := range breakers {
+			for _, r := range retries {
+				s := base
+				s.Strategy, s.CircuitBreaker, s.MaxRetries = strat, cb, r
+				s.Name = name(s)
+				scenarios = append(scenarios, s)
+			}
+		}
+	}
+	return scenarios
+}
+
+func name(s Scenario) string {
+	cb := "without circuit breaker"
+	if s.CircuitBreaker {
+		cb = "with circuit breaker"
+	}
+	return fmt.Sprintf("%s, %s, %d retries", s.Strategy, cb, s.MaxRetries)
+}
+
+// Run starts the scenario's backends and a load balancer in front of them,
+// sends its requests and tears everything down again. A request succeeds
+// unless it fails to connect or gets a 5xx.
+func Run(ctx context.Context, s Scenario) (Result, error) {
+	if !slices.Contains(strategies, s.Strategy) {
+		return Result{}, fmt.Errorf("unknown strategy %q", s.Strategy)
+	}
+	if s.Backends < 1 {
+		return Result{}, fmt.Errorf("scenario %q needs at least one backend", s.Name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	servers := make([]*testbackend.Server, 0, s.Backends)
+	defer func() { testbackend.CloseAll(servers) }()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	backends := make([]*backend.Backend, 0, s.Backends)
+	for range s.Backends {
+		srv, err := testbackend.Start("127.0.0.1:0")
+		if err != nil {
+			return Result{}, err
+		}
+		servers = append(servers, srv)
+
+		b := backend.New(&url.URL{Scheme: "http", Host: srv.Addr().String()}, 1)
+		b.SetHealthy(true)
+		backends = append(backends, b)
+		if s.HealthCheckInterval > 0 {
+			goroutines.Go("healthcheck", func() {
+				healthcheck.Run(ctx, b, healthcheck.HTTP{Timeout: time.Second}, s.HealthCheckInterval, logger)
+			})
+		}
+	}
+
+	var registry *circuitbreaker.Registry
+	if s.CircuitBreaker {
+		registry = circuitbreaker.NewRegistry(FailureThreshold, ResetTimeout)
+	}
+	stratCfg := config.Defaults().Strategy
+	stratCfg.Type = s.Strategy
+	strat, err := strategy.FromConfig(logger, stratCfg)
+	if err != nil {
+		return Result{}, err
+	}
+	lb := loadbalancer.NewLoadBalancer(strat)
+	h := handler.NewLoadBalancerHandler(logger, lb, backends, nil, registry, s.MaxRetries)
+
+	front := httptest.NewServer(h)
+	defer front.Close()
+
+	return send(ctx, s, front.URL, servers[0]), nil
+}
+
+// send runs the scenario's requests against target, killing victim on the way.
+func send(ctx context.Context, s Scenario, target string, victim *testbackend.Server) Result {
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+
+	result := Result{Scenario: s, Errors: make(map[string]int)}
+	latencies := make([]time.Duration, 0, s.Requests)
+	start := time.Now()
+
+	for i := range s.Requests {
+		if ctx.Err() != nil {
+			break
+		}
+		if i == s.KillAfter && i > 0 {
+			victim.Close()
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		sent := time.Now()
+		resp, err := client.Get(target + "/health")
+		latencies = append(latencies, time.Since(sent))
+		result.Requests++
+
+		switch {
+		case err != nil:
+			result.Failed++
+			result.Errors[errorKind(err)]++
+		case resp.StatusCode >= 500:
+			result.Failed++
+			result.Errors[fmt.Sprintf("HTTP %d", resp.StatusCode)]++
+		default:
+			result.Succeeded++
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		time.Sleep(s.Interval)
+	}
+
+	result.summarize(latencies, time.Since(start))
+	return result
+}
+
+func errorKind(err error) string {
+	msg := err.Error()
+	if len(msg) > 80 {
+		msg = msg[:80] + "..."
+	}
+	return strings.TrimSpace(msg)
+}
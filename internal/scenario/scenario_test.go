@@ -0,0 +1,119 @@
+package scenario_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/scenario"
+)
+
+var _ = Describe("Scenario", func() {
+	base := scenario.Scenario{
+		Strategy:  "round-robin",
+		Backends:  3,
+		Requests:  30,
+		KillAfter: 5,
+	}
+
+	Describe("Matrix", func() {
+		It("should expand every combination", func() {
+			scenarios := scenario.Matrix{
+				Strategies:     []string{"round-robin", "least-conn"},
+				CircuitBreaker: []bool{true, false},
+			}.Scenarios(base)
+
+			Expect(scenarios).To(HaveLen(4))
+			Expect(scenarios[1].Strategy).To(Equal("round-robin"))
+			Expect(scenarios[1].CircuitBreaker).To(BeFalse())
+			Expect(scenarios[1].Name).To(Equal("round-robin, without circuit breaker, 0 retries"))
+			Expect(scenarios[2].Strategy).To(Equal("least-conn"))
+			Expect(scenarios[2].Requests).To(Equal(30))
+		})
+
+		It("should keep the base scenario without values", func() {
+			scenarios := scenario.Matrix{}.Scenarios(base)
+			Expect(scenarios).To(HaveLen(1))
+			Expect(scenarios[0].Strategy).To(Equal("round-robin"))
+		})
+	})
+
+	Describe("Run", func() {
+		It("should recover from the killed backend with retries", func() {
+			s := base
+			s.CircuitBreaker, s.MaxRetries = true, 2
+			result, err := scenario.Run(context.Background(), s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requests).To(Equal(30))
+			Expect(result.Succeeded).To(Equal(30))
+			Expect(result.Errors).To(BeEmpty())
+		})
+
+		It("should fail requests sent to the killed backend without retries", func() {
+			result, err := scenario.Run(context.Background(), base)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Failed).To(BeNumerically(">", 0))
+			Expect(result.Errors).To(HaveKeyWithValue("HTTP 503", result.Failed))
+			Expect(result.SuccessRate).To(BeNumerically("<", 1))
+		})
+
+		It("should reject an unknown strategy", func() {
+			s := base
+			s.Strategy = "fastest"
+			_, err := scenario.Run(context.Background(), s)
+			Expect(err).To(MatchError(ContainSubstring("fastest")))
+		})
+	})
+
+	Describe("Report", func() {
+		var report scenario.Report
+
+		BeforeEach(func() {
+			s := base
+			s.Name = "round-robin, without circuit breaker, 0 retries"
+			report = scenario.Report{
+				Date: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+				Results: []scenario.Result{{
+					Scenario:    s,
+					Requests:    30,
+					Succeeded:   27,
+					Failed:      3,
+					SuccessRate: 0.9,
+					Errors:      map[string]int{"HTTP 503": 3},
+				}},
+			}
+		})
+
+		It("should write JSON", func() {
+			var buf bytes.Buffer
+			Expect(report.WriteJSON(&buf)).To(Succeed())
+
+			var decoded struct {
+				Results []struct {
+					Scenario struct {
+						Strategy string `json:"strategy"`
+					} `json:"scenario"`
+					Failed int            `json:"failed"`
+					Errors map[string]int `json:"errors"`
+				} `json:"results"`
+			}
+			Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+			Expect(decoded.Results).To(HaveLen(1))
+			Expect(decoded.Results[0].Scenario.Strategy).To(Equal("round-robin"))
+			Expect(decoded.Results[0].Failed).To(Equal(3))
+			Expect(decoded.Results[0].Errors).To(HaveKeyWithValue("HTTP 503", 3))
+		})
+
+		It("should write a markdown table", func() {
+			var buf bytes.Buffer
+			Expect(report.WriteMarkdown(&buf)).To(Succeed())
+			Expect(buf.String()).To(ContainSubstring("one killed after request #5"))
+			Expect(buf.String()).To(ContainSubstring("| round-robin, without circuit breaker, 0 retries | 90.0% | 27 | 3 |"))
+			Expect(buf.String()).To(ContainSubstring("- `HTTP 503` ×3"))
+		})
+	})
+})
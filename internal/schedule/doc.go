@@ -0,0 +1,21 @@
+// Package schedule applies traffic policies on a cron schedule.
+//
+// Each Rule opens a window of Duration every time its cron expression fires.
+// While the window is open the rule's action is in force:
+//
+//   - ActionWeight sets the weight of the listed backends.
+//   - ActionMaintenance takes the listed backends out of rotation.
+//   - ActionPool switches traffic to the listed backends by taking every
+//     other backend out of rotation. Standby backends in the pool are
+//     activated by the standby pool like on any other outage.
+//
+// When the window closes the backends return to their configured weight and
+// leave maintenance. Rules are applied in order, so for overlapping weight
+// rules the last one wins.
+//
+// Usage:
+//
+//	scheduler := schedule.NewScheduler(rules, pool, logger)
+//	scheduler.Start(ctx, 15*time.Second)
+//	upcoming := scheduler.Upcoming(time.Now())
+package schedule
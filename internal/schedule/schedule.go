@@ -0,0 +1,257 @@
+package schedule
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/cron"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+type Action string
+
+const (
+	ActionWeight      Action = "weight"
+	ActionMaintenance Action = "maintenance"
+	ActionPool        Action = "pool"
+)
+
+// Rule is a scheduled policy. Backends are matched by name, URL or
+// configured URL.
+type Rule struct {
+	Name     string
+	Cron     string
+	Expr     cron.Expression
+	Duration time.Duration
+	Location *time.Location
+	Action   Action
+	Backends []string
+	Weight   int
+}
+
+// Status describes a rule as of a point in time. ActiveUntil is set while
+// the rule is in force; NextStart is the next time its window opens.
+type Status struct {
+	Name        string     `json:"name"`
+	Cron        string     `json:"cron"`
+	Timezone    string     `json:"timezone"`
+	Duration    string     `json:"duration"`
+	Action      Action     `json:"action"`
+	Backends    []string   `json:"backends"`
+	Weight      *int       `json:"weight,omitempty"`
+	Active      bool       `json:"active"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	NextStart   *time.Time `json:"next_start,omitempty"`
+}
+
+type Scheduler struct {
+	rules  []Rule
+	pool   *backend.Pool
+	logger *slog.Logger
+
+	mutex sync.Mutex
+	// weighted holds the weight the scheduler holds on each backend, so it
+	// only releases weights it set itself.
+	weighted map[*backend.Backend]int
+	// maintained holds the backends the scheduler put in maintenance, so it
+	// only takes backends out of maintenance it put there itself.
+	maintained map[*backend.Backend]bool
+	// unmatched holds the rule backend references no backend in the pool
+	// matched at the last evaluation, so each is reported once.
+	unmatched map[string]bool
+}
+
+// NewScheduler applies rules to the backends in pool, as they are when the
+// rules are evaluated.
+func NewScheduler(rules []Rule, pool *backend.Pool, logger *slog.Logger) *Scheduler {
+	for i := range rules {
+		if rules[i].Location == nil {
+			rules[i].Location = time.Local
+		}
+	}
+	return &Scheduler{
+		rules:      rules,
+		pool:       pool,
+		logger:     logger,
+		weighted:   make(map[*backend.Backend]int),
+		maintained: make(map[*backend.Backend]bool),
+		unmatched:  make(map[string]bool),
+	}
+}
+
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	goroutines.Go("schedule", func() { s.run(ctx, interval) })
+}
+
+func (s *Scheduler) run(ctx context.Context, interval time.Duration) {
+	s.Evaluate(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Evaluate(now)
+		}
+	}
+}
+
+// Evaluate puts the backends in the state the rules in force at now call
+// for. Backend references that match no backend in the pool are reported,
+// and a rule none of whose references match is not applied, so a mistyped
+// pool switch does not take every backend out of rotation.
+func (s *Scheduler) Evaluate(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	backends := s.pool.Backends()
+	weights := make(map[*backend.Backend]int)
+	maintenance := make(map[*backend.Backend]bool)
+	matched := s.match(backends)
+
+	for i, rule := range s.rules {
+		if _, active := rule.window(now); !active || !matched[i] {
+			continue
+		}
+		for _, b := range backends {
+			listed := rule.lists(b)
+			switch rule.Action {
+			case ActionWeight:
+				if listed {
+					weights[b] = rule.Weight
+				}
+			case ActionMaintenance:
+				if listed {
+					maintenance[b] = true
+				}
+			case ActionPool:
+				if !listed {
+					maintenance[b] = true
+				}
+			}
+		}
+	}
+
+	for _, b := range backends {
+		if weight, ok := weights[b]; ok {
+			if held, ok := s.weighted[b]; !ok || held != weight {
+				b.HoldWeight(backend.OwnerSchedule, weight)
+				s.weighted[b] = weight
+				s.logger.Info("Scheduled weight applied",
+					slog.String("backend", b.Name()),
+					slog.Int("weight", weight))
+			}
+		} else if _, ok := s.weighted[b]; ok {
+			b.ReleaseWeight(backend.OwnerSchedule)
+			delete(s.weighted, b)
+			s.logger.Info("Scheduled weight ended",
+				slog.String("backend", b.Name()),
+				slog.Int("weight", b.BaseWeight()))
+		}
+
+		switch {
+		case maintenance[b] && !s.maintained[b]:
+			s.maintained[b] = true
+			if b.Enter(backend.OwnerSchedule, backend.StateMaintenance) {
+				s.logger.Warn("Backend entered scheduled maintenance", slog.String("backend", b.Name()))
+			}
+		case !maintenance[b] && s.maintained[b]:
+			delete(s.maintained, b)
+			if b.Leave(backend.OwnerSchedule, backend.StateMaintenance) {
+				s.logger.Info("Backend left scheduled maintenance", slog.String("backend", b.Name()))
+			}
+		}
+	}
+}
+
+// match reports, by position, the rules at least one of whose references
+// matches one of backends, and logs the references that newly match none.
+func (s *Scheduler) match(backends []*backend.Backend) []bool {
+	matched := make([]bool, len(s.rules))
+	unmatched := make(map[string]bool)
+	for i, rule := range s.rules {
+		for _, ref := range rule.Backends {
+			if slices.ContainsFunc(backends, func(b *backend.Backend) bool { return refers(ref, b) }) {
+				matched[i] = true
+				continue
+			}
+			key := rule.Name + "\x00" + ref
+			unmatched[key] = true
+			if !s.unmatched[key] {
+				s.logger.Warn("Scheduled rule lists an unknown backend",
+					slog.String("rule", rule.Name),
+					slog.String("backend", ref))
+			}
+		}
+	}
+	s.unmatched = unmatched
+	return matched
+}
+
+// Forget drops whether the scheduler changed b's weight or maintenance, for
+// backends that left the pool.
+func (s *Scheduler) Forget(b *backend.Backend) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.weighted, b)
+	delete(s.maintained, b)
+}
+
+// Upcoming reports every rule's state at now, in configuration order.
+func (s *Scheduler) Upcoming(now time.Time) []Status {
+	statuses := make([]Status, 0, len(s.rules))
+	for _, rule := range s.rules {
+		status := Status{
+			Name:     rule.Name,
+			Cron:     rule.Cron,
+			Timezone: rule.Location.String(),
+			Duration: rule.Duration.String(),
+			Action:   rule.Action,
+			Backends: rule.Backends,
+		}
+		if rule.Action == ActionWeight {
+			status.Weight = &rule.Weight
+		}
+		if until, active := rule.window(now); active {
+			status.Active = true
+			status.ActiveUntil = &until
+		}
+		if next := rule.Expr.Next(now.In(rule.Location)); !next.IsZero() {
+			status.NextStart = &next
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// window reports whether the rule is in force at now and, if so, when its
+// window closes. Windows opened by consecutive firings may overlap, in which
+// case they extend each other.
+func (r Rule) window(now time.Time) (until time.Time, active bool) {
+	start := r.Expr.Next(now.In(r.Location).Add(-r.Duration))
+	if start.IsZero() || start.After(now) {
+		return time.Time{}, false
+	}
+	for {
+		next := r.Expr.Next(start)
+		if next.IsZero() || next.After(now) {
+			return start.Add(r.Duration), true
+		}
+		start = next
+	}
+}
+
+func (r Rule) lists(b *backend.Backend) bool {
+	return slices.ContainsFunc(r.Backends, func(ref string) bool { return refers(ref, b) })
+}
+
+func refers(ref string, b *backend.Backend) bool {
+	return ref == b.Name() || ref == b.URL().String() || ref == b.Origin()
+}
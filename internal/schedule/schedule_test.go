@@ -0,0 +1,149 @@
+package schedule_test
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/cron"
+	"github.com/angeloszaimis/load-balancer/internal/schedule"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		backends []*backend.Backend
+		log      *slog.Logger
+	)
+
+	// Nightly at 02:00 UTC for an hour.
+	nightly := func(action schedule.Action, refs ...string) schedule.Rule {
+		expr, err := cron.Parse("0 2 * * *")
+		Expect(err).NotTo(HaveOccurred())
+		return schedule.Rule{
+			Name:     "nightly",
+			Cron:     "0 2 * * *",
+			Expr:     expr,
+			Duration: time.Hour,
+			Location: time.UTC,
+			Action:   action,
+			Backends: refs,
+		}
+	}
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, time.March, 4, hour, minute, 0, 0, time.UTC)
+	}
+
+	available := func() []bool {
+		states := make([]bool, len(backends))
+		for i, b := range backends {
+			states[i] = b.IsAvailable()
+		}
+		return states
+	}
+
+	BeforeEach(func() {
+		backends = nil
+		for _, raw := range []string{"http://10.0.0.1", "http://10.0.0.2", "http://10.0.0.3"} {
+			u, _ := url.Parse(raw)
+			b := backend.New(u, 5)
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	})
+
+	It("should put listed backends in maintenance only during the window", func() {
+		s := schedule.NewScheduler([]schedule.Rule{nightly(schedule.ActionMaintenance, "http://10.0.0.1")}, backend.NewPool(backends), log)
+
+		s.Evaluate(at(1, 59))
+		Expect(available()).To(Equal([]bool{true, true, true}))
+
+		s.Evaluate(at(2, 0))
+		Expect(available()).To(Equal([]bool{false, true, true}))
+		Expect(backends[0].InMaintenance()).To(BeTrue())
+
+		s.Evaluate(at(3, 0))
+		Expect(available()).To(Equal([]bool{true, true, true}))
+	})
+
+	It("should switch traffic to the listed pool", func() {
+		s := schedule.NewScheduler([]schedule.Rule{nightly(schedule.ActionPool, "http://10.0.0.2", "http://10.0.0.3")}, backend.NewPool(backends), log)
+
+		s.Evaluate(at(2, 30))
+		Expect(available()).To(Equal([]bool{false, true, true}))
+	})
+
+	It("should not apply a rule that lists no backend in the pool", func() {
+		s := schedule.NewScheduler([]schedule.Rule{nightly(schedule.ActionPool, "http://10.0.0.9")}, backend.NewPool(backends), log)
+
+		s.Evaluate(at(2, 30))
+		Expect(available()).To(Equal([]bool{true, true, true}))
+	})
+
+	It("should only take backends out of maintenance it put there", func() {
+		backends[1].SetMaintenance(true)
+		s := schedule.NewScheduler([]schedule.Rule{nightly(schedule.ActionMaintenance, "http://10.0.0.1", "http://10.0.0.2")}, backend.NewPool(backends), log)
+
+		s.Evaluate(at(2, 30))
+		Expect(available()).To(Equal([]bool{false, false, true}))
+
+		s.Evaluate(at(3, 30))
+		Expect(available()).To(Equal([]bool{true, false, true}))
+	})
+
+	It("should set weights during the window and restore the configured weight after", func() {
+		rule := nightly(schedule.ActionWeight, "http://10.0.0.3")
+		rule.Weight = 20
+		s := schedule.NewScheduler([]schedule.Rule{rule}, backend.NewPool(backends), log)
+
+		s.Evaluate(at(2, 30))
+		Expect(backends[2].Weight()).To(Equal(20))
+		Expect(backends[0].Weight()).To(Equal(5))
+
+		s.Evaluate(at(3, 30))
+		Expect(backends[2].Weight()).To(Equal(5))
+	})
+
+	It("should leave weights it did not set alone", func() {
+		backends[0].SetWeight(9)
+		s := schedule.NewScheduler([]schedule.Rule{nightly(schedule.ActionWeight, "http://10.0.0.3")}, backend.NewPool(backends), log)
+
+		s.Evaluate(at(3, 30))
+		Expect(backends[0].Weight()).To(Equal(9))
+	})
+
+	It("should not undo a weight an operator set when its window ends", func() {
+		rule := nightly(schedule.ActionWeight, "http://10.0.0.3")
+		rule.Weight = 20
+		s := schedule.NewScheduler([]schedule.Rule{rule}, backend.NewPool(backends), log)
+
+		s.Evaluate(at(2, 30))
+		backends[2].HoldWeight(backend.OwnerAdmin, 8)
+		Expect(backends[2].Weight()).To(Equal(8))
+
+		s.Evaluate(at(3, 30))
+		Expect(backends[2].Weight()).To(Equal(8))
+	})
+
+	It("should report the active window and the next start", func() {
+		s := schedule.NewScheduler([]schedule.Rule{nightly(schedule.ActionMaintenance, "http://10.0.0.1")}, backend.NewPool(backends), log)
+
+		statuses := s.Upcoming(at(2, 15))
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].Active).To(BeTrue())
+		Expect(*statuses[0].ActiveUntil).To(BeTemporally("==", at(3, 0)))
+		Expect(*statuses[0].NextStart).To(BeTemporally("==", at(2, 0).AddDate(0, 0, 1)))
+		Expect(statuses[0].Timezone).To(Equal("UTC"))
+
+		statuses = s.Upcoming(at(1, 0))
+		Expect(statuses[0].Active).To(BeFalse())
+		Expect(statuses[0].ActiveUntil).To(BeNil())
+		Expect(*statuses[0].NextStart).To(BeTemporally("==", at(2, 0)))
+	})
+})
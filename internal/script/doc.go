@@ -0,0 +1,43 @@
+// Package script runs routing hooks written in a small expression language
+// on every request, for logic the routing rules and WAF cannot express,
+// without recompiling the balancer.
+//
+// A Hook holds expressions. When decides whether the hook applies to a
+// request; Group picks the backend group the request goes to and Headers
+// the values of headers to set on it; Reject refuses it with a status.
+// Hooks are evaluated in order: every hook that applies sets its headers,
+// the first to pick a non-empty group decides the group, and the first to
+// reject ends the evaluation.
+//
+// Expressions are statically typed, with strings, ints and bools, and are
+// type checked when compiled. They can read the variables method, path,
+// host, proto and client_ip, and call:
+//
+//	header(name), query(name), cookie(name)   string, empty when absent
+//	has_header(name)                          bool
+//	starts_with(s, p), ends_with(s, p),
+//	contains(s, sub), matches(s, "regexp")    bool
+//	lower(s), upper(s), string(i)             string
+//	len(s), int(s), hash(s)                   int
+//
+// Operators are ! && || == != < <= > >= + - * / % and c ? a : b; + also
+// joins strings. String literals take single or double quotes.
+//
+// The language is deliberately this small rather than CEL or Starlark.
+// Hooks only need to read a request and return a bool or a string, which
+// the handful of functions above covers; cel-go would bring in ANTLR,
+// protobuf and genproto for that, and Starlark a full interpreter with
+// loops, where these expressions are guaranteed to finish in time linear
+// in their size and are type checked once, when the configuration loads.
+// Should hooks outgrow it, the Hook fields are plain strings and can be
+// compiled by another engine behind New without changing the config.
+//
+// Usage:
+//
+//	engine, err := script.New([]script.Hook{{
+//		Name:  "canary",
+//		When:  `has_header("X-Beta") || hash(client_ip) % 100 < 5`,
+//		Group: `"canary"`,
+//	}})
+//	d := engine.Run(r, clientIP)
+package script
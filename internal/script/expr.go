@@ -0,0 +1,523 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of an expression's value.
+type Type string
+
+const (
+	TypeString Type = "string"
+	TypeInt    Type = "int"
+	TypeBool   Type = "bool"
+)
+
+// Expr is a compiled expression. Its type is known once compiled, so
+// evaluating it only fails on a value the expression cannot handle, such as
+// int("abc") or a division by zero.
+type Expr struct {
+	src  string
+	node node
+}
+
+// Compile parses and type checks src, which must evaluate to a value of
+// type want.
+func Compile(src string, want Type) (*Expr, error) {
+	p := &parser{lex: lexer{src: src}}
+	p.next()
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.unexpected()
+	}
+	if n.typ != want {
+		return nil, fmt.Errorf("expression is %s, want %s", n.typ, want)
+	}
+	return &Expr{src: src, node: n}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Request is what an expression can see of a request.
+type Request struct {
+	HTTP     *http.Request
+	ClientIP string
+}
+
+// Bool evaluates an expression compiled as TypeBool.
+func (e *Expr) Bool(req *Request) (bool, error) {
+	v, err := e.node.eval(req)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// Text evaluates an expression compiled as TypeString.
+func (e *Expr) Text(req *Request) (string, error) {
+	v, err := e.node.eval(req)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// node is a type checked expression evaluating to a string, an int64 or a
+// bool as given by typ.
+type node struct {
+	typ  Type
+	eval func(*Request) (any, error)
+}
+
+func constant(typ Type, v any) node {
+	return node{typ: typ, eval: func(*Request) (any, error) { return v, nil }}
+}
+
+// variables are the request attributes expressions can name.
+var variables = map[string]func(*Request) string{
+	"method":    func(req *Request) string { return req.HTTP.Method },
+	"path":      func(req *Request) string { return req.HTTP.URL.Path },
+	"host":      func(req *Request) string { return hostname(req.HTTP.Host) },
+	"proto":     func(req *Request) string { return req.HTTP.Proto },
+	"client_ip": func(req *Request) string { return req.ClientIP },
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// call applies a function to the values of its arguments.
+type call func(req *Request, args []any) (any, error)
+
+// function is a built-in function. Arguments are type checked against args
+// before compile is called with the text of those that are string literals.
+type function struct {
+	args    []Type
+	result  Type
+	compile func(literals []*string) (call, error)
+}
+
+// simple wraps a function that cannot fail and needs no compile step.
+func simple(result Type, f func(*Request, []any) any, args ...Type) function {
+	return function{args: args, result: result, compile: func([]*string) (call, error) {
+		return func(req *Request, v []any) (any, error) { return f(req, v), nil }, nil
+	}}
+}
+
+var functions = map[string]function{
+	"header": simple(TypeString, func(req *Request, v []any) any {
+		return req.HTTP.Header.Get(v[0].(string))
+	}, TypeString),
+	"has_header": simple(TypeBool, func(req *Request, v []any) any {
+		return len(req.HTTP.Header.Values(v[0].(string))) > 0
+	}, TypeString),
+	"query": simple(TypeString, func(req *Request, v []any) any {
+		return req.HTTP.URL.Query().Get(v[0].(string))
+	}, TypeString),
+	"cookie": simple(TypeString, func(req *Request, v []any) any {
+		if c, err := req.HTTP.Cookie(v[0].(string)); err == nil {
+			return c.Value
+		}
+		return ""
+	}, TypeString),
+	"starts_with": simple(TypeBool, func(_ *Request, v []any) any {
+		return strings.HasPrefix(v[0].(string), v[1].(string))
+	}, TypeString, TypeString),
+	"ends_with": simple(TypeBool, func(_ *Request, v []any) any {
+		return strings.HasSuffix(v[0].(string), v[1].(string))
+	}, TypeString, TypeString),
+	"contains": simple(TypeBool, func(_ *Request, v []any) any {
+		return strings.Contains(v[0].(string), v[1].(string))
+	}, TypeString, TypeString),
+	"lower": simple(TypeString, func(_ *Request, v []any) any {
+		return strings.ToLower(v[0].(string))
+	}, TypeString),
+	"upper": simple(TypeString, func(_ *Request, v []any) any {
+		return strings.ToUpper(v[0].(string))
+	}, TypeString),
+	"len": simple(TypeInt, func(_ *Request, v []any) any {
+		return int64(len(v[0].(string)))
+	}, TypeString),
+	"string": simple(TypeString, func(_ *Request, v []any) any {
+		return strconv.FormatInt(v[0].(int64), 10)
+	}, TypeInt),
+	// hash spreads values evenly over the non-negative ints, so
+	// hash(client_ip) % 100 < 5 picks a stable 5% of the clients.
+	"hash": simple(TypeInt, func(_ *Request, v []any) any {
+		h := fnv.New32a()
+		h.Write([]byte(v[0].(string)))
+		return int64(h.Sum32())
+	}, TypeString),
+	"int": {args: []Type{TypeString}, result: TypeInt, compile: func([]*string) (call, error) {
+		return func(_ *Request, v []any) (any, error) {
+			i, err := strconv.ParseInt(strings.TrimSpace(v[0].(string)), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("int(%q): not an integer", v[0])
+			}
+			return i, nil
+		}, nil
+	}},
+	// matches compiles its pattern once, so the pattern must be a literal.
+	"matches": {args: []Type{TypeString, TypeString}, result: TypeBool, compile: func(literals []*string) (call, error) {
+		if literals[1] == nil {
+			return nil, errors.New("matches: pattern must be a string literal")
+		}
+		re, err := regexp.Compile(*literals[1])
+		if err != nil {
+			return nil, fmt.Errorf("matches: %w", err)
+		}
+		return func(_ *Request, v []any) (any, error) { return re.MatchString(v[0].(string)), nil }, nil
+	}},
+}
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+// peek returns the token after the current one.
+func (p *parser) peek() token {
+	lex := p.lex
+	return lex.next()
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokEOF {
+		return errors.New("unexpected end of expression")
+	}
+	if p.tok.kind == tokInvalid {
+		return fmt.Errorf("%s at offset %d", p.tok.text, p.tok.pos)
+	}
+	return fmt.Errorf("unexpected %q at offset %d", p.tok.text, p.tok.pos)
+}
+
+func (p *parser) expect(text string) error {
+	if p.tok.kind != tokPunct || p.tok.text != text {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+// parseExpr parses a conditional, the lowest precedence expression.
+func (p *parser) parseExpr() (node, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil || !p.is("?") {
+		return cond, err
+	}
+	pos := p.tok.pos
+	p.next()
+	then, err := p.parseExpr()
+	if err != nil {
+		return node{}, err
+	}
+	if err := p.expect(":"); err != nil {
+		return node{}, err
+	}
+	els, err := p.parseExpr()
+	if err != nil {
+		return node{}, err
+	}
+	if cond.typ != TypeBool {
+		return node{}, fmt.Errorf("condition at offset %d is %s, want bool", pos, cond.typ)
+	}
+	if then.typ != els.typ {
+		return node{}, fmt.Errorf("branches at offset %d are %s and %s", pos, then.typ, els.typ)
+	}
+	return node{typ: then.typ, eval: func(req *Request) (any, error) {
+		c, err := cond.eval(req)
+		if err != nil {
+			return nil, err
+		}
+		if c.(bool) {
+			return then.eval(req)
+		}
+		return els.eval(req)
+	}}, nil
+}
+
+func (p *parser) is(text string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == text
+}
+
+// precedence lists the binary operators from the loosest to the tightest.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return node{}, err
+	}
+	for p.tok.kind == tokPunct && slices.Contains(precedence[level], p.tok.text) {
+		op, pos := p.tok.text, p.tok.pos
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return node{}, err
+		}
+		if left, err = binary(op, pos, left, right); err != nil {
+			return node{}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if !p.is("!") && !p.is("-") {
+		return p.parsePrimary()
+	}
+	op, pos := p.tok.text, p.tok.pos
+	p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return node{}, err
+	}
+	switch {
+	case op == "!" && operand.typ == TypeBool:
+		return node{typ: TypeBool, eval: func(req *Request) (any, error) {
+			v, err := operand.eval(req)
+			if err != nil {
+				return nil, err
+			}
+			return !v.(bool), nil
+		}}, nil
+	case op == "-" && operand.typ == TypeInt:
+		return node{typ: TypeInt, eval: func(req *Request) (any, error) {
+			v, err := operand.eval(req)
+			if err != nil {
+				return nil, err
+			}
+			return -v.(int64), nil
+		}}, nil
+	}
+	return node{}, fmt.Errorf("operator %s at offset %d does not apply to %s", op, pos, operand.typ)
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		p.next()
+		return constant(TypeString, tok.text), nil
+	case tokInt:
+		p.next()
+		i, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return node{}, fmt.Errorf("invalid number %s at offset %d", tok.text, tok.pos)
+		}
+		return constant(TypeInt, i), nil
+	case tokIdent:
+		p.next()
+		if p.is("(") {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "true":
+			return constant(TypeBool, true), nil
+		case "false":
+			return constant(TypeBool, false), nil
+		}
+		get, ok := variables[tok.text]
+		if !ok {
+			return node{}, fmt.Errorf("unknown variable %s at offset %d", tok.text, tok.pos)
+		}
+		return node{typ: TypeString, eval: func(req *Request) (any, error) { return get(req), nil }}, nil
+	case tokPunct:
+		if tok.text == "(" {
+			p.next()
+			n, err := p.parseExpr()
+			if err != nil {
+				return node{}, err
+			}
+			return n, p.expect(")")
+		}
+	}
+	return node{}, p.unexpected()
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	f, ok := functions[name.text]
+	if !ok {
+		return node{}, fmt.Errorf("unknown function %s at offset %d", name.text, name.pos)
+	}
+	p.next()
+
+	var args []node
+	var literals []*string
+	for !p.is(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return node{}, err
+			}
+		}
+		var literal *string
+		if p.tok.kind == tokString {
+			if after := p.peek(); after.kind == tokPunct && (after.text == "," || after.text == ")") {
+				text := p.tok.text
+				literal = &text
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return node{}, err
+		}
+		args = append(args, arg)
+		literals = append(literals, literal)
+	}
+	p.next()
+
+	if len(args) != len(f.args) {
+		return node{}, fmt.Errorf("%s at offset %d takes %d arguments, got %d", name.text, name.pos, len(f.args), len(args))
+	}
+	for i, arg := range args {
+		if arg.typ != f.args[i] {
+			return node{}, fmt.Errorf("argument %d of %s at offset %d is %s, want %s", i+1, name.text, name.pos, arg.typ, f.args[i])
+		}
+	}
+	apply, err := f.compile(literals)
+	if err != nil {
+		return node{}, fmt.Errorf("%w at offset %d", err, name.pos)
+	}
+
+	return node{typ: f.result, eval: func(req *Request) (any, error) {
+		values := make([]any, len(args))
+		for i, arg := range args {
+			v, err := arg.eval(req)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return apply(req, values)
+	}}, nil
+}
+
+// binary type checks an operator applied to left and right.
+func binary(op string, pos int, left, right node) (node, error) {
+	if left.typ != right.typ {
+		return node{}, fmt.Errorf("operator %s at offset %d applied to %s and %s", op, pos, left.typ, right.typ)
+	}
+	typ := left.typ
+
+	switch op {
+	case "&&", "||":
+		if typ != TypeBool {
+			break
+		}
+		and := op == "&&"
+		return node{typ: TypeBool, eval: func(req *Request) (any, error) {
+			l, err := left.eval(req)
+			if err != nil || l.(bool) != and {
+				return l, err
+			}
+			return right.eval(req)
+		}}, nil
+	case "==", "!=":
+		equal := op == "=="
+		return operands(TypeBool, left, right, func(l, r any) (any, error) { return (l == r) == equal, nil }), nil
+	case "<", "<=", ">", ">=":
+		if typ == TypeBool {
+			break
+		}
+		return operands(TypeBool, left, right, func(l, r any) (any, error) {
+			c := compare(l, r)
+			switch op {
+			case "<":
+				return c < 0, nil
+			case "<=":
+				return c <= 0, nil
+			case ">":
+				return c > 0, nil
+			default:
+				return c >= 0, nil
+			}
+		}), nil
+	case "+":
+		if typ == TypeString {
+			return operands(TypeString, left, right, func(l, r any) (any, error) { return l.(string) + r.(string), nil }), nil
+		}
+		fallthrough
+	case "-", "*", "/", "%":
+		if typ != TypeInt {
+			break
+		}
+		return operands(TypeInt, left, right, func(l, r any) (any, error) {
+			a, b := l.(int64), r.(int64)
+			switch op {
+			case "+":
+				return a + b, nil
+			case "-":
+				return a - b, nil
+			case "*":
+				return a * b, nil
+			}
+			if b == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if op == "/" {
+				return a / b, nil
+			}
+			return a % b, nil
+		}), nil
+	}
+	return node{}, fmt.Errorf("operator %s at offset %d does not apply to %s", op, pos, typ)
+}
+
+// operands evaluates both sides before applying f.
+func operands(typ Type, left, right node, f func(l, r any) (any, error)) node {
+	return node{typ: typ, eval: func(req *Request) (any, error) {
+		l, err := left.eval(req)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right.eval(req)
+		if err != nil {
+			return nil, err
+		}
+		return f(l, r)
+	}}
+}
+
+func compare(l, r any) int {
+	if a, ok := l.(int64); ok {
+		b := r.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(l.(string), r.(string))
+}
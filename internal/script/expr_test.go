@@ -0,0 +1,100 @@
+package script_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/script"
+)
+
+var _ = Describe("Expr", func() {
+	var req *script.Request
+
+	BeforeEach(func() {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com:8080/v1/users?tenant=acme&limit=20", nil)
+		r.Header.Set("X-Beta", "yes")
+		r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		req = &script.Request{HTTP: r, ClientIP: "10.0.0.7"}
+	})
+
+	evalBool := func(src string) bool {
+		expr, err := script.Compile(src, script.TypeBool)
+		Expect(err).NotTo(HaveOccurred())
+		v, err := expr.Bool(req)
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	evalText := func(src string) string {
+		expr, err := script.Compile(src, script.TypeString)
+		Expect(err).NotTo(HaveOccurred())
+		v, err := expr.Text(req)
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	It("should read the request", func() {
+		Expect(evalText(`method + " " + host + path`)).To(Equal("GET api.example.com/v1/users"))
+		Expect(evalText(`header("x-beta") + query("tenant") + cookie("session") + cookie("none")`)).To(Equal("yesacmeabc"))
+		Expect(evalBool(`has_header("X-Beta") && !has_header("X-Alpha")`)).To(BeTrue())
+		Expect(evalBool(`client_ip == "10.0.0.7"`)).To(BeTrue())
+	})
+
+	It("should apply functions and operators with the usual precedence", func() {
+		Expect(evalBool(`starts_with(path, "/v1/") && ends_with(path, "users") && contains(host, "example")`)).To(BeTrue())
+		Expect(evalBool(`matches(path, '^/v\d+/')`)).To(BeTrue())
+		Expect(evalBool(`int(query("limit")) * 2 + 1 == 41`)).To(BeTrue())
+		Expect(evalBool(`1 + 2 * 3 == 7 || false`)).To(BeTrue())
+		Expect(evalBool(`-len("abc") < 0 && "a" < "b" && 7 % 4 >= 3`)).To(BeTrue())
+		Expect(evalText(`upper(query("tenant")) + "-" + string(len(lower("AB")))`)).To(Equal("ACME-2"))
+		Expect(evalText(`has_header("X-Beta") ? "beta" : "stable"`)).To(Equal("beta"))
+		Expect(evalText(`'it\'s' + "\"quoted\""`)).To(Equal(`it's"quoted"`))
+	})
+
+	It("should hash values stably", func() {
+		Expect(evalBool(`hash(client_ip) == hash("10.0.0.7") && hash(client_ip) >= 0`)).To(BeTrue())
+		Expect(evalBool(`hash("a") != hash("b")`)).To(BeTrue())
+	})
+
+	It("should short-circuit boolean operators", func() {
+		Expect(evalBool(`false && int("x") == 1`)).To(BeFalse())
+		Expect(evalBool(`true || 1 / 0 == 1`)).To(BeTrue())
+	})
+
+	It("should fail to evaluate values it cannot handle", func() {
+		expr, err := script.Compile(`int(header("X-Beta")) > 1`, script.TypeBool)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = expr.Bool(req)
+		Expect(err).To(MatchError(ContainSubstring("not an integer")))
+
+		expr, err = script.Compile(`10 % (len(header("X-None"))) == 0`, script.TypeBool)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = expr.Bool(req)
+		Expect(err).To(MatchError("division by zero"))
+	})
+
+	DescribeTable("should reject invalid expressions",
+		func(src string, want script.Type, msg string) {
+			_, err := script.Compile(src, want)
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("wrong result type", `path`, script.TypeBool, "expression is string, want bool"),
+		Entry("mismatched operands", `path == 1`, script.TypeBool, "applied to string and int"),
+		Entry("unknown variable", `user == "x"`, script.TypeBool, "unknown variable user"),
+		Entry("unknown function", `exec("rm")`, script.TypeBool, "unknown function exec"),
+		Entry("wrong argument count", `header()`, script.TypeString, "takes 1 arguments, got 0"),
+		Entry("wrong argument type", `lower(1)`, script.TypeString, "argument 1 of lower"),
+		Entry("pattern not literal", `matches(path, path)`, script.TypeBool, "pattern must be a string literal"),
+		Entry("invalid pattern", `matches(path, "(")`, script.TypeBool, "missing closing )"),
+		Entry("mismatched branches", `true ? "a" : 1`, script.TypeString, "branches at offset 5 are string and int"),
+		Entry("non-bool condition", `"a" ? "a" : "b"`, script.TypeString, "condition at offset 4 is string"),
+		Entry("bool ordering", `true < false`, script.TypeBool, "operator < at offset 5 does not apply to bool"),
+		Entry("trailing tokens", `true true`, script.TypeBool, `unexpected "true" at offset 5`),
+		Entry("unterminated string", `path == "/v1`, script.TypeBool, "unterminated string at offset 8"),
+		Entry("invalid character", `path == #`, script.TypeBool, "unexpected character '#' at offset 8"),
+		Entry("empty", ``, script.TypeBool, "unexpected end of expression"),
+	)
+})
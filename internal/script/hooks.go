@@ -0,0 +1,154 @@
+package script
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// Hook is one routing hook. When is a bool expression; the other
+// expressions are strings, evaluated only for requests When holds for.
+// Group picks the backend group the request goes to, none when it evaluates
+// to empty; Fallback lets the request go to any backend while none in the
+// group is available instead of refusing it. Headers sets request headers,
+// by name, to the values of their expressions. A non-zero Reject refuses the
+// request with that status.
+type Hook struct {
+	Name     string
+	When     string
+	Group    string
+	Fallback bool
+	Headers  map[string]string
+	Reject   int
+}
+
+// Decision is the outcome of running the hooks on a request. Status is
+// non-zero when the hook named Rejected refused it. Group is the backend
+// group the hook named Grouped picked, if any, and Fallback that hook's
+// Fallback. Headers holds the headers to set, and Errors the hooks that
+// failed to evaluate and were skipped.
+type Decision struct {
+	Rejected string
+	Status   int
+	Grouped  string
+	Group    string
+	Fallback bool
+	Headers  map[string]string
+	Errors   []error
+}
+
+// Engine runs hooks on requests.
+type Engine struct {
+	hooks []*hook
+}
+
+type hook struct {
+	Hook
+	when    *Expr
+	group   *Expr
+	names   []string
+	headers []*Expr
+}
+
+// New compiles hooks. It fails on expressions that do not parse or do not
+// have the type their field needs, on invalid header names and on
+// rejections outside 400-599.
+func New(hooks []Hook) (*Engine, error) {
+	e := &Engine{hooks: make([]*hook, 0, len(hooks))}
+	for _, h := range hooks {
+		compiled, err := compile(h)
+		if err != nil {
+			return nil, fmt.Errorf("script hook %q: %w", h.Name, err)
+		}
+		e.hooks = append(e.hooks, compiled)
+	}
+	return e, nil
+}
+
+func compile(h Hook) (*hook, error) {
+	c := &hook{Hook: h}
+	var err error
+	if c.when, err = Compile(h.When, TypeBool); err != nil {
+		return nil, fmt.Errorf("when: %w", err)
+	}
+	if h.Group != "" {
+		if c.group, err = Compile(h.Group, TypeString); err != nil {
+			return nil, fmt.Errorf("group: %w", err)
+		}
+	}
+	c.names = slices.Sorted(maps.Keys(h.Headers))
+	for _, name := range c.names {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("%q is not a valid header name", name)
+		}
+		value, err := Compile(h.Headers[name], TypeString)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		c.headers = append(c.headers, value)
+	}
+	if h.Reject != 0 && (h.Reject < 400 || h.Reject > 599) {
+		return nil, fmt.Errorf("reject status %d is not an error status", h.Reject)
+	}
+	return c, nil
+}
+
+// Run evaluates the hooks in order against r. Every hook whose When holds
+// sets its headers, the first to pick a group decides the request's group,
+// and the first to reject the request ends the evaluation. A hook that fails
+// to evaluate, or yields a header value HTTP cannot carry, is skipped.
+func (e *Engine) Run(r *http.Request, clientIP string) Decision {
+	req := &Request{HTTP: r, ClientIP: clientIP}
+	var d Decision
+	for _, h := range e.hooks {
+		if err := h.apply(req, &d); err != nil {
+			d.Errors = append(d.Errors, fmt.Errorf("script hook %q: %w", h.Name, err))
+			continue
+		}
+		if d.Status != 0 {
+			break
+		}
+	}
+	return d
+}
+
+// apply runs the hook, only changing d once all its expressions evaluated.
+func (h *hook) apply(req *Request, d *Decision) error {
+	ok, err := h.when.Bool(req)
+	if err != nil || !ok {
+		return err
+	}
+
+	var group string
+	if h.group != nil && d.Group == "" {
+		if group, err = h.group.Text(req); err != nil {
+			return fmt.Errorf("group: %w", err)
+		}
+	}
+	values := make([]string, len(h.headers))
+	for i, value := range h.headers {
+		if values[i], err = value.Text(req); err != nil {
+			return fmt.Errorf("header %s: %w", h.names[i], err)
+		}
+		if !httpguts.ValidHeaderFieldValue(values[i]) {
+			return fmt.Errorf("header %s: %q is not a valid header value", h.names[i], values[i])
+		}
+	}
+
+	if group != "" {
+		d.Group, d.Grouped, d.Fallback = group, h.Name, h.Fallback
+	}
+	for i, name := range h.names {
+		if d.Headers == nil {
+			d.Headers = make(map[string]string, len(h.names))
+		}
+		d.Headers[name] = values[i]
+	}
+	if h.Reject != 0 {
+		d.Status, d.Rejected = h.Reject, h.Name
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package script_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/script"
+)
+
+var _ = Describe("Engine", func() {
+	newEngine := func(hooks ...script.Hook) *script.Engine {
+		e, err := script.New(hooks)
+		Expect(err).NotTo(HaveOccurred())
+		return e
+	}
+
+	request := func(tenant string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+		return r
+	}
+
+	It("should pick the group of the first hook that picks one", func() {
+		e := newEngine(
+			script.Hook{Name: "none", When: `true`, Group: `""`},
+			script.Hook{Name: "tenant", When: `has_header("X-Tenant")`, Group: `lower(header("X-Tenant"))`},
+			script.Hook{Name: "default", When: `true`, Group: `"shared"`},
+		)
+
+		d := e.Run(request("ACME"), "10.0.0.1")
+		Expect(d.Group).To(Equal("acme"))
+		Expect(d.Grouped).To(Equal("tenant"))
+
+		d = e.Run(request(""), "10.0.0.1")
+		Expect(d.Group).To(Equal("shared"))
+		Expect(d.Grouped).To(Equal("default"))
+	})
+
+	It("should set the headers of every hook that applies", func() {
+		e := newEngine(
+			script.Hook{Name: "tenant", When: `has_header("X-Tenant")`, Headers: map[string]string{
+				"X-Tenant-Id": `lower(header("X-Tenant"))`,
+				"X-Routed":    `"tenant"`,
+			}},
+			script.Hook{Name: "client", When: `true`, Headers: map[string]string{"X-Routed": `"client " + client_ip`}},
+		)
+
+		Expect(e.Run(request("ACME"), "10.0.0.1").Headers).To(Equal(map[string]string{
+			"X-Tenant-Id": "acme",
+			"X-Routed":    "client 10.0.0.1",
+		}))
+		Expect(e.Run(request(""), "10.0.0.1").Headers).To(Equal(map[string]string{"X-Routed": "client 10.0.0.1"}))
+	})
+
+	It("should stop at the first hook that rejects the request", func() {
+		e := newEngine(
+			script.Hook{Name: "banned", When: `header("X-Tenant") == "evil"`, Reject: http.StatusForbidden},
+			script.Hook{Name: "later", When: `true`, Reject: http.StatusTeapot, Headers: map[string]string{"X-Late": `"yes"`}},
+		)
+
+		d := e.Run(request("evil"), "10.0.0.1")
+		Expect(d.Status).To(Equal(http.StatusForbidden))
+		Expect(d.Rejected).To(Equal("banned"))
+		Expect(d.Headers).To(BeEmpty())
+
+		Expect(e.Run(request("acme"), "10.0.0.1").Rejected).To(Equal("later"))
+	})
+
+	It("should skip hooks that fail to evaluate", func() {
+		e := newEngine(
+			script.Hook{Name: "broken", When: `int(header("X-Tenant")) > 3`, Group: `"numbered"`},
+			script.Hook{Name: "half", When: `true`, Group: `"x" + string(1 / int(header("X-Tenant")))`, Headers: map[string]string{"X-Half": `"set"`}},
+		)
+
+		d := e.Run(request("acme"), "10.0.0.1")
+		Expect(d.Errors).To(HaveLen(2))
+		Expect(d.Errors[0]).To(MatchError(ContainSubstring(`script hook "broken"`)))
+		Expect(d.Group).To(BeEmpty())
+		Expect(d.Headers).To(BeEmpty())
+	})
+
+	It("should skip hooks whose header values HTTP cannot carry", func() {
+		e := newEngine(script.Hook{Name: "echo", When: `true`, Headers: map[string]string{"X-Echo": `query("v")`}})
+
+		d := e.Run(httptest.NewRequest(http.MethodGet, "/?v=a%0d%0aX-Admin:%20true", nil), "10.0.0.1")
+		Expect(d.Errors).To(ConsistOf(MatchError(ContainSubstring("not a valid header value"))))
+		Expect(d.Headers).To(BeEmpty())
+
+		Expect(e.Run(httptest.NewRequest(http.MethodGet, "/?v=ok", nil), "10.0.0.1").Headers).
+			To(Equal(map[string]string{"X-Echo": "ok"}))
+	})
+
+	It("should reject invalid hooks", func() {
+		_, err := script.New([]script.Hook{{Name: "bad", When: `path`}})
+		Expect(err).To(MatchError(`script hook "bad": when: expression is string, want bool`))
+
+		_, err = script.New([]script.Hook{{Name: "bad", When: `true`, Group: `1`}})
+		Expect(err).To(MatchError(ContainSubstring("group: expression is int")))
+
+		_, err = script.New([]script.Hook{{Name: "bad", When: `true`, Headers: map[string]string{"X-A": `true`}}})
+		Expect(err).To(MatchError(ContainSubstring("header X-A: expression is bool")))
+
+		_, err = script.New([]script.Hook{{Name: "bad", When: `true`, Headers: map[string]string{"X A": `"a"`}}})
+		Expect(err).To(MatchError(ContainSubstring("not a valid header name")))
+
+		_, err = script.New([]script.Hook{{Name: "bad", When: `true`, Reject: 302}})
+		Expect(err).To(MatchError(ContainSubstring("not an error status")))
+	})
+})
@@ -0,0 +1,101 @@
+package script
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokInvalid
+	tokIdent
+	tokString
+	tokInt
+	tokPunct
+)
+
+// token is a lexed token. The text of a string token is its unquoted value
+// and that of an invalid token describes the problem.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// punctuation lists the operators and delimiters, longest first so "<="
+// is not read as "<".
+var punctuation = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"(", ")", ",", "?", ":", "!", "<", ">", "+", "-", "*", "/", "%",
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if start == len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	c := l.src[start]
+	switch {
+	case isLetter(c):
+		for l.pos < len(l.src) && (isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}
+	case isDigit(c):
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokInt, text: l.src[start:l.pos], pos: start}
+	case c == '"' || c == '\'':
+		return l.quoted(c)
+	}
+
+	for _, p := range punctuation {
+		if strings.HasPrefix(l.src[start:], p) {
+			l.pos += len(p)
+			return token{kind: tokPunct, text: p, pos: start}
+		}
+	}
+	l.pos = len(l.src)
+	return token{kind: tokInvalid, text: fmt.Sprintf("unexpected character %q", c), pos: start}
+}
+
+// quoted reads a string literal in single or double quotes. A backslash
+// escapes the quote and itself; other backslashes are kept, so regular
+// expressions such as "\d+" need no doubling.
+func (l *lexer) quoted(quote byte) token {
+	start := l.pos
+	var value strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return token{kind: tokString, text: value.String(), pos: start}
+		case c == '\\' && l.pos+1 < len(l.src) && (l.src[l.pos+1] == quote || l.src[l.pos+1] == '\\'):
+			l.pos++
+			c = l.src[l.pos]
+		}
+		value.WriteByte(c)
+	}
+	return token{kind: tokInvalid, text: "unterminated string", pos: start}
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,27 @@
+// Package selftest checks that a built balancer works end to end before it
+// is shipped or deployed.
+//
+// Run starts a few in-process backends from testbackend and puts the real
+// handler, circuit breakers and metrics collector in front of them, served by
+// the balancer's HTTP server. Options.Front lets the caller add the handler
+// options, router and server options its configuration calls for. It sends
+// a short burst of requests, killing the backend that served one of them on
+// the way, and checks that every request still succeeded through retries,
+// that the dead backend's breaker opened and that the metrics snapshot
+// accounts for every attempt. Everything listens on loopback ports the
+// kernel picks, so a run needs no configuration and no network.
+//
+// Usage:
+//
+//	report, err := selftest.Run(ctx, selftest.Options{
+//		Strategy:   strategy.NewRoundRobinStrategy(),
+//		MaxRetries: 2,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	report.Write(os.Stdout)
+//	if !report.Passed() {
+//		os.Exit(1)
+//	}
+package selftest
@@ -0,0 +1,298 @@
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/httpserver"
+	"github.com/angeloszaimis/load-balancer/internal/loadbalancer"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+	"github.com/angeloszaimis/load-balancer/internal/testbackend"
+)
+
+// settleTimeout bounds how long Run waits for the metrics collector to catch
+// up with the burst before checking its snapshot.
+const settleTimeout = 2 * time.Second
+
+// Options configure a self-test. Zero values take the defaults in
+// parentheses: Backends (3), Requests (60), KillAfter (Requests/3),
+// MaxRetries (1), FailureThreshold (5) and ResetTimeout (30s). The breaker
+// has to stay open for the rest of the burst, so ResetTimeout should be well
+// above the time it takes. Front, when set, builds the handler options,
+// router and server options the balancer would use, for the fake backends'
+// pool and the test's collector; without it the bare handler is served.
+type Options struct {
+	Strategy         strategy.Strategy
+	Backends         int
+	Requests         int
+	KillAfter        int
+	MaxRetries       int
+	FailureThreshold int
+	ResetTimeout     time.Duration
+	Front            func(pool *backend.Pool, collector *metrics.Collector) (Front, error)
+}
+
+// Front is what sits between clients and the handler. Router wraps the
+// handler as the balancer's router does; nil serves it directly.
+type Front struct {
+	HandlerOptions []handler.Option
+	Router         func(proxy http.Handler) http.Handler
+	ServerOptions  []httpserver.Option
+}
+
+func (o *Options) setDefaults() {
+	if o.Backends == 0 {
+		o.Backends = 3
+	}
+	if o.Requests == 0 {
+		o.Requests = 60
+	}
+	if o.KillAfter == 0 {
+		o.KillAfter = o.Requests / 3
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 1
+	}
+	if o.FailureThreshold == 0 {
+		o.FailureThreshold = 5
+	}
+	if o.ResetTimeout == 0 {
+		o.ResetTimeout = 30 * time.Second
+	}
+}
+
+// Check is one thing a self-test verified.
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Report is the outcome of a self-test.
+type Report struct {
+	Requests  int              `json:"requests"`
+	Succeeded int              `json:"succeeded"`
+	Killed    string           `json:"killed"`
+	Checks    []Check          `json:"checks"`
+	Metrics   metrics.Snapshot `json:"metrics"`
+}
+
+// Passed reports whether every check passed.
+func (r Report) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Write writes one line per check, then the verdict.
+func (r Report) Write(w io.Writer) error {
+	for _, c := range r.Checks {
+		verdict := "PASS"
+		if !c.Passed {
+			verdict = "FAIL"
+		}
+		if _, err := fmt.Fprintf(w, "%s  %-16s %s\n", verdict, c.Name, c.Detail); err != nil {
+			return err
+		}
+	}
+	verdict := "self-test passed"
+	if !r.Passed() {
+		verdict = "self-test failed"
+	}
+	_, err := fmt.Fprintln(w, verdict)
+	return err
+}
+
+func (r *Report) check(name string, passed bool, format string, args ...any) {
+	r.Checks = append(r.Checks, Check{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Run starts fake backends and the balancer's handler, circuit breakers and
+// metrics collector in front of them, served by the balancer's HTTP server,
+// then sends a burst of requests. The
+// backend that served request KillAfter dies right after it, so the rest of
+// the burst needs retries to succeed and opens that backend's breaker. Run
+// returns an error only when the test could not be set up; what the burst
+// met is in the report's checks.
+func Run(ctx context.Context, opts Options) (Report, error) {
+	opts.setDefaults()
+	if opts.Strategy == nil {
+		return Report{}, fmt.Errorf("self-test needs a strategy")
+	}
+	if opts.Backends < 2 {
+		return Report{}, fmt.Errorf("self-test needs at least two backends, got %d", opts.Backends)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	servers := make(map[string]*testbackend.Server, opts.Backends)
+	defer func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}()
+
+	backends := make([]*backend.Backend, 0, opts.Backends)
+	for range opts.Backends {
+		srv, err := testbackend.Start("127.0.0.1:0")
+		if err != nil {
+			return Report{}, fmt.Errorf("starting fake backend: %w", err)
+		}
+		b := backend.New(&url.URL{Scheme: "http", Host: srv.Addr().String()}, 1)
+		b.SetHealthy(true)
+		servers[b.URL().String()] = srv
+		backends = append(backends, b)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	collector := metrics.NewCollector(10*opts.Requests, logger)
+	collector.Start(ctx)
+
+	var front Front
+	if opts.Front != nil {
+		var err error
+		if front, err = opts.Front(backend.NewPool(backends), collector); err != nil {
+			return Report{}, fmt.Errorf("setting up the proxy: %w", err)
+		}
+	}
+
+	registry := circuitbreaker.NewRegistry(opts.FailureThreshold, opts.ResetTimeout)
+	lb := loadbalancer.NewLoadBalancer(opts.Strategy)
+	var h http.Handler = handler.NewLoadBalancerHandler(logger, lb, backends, collector, registry, opts.MaxRetries, front.HandlerOptions...)
+	if front.Router != nil {
+		h = front.Router(h)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return Report{}, fmt.Errorf("listening: %w", err)
+	}
+	srv, err := httpserver.New(l.Addr().String(), h, append(front.ServerOptions, httpserver.WithListener(l))...)
+	if err != nil {
+		l.Close()
+		return Report{}, fmt.Errorf("creating server: %w", err)
+	}
+	go srv.Start()
+	defer srv.Shutdown(context.Background())
+	frontURL := "http://" + l.Addr().String()
+
+	report := Report{}
+	client := &http.Client{Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+
+	var victim *backend.Backend
+	for i := 1; i <= opts.Requests && ctx.Err() == nil; i++ {
+		report.Requests++
+		resp, err := client.Get(frontURL + "/health")
+		if err != nil {
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			report.Succeeded++
+		}
+
+		if i == opts.KillAfter {
+			served := resp.Header.Get(backend.HeaderBackendServer)
+			for _, b := range backends {
+				if b.URL().String() == served {
+					victim = b
+				}
+			}
+			if victim != nil {
+				servers[served].Close()
+				report.Killed = served
+			}
+		}
+	}
+
+	report.check("requests", report.Succeeded == report.Requests,
+		"%d of %d requests succeeded", report.Succeeded, report.Requests)
+
+	report.Metrics = settle(collector, report.Succeeded)
+	counters := collector.Counters()
+
+	if victim == nil {
+		report.check("retries", false, "no backend was killed after request %d", opts.KillAfter)
+	} else {
+		failures := attemptFailures(report.Metrics.Backends[victim.Name()].Errors)
+		report.check("retries", failures > 0 && report.Succeeded == report.Requests,
+			"%d failed attempts on the killed backend were retried", failures)
+
+		// Strategies that learn from failures may stop picking the backend
+		// before its breaker has to step in.
+		state := registry.GetBreaker(victim.Name()).State()
+		if failures < int64(opts.FailureThreshold) {
+			report.check("circuit breaker", state != circuitbreaker.StateOpen,
+				"strategy avoided the killed backend after %d failures, breaker is %s", failures, state)
+		} else {
+			report.check("circuit breaker", state == circuitbreaker.StateOpen,
+				"breaker of the killed backend is %s after %d failures", state, failures)
+		}
+	}
+
+	report.check("metrics", consistent(report.Metrics, counters, report.Succeeded),
+		"%d attempts, %d responses, %d dropped events", report.Metrics.TotalRequests, responses(report.Metrics), counters.DroppedEvents)
+
+	return report, nil
+}
+
+// settle waits until the collector has recorded want responses, or for
+// settleTimeout, and returns its snapshot. Events are processed in order, so
+// once the last response is in, so is everything before it.
+func settle(collector *metrics.Collector, want int) metrics.Snapshot {
+	deadline := time.Now().Add(settleTimeout)
+	for {
+		snap := collector.Snapshot("selftest")
+		if responses(snap) >= int64(want) || time.Now().After(deadline) {
+			return snap
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// consistent reports whether every attempt the snapshot counts either got a
+// response or failed, no response is missing and no event was dropped.
+func consistent(snap metrics.Snapshot, counters metrics.Counters, succeeded int) bool {
+	var failed int64
+	for _, b := range snap.Backends {
+		failed += attemptFailures(b.Errors)
+	}
+	return counters.DroppedEvents == 0 &&
+		snap.TotalRequests == responses(snap)+failed &&
+		responses(snap) == int64(succeeded)
+}
+
+func responses(snap metrics.Snapshot) int64 {
+	var n int64
+	for _, b := range snap.Backends {
+		for _, count := range b.StatusClasses {
+			n += count
+		}
+	}
+	return n
+}
+
+// attemptFailures counts the attempts that reached a backend and failed,
+// leaving out the ones its breaker refused.
+func attemptFailures(errs *metrics.BackendErrors) int64 {
+	if errs == nil {
+		return 0
+	}
+	return errs.Dial + errs.Timeout + errs.Reset + errs.Other
+}
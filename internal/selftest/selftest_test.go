@@ -0,0 +1,118 @@
+package selftest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/handler"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/selftest"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Run", func() {
+	It("should pass with round-robin, retrying and then breaking the killed backend", func() {
+		report, err := selftest.Run(context.Background(), selftest.Options{Strategy: strategy.NewRoundRobinStrategy()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Passed()).To(BeTrue(), "%+v", report.Checks)
+		Expect(report.Requests).To(Equal(60))
+		Expect(report.Succeeded).To(Equal(60))
+		Expect(report.Killed).NotTo(BeEmpty())
+
+		errs := report.Metrics.Backends[report.Killed].Errors
+		Expect(errs).NotTo(BeNil())
+		Expect(errs.Dial).To(BeEquivalentTo(5))
+		Expect(errs.BreakerRejected).To(BeNumerically(">", 0))
+	})
+
+	It("should kill the backend a hashing strategy sends every request to", func() {
+		report, err := selftest.Run(context.Background(), selftest.Options{Strategy: strategy.NewConsistentHashStrategy(100)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Passed()).To(BeTrue(), "%+v", report.Checks)
+	})
+
+	It("should pass when the strategy stops picking the killed backend by itself", func() {
+		report, err := selftest.Run(context.Background(), selftest.Options{Strategy: strategy.NewPeakEWMAStrategy(0, 0)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Passed()).To(BeTrue(), "%+v", report.Checks)
+	})
+
+	It("should fail when no backend was killed", func() {
+		report, err := selftest.Run(context.Background(), selftest.Options{
+			Strategy:  strategy.NewRoundRobinStrategy(),
+			Requests:  10,
+			KillAfter: 20,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Passed()).To(BeFalse())
+		Expect(report.Succeeded).To(Equal(10))
+		Expect(report.Killed).To(BeEmpty())
+	})
+
+	It("should serve through the front's router with its handler options", func() {
+		var routed atomic.Int64
+		var pooled int
+		report, err := selftest.Run(context.Background(), selftest.Options{
+			Strategy: strategy.NewRoundRobinStrategy(),
+			Front: func(pool *backend.Pool, collector *metrics.Collector) (selftest.Front, error) {
+				pooled = len(pool.Backends())
+				return selftest.Front{
+					HandlerOptions: []handler.Option{handler.WithBackendPool(pool)},
+					Router: func(h http.Handler) http.Handler {
+						return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							routed.Add(1)
+							h.ServeHTTP(w, r)
+						})
+					},
+				}, nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Passed()).To(BeTrue(), "%+v", report.Checks)
+		Expect(pooled).To(Equal(3))
+		Expect(routed.Load()).To(BeEquivalentTo(60))
+	})
+
+	It("should not run when the front cannot be set up", func() {
+		_, err := selftest.Run(context.Background(), selftest.Options{
+			Strategy: strategy.NewRoundRobinStrategy(),
+			Front: func(*backend.Pool, *metrics.Collector) (selftest.Front, error) {
+				return selftest.Front{}, errors.New("invalid rule")
+			},
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid rule")))
+	})
+
+	It("should refuse to run without a strategy or with a single backend", func() {
+		_, err := selftest.Run(context.Background(), selftest.Options{})
+		Expect(err).To(HaveOccurred())
+
+		_, err = selftest.Run(context.Background(), selftest.Options{Strategy: strategy.NewRoundRobinStrategy(), Backends: 1})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Report", func() {
+	It("should write every check and the verdict", func() {
+		report := selftest.Report{
+			Checks: []selftest.Check{
+				{Name: "requests", Passed: true, Detail: "60 of 60 requests succeeded"},
+				{Name: "metrics", Passed: false, Detail: "61 attempts, 59 responses, 0 dropped events"},
+			},
+		}
+
+		var buf bytes.Buffer
+		Expect(report.Write(&buf)).To(Succeed())
+		Expect(buf.String()).To(Equal("" +
+			"PASS  requests         60 of 60 requests succeeded\n" +
+			"FAIL  metrics          61 attempts, 59 responses, 0 dropped events\n" +
+			"self-test failed\n"))
+	})
+})
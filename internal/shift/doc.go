@@ -0,0 +1,23 @@
+// Package shift moves traffic between two labeled groups of backends, as in
+// a blue/green deploy.
+//
+// A shift names the group traffic leaves and the group it moves to by label
+// selectors such as "color=blue" and "color=green". Over its duration the
+// leaving group's shift factor falls linearly from 1 to 0 and the other
+// group's rises from 0 to 1; weighted strategies scale backend weights by
+// it, and the load balancer draws a group by it for the others. Once
+// complete the new group keeps all the traffic until the next shift.
+// Rolling back returns all traffic to the leaving group at once.
+//
+// A split instead holds a fixed share of the traffic on the new group until
+// it is changed, for progressive delivery controllers that step a canary
+// through shares of their own choosing and analyse it between steps.
+//
+// Usage:
+//
+//	shifter := shift.New(pool, logger)
+//	shifter.Start(ctx, time.Second)
+//	status, err := shifter.Shift(blue, green, 10*time.Minute, time.Now())
+//	status, err = shifter.Split(stable, canary, 0.2, time.Now())
+//	status, err = shifter.Rollback(time.Now())
+package shift
@@ -0,0 +1,325 @@
+package shift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+var (
+	ErrActive  = errors.New("a traffic shift is already in progress")
+	ErrNoShift = errors.New("no traffic shift to roll back")
+)
+
+// Selector matches the backends carrying a label with a given value.
+type Selector struct {
+	Key   string
+	Value string
+}
+
+// ParseSelector parses a selector written as key=value.
+func ParseSelector(s string) (Selector, error) {
+	key, value, ok := strings.Cut(s, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return Selector{}, fmt.Errorf("invalid selector %q, use key=value", s)
+	}
+	return Selector{Key: key, Value: value}, nil
+}
+
+func (s Selector) String() string {
+	return s.Key + "=" + s.Value
+}
+
+func (s Selector) Matches(b *backend.Backend) bool {
+	return b.HasLabel(s.Key, s.Value)
+}
+
+type Phase string
+
+const (
+	PhaseIdle       Phase = "idle"
+	PhaseShifting   Phase = "shifting"
+	PhaseComplete   Phase = "complete"
+	PhaseRolledBack Phase = "rolled_back"
+	PhaseSplit      Phase = "split"
+)
+
+// Status describes the current or most recent shift. Progress is the share
+// of the traffic moved to the To group.
+type Status struct {
+	Phase        Phase      `json:"phase"`
+	From         string     `json:"from,omitempty"`
+	To           string     `json:"to,omitempty"`
+	Duration     string     `json:"duration,omitempty"`
+	Started      *time.Time `json:"started,omitempty"`
+	Progress     float64    `json:"progress"`
+	FromBackends []string   `json:"from_backends,omitempty"`
+	ToBackends   []string   `json:"to_backends,omitempty"`
+}
+
+// Controller runs one traffic shift at a time over the backends of a pool.
+type Controller struct {
+	pool   *backend.Pool
+	logger *slog.Logger
+
+	mutex    sync.Mutex
+	phase    Phase
+	from     Selector
+	to       Selector
+	duration time.Duration
+	started  time.Time
+	progress float64
+	onStart  []func(Status)
+}
+
+// New returns a controller shifting traffic between the backends of pool,
+// including those that join it during a shift.
+func New(pool *backend.Pool, logger *slog.Logger) *Controller {
+	return &Controller{pool: pool, logger: logger, phase: PhaseIdle}
+}
+
+// OnStart registers fn to run whenever a shift starts or a split is set,
+// with the new status. It runs while the controller holds its lock, so it
+// must not block or call back into the controller.
+func (c *Controller) OnStart(fn func(Status)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onStart = append(c.onStart, fn)
+}
+
+// Start moves the shift in progress forward every interval until ctx is
+// done.
+func (c *Controller) Start(ctx context.Context, interval time.Duration) {
+	goroutines.Go("shift", func() { c.run(ctx, interval) })
+}
+
+func (c *Controller) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.Apply(now)
+		}
+	}
+}
+
+// Shift starts moving traffic from the backends matching from to those
+// matching to over duration, beginning at now. A zero duration switches at
+// once. Backends in neither group get their full share back. It fails with
+// ErrActive while another shift is in progress.
+func (c *Controller) Shift(from, to Selector, duration time.Duration, now time.Time) (Status, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.phase == PhaseShifting {
+		return c.status(), ErrActive
+	}
+	if duration < 0 {
+		return Status{}, fmt.Errorf("duration must not be negative")
+	}
+	if err := c.checkGroups(from, to); err != nil {
+		return Status{}, err
+	}
+
+	c.phase, c.from, c.to, c.duration, c.started = PhaseShifting, from, to, duration, now
+	c.logger.Info("Traffic shift started",
+		slog.String("from", from.String()),
+		slog.String("to", to.String()),
+		slog.Duration("duration", duration))
+	c.apply(now)
+	c.begun()
+	return c.status(), nil
+}
+
+// Split holds share of the traffic, between 0 and 1, on the backends
+// matching to and the rest on those matching from, until the next split,
+// shift or rollback. It is meant for external progressive delivery
+// controllers that step a canary's share themselves. Unlike a shift, the
+// split is exact whatever the groups' sizes: each group's factors are scaled
+// by its configured weight. It fails with ErrActive while a shift is in
+// progress.
+func (c *Controller) Split(from, to Selector, share float64, now time.Time) (Status, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.phase == PhaseShifting {
+		return c.status(), ErrActive
+	}
+	if share < 0 || share > 1 {
+		return Status{}, fmt.Errorf("share must be between 0 and 1")
+	}
+	if err := c.checkGroups(from, to); err != nil {
+		return Status{}, err
+	}
+
+	if c.phase != PhaseSplit || c.from != from || c.to != to {
+		c.started = now
+	}
+	c.phase, c.from, c.to, c.duration, c.progress = PhaseSplit, from, to, 0, share
+	c.setFactors()
+	c.logger.Info("Traffic split set",
+		slog.String("from", from.String()),
+		slog.String("to", to.String()),
+		slog.Float64("share", share))
+	c.begun()
+	return c.status(), nil
+}
+
+// checkGroups makes sure each group has a backend and none is in both.
+func (c *Controller) checkGroups(from, to Selector) error {
+	var leaving, joining int
+	for _, b := range c.pool.Backends() {
+		switch f, t := from.Matches(b), to.Matches(b); {
+		case f && t:
+			return fmt.Errorf("backend %s matches both %s and %s", b.Name(), from, to)
+		case f:
+			leaving++
+		case t:
+			joining++
+		}
+	}
+	if leaving == 0 {
+		return fmt.Errorf("no backend matches %s", from)
+	}
+	if joining == 0 {
+		return fmt.Errorf("no backend matches %s", to)
+	}
+	return nil
+}
+
+// Rollback returns all traffic to the group the last shift or split moved
+// it away from, at once, whether that shift is still in progress or
+// complete.
+func (c *Controller) Rollback(now time.Time) (Status, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.phase != PhaseShifting && c.phase != PhaseComplete && c.phase != PhaseSplit {
+		return c.status(), ErrNoShift
+	}
+
+	c.phase, c.progress = PhaseRolledBack, 0
+	c.setFactors()
+	c.logger.Warn("Traffic shift rolled back",
+		slog.String("from", c.from.String()),
+		slog.String("to", c.to.String()),
+		slog.Duration("after", now.Sub(c.started)))
+	return c.status(), nil
+}
+
+// Apply sets the shift factors the shift in progress calls for at now.
+func (c *Controller) Apply(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.phase == PhaseShifting {
+		c.apply(now)
+	}
+}
+
+func (c *Controller) apply(now time.Time) {
+	elapsed := now.Sub(c.started)
+	switch {
+	case elapsed >= c.duration:
+		c.progress = 1
+	case elapsed > 0:
+		c.progress = float64(elapsed) / float64(c.duration)
+	default:
+		c.progress = 0
+	}
+	c.setFactors()
+
+	if c.progress >= 1 {
+		c.phase = PhaseComplete
+		c.logger.Info("Traffic shift complete",
+			slog.String("from", c.from.String()),
+			slog.String("to", c.to.String()))
+	}
+}
+
+func (c *Controller) setFactors() {
+	fromFactor, toFactor := 1-c.progress, c.progress
+	if c.phase == PhaseSplit {
+		fromFactor, toFactor = c.splitFactors()
+	}
+
+	for _, b := range c.pool.Backends() {
+		switch {
+		case c.from.Matches(b):
+			b.SetShiftFactor(fromFactor)
+		case c.to.Matches(b):
+			b.SetShiftFactor(toFactor)
+		default:
+			b.SetShiftFactor(1)
+		}
+	}
+}
+
+// splitFactors scales the factors of a split so each group's share of their
+// combined configured weight is the one the split calls for.
+func (c *Controller) splitFactors() (fromFactor, toFactor float64) {
+	var fromWeight, toWeight int
+	for _, b := range c.pool.Backends() {
+		switch {
+		case c.from.Matches(b):
+			fromWeight += b.ConfiguredWeight()
+		case c.to.Matches(b):
+			toWeight += b.ConfiguredWeight()
+		}
+	}
+	if fromWeight <= 0 || toWeight <= 0 {
+		return 1 - c.progress, c.progress
+	}
+
+	smaller := float64(min(fromWeight, toWeight))
+	return (1 - c.progress) * smaller / float64(fromWeight), c.progress * smaller / float64(toWeight)
+}
+
+// Status reports the current or most recent shift.
+func (c *Controller) Status() Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.status()
+}
+
+func (c *Controller) status() Status {
+	status := Status{Phase: c.phase, Progress: c.progress}
+	if c.phase == PhaseIdle {
+		return status
+	}
+
+	started := c.started
+	status.From, status.To = c.from.String(), c.to.String()
+	if c.phase != PhaseSplit {
+		status.Duration = c.duration.String()
+	}
+	status.Started = &started
+	for _, b := range c.pool.Backends() {
+		if c.from.Matches(b) {
+			status.FromBackends = append(status.FromBackends, b.Name())
+		} else if c.to.Matches(b) {
+			status.ToBackends = append(status.ToBackends, b.Name())
+		}
+	}
+	return status
+}
+
+// begun runs the OnStart hooks. Callers must hold the mutex.
+func (c *Controller) begun() {
+	status := c.status()
+	for _, fn := range c.onStart {
+		fn(status)
+	}
+}
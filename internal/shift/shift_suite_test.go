@@ -0,0 +1,13 @@
+package shift_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestShift(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shift Suite")
+}
@@ -0,0 +1,156 @@
+package shift_test
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/shift"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		blue, green, other *backend.Backend
+		controller         *shift.Controller
+		start              time.Time
+	)
+
+	selector := func(s string) shift.Selector {
+		sel, err := shift.ParseSelector(s)
+		Expect(err).NotTo(HaveOccurred())
+		return sel
+	}
+
+	factors := func() []float64 {
+		return []float64{blue.ShiftFactor(), green.ShiftFactor(), other.ShiftFactor()}
+	}
+
+	BeforeEach(func() {
+		newBackend := func(raw string, labels map[string]string) *backend.Backend {
+			u, _ := url.Parse(raw)
+			return backend.New(u, 1, backend.WithLabels(labels))
+		}
+		blue = newBackend("http://10.0.0.1", map[string]string{"color": "blue"})
+		green = newBackend("http://10.0.0.2", map[string]string{"color": "green"})
+		other = newBackend("http://10.0.0.3", nil)
+
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		controller = shift.New(backend.NewPool([]*backend.Backend{blue, green, other}), log)
+		start = time.Date(2026, time.March, 4, 12, 0, 0, 0, time.UTC)
+	})
+
+	It("should move traffic linearly over the duration", func() {
+		status, err := controller.Shift(selector("color=blue"), selector("color=green"), 10*time.Minute, start)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Phase).To(Equal(shift.PhaseShifting))
+		Expect(status.FromBackends).To(Equal([]string{"http://10.0.0.1"}))
+		Expect(status.ToBackends).To(Equal([]string{"http://10.0.0.2"}))
+		Expect(factors()).To(Equal([]float64{1, 0, 1}))
+
+		controller.Apply(start.Add(4 * time.Minute))
+		Expect(blue.ShiftFactor()).To(BeNumerically("~", 0.6, 1e-9))
+		Expect(green.ShiftFactor()).To(BeNumerically("~", 0.4, 1e-9))
+
+		controller.Apply(start.Add(10 * time.Minute))
+		Expect(factors()).To(Equal([]float64{0, 1, 1}))
+		Expect(controller.Status().Phase).To(Equal(shift.PhaseComplete))
+	})
+
+	It("should roll back at once", func() {
+		_, err := controller.Shift(selector("color=blue"), selector("color=green"), 10*time.Minute, start)
+		Expect(err).NotTo(HaveOccurred())
+		controller.Apply(start.Add(5 * time.Minute))
+
+		status, err := controller.Rollback(start.Add(5 * time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Phase).To(Equal(shift.PhaseRolledBack))
+		Expect(factors()).To(Equal([]float64{1, 0, 1}))
+
+		controller.Apply(start.Add(10 * time.Minute))
+		Expect(factors()).To(Equal([]float64{1, 0, 1}))
+	})
+
+	It("should hold an exact split whatever the group sizes", func() {
+		var stable []*backend.Backend
+		for _, raw := range []string{"http://10.0.1.1", "http://10.0.1.2", "http://10.0.1.3"} {
+			u, _ := url.Parse(raw)
+			stable = append(stable, backend.New(u, 1, backend.WithLabels(map[string]string{"track": "stable"})))
+		}
+		u, _ := url.Parse("http://10.0.1.4")
+		canary := backend.New(u, 1, backend.WithLabels(map[string]string{"track": "canary"}))
+		controller = shift.New(backend.NewPool(append(stable, canary)), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		status, err := controller.Split(selector("track=stable"), selector("track=canary"), 0.25, start)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Phase).To(Equal(shift.PhaseSplit))
+		Expect(status.Progress).To(Equal(0.25))
+		Expect(status.Duration).To(BeEmpty())
+
+		var stableShare float64
+		for _, b := range stable {
+			stableShare += b.ShiftFactor()
+		}
+		Expect(stableShare).To(BeNumerically("~", 0.75, 1e-9))
+		Expect(canary.ShiftFactor()).To(BeNumerically("~", 0.25, 1e-9))
+
+		controller.Apply(start.Add(time.Hour))
+		Expect(controller.Status().Phase).To(Equal(shift.PhaseSplit))
+
+		status, err = controller.Split(selector("track=stable"), selector("track=canary"), 1, start.Add(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*status.Started).To(Equal(start))
+		Expect(stable[0].ShiftFactor()).To(BeZero())
+		Expect(canary.ShiftFactor()).To(Equal(1.0))
+
+		_, err = controller.Rollback(start.Add(2 * time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stable[0].ShiftFactor()).To(Equal(1.0))
+		Expect(canary.ShiftFactor()).To(BeZero())
+	})
+
+	It("should not split during a shift or beyond the whole traffic", func() {
+		_, err := controller.Split(selector("color=blue"), selector("color=green"), 1.5, start)
+		Expect(err).To(HaveOccurred())
+
+		_, err = controller.Shift(selector("color=blue"), selector("color=green"), time.Minute, start)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = controller.Split(selector("color=blue"), selector("color=green"), 0.5, start)
+		Expect(err).To(MatchError(shift.ErrActive))
+	})
+
+	It("should run one shift at a time", func() {
+		_, err := controller.Shift(selector("color=blue"), selector("color=green"), time.Minute, start)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = controller.Shift(selector("color=green"), selector("color=blue"), time.Minute, start)
+		Expect(err).To(MatchError(shift.ErrActive))
+
+		controller.Apply(start.Add(time.Minute))
+		_, err = controller.Shift(selector("color=green"), selector("color=blue"), 0, start.Add(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(factors()).To(Equal([]float64{1, 0, 1}))
+	})
+
+	It("should reject groups without backends", func() {
+		_, err := controller.Shift(selector("color=blue"), selector("color=purple"), time.Minute, start)
+		Expect(err).To(HaveOccurred())
+		Expect(controller.Status().Phase).To(Equal(shift.PhaseIdle))
+	})
+
+	It("should refuse to roll back without a shift", func() {
+		_, err := controller.Rollback(start)
+		Expect(err).To(MatchError(shift.ErrNoShift))
+	})
+
+	It("should parse selectors", func() {
+		Expect(selector(" color = blue ")).To(Equal(shift.Selector{Key: "color", Value: "blue"}))
+		for _, bad := range []string{"", "color", "=blue", "color="} {
+			_, err := shift.ParseSelector(bad)
+			Expect(err).To(HaveOccurred(), bad)
+		}
+	})
+})
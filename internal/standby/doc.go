@@ -0,0 +1,14 @@
+// Package standby activates warm standby backends when the active pool runs
+// short.
+//
+// Standby backends are health checked like any other but receive no traffic.
+// A Pool counts the regular backends that are available; while fewer than
+// MinActive are, it activates healthy standbys in configuration order to make
+// up the difference, and deactivates them again once enough regular backends
+// have recovered.
+//
+// Usage:
+//
+//	standbys := standby.NewPool(pool, 2, logger)
+//	standbys.Start(ctx, 2*time.Second)
+package standby
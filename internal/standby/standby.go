@@ -0,0 +1,80 @@
+package standby
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/goroutines"
+)
+
+type Pool struct {
+	backends  *backend.Pool
+	minActive int
+	logger    *slog.Logger
+}
+
+// NewPool keeps at least minActive of the local backends in backends
+// available, counting those that join it later.
+func NewPool(backends *backend.Pool, minActive int, logger *slog.Logger) *Pool {
+	return &Pool{backends: backends, minActive: minActive, logger: logger}
+}
+
+func (p *Pool) Start(ctx context.Context, interval time.Duration) {
+	goroutines.Go("standby", func() { p.run(ctx, interval) })
+}
+
+func (p *Pool) run(ctx context.Context, interval time.Duration) {
+	p.Evaluate()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Evaluate()
+		}
+	}
+}
+
+// Evaluate activates or deactivates standbys for the current health of the
+// regular backends.
+func (p *Pool) Evaluate() {
+	var standbys []*backend.Backend
+	active := 0
+	for _, b := range p.backends.Backends() {
+		switch {
+		case b.IsStandby():
+			standbys = append(standbys, b)
+		case !b.IsRemote() && b.IsAvailable():
+			active++
+		}
+	}
+
+	needed := p.minActive - active
+	for _, b := range standbys {
+		activate := needed > 0 && b.IsHealthy() && !b.IsDraining()
+		if activate {
+			needed--
+		}
+
+		if !b.SetStandbyActive(activate) {
+			continue
+		}
+		if activate {
+			p.logger.Warn("Activated standby backend",
+				slog.String("backend", b.Name()),
+				slog.Int("active_regular", active),
+				slog.Int("min_active", p.minActive))
+		} else {
+			p.logger.Info("Deactivated standby backend",
+				slog.String("backend", b.Name()),
+				slog.Int("active_regular", active),
+				slog.Int("min_active", p.minActive))
+		}
+	}
+}
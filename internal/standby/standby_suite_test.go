@@ -0,0 +1,13 @@
+package standby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestStandby(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Standby Suite")
+}
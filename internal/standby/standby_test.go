@@ -0,0 +1,79 @@
+package standby_test
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/standby"
+)
+
+var _ = Describe("Pool", func() {
+	var (
+		regular  []*backend.Backend
+		standbys []*backend.Backend
+		pool     *standby.Pool
+	)
+
+	newBackend := func(rawURL string, opts ...backend.Option) *backend.Backend {
+		u, _ := url.Parse(rawURL)
+		b := backend.New(u, 1, opts...)
+		b.SetHealthy(true)
+		return b
+	}
+
+	active := func() []bool {
+		states := make([]bool, len(standbys))
+		for i, b := range standbys {
+			states[i] = b.IsAvailable()
+		}
+		return states
+	}
+
+	BeforeEach(func() {
+		regular = []*backend.Backend{newBackend("http://10.0.0.1"), newBackend("http://10.0.0.2")}
+		standbys = []*backend.Backend{
+			newBackend("http://10.0.1.1", backend.WithStandby()),
+			newBackend("http://10.0.1.2", backend.WithStandby()),
+		}
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		pool = standby.NewPool(backend.NewPool(append(append([]*backend.Backend{}, regular...), standbys...)), 2, log)
+	})
+
+	It("should keep standbys inactive while enough regular backends are available", func() {
+		pool.Evaluate()
+		Expect(active()).To(Equal([]bool{false, false}))
+	})
+
+	It("should activate as many standbys as regular backends are missing", func() {
+		regular[0].SetHealthy(false)
+		pool.Evaluate()
+		Expect(active()).To(Equal([]bool{true, false}))
+
+		regular[1].SetDraining(true)
+		pool.Evaluate()
+		Expect(active()).To(Equal([]bool{true, true}))
+	})
+
+	It("should skip unhealthy standbys", func() {
+		regular[0].SetHealthy(false)
+		standbys[0].SetHealthy(false)
+		pool.Evaluate()
+		Expect(standbys[0].StandbyActive()).To(BeFalse())
+		Expect(active()).To(Equal([]bool{false, true}))
+	})
+
+	It("should deactivate standbys once the regular backends recover", func() {
+		regular[0].SetHealthy(false)
+		pool.Evaluate()
+		Expect(active()).To(Equal([]bool{true, false}))
+
+		regular[0].SetHealthy(true)
+		pool.Evaluate()
+		Expect(active()).To(Equal([]bool{false, false}))
+	})
+})
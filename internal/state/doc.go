@@ -0,0 +1,18 @@
+// Package state exports the balancer's runtime state and imports it into
+// another instance, so a replacement balancer in a blue/green rollout starts
+// where the old one left off instead of from the configuration.
+//
+// A Snapshot holds what operators and the balancer changed at runtime: each
+// backend's weight, health override, draining and maintenance flags, the
+// circuit breaker states and the members of the hash ring, which decide where
+// clients of the hashing strategies are pinned. Health check results and
+// latency estimates are not carried over; the new instance measures its own.
+//
+// Usage:
+//
+//	m := state.NewManager(pool, registry, strat)
+//	snap := m.Export()
+//
+//	snap, err := state.Load("/var/lib/lb/state.json")
+//	result, err := other.Import(snap)
+package state
@@ -0,0 +1,245 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// Version is bumped whenever a Snapshot field is renamed, removed or changes
+// meaning. Snapshots older than MinVersion or newer than Version are
+// rejected. Version 2 writes retry_after as a duration string such as
+// "42s" instead of nanoseconds; version 1 snapshots are still read.
+const (
+	Version    = 2
+	MinVersion = 1
+)
+
+type Snapshot struct {
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Backends   []Backend          `json:"backends"`
+	Breakers   map[string]Breaker `json:"breakers,omitempty"`
+	// Affinity lists the names of the backends on the hash ring. It is
+	// empty unless the strategy hashes.
+	Affinity []string `json:"affinity,omitempty"`
+}
+
+// Backend is matched by Name on import, or by URL when no backend has that
+// name.
+type Backend struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	Weight         int    `json:"weight"`
+	HealthOverride string `json:"health_override,omitempty"`
+	Draining       bool   `json:"draining,omitempty"`
+	Maintenance    bool   `json:"maintenance,omitempty"`
+}
+
+// Breaker is one backend's circuit breaker, keyed by backend name. RetryAfter
+// is how long an open breaker still rejects requests.
+type Breaker struct {
+	State      string   `json:"state"`
+	Failures   int      `json:"failures"`
+	RetryAfter Duration `json:"retry_after,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "1m30s". It also
+// reads the nanoseconds version 1 snapshots hold.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var nanos int64
+	if err := json.Unmarshal(data, &nanos); err == nil {
+		*d = Duration(nanos)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Result reports what an import applied. Unknown lists the backends of the
+// snapshot that match none of this instance's.
+type Result struct {
+	Backends int      `json:"backends"`
+	Breakers int      `json:"breakers"`
+	Affinity int      `json:"affinity"`
+	Unknown  []string `json:"unknown,omitempty"`
+}
+
+type Manager struct {
+	pool     *backend.Pool
+	registry *circuitbreaker.Registry
+	strategy strategy.Strategy
+}
+
+// NewManager exports and imports the state of the backends in pool, the
+// breakers in registry, which may be nil, and the ring of strat if it hashes.
+func NewManager(pool *backend.Pool, registry *circuitbreaker.Registry, strat strategy.Strategy) *Manager {
+	return &Manager{pool: pool, registry: registry, strategy: strat}
+}
+
+// Load reads a snapshot written from Export.
+func Load(path string) (Snapshot, error) {
+	var snap Snapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+func (m *Manager) Export() Snapshot {
+	backends := m.pool.Backends()
+	snap := Snapshot{
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		Backends:   make([]Backend, 0, len(backends)),
+	}
+
+	for _, b := range backends {
+		snap.Backends = append(snap.Backends, Backend{
+			Name:           b.Name(),
+			URL:            b.URL().String(),
+			Weight:         b.BaseWeight(),
+			HealthOverride: b.HealthOverride().String(),
+			Draining:       b.Holders(backend.StateDraining)&backend.OwnerAdmin != 0,
+			Maintenance:    b.Holders(backend.StateMaintenance)&backend.OwnerAdmin != 0,
+		})
+	}
+
+	if m.registry != nil {
+		snap.Breakers = make(map[string]Breaker)
+		stats := m.registry.Stats()
+		for _, b := range backends {
+			if _, ok := stats[b.Name()]; !ok {
+				continue
+			}
+			cb := m.registry.GetBreaker(b.Name())
+			snap.Breakers[b.Name()] = Breaker{
+				State:      cb.State().String(),
+				Failures:   cb.Failures(),
+				RetryAfter: Duration(cb.RetryAfter()),
+			}
+		}
+	}
+
+	if ring, ok := m.strategy.(strategy.MemberLister); ok {
+		for _, b := range ring.Members() {
+			snap.Affinity = append(snap.Affinity, b.Name())
+		}
+	}
+
+	return snap
+}
+
+// Import applies snap. It is validated as a whole first, so an invalid
+// snapshot changes nothing.
+func (m *Manager) Import(snap Snapshot) (Result, error) {
+	var result Result
+	if snap.Version < MinVersion || snap.Version > Version {
+		return result, fmt.Errorf("unsupported state version %d, want %d to %d", snap.Version, MinVersion, Version)
+	}
+
+	overrides := make([]backend.HealthOverride, len(snap.Backends))
+	for i, s := range snap.Backends {
+		override, err := parseOverride(s.HealthOverride)
+		if err != nil {
+			return result, fmt.Errorf("backend %s: %w", s.Name, err)
+		}
+		if s.Weight < 0 {
+			return result, fmt.Errorf("backend %s: weight must not be negative", s.Name)
+		}
+		overrides[i] = override
+	}
+	states := make(map[string]circuitbreaker.State, len(snap.Breakers))
+	for name, s := range snap.Breakers {
+		state, err := circuitbreaker.ParseState(s.State)
+		if err != nil {
+			return result, fmt.Errorf("breaker %s: %w", name, err)
+		}
+		states[name] = state
+	}
+
+	for i, s := range snap.Backends {
+		b := m.find(s)
+		if b == nil {
+			result.Unknown = append(result.Unknown, s.Name)
+			continue
+		}
+		if s.Weight == b.ConfiguredWeight() {
+			b.ReleaseWeight(backend.OwnerAdmin)
+		} else {
+			b.HoldWeight(backend.OwnerAdmin, s.Weight)
+		}
+		b.SetHealthOverride(overrides[i])
+		b.SetDraining(s.Draining)
+		b.SetMaintenance(s.Maintenance)
+		result.Backends++
+
+		if breaker, ok := snap.Breakers[s.Name]; ok && m.registry != nil {
+			m.registry.GetBreaker(b.Name()).Restore(states[s.Name], breaker.Failures, time.Duration(breaker.RetryAfter))
+			result.Breakers++
+		}
+	}
+
+	if ring, ok := m.strategy.(strategy.Rebuilder); ok && len(snap.Affinity) > 0 {
+		var members []*backend.Backend
+		for _, name := range snap.Affinity {
+			if b := m.find(Backend{Name: name}); b != nil {
+				members = append(members, b)
+			}
+		}
+		if len(members) > 0 {
+			ring.Rebuild(members)
+			result.Affinity = len(members)
+		}
+	}
+
+	return result, nil
+}
+
+func (m *Manager) find(s Backend) *backend.Backend {
+	backends := m.pool.Backends()
+	for _, b := range backends {
+		if b.Name() == s.Name {
+			return b
+		}
+	}
+	for _, b := range backends {
+		if s.URL != "" && b.URL().String() == s.URL {
+			return b
+		}
+	}
+	return nil
+}
+
+func parseOverride(s string) (backend.HealthOverride, error) {
+	for _, o := range []backend.HealthOverride{backend.OverrideNone, backend.OverrideHealthy, backend.OverrideUnhealthy} {
+		if o.String() == s {
+			return o, nil
+		}
+	}
+	return backend.OverrideNone, fmt.Errorf("unknown health override %q", s)
+}
@@ -0,0 +1,168 @@
+package state_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/state"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Manager", func() {
+	newBackends := func() []*backend.Backend {
+		var backends []*backend.Backend
+		for _, name := range []string{"a", "b", "c"} {
+			u, _ := url.Parse("http://" + name + ".internal:8080")
+			b := backend.New(u, 1, backend.WithName(name))
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+		return backends
+	}
+
+	var (
+		source   []*backend.Backend
+		registry *circuitbreaker.Registry
+		ring     strategy.Strategy
+		manager  *state.Manager
+	)
+
+	BeforeEach(func() {
+		source = newBackends()
+		registry = circuitbreaker.NewRegistry(2, time.Minute)
+		ring = strategy.NewConsistentHashStrategy(10)
+		manager = state.NewManager(backend.NewPool(source), registry, ring)
+
+		source[0].SetWeight(5)
+		source[1].SetDraining(true)
+		source[1].SetHealthOverride(backend.OverrideUnhealthy)
+		source[2].SetMaintenance(true)
+		registry.GetBreaker("a").RecordFailure()
+		registry.GetBreaker("b").RecordFailure()
+		registry.GetBreaker("b").RecordFailure()
+		ring.(strategy.Rebuilder).Rebuild(source[:2])
+	})
+
+	It("should export weights, flags, breakers and the ring", func() {
+		snap := manager.Export()
+
+		Expect(snap.Version).To(Equal(state.Version))
+		Expect(snap.Backends).To(Equal([]state.Backend{
+			{Name: "a", URL: "http://a.internal:8080", Weight: 5},
+			{Name: "b", URL: "http://b.internal:8080", Weight: 1, HealthOverride: "unhealthy", Draining: true},
+			{Name: "c", URL: "http://c.internal:8080", Weight: 1, Maintenance: true},
+		}))
+		Expect(snap.Breakers).To(HaveLen(2))
+		Expect(snap.Breakers["a"]).To(Equal(state.Breaker{State: "CLOSED", Failures: 1}))
+		Expect(snap.Breakers["b"].State).To(Equal("OPEN"))
+		Expect(time.Duration(snap.Breakers["b"].RetryAfter)).To(BeNumerically("~", time.Minute, time.Second))
+		Expect(snap.Affinity).To(Equal([]string{"a", "b"}))
+	})
+
+	It("should restore an export into a fresh instance", func() {
+		target := newBackends()
+		targetRegistry := circuitbreaker.NewRegistry(2, time.Minute)
+		targetRing := strategy.NewConsistentHashStrategy(10)
+
+		result, err := state.NewManager(backend.NewPool(target), targetRegistry, targetRing).Import(manager.Export())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(state.Result{Backends: 3, Breakers: 2, Affinity: 2}))
+
+		Expect(target[0].BaseWeight()).To(Equal(5))
+		Expect(target[1].IsDraining()).To(BeTrue())
+		Expect(target[1].IsHealthy()).To(BeFalse())
+		Expect(target[2].InMaintenance()).To(BeTrue())
+		Expect(targetRegistry.GetBreaker("a").Failures()).To(Equal(1))
+		Expect(targetRegistry.GetBreaker("b").State()).To(Equal(circuitbreaker.StateOpen))
+		Expect(targetRegistry.GetBreaker("b").RetryAfter()).To(BeNumerically("~", time.Minute, time.Second))
+		Expect(targetRing.(strategy.MemberLister).Members()).To(Equal(target[:2]))
+	})
+
+	It("should write retry_after as a duration string and read version 1 nanoseconds", func() {
+		data, err := json.Marshal(manager.Export())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(MatchRegexp(`"retry_after":"\d+(\.\d+)?s"`))
+
+		var snap state.Snapshot
+		Expect(json.Unmarshal([]byte(`{"version":1,"backends":[{"name":"b","url":"http://b.internal:8080","weight":1}],"breakers":{"b":{"state":"OPEN","failures":2,"retry_after":30000000000}}}`), &snap)).To(Succeed())
+		Expect(time.Duration(snap.Breakers["b"].RetryAfter)).To(Equal(30 * time.Second))
+
+		target := newBackends()
+		targetRegistry := circuitbreaker.NewRegistry(2, time.Minute)
+		_, err = state.NewManager(backend.NewPool(target), targetRegistry, nil).Import(snap)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targetRegistry.GetBreaker("b").RetryAfter()).To(BeNumerically("~", 30*time.Second, time.Second))
+
+		Expect(json.Unmarshal([]byte(`{"breakers":{"b":{"state":"OPEN","retry_after":"soon"}}}`), &snap)).NotTo(Succeed())
+	})
+
+	It("should match backends by URL and report unknown ones", func() {
+		snap := manager.Export()
+		snap.Backends[0].Name = "renamed"
+		snap.Backends = append(snap.Backends, state.Backend{Name: "gone", URL: "http://gone.internal:8080", Weight: 1})
+
+		target := newBackends()
+		result, err := state.NewManager(backend.NewPool(target), nil, strategy.NewRoundRobinStrategy()).Import(snap)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Backends).To(Equal(3))
+		Expect(result.Unknown).To(Equal([]string{"gone"}))
+		Expect(target[0].BaseWeight()).To(Equal(5))
+	})
+
+	It("should reject invalid snapshots without applying any of them", func() {
+		target := newBackends()
+		m := state.NewManager(backend.NewPool(target), nil, nil)
+
+		snap := manager.Export()
+		snap.Version = state.Version + 1
+		_, err := m.Import(snap)
+		Expect(err).To(MatchError(ContainSubstring("unsupported state version")))
+
+		snap = manager.Export()
+		snap.Breakers["c"] = state.Breaker{State: "ajar"}
+		_, err = m.Import(snap)
+		Expect(err).To(HaveOccurred())
+
+		snap = manager.Export()
+		snap.Backends[2].HealthOverride = "sick"
+		_, err = m.Import(snap)
+		Expect(err).To(HaveOccurred())
+
+		Expect(target[0].BaseWeight()).To(Equal(1))
+	})
+
+	It("should follow backends joining and leaving the pool", func() {
+		target := newBackends()
+		pool := backend.NewPool(target[:1])
+		m := state.NewManager(pool, nil, nil)
+		pool.Add(target[1])
+
+		result, err := m.Import(manager.Export())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Backends).To(Equal(2))
+		Expect(target[1].IsDraining()).To(BeTrue())
+
+		pool.Remove(target[0])
+		Expect(m.Export().Backends).To(HaveLen(1))
+	})
+
+	It("should load a snapshot written to a file", func() {
+		data, err := json.Marshal(manager.Export())
+		Expect(err).NotTo(HaveOccurred())
+		path := filepath.Join(GinkgoT().TempDir(), "state.json")
+		Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+
+		snap, err := state.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.Backends).To(HaveLen(3))
+		Expect(snap.Breakers["b"].State).To(Equal("OPEN"))
+	})
+})
@@ -0,0 +1,179 @@
+package strategy
+
+import (
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// Eligible reports whether a backend picked by a chained strategy may take
+// the request.
+type Eligible func(b *backend.Backend) bool
+
+// MaxLoad returns an Eligible that refuses backends holding max or more
+// active connections. Zero accepts every backend.
+func MaxLoad(max int) Eligible {
+	return func(b *backend.Backend) bool {
+		return max <= 0 || b.ActiveConnections() < max
+	}
+}
+
+// MaxLatency returns an Eligible that refuses backends whose smoothed
+// response time exceeds max. Zero accepts every backend.
+func MaxLatency(max time.Duration) Eligible {
+	return func(b *backend.Backend) bool {
+		return max <= 0 || b.EWMATime() <= max
+	}
+}
+
+// MaxReportedLoad returns an Eligible that refuses backends reporting a
+// utilisation of max or more through X-LB-Load. Backends that report none
+// are accepted, as is every backend when max is zero.
+func MaxReportedLoad(max float64) Eligible {
+	return func(b *backend.Backend) bool {
+		load, ok := b.ReportedLoad()
+		return max <= 0 || !ok || load < max
+	}
+}
+
+// AllOf returns an Eligible accepting backends that every one of eligible
+// accepts. Nil entries are ignored.
+func AllOf(eligible ...Eligible) Eligible {
+	return func(b *backend.Backend) bool {
+		for _, e := range eligible {
+			if e != nil && !e(b) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+type chainStrategy struct {
+	reporter
+	strategies []Strategy
+	eligible   Eligible
+}
+
+// NewChain returns a strategy that asks strategies in order and takes the
+// first backend picked that eligible accepts, so e.g. consistent_hash
+// followed by least-conn keeps clients on their backend until it is loaded.
+// When no pick is eligible the last one is taken rather than fail the
+// request. A nil eligible accepts every pick, moving on only on nil.
+// A chain with a hashing strategy hashes like the first one it holds.
+func NewChain(eligible Eligible, strategies ...Strategy) Strategy {
+	if eligible == nil {
+		eligible = func(*backend.Backend) bool { return true }
+	}
+	c := &chainStrategy{strategies: strategies, eligible: eligible}
+
+	for _, s := range strategies {
+		if _, ok := s.(Keyer); ok {
+			return &hashChain{chainStrategy: c, hash: s}
+		}
+	}
+	return c
+}
+
+func (c *chainStrategy) SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend {
+	var last *backend.Backend
+	taken := 0
+	for i, s := range c.strategies {
+		b := s.SelectBackend(ctx, backends)
+		if b == nil {
+			continue
+		}
+		last, taken = b, i
+		if c.eligible(b) {
+			break
+		}
+	}
+	if last != nil && taken > 0 {
+		c.report(DecisionChainFallback, float64(taken))
+	}
+	return last
+}
+
+// SetReporter reports the chain's fallbacks and the decisions of the
+// strategies it holds to r.
+func (c *chainStrategy) SetReporter(r Reporter) {
+	c.reporter.SetReporter(r)
+	for _, s := range c.strategies {
+		if rs, ok := s.(Reporting); ok {
+			rs.SetReporter(r)
+		}
+	}
+}
+
+// Observe passes the outcome of every attempt to the strategies in the chain
+// that learn from it.
+func (c *chainStrategy) Observe(b *backend.Backend, rtt time.Duration, failed bool) {
+	for _, s := range c.strategies {
+		if o, ok := s.(Observer); ok {
+			o.Observe(b, rtt, failed)
+		}
+	}
+}
+
+// UpdateBackends passes backends to the strategies in the chain that
+// precompute from them.
+func (c *chainStrategy) UpdateBackends(backends []*backend.Backend) {
+	for _, s := range c.strategies {
+		if u, ok := s.(Updater); ok {
+			u.UpdateBackends(backends)
+		}
+	}
+}
+
+// Forget passes a backend that left the pool to the strategies in the chain
+// that keep state per backend.
+func (c *chainStrategy) Forget(b *backend.Backend) {
+	for _, s := range c.strategies {
+		if f, ok := s.(Forgetter); ok {
+			f.Forget(b)
+		}
+	}
+}
+
+// HonoursShift reports whether every strategy in the chain scales weights by
+// shift factors, so the load balancer need not narrow its candidates.
+func (c *chainStrategy) HonoursShift() bool {
+	for _, s := range c.strategies {
+		if sh, ok := s.(Shifter); !ok || !sh.HonoursShift() {
+			return false
+		}
+	}
+	return true
+}
+
+// hashChain is a chain holding a hashing strategy. Clients are pinned to
+// what that strategy picks, so a request a later strategy serves counts as
+// an affinity failover.
+type hashChain struct {
+	*chainStrategy
+	hash Strategy
+}
+
+func (c *hashChain) Key(ctx SelectionContext) string {
+	return c.hash.(Keyer).Key(ctx)
+}
+
+func (c *hashChain) AffinityStrategy() Strategy {
+	return c.hash
+}
+
+// Rebuild rebuilds the rings of the hashing strategies in the chain.
+func (c *hashChain) Rebuild(backends []*backend.Backend) {
+	for _, s := range c.strategies {
+		if r, ok := s.(Rebuilder); ok {
+			r.Rebuild(backends)
+		}
+	}
+}
+
+func (c *hashChain) Members() []*backend.Backend {
+	if m, ok := c.hash.(MemberLister); ok {
+		return m.Members()
+	}
+	return nil
+}
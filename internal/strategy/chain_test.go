@@ -0,0 +1,134 @@
+package strategy_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+// fixedStrategy always picks the same backend, nil for none.
+type fixedStrategy struct {
+	pick *backend.Backend
+}
+
+func (s fixedStrategy) SelectBackend(strategy.SelectionContext, []*backend.Backend) *backend.Backend {
+	return s.pick
+}
+
+var _ = Describe("Chain", func() {
+	var backends []*backend.Backend
+
+	BeforeEach(func() {
+		backends = []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+		}
+	})
+
+	It("should move on to the next strategy when one picks nothing", func() {
+		chain := strategy.NewChain(nil, fixedStrategy{}, fixedStrategy{pick: backends[1]})
+
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[1]))
+	})
+
+	It("should move on when the pick is at the load limit", func() {
+		chain := strategy.NewChain(strategy.MaxLoad(2), fixedStrategy{pick: backends[0]}, strategy.NewLeastConnStrategy())
+
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[0]))
+
+		backends[0].IncrementConn()
+		backends[0].IncrementConn()
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[1]))
+	})
+
+	It("should take the last pick when none is below the limit", func() {
+		for range 2 {
+			backends[0].IncrementConn()
+			backends[1].IncrementConn()
+		}
+		chain := strategy.NewChain(strategy.MaxLoad(1), fixedStrategy{pick: backends[0]}, fixedStrategy{pick: backends[1]})
+
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[1]))
+	})
+
+	It("should report fallbacks and pass the reporter on to its strategies", func() {
+		var decisions []strategy.Decision
+		ring := strategy.NewConsistentHashStrategy(10)
+		chain := strategy.NewChain(strategy.MaxLoad(1), ring, fixedStrategy{pick: backends[1]})
+		chain.(strategy.Reporting).SetReporter(func(d strategy.Decision) { decisions = append(decisions, d) })
+
+		ring.(strategy.Rebuilder).Rebuild(backends[:1])
+		Expect(chain.SelectBackend(strategy.SelectionContext{ClientIP: "10.0.0.1"}, backends)).To(Equal(backends[0]))
+
+		backends[0].IncrementConn()
+		Expect(chain.SelectBackend(strategy.SelectionContext{ClientIP: "10.0.0.1"}, backends)).To(Equal(backends[1]))
+
+		Expect(decisions).To(Equal([]strategy.Decision{
+			{Kind: strategy.DecisionRingRebuild, Value: 1},
+			{Kind: strategy.DecisionChainFallback, Value: 1},
+		}))
+	})
+
+	It("should move on when the pick is slow or reports high load", func() {
+		eligible := strategy.AllOf(strategy.MaxLatency(100*time.Millisecond), strategy.MaxReportedLoad(0.9))
+		chain := strategy.NewChain(eligible, fixedStrategy{pick: backends[0]}, fixedStrategy{pick: backends[1]})
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[0]))
+
+		backends[0].RecordResponse(time.Second)
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[1]))
+
+		backends[1].SetReportedLoad(0.95)
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[1]))
+
+		chain = strategy.NewChain(eligible, fixedStrategy{pick: backends[1]}, fixedStrategy{pick: backends[0]}, fixedStrategy{pick: backends[1]})
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[1]))
+	})
+
+	It("should accept every backend with limits of zero", func() {
+		backends[0].RecordResponse(time.Hour)
+		backends[0].SetReportedLoad(1)
+		backends[0].IncrementConn()
+
+		eligible := strategy.AllOf(strategy.MaxLoad(0), strategy.MaxLatency(0), strategy.MaxReportedLoad(0), nil)
+		Expect(eligible(backends[0])).To(BeTrue())
+	})
+
+	It("should return nil when no strategy picks", func() {
+		chain := strategy.NewChain(strategy.MaxLoad(1), fixedStrategy{}, fixedStrategy{})
+
+		Expect(chain.SelectBackend(strategy.SelectionContext{}, backends)).To(BeNil())
+	})
+
+	It("should hash like the hashing strategy it holds", func() {
+		hash := strategy.NewIPHashStrategy(100, 24, 56)
+		chain := strategy.NewChain(nil, strategy.NewRoundRobinStrategy(), hash)
+		ctx := strategy.SelectionContext{ClientIP: "10.1.2.3"}
+
+		keyer, ok := chain.(strategy.Keyer)
+		Expect(ok).To(BeTrue())
+		Expect(keyer.Key(ctx)).To(Equal(hash.(strategy.Keyer).Key(ctx)))
+
+		affinity, ok := chain.(strategy.Affinity)
+		Expect(ok).To(BeTrue())
+		Expect(affinity.AffinityStrategy()).To(BeIdenticalTo(hash))
+	})
+
+	It("should pass pool updates on to the strategies that precompute", func() {
+		hash := strategy.NewConsistentHashStrategy(100)
+		chain := strategy.NewChain(nil, strategy.NewRoundRobinStrategy(), hash)
+
+		chain.(strategy.Updater).UpdateBackends(backends[:1])
+		Expect(hash.(strategy.MemberLister).Members()).To(ConsistOf(backends[0]))
+	})
+
+	It("should not hash without a hashing strategy", func() {
+		chain := strategy.NewChain(nil, strategy.NewRoundRobinStrategy(), strategy.NewLeastConnStrategy())
+
+		_, ok := chain.(strategy.Keyer)
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,76 @@
+package strategy
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/config"
+)
+
+// FromConfig builds the strategy cfg names with its settings. An unknown
+// type falls back to round-robin with a warning.
+func FromConfig(logger *slog.Logger, cfg config.StrategyConfig) (Strategy, error) {
+	switch cfg.Type {
+	case "round-robin":
+		return NewRoundRobinStrategy(), nil
+	case "random":
+		return NewRandomStrategy(), nil
+	case "least-conn":
+		return NewLeastConnStrategy(), nil
+	case "least-response":
+		return NewLeastResponseStrategy(), nil
+	case "consistent_hash":
+		return NewConsistentHashStrategy(cfg.VirtualNodes), nil
+	case "ip-hash":
+		return NewIPHashStrategy(cfg.VirtualNodes, cfg.IPv4Prefix, cfg.IPv6Prefix), nil
+	case "query-hash":
+		return NewQueryHashStrategy(cfg.VirtualNodes, cfg.HashParam, cfg.HashDefault), nil
+	case "cookie-hash":
+		return NewCookieHashStrategy(cfg.VirtualNodes, cfg.HashParam, cfg.HashDefault), nil
+	case "header-hash":
+		return NewHeaderHashStrategy(cfg.VirtualNodes, cfg.HashParam, cfg.HashDefault), nil
+	case "weighted-round-robin":
+		ramp := defaultWeightRamp
+		if cfg.WeightRamp != "" {
+			ramp, _ = time.ParseDuration(cfg.WeightRamp)
+		}
+		return NewWeightedRoundRobinStrategyWithRamp(ramp), nil
+	case "weighted-random":
+		return NewWeightedRandomStrategy(), nil
+	case "weighted-alias":
+		return NewWeightedAliasStrategy(), nil
+	case "peak-ewma":
+		decay, _ := time.ParseDuration(cfg.Decay)
+		penalty, _ := time.ParseDuration(cfg.ErrorPenalty)
+		if cfg.P2C {
+			return NewPeakEWMAStrategyWithP2C(decay, penalty), nil
+		}
+		return NewPeakEWMAStrategy(decay, penalty), nil
+	case "p95":
+		threshold, _ := time.ParseDuration(cfg.P95Threshold)
+		return NewPercentileStrategy(threshold), nil
+	case "warm":
+		return NewWarmStrategy(cfg.WarmPaths), nil
+	case "chain":
+		members := make([]Strategy, 0, len(cfg.Chain))
+		for _, t := range cfg.Chain {
+			member := cfg
+			member.Type = t
+			s, err := FromConfig(logger, member)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, s)
+		}
+		maxLatency, _ := time.ParseDuration(cfg.ChainMaxLatency)
+		eligible := AllOf(
+			MaxLoad(cfg.ChainMaxLoad),
+			MaxLatency(maxLatency),
+			MaxReportedLoad(cfg.ChainMaxReportedLoad),
+		)
+		return NewChain(eligible, members...), nil
+	default:
+		logger.Warn("Unkown strategy, defaulting to round-robin", slog.String("requested", cfg.Type))
+		return NewRoundRobinStrategy(), nil
+	}
+}
@@ -0,0 +1,198 @@
+package strategy_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/config"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("FromConfig", func() {
+	var log *slog.Logger
+
+	BeforeEach(func() {
+		log = slog.Default()
+	})
+
+	Context("valid strategies", func() {
+		It("should create round-robin strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "round-robin", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should create random strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "random", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should create least-conn strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "least-conn", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should create least-response strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "least-response", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should create peak-ewma strategy that observes attempts", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "peak-ewma", VirtualNodes: 100, Decay: "10s", ErrorPenalty: "1s"})
+			Expect(err).NotTo(HaveOccurred())
+			_, observes := strat.(strategy.Observer)
+			Expect(observes).To(BeTrue())
+		})
+
+		It("should create consistent hash strategy with virtual nodes", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "consistent_hash", VirtualNodes: 150})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should create ip-hash strategy with prefixes", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "ip-hash", VirtualNodes: 100, IPv4Prefix: 24, IPv6Prefix: 56})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+			keyer, keyed := strat.(strategy.Keyer)
+			Expect(keyed).To(BeTrue())
+			Expect(keyer.Key(strategy.SelectionContext{ClientIP: "203.0.113.10"})).To(Equal("203.0.113.0/24"))
+		})
+
+		It("should create query-hash strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "query-hash", VirtualNodes: 100, HashParam: "user_id"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat.(strategy.Keyer).Key(strategy.SelectionContext{RawQuery: "user_id=42"})).To(Equal("42"))
+		})
+
+		It("should create cookie-hash strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "cookie-hash", VirtualNodes: 100, HashParam: "session"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat.(strategy.Keyer).Key(strategy.SelectionContext{Header: http.Header{"Cookie": {"session=abc123"}}})).To(Equal("abc123"))
+		})
+
+		It("should create header-hash strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "header-hash", VirtualNodes: 100, HashParam: "X-Tenant-ID"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat.(strategy.Keyer).Key(strategy.SelectionContext{Header: http.Header{"X-Tenant-Id": {"acme"}}})).To(Equal("acme"))
+		})
+
+		It("should create a chain from its strategies", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "chain", VirtualNodes: 100, Chain: []string{"cookie-hash", "least-conn"}, HashParam: "session", ChainMaxLoad: 10})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat.(strategy.Keyer).Key(strategy.SelectionContext{Header: http.Header{"Cookie": {"session=abc123"}}})).To(Equal("abc123"))
+		})
+
+		It("should create a chain that passes slow backends on", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "chain", VirtualNodes: 100, Chain: []string{"round-robin", "least-response"}, ChainMaxLatency: "100ms"})
+			Expect(err).NotTo(HaveOccurred())
+
+			slowURL, _ := url.Parse("http://localhost:8081")
+			fastURL, _ := url.Parse("http://localhost:8082")
+			slow := backend.New(slowURL, 1)
+			fast := backend.New(fastURL, 1)
+			slow.RecordResponse(time.Second)
+			fast.RecordResponse(time.Millisecond)
+			for range 4 {
+				Expect(strat.SelectBackend(strategy.SelectionContext{}, []*backend.Backend{slow, fast})).To(Equal(fast))
+			}
+		})
+
+		It("should create weighted-round-robin strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "weighted-round-robin", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+	})
+
+	Context("default behavior", func() {
+		It("should default to round-robin for unknown strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "unknown-strategy", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should default to round-robin for empty strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should default to round-robin for invalid strategy name", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "!!invalid!!", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should default to round-robin for mixed case strategy", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "Round-Robin", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+	})
+
+	Context("virtual nodes parameter", func() {
+		It("should handle different virtual nodes parameters", func() {
+			strat1, err := strategy.FromConfig(log, config.StrategyConfig{Type: "consistent_hash", VirtualNodes: 50})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat1).NotTo(BeNil())
+
+			strat2, err := strategy.FromConfig(log, config.StrategyConfig{Type: "consistent_hash", VirtualNodes: 200})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat2).NotTo(BeNil())
+		})
+
+		It("should handle zero virtual nodes", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "consistent_hash", VirtualNodes: 0})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should handle negative virtual nodes", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "consistent_hash", VirtualNodes: -10})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should handle large virtual nodes value", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "consistent_hash", VirtualNodes: 10000})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should ignore virtual nodes for non-hash strategies", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "round-robin", VirtualNodes: 999})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+	})
+
+	Context("strategy name variations", func() {
+		It("should handle round-robin exactly", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "round-robin", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should handle consistent_hash with underscore", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "consistent_hash", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+
+		It("should handle weighted-round-robin with hyphens", func() {
+			strat, err := strategy.FromConfig(log, config.StrategyConfig{Type: "weighted-round-robin", VirtualNodes: 100})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strat).NotTo(BeNil())
+		})
+	})
+})
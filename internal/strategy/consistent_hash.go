@@ -2,6 +2,7 @@ package strategy
 
 import (
 	"hash/crc32"
+	"slices"
 	"sort"
 	"strconv"
 	"sync"
@@ -11,96 +12,179 @@ import (
 )
 
 type consistentHashStrategy struct {
+	reporter
 	virtualNodes int
 	ring         atomic.Value
+	miss         atomic.Pointer[ringSnapshot]
 	mutex        sync.Mutex
-	hashKey      atomic.Uint32
+	key          func(ctx SelectionContext) string
 }
 
+// ringSnapshot is a hash ring. Each point refers to its owner by its index
+// in members, so a lookup can mark the candidates in a bitset instead of
+// collecting them in a map.
 type ringSnapshot struct {
-	positions []uint32
-	owners    map[uint32]*backend.Backend
+	points  []ringPoint
+	members []*backend.Backend
+	index   map[*backend.Backend]int
+}
+
+type ringPoint struct {
+	hash  uint32
+	owner int
 }
 
 func buildRing(backends []*backend.Backend, vnodes int) *ringSnapshot {
 	rs := &ringSnapshot{
-		positions: make([]uint32, 0, len(backends)*vnodes),
-		owners:    make(map[uint32]*backend.Backend),
+		points: make([]ringPoint, 0, len(backends)*vnodes),
+		index:  make(map[*backend.Backend]int, len(backends)),
 	}
 
 	for _, b := range backends {
-		for i := 0; i < vnodes; i++ {
-			key := b.URL().String() + "#" + strconv.Itoa(i)
-			hash := crc32.ChecksumIEEE([]byte(key))
+		if _, ok := rs.index[b]; ok {
+			continue
+		}
+		owner := len(rs.members)
+		rs.index[b] = owner
+		rs.members = append(rs.members, b)
 
-			rs.positions = append(rs.positions, hash)
-			rs.owners[hash] = b
+		for i := 0; i < vnodes; i++ {
+			key := b.Name() + "#" + strconv.Itoa(i)
+			rs.points = append(rs.points, ringPoint{hash: crc32.ChecksumIEEE([]byte(key)), owner: owner})
 		}
 	}
 
-	sort.Slice(rs.positions, func(i, j int) bool { return rs.positions[i] < rs.positions[j] })
+	sort.Slice(rs.points, func(i, j int) bool { return rs.points[i].hash < rs.points[j].hash })
 	return rs
 }
 
-func (r *ringSnapshot) lookup(hash uint32) *backend.Backend {
-	if r == nil || len(r.positions) == 0 {
+// lookup returns the first owner clockwise from hash that is one of the
+// candidates, so a ring shared with peer instances keeps its layout while
+// locally unavailable backends are skipped. It returns nil if no candidate is
+// on the ring.
+func (r *ringSnapshot) lookup(hash uint32, candidates []*backend.Backend) *backend.Backend {
+	if r == nil || len(r.points) == 0 {
+		return nil
+	}
+
+	var buf [4]uint64
+	allowed := buf[:]
+	if words := (len(r.members) + 63) / 64; words > len(buf) {
+		allowed = make([]uint64, words)
+	}
+	found := false
+	for _, b := range candidates {
+		if i, ok := r.index[b]; ok {
+			allowed[i/64] |= 1 << (i % 64)
+			found = true
+		}
+	}
+	if !found {
 		return nil
 	}
 
-	idx := sort.Search(len(r.positions), func(i int) bool {
-		return r.positions[i] >= hash
+	idx := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
 	})
 
-	if idx == len(r.positions) {
-		idx = 0
+	for i := 0; i < len(r.points); i++ {
+		owner := r.points[(idx+i)%len(r.points)].owner
+		if allowed[owner/64]&(1<<(owner%64)) != 0 {
+			return r.members[owner]
+		}
 	}
 
-	return r.owners[r.positions[idx]]
+	return nil
 }
 
-func (s *consistentHashStrategy) SelectBackend(backends []*backend.Backend) *backend.Backend {
+func (s *consistentHashStrategy) SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend {
 	val := s.ring.Load()
 	rs, _ := val.(*ringSnapshot)
 
-	if rs == nil || len(rs.positions) == 0 {
+	if rs == nil || len(rs.points) == 0 {
 		s.mutex.Lock()
 		defer s.mutex.Unlock()
 
 		val := s.ring.Load()
 		rs, _ = val.(*ringSnapshot)
-		if rs == nil || len(rs.positions) == 0 {
+		if rs == nil || len(rs.points) == 0 {
 			rs = buildRing(backends, s.virtualNodes)
 			s.ring.Store(rs)
 		}
 	}
 
-	return rs.lookup(s.hashKey.Load())
+	hash := crc32.ChecksumIEEE([]byte(s.key(ctx)))
+	if chosen := rs.lookup(hash, backends); chosen != nil {
+		return chosen
+	}
+
+	// None of the candidates is on the ring, e.g. peers voted them all off.
+	// Hash over a ring of the candidates alone rather than failing the
+	// request, kept until it no longer holds any of them.
+	s.report(DecisionRingMiss, float64(len(backends)))
+	if chosen := s.miss.Load().lookup(hash, backends); chosen != nil {
+		return chosen
+	}
+	miss := buildRing(backends, s.virtualNodes)
+	s.miss.Store(miss)
+	return miss.lookup(hash, backends)
 }
 
-func (s *consistentHashStrategy) SetKey(key string) {
-	hash := crc32.ChecksumIEEE([]byte(key))
-	s.hashKey.Store(hash)
+func (s *consistentHashStrategy) Key(ctx SelectionContext) string {
+	return s.key(ctx)
 }
 
+// NewConsistentHashStrategy returns a strategy that places each request on a
+// hash ring by its HashKey, or its client IP when it has none.
 func NewConsistentHashStrategy(virtualNodes int) Strategy {
+	return newConsistentHash(virtualNodes, func(ctx SelectionContext) string {
+		if ctx.HashKey != "" {
+			return ctx.HashKey
+		}
+		return ctx.ClientIP
+	})
+}
+
+// newConsistentHash returns a hash ring strategy that places selections by
+// the key key derives from them.
+func newConsistentHash(virtualNodes int, key func(ctx SelectionContext) string) *consistentHashStrategy {
 	if virtualNodes <= 0 {
 		virtualNodes = 100
 	}
 
-	ipHashStrategy := &consistentHashStrategy{virtualNodes: virtualNodes}
+	s := &consistentHashStrategy{virtualNodes: virtualNodes, key: key}
 
-	ipHashStrategy.ring.Store(&ringSnapshot{
-		positions: nil,
-		owners:    nil,
-	})
+	s.ring.Store(&ringSnapshot{})
 
-	return ipHashStrategy
+	return s
 }
 
+// Rebuild replaces the ring with one built from backends. Selection then only
+// considers backends on the ring while at least one of them is available.
 func (s *consistentHashStrategy) Rebuild(backends []*backend.Backend) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	rs := buildRing(backends, s.virtualNodes)
 	s.ring.Store(rs)
+	s.miss.Store(nil)
+	s.report(DecisionRingRebuild, float64(len(backends)))
+}
+
+// UpdateBackends rebuilds the ring from backends.
+func (s *consistentHashStrategy) UpdateBackends(backends []*backend.Backend) {
+	s.Rebuild(backends)
+}
+
+// Members returns the backends on the ring ordered by name, or nil before the
+// ring is built.
+func (s *consistentHashStrategy) Members() []*backend.Backend {
+	rs, _ := s.ring.Load().(*ringSnapshot)
+	if rs == nil {
+		return nil
+	}
+
+	members := slices.Clone(rs.members)
+	sort.Slice(members, func(i, j int) bool { return members[i].Name() < members[j].Name() })
+	return members
 }
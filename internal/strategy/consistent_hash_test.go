@@ -1,6 +1,9 @@
 package strategy_test
 
 import (
+	"fmt"
+	"sync"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -26,20 +29,141 @@ var _ = Describe("ConsistentHash", func() {
 		}
 	})
 
-	Describe("SelectBackend with SetKey", func() {
+	It("should key on the hash key rather than the client IP when one is set", func() {
+		keyer := strat.(strategy.Keyer)
+		Expect(keyer.Key(strategy.SelectionContext{ClientIP: "192.168.1.100", HashKey: "tenant-a"})).To(Equal("tenant-a"))
+
+		first := strat.SelectBackend(strategy.SelectionContext{ClientIP: "192.168.1.100", HashKey: "tenant-a"}, backends)
+		for i := range 20 {
+			ctx := strategy.SelectionContext{ClientIP: fmt.Sprintf("10.0.0.%d", i), HashKey: "tenant-a"}
+			Expect(strat.SelectBackend(ctx, backends)).To(Equal(first))
+		}
+	})
+
+	Describe("SelectBackend with a client IP", func() {
 		It("should return same backend for same IP", func() {
-			hasher, ok := strat.(interface{ SetKey(string) })
+			keyer, ok := strat.(strategy.Keyer)
 			Expect(ok).To(BeTrue())
 
-			ip := "192.168.1.100"
-			hasher.SetKey(ip)
-			first := strat.SelectBackend(backends)
+			ctx := strategy.SelectionContext{ClientIP: "192.168.1.100"}
+			Expect(keyer.Key(ctx)).To(Equal("192.168.1.100"))
+			first := strat.SelectBackend(ctx, backends)
 
 			for i := 0; i < 5; i++ {
-				hasher.SetKey(ip)
-				selected := strat.SelectBackend(backends)
+				selected := strat.SelectBackend(ctx, backends)
 				Expect(selected).To(Equal(first))
 			}
 		})
+
+		It("should not let concurrent selections overwrite each other's key", func() {
+			clients := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}
+			expected := make(map[string]*backend.Backend)
+			for _, ip := range clients {
+				expected[ip] = strat.SelectBackend(strategy.SelectionContext{ClientIP: ip}, backends)
+			}
+
+			var wg sync.WaitGroup
+			for _, ip := range clients {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					for range 200 {
+						Expect(strat.SelectBackend(strategy.SelectionContext{ClientIP: ip}, backends)).To(Equal(expected[ip]))
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	})
+
+	Describe("backend names", func() {
+		It("should keep ring positions when a named backend changes address", func() {
+			named := func(port string) []*backend.Backend {
+				return []*backend.Backend{
+					backend.New(mustParseURL("http://localhost:8081"), 1, backend.WithName("a")),
+					backend.New(mustParseURL("http://localhost:"+port), 1, backend.WithName("b")),
+					backend.New(mustParseURL("http://localhost:8083"), 1, backend.WithName("c")),
+				}
+			}
+			before, after := named("8082"), named("9092")
+
+			s1 := strategy.NewConsistentHashStrategy(100)
+			s2 := strategy.NewConsistentHashStrategy(100)
+			for _, key := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+				ctx := strategy.SelectionContext{ClientIP: key}
+				Expect(s1.SelectBackend(ctx, before).Name()).To(Equal(s2.SelectBackend(ctx, after).Name()))
+			}
+		})
+	})
+
+	Describe("Rebuild", func() {
+		It("should keep the ring layout and skip owners that are not candidates", func() {
+			ctx := strategy.SelectionContext{ClientIP: "192.168.1.100"}
+			strat.(strategy.Rebuilder).Rebuild(backends)
+
+			owner := strat.SelectBackend(ctx, backends)
+
+			var rest []*backend.Backend
+			for _, b := range backends {
+				if b != owner {
+					rest = append(rest, b)
+				}
+			}
+
+			fallback := strat.SelectBackend(ctx, rest)
+			Expect(fallback).NotTo(BeNil())
+			Expect(fallback).NotTo(Equal(owner))
+
+			Expect(strat.SelectBackend(ctx, backends)).To(Equal(owner))
+		})
+
+		It("should hash over the candidates when none is on the ring", func() {
+			strat.(strategy.Rebuilder).Rebuild(backends[:1])
+
+			ctx := strategy.SelectionContext{ClientIP: "192.168.1.100"}
+			Expect(strat.SelectBackend(ctx, backends[1:])).To(BeElementOf(backends[1], backends[2]))
+		})
+
+		It("should keep hashing over the candidates off the ring while any of them is left", func() {
+			others := make([]*backend.Backend, 10)
+			for i := range others {
+				others[i] = backend.New(mustParseURL(fmt.Sprintf("http://localhost:%d", 9000+i)), 1)
+			}
+			strat.(strategy.Rebuilder).Rebuild(backends)
+
+			ctx := strategy.SelectionContext{ClientIP: "192.168.1.100"}
+			owner := strat.SelectBackend(ctx, others)
+			var rest []*backend.Backend
+			for _, b := range others {
+				if b != others[0] && b != owner {
+					rest = append(rest, b)
+				}
+			}
+			Expect(strat.SelectBackend(ctx, append(rest, owner))).To(Equal(owner))
+		})
+
+		It("should skip owners that are not candidates on rings of any size", func() {
+			many := make([]*backend.Backend, 300)
+			for i := range many {
+				many[i] = backend.New(mustParseURL(fmt.Sprintf("http://localhost:%d", 9000+i)), 1)
+			}
+			strat.(strategy.Rebuilder).Rebuild(many)
+
+			for i := range 50 {
+				ctx := strategy.SelectionContext{ClientIP: fmt.Sprintf("10.0.0.%d", i)}
+				Expect(strat.SelectBackend(ctx, many[290:])).To(BeElementOf(many[290:]))
+			}
+		})
+	})
+
+	Describe("Members", func() {
+		It("should list the ring owners once each, by name", func() {
+			lister := strat.(strategy.MemberLister)
+			Expect(lister.Members()).To(BeNil())
+
+			strat.(strategy.Rebuilder).Rebuild([]*backend.Backend{backends[2], backends[0]})
+			Expect(lister.Members()).To(Equal([]*backend.Backend{backends[0], backends[2]}))
+		})
 	})
 })
@@ -5,8 +5,22 @@
 //   - Random: Random backend selection
 //   - Least Connections: Routes to backend with fewest active connections
 //   - Least Response Time: Routes based on exponentially weighted moving average (EWMA) response times
-//   - IP Hash: Consistent hashing for session affinity
+//   - Consistent Hash: Consistent hashing for session affinity
+//   - IP Hash: Consistent hashing keyed on the client's network prefix
+//   - Query/Cookie/Header Hash: Consistent hashing keyed on a query parameter, cookie or header
 //   - Weighted Round Robin: Distribution proportional to backend weights
+//   - Weighted Random: Random selection with probability proportional to backend weights
+//   - Weighted Alias: Weighted random in constant time from a precomputed alias table
+//   - Peak EWMA: Routes on decayed peak latency times outstanding requests, penalizing errors
+//   - P95: Least connections among backends whose recent P95 latency is below a threshold
+//   - Warm: Least connections among backends with an idle keep-alive connection, for latency-sensitive paths
+//   - Chain: Asks strategies in order, falling back when a pick is missing or loaded
 //
 // All strategies respect backend health status and only select healthy backends.
+// Each selection receives a SelectionContext describing the request, from
+// which hashing strategies derive their key.
+//
+// Strategies that precompute from the backends, such as a hash ring or an
+// alias table, implement Updater; FollowPool calls it whenever the pool
+// changes, so that work stays out of SelectBackend.
 package strategy
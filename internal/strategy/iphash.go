@@ -0,0 +1,51 @@
+package strategy
+
+import (
+	"net/netip"
+)
+
+const (
+	DefaultIPv4Prefix = 24
+	DefaultIPv6Prefix = 56
+)
+
+// maskIP reduces addr to its network prefix. Keys that are not IP addresses
+// are returned unchanged so they still hash deterministically.
+func maskIP(addr string, ipv4Prefix, ipv6Prefix int) string {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return addr
+	}
+
+	ip = ip.Unmap().WithZone("")
+
+	bits := ipv6Prefix
+	if ip.Is4() {
+		bits = ipv4Prefix
+	}
+
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return ip.String()
+	}
+
+	return prefix.String()
+}
+
+// NewIPHashStrategy returns a consistent hash keyed on the client's network
+// prefix rather than its exact address, so clients whose address rotates
+// within one network (mobile carriers, IPv6 privacy addresses) keep their
+// affinity. A negative or too long prefix uses the default; a zero prefix
+// keys every client of that address family alike.
+func NewIPHashStrategy(virtualNodes, ipv4Prefix, ipv6Prefix int) Strategy {
+	if ipv4Prefix < 0 || ipv4Prefix > 32 {
+		ipv4Prefix = DefaultIPv4Prefix
+	}
+	if ipv6Prefix < 0 || ipv6Prefix > 128 {
+		ipv6Prefix = DefaultIPv6Prefix
+	}
+
+	return newConsistentHash(virtualNodes, func(ctx SelectionContext) string {
+		return maskIP(ctx.ClientIP, ipv4Prefix, ipv6Prefix)
+	})
+}
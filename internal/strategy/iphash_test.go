@@ -0,0 +1,92 @@
+package strategy_test
+
+import (
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("IPHash", func() {
+	var (
+		strat    strategy.Strategy
+		backends []*backend.Backend
+	)
+
+	selectFor := func(ip string) *backend.Backend {
+		return strat.SelectBackend(strategy.SelectionContext{ClientIP: ip}, backends)
+	}
+
+	BeforeEach(func() {
+		backends = make([]*backend.Backend, 0, 16)
+		for port := 9000; port < 9016; port++ {
+			b := backend.New(mustParseURL("http://localhost:"+strconv.Itoa(port)), 1)
+			b.SetHealthy(true)
+			backends = append(backends, b)
+		}
+	})
+
+	Context("with default prefixes", func() {
+		BeforeEach(func() {
+			strat = strategy.NewIPHashStrategy(100, -1, -1)
+		})
+
+		It("should keep affinity within an IPv4 /24", func() {
+			first := selectFor("203.0.113.10")
+			for _, ip := range []string{"203.0.113.1", "203.0.113.77", "203.0.113.254"} {
+				Expect(selectFor(ip)).To(BeIdenticalTo(first))
+			}
+		})
+
+		It("should keep affinity within an IPv6 /56", func() {
+			first := selectFor("2001:db8:abcd:1200::1")
+			for _, ip := range []string{"2001:db8:abcd:1201::42", "2001:db8:abcd:12ff:ffff::9"} {
+				Expect(selectFor(ip)).To(BeIdenticalTo(first))
+			}
+		})
+
+		It("should treat IPv4-mapped IPv6 addresses as IPv4", func() {
+			Expect(selectFor("::ffff:203.0.113.10")).To(BeIdenticalTo(selectFor("203.0.113.99")))
+		})
+
+		It("should spread different networks across backends", func() {
+			seen := make(map[*backend.Backend]bool)
+			for i := 0; i < 64; i++ {
+				seen[selectFor("10.0."+strconv.Itoa(i)+".1")] = true
+			}
+			Expect(len(seen)).To(BeNumerically(">", 1))
+		})
+
+		It("should still hash keys that are not IP addresses", func() {
+			Expect(selectFor("not-an-ip")).NotTo(BeNil())
+		})
+	})
+
+	Context("with zero prefixes", func() {
+		BeforeEach(func() {
+			strat = strategy.NewIPHashStrategy(100, 0, 0)
+		})
+
+		It("should key every client of an address family alike", func() {
+			Expect(selectFor("10.0.0.1")).To(BeIdenticalTo(selectFor("203.0.113.99")))
+			Expect(selectFor("2001:db8::1")).To(BeIdenticalTo(selectFor("2001:db9:ffff::1")))
+		})
+	})
+
+	Context("with exact-address prefixes", func() {
+		BeforeEach(func() {
+			strat = strategy.NewIPHashStrategy(100, 32, 128)
+		})
+
+		It("should distinguish addresses within the same /24", func() {
+			seen := make(map[*backend.Backend]bool)
+			for i := 1; i < 64; i++ {
+				seen[selectFor("203.0.113."+strconv.Itoa(i))] = true
+			}
+			Expect(len(seen)).To(BeNumerically(">", 1))
+		})
+	})
+})
@@ -9,7 +9,7 @@ import (
 type leastConnStrategy struct {
 }
 
-func (l *leastConnStrategy) SelectBackend(backends []*backend.Backend) *backend.Backend {
+func (l *leastConnStrategy) SelectBackend(_ SelectionContext, backends []*backend.Backend) *backend.Backend {
 	if len(backends) == 0 {
 		return nil
 	}
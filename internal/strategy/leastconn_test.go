@@ -32,7 +32,7 @@ var _ = Describe("Leastconn", func() {
 			backends[0].IncrementConn()
 			backends[1].IncrementConn()
 
-			selected := strat.SelectBackend(backends)
+			selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 			Expect(selected).To(Equal(backends[2]))
 		})
 	})
@@ -8,7 +8,7 @@ import (
 
 type leastResponseStrategy struct{}
 
-func (l *leastResponseStrategy) SelectBackend(backends []*backend.Backend) *backend.Backend {
+func (l *leastResponseStrategy) SelectBackend(_ SelectionContext, backends []*backend.Backend) *backend.Backend {
 	if len(backends) == 0 {
 		return nil
 	}
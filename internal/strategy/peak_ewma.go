@@ -0,0 +1,184 @@
+package strategy
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// Defaults for NewPeakEWMAStrategy, as in Finagle.
+const (
+	DefaultPeakEWMADecay        = 10 * time.Second
+	DefaultPeakEWMAErrorPenalty = time.Second
+)
+
+// peakEWMAStrategy picks the backend with the lowest expected cost: a latency
+// estimate multiplied by the requests outstanding on the backend. The
+// estimate jumps to every new peak and decays exponentially afterwards, also
+// while no responses arrive, so a single slow response diverts traffic at
+// once and an idle backend is tried again. A failed attempt counts as a
+// response taking errorPenalty. With p2c it compares two backends drawn at
+// random instead of all of them, as Finagle does, so instances that see the
+// same estimates do not all send their next requests to the same backend.
+type peakEWMAStrategy struct {
+	reporter
+	mutex        sync.Mutex
+	decay        time.Duration
+	errorPenalty time.Duration
+	p2c          bool
+	estimates    map[*backend.Backend]*peakEstimate
+}
+
+type peakEstimate struct {
+	cost  float64
+	stamp time.Time
+}
+
+// NewPeakEWMAStrategy returns a Peak-EWMA strategy whose latency estimates
+// decay with time constant decay. Zero values use the defaults.
+func NewPeakEWMAStrategy(decay, errorPenalty time.Duration) Strategy {
+	if decay <= 0 {
+		decay = DefaultPeakEWMADecay
+	}
+	if errorPenalty <= 0 {
+		errorPenalty = DefaultPeakEWMAErrorPenalty
+	}
+	return &peakEWMAStrategy{
+		decay:        decay,
+		errorPenalty: errorPenalty,
+		estimates:    make(map[*backend.Backend]*peakEstimate),
+	}
+}
+
+// NewPeakEWMAStrategyWithP2C returns a Peak-EWMA strategy that picks the
+// cheaper of two backends drawn at random, reporting each comparison.
+func NewPeakEWMAStrategyWithP2C(decay, errorPenalty time.Duration) Strategy {
+	p := NewPeakEWMAStrategy(decay, errorPenalty).(*peakEWMAStrategy)
+	p.p2c = true
+	return p
+}
+
+func (p *peakEWMAStrategy) SelectBackend(_ SelectionContext, backends []*backend.Backend) *backend.Backend {
+	if len(backends) == 0 {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	costs := make([]float64, len(backends))
+	var total float64
+	var known int
+	for i, b := range backends {
+		costs[i] = p.cost(b, now)
+		if costs[i] > 0 {
+			total += costs[i]
+			known++
+		}
+	}
+	// Backends without an estimate yet, such as ones that just joined,
+	// are assumed to cost what the others do on average, so they get
+	// their share of traffic without being flooded by every request.
+	var seed float64
+	if known > 0 {
+		seed = total / float64(known)
+	}
+	scored := func(i int) float64 {
+		if costs[i] == 0 {
+			return score(seed, backends[i])
+		}
+		return score(costs[i], backends[i])
+	}
+
+	if p.p2c && len(backends) > 1 {
+		i := rand.IntN(len(backends))
+		j := rand.IntN(len(backends) - 1)
+		if j >= i {
+			j++
+		}
+		picked, passed := scored(i), scored(j)
+		if passed < picked {
+			i, picked, passed = j, passed, picked
+		}
+		ratio := 0.0
+		if picked > 0 {
+			ratio = passed / picked
+		}
+		p.report(DecisionP2C, ratio)
+		return backends[i]
+	}
+
+	var chosen *backend.Backend
+	var best float64
+	for i, b := range backends {
+		score := scored(i)
+		if chosen == nil || score < best {
+			chosen = b
+			best = score
+		}
+	}
+
+	return chosen
+}
+
+// cost returns the decayed latency estimate of b, zero when it has none.
+func (p *peakEWMAStrategy) cost(b *backend.Backend, now time.Time) float64 {
+	e, ok := p.estimates[b]
+	if !ok {
+		return 0
+	}
+	e.observe(0, now, p.decay)
+	return e.cost
+}
+
+// score returns the expected cost of sending a request to b. Without any
+// latency estimate it only counts b's outstanding requests.
+func score(cost float64, b *backend.Backend) float64 {
+	outstanding := float64(b.ActiveConnections())
+	if cost == 0 {
+		return outstanding
+	}
+	return cost * (outstanding + 1)
+}
+
+func (p *peakEWMAStrategy) Observe(b *backend.Backend, rtt time.Duration, failed bool) {
+	if failed {
+		rtt = max(rtt, p.errorPenalty)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	e, ok := p.estimates[b]
+	if !ok {
+		p.estimates[b] = &peakEstimate{cost: float64(rtt), stamp: now}
+		return
+	}
+	e.observe(float64(rtt), now, p.decay)
+}
+
+// Forget drops the latency estimate of b.
+func (p *peakEWMAStrategy) Forget(b *backend.Backend) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.estimates, b)
+}
+
+// observe folds a sample into the estimate: a sample above it replaces it,
+// a lower one pulls it down by how much time passed since the last sample.
+func (e *peakEstimate) observe(rtt float64, now time.Time, decay time.Duration) {
+	elapsed := max(now.Sub(e.stamp), 0)
+	w := math.Exp(-float64(elapsed) / float64(decay))
+
+	if rtt > e.cost {
+		e.cost = rtt
+	} else {
+		e.cost = e.cost*w + rtt*(1-w)
+	}
+	e.stamp = now
+}
@@ -0,0 +1,124 @@
+package strategy_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("PeakEWMAStrategy", func() {
+	var (
+		strat    strategy.Strategy
+		observer strategy.Observer
+		fast     *backend.Backend
+		slow     *backend.Backend
+		backends []*backend.Backend
+	)
+
+	BeforeEach(func() {
+		strat = strategy.NewPeakEWMAStrategy(time.Minute, time.Second)
+		observer = strat.(strategy.Observer)
+		fast = backend.New(mustParseURLTable("http://localhost:8081"), 1)
+		slow = backend.New(mustParseURLTable("http://localhost:8082"), 1)
+		backends = []*backend.Backend{slow, fast}
+	})
+
+	It("should assume a backend without samples costs the mean of the others", func() {
+		observer.Observe(slow, 10*time.Millisecond, false)
+		slow.IncrementConn()
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(fast))
+
+		slow.DecrementConn()
+		fast.IncrementConn()
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(slow))
+	})
+
+	It("should treat a forgotten backend as one without samples", func() {
+		observer.Observe(slow, 50*time.Millisecond, false)
+		observer.Observe(fast, 10*time.Millisecond, false)
+		strat.(strategy.Forgetter).Forget(slow)
+		fast.IncrementConn()
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(slow))
+	})
+
+	It("should prefer the backend with the lower latency", func() {
+		observer.Observe(slow, 50*time.Millisecond, false)
+		observer.Observe(fast, 10*time.Millisecond, false)
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(fast))
+	})
+
+	It("should react to a single latency spike", func() {
+		for range 20 {
+			observer.Observe(slow, 20*time.Millisecond, false)
+			observer.Observe(fast, 10*time.Millisecond, false)
+		}
+		observer.Observe(fast, 100*time.Millisecond, false)
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(slow))
+	})
+
+	It("should multiply the latency by outstanding requests", func() {
+		observer.Observe(slow, 20*time.Millisecond, false)
+		observer.Observe(fast, 10*time.Millisecond, false)
+		fast.IncrementConn()
+		fast.IncrementConn()
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(slow))
+	})
+
+	It("should penalize recent errors", func() {
+		observer.Observe(slow, 50*time.Millisecond, false)
+		observer.Observe(fast, 10*time.Millisecond, true)
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(slow))
+	})
+
+	It("should forget a peak once it decays", func() {
+		strat = strategy.NewPeakEWMAStrategy(time.Millisecond, time.Second)
+		observer = strat.(strategy.Observer)
+		observer.Observe(slow, 50*time.Millisecond, false)
+		observer.Observe(fast, 10*time.Millisecond, true)
+		time.Sleep(50 * time.Millisecond)
+		observer.Observe(slow, 50*time.Millisecond, false)
+		observer.Observe(fast, 10*time.Millisecond, false)
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(fast))
+	})
+
+	It("should return nil without backends", func() {
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, nil)).To(BeNil())
+	})
+
+	Context("with P2C", func() {
+		var decisions []strategy.Decision
+
+		BeforeEach(func() {
+			strat = strategy.NewPeakEWMAStrategyWithP2C(time.Minute, time.Second)
+			observer = strat.(strategy.Observer)
+			decisions = nil
+			strat.(strategy.Reporting).SetReporter(func(d strategy.Decision) { decisions = append(decisions, d) })
+		})
+
+		It("should pick the cheaper of the two drawn and report the comparison", func() {
+			observer.Observe(slow, 40*time.Millisecond, false)
+			observer.Observe(fast, 10*time.Millisecond, false)
+
+			Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(fast))
+			Expect(decisions).To(HaveLen(1))
+			Expect(decisions[0].Kind).To(Equal(strategy.DecisionP2C))
+			Expect(decisions[0].Value).To(BeNumerically("~", 4, 1e-6))
+		})
+
+		It("should draw from every backend while none has an estimate", func() {
+			third := backend.New(mustParseURLTable("http://localhost:8083"), 1)
+			backends = append(backends, third)
+
+			picked := make(map[*backend.Backend]bool)
+			for range 200 {
+				picked[strat.SelectBackend(strategy.SelectionContext{}, backends)] = true
+			}
+			Expect(picked).To(HaveLen(3))
+			Expect(decisions).To(HaveLen(200))
+		})
+	})
+})
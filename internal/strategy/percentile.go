@@ -0,0 +1,60 @@
+package strategy
+
+import (
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// percentileQuantile is the quantile of recent response times compared with
+// the threshold.
+const percentileQuantile = 0.95
+
+// percentileStrategy avoids backends whose recent P95 response time exceeds a
+// threshold and picks the one with the fewest active connections among the
+// rest. Smoothed averages hide a backend answering most requests quickly and
+// some very slowly; its P95 does not. Backends without enough recent
+// responses to tell are not avoided, so an avoided backend is tried again once
+// its slow responses have aged out of its latency window. When every backend
+// is above the threshold, the one with the lowest P95 is picked.
+type percentileStrategy struct {
+	reporter
+	threshold time.Duration
+	leastConn Strategy
+}
+
+// NewPercentileStrategy returns a strategy avoiding backends whose P95
+// response time is above threshold.
+func NewPercentileStrategy(threshold time.Duration) Strategy {
+	return &percentileStrategy{threshold: threshold, leastConn: NewLeastConnStrategy()}
+}
+
+func (p *percentileStrategy) SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend {
+	if len(backends) == 0 {
+		return nil
+	}
+
+	within := make([]*backend.Backend, 0, len(backends))
+	var fastest *backend.Backend
+	var best time.Duration
+
+	for _, b := range backends {
+		p95, ok := b.LatencyPercentile(percentileQuantile)
+		if !ok || p95 <= p.threshold {
+			within = append(within, b)
+			continue
+		}
+		if fastest == nil || p95 < best {
+			fastest = b
+			best = p95
+		}
+	}
+
+	if avoided := len(backends) - len(within); avoided > 0 {
+		p.report(DecisionPercentileAvoided, float64(avoided))
+	}
+	if len(within) == 0 {
+		return fastest
+	}
+	return p.leastConn.SelectBackend(ctx, within)
+}
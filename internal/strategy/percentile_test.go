@@ -0,0 +1,77 @@
+package strategy_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("PercentileStrategy", func() {
+	var (
+		strat    strategy.Strategy
+		bimodal  *backend.Backend
+		steady   *backend.Backend
+		backends []*backend.Backend
+	)
+
+	record := func(b *backend.Backend, slowEvery int) {
+		for i := range 50 {
+			if slowEvery > 0 && i%slowEvery == 0 {
+				b.RecordResponse(time.Second)
+			} else {
+				b.RecordResponse(20 * time.Millisecond)
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		strat = strategy.NewPercentileStrategy(200 * time.Millisecond)
+		bimodal = backend.New(mustParseURLTable("http://localhost:8081"), 1)
+		steady = backend.New(mustParseURLTable("http://localhost:8082"), 1)
+		backends = []*backend.Backend{bimodal, steady}
+	})
+
+	It("should avoid a backend whose P95 is above the threshold", func() {
+		record(bimodal, 10)
+		record(steady, 0)
+		steady.IncrementConn()
+		steady.IncrementConn()
+		Expect(bimodal.EWMATime()).To(BeNumerically("<", 200*time.Millisecond))
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(steady))
+	})
+
+	It("should pick the least loaded of the backends within the threshold", func() {
+		record(bimodal, 0)
+		record(steady, 0)
+		steady.IncrementConn()
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(bimodal))
+	})
+
+	It("should not avoid backends without enough samples", func() {
+		bimodal.RecordResponse(time.Second)
+		steady.IncrementConn()
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(bimodal))
+	})
+
+	It("should pick the lowest P95 when every backend is above the threshold", func() {
+		record(bimodal, 10)
+		record(steady, 2)
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(bimodal))
+	})
+
+	It("should report the backends it avoided", func() {
+		var decisions []strategy.Decision
+		strat.(strategy.Reporting).SetReporter(func(d strategy.Decision) { decisions = append(decisions, d) })
+		record(bimodal, 10)
+		strat.SelectBackend(strategy.SelectionContext{}, backends)
+		Expect(decisions).To(Equal([]strategy.Decision{{Kind: strategy.DecisionPercentileAvoided, Value: 1}}))
+	})
+
+	It("should return nil without backends", func() {
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, nil)).To(BeNil())
+	})
+})
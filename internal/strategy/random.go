@@ -8,7 +8,7 @@ import (
 
 type randomStrategy struct{}
 
-func (r *randomStrategy) SelectBackend(backends []*backend.Backend) *backend.Backend {
+func (r *randomStrategy) SelectBackend(_ SelectionContext, backends []*backend.Backend) *backend.Backend {
 	if len(backends) == 0 {
 		return nil
 	}
@@ -0,0 +1,62 @@
+package strategy
+
+import "sync/atomic"
+
+// Kinds of Decision.
+const (
+	// DecisionRingRebuild is a hash ring replaced by Rebuild. Value is the
+	// number of backends on the new ring.
+	DecisionRingRebuild = "ring_rebuild"
+	// DecisionRingMiss is a selection none of whose candidates was on the
+	// hash ring, hashed over the candidates alone. Value is their number.
+	DecisionRingMiss = "ring_miss"
+	// DecisionChainFallback is a chain selection served by a strategy other
+	// than its first. Value is the position of that strategy in the chain,
+	// counting from 0.
+	DecisionChainFallback = "chain_fallback"
+	// DecisionSubset is a change in the number of backends of this
+	// instance's subset that selections are made within. Value is the new
+	// number.
+	DecisionSubset = "subset"
+	// DecisionPercentileAvoided is a p95 selection that passed over backends
+	// whose recent P95 is above the threshold. Value is their number.
+	DecisionPercentileAvoided = "p95_avoided"
+	// DecisionWarmPreferred is a warm selection that passed over backends
+	// without an idle connection. Value is the number of warm backends.
+	DecisionWarmPreferred = "warm_preferred"
+	// DecisionP2C is a comparison of the two backends a power-of-two-choices
+	// selection drew. Value is the cost of the one passed over relative to
+	// the one picked, or 0 when the one picked cost nothing.
+	DecisionP2C = "p2c"
+)
+
+// Decision is an internal choice made while selecting a backend, which the
+// backend selected alone does not explain.
+type Decision struct {
+	Kind  string
+	Value float64
+}
+
+// Reporter receives decisions. It is called while a selection is made, so it
+// must not block.
+type Reporter func(d Decision)
+
+// Reporting is implemented by strategies that report their decisions.
+type Reporting interface {
+	SetReporter(r Reporter)
+}
+
+// reporter is embedded by strategies to implement Reporting.
+type reporter struct {
+	fn atomic.Pointer[Reporter]
+}
+
+func (r *reporter) SetReporter(fn Reporter) {
+	r.fn.Store(&fn)
+}
+
+func (r *reporter) report(kind string, value float64) {
+	if fn := r.fn.Load(); fn != nil && *fn != nil {
+		(*fn)(Decision{Kind: kind, Value: value})
+	}
+}
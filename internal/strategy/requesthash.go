@@ -0,0 +1,53 @@
+package strategy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewQueryHashStrategy returns a consistent hash keyed on the value of a
+// named query parameter, e.g. ?user_id=42, so all requests for one shard
+// land on the same backend. Requests without it are keyed on fallback, or on
+// the client IP when fallback is empty.
+func NewQueryHashStrategy(virtualNodes int, param, fallback string) Strategy {
+	return newConsistentHash(virtualNodes, func(ctx SelectionContext) string {
+		query, _ := url.ParseQuery(ctx.RawQuery)
+		return requestKey(ctx, query.Get(param), fallback)
+	})
+}
+
+// NewCookieHashStrategy returns a consistent hash keyed on the value of a
+// named cookie.
+func NewCookieHashStrategy(virtualNodes int, cookie, fallback string) Strategy {
+	return newConsistentHash(virtualNodes, func(ctx SelectionContext) string {
+		var value string
+		if c, err := (&http.Request{Header: ctx.Header}).Cookie(cookie); err == nil {
+			value = c.Value
+		}
+		return requestKey(ctx, value, fallback)
+	})
+}
+
+// NewHeaderHashStrategy returns a consistent hash keyed on the value of a
+// named request header, e.g. X-Tenant-ID. The value is only used to place
+// the request on the ring, so credentials such as Authorization can be keyed
+// on without being kept.
+func NewHeaderHashStrategy(virtualNodes int, header, fallback string) Strategy {
+	return newConsistentHash(virtualNodes, func(ctx SelectionContext) string {
+		return requestKey(ctx, strings.TrimSpace(ctx.Header.Get(header)), fallback)
+	})
+}
+
+// requestKey returns value, or when the request carries none the fallback
+// key, or when there is none either the client IP.
+func requestKey(ctx SelectionContext, value, fallback string) string {
+	switch {
+	case value != "":
+		return value
+	case fallback != "":
+		return fallback
+	default:
+		return ctx.ClientIP
+	}
+}
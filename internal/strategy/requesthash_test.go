@@ -0,0 +1,96 @@
+package strategy_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("Request hash strategies", func() {
+	key := func(keyer strategy.Keyer, req *http.Request) string {
+		return keyer.Key(strategy.NewSelectionContext(req, "192.0.2.1"))
+	}
+
+	Describe("QueryHash", func() {
+		var keyer strategy.Keyer
+
+		BeforeEach(func() {
+			keyer = strategy.NewQueryHashStrategy(100, "user_id", "anonymous").(strategy.Keyer)
+		})
+
+		It("should key on the named query parameter", func() {
+			req := httptest.NewRequest(http.MethodGet, "/orders?user_id=42&page=2", nil)
+			Expect(key(keyer, req)).To(Equal("42"))
+		})
+
+		It("should fall back to the default when the parameter is absent", func() {
+			req := httptest.NewRequest(http.MethodGet, "/orders?page=2", nil)
+			Expect(key(keyer, req)).To(Equal("anonymous"))
+		})
+
+		It("should fall back to the client IP without a default", func() {
+			keyer = strategy.NewQueryHashStrategy(100, "user_id", "").(strategy.Keyer)
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			Expect(key(keyer, req)).To(Equal("192.0.2.1"))
+		})
+	})
+
+	Describe("CookieHash", func() {
+		var keyer strategy.Keyer
+
+		BeforeEach(func() {
+			keyer = strategy.NewCookieHashStrategy(100, "session", "none").(strategy.Keyer)
+		})
+
+		It("should key on the named cookie", func() {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+			Expect(key(keyer, req)).To(Equal("abc123"))
+		})
+
+		It("should fall back to the default when the cookie is absent", func() {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "other", Value: "x"})
+			Expect(key(keyer, req)).To(Equal("none"))
+		})
+	})
+
+	Describe("HeaderHash", func() {
+		var keyer strategy.Keyer
+
+		BeforeEach(func() {
+			keyer = strategy.NewHeaderHashStrategy(100, "X-Tenant-ID", "").(strategy.Keyer)
+		})
+
+		It("should key on the named header", func() {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("x-tenant-id", " acme ")
+			Expect(key(keyer, req)).To(Equal("acme"))
+		})
+
+		It("should fall back to the client IP when the header is absent", func() {
+			Expect(key(keyer, httptest.NewRequest(http.MethodGet, "/", nil))).To(Equal("192.0.2.1"))
+		})
+	})
+
+	It("should place requests with the same key on the same backend", func() {
+		strat := strategy.NewHeaderHashStrategy(100, "X-Tenant-ID", "")
+		var backends []*backend.Backend
+		for port := range 8 {
+			backends = append(backends, backend.New(mustParseURL(fmt.Sprintf("http://localhost:%d", 9000+port)), 1))
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tenant-ID", "acme")
+		first := strat.SelectBackend(strategy.NewSelectionContext(req, "192.0.2.1"), backends)
+		for _, ip := range []string{"192.0.2.2", "198.51.100.7"} {
+			Expect(strat.SelectBackend(strategy.NewSelectionContext(req, ip), backends)).To(Equal(first))
+		}
+	})
+})
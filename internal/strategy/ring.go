@@ -0,0 +1,47 @@
+package strategy
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// FollowPool keeps s updated with the healthy backends of pool: it updates
+// it now and whenever a backend joins or leaves the pool or its health
+// changes. For a hash ring, a backend that fails its health checks leaves
+// the ring and one that recovers rejoins it, and only the keys of that
+// backend move: the other members stay as they are, so a ring imported
+// from another instance is kept.
+func FollowPool(s Updater, pool *backend.Pool) {
+	var mutex sync.Mutex
+	update := func(changed *backend.Backend) {
+		// Updates read health when they run, so serializing them keeps an
+		// older view from replacing a newer one.
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		backends := pool.Backends()
+		if ring, ok := s.(MemberLister); ok && changed != nil {
+			members := slices.DeleteFunc(ring.Members(), func(b *backend.Backend) bool { return b == changed })
+			if changed.IsHealthy() && slices.Contains(backends, changed) {
+				members = append(members, changed)
+			}
+			s.UpdateBackends(members)
+			return
+		}
+
+		var healthy []*backend.Backend
+		for _, b := range backends {
+			if b.IsHealthy() {
+				healthy = append(healthy, b)
+			}
+		}
+		s.UpdateBackends(healthy)
+	}
+
+	pool.OnAdd(update)
+	pool.OnRemove(update)
+	pool.OnHealthChange(func(b *backend.Backend, _ bool) { update(b) })
+	update(nil)
+}
@@ -0,0 +1,109 @@
+package strategy_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("FollowPool", func() {
+	var (
+		backends []*backend.Backend
+		pool     *backend.Pool
+		hash     strategy.Strategy
+	)
+
+	BeforeEach(func() {
+		backends = []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+			backend.New(mustParseURL("http://localhost:8083"), 1),
+		}
+		pool = backend.NewPool(backends)
+		hash = strategy.NewConsistentHashStrategy(100)
+		strategy.FollowPool(hash.(strategy.Updater), pool)
+	})
+
+	members := func() []*backend.Backend {
+		return hash.(strategy.MemberLister).Members()
+	}
+
+	It("should put backends on the ring as they become healthy", func() {
+		Expect(members()).To(BeEmpty())
+
+		backends[0].SetHealthy(true)
+		backends[1].SetHealthy(true)
+		Expect(members()).To(ConsistOf(backends[0], backends[1]))
+
+		backends[2].SetHealthy(true)
+		Expect(members()).To(ConsistOf(backends))
+	})
+
+	It("should send clients to a backend that recovered after the ring was first used", func() {
+		backends[0].SetHealthy(true)
+		backends[1].SetHealthy(true)
+		for i := range 50 {
+			ctx := strategy.SelectionContext{ClientIP: fmt.Sprintf("10.0.0.%d", i)}
+			Expect(hash.SelectBackend(ctx, backends[:2])).NotTo(BeNil())
+		}
+
+		backends[2].SetHealthy(true)
+		served := map[*backend.Backend]bool{}
+		for i := range 50 {
+			ctx := strategy.SelectionContext{ClientIP: fmt.Sprintf("10.0.0.%d", i)}
+			served[hash.SelectBackend(ctx, backends)] = true
+		}
+		Expect(served).To(HaveKey(backends[2]))
+	})
+
+	It("should only move the keys of a backend that goes down", func() {
+		for _, b := range backends {
+			b.SetHealthy(true)
+		}
+		before := map[string]*backend.Backend{}
+		for i := range 100 {
+			ip := fmt.Sprintf("10.0.1.%d", i)
+			before[ip] = hash.SelectBackend(strategy.SelectionContext{ClientIP: ip}, backends)
+		}
+
+		backends[1].SetHealthy(false)
+		Expect(members()).To(ConsistOf(backends[0], backends[2]))
+		for ip, was := range before {
+			now := hash.SelectBackend(strategy.SelectionContext{ClientIP: ip}, backends)
+			if was != backends[1] {
+				Expect(now).To(Equal(was))
+			} else {
+				Expect(now).NotTo(Equal(backends[1]))
+			}
+		}
+	})
+
+	It("should keep an imported ring and only move the backend that changed", func() {
+		for _, b := range backends {
+			b.SetHealthy(true)
+		}
+		hash.(strategy.Rebuilder).Rebuild(backends[:2])
+
+		backends[0].SetHealthy(false)
+		Expect(members()).To(ConsistOf(backends[1]))
+
+		backends[0].SetHealthy(true)
+		Expect(members()).To(ConsistOf(backends[0], backends[1]))
+	})
+
+	It("should follow backends joining and leaving the pool", func() {
+		backends[0].SetHealthy(true)
+		added := backend.New(mustParseURL("http://localhost:8084"), 1)
+		added.SetHealthy(true)
+
+		pool.Add(added)
+		Expect(members()).To(ConsistOf(backends[0], added))
+
+		pool.Remove(backends[0])
+		Expect(members()).To(ConsistOf(added))
+	})
+})
@@ -10,7 +10,7 @@ type roundRobinStrategy struct {
 	current uint64
 }
 
-func (rb *roundRobinStrategy) SelectBackend(backends []*backend.Backend) *backend.Backend {
+func (rb *roundRobinStrategy) SelectBackend(_ SelectionContext, backends []*backend.Backend) *backend.Backend {
 	if len(backends) == 0 {
 		return nil
 	}
@@ -34,16 +34,16 @@ var _ = Describe("Roundrobin", func() {
 	Describe("SelectBackend", func() {
 		Context("with all healthy backends", func() {
 			It("should cycle through backends in order", func() {
-				Expect(strat.SelectBackend(backends)).To(Equal(backends[0]))
-				Expect(strat.SelectBackend(backends)).To(Equal(backends[1]))
-				Expect(strat.SelectBackend(backends)).To(Equal(backends[2]))
-				Expect(strat.SelectBackend(backends)).To(Equal(backends[0]))
+				Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[0]))
+				Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[1]))
+				Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[2]))
+				Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[0]))
 			})
 
 			It("should distribute load evenly", func() {
 				counts := make(map[string]int)
 				for i := 0; i < 300; i++ {
-					selected := strat.SelectBackend(backends)
+					selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 					counts[selected.URL().String()]++
 				}
 				Expect(counts["http://localhost:8081"]).To(Equal(100))
@@ -54,7 +54,7 @@ var _ = Describe("Roundrobin", func() {
 
 		Context("with empty backend list", func() {
 			It("should return nil", func() {
-				Expect(strat.SelectBackend([]*backend.Backend{})).To(BeNil())
+				Expect(strat.SelectBackend(strategy.SelectionContext{}, []*backend.Backend{})).To(BeNil())
 			})
 		})
 	})
@@ -80,17 +80,17 @@ var _ = Describe("LeastResponse", func() {
 		backends[1].RecordResponse(50 * time.Millisecond)
 		backends[2].RecordResponse(200 * time.Millisecond)
 
-		selected := strat.SelectBackend(backends)
+		selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 		Expect(selected).To(Equal(backends[1]))
 	})
 
 	It("should select first backend when all have zero EWMA", func() {
-		selected := strat.SelectBackend(backends)
+		selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 		Expect(selected).To(Equal(backends[0]))
 	})
 
 	It("should return nil for empty backend list", func() {
-		selected := strat.SelectBackend([]*backend.Backend{})
+		selected := strat.SelectBackend(strategy.SelectionContext{}, []*backend.Backend{})
 		Expect(selected).To(BeNil())
 	})
 })
@@ -111,7 +111,7 @@ var _ = Describe("Random", func() {
 	})
 
 	It("should select a backend", func() {
-		selected := strat.SelectBackend(backends)
+		selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 		Expect(selected).NotTo(BeNil())
 		Expect(backends).To(ContainElement(selected))
 	})
@@ -120,7 +120,7 @@ var _ = Describe("Random", func() {
 		backendSet := make(map[*backend.Backend]bool)
 
 		for i := 0; i < 100; i++ {
-			selected := strat.SelectBackend(backends)
+			selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 			backendSet[selected] = true
 		}
 
@@ -128,7 +128,7 @@ var _ = Describe("Random", func() {
 	})
 
 	It("should return nil for empty backend list", func() {
-		selected := strat.SelectBackend([]*backend.Backend{})
+		selected := strat.SelectBackend(strategy.SelectionContext{}, []*backend.Backend{})
 		Expect(selected).To(BeNil())
 	})
 })
@@ -153,7 +153,7 @@ var _ = Describe("WeightedRoundRobin", func() {
 	})
 
 	It("should select backend based on weights", func() {
-		backend := strat.SelectBackend(backends)
+		backend := strat.SelectBackend(strategy.SelectionContext{}, backends)
 		Expect(backend).NotTo(BeNil())
 		Expect(backends).To(ContainElement(backend))
 	})
@@ -163,7 +163,7 @@ var _ = Describe("WeightedRoundRobin", func() {
 		iterations := 100
 
 		for i := 0; i < iterations; i++ {
-			backend := strat.SelectBackend(backends)
+			backend := strat.SelectBackend(strategy.SelectionContext{}, backends)
 			counts[backend]++
 		}
 
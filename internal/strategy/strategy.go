@@ -1,9 +1,100 @@
 package strategy
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/angeloszaimis/load-balancer/internal/backend"
 )
 
 type Strategy interface {
-	SelectBackend(backends []*backend.Backend) *backend.Backend
+	SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend
+}
+
+// SelectionContext describes the request a backend is selected for. It is
+// passed by value with every selection, so strategies never share request
+// state between concurrent calls. The zero value carries no request.
+type SelectionContext struct {
+	ClientIP string
+	Path     string
+	RawQuery string
+	Header   http.Header
+	// HashKey, when set, replaces ClientIP as the key consistent_hash places
+	// the request by.
+	HashKey string
+	// Weights overrides the weight of the backends it holds for this
+	// selection; the others keep their own.
+	Weights map[*backend.Backend]int
+	// Unshifted makes weighted strategies ignore traffic shift factors, for
+	// selections among backends a shift left no share at all.
+	Unshifted bool
+}
+
+func NewSelectionContext(r *http.Request, clientIP string) SelectionContext {
+	return SelectionContext{
+		ClientIP: clientIP,
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+		Header:   r.Header,
+	}
+}
+
+// Weight returns the weight of b for this selection.
+func (c SelectionContext) Weight(b *backend.Backend) int {
+	if weight, ok := c.Weights[b]; ok {
+		return weight
+	}
+	return b.Weight()
+}
+
+// Keyer is implemented by hashing strategies. Key returns the affinity key a
+// selection is placed on the ring by.
+type Keyer interface {
+	Key(ctx SelectionContext) string
+}
+
+// Rebuilder is implemented by hashing strategies whose ring can be replaced
+// from outside, e.g. with a membership agreed between peer instances.
+type Rebuilder interface {
+	Rebuild(backends []*backend.Backend)
+}
+
+// Updater is implemented by strategies that precompute state from the
+// backends they select among, such as a hash ring or an alias table.
+// UpdateBackends is called with the available backends whenever the pool
+// changes, outside the request path, so SelectBackend does not have to build
+// that state itself.
+type Updater interface {
+	UpdateBackends(backends []*backend.Backend)
+}
+
+// MemberLister is implemented by hashing strategies that can list the
+// backends on their ring, e.g. to carry the ring over to another instance.
+type MemberLister interface {
+	Members() []*backend.Backend
+}
+
+// Affinity is implemented by strategies combining others, returning the one
+// whose picks clients are pinned to.
+type Affinity interface {
+	AffinityStrategy() Strategy
+}
+
+// Observer is implemented by strategies that learn from the outcome of every
+// proxied attempt. failed marks attempts the backend is to blame for.
+type Observer interface {
+	Observe(b *backend.Backend, rtt time.Duration, failed bool)
+}
+
+// Shifter is implemented by strategies that may scale backend weights by
+// their traffic shift factors themselves. The load balancer narrows the
+// candidates of any other strategy to one shift group.
+type Shifter interface {
+	HonoursShift() bool
+}
+
+// Forgetter is implemented by strategies that keep state per backend.
+// Forget drops what they keep about b once it left the pool.
+type Forgetter interface {
+	Forget(b *backend.Backend)
 }
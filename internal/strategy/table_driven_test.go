@@ -23,6 +23,11 @@ var _ = Describe("Table-Driven Strategy Tests", func() {
 		Entry("Least Response Time", func() strategy.Strategy { return strategy.NewLeastResponseStrategy() }),
 		Entry("Consistent Hash with 100 vnodes", func() strategy.Strategy { return strategy.NewConsistentHashStrategy(100) }),
 		Entry("Weighted Round Robin", func() strategy.Strategy { return strategy.NewWeightedRoundRobinStrategy() }),
+		Entry("Weighted Random", func() strategy.Strategy { return strategy.NewWeightedRandomStrategy() }),
+		Entry("Peak EWMA", func() strategy.Strategy { return strategy.NewPeakEWMAStrategy(0, 0) }),
+		Entry("Chain", func() strategy.Strategy {
+			return strategy.NewChain(strategy.MaxLoad(10), strategy.NewConsistentHashStrategy(100), strategy.NewLeastConnStrategy())
+		}),
 	)
 
 	DescribeTable("All strategies select from healthy backends",
@@ -38,7 +43,7 @@ var _ = Describe("Table-Driven Strategy Tests", func() {
 				b.SetHealthy(true)
 			}
 
-			selected := strat.SelectBackend(backends)
+			selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 			Expect(selected).NotTo(BeNil())
 			Expect(backends).To(ContainElement(selected))
 		},
@@ -47,6 +52,11 @@ var _ = Describe("Table-Driven Strategy Tests", func() {
 		Entry("Least Connections", func() strategy.Strategy { return strategy.NewLeastConnStrategy() }),
 		Entry("Least Response Time", func() strategy.Strategy { return strategy.NewLeastResponseStrategy() }),
 		Entry("Consistent Hash", func() strategy.Strategy { return strategy.NewConsistentHashStrategy(100) }),
+		Entry("Weighted Random", func() strategy.Strategy { return strategy.NewWeightedRandomStrategy() }),
+		Entry("Peak EWMA", func() strategy.Strategy { return strategy.NewPeakEWMAStrategy(0, 0) }),
+		Entry("Chain", func() strategy.Strategy {
+			return strategy.NewChain(strategy.MaxLoad(10), strategy.NewConsistentHashStrategy(100), strategy.NewLeastConnStrategy())
+		}),
 	)
 
 	DescribeTable("Least-connection strategy behavior",
@@ -62,7 +72,7 @@ var _ = Describe("Table-Driven Strategy Tests", func() {
 			backends[0].IncrementConn()
 			backends[0].IncrementConn()
 
-			selected := strat.SelectBackend(backends)
+			selected := strat.SelectBackend(strategy.SelectionContext{}, backends)
 			Expect(selected).To(Equal(backends[1]), "Should prefer backend with fewer connections")
 		},
 		Entry("Least Connections", func() strategy.Strategy { return strategy.NewLeastConnStrategy() }),
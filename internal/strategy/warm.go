@@ -0,0 +1,57 @@
+package strategy
+
+import (
+	"strings"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// warmStrategy sends latency-sensitive requests to backends with an idle
+// keep-alive connection, which answer without a TCP or TLS handshake first.
+// A request is latency-sensitive when its path starts with one of paths, or
+// always when there are none. Among the warm backends, and for every other
+// request among all of them, the one with the fewest active connections is
+// picked. Other requests therefore keep spreading over every backend, which
+// keeps their connections warm too.
+type warmStrategy struct {
+	reporter
+	paths     []string
+	leastConn Strategy
+}
+
+// NewWarmStrategy returns a strategy preferring backends with warm
+// connections for requests whose path starts with one of paths.
+func NewWarmStrategy(paths []string) Strategy {
+	return &warmStrategy{paths: paths, leastConn: NewLeastConnStrategy()}
+}
+
+func (w *warmStrategy) SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend {
+	if !w.sensitive(ctx.Path) {
+		return w.leastConn.SelectBackend(ctx, backends)
+	}
+
+	warm := make([]*backend.Backend, 0, len(backends))
+	for _, b := range backends {
+		if b.IdleConnections() > 0 {
+			warm = append(warm, b)
+		}
+	}
+
+	if len(warm) == 0 || len(warm) == len(backends) {
+		return w.leastConn.SelectBackend(ctx, backends)
+	}
+	w.report(DecisionWarmPreferred, float64(len(warm)))
+	return w.leastConn.SelectBackend(ctx, warm)
+}
+
+func (w *warmStrategy) sensitive(path string) bool {
+	if len(w.paths) == 0 {
+		return true
+	}
+	for _, prefix := range w.paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
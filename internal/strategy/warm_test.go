@@ -0,0 +1,75 @@
+package strategy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("WarmStrategy", func() {
+	var (
+		servers  []*httptest.Server
+		warm     *backend.Backend
+		cold     *backend.Backend
+		backends []*backend.Backend
+	)
+
+	BeforeEach(func() {
+		servers = nil
+		for range 2 {
+			servers = append(servers, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			})))
+		}
+		warm = backend.New(mustParseURLTable(servers[0].URL), 1)
+		cold = backend.New(mustParseURLTable(servers[1].URL), 1)
+		backends = []*backend.Backend{cold, warm}
+
+		w := httptest.NewRecorder()
+		warm.ReverseProxy().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		Eventually(warm.IdleConnections).Should(Equal(1))
+
+		warm.IncrementConn()
+	})
+
+	AfterEach(func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	})
+
+	It("should prefer a backend with an idle connection on latency-sensitive paths", func() {
+		strat := strategy.NewWarmStrategy([]string{"/api/"})
+		Expect(strat.SelectBackend(strategy.SelectionContext{Path: "/api/quote"}, backends)).To(Equal(warm))
+	})
+
+	It("should pick by least connections on other paths", func() {
+		strat := strategy.NewWarmStrategy([]string{"/api/"})
+		Expect(strat.SelectBackend(strategy.SelectionContext{Path: "/reports"}, backends)).To(Equal(cold))
+	})
+
+	It("should treat every path as latency-sensitive without paths", func() {
+		strat := strategy.NewWarmStrategy(nil)
+		Expect(strat.SelectBackend(strategy.SelectionContext{Path: "/reports"}, backends)).To(Equal(warm))
+	})
+
+	It("should pick by least connections when no backend is warm", func() {
+		warm.Transport().CloseIdleConnections()
+		strat := strategy.NewWarmStrategy(nil)
+		Expect(strat.SelectBackend(strategy.SelectionContext{Path: "/"}, backends)).To(Equal(cold))
+	})
+
+	It("should report passing over cold backends", func() {
+		strat := strategy.NewWarmStrategy(nil)
+		var decisions []strategy.Decision
+		strat.(strategy.Reporting).SetReporter(func(d strategy.Decision) { decisions = append(decisions, d) })
+
+		strat.SelectBackend(strategy.SelectionContext{Path: "/"}, backends)
+		Expect(decisions).To(Equal([]strategy.Decision{{Kind: strategy.DecisionWarmPreferred, Value: 1}}))
+	})
+})
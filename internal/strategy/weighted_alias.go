@@ -0,0 +1,183 @@
+package strategy
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+// aliasRefresh is how long an alias table is used before it is rebuilt to
+// pick up weight changes: admin and override weights, feedback, slow start
+// and error decay.
+const aliasRefresh = time.Second
+
+// aliasTries is how many picks from the table a selection makes before it
+// falls back to weighted-random because none was a candidate.
+const aliasTries = 4
+
+type weightedAliasStrategy struct {
+	table    atomic.Pointer[aliasTable]
+	fallback Strategy
+}
+
+// aliasTable is Vose's alias table for the backends it was built from: slot i
+// holds picked[i] with probability prob[i] and picked[alias[i]] otherwise.
+type aliasTable struct {
+	backends []*backend.Backend
+	members  map[*backend.Backend]bool
+	picked   []*backend.Backend
+	prob     []float64
+	alias    []int
+	built    time.Time
+}
+
+// NewWeightedAliasStrategy returns a strategy that picks a backend at random
+// with a probability proportional to its weight, like weighted-random, in
+// constant time. It builds an alias table from the backends UpdateBackends
+// passes it whenever the pool changes, and rebuilds it every second, so
+// weight changes, slow start and error decay apply within a second rather
+// than at once. A selection among fewer candidates, such as a retry or one
+// that leaves out backends at their limit, picks from the same table and
+// picks again when it drew a backend that is no candidate, which keeps the
+// odds proportional to the weights of the candidates; after a few misses,
+// and for selections that override weights, it is picked by weighted-random.
+func NewWeightedAliasStrategy() Strategy {
+	return &weightedAliasStrategy{fallback: NewWeightedRandomStrategy()}
+}
+
+// UpdateBackends builds the alias table for backends, so selections among
+// them start from a table built outside the request path.
+func (w *weightedAliasStrategy) UpdateBackends(backends []*backend.Backend) {
+	w.table.Store(buildAliasTable(backends, time.Now()))
+}
+
+func (w *weightedAliasStrategy) SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend {
+	if len(ctx.Weights) > 0 || ctx.Unshifted {
+		return w.fallback.SelectBackend(ctx, backends)
+	}
+
+	now := time.Now()
+	t := w.table.Load()
+	switch {
+	case t == nil:
+		t = buildAliasTable(backends, now)
+		w.table.CompareAndSwap(nil, t)
+	case !t.covers(backends):
+		// Only without UpdateBackends: the table grows to every backend
+		// selections have been asked to pick among.
+		fresh := buildAliasTable(t.union(backends), now)
+		w.table.CompareAndSwap(t, fresh)
+		t = fresh
+	case now.Sub(t.built) >= aliasRefresh:
+		fresh := buildAliasTable(t.backends, now)
+		w.table.CompareAndSwap(t, fresh)
+		t = fresh
+	}
+
+	for range aliasTries {
+		if b := t.pick(); b != nil && slices.Contains(backends, b) {
+			return b
+		}
+	}
+	return w.fallback.SelectBackend(ctx, backends)
+}
+
+func buildAliasTable(backends []*backend.Backend, now time.Time) *aliasTable {
+	t := &aliasTable{backends: slices.Clone(backends), members: make(map[*backend.Backend]bool, len(backends)), built: now}
+	for _, b := range backends {
+		t.members[b] = true
+	}
+
+	var weights []int
+	total := 0
+	for _, b := range backends {
+		weight := scale(SelectionContext{}, b, now, b.Weight()*rampScale)
+		if weight <= 0 {
+			continue
+		}
+		t.picked = append(t.picked, b)
+		weights = append(weights, weight)
+		total += weight
+	}
+
+	n := len(weights)
+	if n == 0 {
+		return t
+	}
+
+	t.prob = make([]float64, n)
+	t.alias = make([]int, n)
+
+	// Scale each weight so the average slot holds exactly 1, then let every
+	// slot below 1 be topped up by one above it.
+	scaled := make([]float64, n)
+	var small, large []int
+	for i, weight := range weights {
+		scaled[i] = float64(weight) * float64(n) / float64(total)
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small = small[:len(small)-1]
+
+		t.prob[s] = scaled[s]
+		t.alias[s] = l
+		scaled[l] -= 1 - scaled[s]
+		if scaled[l] < 1 {
+			large = large[:len(large)-1]
+			small = append(small, l)
+		}
+	}
+	// Whatever is left is 1 up to rounding.
+	for _, i := range append(small, large...) {
+		t.prob[i] = 1
+	}
+
+	return t
+}
+
+// covers reports whether the table was built from every one of backends.
+func (t *aliasTable) covers(backends []*backend.Backend) bool {
+	for _, b := range backends {
+		if !t.members[b] {
+			return false
+		}
+	}
+	return true
+}
+
+// union returns the table's backends followed by those of backends it was
+// not built from.
+func (t *aliasTable) union(backends []*backend.Backend) []*backend.Backend {
+	union := slices.Clone(t.backends)
+	for _, b := range backends {
+		if !t.members[b] {
+			union = append(union, b)
+		}
+	}
+	return union
+}
+
+func (t *aliasTable) pick() *backend.Backend {
+	if len(t.picked) == 0 {
+		return nil
+	}
+	i := rand.IntN(len(t.picked))
+	if rand.Float64() < t.prob[i] {
+		return t.picked[i]
+	}
+	return t.picked[t.alias[i]]
+}
+
+// HonoursShift reports that weights are scaled by shift factors.
+func (w *weightedAliasStrategy) HonoursShift() bool {
+	return true
+}
@@ -0,0 +1,143 @@
+package strategy_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("WeightedAliasStrategy", func() {
+	var strat strategy.Strategy
+
+	BeforeEach(func() {
+		strat = strategy.NewWeightedAliasStrategy()
+	})
+
+	count := func(backends []*backend.Backend, iterations int) map[*backend.Backend]int {
+		counts := make(map[*backend.Backend]int)
+		for range iterations {
+			b := strat.SelectBackend(strategy.SelectionContext{}, backends)
+			Expect(b).NotTo(BeNil())
+			counts[b]++
+		}
+		return counts
+	}
+
+	It("should pick backends in proportion to their weights", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 3),
+			backend.New(mustParseURL("http://localhost:8083"), 6),
+		}
+
+		counts := count(backends, 10000)
+		Expect(counts[backends[0]]).To(BeNumerically("~", 1000, 200))
+		Expect(counts[backends[1]]).To(BeNumerically("~", 3000, 300))
+		Expect(counts[backends[2]]).To(BeNumerically("~", 6000, 300))
+	})
+
+	It("should only pick among the candidates it is given", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+			backend.New(mustParseURL("http://localhost:8083"), 1),
+		}
+		count(backends, 10)
+
+		Expect(count(backends[1:2], 100)).To(Equal(map[*backend.Backend]int{backends[1]: 100}))
+		Expect(count(backends, 300)).To(HaveLen(3))
+	})
+
+	It("should skip backends with zero weight", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 0),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+		}
+
+		Expect(count(backends, 100)).To(Equal(map[*backend.Backend]int{backends[1]: 100}))
+	})
+
+	It("should pick up weight changes within a second", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+		}
+		count(backends, 10)
+
+		backends[0].SetWeight(0)
+		Eventually(func() map[*backend.Backend]int {
+			return count(backends, 100)
+		}, 2*time.Second, 100*time.Millisecond).Should(Equal(map[*backend.Backend]int{backends[1]: 100}))
+	})
+
+	It("should pick from the table built by UpdateBackends", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 0),
+		}
+		strat.(strategy.Updater).UpdateBackends(backends)
+
+		// The table is not rebuilt on the request path within a second.
+		backends[1].SetWeight(1)
+		Expect(count(backends, 100)).To(Equal(map[*backend.Backend]int{backends[0]: 100}))
+	})
+
+	It("should pick among fewer candidates from the same table", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 3),
+			backend.New(mustParseURL("http://localhost:8083"), 0),
+		}
+		strat.(strategy.Updater).UpdateBackends(backends)
+		backends[2].SetWeight(10)
+
+		counts := count(backends[:2], 4000)
+		Expect(counts[backends[0]]).To(BeNumerically("~", 1000, 200))
+		Expect(counts[backends[1]]).To(BeNumerically("~", 3000, 200))
+		Expect(count(backends[1:2], 100)).To(Equal(map[*backend.Backend]int{backends[1]: 100}))
+		Expect(count(backends, 100)).NotTo(HaveKey(backends[2]))
+	})
+
+	It("should rebuild the table when the pool changes", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 0),
+		}
+		for _, b := range backends {
+			b.SetHealthy(true)
+		}
+		pool := backend.NewPool(backends[:1])
+		strategy.FollowPool(strat.(strategy.Updater), pool)
+		pool.Add(backends[1])
+
+		backends[1].SetWeight(1)
+		Expect(count(backends, 100)).To(Equal(map[*backend.Backend]int{backends[0]: 100}))
+
+		backends[0].SetHealthy(false)
+		backends[0].SetHealthy(true)
+		Expect(count(backends, 300)).To(HaveLen(2))
+	})
+
+	It("should honour weights from the selection context", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+		}
+		ctx := strategy.SelectionContext{Weights: map[*backend.Backend]int{backends[0]: 0}}
+
+		for range 100 {
+			Expect(strat.SelectBackend(ctx, backends)).To(Equal(backends[1]))
+		}
+	})
+
+	It("should return nil without backends or weight", func() {
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, nil)).To(BeNil())
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 0),
+		})).To(BeNil())
+	})
+})
@@ -0,0 +1,52 @@
+package strategy
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+)
+
+type weightedRandomStrategy struct{}
+
+// NewWeightedRandomStrategy returns a strategy that picks a backend at random
+// with a probability proportional to its weight. Unlike weighted round robin
+// it keeps no state per backend and takes no lock, which keeps it cheap for
+// very large pools at the price of a less even spread over short periods.
+// Weight changes apply at once; slow start and error decay are honoured.
+func NewWeightedRandomStrategy() Strategy {
+	return &weightedRandomStrategy{}
+}
+
+func (w *weightedRandomStrategy) SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend {
+	now := time.Now()
+	total := 0
+	for _, b := range backends {
+		total += scale(ctx, b, now, ctx.Weight(b)*rampScale)
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	// Weights read again may have moved since the sum; the last backend
+	// with any weight takes whatever is left over.
+	pick := rand.IntN(total)
+	var last *backend.Backend
+	for _, b := range backends {
+		weight := scale(ctx, b, now, ctx.Weight(b)*rampScale)
+		if weight <= 0 {
+			continue
+		}
+		if pick < weight {
+			return b
+		}
+		pick -= weight
+		last = b
+	}
+	return last
+}
+
+// HonoursShift reports that weights are scaled by shift factors.
+func (w *weightedRandomStrategy) HonoursShift() bool {
+	return true
+}
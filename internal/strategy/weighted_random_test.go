@@ -0,0 +1,79 @@
+package strategy_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/strategy"
+)
+
+var _ = Describe("WeightedRandomStrategy", func() {
+	var strat strategy.Strategy
+
+	BeforeEach(func() {
+		strat = strategy.NewWeightedRandomStrategy()
+	})
+
+	count := func(backends []*backend.Backend, iterations int) map[*backend.Backend]int {
+		counts := make(map[*backend.Backend]int)
+		for range iterations {
+			b := strat.SelectBackend(strategy.SelectionContext{}, backends)
+			Expect(b).NotTo(BeNil())
+			counts[b]++
+		}
+		return counts
+	}
+
+	It("should pick backends in proportion to their weights", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 3),
+		}
+
+		counts := count(backends, 4000)
+		Expect(counts[backends[0]]).To(BeNumerically("~", 1000, 150))
+		Expect(counts[backends[1]]).To(BeNumerically("~", 3000, 150))
+	})
+
+	It("should take weights from the selection context over the backends' own", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+		}
+		ctx := strategy.SelectionContext{Weights: map[*backend.Backend]int{backends[0]: 0}}
+
+		for range 100 {
+			Expect(strat.SelectBackend(ctx, backends)).To(Equal(backends[1]))
+		}
+	})
+
+	It("should skip backends with zero weight", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 0),
+			backend.New(mustParseURL("http://localhost:8082"), 1),
+		}
+
+		Expect(count(backends, 100)).To(Equal(map[*backend.Backend]int{backends[1]: 100}))
+	})
+
+	It("should return nil without backends or weight", func() {
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, nil)).To(BeNil())
+		Expect(strat.SelectBackend(strategy.SelectionContext{}, []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 0),
+		})).To(BeNil())
+	})
+
+	It("should give a slow starting backend a share of its weight", func() {
+		backends := []*backend.Backend{
+			backend.New(mustParseURL("http://localhost:8081"), 1),
+			backend.New(mustParseURL("http://localhost:8082"), 1, backend.WithSlowStart(time.Hour)),
+		}
+		backends[1].BeginSlowStart(time.Now().Add(-15 * time.Minute))
+
+		counts := count(backends, 2500)
+		Expect(counts[backends[1]]).To(BeNumerically("~", 500, 100))
+	})
+})
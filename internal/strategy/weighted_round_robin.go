@@ -1,23 +1,52 @@
 package strategy
 
 import (
+	"math"
 	"sync"
+	"time"
 
 	"github.com/angeloszaimis/load-balancer/internal/backend"
 )
 
+// rampScale is the resolution of ramped weights: a weight of 1 counts as
+// rampScale, so intermediate weights can be fractional.
+const rampScale = 100
+
+// defaultWeightRamp is the ramp window FromConfig uses when none is set.
+const defaultWeightRamp = 10 * time.Second
+
 type weightedRoundRobinStrategy struct {
 	mutex   sync.Mutex
 	current map[*backend.Backend]int
+	window  time.Duration
+	ramps   map[*backend.Backend]*weightRamp
+}
+
+// weightRamp moves the weight the strategy uses for a backend linearly from
+// one value to another over the ramp window.
+type weightRamp struct {
+	from  float64
+	to    int
+	start time.Time
 }
 
 func NewWeightedRoundRobinStrategy() Strategy {
+	return NewWeightedRoundRobinStrategyWithRamp(0)
+}
+
+// NewWeightedRoundRobinStrategyWithRamp returns a weighted round robin that
+// moves to a backend's new weight gradually over window instead of at once,
+// so a backend whose weight was raised is not hit by its full share of
+// traffic immediately. A zero window applies weight changes instantly.
+func NewWeightedRoundRobinStrategyWithRamp(window time.Duration) Strategy {
 	return &weightedRoundRobinStrategy{
 		current: make(map[*backend.Backend]int),
+		window:  window,
+		ramps:   make(map[*backend.Backend]*weightRamp),
 	}
 }
 
-func (w *weightedRoundRobinStrategy) SelectBackend(backends []*backend.Backend) *backend.Backend {
+func (w *weightedRoundRobinStrategy) SelectBackend(ctx SelectionContext, backends []*backend.Backend) *backend.Backend {
 	if len(backends) == 0 {
 		return nil
 	}
@@ -27,11 +56,12 @@ func (w *weightedRoundRobinStrategy) SelectBackend(backends []*backend.Backend)
 
 	w.cleanup(backends)
 
+	now := time.Now()
 	totalWeight := 0
 	var chosen *backend.Backend
 
 	for _, b := range backends {
-		weight := b.Weight()
+		weight := w.weight(ctx, b, now)
 		if weight <= 0 {
 			continue
 		}
@@ -52,6 +82,79 @@ func (w *weightedRoundRobinStrategy) SelectBackend(backends []*backend.Backend)
 	return chosen
 }
 
+// weight returns the scaled weight to use for b at now. A change of the
+// backend's weight starts a new ramp from wherever the previous one was, and
+// a backend that is slow starting after recovery or decayed by failures gets
+// a share of it. A weight set by the selection context applies at once.
+func (w *weightedRoundRobinStrategy) weight(ctx SelectionContext, b *backend.Backend, now time.Time) int {
+	if weight, ok := ctx.Weights[b]; ok {
+		return scale(ctx, b, now, weight*rampScale)
+	}
+	return scale(ctx, b, now, w.rampedWeight(b, now))
+}
+
+func (w *weightedRoundRobinStrategy) rampedWeight(b *backend.Backend, now time.Time) int {
+	target := b.Weight()
+	if w.window <= 0 {
+		return target * rampScale
+	}
+
+	r, ok := w.ramps[b]
+	if !ok {
+		r = &weightRamp{from: float64(target), to: target, start: now}
+		w.ramps[b] = r
+	}
+	if r.to != target {
+		r.from, r.to, r.start = r.value(now, w.window), target, now
+	}
+
+	return int(math.Round(r.value(now, w.window) * rampScale))
+}
+
+// scale scales weight by b's slow-start, decay and shift factors. A backend
+// with any weight keeps at least the smallest scaled weight, so one that just
+// recovered still receives traffic when every other backend recovered at the
+// same moment. Only a traffic shift can take a backend down to nothing, and
+// not in a selection ctx marks Unshifted.
+func scale(ctx SelectionContext, b *backend.Backend, now time.Time, weight int) int {
+	shift := b.ShiftFactor()
+	if ctx.Unshifted {
+		shift = 1
+	}
+	if shift <= 0 {
+		return 0
+	}
+	factor := b.SlowStartFactor(now) * b.DecayFactor() * shift
+	if factor >= 1 || weight <= 0 {
+		return weight
+	}
+	return max(1, int(math.Round(float64(weight)*factor)))
+}
+
+// HonoursShift reports that weights are scaled by shift factors.
+func (w *weightedRoundRobinStrategy) HonoursShift() bool {
+	return true
+}
+
+func (r *weightRamp) value(now time.Time, window time.Duration) float64 {
+	elapsed := now.Sub(r.start)
+	if elapsed >= window {
+		return float64(r.to)
+	}
+	progress := float64(elapsed) / float64(window)
+	return r.from + (float64(r.to)-r.from)*progress
+}
+
+// Forget drops the running weight and ramp of b.
+func (w *weightedRoundRobinStrategy) Forget(b *backend.Backend) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.current, b)
+	delete(w.ramps, b)
+}
+
+// cleanup drops the running weights and ramps of backends that are no
+// longer offered, so neither grows with every backend ever seen.
 func (w *weightedRoundRobinStrategy) cleanup(backends []*backend.Backend) {
 	alive := make(map[*backend.Backend]struct{}, len(backends))
 
@@ -64,4 +167,9 @@ func (w *weightedRoundRobinStrategy) cleanup(backends []*backend.Backend) {
 			delete(w.current, b)
 		}
 	}
+	for b := range w.ramps {
+		if _, ok := alive[b]; !ok {
+			delete(w.ramps, b)
+		}
+	}
 }
@@ -2,6 +2,7 @@ package strategy_test
 
 import (
 	"net/url"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -38,7 +39,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			iterations := 300
 
 			for i := 0; i < iterations; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				Expect(b).NotTo(BeNil())
 				counts[b]++
 			}
@@ -64,7 +65,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			iterations := 900
 
 			for i := 0; i < iterations; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				Expect(b).NotTo(BeNil())
 				counts[b]++
 			}
@@ -80,7 +81,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			iterations := 450
 
 			for i := 0; i < iterations; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				counts[b]++
 			}
 
@@ -105,7 +106,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			iterations := 1010
 
 			for i := 0; i < iterations; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				counts[b]++
 			}
 
@@ -117,12 +118,12 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 	Context("edge cases", func() {
 		It("should return nil for empty backends", func() {
 			backends = []*backend.Backend{}
-			b := strat.SelectBackend(backends)
+			b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 			Expect(b).To(BeNil())
 		})
 
 		It("should return nil for nil backends", func() {
-			b := strat.SelectBackend(nil)
+			b := strat.SelectBackend(strategy.SelectionContext{}, nil)
 			Expect(b).To(BeNil())
 		})
 
@@ -132,7 +133,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			}
 
 			for i := 0; i < 10; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				Expect(b).To(Equal(backends[0]))
 			}
 		})
@@ -146,7 +147,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 
 			counts := make(map[*backend.Backend]int)
 			for i := 0; i < 100; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				Expect(b).To(Equal(backends[1]))
 				counts[b]++
 			}
@@ -162,7 +163,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 				backend.New(mustParseURLWeighted("http://localhost:8082"), 0),
 			}
 
-			b := strat.SelectBackend(backends)
+			b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 			Expect(b).To(BeNil())
 		})
 	})
@@ -176,14 +177,14 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			}
 
 			for i := 0; i < 10; i++ {
-				strat.SelectBackend(backends)
+				strat.SelectBackend(strategy.SelectionContext{}, backends)
 			}
 
 			backends = backends[:2]
 
 			counts := make(map[*backend.Backend]int)
 			for i := 0; i < 100; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				Expect(b).NotTo(BeNil())
 				Expect(backends).To(ContainElement(b))
 				counts[b]++
@@ -198,7 +199,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			}
 
 			for i := 0; i < 10; i++ {
-				strat.SelectBackend(backends)
+				strat.SelectBackend(strategy.SelectionContext{}, backends)
 			}
 
 			backends = append(backends,
@@ -208,7 +209,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 
 			counts := make(map[*backend.Backend]int)
 			for i := 0; i < 300; i++ {
-				b := strat.SelectBackend(backends)
+				b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 				counts[b]++
 			}
 
@@ -219,6 +220,89 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 		})
 	})
 
+	Context("with weights from the selection context", func() {
+		It("should apply them at once over the backends' own", func() {
+			backends = []*backend.Backend{
+				backend.New(mustParseURLWeighted("http://localhost:8081"), 1),
+				backend.New(mustParseURLWeighted("http://localhost:8082"), 1),
+			}
+			ctx := strategy.SelectionContext{Weights: map[*backend.Backend]int{backends[1]: 3}}
+
+			counts := make(map[*backend.Backend]int)
+			for range 400 {
+				counts[strat.SelectBackend(ctx, backends)]++
+			}
+			Expect(counts[backends[0]]).To(Equal(100))
+			Expect(counts[backends[1]]).To(Equal(300))
+		})
+	})
+
+	Context("slow start", func() {
+		It("should give a recovering backend a growing share of its weight", func() {
+			backends = []*backend.Backend{
+				backend.New(mustParseURLWeighted("http://localhost:8081"), 1),
+				backend.New(mustParseURLWeighted("http://localhost:8082"), 1, backend.WithSlowStart(time.Hour)),
+			}
+			backends[1].BeginSlowStart(time.Now().Add(-15 * time.Minute))
+
+			counts := make(map[*backend.Backend]int)
+			for i := 0; i < 500; i++ {
+				counts[strat.SelectBackend(strategy.SelectionContext{}, backends)]++
+			}
+			Expect(counts[backends[1]]).To(BeNumerically("~", 100, 5))
+		})
+
+		It("should keep serving when every backend just recovered", func() {
+			backends = []*backend.Backend{
+				backend.New(mustParseURLWeighted("http://localhost:8081"), 1, backend.WithSlowStart(time.Hour)),
+				backend.New(mustParseURLWeighted("http://localhost:8082"), 1, backend.WithSlowStart(time.Hour)),
+			}
+			for _, b := range backends {
+				b.BeginSlowStart(time.Now())
+			}
+
+			Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).NotTo(BeNil())
+		})
+	})
+
+	Context("error decay", func() {
+		It("should give a failing backend a decayed share of its weight", func() {
+			backends = []*backend.Backend{
+				backend.New(mustParseURLWeighted("http://localhost:8081"), 1),
+				backend.New(mustParseURLWeighted("http://localhost:8082"), 1, backend.WithErrorDecay(0.5, time.Hour)),
+			}
+			backends[1].Decay(time.Now())
+			backends[1].Decay(time.Now())
+
+			counts := make(map[*backend.Backend]int)
+			for i := 0; i < 500; i++ {
+				counts[strat.SelectBackend(strategy.SelectionContext{}, backends)]++
+			}
+			Expect(counts[backends[1]]).To(BeNumerically("~", 100, 5))
+		})
+	})
+
+	Context("traffic shift", func() {
+		It("should scale weights by the shift factor down to nothing", func() {
+			backends = []*backend.Backend{
+				backend.New(mustParseURLWeighted("http://localhost:8081"), 1),
+				backend.New(mustParseURLWeighted("http://localhost:8082"), 1),
+			}
+			backends[1].SetShiftFactor(0.25)
+
+			counts := make(map[*backend.Backend]int)
+			for i := 0; i < 500; i++ {
+				counts[strat.SelectBackend(strategy.SelectionContext{}, backends)]++
+			}
+			Expect(counts[backends[1]]).To(BeNumerically("~", 100, 5))
+
+			backends[1].SetShiftFactor(0)
+			for i := 0; i < 10; i++ {
+				Expect(strat.SelectBackend(strategy.SelectionContext{}, backends)).To(Equal(backends[0]))
+			}
+		})
+	})
+
 	Context("smooth weighted distribution", func() {
 		It("should provide smooth distribution pattern", func() {
 			backends = []*backend.Backend{
@@ -228,7 +312,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 
 			selections := make([]*backend.Backend, 18)
 			for i := 0; i < 18; i++ {
-				selections[i] = strat.SelectBackend(backends)
+				selections[i] = strat.SelectBackend(strategy.SelectionContext{}, backends)
 			}
 
 			count1 := 0
@@ -255,7 +339,7 @@ var _ = Describe("WeightedRoundRobinStrategy", func() {
 			for g := 0; g < 10; g++ {
 				go func() {
 					for i := 0; i < 10; i++ {
-						b := strat.SelectBackend(backends)
+						b := strat.SelectBackend(strategy.SelectionContext{}, backends)
 						results <- b
 					}
 					done <- true
@@ -290,3 +374,48 @@ func mustParseURLWeighted(rawURL string) *url.URL {
 	}
 	return u
 }
+
+var _ = Describe("WeightedRoundRobinStrategy with a weight ramp", func() {
+	var backends []*backend.Backend
+
+	share := func(strat strategy.Strategy, b *backend.Backend) float64 {
+		picks := 0
+		for i := 0; i < 1000; i++ {
+			if strat.SelectBackend(strategy.SelectionContext{}, backends) == b {
+				picks++
+			}
+		}
+		return float64(picks) / 1000
+	}
+
+	BeforeEach(func() {
+		backends = []*backend.Backend{
+			backend.New(mustParseURLWeighted("http://localhost:8081"), 1),
+			backend.New(mustParseURLWeighted("http://localhost:8082"), 1),
+		}
+	})
+
+	It("should move to a raised weight gradually", func() {
+		strat := strategy.NewWeightedRoundRobinStrategyWithRamp(time.Hour)
+		Expect(share(strat, backends[0])).To(BeNumerically("~", 0.5, 0.01))
+
+		backends[0].SetWeight(9)
+		Expect(share(strat, backends[0])).To(BeNumerically("~", 0.5, 0.02))
+	})
+
+	It("should reach the new weight once the ramp is over", func() {
+		strat := strategy.NewWeightedRoundRobinStrategyWithRamp(50 * time.Millisecond)
+		strat.SelectBackend(strategy.SelectionContext{}, backends)
+
+		backends[0].SetWeight(9)
+		Eventually(func() float64 { return share(strat, backends[0]) }).Should(BeNumerically("~", 0.9, 0.01))
+	})
+
+	It("should apply weight changes at once without a ramp", func() {
+		strat := strategy.NewWeightedRoundRobinStrategy()
+		strat.SelectBackend(strategy.SelectionContext{}, backends)
+
+		backends[0].SetWeight(9)
+		Expect(share(strat, backends[0])).To(BeNumerically("~", 0.9, 0.01))
+	})
+})
@@ -0,0 +1,5 @@
+// Package testbackend provides the demo backend used by the scripts under
+// scripts/. It can run as its own process (scripts/backend.go) or in-process,
+// which lets the circuit breaker tooling start and kill backends without
+// shelling out to platform tools like lsof or pkill.
+package testbackend
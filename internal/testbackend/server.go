@@ -0,0 +1,155 @@
+package testbackend
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+// Course represents a course entity with unique identifier.
+type Course struct {
+	UUID        string `json:"uuid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// CreateCourseRequest is the request payload for creating a course.
+type CreateCourseRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Handler serves POST /create-course and GET /health. Everything else is a
+// 404, which the tooling counts as a live backend.
+func Handler(logger *log.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/create-course", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		// log request for visibility when running multiple backends
+		logger.Printf("request: method=%s path=%s from=%s body=%s", r.Method, r.URL.Path, r.RemoteAddr, string(body))
+		var req CreateCourseRequest
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Title == "" {
+			req.Title = "Default Course"
+		}
+		course := Course{
+			UUID:        newUUID(),
+			Title:       req.Title,
+			Description: req.Description,
+		}
+
+		resp := map[string]any{"course": course}
+		b, _ := json.Marshal(resp)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+	})
+
+	// simple health endpoint used by the load balancer health checker
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	return mux
+}
+
+// Server is an in-process backend. Close simulates the backend dying: the
+// listener and all open connections are closed.
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// Start listens on addr and serves Handler in the background.
+func Start(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		server:   &http.Server{Handler: Handler(log.New(io.Discard, "", 0))},
+	}
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+// StartRange starts one backend per port from first to last inclusive. On
+// failure the backends already started are closed.
+func StartRange(first, last int) ([]*Server, error) {
+	var servers []*Server
+	for port := first; port <= last; port++ {
+		s, err := Start(fmt.Sprintf(":%d", port))
+		if err != nil {
+			CloseAll(servers)
+			return nil, fmt.Errorf("backend on port %d: %w", port, err)
+		}
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Port returns the TCP port the backend listens on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *Server) Close() error {
+	if err := s.server.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// CloseAll closes every server, ignoring errors.
+func CloseAll(servers []*Server) {
+	for _, s := range servers {
+		s.Close()
+	}
+}
+
+// newUUID generates a random v4 UUID per RFC 4122.
+func newUUID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+	// set version (4) and variant bits per RFC 4122
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	// format as hex groups
+	return fmt.Sprintf("%s-%s-%s-%s-%s",
+		hex.EncodeToString(b[0:4]),
+		hex.EncodeToString(b[4:6]),
+		hex.EncodeToString(b[6:8]),
+		hex.EncodeToString(b[8:10]),
+		hex.EncodeToString(b[10:16]),
+	)
+}
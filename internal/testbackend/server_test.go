@@ -0,0 +1,64 @@
+package testbackend_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/testbackend"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		srv    *testbackend.Server
+		client *http.Client
+	)
+
+	BeforeEach(func() {
+		var err error
+		srv, err = testbackend.Start("127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		client = &http.Client{Timeout: time.Second}
+	})
+
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	url := func(path string) string {
+		return fmt.Sprintf("http://%s%s", srv.Addr(), path)
+	}
+
+	It("should answer health checks", func() {
+		resp, err := client.Get(url("/health"))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should create courses", func() {
+		resp, err := client.Post(url("/create-course"), "application/json", strings.NewReader(`{"title":"Go"}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+
+		var body struct {
+			Course testbackend.Course `json:"course"`
+		}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Course.Title).To(Equal("Go"))
+		Expect(body.Course.UUID).To(HaveLen(36))
+	})
+
+	It("should stop accepting connections once closed", func() {
+		Expect(srv.Close()).To(Succeed())
+
+		_, err := client.Get(url("/health"))
+		Expect(err).To(HaveOccurred())
+	})
+})
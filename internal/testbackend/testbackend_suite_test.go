@@ -0,0 +1,13 @@
+package testbackend_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTestBackend(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TestBackend Suite")
+}
@@ -0,0 +1,18 @@
+// Package traffic classifies requests by who sent them: health probes,
+// bots, browsers or API clients. The class labels per-class metrics and lets
+// the handler treat classes differently, for example by keeping probe
+// traffic out of endpoint latency and error figures.
+//
+// A request is a probe when its path is one of the probe paths or its
+// User-Agent matches a probe pattern, otherwise a bot or a browser when its
+// User-Agent matches one of their patterns, and an API client otherwise.
+// Patterns left empty fall back to built-in ones.
+//
+// Usage:
+//
+//	c, err := traffic.New(traffic.Options{ProbePaths: []string{"/healthz"}})
+//	switch c.Classify(r) {
+//	case traffic.ClassProbe:
+//		...
+//	}
+package traffic
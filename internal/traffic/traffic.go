@@ -0,0 +1,101 @@
+package traffic
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+type Class string
+
+const (
+	ClassProbe   Class = "probe"
+	ClassBot     Class = "bot"
+	ClassBrowser Class = "browser"
+	ClassAPI     Class = "api"
+)
+
+// Built-in patterns used for Options fields left empty.
+var (
+	DefaultProbePaths    = []string{"/health", "/healthz", "/livez", "/readyz", "/ping"}
+	DefaultProbeAgents   = []string{`(?i)kube-probe|elb-healthchecker|googlehc|consul health check|envoy/hc|blackbox exporter|uptimerobot|pingdom`}
+	DefaultBotAgents     = []string{`(?i)bot\b|crawl|spider|slurp|facebookexternalhit|bingpreview`}
+	DefaultBrowserAgents = []string{`^Mozilla/`}
+)
+
+// Options lists what identifies each class. ProbePaths are exact request
+// paths, the other fields regular expressions matched against the
+// User-Agent.
+type Options struct {
+	ProbePaths    []string
+	ProbeAgents   []string
+	BotAgents     []string
+	BrowserAgents []string
+}
+
+type Classifier struct {
+	probePaths    []string
+	probeAgents   []*regexp.Regexp
+	botAgents     []*regexp.Regexp
+	browserAgents []*regexp.Regexp
+}
+
+func New(opts Options) (*Classifier, error) {
+	c := &Classifier{probePaths: orDefault(opts.ProbePaths, DefaultProbePaths)}
+
+	var err error
+	if c.probeAgents, err = compile(orDefault(opts.ProbeAgents, DefaultProbeAgents)); err != nil {
+		return nil, fmt.Errorf("probe agents: %w", err)
+	}
+	if c.botAgents, err = compile(orDefault(opts.BotAgents, DefaultBotAgents)); err != nil {
+		return nil, fmt.Errorf("bot agents: %w", err)
+	}
+	if c.browserAgents, err = compile(orDefault(opts.BrowserAgents, DefaultBrowserAgents)); err != nil {
+		return nil, fmt.Errorf("browser agents: %w", err)
+	}
+	return c, nil
+}
+
+// Classify returns the class of r.
+func (c *Classifier) Classify(r *http.Request) Class {
+	agent := r.UserAgent()
+	switch {
+	case slices.Contains(c.probePaths, r.URL.Path), matchAny(c.probeAgents, agent):
+		return ClassProbe
+	case matchAny(c.botAgents, agent):
+		return ClassBot
+	case matchAny(c.browserAgents, agent):
+		return ClassBrowser
+	default:
+		return ClassAPI
+	}
+}
+
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package traffic_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/traffic"
+)
+
+var _ = Describe("Classifier", func() {
+	request := func(path, agent string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("User-Agent", agent)
+		return r
+	}
+
+	DescribeTable("built-in patterns",
+		func(path, agent string, class traffic.Class) {
+			c, err := traffic.New(traffic.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Classify(request(path, agent))).To(Equal(class))
+		},
+		Entry("probe path", "/healthz", "curl/8.0", traffic.ClassProbe),
+		Entry("kubelet probe", "/", "kube-probe/1.30", traffic.ClassProbe),
+		Entry("load balancer probe", "/status", "ELB-HealthChecker/2.0", traffic.ClassProbe),
+		Entry("search crawler", "/", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", traffic.ClassBot),
+		Entry("browser", "/", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", traffic.ClassBrowser),
+		Entry("API client", "/api/orders", "okhttp/4.12.0", traffic.ClassAPI),
+		Entry("no user agent", "/api/orders", "", traffic.ClassAPI),
+	)
+
+	It("should use configured patterns instead of the built-in ones", func() {
+		c, err := traffic.New(traffic.Options{
+			ProbePaths:  []string{"/_status"},
+			BotAgents:   []string{`^internal-scraper/`},
+			ProbeAgents: []string{`^synthetic-check$`},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Classify(request("/_status", ""))).To(Equal(traffic.ClassProbe))
+		Expect(c.Classify(request("/healthz", ""))).To(Equal(traffic.ClassAPI))
+		Expect(c.Classify(request("/", "synthetic-check"))).To(Equal(traffic.ClassProbe))
+		Expect(c.Classify(request("/", "internal-scraper/1.0"))).To(Equal(traffic.ClassBot))
+		Expect(c.Classify(request("/", "Googlebot/2.1"))).To(Equal(traffic.ClassAPI))
+	})
+
+	It("should reject invalid patterns", func() {
+		_, err := traffic.New(traffic.Options{BotAgents: []string{"("}})
+		Expect(err).To(MatchError(ContainSubstring("bot agents")))
+	})
+})
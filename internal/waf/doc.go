@@ -0,0 +1,28 @@
+// Package waf is a small request rule engine evaluated before requests are
+// proxied. It is meant to keep known bad traffic away from backends, not to
+// replace a full web application firewall.
+//
+// A Rule matches on the method, a path regular expression, header regular
+// expressions and a body regular expression; every condition it sets must
+// hold. Rules are evaluated in order and act on the requests they match:
+//
+//   - ActionBlock refuses the request with the rule's status.
+//   - ActionRateLimit refuses a client's requests with 429 once it has sent
+//     more than Requests matching requests within Window.
+//   - ActionTag lets the request through and adds the rule's tag to it.
+//
+// The first rule that refuses a request ends the evaluation. Bodies are only
+// matched when they were prepared by package inspect; those it passed on
+// uninspected meet every body condition, so a client cannot get past a body
+// rule by padding or re-encoding its body, unless the engine is created with
+// SkipUninspected.
+//
+// Usage:
+//
+//	engine, err := waf.New([]waf.Rule{
+//		{Name: "dotfiles", Path: `^/\.`, Action: waf.ActionBlock},
+//		{Name: "login", Methods: []string{"POST"}, Path: `^/login$`,
+//			Action: waf.ActionRateLimit, Requests: 10, Window: time.Minute},
+//	})
+//	verdict := engine.Evaluate(r, clientIP)
+package waf
@@ -0,0 +1,241 @@
+package waf
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+)
+
+type Action string
+
+const (
+	ActionBlock     Action = "block"
+	ActionRateLimit Action = "rate_limit"
+	ActionTag       Action = "tag"
+)
+
+// Rule is one WAF rule. Path, the Headers values and Body are regular
+// expressions; empty conditions match every request. Path is matched against
+// the request path both as sent and cleaned of dot segments and repeated
+// slashes. A header that is absent is matched as an empty value. Body
+// matches bodies that were too large or in an encoding to be inspected,
+// unless the engine skips them. Status defaults to 403 for blocks and
+// Tag to the rule's name.
+type Rule struct {
+	Name     string
+	Methods  []string
+	Path     string
+	Headers  map[string]string
+	Body     string
+	Action   Action
+	Status   int
+	Tag      string
+	Requests int
+	Window   time.Duration
+}
+
+// Verdict is the outcome of evaluating a request. Status is non-zero when
+// the request is refused, by the rule named Rule; RetryAfter is set when it
+// was rate limited. Hits lists every rule that acted on the request, Tags the
+// tags of the tag rules among them.
+type Verdict struct {
+	Rule       string
+	Status     int
+	RetryAfter time.Duration
+	Tags       []string
+	Hits       []string
+}
+
+type Engine struct {
+	rules           []*rule
+	skipUninspected bool
+}
+
+type Option func(*Engine)
+
+// SkipUninspected makes body conditions fail on bodies that were not
+// inspected instead of matching them, letting such requests past the rules
+// that look at bodies.
+func SkipUninspected() Option {
+	return func(e *Engine) {
+		e.skipUninspected = true
+	}
+}
+
+type rule struct {
+	Rule
+	path    *regexp.Regexp
+	headers map[string]*regexp.Regexp
+	body    *regexp.Regexp
+	limiter *limiter
+}
+
+// New compiles rules. It fails on invalid regular expressions and on rate
+// limits without a positive request count and window.
+func New(rules []Rule, opts ...Option) (*Engine, error) {
+	e := &Engine{rules: make([]*rule, 0, len(rules))}
+	for _, opt := range opts {
+		opt(e)
+	}
+	for _, r := range rules {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("waf rule %q: %w", r.Name, err)
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	return e, nil
+}
+
+func compile(r Rule) (*rule, error) {
+	c := &rule{Rule: r, headers: make(map[string]*regexp.Regexp, len(r.Headers))}
+
+	var err error
+	if c.path, err = compilePattern(r.Path); err != nil {
+		return nil, fmt.Errorf("path: %w", err)
+	}
+	if c.body, err = compilePattern(r.Body); err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	for name, pattern := range r.Headers {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		c.headers[http.CanonicalHeaderKey(name)] = re
+	}
+
+	switch r.Action {
+	case ActionBlock:
+		if c.Status == 0 {
+			c.Status = http.StatusForbidden
+		}
+	case ActionRateLimit:
+		if r.Requests <= 0 || r.Window <= 0 {
+			return nil, fmt.Errorf("rate limit needs a positive request count and window")
+		}
+		c.limiter = &limiter{requests: r.Requests, window: r.Window, counts: make(map[string]int)}
+	case ActionTag:
+		if c.Tag == "" {
+			c.Tag = r.Name
+		}
+	default:
+		return nil, fmt.Errorf("unknown action %q", r.Action)
+	}
+	return c, nil
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// Evaluate runs the rules against r, whose client is identified by clientIP
+// for rate limits.
+func (e *Engine) Evaluate(r *http.Request, clientIP string) Verdict {
+	var v Verdict
+	now := time.Now()
+
+	for _, rl := range e.rules {
+		if !rl.matches(r, !e.skipUninspected) {
+			continue
+		}
+
+		switch rl.Action {
+		case ActionBlock:
+			v.Rule, v.Status = rl.Name, rl.Status
+		case ActionRateLimit:
+			wait, ok := rl.limiter.allow(clientIP, now)
+			if ok {
+				continue
+			}
+			v.Rule, v.Status, v.RetryAfter = rl.Name, http.StatusTooManyRequests, wait
+		case ActionTag:
+			v.Tags = append(v.Tags, rl.Tag)
+		}
+
+		v.Hits = append(v.Hits, rl.Name)
+		if v.Status != 0 {
+			return v
+		}
+	}
+	return v
+}
+
+// matches reports whether r meets every condition of the rule. Bodies that
+// were not inspected meet body conditions when uninspected is set.
+func (rl *rule) matches(r *http.Request, uninspected bool) bool {
+	if len(rl.Methods) > 0 && !slices.ContainsFunc(rl.Methods, func(m string) bool {
+		return strings.EqualFold(m, r.Method)
+	}) {
+		return false
+	}
+	if rl.path != nil && !rl.path.MatchString(r.URL.Path) && !rl.path.MatchString(cleanPath(r.URL.Path)) {
+		return false
+	}
+	for name, re := range rl.headers {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			values = []string{""}
+		}
+		if !slices.ContainsFunc(values, re.MatchString) {
+			return false
+		}
+	}
+	if rl.body != nil {
+		body, ok := inspect.FromRequest(r)
+		switch {
+		case ok:
+			return rl.body.Match(body.Data)
+		case !uninspected || !inspect.Skipped(r):
+			return false
+		}
+	}
+	return true
+}
+
+// cleanPath returns p as a backend resolving it would see it, so "//admin"
+// and "/static/../admin" match rules written for "/admin".
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
+
+// limiter counts requests per client in fixed windows. The counts are
+// dropped when a window ends, so idle clients cost nothing.
+type limiter struct {
+	mutex    sync.Mutex
+	requests int
+	window   time.Duration
+	start    time.Time
+	counts   map[string]int
+}
+
+// allow counts a request from key and reports whether it is within the
+// limit, or how long until the window ends when it is not.
+func (l *limiter) allow(key string, now time.Time) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.start) >= l.window {
+		l.start = now
+		clear(l.counts)
+	}
+
+	l.counts[key]++
+	if l.counts[key] <= l.requests {
+		return 0, true
+	}
+	return l.start.Add(l.window).Sub(now), false
+}
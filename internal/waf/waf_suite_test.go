@@ -0,0 +1,13 @@
+package waf_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWAF(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "WAF Suite")
+}
@@ -0,0 +1,158 @@
+package waf_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/inspect"
+	"github.com/angeloszaimis/load-balancer/internal/waf"
+)
+
+var _ = Describe("Engine", func() {
+	newEngine := func(rules ...waf.Rule) *waf.Engine {
+		e, err := waf.New(rules)
+		Expect(err).NotTo(HaveOccurred())
+		return e
+	}
+
+	It("should let requests no rule matches through", func() {
+		e := newEngine(waf.Rule{Name: "dotfiles", Path: `^/\.`, Action: waf.ActionBlock})
+		Expect(e.Evaluate(httptest.NewRequest(http.MethodGet, "/index.html", nil), "10.0.0.1")).To(Equal(waf.Verdict{}))
+	})
+
+	It("should block on path with 403 unless another status is set", func() {
+		e := newEngine(
+			waf.Rule{Name: "dotfiles", Path: `^/\.`, Action: waf.ActionBlock},
+			waf.Rule{Name: "admin", Path: `^/wp-admin`, Action: waf.ActionBlock, Status: http.StatusNotFound},
+		)
+
+		v := e.Evaluate(httptest.NewRequest(http.MethodGet, "/.env", nil), "10.0.0.1")
+		Expect(v.Rule).To(Equal("dotfiles"))
+		Expect(v.Status).To(Equal(http.StatusForbidden))
+		Expect(v.Hits).To(Equal([]string{"dotfiles"}))
+
+		v = e.Evaluate(httptest.NewRequest(http.MethodGet, "/wp-admin/", nil), "10.0.0.1")
+		Expect(v.Status).To(Equal(http.StatusNotFound))
+	})
+
+	It("should require every condition of a rule to match", func() {
+		e := newEngine(waf.Rule{
+			Name:    "scanner",
+			Methods: []string{"post"},
+			Path:    `^/api/`,
+			Headers: map[string]string{"user-agent": `(?i)sqlmap`},
+			Action:  waf.ActionBlock,
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/users", nil)
+		req.Header.Set("User-Agent", "sqlmap/1.7")
+		Expect(e.Evaluate(req, "10.0.0.1").Status).To(Equal(http.StatusForbidden))
+
+		req = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("User-Agent", "sqlmap/1.7")
+		Expect(e.Evaluate(req, "10.0.0.1").Status).To(BeZero())
+
+		req = httptest.NewRequest(http.MethodPost, "/api/users", nil)
+		req.Header.Set("User-Agent", "curl/8.0")
+		Expect(e.Evaluate(req, "10.0.0.1").Status).To(BeZero())
+	})
+
+	It("should match an absent header as empty", func() {
+		e := newEngine(waf.Rule{Name: "no-agent", Headers: map[string]string{"User-Agent": `^$`}, Action: waf.ActionBlock})
+		Expect(e.Evaluate(httptest.NewRequest(http.MethodGet, "/", nil), "10.0.0.1").Status).To(Equal(http.StatusForbidden))
+	})
+
+	It("should match bodies prepared for inspection only", func() {
+		e := newEngine(waf.Rule{Name: "sqli", Body: `(?i)union\s+select`, Action: waf.ActionBlock})
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("q=1 UNION SELECT password"))
+		Expect(e.Evaluate(req, "10.0.0.1").Status).To(BeZero())
+
+		req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("q=1 UNION SELECT password"))
+		req, err := inspect.New(inspect.Options{MaxBytes: 1024, MaxDecodedBytes: 1024}).Prepare(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(e.Evaluate(req, "10.0.0.1").Status).To(Equal(http.StatusForbidden))
+	})
+
+	It("should match bodies that could not be inspected unless told to skip them", func() {
+		rule := waf.Rule{Name: "sqli", Body: `(?i)union\s+select`, Action: waf.ActionBlock}
+		inspector := inspect.New(inspect.Options{MaxBytes: 16, MaxDecodedBytes: 16})
+		padded := func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat(" ", 32)+"UNION SELECT"))
+			req, err := inspector.Prepare(req)
+			Expect(err).NotTo(HaveOccurred())
+			return req
+		}
+
+		Expect(newEngine(rule).Evaluate(padded(), "10.0.0.1").Status).To(Equal(http.StatusForbidden))
+
+		e, err := waf.New([]waf.Rule{rule}, waf.SkipUninspected())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(e.Evaluate(padded(), "10.0.0.1").Status).To(BeZero())
+	})
+
+	It("should match paths as a backend resolves them", func() {
+		e := newEngine(waf.Rule{Name: "admin", Path: `^/admin(/|$)`, Action: waf.ActionBlock})
+		for _, p := range []string{"/admin", "//admin", "/./admin/", "/static/../admin", "/admin/x/.."} {
+			Expect(e.Evaluate(httptest.NewRequest(http.MethodGet, p, nil), "10.0.0.1").Status).
+				To(Equal(http.StatusForbidden), p)
+		}
+		Expect(e.Evaluate(httptest.NewRequest(http.MethodGet, "/administrator", nil), "10.0.0.1").Status).To(BeZero())
+	})
+
+	It("should collect tags and keep evaluating", func() {
+		e := newEngine(
+			waf.Rule{Name: "bot", Headers: map[string]string{"User-Agent": `(?i)bot`}, Action: waf.ActionTag},
+			waf.Rule{Name: "api", Path: `^/api/`, Action: waf.ActionTag, Tag: "api-call"},
+			waf.Rule{Name: "dotfiles", Path: `/\.`, Action: waf.ActionBlock},
+		)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("User-Agent", "Googlebot")
+		v := e.Evaluate(req, "10.0.0.1")
+		Expect(v.Status).To(BeZero())
+		Expect(v.Tags).To(Equal([]string{"bot", "api-call"}))
+		Expect(v.Hits).To(Equal([]string{"bot", "api"}))
+	})
+
+	It("should rate limit each client separately within a window", func() {
+		e := newEngine(waf.Rule{
+			Name:     "login",
+			Path:     `^/login$`,
+			Action:   waf.ActionRateLimit,
+			Requests: 2,
+			Window:   100 * time.Millisecond,
+		})
+		login := func(client string) waf.Verdict {
+			return e.Evaluate(httptest.NewRequest(http.MethodPost, "/login", nil), client)
+		}
+
+		Expect(login("10.0.0.1").Status).To(BeZero())
+		Expect(login("10.0.0.1").Status).To(BeZero())
+
+		v := login("10.0.0.1")
+		Expect(v.Rule).To(Equal("login"))
+		Expect(v.Status).To(Equal(http.StatusTooManyRequests))
+		Expect(v.RetryAfter).To(BeNumerically(">", 0))
+		Expect(v.Hits).To(Equal([]string{"login"}))
+
+		Expect(login("10.0.0.2").Status).To(BeZero())
+		Eventually(func() int { return login("10.0.0.1").Status }).Should(BeZero())
+	})
+
+	It("should reject invalid rules", func() {
+		_, err := waf.New([]waf.Rule{{Name: "bad", Path: `(`, Action: waf.ActionBlock}})
+		Expect(err).To(MatchError(ContainSubstring(`waf rule "bad"`)))
+
+		_, err = waf.New([]waf.Rule{{Name: "limit", Action: waf.ActionRateLimit}})
+		Expect(err).To(HaveOccurred())
+
+		_, err = waf.New([]waf.Rule{{Name: "other", Action: "log"}})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,337 @@
+package adminclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxRetries   = 2
+	DefaultRetryBackoff = 200 * time.Millisecond
+)
+
+var (
+	ErrUnauthorized = errors.New("missing or invalid admin token")
+	ErrForbidden    = errors.New("admin token role too low")
+)
+
+// APIError is a response the admin API answered with an error status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("admin API returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// Client talks to the admin API served at URL, e.g. "http://localhost:8080".
+// HTTPClient defaults to http.DefaultClient. A failed request is tried
+// MaxRetries more times, DefaultMaxRetries when zero and none when
+// negative, waiting RetryBackoff, doubled after every attempt, in between.
+type Client struct {
+	URL          string
+	Token        string
+	HTTPClient   *http.Client
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// Backend is a backend as GET /admin/backends reports it.
+type Backend struct {
+	Name              string            `json:"name"`
+	URL               string            `json:"url"`
+	Origin            string            `json:"origin"`
+	Healthy           bool              `json:"healthy"`
+	State             string            `json:"state"`
+	HealthOverride    string            `json:"health_override,omitempty"`
+	Draining          bool              `json:"draining"`
+	DrainedBy         []string          `json:"drained_by,omitempty"`
+	DrainDeadline     *time.Time        `json:"drain_deadline,omitempty"`
+	Maintenance       bool              `json:"maintenance,omitempty"`
+	MaintenanceBy     []string          `json:"maintenance_by,omitempty"`
+	Weight            int               `json:"weight"`
+	ConfiguredWeight  int               `json:"configured_weight"`
+	ActiveConnections int               `json:"active_connections"`
+	EWMAResponse      time.Duration     `json:"ewma_response"`
+	CircuitState      string            `json:"circuit_state,omitempty"`
+	ReportedLoad      *float64          `json:"reported_load,omitempty"`
+	SlowStart         *float64          `json:"slow_start,omitempty"`
+	WeightDecay       *float64          `json:"weight_decay,omitempty"`
+	Shift             *float64          `json:"shift,omitempty"`
+	CheckOutput       string            `json:"check_output,omitempty"`
+	SkippedChecks     uint64            `json:"skipped_checks,omitempty"`
+	Standby           string            `json:"standby,omitempty"`
+	Priority          int               `json:"priority"`
+	AtCapacity        bool              `json:"at_capacity,omitempty"`
+	MaxInFlight       int               `json:"max_in_flight,omitempty"`
+	Zone              string            `json:"zone,omitempty"`
+	Remote            bool              `json:"remote,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+}
+
+// Weight is a backend's weight after SetWeight or ResetWeight.
+type Weight struct {
+	Name             string `json:"name"`
+	URL              string `json:"url"`
+	Weight           int    `json:"weight"`
+	ConfiguredWeight int    `json:"configured_weight"`
+}
+
+// Drain is a backend's draining flag and state after Drain or Undrain.
+// InFlight is the number of requests it still holds, and Deadline when those
+// still in flight are cut off.
+type Drain struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Draining  bool       `json:"draining"`
+	DrainedBy []string   `json:"drained_by,omitempty"`
+	State     string     `json:"state"`
+	InFlight  int        `json:"in_flight"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+}
+
+// ShiftStatus is the current or most recent traffic shift or split.
+// Progress is the share of the traffic on the To group.
+type ShiftStatus struct {
+	Phase        string   `json:"phase"`
+	From         string   `json:"from,omitempty"`
+	To           string   `json:"to,omitempty"`
+	Progress     float64  `json:"progress"`
+	FromBackends []string `json:"from_backends,omitempty"`
+	ToBackends   []string `json:"to_backends,omitempty"`
+}
+
+// GroupMetrics sums the requests of the backends in one group of a shift
+// since it started or the split was last set. SuccessRate is nil until the
+// group has served a request.
+type GroupMetrics struct {
+	Selector    string        `json:"selector"`
+	Backends    int           `json:"backends"`
+	Healthy     int           `json:"healthy"`
+	Requests    int64         `json:"requests"`
+	Errors      int64         `json:"errors"`
+	SuccessRate *float64      `json:"success_rate,omitempty"`
+	AvgResponse time.Duration `json:"avg_response"`
+}
+
+// ShiftMetrics reports both groups of the current or most recent shift.
+type ShiftMetrics struct {
+	Phase    string       `json:"phase"`
+	Progress float64      `json:"progress"`
+	Since    time.Time    `json:"since"`
+	From     GroupMetrics `json:"from"`
+	To       GroupMetrics `json:"to"`
+}
+
+func (c *Client) ListBackends(ctx context.Context) ([]Backend, error) {
+	var backends []Backend
+	err := c.do(ctx, http.MethodGet, "/admin/backends", nil, &backends)
+	return backends, err
+}
+
+// SetWeight sets the runtime weight of the backends whose name, URL or
+// configured URL equals backend.
+func (c *Client) SetWeight(ctx context.Context, backend string, weight int) ([]Weight, error) {
+	var updated []Weight
+	err := c.do(ctx, http.MethodPut, "/admin/backends/weight", map[string]any{"backend": backend, "weight": weight}, &updated)
+	return updated, err
+}
+
+// ResetWeight restores the configured weight of the backends matching
+// backend.
+func (c *Client) ResetWeight(ctx context.Context, backend string) ([]Weight, error) {
+	var updated []Weight
+	err := c.do(ctx, http.MethodPut, "/admin/backends/weight", map[string]any{"backend": backend, "weight": nil}, &updated)
+	return updated, err
+}
+
+// Drain stops new requests going to the backends matching backend while
+// those in flight complete.
+func (c *Client) Drain(ctx context.Context, backend string) ([]Drain, error) {
+	return c.setDraining(ctx, backend, true)
+}
+
+// DrainWithin drains the backends matching backend like Drain, but cuts off
+// the requests still in flight after timeout instead of the configured drain
+// timeout. Zero waits for them however long they take.
+func (c *Client) DrainWithin(ctx context.Context, backend string, timeout time.Duration) ([]Drain, error) {
+	var updated []Drain
+	err := c.do(ctx, http.MethodPut, "/admin/backends/drain", map[string]any{"backend": backend, "draining": true, "timeout": timeout.String()}, &updated)
+	return updated, err
+}
+
+// Undrain returns the backends matching backend to rotation.
+func (c *Client) Undrain(ctx context.Context, backend string) ([]Drain, error) {
+	return c.setDraining(ctx, backend, false)
+}
+
+func (c *Client) setDraining(ctx context.Context, backend string, draining bool) ([]Drain, error) {
+	var updated []Drain
+	err := c.do(ctx, http.MethodPut, "/admin/backends/drain", map[string]any{"backend": backend, "draining": draining}, &updated)
+	return updated, err
+}
+
+// Breakers returns the circuit breaker state of every backend, keyed by
+// backend name: "CLOSED", "OPEN" or "HALF-OPEN".
+func (c *Client) Breakers(ctx context.Context) (map[string]string, error) {
+	var states map[string]string
+	err := c.do(ctx, http.MethodGet, "/admin/breakers", nil, &states)
+	return states, err
+}
+
+// BreakerState returns the circuit breaker state of the named backend.
+// Breakers are created on a backend's first request and dropped on reset, so
+// a backend without one reports "CLOSED".
+func (c *Client) BreakerState(ctx context.Context, backend string) (string, error) {
+	states, err := c.Breakers(ctx)
+	if err != nil {
+		return "", err
+	}
+	if state, ok := states[backend]; ok {
+		return state, nil
+	}
+	return "CLOSED", nil
+}
+
+// ResetBreakers closes every circuit breaker.
+func (c *Client) ResetBreakers(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/admin/breakers/reset", nil, nil)
+}
+
+// SetSplit holds weight percent of the traffic on the backends labeled to,
+// and the rest on those labeled from, both written as key=value.
+func (c *Client) SetSplit(ctx context.Context, from, to string, weight int) (ShiftStatus, error) {
+	var status ShiftStatus
+	err := c.do(ctx, http.MethodPut, "/admin/shift/split", map[string]any{"from": from, "to": to, "weight": weight}, &status)
+	return status, err
+}
+
+// RollbackShift returns all traffic to the group the last shift or split
+// moved it away from.
+func (c *Client) RollbackShift(ctx context.Context) (ShiftStatus, error) {
+	var status ShiftStatus
+	err := c.do(ctx, http.MethodPost, "/admin/shift/rollback", nil, &status)
+	return status, err
+}
+
+// ShiftMetrics returns the request metrics of both groups of the current or
+// most recent shift or split.
+func (c *Client) ShiftMetrics(ctx context.Context) (ShiftMetrics, error) {
+	var m ShiftMetrics
+	err := c.do(ctx, http.MethodGet, "/admin/shift/metrics", nil, &m)
+	return m, err
+}
+
+// do sends a request with body encoded as JSON, retrying it as configured,
+// and decodes a successful response into out unless out is nil.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	retries := c.MaxRetries
+	switch {
+	case retries == 0:
+		retries = DefaultMaxRetries
+	case retries < 0:
+		retries = 0
+	}
+	backoff := c.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, err := c.send(ctx, method, path, payload, out)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff << attempt):
+		}
+	}
+}
+
+// send makes one attempt and reports whether a failure is worth retrying.
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, out any) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return retryable(resp.StatusCode), &APIError{StatusCode: resp.StatusCode, Message: errorMessage(resp.Body)}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return false, nil
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// errorMessage returns the error the admin API reported in body, or the
+// start of body when it is not an admin error response.
+func errorMessage(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, 512))
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &resp) == nil && resp.Error != "" {
+		return resp.Error
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,188 @@
+package adminclient_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/admin"
+	"github.com/angeloszaimis/load-balancer/internal/backend"
+	"github.com/angeloszaimis/load-balancer/internal/circuitbreaker"
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/internal/shift"
+	"github.com/angeloszaimis/load-balancer/pkg/adminclient"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		b        *backend.Backend
+		registry *circuitbreaker.Registry
+		server   *httptest.Server
+		client   *adminclient.Client
+		ctx      context.Context
+	)
+
+	BeforeEach(func() {
+		u, _ := url.Parse("http://localhost:8081")
+		b = backend.New(u, 3)
+		b.SetHealthy(true)
+		pool := backend.NewPool([]*backend.Backend{b})
+		registry = circuitbreaker.NewRegistry(1, time.Minute)
+
+		api := admin.New(slog.New(slog.NewTextHandler(io.Discard, nil)), []admin.Token{
+			{Value: "observer-token", Role: admin.RoleObserver},
+			{Value: "operator-token", Role: admin.RoleOperator},
+		})
+		api.Handle("GET /admin/backends", admin.RoleObserver, admin.BackendsHandler(pool, registry))
+		api.Handle("PUT /admin/backends/weight", admin.RoleOperator, admin.SetWeightHandler(pool))
+		api.Handle("PUT /admin/backends/drain", admin.RoleOperator, admin.SetDrainHandler(pool))
+		api.Handle("GET /admin/breakers", admin.RoleObserver, admin.BreakersHandler(registry))
+		api.Handle("POST /admin/breakers/reset", admin.RoleOperator, admin.ResetBreakersHandler(registry))
+
+		server = httptest.NewServer(api)
+		DeferCleanup(server.Close)
+		client = &adminclient.Client{URL: server.URL, Token: "operator-token"}
+		ctx = context.Background()
+	})
+
+	It("should list backends", func() {
+		backends, err := client.ListBackends(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backends).To(HaveLen(1))
+		Expect(backends[0].Name).To(Equal("http://localhost:8081"))
+		Expect(backends[0].State).To(Equal("active"))
+		Expect(backends[0].Weight).To(Equal(3))
+	})
+
+	It("should set and reset weights", func() {
+		updated, err := client.SetWeight(ctx, "http://localhost:8081", 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated).To(Equal([]adminclient.Weight{{
+			Name: "http://localhost:8081", URL: "http://localhost:8081", Weight: 7, ConfiguredWeight: 3,
+		}}))
+
+		_, err = client.ResetWeight(ctx, "http://localhost:8081")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.BaseWeight()).To(Equal(3))
+	})
+
+	It("should drain and undrain backends", func() {
+		updated, err := client.Drain(ctx, "http://localhost:8081")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated[0].State).To(Equal("draining"))
+		Expect(b.IsDraining()).To(BeTrue())
+
+		_, err = client.Undrain(ctx, "http://localhost:8081")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.IsDraining()).To(BeFalse())
+	})
+
+	It("should drain backends within a timeout", func() {
+		updated, err := client.DrainWithin(ctx, "http://localhost:8081", time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated[0].Deadline).NotTo(BeNil())
+		Expect(*updated[0].Deadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+
+		_, err = client.Undrain(ctx, "http://localhost:8081")
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := b.DrainDeadline()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should report and reset breaker states", func() {
+		registry.GetBreaker("http://localhost:8081").RecordFailure()
+		state, err := client.BreakerState(ctx, "http://localhost:8081")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal("OPEN"))
+
+		Expect(client.ResetBreakers(ctx)).To(Succeed())
+		state, err = client.BreakerState(ctx, "http://localhost:8081")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal("CLOSED"))
+	})
+
+	It("should hold a split, report its metrics and roll it back", func() {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		stableURL, _ := url.Parse("http://10.0.0.1")
+		canaryURL, _ := url.Parse("http://10.0.0.2")
+		stable := backend.New(stableURL, 1, backend.WithLabels(map[string]string{"track": "stable"}))
+		canary := backend.New(canaryURL, 1, backend.WithLabels(map[string]string{"track": "canary"}))
+		pool := backend.NewPool([]*backend.Backend{stable, canary})
+		shifter := shift.New(pool, log)
+
+		api := admin.New(log, []admin.Token{{Value: "operator-token", Role: admin.RoleOperator}})
+		api.Handle("PUT /admin/shift/split", admin.RoleOperator, admin.SplitHandler(shifter))
+		api.Handle("POST /admin/shift/rollback", admin.RoleOperator, admin.RollbackShiftHandler(shifter))
+		api.Handle("GET /admin/shift/metrics", admin.RoleObserver, admin.ShiftMetricsHandler(shifter, pool, metrics.NewCollector(1, log)))
+		server := httptest.NewServer(api)
+		DeferCleanup(server.Close)
+		client.URL = server.URL
+
+		status, err := client.SetSplit(ctx, "track=stable", "track=canary", 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Phase).To(Equal("split"))
+		Expect(status.Progress).To(Equal(0.1))
+		Expect(status.ToBackends).To(Equal([]string{"http://10.0.0.2"}))
+
+		m, err := client.ShiftMetrics(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.To.Selector).To(Equal("track=canary"))
+		Expect(m.To.Backends).To(Equal(1))
+		Expect(m.To.SuccessRate).To(BeNil())
+
+		status, err = client.RollbackShift(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Phase).To(Equal("rolled_back"))
+		Expect(canary.ShiftFactor()).To(BeZero())
+	})
+
+	It("should surface authentication and API errors", func() {
+		client.Token = ""
+		_, err := client.ListBackends(ctx)
+		Expect(errors.Is(err, adminclient.ErrUnauthorized)).To(BeTrue())
+
+		client.Token = "observer-token"
+		_, err = client.Drain(ctx, "http://localhost:8081")
+		Expect(errors.Is(err, adminclient.ErrForbidden)).To(BeTrue())
+
+		client.Token = "operator-token"
+		_, err = client.SetWeight(ctx, "http://localhost:9999", 1)
+		var apiErr *adminclient.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(apiErr.Message).To(Equal("unknown backend http://localhost:9999"))
+	})
+
+	It("should retry unavailable responses", func() {
+		var calls atomic.Int32
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"http://localhost:8081":"CLOSED"}`))
+		}))
+		defer flaky.Close()
+
+		client = &adminclient.Client{URL: flaky.URL, RetryBackoff: time.Millisecond}
+		states, err := client.Breakers(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(states).To(HaveKeyWithValue("http://localhost:8081", "CLOSED"))
+		Expect(calls.Load()).To(Equal(int32(3)))
+
+		calls.Store(0)
+		client.MaxRetries = -1
+		_, err = client.Breakers(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+})
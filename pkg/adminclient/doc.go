@@ -0,0 +1,19 @@
+// Package adminclient provides typed access to the load balancer's admin API
+// for tools and scripts automating operations.
+//
+// Requests carry Token as a bearer token. Reads and the idempotent updates
+// the client makes are retried on network errors and 502, 503 and 504
+// responses; other failures are returned as an *APIError, which matches
+// ErrUnauthorized and ErrForbidden with errors.Is when the token is missing
+// or its role too low.
+//
+//	c := &adminclient.Client{URL: "http://localhost:8080", Token: "ops-token"}
+//	backends, err := c.ListBackends(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	for _, b := range backends {
+//		fmt.Println(b.Name, b.State, b.Weight)
+//	}
+//	_, err = c.Drain(ctx, "http://10.0.0.1:8080")
+package adminclient
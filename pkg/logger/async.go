@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncWriter hands writes to a background goroutine through a queue of
+// bounded size, so a slow sink such as a full disk or a pipe nobody reads
+// never blocks the caller. Writes that find the queue full are dropped and
+// counted, as are those the sink fails.
+type AsyncWriter struct {
+	out   io.Writer
+	queue chan []byte
+	done  chan struct{}
+
+	mutex  sync.RWMutex
+	closed bool
+
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// NewAsyncWriter starts writing to out in the background, queueing up to size
+// writes.
+func NewAsyncWriter(out io.Writer, size int) *AsyncWriter {
+	w := &AsyncWriter{
+		out:   out,
+		queue: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	for p := range w.queue {
+		if _, err := w.out.Write(p); err != nil {
+			w.failed.Add(1)
+		}
+	}
+}
+
+// Write queues a copy of p and never blocks. It always reports success: a
+// write that does not fit in the queue, or comes after Close, is dropped.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if w.closed {
+		w.dropped.Add(1)
+		return len(p), nil
+	}
+
+	select {
+	case w.queue <- append([]byte(nil), p...):
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Dropped returns how many writes were dropped or failed. A nil writer has
+// dropped none.
+func (w *AsyncWriter) Dropped() uint64 {
+	if w == nil {
+		return 0
+	}
+	return w.dropped.Load() + w.failed.Load()
+}
+
+// Close stops accepting writes and waits until the queued ones have reached
+// the sink or ctx is done.
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mutex.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
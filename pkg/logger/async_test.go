@@ -0,0 +1,103 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/pkg/logger"
+)
+
+var _ = Describe("AsyncWriter", func() {
+	It("should write lines in order and flush them on close", func() {
+		sink := &blockingSink{}
+		w := logger.NewAsyncWriter(sink, 8)
+
+		w.Write([]byte("first\n"))
+		w.Write([]byte("second\n"))
+		Expect(w.Close(context.Background())).To(Succeed())
+
+		Expect(sink.String()).To(Equal("first\nsecond\n"))
+		Expect(w.Dropped()).To(BeZero())
+	})
+
+	It("should drop writes instead of blocking while the sink is stalled", func() {
+		sink := &blockingSink{release: make(chan struct{})}
+		w := logger.NewAsyncWriter(sink, 2)
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			for range 10 {
+				n, err := w.Write([]byte("line\n"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n).To(Equal(5))
+			}
+		}()
+		Eventually(done).Should(BeClosed())
+		Expect(w.Dropped()).To(BeNumerically(">=", 7))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(w.Close(ctx)).To(MatchError(context.DeadlineExceeded))
+
+		close(sink.release)
+		Expect(w.Close(context.Background())).To(Succeed())
+		w.Write([]byte("late\n"))
+		Expect(w.Dropped()).To(BeNumerically(">=", 8))
+	})
+
+	It("should count writes the sink fails", func() {
+		w := logger.NewAsyncWriter(failingSink{}, 8)
+		w.Write([]byte("line\n"))
+		Expect(w.Close(context.Background())).To(Succeed())
+		Expect(w.Dropped()).To(Equal(uint64(1)))
+	})
+
+	It("should report no drops when nil", func() {
+		var w *logger.AsyncWriter
+		Expect(w.Dropped()).To(BeZero())
+	})
+
+	It("should carry a logger's output", func() {
+		sink := &blockingSink{}
+		w := logger.NewAsyncWriter(sink, 8)
+		logger.NewWriter(w, "info", false, "prod").Info("served")
+		Expect(w.Close(context.Background())).To(Succeed())
+		Expect(sink.String()).To(ContainSubstring(`"msg":"served"`))
+	})
+})
+
+// blockingSink collects writes, each waiting for release when it is set.
+type blockingSink struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (s *blockingSink) Write(p []byte) (int, error) {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *blockingSink) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
@@ -1,12 +1,18 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
 	"strings"
 )
 
 func New(lvl string, addSource bool, enviroment string) *slog.Logger {
+	return NewWriter(os.Stdout, lvl, addSource, enviroment)
+}
+
+// NewWriter is New logging to out instead of standard output.
+func NewWriter(out io.Writer, lvl string, addSource bool, enviroment string) *slog.Logger {
 
 	level := parseLevel(lvl)
 
@@ -17,9 +23,9 @@ func New(lvl string, addSource bool, enviroment string) *slog.Logger {
 	var handler slog.Handler
 
 	if strings.ToLower(enviroment) == "prod" {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	} else {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(out, opts)
 	}
 
 	return slog.New(handler).With(
@@ -0,0 +1,254 @@
+package metricsclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Aggregate is a merged view of snapshots from several load balancer
+// instances. Instances keeps every instance's own snapshot so contributions
+// can be told apart; instances that could not be fetched are listed in
+// Unreachable with the error.
+type Aggregate struct {
+	SchemaVersion    int                         `json:"schema_version"`
+	TotalRequests    int64                       `json:"total_requests"`
+	Backends         map[string]AggregateBackend `json:"backends"`
+	Errors           ErrorCounts                 `json:"errors"`
+	Endpoints        map[string]EndpointMetrics  `json:"endpoints,omitempty"`
+	ClientIPRejected map[string]int64            `json:"client_ip_rejected,omitempty"`
+	HeadersRejected  map[string]int64            `json:"headers_rejected,omitempty"`
+	WAFHits          map[string]int64            `json:"waf_hits,omitempty"`
+	Classes          map[string]ClassMetrics     `json:"classes,omitempty"`
+	Decisions        map[string]DecisionMetrics  `json:"decisions,omitempty"`
+	Queue            *QueueMetrics               `json:"queue,omitempty"`
+	Instances        map[string]*Snapshot        `json:"instances"`
+	Unreachable      map[string]string           `json:"unreachable,omitempty"`
+}
+
+// AggregateBackend merges one backend's metrics across instances. Counters
+// are summed and the average is weighted by request count. Percentiles cannot
+// be merged exactly, so the highest instance value is reported as an upper
+// bound. Healthy is true only if every instance reporting the backend sees it
+// healthy. State is kept when every instance reports the same state and is
+// "mixed" otherwise; States counts the instances in each state. The
+// certificate fields report the soonest expiry any instance saw.
+type AggregateBackend struct {
+	BackendMetrics
+	HealthyOn int            `json:"healthy_on"`
+	Instances int            `json:"instances"`
+	States    map[string]int `json:"states,omitempty"`
+}
+
+// Merge combines snapshots keyed by instance name. Endpoints are merged like
+// backends: counters are summed, the average is weighted by request count
+// and percentiles are upper bounds. Decision counts are summed and the
+// highest last value is kept. Queue depths and outcomes are summed and the
+// wait is averaged over admitted requests.
+func Merge(snapshots map[string]*Snapshot) *Aggregate {
+	agg := &Aggregate{
+		SchemaVersion: SchemaVersion,
+		Backends:      make(map[string]AggregateBackend),
+		Errors: ErrorCounts{
+			LB:           make(map[int]int64),
+			Upstream:     make(map[int]int64),
+			UpstreamGRPC: make(map[int]int64),
+		},
+		Instances: snapshots,
+	}
+
+	weightedAvg := make(map[string]float64)
+	var queueWait float64
+	endpointAvg := make(map[string]float64)
+	for _, snap := range snapshots {
+		agg.TotalRequests += snap.TotalRequests
+		addCounts(agg.Errors.LB, snap.Errors.LB)
+		addCounts(agg.Errors.Upstream, snap.Errors.Upstream)
+		addCounts(agg.Errors.UpstreamGRPC, snap.Errors.UpstreamGRPC)
+
+		for name, bm := range snap.Backends {
+			ab, seen := agg.Backends[name]
+			if !seen {
+				ab.Healthy = true
+				ab.State = bm.State
+				ab.StatusCodes = make(map[int]int64)
+				ab.StatusClasses = make(map[string]int64)
+				ab.GRPCStatuses = make(map[int]int64)
+			}
+
+			ab.Instances++
+			if bm.Healthy {
+				ab.HealthyOn++
+			}
+			ab.Healthy = ab.Healthy && bm.Healthy
+			if bm.State != ab.State {
+				ab.State = "mixed"
+			}
+			if bm.State != "" {
+				if ab.States == nil {
+					ab.States = make(map[string]int)
+				}
+				ab.States[bm.State]++
+			}
+			ab.Requests += bm.Requests
+			ab.Selections += bm.Selections
+			ab.ClientCanceled += bm.ClientCanceled
+			ab.AffinityFailovers += bm.AffinityFailovers
+			ab.OtherStatusCodes += bm.OtherStatusCodes
+			ab.P50Response = max(ab.P50Response, bm.P50Response)
+			ab.P95Response = max(ab.P95Response, bm.P95Response)
+			ab.P99Response = max(ab.P99Response, bm.P99Response)
+			addCounts(ab.StatusCodes, bm.StatusCodes)
+			addCounts(ab.StatusClasses, bm.StatusClasses)
+			addCounts(ab.GRPCStatuses, bm.GRPCStatuses)
+			weightedAvg[name] += float64(bm.AvgResponse) * float64(bm.Requests)
+			if days := bm.CertificateExpiresInDays; days != nil && (ab.CertificateExpiresInDays == nil || *days < *ab.CertificateExpiresInDays) {
+				soonest := *days
+				ab.CertificateExpiresInDays = &soonest
+			}
+			ab.CertificateExpiring = ab.CertificateExpiring || bm.CertificateExpiring
+			if e := bm.Errors; e != nil {
+				if ab.Errors == nil {
+					ab.Errors = &BackendErrors{}
+				}
+				ab.Errors.Dial += e.Dial
+				ab.Errors.Timeout += e.Timeout
+				ab.Errors.Reset += e.Reset
+				ab.Errors.Other += e.Other
+				ab.Errors.Status5xx += e.Status5xx
+				ab.Errors.BreakerRejected += e.BreakerRejected
+			}
+
+			agg.Backends[name] = ab
+		}
+
+		for reason, count := range snap.ClientIPRejected {
+			if agg.ClientIPRejected == nil {
+				agg.ClientIPRejected = make(map[string]int64)
+			}
+			agg.ClientIPRejected[reason] += count
+		}
+		for reason, count := range snap.HeadersRejected {
+			if agg.HeadersRejected == nil {
+				agg.HeadersRejected = make(map[string]int64)
+			}
+			agg.HeadersRejected[reason] += count
+		}
+		for rule, count := range snap.WAFHits {
+			if agg.WAFHits == nil {
+				agg.WAFHits = make(map[string]int64)
+			}
+			agg.WAFHits[rule] += count
+		}
+		for class, cm := range snap.Classes {
+			if agg.Classes == nil {
+				agg.Classes = make(map[string]ClassMetrics)
+			}
+			merged := agg.Classes[class]
+			merged.Requests += cm.Requests
+			merged.Errors += cm.Errors
+			agg.Classes[class] = merged
+		}
+		if q := snap.Queue; q != nil {
+			if agg.Queue == nil {
+				agg.Queue = &QueueMetrics{Outcomes: make(map[string]int64)}
+			}
+			agg.Queue.Depth += q.Depth
+			for outcome, count := range q.Outcomes {
+				agg.Queue.Outcomes[outcome] += count
+			}
+			queueWait += float64(q.AvgWait) * float64(q.Outcomes["admitted"])
+		}
+		for kind, dm := range snap.Decisions {
+			if agg.Decisions == nil {
+				agg.Decisions = make(map[string]DecisionMetrics)
+			}
+			merged := agg.Decisions[kind]
+			merged.Count += dm.Count
+			merged.Last = max(merged.Last, dm.Last)
+			agg.Decisions[kind] = merged
+		}
+
+		for label, em := range snap.Endpoints {
+			if agg.Endpoints == nil {
+				agg.Endpoints = make(map[string]EndpointMetrics)
+			}
+			merged, seen := agg.Endpoints[label]
+			if !seen {
+				merged.StatusCodes = make(map[int]int64)
+				merged.StatusClasses = make(map[string]int64)
+			}
+
+			merged.Requests += em.Requests
+			merged.Errors += em.Errors
+			merged.OtherStatusCodes += em.OtherStatusCodes
+			merged.P50Response = max(merged.P50Response, em.P50Response)
+			merged.P95Response = max(merged.P95Response, em.P95Response)
+			merged.P99Response = max(merged.P99Response, em.P99Response)
+			addCounts(merged.StatusCodes, em.StatusCodes)
+			addCounts(merged.StatusClasses, em.StatusClasses)
+			endpointAvg[label] += float64(em.AvgResponse) * float64(em.Requests)
+
+			agg.Endpoints[label] = merged
+		}
+	}
+
+	for name, ab := range agg.Backends {
+		if ab.Requests > 0 {
+			ab.AvgResponse = time.Duration(weightedAvg[name] / float64(ab.Requests))
+			agg.Backends[name] = ab
+		}
+	}
+
+	for label, em := range agg.Endpoints {
+		if em.Requests > 0 {
+			em.AvgResponse = time.Duration(endpointAvg[label] / float64(em.Requests))
+			agg.Endpoints[label] = em
+		}
+	}
+
+	if agg.Queue != nil && agg.Queue.Outcomes["admitted"] > 0 {
+		agg.Queue.AvgWait = time.Duration(queueWait / float64(agg.Queue.Outcomes["admitted"]))
+	}
+
+	return agg
+}
+
+// FetchAll fetches every instance concurrently and merges the results.
+func FetchAll(ctx context.Context, clients map[string]*Client) *Aggregate {
+	var (
+		mutex       sync.Mutex
+		wg          sync.WaitGroup
+		snapshots   = make(map[string]*Snapshot, len(clients))
+		unreachable = make(map[string]string)
+	)
+
+	for name, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snap, err := client.Fetch(ctx)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				unreachable[name] = err.Error()
+				return
+			}
+			snapshots[name] = snap
+		}()
+	}
+	wg.Wait()
+
+	agg := Merge(snapshots)
+	if len(unreachable) > 0 {
+		agg.Unreachable = unreachable
+	}
+	return agg
+}
+
+func addCounts[K comparable](dst, src map[K]int64) {
+	for code, count := range src {
+		dst[code] += count
+	}
+}
@@ -0,0 +1,235 @@
+package metricsclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/pkg/metricsclient"
+)
+
+var _ = Describe("Aggregate", func() {
+	const backend = "http://localhost:8081"
+
+	snapshot := func(requests int, latency time.Duration, healthy bool) *metricsclient.Snapshot {
+		return &metricsclient.Snapshot{
+			SchemaVersion: metricsclient.SchemaVersion,
+			TotalRequests: int64(requests),
+			Backends: map[string]metricsclient.BackendMetrics{
+				backend: {
+					Requests:      int64(requests),
+					Selections:    int64(requests),
+					Healthy:       healthy,
+					AvgResponse:   latency,
+					P99Response:   latency,
+					StatusCodes:   map[int]int64{http.StatusOK: int64(requests)},
+					StatusClasses: map[string]int64{"2xx": int64(requests)},
+				},
+			},
+			Errors: metricsclient.ErrorCounts{
+				LB:       map[int]int64{http.StatusServiceUnavailable: 1},
+				Upstream: map[int]int64{},
+			},
+		}
+	}
+
+	It("should sum counters and keep per-instance snapshots", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		b := snapshot(3, 50*time.Millisecond, false)
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(agg.TotalRequests).To(Equal(int64(4)))
+		Expect(agg.Errors.LB).To(HaveKeyWithValue(http.StatusServiceUnavailable, int64(2)))
+		Expect(agg.Instances).To(HaveKeyWithValue("a", a))
+		Expect(agg.Instances).To(HaveKeyWithValue("b", b))
+
+		m := agg.Backends[backend]
+		Expect(m.Requests).To(Equal(int64(4)))
+		Expect(m.StatusCodes).To(HaveKeyWithValue(http.StatusOK, int64(4)))
+		Expect(m.StatusClasses).To(HaveKeyWithValue("2xx", int64(4)))
+		Expect(m.AvgResponse).To(Equal(40 * time.Millisecond))
+		Expect(m.P99Response).To(Equal(50 * time.Millisecond))
+		Expect(m.Instances).To(Equal(2))
+		Expect(m.HealthyOn).To(Equal(1))
+		Expect(m.Healthy).To(BeFalse())
+	})
+
+	It("should keep a state the instances agree on", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		b := snapshot(1, 10*time.Millisecond, true)
+		c := snapshot(1, 10*time.Millisecond, true)
+		for _, snap := range []*metricsclient.Snapshot{a, b, c} {
+			m := snap.Backends[backend]
+			m.State = "active"
+			snap.Backends[backend] = m
+		}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+		Expect(agg.Backends[backend].State).To(Equal("active"))
+		Expect(agg.Backends[backend].States).To(Equal(map[string]int{"active": 2}))
+
+		m := c.Backends[backend]
+		m.State = "maintenance"
+		c.Backends[backend] = m
+		agg = metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b, "c": c})
+		Expect(agg.Backends[backend].State).To(Equal("mixed"))
+		Expect(agg.Backends[backend].States).To(Equal(map[string]int{"active": 2, "maintenance": 1}))
+	})
+
+	It("should merge endpoint metrics", func() {
+		const label = "GET /users/{id}"
+		a := snapshot(1, 10*time.Millisecond, true)
+		a.Endpoints = map[string]metricsclient.EndpointMetrics{
+			label: {Requests: 1, AvgResponse: 10 * time.Millisecond, P99Response: 10 * time.Millisecond, StatusCodes: map[int]int64{http.StatusOK: 1}},
+		}
+		b := snapshot(3, 50*time.Millisecond, true)
+		b.Endpoints = map[string]metricsclient.EndpointMetrics{
+			label: {Requests: 3, Errors: 1, AvgResponse: 50 * time.Millisecond, P99Response: 90 * time.Millisecond, StatusCodes: map[int]int64{http.StatusOK: 2, http.StatusBadGateway: 1}},
+		}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		em := agg.Endpoints[label]
+		Expect(em.Requests).To(Equal(int64(4)))
+		Expect(em.Errors).To(Equal(int64(1)))
+		Expect(em.AvgResponse).To(Equal(40 * time.Millisecond))
+		Expect(em.P99Response).To(Equal(90 * time.Millisecond))
+		Expect(em.StatusCodes).To(Equal(map[int]int64{http.StatusOK: 3, http.StatusBadGateway: 1}))
+	})
+
+	It("should report the soonest certificate expiry", func() {
+		soon, later := 3.5, 40.0
+		a := snapshot(1, 10*time.Millisecond, true)
+		bm := a.Backends[backend]
+		bm.CertificateExpiresInDays, bm.CertificateExpiring = &soon, true
+		a.Backends[backend] = bm
+		b := snapshot(1, 10*time.Millisecond, true)
+		bm = b.Backends[backend]
+		bm.CertificateExpiresInDays = &later
+		b.Backends[backend] = bm
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(*agg.Backends[backend].CertificateExpiresInDays).To(Equal(3.5))
+		Expect(agg.Backends[backend].CertificateExpiring).To(BeTrue())
+	})
+
+	It("should sum failure causes", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		bm := a.Backends[backend]
+		bm.Errors = &metricsclient.BackendErrors{Dial: 2, BreakerRejected: 1}
+		a.Backends[backend] = bm
+		b := snapshot(1, 10*time.Millisecond, true)
+		bm = b.Backends[backend]
+		bm.Errors = &metricsclient.BackendErrors{Dial: 1, Timeout: 4}
+		b.Backends[backend] = bm
+		c := snapshot(1, 10*time.Millisecond, true)
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b, "c": c})
+
+		Expect(agg.Backends[backend].Errors).To(Equal(&metricsclient.BackendErrors{Dial: 3, Timeout: 4, BreakerRejected: 1}))
+		Expect(a.Backends[backend].Errors.Dial).To(Equal(int64(2)))
+	})
+
+	It("should sum rejected client IP headers", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		a.ClientIPRejected = map[string]int64{"untrusted_peer": 2}
+		b := snapshot(1, 10*time.Millisecond, true)
+		b.ClientIPRejected = map[string]int64{"untrusted_peer": 1, "invalid": 4}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(agg.ClientIPRejected).To(Equal(map[string]int64{"untrusted_peer": 3, "invalid": 4}))
+	})
+
+	It("should sum rejected request headers", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		a.HeadersRejected = map[string]int64{"size": 1}
+		b := snapshot(1, 10*time.Millisecond, true)
+		b.HeadersRejected = map[string]int64{"size": 2, "count": 1}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(agg.HeadersRejected).To(Equal(map[string]int64{"size": 3, "count": 1}))
+	})
+
+	It("should sum traffic classes", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		a.Classes = map[string]metricsclient.ClassMetrics{"probe": {Requests: 10}}
+		b := snapshot(1, 10*time.Millisecond, true)
+		b.Classes = map[string]metricsclient.ClassMetrics{"probe": {Requests: 5}, "api": {Requests: 3, Errors: 1}}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(agg.Classes).To(Equal(map[string]metricsclient.ClassMetrics{
+			"probe": {Requests: 15},
+			"api":   {Requests: 3, Errors: 1},
+		}))
+	})
+
+	It("should sum WAF rule hits", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		a.WAFHits = map[string]int64{"block-dotfiles": 2}
+		b := snapshot(1, 10*time.Millisecond, true)
+		b.WAFHits = map[string]int64{"block-dotfiles": 1, "limit-login": 5}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(agg.WAFHits).To(Equal(map[string]int64{"block-dotfiles": 3, "limit-login": 5}))
+	})
+
+	It("should sum strategy decisions", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		a.Decisions = map[string]metricsclient.DecisionMetrics{"subset": {Count: 4, Last: 5}}
+		b := snapshot(1, 10*time.Millisecond, true)
+		b.Decisions = map[string]metricsclient.DecisionMetrics{"subset": {Count: 2, Last: 4}, "ring_rebuild": {Count: 1, Last: 8}}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(agg.Decisions).To(Equal(map[string]metricsclient.DecisionMetrics{
+			"subset":       {Count: 6, Last: 5},
+			"ring_rebuild": {Count: 1, Last: 8},
+		}))
+	})
+
+	It("should sum queue depths and average the wait over admitted requests", func() {
+		a := snapshot(1, 10*time.Millisecond, true)
+		a.Queue = &metricsclient.QueueMetrics{Depth: 2, Outcomes: map[string]int64{"admitted": 1}, AvgWait: 40 * time.Millisecond}
+		b := snapshot(1, 10*time.Millisecond, true)
+		b.Queue = &metricsclient.QueueMetrics{Depth: 1, Outcomes: map[string]int64{"admitted": 3, "timeout": 2}, AvgWait: 20 * time.Millisecond}
+
+		agg := metricsclient.Merge(map[string]*metricsclient.Snapshot{"a": a, "b": b})
+
+		Expect(agg.Queue.Depth).To(Equal(int64(3)))
+		Expect(agg.Queue.Outcomes).To(Equal(map[string]int64{"admitted": 4, "timeout": 2}))
+		Expect(agg.Queue.AvgWait).To(Equal(25 * time.Millisecond))
+	})
+
+	It("should fetch peers and report unreachable ones", func() {
+		m := metrics.NewMetrics()
+		m.IncrementRequests(backend)
+		m.RecordResponse(backend, 20*time.Millisecond, http.StatusOK)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(m.Snapshot("round-robin"))
+		}))
+		defer server.Close()
+
+		agg := metricsclient.FetchAll(context.Background(), map[string]*metricsclient.Client{
+			"up":   {URL: server.URL},
+			"down": {URL: "http://127.0.0.1:1/metrics"},
+		})
+
+		Expect(agg.Instances).To(HaveKey("up"))
+		Expect(agg.Instances).NotTo(HaveKey("down"))
+		Expect(agg.Unreachable).To(HaveKey("down"))
+		Expect(agg.TotalRequests).To(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,216 @@
+package metricsclient
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SchemaVersion is the snapshot schema version this client understands.
+// Snapshots down to MinSchemaVersion are decoded too, leaving the fields
+// later versions added at their zero values.
+const (
+	SchemaVersion    = 2
+	MinSchemaVersion = 1
+)
+
+// Schema is the JSON Schema describing the snapshot at SchemaVersion.
+//
+//go:embed snapshot.v2.schema.json
+var Schema []byte
+
+type Snapshot struct {
+	SchemaVersion int                       `json:"schema_version"`
+	TotalRequests int64                     `json:"total_requests"`
+	Uptime        time.Duration             `json:"uptime"`
+	Backends      map[string]BackendMetrics `json:"backends"`
+	Algorithm     string                    `json:"algorithm"`
+	Errors        ErrorCounts               `json:"errors"`
+	// Endpoints is keyed by endpoint label, e.g. "GET /users/{id}", and is
+	// only present when endpoint metrics are enabled.
+	Endpoints map[string]EndpointMetrics `json:"endpoints,omitempty"`
+	// ClientIPRejected counts requests whose client IP header was not
+	// believed, keyed by reason: "untrusted_peer" when the peer is not a
+	// trusted proxy, "invalid" when a value is not an IP address.
+	ClientIPRejected map[string]int64 `json:"client_ip_rejected,omitempty"`
+	// HeadersRejected counts requests refused with 431 because their headers
+	// exceeded a limit, keyed by limit: "size", "count" or "line_length".
+	HeadersRejected map[string]int64 `json:"headers_rejected,omitempty"`
+	// WAFHits counts requests each WAF rule blocked, rate limited or
+	// tagged, keyed by rule name.
+	WAFHits map[string]int64 `json:"waf_hits,omitempty"`
+	// Classes counts the responses clients received by traffic class:
+	// "probe", "bot", "browser" or "api".
+	Classes map[string]ClassMetrics `json:"classes,omitempty"`
+	// Decisions counts the internal decisions made while selecting
+	// backends, keyed by kind: "ring_rebuild", "ring_miss",
+	// "chain_fallback" or "subset".
+	Decisions map[string]DecisionMetrics `json:"decisions,omitempty"`
+	// Queue describes the admission queue; it is absent until a request
+	// met a pool whose backends were all full.
+	Queue *QueueMetrics `json:"queue,omitempty"`
+}
+
+// ErrorCounts splits 5xx responses into those generated by the load balancer
+// and those relayed from backends, keyed by status code. UpstreamGRPC counts
+// gRPC calls that failed on the backend, keyed by grpc-status.
+type ErrorCounts struct {
+	LB           map[int]int64 `json:"lb"`
+	Upstream     map[int]int64 `json:"upstream"`
+	UpstreamGRPC map[int]int64 `json:"upstream_grpc,omitempty"`
+}
+
+type BackendMetrics struct {
+	Requests    int64         `json:"requests"`
+	Selections  int64         `json:"selections"`
+	Healthy     bool          `json:"healthy"`
+	AvgResponse time.Duration `json:"avg_response"`
+	P50Response time.Duration `json:"p50_response"`
+	P95Response time.Duration `json:"p95_response"`
+	P99Response time.Duration `json:"p99_response"`
+	StatusCodes map[int]int64 `json:"status_codes"`
+	// GRPCStatuses counts completed gRPC calls by grpc-status.
+	GRPCStatuses map[int]int64 `json:"grpc_statuses,omitempty"`
+	// ClientCanceled counts requests the client abandoned before the
+	// backend responded; they are not counted as backend failures.
+	ClientCanceled int64 `json:"client_canceled"`
+	// AffinityFailovers counts requests a hashing strategy maps to this
+	// backend that another backend served because it was unavailable.
+	AffinityFailovers int64 `json:"affinity_failovers,omitempty"`
+	// OtherStatusCodes counts the responses whose code StatusCodes no
+	// longer lists, so that the two together count every response.
+	OtherStatusCodes int64 `json:"other_status_codes,omitempty"`
+	// StatusClasses counts every response by class: "1xx" to "5xx", and
+	// "other" for codes outside them. StatusCodes only lists every 5xx code
+	// and the other codes seen most recently, so it may not add up to these.
+	StatusClasses map[string]int64 `json:"status_classes"`
+	// Errors breaks down why the backend failed requests; absent until it
+	// has.
+	Errors *BackendErrors `json:"errors,omitempty"`
+	// State is the backend's state on the instance: "active", "degraded",
+	// "standby", "draining", "down" or "maintenance". It is empty until the
+	// instance has reported one.
+	State string `json:"state,omitempty"`
+	// CertificateExpiresInDays is the time left until the backend's TLS
+	// certificate expires, negative once expired; absent for plain HTTP
+	// backends and until a handshake was seen. CertificateExpiring is set
+	// within the configured warning period.
+	CertificateExpiresInDays *float64 `json:"certificate_expires_in_days,omitempty"`
+	CertificateExpiring      bool     `json:"certificate_expiring,omitempty"`
+}
+
+// BackendErrors counts a backend's failures by cause. Dial, Timeout, Reset and
+// Other count attempts that got no response: the backend could not be
+// reached, did not answer in time, dropped the connection, or failed some
+// other way. Status5xx counts the 5xx responses it sent and BreakerRejected
+// the attempts skipped because its circuit breaker was open.
+type BackendErrors struct {
+	Dial            int64 `json:"dial"`
+	Timeout         int64 `json:"timeout"`
+	Reset           int64 `json:"reset"`
+	Other           int64 `json:"other"`
+	Status5xx       int64 `json:"status_5xx"`
+	BreakerRejected int64 `json:"breaker_rejected"`
+}
+
+// EndpointMetrics describes the responses clients received for one endpoint,
+// after retries. Errors counts 5xx responses.
+type EndpointMetrics struct {
+	Requests    int64         `json:"requests"`
+	Errors      int64         `json:"errors"`
+	AvgResponse time.Duration `json:"avg_response"`
+	P50Response time.Duration `json:"p50_response"`
+	P95Response time.Duration `json:"p95_response"`
+	P99Response time.Duration `json:"p99_response"`
+	StatusCodes map[int]int64 `json:"status_codes"`
+	// OtherStatusCodes counts the responses whose code StatusCodes no
+	// longer lists, like the backend's.
+	OtherStatusCodes int64 `json:"other_status_codes,omitempty"`
+	// StatusClasses counts every response by class, like the backend's.
+	StatusClasses map[string]int64 `json:"status_classes"`
+}
+
+// ClassMetrics counts the requests of one traffic class. Errors counts 5xx
+// responses.
+type ClassMetrics struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+// QueueMetrics describes the admission queue. Depth is the number of requests
+// waiting, Outcomes counts requests by what became of them: "queued",
+// "admitted", "timeout", "full" or "canceled". AvgWait is the mean time
+// admitted requests waited.
+type QueueMetrics struct {
+	Depth    int64            `json:"depth"`
+	Outcomes map[string]int64 `json:"outcomes"`
+	AvgWait  time.Duration    `json:"avg_wait"`
+}
+
+// DecisionMetrics counts the decisions of one kind. Last is the value the
+// latest one reported: the backends on a rebuilt ring, the candidates of a
+// ring miss, the chain position of a fallback or the size of the subset.
+type DecisionMetrics struct {
+	Count int64   `json:"count"`
+	Last  float64 `json:"last"`
+}
+
+// Client fetches snapshots from a /metrics endpoint. Token is sent as a
+// bearer token when set; HTTPClient defaults to http.DefaultClient.
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Fetch retrieves a snapshot from url using a default Client.
+func Fetch(ctx context.Context, url string) (*Snapshot, error) {
+	return (&Client{URL: url}).Fetch(ctx)
+}
+
+func (c *Client) Fetch(ctx context.Context) (*Snapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("metrics endpoint returned %s: %s", resp.Status, body)
+	}
+
+	return Decode(resp.Body)
+}
+
+// Decode reads a snapshot from r and checks its schema version.
+func Decode(r io.Reader) (*Snapshot, error) {
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	if snap.SchemaVersion < MinSchemaVersion || snap.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unsupported snapshot schema version %d, want %d to %d", snap.SchemaVersion, MinSchemaVersion, SchemaVersion)
+	}
+
+	return &snap, nil
+}
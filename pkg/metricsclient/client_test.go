@@ -0,0 +1,123 @@
+package metricsclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/angeloszaimis/load-balancer/internal/metrics"
+	"github.com/angeloszaimis/load-balancer/pkg/metricsclient"
+)
+
+var _ = Describe("Client", func() {
+	var m *metrics.Metrics
+
+	BeforeEach(func() {
+		m = metrics.NewMetrics()
+		m.IncrementRequests("http://localhost:8081")
+		m.RecordBackendSelection("http://localhost:8081")
+		m.RecordResponse("http://localhost:8081", 20*time.Millisecond, http.StatusOK)
+		m.UpdateHealthStatus("http://localhost:8081", true)
+	})
+
+	It("should match the server's schema version", func() {
+		Expect(metricsclient.SchemaVersion).To(Equal(metrics.SnapshotSchemaVersion))
+	})
+
+	It("should decode a snapshot served by the load balancer", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(m.Snapshot("round-robin"))
+		}))
+		defer server.Close()
+
+		snap, err := metricsclient.Fetch(context.Background(), server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.Algorithm).To(Equal("round-robin"))
+		Expect(snap.TotalRequests).To(Equal(int64(1)))
+
+		b := snap.Backends["http://localhost:8081"]
+		Expect(b.Healthy).To(BeTrue())
+		Expect(b.Selections).To(Equal(int64(1)))
+		Expect(b.P50Response).To(Equal(20 * time.Millisecond))
+		Expect(b.StatusCodes).To(HaveKeyWithValue(http.StatusOK, int64(1)))
+	})
+
+	It("should send the bearer token", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(m.Snapshot("round-robin"))
+		}))
+		defer server.Close()
+
+		_, err := metricsclient.Fetch(context.Background(), server.URL)
+		Expect(err).To(MatchError(ContainSubstring("401")))
+
+		client := &metricsclient.Client{URL: server.URL, Token: "secret"}
+		_, err = client.Fetch(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject unknown schema versions", func() {
+		_, err := metricsclient.Decode(strings.NewReader(`{"schema_version": 3, "backends": {}}`))
+		Expect(err).To(MatchError(ContainSubstring("unsupported snapshot schema version 3")))
+
+		_, err = metricsclient.Decode(strings.NewReader(`{"backends": {}}`))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should decode version 1 snapshots without the fields added since", func() {
+		snap, err := metricsclient.Decode(strings.NewReader(`{
+			"schema_version": 1,
+			"total_requests": 3,
+			"algorithm": "round-robin",
+			"backends": {"http://localhost:8081": {"healthy": true, "selections": 3}}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.SchemaVersion).To(Equal(1))
+		Expect(snap.TotalRequests).To(Equal(int64(3)))
+		Expect(snap.ClientIPRejected).To(BeEmpty())
+
+		b := snap.Backends["http://localhost:8081"]
+		Expect(b.Healthy).To(BeTrue())
+		Expect(b.Selections).To(Equal(int64(3)))
+		Expect(b.AffinityFailovers).To(BeZero())
+	})
+
+	It("should embed a schema listing every snapshot field", func() {
+		var schema struct {
+			Required []string `json:"required"`
+			Defs     struct {
+				Backend struct {
+					Required []string `json:"required"`
+				} `json:"backend"`
+			} `json:"$defs"`
+		}
+		Expect(json.Unmarshal(metricsclient.Schema, &schema)).To(Succeed())
+
+		raw, err := json.Marshal(m.Snapshot("round-robin"))
+		Expect(err).NotTo(HaveOccurred())
+		var snap map[string]json.RawMessage
+		Expect(json.Unmarshal(raw, &snap)).To(Succeed())
+		Expect(snap).To(HaveLen(len(schema.Required)))
+		for _, field := range schema.Required {
+			Expect(snap).To(HaveKey(field))
+		}
+
+		var backends map[string]map[string]json.RawMessage
+		Expect(json.Unmarshal(snap["backends"], &backends)).To(Succeed())
+		backend := backends["http://localhost:8081"]
+		Expect(backend).To(HaveLen(len(schema.Defs.Backend.Required)))
+		for _, field := range schema.Defs.Backend.Required {
+			Expect(backend).To(HaveKey(field))
+		}
+	})
+})
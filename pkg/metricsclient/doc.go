@@ -0,0 +1,18 @@
+// Package metricsclient provides typed access to the load balancer's /metrics
+// snapshot for tools and scripts.
+//
+// The snapshot carries a schema_version field; Fetch rejects snapshots whose
+// version it does not understand instead of silently decoding zero values.
+// The JSON Schema for the current version is available as Schema.
+//
+//	snap, err := metricsclient.Fetch(ctx, "http://localhost:8080/metrics")
+//	if err != nil {
+//		return err
+//	}
+//	for name, b := range snap.Backends {
+//		fmt.Println(name, b.Healthy, b.P95Response)
+//	}
+//
+// FetchAll and Merge combine snapshots from several instances into one
+// Aggregate that keeps each instance's contribution.
+package metricsclient
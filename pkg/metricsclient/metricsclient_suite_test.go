@@ -0,0 +1,13 @@
+package metricsclient_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMetricsClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MetricsClient Suite")
+}
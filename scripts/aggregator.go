@@ -0,0 +1,88 @@
+// aggregator serves a merged /metrics view of several load balancer
+// instances, e.g. processes sharing a port with SO_REUSEPORT or instances on
+// separate hosts.
+//
+// Usage:
+//
+//	go run aggregator.go -listen :9100 -peers lb1=http://10.0.0.1:8080/metrics,lb2=http://10.0.0.2:8080/metrics
+//
+// Peers are given as name=url; without a name the URL's host is used. A URL
+// may itself contain "=", e.g. in its query string. Every
+// request fetches all peers concurrently. The response sums counters across
+// instances and keeps each instance's snapshot under "instances", with peers
+// that could not be fetched listed under "unreachable".
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/angeloszaimis/load-balancer/pkg/metricsclient"
+)
+
+func main() {
+	listen := flag.String("listen", ":9100", "address to serve the merged view on")
+	peers := flag.String("peers", "", "comma-separated list of [name=]metrics URL")
+	token := flag.String("token", "", "bearer token sent to peers")
+	timeout := flag.Duration("timeout", 2*time.Second, "per-request timeout for fetching peers")
+	flag.Parse()
+
+	clients, err := parsePeers(*peers, *token, *timeout)
+	if err != nil {
+		log.Fatalf("invalid -peers: %v", err)
+	}
+	if len(clients) == 0 {
+		log.Fatal("no peers given, use -peers")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), *timeout)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metricsclient.FetchAll(ctx, clients))
+	})
+
+	log.Printf("aggregating %d peers on %s", len(clients), *listen)
+	if err := http.ListenAndServe(*listen, mux); err != nil {
+		log.Fatalf("server failed: %v", err)
+	}
+}
+
+func parsePeers(list, token string, timeout time.Duration) (map[string]*metricsclient.Client, error) {
+	clients := make(map[string]*metricsclient.Client)
+	httpClient := &http.Client{Timeout: timeout}
+
+	for _, peer := range strings.Split(list, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer == "" {
+			continue
+		}
+
+		// Only an "=" before the URL names the peer; one inside the URL,
+		// as in a query string, does not.
+		name, rawURL, named := strings.Cut(peer, "=")
+		if !named || strings.ContainsAny(name, ":/?") {
+			name, rawURL, named = "", peer, false
+		}
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if !named {
+			name = u.Host
+		}
+
+		clients[name] = &metricsclient.Client{URL: rawURL, Token: token, HTTPClient: httpClient}
+	}
+
+	return clients, nil
+}
@@ -4,18 +4,25 @@
 // Usage:
 //
 //	go run cbtest.go -lb http://localhost:8080 -backend-port 8081
+//
+// By default the backends on ports 8081-8085 are started in-process, so the
+// failure phase can stop one without platform tools. Pass -spawn-backends=false
+// to test against externally started backends; the failure phase is then
+// skipped.
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/angeloszaimis/load-balancer/internal/testbackend"
+	"github.com/angeloszaimis/load-balancer/pkg/adminclient"
+	"github.com/angeloszaimis/load-balancer/pkg/metricsclient"
 )
 
 const (
@@ -29,13 +36,30 @@ const (
 
 func main() {
 	var (
-		lbURL       = flag.String("lb", "http://localhost:8080", "Load balancer URL")
-		backendPort = flag.Int("backend-port", 8081, "Backend port to kill for testing")
-		requests    = flag.Int("requests", 20, "Requests per phase")
-		skipKill    = flag.Bool("skip-kill", false, "Skip the kill backend phase")
+		lbURL        = flag.String("lb", "http://localhost:8080", "Load balancer URL")
+		backendPort  = flag.Int("backend-port", 8081, "Backend port to kill for testing")
+		requests     = flag.Int("requests", 20, "Requests per phase")
+		skipKill     = flag.Bool("skip-kill", false, "Skip the kill backend phase")
+		metricsToken = flag.String("metrics-token", "", "Bearer token for /metrics, if protected")
+		adminToken   = flag.String("admin-token", "", "Admin API token; when set, circuit breaker states are read from the admin API")
+		spawn        = flag.Bool("spawn-backends", true, "Run the test backends on ports 8081-8085 in-process")
 	)
 	flag.Parse()
 
+	var backends []*testbackend.Server
+	if *spawn {
+		var err error
+		backends, err = testbackend.StartRange(8081, 8085)
+		if err != nil {
+			fmt.Printf(colorRed+"  Could not start backends: %v\n"+colorReset, err)
+			fmt.Println("  Stop externally started backends or pass -spawn-backends=false.")
+			os.Exit(1)
+		}
+		defer testbackend.CloseAll(backends)
+		// Give the load balancer a health check interval to notice them.
+		time.Sleep(3 * time.Second)
+	}
+
 	client := &http.Client{Timeout: 5 * time.Second}
 
 	fmt.Println(colorCyan + "╔════════════════════════════════════════════════════════════════╗" + colorReset)
@@ -78,7 +102,7 @@ func main() {
 		fmt.Println(colorBlue + "━━━ PHASE 2: Backend Failure & Retry ━━━" + colorReset)
 		fmt.Printf("Killing backend on port %d...\n", *backendPort)
 
-		if err := killBackend(*backendPort); err != nil {
+		if err := killBackend(backends, *backendPort); err != nil {
 			fmt.Printf(colorYellow+"  Warning: Could not kill backend: %v\n"+colorReset, err)
 		} else {
 			fmt.Printf(colorGreen+"  ✓ Backend on port %d killed\n"+colorReset, *backendPort)
@@ -115,22 +139,34 @@ func main() {
 	fmt.Println(colorBlue + "━━━ PHASE 3: Circuit Breaker Status ━━━" + colorReset)
 	fmt.Println("Checking /metrics endpoint...")
 
-	metrics, err := getMetrics(client, *lbURL+"/metrics")
+	metricsClient := &metricsclient.Client{URL: *lbURL + "/metrics", Token: *metricsToken, HTTPClient: client}
+	snap, err := metricsClient.Fetch(context.Background())
 	if err != nil {
 		fmt.Printf(colorYellow+"  Could not fetch metrics: %v\n"+colorReset, err)
 	} else {
 		fmt.Println("\n  Backend health status:")
-		if backends, ok := metrics["backends"].(map[string]interface{}); ok {
-			for url, data := range backends {
-				if bs, ok := data.(map[string]interface{}); ok {
-					healthy := bs["healthy"].(bool)
-					reqs := int(bs["requests"].(float64))
-					status := colorGreen + "HEALTHY" + colorReset
-					if !healthy {
-						status = colorRed + "UNHEALTHY" + colorReset
-					}
-					fmt.Printf("    %s → %s (requests: %d)\n", url, status, reqs)
+		for url, bs := range snap.Backends {
+			status := colorGreen + "HEALTHY" + colorReset
+			if !bs.Healthy {
+				status = colorRed + "UNHEALTHY" + colorReset
+			}
+			fmt.Printf("    %s → %s (requests: %d)\n", url, status, bs.Requests)
+		}
+	}
+
+	if *adminToken != "" {
+		adminClient := &adminclient.Client{URL: *lbURL, Token: *adminToken, HTTPClient: client}
+		states, err := adminClient.Breakers(context.Background())
+		if err != nil {
+			fmt.Printf(colorYellow+"  Could not fetch circuit breakers: %v\n"+colorReset, err)
+		} else {
+			fmt.Println("\n  Circuit breakers:")
+			for name, state := range states {
+				color := colorGreen
+				if state != "CLOSED" {
+					color = colorRed
 				}
+				fmt.Printf("    %s → %s%s%s\n", name, color, state, colorReset)
 			}
 		}
 	}
@@ -185,38 +221,11 @@ func sendRequest(client *http.Client, url string) (*http.Response, string, error
 	return resp, backend, nil
 }
 
-func killBackend(port int) error {
-	cmd := exec.Command("lsof", "-ti", fmt.Sprintf(":%d", port))
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("no process found on port %d", port)
-	}
-
-	pid := strings.TrimSpace(string(output))
-	if pid == "" {
-		return fmt.Errorf("no process found on port %d", port)
-	}
-
-	killCmd := exec.Command("kill", pid)
-	return killCmd.Run()
-}
-
-func getMetrics(client *http.Client, url string) (map[string]interface{}, error) {
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var metrics map[string]interface{}
-	if err := json.Unmarshal(body, &metrics); err != nil {
-		return nil, err
+func killBackend(backends []*testbackend.Server, port int) error {
+	for _, b := range backends {
+		if b.Port() == port {
+			return b.Close()
+		}
 	}
-
-	return metrics, nil
+	return fmt.Errorf("backend on port %d is not managed by cbtest", port)
 }
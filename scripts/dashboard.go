@@ -0,0 +1,46 @@
+// dashboard writes a Grafana dashboard for the metrics the load balancer
+// pushes with metrics.remote_write, ready for Grafana's dashboard import.
+//
+// Usage:
+//
+//	go run dashboard.go -out lb-dashboard.json -selector 'job="lb"'
+//
+// Without -out the dashboard is written to stdout. -selector adds label
+// matchers to every query, for Prometheus servers holding several fleets.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/angeloszaimis/load-balancer/internal/dashboard"
+)
+
+func main() {
+	title := flag.String("title", "Load Balancer", "dashboard title")
+	uid := flag.String("uid", "", "dashboard UID, so re-imports replace the dashboard")
+	selector := flag.String("selector", "", `label matchers added to every query, e.g. job="lb"`)
+	refresh := flag.String("refresh", "30s", "dashboard refresh interval")
+	out := flag.String("out", "", "file to write, stdout when empty")
+	flag.Parse()
+
+	data, err := dashboard.Generate(dashboard.Options{
+		Title:    *title,
+		UID:      *uid,
+		Selector: *selector,
+		Refresh:  *refresh,
+	})
+	if err != nil {
+		log.Fatalf("generating dashboard: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatalf("writing %s: %v", *out, err)
+	}
+}